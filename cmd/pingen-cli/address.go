@@ -0,0 +1,239 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// addressWindows are the regions searched for the recipient, in millimetres
+// from the top-left corner of an A4 page. They are wider than the windows of
+// C5/DL envelopes so that both DIN 5008 layouts and Swiss right-window
+// letters are covered.
+var addressWindows = map[string][4]float64{
+	"left":  {15, 40, 110, 100},
+	"right": {100, 40, 200, 100},
+}
+
+// defaultAddressCountry is assumed when an address has no country line or
+// prefix, as is usual for domestic Swiss mail.
+const defaultAddressCountry = "CH"
+
+// detectedAddress is the recipient found in the address window of a PDF.
+type detectedAddress struct {
+	Lines         []string `json:"lines"`
+	Name          string   `json:"name,omitempty"`
+	Street        string   `json:"street,omitempty"`
+	Number        string   `json:"number,omitempty"`
+	POBox         string   `json:"pobox,omitempty"`
+	Zip           string   `json:"zip,omitempty"`
+	City          string   `json:"city,omitempty"`
+	Country       string   `json:"country,omitempty"`
+	CountrySource string   `json:"country_source,omitempty"` // line, prefix or default
+}
+
+var (
+	zipCityLine  = regexp.MustCompile(`^(?:([A-Z]{1,3})\s*-\s*)?(\d{4,5})\s+(.+)$`)
+	streetNumber = regexp.MustCompile(`^(.*\D)\s+(\d+\s?[A-Za-z]?(?:[-/]\d+[A-Za-z]?)?)$`)
+	poBoxLine    = regexp.MustCompile(`(?i)^(postfach|case postale|casella postale|p\.?\s?o\.?\s?box)\b`)
+)
+
+// salutations are lines printed above the name, e.g. "Herr" / "Max Muster".
+var salutations = map[string]bool{
+	"herr": true, "herrn": true, "frau": true, "monsieur": true, "madame": true,
+	"signor": true, "signora": true, "mr": true, "mrs": true, "ms": true,
+}
+
+// countryPrefixes are the postal prefixes written before the zip code.
+var countryPrefixes = map[string]string{"D": "DE", "A": "AT", "FL": "LI", "F": "FR", "I": "IT", "L": "LU", "B": "BE", "NL": "NL"}
+
+// inspectAddress extracts and parses the recipient in the address window of
+// the first page of the PDF at path.
+func inspectAddress(path, position string) (detectedAddress, error) {
+	runs, _, height, err := pingen.FirstPageText(path)
+	if err != nil {
+		return detectedAddress{}, err
+	}
+	window := addressWindows[position]
+	const points = 72 / 25.4
+	lines := pingen.TextLines(runs, window[0]*points, height-window[3]*points, window[2]*points, height-window[1]*points)
+	if len(lines) == 0 {
+		return detectedAddress{Lines: lines}, codedErrorf("PINGEN-INPUT-006", "could not detect the recipient address: no text in the %s address window of %s (scanned PDF?)", position, path)
+	}
+	return parseAddress(lines), nil
+}
+
+// parseAddress splits address lines into name, street, zip, city and country.
+// Lines that are not part of the recipient (franking, return address) are
+// skipped.
+func parseAddress(lines []string) detectedAddress {
+	address := detectedAddress{Lines: lines}
+	recipient := []string{}
+	for _, line := range lines {
+		if strings.HasPrefix(strings.ToUpper(line), "P.P.") || strings.Count(line, ",") >= 2 {
+			continue
+		}
+		recipient = append(recipient, line)
+	}
+	if len(recipient) > 0 {
+		if code, ok := pingen.NormalizeCountry(recipient[len(recipient)-1]); ok {
+			address.Country, address.CountrySource = code, "line"
+			recipient = recipient[:len(recipient)-1]
+		}
+	}
+	zipIndex := -1
+	for i := len(recipient) - 1; i >= 0; i-- {
+		if match := zipCityLine.FindStringSubmatch(recipient[i]); match != nil {
+			zipIndex = i
+			address.Zip, address.City = match[2], match[3]
+			if prefix := match[1]; prefix != "" && address.Country == "" {
+				code := prefix
+				if mapped, ok := countryPrefixes[prefix]; ok {
+					code = mapped
+				}
+				if len(code) == 2 {
+					address.Country, address.CountrySource = code, "prefix"
+				}
+			}
+			break
+		}
+	}
+	if zipIndex < 0 {
+		return address
+	}
+	if address.Country == "" {
+		address.Country, address.CountrySource = defaultAddressCountry, "default"
+	}
+	if zipIndex >= 1 {
+		street := recipient[zipIndex-1]
+		if poBoxLine.MatchString(street) {
+			address.POBox = street
+		} else if match := streetNumber.FindStringSubmatch(street); match != nil {
+			address.Street, address.Number = strings.TrimSpace(match[1]), match[2]
+		} else {
+			address.Street = street
+		}
+	}
+	for i := 0; i < zipIndex-1; i++ {
+		if !salutations[strings.ToLower(strings.TrimSuffix(recipient[i], "."))] {
+			address.Name = recipient[i]
+			break
+		}
+	}
+	return address
+}
+
+// checkAddressCountry implements --require-country: the destination detected
+// in the PDF must be one of allowed.
+func checkAddressCountry(path, position, allowed string) error {
+	address, err := inspectAddress(path, position)
+	if err != nil {
+		return err
+	}
+	if address.Country == "" {
+		return codedErrorf("PINGEN-INPUT-006", "could not detect the recipient address: no zip and city line in %q", strings.Join(address.Lines, " / "))
+	}
+	codes := []string{}
+	for _, code := range strings.Split(allowed, ",") {
+		codes = append(codes, strings.ToUpper(strings.TrimSpace(code)))
+	}
+	if !isAllowed(address.Country, codes) {
+		return codedErrorf("PINGEN-INPUT-006", "detected destination %s is not allowed by --require-country %s (address: %s)", address.Country, strings.Join(codes, ","), strings.Join(address.Lines, " / "))
+	}
+	return nil
+}
+
+// addressWarnings implements --validate-address: it returns what is likely to
+// send the letter to action_required, i.e. an empty address window, no zip
+// and city line, fields that break the postal rules of the detected country
+// and a country none of the organisation's delivery products serves. The
+// country is only checked with products set and not when the delivery
+// products cannot be loaded.
+func addressWarnings(ctx *appContext, path, position string, products bool) []string {
+	address, err := inspectAddress(path, position)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	if address.Country == "" {
+		return []string{fmt.Sprintf("could not detect the recipient address: no zip and city line in %q", strings.Join(address.Lines, " / "))}
+	}
+	verbosef(*ctx, "detected recipient: %s (country %s from %s)", strings.Join(address.Lines, " / "), address.Country, address.CountrySource)
+	warnings := []string{}
+	contact := pingen.Contact{Name: address.Name, Street: address.Street, Number: address.Number, POBox: address.POBox, Zip: address.Zip, City: address.City, Country: address.Country}
+	var invalid pingen.AddressError
+	if errors.As(pingen.ValidateAddress("", &contact), &invalid) {
+		for _, problem := range invalid.Problems {
+			warnings = append(warnings, fmt.Sprintf("detected recipient %s %s (address: %s)", problem.Field, problem.Message, strings.Join(address.Lines, " / ")))
+		}
+	}
+	if !products {
+		return warnings
+	}
+	catalog, err := deliveryProductCatalog(ctx, false)
+	if err != nil {
+		verbosef(*ctx, "not checking the destination country: %v", err)
+		return warnings
+	}
+	for _, item := range catalog {
+		if productServes(item, contact.Country) {
+			return warnings
+		}
+	}
+	return append(warnings, fmt.Sprintf("detected destination %s is not served by any delivery product of the organisation (see products list)", contact.Country))
+}
+
+func handleLettersInspectAddress(ctx appContext, args []string) int {
+	fs := flag.NewFlagSet("letters inspect-address", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	filePath := fs.String("file", "", "PDF file to inspect")
+	addressPos := fs.String("address-position", "left", "Address position (left/right)")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli letters inspect-address --file <path> [--address-position left|right]")
+		return 0
+	}
+	if *filePath == "" {
+		printErrorCode("PINGEN-INPUT-001", "--file is required")
+		return 2
+	}
+	if *addressPos != "left" && *addressPos != "right" {
+		printErrorCode("PINGEN-INPUT-001", "address-position must be left or right")
+		return 2
+	}
+	if err := pingen.PreflightPDF(*filePath, maxUploadSize(ctx)); err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	address, err := inspectAddress(*filePath, *addressPos)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	if ctx.global.jsonOutput {
+		return emitJSON(address)
+	}
+	for _, line := range address.Lines {
+		fmt.Println(line)
+	}
+	fmt.Println()
+	for _, field := range [][2]string{
+		{"name", address.Name}, {"street", strings.TrimSpace(address.Street + " " + address.Number)},
+		{"pobox", address.POBox}, {"zip", address.Zip}, {"city", address.City},
+	} {
+		if field[1] != "" {
+			fmt.Printf("%s:\t%s\n", field[0], field[1])
+		}
+	}
+	if address.Country != "" {
+		fmt.Printf("country:\t%s (%s)\n", address.Country, address.CountrySource)
+	}
+	return 0
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// settingSource names where a setting of the invocation comes from: the flag
+// or environment variable that set it, "keychain" or "config", or "" when it
+// is not set. It mirrors the precedence of run: flags over the environment over the
+// config file.
+func settingSource(flagName, flagValue, envName string, stored bool, keychain bool) string {
+	switch {
+	case flagValue != "":
+		return "--" + flagName
+	case envName != "" && os.Getenv(envName) != "":
+		return envName
+	case keychain:
+		return "keychain"
+	case stored:
+		return "config"
+	}
+	return ""
+}
+
+// handleAuthStatus shows which credentials the CLI would use and where each
+// comes from, and describes the access token from its JWT claims. It makes
+// no requests; `doctor` checks the token against the API.
+func handleAuthStatus(ctx appContext, args []string) int {
+	fs := flag.NewFlagSet("auth status", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli auth status")
+		return 0
+	}
+	stored, _, err := pingen.LoadConfig(ctx.configPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		printErrorCode("PINGEN-CONFIG-002", "failed to load config")
+		return 1
+	}
+	inKeychain := func(name string) bool { return isAllowed(name, stored.KeychainSecrets) }
+	global := ctx.global
+	settings := ctx.settings
+
+	envSource := settingSource("env", global.env, "PINGEN_ENV", stored.Env != "", false)
+	if envSource == "" {
+		envSource = "default"
+	}
+	identitySource := settingSource("identity-base", global.identityBase, "PINGEN_IDENTITY_BASE", stored.IdentityBase != "", false)
+	if identitySource == "" {
+		identitySource = "default for " + settings.Env
+	}
+	secretSource := settingSource("client-secret", global.clientSecret, "PINGEN_CLIENT_SECRET", stored.ClientSecret != "", inKeychain("client_secret"))
+	if global.clientSecretFile != "" {
+		secretSource = "--client-secret-file " + global.clientSecretFile
+	}
+	tokenSource := settingSource("access-token", global.accessToken, "PINGEN_ACCESS_TOKEN", stored.AccessToken != "", inKeychain("access_token"))
+	clientSource := settingSource("client-id", global.clientID, "PINGEN_CLIENT_ID", stored.ClientID != "", false)
+	refreshSource := settingSource("", "", "", stored.RefreshToken != "", inKeychain("refresh_token"))
+
+	status := map[string]any{
+		"config_path":   ctx.configPath,
+		"env":           map[string]any{"value": settings.Env, "source": envSource},
+		"identity_base": map[string]any{"value": settings.IdentityBase, "source": identitySource},
+		"client_id":     map[string]any{"value": settings.ClientID, "source": clientSource},
+		"client_secret": map[string]any{"set": settings.ClientSecret != "", "source": secretSource},
+		"refresh_token": map[string]any{"set": settings.RefreshToken != "", "source": refreshSource},
+	}
+	warnings := []string{}
+	token := map[string]any{"set": settings.AccessToken != "", "source": tokenSource}
+	var expiresAt time.Time
+	// The stored expiry only belongs to a token from the config.
+	if (tokenSource == "config" || tokenSource == "keychain") && settings.AccessTokenExpiresAt != 0 {
+		expiresAt = time.Unix(settings.AccessTokenExpiresAt, 0)
+	}
+	if settings.AccessToken != "" {
+		claims, err := pingen.TokenClaims(settings.AccessToken)
+		if err != nil {
+			warnings = append(warnings, err.Error()+"; scopes and client are unknown")
+		} else {
+			if exp, ok := int64Value(claims["exp"]); ok && exp > 0 {
+				expiresAt = time.Unix(exp, 0)
+			}
+			audience := claims["aud"]
+			if list, ok := audience.([]any); ok && len(list) > 0 {
+				audience = list[0]
+			}
+			if issued := stringValue(audience); issued != "" {
+				token["client_id"] = issued
+			}
+			if subject := stringValue(claims["sub"]); subject != "" {
+				token["subject"] = subject
+			}
+			if scopes := tokenScopes(claims); scopes != nil {
+				token["scopes"] = scopes
+			}
+			if issued := stringValue(token["client_id"]); issued != "" && settings.ClientID != "" && issued != settings.ClientID {
+				warnings = append(warnings, fmt.Sprintf("the access token (%s) was issued to client %s, not to the configured client %s", tokenSource, issued, settings.ClientID))
+			}
+		}
+		if token["scopes"] == nil && (tokenSource == "config" || tokenSource == "keychain") {
+			scope := settings.AccessTokenScope
+			if scope == "" {
+				scope = defaultScope
+			}
+			token["scopes"] = strings.Fields(scope)
+		}
+	}
+	expired := !expiresAt.IsZero() && time.Now().After(expiresAt)
+	if !expiresAt.IsZero() {
+		token["expires_at"] = expiresAt.In(displayLocation(ctx)).Format(time.RFC3339)
+		token["expired"] = expired
+	}
+	status["access_token"] = token
+
+	grant := ""
+	switch {
+	case settings.RefreshToken != "" && settings.ClientID != "":
+		grant = "authorization_code"
+	case settings.ClientID != "" && settings.ClientSecret != "":
+		grant = "client_credentials"
+	}
+	if grant != "" {
+		status["renewal"] = grant
+	}
+	usable := settings.AccessToken != "" && !expired || grant != ""
+	if !usable {
+		warnings = append(warnings, "no usable credentials: run `pingen-cli auth login`, `pingen-cli auth token --save` or pass --access-token")
+	}
+	if len(warnings) > 0 {
+		status["warnings"] = warnings
+	}
+	code := emitPayload(ctx, status, nil, func() {
+		fmt.Printf("config: %s\n", ctx.configPath)
+		fmt.Printf("env: %s (%s)\n", settings.Env, envSource)
+		fmt.Printf("identity base: %s (%s)\n", settings.IdentityBase, identitySource)
+		fmt.Printf("client id: %s\n", describeSetting(settings.ClientID, clientSource))
+		fmt.Printf("client secret: %s\n", describeSecret(settings.ClientSecret, secretSource))
+		fmt.Printf("access token: %s\n", describeSecret(settings.AccessToken, tokenSource))
+		if value, ok := token["expires_at"]; ok {
+			state := "valid until"
+			if expired {
+				state = "expired at"
+			}
+			fmt.Printf("  %s %s\n", state, value)
+		}
+		if value, ok := token["client_id"]; ok {
+			fmt.Printf("  issued to client: %s\n", value)
+		}
+		if value, ok := token["subject"]; ok {
+			fmt.Printf("  user: %s\n", value)
+		}
+		if scopes, ok := token["scopes"].([]string); ok {
+			fmt.Printf("  scopes: %s\n", strings.Join(scopes, " "))
+		}
+		fmt.Printf("refresh token: %s\n", describeSecret(settings.RefreshToken, refreshSource))
+		if grant != "" {
+			fmt.Printf("renewal: %s\n", grant)
+		} else {
+			fmt.Println("renewal: none")
+		}
+		for _, warning := range warnings {
+			logf("warn", "%s", warning)
+		}
+	})
+	if code == 0 && !usable {
+		return 1
+	}
+	return code
+}
+
+// tokenScopes reads the granted scopes from JWT claims, which carry them as
+// a "scopes" list or a space-separated "scope" string.
+func tokenScopes(claims map[string]any) []string {
+	if list, ok := claims["scopes"].([]any); ok {
+		scopes := make([]string, 0, len(list))
+		for _, scope := range list {
+			scopes = append(scopes, stringValue(scope))
+		}
+		return scopes
+	}
+	if scope := stringValue(claims["scope"]); scope != "" {
+		return strings.Fields(scope)
+	}
+	return nil
+}
+
+func describeSetting(value, source string) string {
+	if value == "" {
+		return "not set"
+	}
+	return fmt.Sprintf("%s (%s)", value, source)
+}
+
+func describeSecret(value, source string) string {
+	if value == "" {
+		return "not set"
+	}
+	return fmt.Sprintf("set (%s)", source)
+}
+
+// displayLocation is the zone for times the CLI prints: --tz or the config
+// timezone, otherwise the system zone.
+func displayLocation(ctx appContext) *time.Location {
+	if ctx.location != nil {
+		return ctx.location
+	}
+	return time.Local
+}
+
+// handleAuthRevoke removes the stored access and refresh tokens from the
+// config and the keychain, and with --credentials the client id and secret
+// as well. Pingen has no revocation endpoint, so a removed access token stays
+// valid at Pingen until it expires.
+func handleAuthRevoke(ctx appContext, args []string) int {
+	fs := flag.NewFlagSet("auth revoke", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	credentials := fs.Bool("credentials", false, "Remove the stored client id and secret as well")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli auth revoke [--credentials]")
+		return 0
+	}
+	removed := []string{}
+	var expiresAt int64
+	if ctx.configLoaded {
+		cfg, _, err := loadConfig(ctx.configPath)
+		if err != nil {
+			printErrorCode("PINGEN-CONFIG-002", "failed to load config")
+			return 1
+		}
+		expiresAt = cfg.AccessTokenExpiresAt
+		for _, field := range []struct {
+			name  string
+			value *string
+			clear bool
+		}{
+			{"access_token", &cfg.AccessToken, true},
+			{"refresh_token", &cfg.RefreshToken, true},
+			{"client_id", &cfg.ClientID, *credentials},
+			{"client_secret", &cfg.ClientSecret, *credentials},
+		} {
+			if field.clear && *field.value != "" {
+				removed = append(removed, field.name)
+				*field.value = ""
+			}
+		}
+		cfg.AccessTokenExpiresAt = 0
+		cfg.AccessTokenScope = ""
+		if len(removed) > 0 && !ctx.global.dryRun {
+			if err := saveConfig(ctx, cfg); err != nil {
+				reportError(ctx, err)
+				return 1
+			}
+		}
+	}
+	remaining := []string{}
+	if ctx.global.accessToken != "" {
+		remaining = append(remaining, "--access-token")
+	}
+	for _, name := range []string{"PINGEN_ACCESS_TOKEN", "PINGEN_CLIENT_SECRET"} {
+		if os.Getenv(name) != "" {
+			remaining = append(remaining, name)
+		}
+	}
+	result := map[string]any{
+		"dry_run":         ctx.global.dryRun,
+		"removed":         removed,
+		"revoked_at_api":  false,
+		"still_in_effect": remaining,
+	}
+	if expiresAt != 0 && isAllowed("access_token", removed) {
+		result["token_valid_until"] = time.Unix(expiresAt, 0).In(displayLocation(ctx)).Format(time.RFC3339)
+	}
+	return emitPayload(ctx, result, nil, func() {
+		verb := "Removed"
+		if ctx.global.dryRun {
+			verb = "Would remove"
+		}
+		if len(removed) == 0 {
+			fmt.Println("No stored tokens to remove.")
+		} else {
+			fmt.Printf("%s %s from %s.\n", verb, strings.Join(removed, ", "), ctx.configPath)
+		}
+		if until, ok := result["token_valid_until"]; ok {
+			fmt.Printf("Pingen has no revocation endpoint: the access token stays valid until %s. Reset the client secret in the Pingen web app to invalidate it sooner.\n", until)
+		}
+		if len(remaining) > 0 {
+			logf("warn", "still set outside the config: %s", strings.Join(remaining, ", "))
+		}
+	})
+}
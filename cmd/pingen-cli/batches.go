@@ -0,0 +1,640 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+var batchIcons = []string{"campaign", "megaphone", "wave-hand", "flash", "rocket", "bell", "percent-tag", "percent-badge", "present", "receipt", "document", "information", "calendar", "newspaper", "crown", "virus"}
+
+var batchSplitTypes = []string{"file", "page", "custom", "qr_invoice"}
+
+var countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+func handleBatches(ctx appContext, args []string) int {
+	if len(args) == 0 {
+		fmt.Println("batches requires a subcommand (create/list/get/add-attachment/send/cancel)")
+		return 2
+	}
+	switch args[0] {
+	case "create":
+		return handleBatchesCreate(ctx, args[1:])
+	case "list":
+		return handleBatchesList(ctx, args[1:])
+	case "get":
+		return handleBatchesGet(ctx, args[1:])
+	case "add-attachment":
+		return handleBatchesAddAttachment(ctx, args[1:])
+	case "send":
+		return handleBatchesSend(ctx, args[1:])
+	case "cancel":
+		return handleBatchesCancel(ctx, args[1:])
+	default:
+		fmt.Println("unknown batches subcommand")
+		return 2
+	}
+}
+
+// handleBatchesCreate uploads a PDF or ZIP file and creates a batch from it.
+// A ZIP becomes one letter per file; a PDF is split by --split-type.
+func handleBatchesCreate(ctx appContext, args []string) int {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("batches create", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	filePath := fs.String("file", "", "PDF to split into letters, or ZIP with one PDF per letter")
+	name := fs.String("name", "", "Batch name (default: the file name)")
+	icon := fs.String("icon", "document", "Icon shown in the web app")
+	fileName := fs.String("file-name", "", "Original file name (default: the file's base name)")
+	addressPos := fs.String("address-position", "left", "Address position: left or right")
+	splitType := fs.String("split-type", "", "How a PDF is split: page, custom (at --split-separator) or qr_invoice; a ZIP is split by file")
+	splitSize := fs.Int("split-size", 0, "Pages per letter with --split-type page")
+	splitSeparator := fs.String("split-separator", "", "Text marking a new letter with --split-type custom")
+	splitPosition := fs.String("split-position", "", "Page holding the separator with --split-type custom: first_page or last_page")
+	idempotencyKey := fs.String("idempotency-key", "", "Idempotency key for create request")
+	schemaOnly := fs.Bool("schema-only", false, "Validate the request body against its schema and exit without network calls")
+	payloadFile := fs.String("payload", "", "With --schema-only, validate this request body (JSON file or -) instead of one built from the flags")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli batches create --file <file.pdf|file.zip> [--name name] [--icon icon] [--file-name name] [--address-position left|right] [--split-type page|custom|qr_invoice] [--split-size N] [--split-separator text] [--split-position first_page|last_page] [--idempotency-key ...] [--schema-only [--payload file]]")
+		return 0
+	}
+	if *payloadFile != "" {
+		return validatePayloadFile(ctx, "batch-create", *payloadFile, *schemaOnly)
+	}
+	redactSecrets(*filePath, *fileName)
+	if *filePath == "" {
+		printErrorCode("PINGEN-INPUT-001", "--file is required")
+		return 2
+	}
+	if _, err := os.Stat(*filePath); err != nil {
+		printErrorCode("PINGEN-UPLOAD-001", "file not found")
+		return 2
+	}
+	groupingType := "merge"
+	if strings.EqualFold(filepath.Ext(*filePath), ".zip") {
+		groupingType = "zip"
+		if *splitType == "" {
+			*splitType = "file"
+		}
+	} else {
+		if *splitType == "" {
+			printErrorCode("PINGEN-INPUT-001", "--split-type is required for a PDF (page, custom or qr_invoice)")
+			return 2
+		}
+		if err := pingen.PreflightPDF(*filePath, maxUploadSize(ctx)); err != nil {
+			reportError(ctx, err)
+			return 2
+		}
+	}
+	if !isAllowed(*splitType, batchSplitTypes) {
+		printErrorCode("PINGEN-INPUT-001", fmt.Sprintf("invalid --split-type (use %s)", strings.Join(batchSplitTypes, ", ")))
+		return 2
+	}
+	if !isAllowed(*icon, batchIcons) {
+		printErrorCode("PINGEN-INPUT-001", fmt.Sprintf("invalid --icon (use %s)", strings.Join(batchIcons, ", ")))
+		return 2
+	}
+	originalName := *fileName
+	if originalName == "" {
+		originalName = filepath.Base(*filePath)
+	}
+	if *name == "" {
+		*name = strings.TrimSuffix(originalName, filepath.Ext(originalName))
+	}
+	attributes := map[string]any{
+		"name":                        *name,
+		"icon":                        *icon,
+		"file_original_name":          originalName,
+		"address_position":            *addressPos,
+		"grouping_type":               groupingType,
+		"grouping_options_split_type": *splitType,
+	}
+	if *splitSize > 0 {
+		attributes["grouping_options_split_size"] = *splitSize
+	}
+	if *splitSeparator != "" {
+		attributes["grouping_options_split_separator"] = *splitSeparator
+	}
+	if *splitPosition != "" {
+		attributes["grouping_options_split_position"] = *splitPosition
+	}
+	payload := map[string]any{"data": map[string]any{"type": "batches", "attributes": attributes}}
+	// As for letters create, the upload URL is only issued after validation.
+	attributes["file_url"] = "https://upload.invalid/pending"
+	attributes["file_url_signature"] = "pending"
+	err := pingen.ValidatePayload("batch-create", payload)
+	delete(attributes, "file_url")
+	delete(attributes, "file_url_signature")
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	if *schemaOnly {
+		return reportSchemaValid("batch-create")
+	}
+
+	if ctx.global.dryRun {
+		return emitDryRun(ctx, map[string]any{
+			"action":          "batches.create",
+			"file":            *filePath,
+			"organisation_id": ctx.settings.OrganisationID,
+			"attributes":      copyMap(attributes),
+		}, func(client pingen.Client) error {
+			uploadURL, signature, _, err := client.GetFileUpload(ctx.jobContext)
+			if err != nil {
+				return err
+			}
+			if err := client.UploadFile(ctx.jobContext, uploadURL, *filePath, 0); err != nil {
+				return err
+			}
+			attributes["file_url"] = uploadURL
+			attributes["file_url_signature"] = signature
+			_, _, err = client.CreateBatchRaw(ctx.jobContext, ctx.settings.OrganisationID, payload, *idempotencyKey)
+			return err
+		})
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	var stopSignals func()
+	ctx.jobContext, stopSignals = handleSignals(ctx.jobContext)
+	defer stopSignals()
+	client := newClient(ctx, token)
+	verbosef(ctx, "requesting upload url...")
+	uploadURL, signature, _, err := client.GetFileUpload(ctx.jobContext)
+	if err != nil {
+		reportError(ctx, err)
+		return interruptedCode(ctx, 1)
+	}
+	verbosef(ctx, "uploading %s...", *filePath)
+	progress := uploadProgress(ctx, &client)
+	err = client.UploadFile(ctx.jobContext, uploadURL, *filePath, uploadTimeout(ctx))
+	progress.finish()
+	if err != nil {
+		reportError(ctx, err)
+		return interruptedCode(ctx, 1)
+	}
+	attributes["file_url"] = uploadURL
+	attributes["file_url_signature"] = signature
+	verbosef(ctx, "creating batch %q...", *name)
+	resp, headers, err := client.CreateBatchRaw(ctx.jobContext, ctx.settings.OrganisationID, payload, *idempotencyKey)
+	if err != nil {
+		reportError(ctx, err)
+		return interruptedCode(ctx, 1)
+	}
+	return emitPayload(ctx, resp, headers, func() { printBatchSummary(resp) })
+}
+
+// handleBatchesAddAttachment uploads a PDF and appends it to every letter of
+// a batch, e.g. terms and conditions behind each invoice.
+func handleBatchesAddAttachment(ctx appContext, args []string) int {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("batches add-attachment", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	filePath := fs.String("file", "", "PDF to append to every letter")
+	pick := fs.Bool("pick", false, "Choose the batch interactively from the newest batches")
+	help := fs.Bool("help", false, "show help")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil || applyParsedDefaults(ctx, fs) != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli batches add-attachment <batch_id>|--pick --file <attachment.pdf>")
+		return 0
+	}
+	redactSecrets(*filePath)
+	if *filePath == "" {
+		printErrorCode("PINGEN-INPUT-001", "--file is required")
+		return 2
+	}
+	if err := pingen.PreflightPDF(*filePath, maxUploadSize(ctx)); err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	batchID, code := batchArgument(&ctx, positional, *pick)
+	if code != 0 {
+		return code
+	}
+	if ctx.global.dryRun {
+		return emitDryRun(ctx, map[string]any{
+			"action":          "batches.add-attachment",
+			"organisation_id": ctx.settings.OrganisationID,
+			"batch_id":        batchID,
+			"file":            *filePath,
+		}, func(client pingen.Client) error {
+			uploadURL, signature, _, err := client.GetFileUpload(ctx.jobContext)
+			if err != nil {
+				return err
+			}
+			if err := client.UploadFile(ctx.jobContext, uploadURL, *filePath, 0); err != nil {
+				return err
+			}
+			_, err = client.AddBatchAttachment(ctx.jobContext, ctx.settings.OrganisationID, batchID, uploadURL, signature)
+			return err
+		})
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	var stopSignals func()
+	ctx.jobContext, stopSignals = handleSignals(ctx.jobContext)
+	defer stopSignals()
+	client := newClient(ctx, token)
+	verbosef(ctx, "requesting upload url...")
+	uploadURL, signature, _, err := client.GetFileUpload(ctx.jobContext)
+	if err != nil {
+		reportError(ctx, err)
+		return interruptedCode(ctx, 1)
+	}
+	verbosef(ctx, "uploading %s...", *filePath)
+	progress := uploadProgress(ctx, &client)
+	err = client.UploadFile(ctx.jobContext, uploadURL, *filePath, uploadTimeout(ctx))
+	progress.finish()
+	if err != nil {
+		reportError(ctx, err)
+		return interruptedCode(ctx, 1)
+	}
+	verbosef(ctx, "adding attachment to batch %s...", batchID)
+	if _, err := client.AddBatchAttachment(ctx.jobContext, ctx.settings.OrganisationID, batchID, uploadURL, signature); err != nil {
+		reportError(ctx, err)
+		return interruptedCode(ctx, 1)
+	}
+	payload, headers, err := client.GetBatchRaw(ctx.jobContext, ctx.settings.OrganisationID, batchID)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	return emitPayload(ctx, payload, headers, func() { printBatchSummary(payload) })
+}
+
+func handleBatchesList(ctx appContext, args []string) int {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("batches list", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	page := fs.Int("page", 0, "Page number")
+	limit := fs.Int("limit", 0, "Page size")
+	sort := fs.String("sort", "", "Sort expression")
+	filter := fs.String("filter", "", "Filter JSON string or @path")
+	query := fs.String("q", "", "Full-text query")
+	var where stringList
+	fs.Var(&where, "where", "Filter clause (repeatable), see letters list")
+	since := fs.String("since", "", "Only batches created at or after this time")
+	until := fs.String("until", "", "Only batches created before this time")
+	all := fs.Bool("all", false, "Fetch every page of the listing")
+	maxPages := fs.Int("max-pages", 100, "Stop --all after this many pages (0: no limit)")
+	concurrency := fs.Int("concurrency", 4, "Pages fetched in parallel with --all")
+	sortBy := fs.String("sort-by", "", "Client-side stable sort by fields (e.g. created_at,id or -status)")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli batches list [--page N] [--limit N] [--sort expr] [--filter json] [--q query] [--sort-by fields] [--where clause]... [--since time] [--until time] [--all [--max-pages N] [--concurrency N]]")
+		return 0
+	}
+	if *all && *page > 0 {
+		printErrorCode("PINGEN-INPUT-001", "--all cannot be combined with --page")
+		return 2
+	}
+	if *maxPages < 0 {
+		printErrorCode("PINGEN-INPUT-001", "--max-pages must be at least 0")
+		return 2
+	}
+	if *concurrency < 1 {
+		printErrorCode("PINGEN-INPUT-001", "--concurrency must be at least 1")
+		return 2
+	}
+	rangeClauses, err := timeRangeClauses("created_at", *since, *until, inputLocation(ctx))
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	filterExpr, err := compileFilter(*filter, append(where, rangeClauses...))
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+	params := buildListParams(*page, *limit, *sort, filterExpr, *query, "", "", "batches")
+	if *all {
+		return listAllBatches(ctx, client, params, *sortBy, *maxPages, *concurrency)
+	}
+	payload, headers, err := client.ListBatchesRaw(ctx.jobContext, ctx.settings.OrganisationID, params)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	if *sortBy != "" {
+		data, _ := payload["data"].([]any)
+		sortResources(data, *sortBy)
+	}
+	return emitPayload(ctx, payload, headers, func() { printBatchRows(payload) })
+}
+
+// listAllBatches merges every page of a batches listing, fetching the pages
+// concurrency at a time once the page count is known, and orders the batches
+// by --sort-by or mergedSortOrder.
+func listAllBatches(ctx appContext, client pingen.Client, params map[string]string, sortBy string, maxPages, concurrency int) int {
+	if params["page[limit]"] == "" {
+		params["page[limit]"] = "100"
+	}
+	var mu sync.Mutex
+	var headers http.Header
+	items, pages, truncated, err := fetchPages(ctx.jobContext, concurrency, maxPages, func(page int) (map[string]any, error) {
+		payload, pageHeaders, err := client.ListBatchesRaw(ctx.jobContext, ctx.settings.OrganisationID, withPage(params, page))
+		mu.Lock()
+		headers = pageHeaders
+		mu.Unlock()
+		return payload, err
+	})
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	verbosef(ctx, "fetched %d pages", pages)
+	if truncated {
+		logf("warn", "stopped after %d pages (--max-pages); more batches are available", pages)
+	}
+	data := make([]any, 0, len(items))
+	for _, item := range items {
+		data = append(data, item)
+	}
+	if sortBy == "" {
+		sortBy = mergedSortOrder
+	}
+	sortResources(data, sortBy)
+	payload := map[string]any{"data": data, "meta": map[string]any{"pages": pages, "total": len(data), "truncated": truncated}}
+	return emitPayload(ctx, payload, headers, func() { printBatchRows(payload) })
+}
+
+func printBatchRows(payload map[string]any) {
+	data, _ := payload["data"].([]any)
+	for _, entry := range data {
+		item, _ := entry.(map[string]any)
+		attrs, _ := item["attributes"].(map[string]any)
+		fmt.Printf("%s\t%s\t%s\t%s\n", stringValue(item["id"]), stringValue(attrs["status"]), stringValue(attrs["letter_count"]), stringValue(attrs["name"]))
+	}
+}
+
+func handleBatchesGet(ctx appContext, args []string) int {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("batches get", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	pick := fs.Bool("pick", false, "Choose the batch interactively from the newest batches")
+	help := fs.Bool("help", false, "show help")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil || applyParsedDefaults(ctx, fs) != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli batches get <batch_id> | --pick")
+		return 0
+	}
+	batchID, code := batchArgument(&ctx, positional, *pick)
+	if code != 0 {
+		return code
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+	payload, headers, err := client.GetBatchRaw(ctx.jobContext, ctx.settings.OrganisationID, batchID)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	return emitPayload(ctx, payload, headers, func() {
+		item, _ := payload["data"].(map[string]any)
+		attrs, _ := item["attributes"].(map[string]any)
+		fmt.Println(stringValue(item["id"]))
+		fmt.Printf("name: %s\n", stringValue(attrs["name"]))
+		fmt.Printf("status: %s\n", stringValue(attrs["status"]))
+		fmt.Printf("letters: %s\n", stringValue(attrs["letter_count"]))
+		fmt.Printf("file: %s\n", stringValue(attrs["file_original_name"]))
+		fmt.Printf("created: %s\n", formatTimestamp(ctx, attrs["created_at"]))
+	})
+}
+
+// handleBatchesSend submits every letter of a batch. Batches mix destination
+// countries, so the delivery product is given per country.
+func handleBatchesSend(ctx appContext, args []string) int {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("batches send", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	var products stringList
+	fs.Var(&products, "delivery-product", "Delivery product per destination country, e.g. CH=cheap (repeatable)")
+	printMode := fs.String("print-mode", "", "Print mode")
+	printSpectrum := fs.String("print-spectrum", "", "Print spectrum")
+	idempotencyKey := fs.String("idempotency-key", "", "Idempotency key for send request")
+	schemaOnly := fs.Bool("schema-only", false, "Validate the request body against its schema and exit without network calls")
+	payloadFile := fs.String("payload", "", "With --schema-only, validate this request body (JSON file or -) instead of one built from the flags")
+	pick := fs.Bool("pick", false, "Choose the batch interactively when no id is given")
+	help := fs.Bool("help", false, "show help")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil || applyParsedDefaults(ctx, fs) != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli batches send <batch_id>|--pick --delivery-product CC=<product (see products list)>... --print-mode <simplex|duplex> --print-spectrum <color|grayscale> [--idempotency-key ...] [--schema-only [--payload file]]")
+		return 0
+	}
+	if *payloadFile != "" {
+		return validatePayloadFile(ctx, "batch-send", *payloadFile, *schemaOnly)
+	}
+	if len(products) == 0 || *printMode == "" || *printSpectrum == "" {
+		printErrorCode("PINGEN-INPUT-001", "delivery-product, print-mode, and print-spectrum are required")
+		return 2
+	}
+	deliveryProducts := []any{}
+	for _, value := range products {
+		country, product, ok := strings.Cut(value, "=")
+		country = strings.ToUpper(strings.TrimSpace(country))
+		if !ok || !countryCodePattern.MatchString(country) {
+			printErrorCode("PINGEN-INPUT-001", fmt.Sprintf("invalid delivery-product %q (use COUNTRY=product, e.g. CH=cheap)", value))
+			return 2
+		}
+		deliveryProducts = append(deliveryProducts, map[string]any{"country": country, "delivery_product": strings.TrimSpace(product)})
+	}
+	attributes := map[string]any{
+		"delivery_products": deliveryProducts,
+		"print_mode":        *printMode,
+		"print_spectrum":    *printSpectrum,
+	}
+	payload := map[string]any{"data": map[string]any{"id": "pending", "type": "batches", "attributes": attributes}}
+	if err := pingen.ValidatePayload("batch-send", payload); err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	if *schemaOnly {
+		return reportSchemaValid("batch-send")
+	}
+	for _, entry := range deliveryProducts {
+		entry := entry.(map[string]any)
+		product, err := checkDeliveryProduct(&ctx, entry["delivery_product"].(string), entry["country"].(string))
+		if err != nil {
+			reportError(ctx, err)
+			return 2
+		}
+		entry["delivery_product"] = product
+	}
+	batchID, code := batchArgument(&ctx, positional, *pick)
+	if code != 0 {
+		return code
+	}
+	payload["data"].(map[string]any)["id"] = batchID
+
+	if ctx.global.dryRun {
+		return emitDryRun(ctx, map[string]any{
+			"action":          "batches.send",
+			"organisation_id": ctx.settings.OrganisationID,
+			"batch_id":        batchID,
+			"attributes":      attributes,
+		}, func(client pingen.Client) error {
+			_, _, err := client.SendBatchRaw(ctx.jobContext, ctx.settings.OrganisationID, batchID, payload, *idempotencyKey)
+			return err
+		})
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+	resp, headers, err := client.SendBatchRaw(ctx.jobContext, ctx.settings.OrganisationID, batchID, payload, *idempotencyKey)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	return emitPayload(ctx, resp, headers, func() { printBatchSummary(resp) })
+}
+
+// handleBatchesCancel cancels the letters of a batch that are not printed
+// yet, after checking that Pingen allows it, and prints the batch.
+func handleBatchesCancel(ctx appContext, args []string) int {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("batches cancel", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	pick := fs.Bool("pick", false, "Choose the batch interactively from the newest batches")
+	help := fs.Bool("help", false, "show help")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil || applyParsedDefaults(ctx, fs) != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli batches cancel <batch_id>|--pick")
+		return 0
+	}
+	batchID, code := batchArgument(&ctx, positional, *pick)
+	if code != 0 {
+		return code
+	}
+	if ctx.global.dryRun {
+		return emitDryRun(ctx, map[string]any{
+			"action":          "batches.cancel",
+			"organisation_id": ctx.settings.OrganisationID,
+			"batch_id":        batchID,
+		}, func(client pingen.Client) error {
+			_, err := client.CancelBatch(ctx.jobContext, ctx.settings.OrganisationID, batchID)
+			return err
+		})
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+	batch, _, err := client.GetBatchRaw(ctx.jobContext, ctx.settings.OrganisationID, batchID)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	item, _ := batch["data"].(map[string]any)
+	attrs, _ := item["attributes"].(map[string]any)
+	if ability := resourceAbility(item, "cancel"); ability != "" && ability != "ok" {
+		printErrorCode("PINGEN-API-003", fmt.Sprintf("batch cannot be cancelled: %s (status %s)", ability, stringValue(attrs["status"])))
+		return 1
+	}
+	if _, err := client.CancelBatch(ctx.jobContext, ctx.settings.OrganisationID, batchID); err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	payload, headers, err := client.GetBatchRaw(ctx.jobContext, ctx.settings.OrganisationID, batchID)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	return emitPayload(ctx, payload, headers, func() { printBatchSummary(payload) })
+}
+
+// batchArgument returns the batch id given as first positional argument (a
+// unique prefix is enough) or chosen with --pick. A non-zero code is the
+// exit code after an error has been reported.
+func batchArgument(ctx *appContext, positional []string, pick bool) (string, int) {
+	var batchID string
+	var err error
+	switch {
+	case len(positional) > 0:
+		batchID, err = resolveBatchID(ctx, positional[0])
+	case pick:
+		batchID, err = pickResource(ctx, "batches")
+	default:
+		printErrorCode("PINGEN-INPUT-001", "batch id required")
+		return "", 2
+	}
+	if err != nil {
+		reportError(*ctx, err)
+		return "", 1
+	}
+	return batchID, 0
+}
+
+func printBatchSummary(payload map[string]any) {
+	data, ok := payload["data"].(map[string]any)
+	if !ok {
+		fmt.Println(payload)
+		return
+	}
+	attrs, _ := data["attributes"].(map[string]any)
+	fmt.Printf("%s\t%s\t%s\n", stringValue(data["id"]), stringValue(attrs["status"]), stringValue(attrs["name"]))
+}
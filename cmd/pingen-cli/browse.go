@@ -0,0 +1,719 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// browseSorts are the orders `o` cycles through in letters browse.
+var browseSorts = []string{"newest", "oldest", "status", "name"}
+
+// browseStatusColors highlights states that need attention or are final.
+var browseStatusColors = map[string]string{
+	"action_required": "\033[31m",
+	"invalid":         "\033[31m",
+	"undeliverable":   "\033[31m",
+	"expired":         "\033[31m",
+	"valid":           "\033[32m",
+	"sent":            "\033[2m",
+	"cancelled":       "\033[2m",
+}
+
+// browser is the state of the letters browse screen.
+type browser struct {
+	ctx    appContext
+	client pingen.Client
+	color  bool
+
+	letters  []map[string]any
+	visible  []map[string]any
+	changed  map[string]bool
+	loadedAt time.Time
+	loading  bool
+
+	query     []rune
+	filtering bool
+	sortIndex int
+	selected  int
+	offset    int
+
+	// detail is the letter shown in the detail view, or nil.
+	detail       map[string]any
+	detailOffset int
+	// confirm is the action waiting for y/n, running the confirmed one.
+	confirm *browseAction
+	running *browseAction
+	message string
+}
+
+// browseAction is a send, cancel or download the user has to confirm.
+type browseAction struct {
+	prompt string
+	run    func() (string, error)
+}
+
+// browseResult is the outcome of a background reload.
+type browseResult struct {
+	letters []map[string]any
+	err     error
+}
+
+// handleLettersBrowse shows the newest letters in a full-screen list that
+// reloads every --interval and highlights letters whose status changed. Keys
+// filter and sort the list, open a letter's details, and send, cancel or
+// download the selected letter.
+func handleLettersBrowse(ctx appContext, args []string) int {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("letters browse", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	limit := fs.Int("limit", 100, "Number of newest letters to show (at most 100)")
+	interval := fs.Duration("interval", 10*time.Second, "How often to reload the letters")
+	filter := fs.String("filter", "", "Filter JSON string or @path")
+	var where stringList
+	fs.Var(&where, "where", "Filter clause (repeatable), as in letters list")
+	since := fs.String("since", "", "Only letters created at or after this time (YYYY-MM-DD, RFC 3339 or 30d)")
+	sortOrder := fs.String("sort", "newest", "Initial order: newest, oldest, status or name")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli letters browse [--limit 100] [--interval 10s] [--where clause]... [--filter json] [--since time] [--sort newest|oldest|status|name]")
+		fmt.Println()
+		fmt.Println("Keys: Up/Down (k/j) move, Enter details, / filter, o sort, r reload,")
+		fmt.Println("      s send, c cancel, d download PDF, q quit")
+		return 0
+	}
+	if *limit < 1 || *limit > 100 {
+		printErrorCode("PINGEN-INPUT-001", "--limit must be between 1 and 100")
+		return 2
+	}
+	if *interval < time.Second {
+		printErrorCode("PINGEN-INPUT-001", "--interval must be at least 1s")
+		return 2
+	}
+	sortIndex := indexOf(browseSorts, *sortOrder)
+	if sortIndex < 0 {
+		printErrorCode("PINGEN-INPUT-001", "invalid --sort (use newest, oldest, status or name)")
+		return 2
+	}
+	if runtime.GOOS == "windows" || !stdinIsTerminal() || !stderrIsTerminal() {
+		printErrorCode("PINGEN-INPUT-001", "letters browse requires an interactive terminal; use letters list or watch letters in scripts")
+		return 2
+	}
+	rangeClauses, err := timeRangeClauses("created_at", *since, "", inputLocation(ctx))
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	filterExpr, err := compileFilter(*filter, append(where, rangeClauses...))
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	params := buildListParams(1, *limit, "-created_at", filterExpr, "", "", "", "letters")
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+
+	b := &browser{
+		ctx:       ctx,
+		client:    newClient(ctx, token),
+		color:     os.Getenv("NO_COLOR") == "",
+		changed:   map[string]bool{},
+		sortIndex: sortIndex,
+		loading:   true,
+	}
+	results := make(chan browseResult, 1)
+	reload := func() {
+		if b.loading && !b.loadedAt.IsZero() {
+			return
+		}
+		b.loading = true
+		go func() {
+			payload, _, err := b.client.ListLettersRaw(b.ctx.jobContext, ctx.settings.OrganisationID, params)
+			letters := []map[string]any{}
+			data, _ := payload["data"].([]any)
+			for _, entry := range data {
+				if item, ok := entry.(map[string]any); ok {
+					letters = append(letters, item)
+				}
+			}
+			results <- browseResult{letters: letters, err: err}
+		}()
+	}
+
+	restore, err := rawTerminal()
+	if err != nil {
+		printErrorCode("PINGEN-INPUT-001", fmt.Sprintf("letters browse requires an interactive terminal: %v", err))
+		return 2
+	}
+	fmt.Fprint(os.Stderr, "\033[?1049h")
+	defer func() {
+		fmt.Fprint(os.Stderr, "\033[?1049l")
+		restore()
+	}()
+
+	reload()
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	reader := bufio.NewReader(os.Stdin)
+	dirty := true
+	rows, columns := terminalSize()
+	sizeChecked := time.Now()
+	for {
+		select {
+		case result := <-results:
+			b.applyResult(result)
+			dirty = true
+		case <-ticker.C:
+			reload()
+			dirty = true
+		case <-ctx.jobContext.Done():
+			return 1
+		default:
+		}
+		// Resizes are noticed within a second; there is no SIGWINCH on all
+		// platforms stty runs on.
+		if time.Since(sizeChecked) >= time.Second {
+			newRows, newColumns := terminalSize()
+			dirty = dirty || newRows != rows || newColumns != columns
+			rows, columns, sizeChecked = newRows, newColumns, time.Now()
+		}
+		if dirty {
+			b.draw(rows, columns)
+			dirty = false
+		}
+		if action := b.running; action != nil {
+			b.running = nil
+			if message, err := action.run(); err != nil {
+				b.message = "error: " + err.Error()
+			} else {
+				b.message = message
+				reload()
+			}
+			dirty = true
+			continue
+		}
+		// Reads return io.EOF after 0.1s without input, so reloads are
+		// picked up while no key is pressed.
+		key, _, err := reader.ReadRune()
+		if err == io.EOF {
+			continue
+		}
+		if err != nil {
+			return 1
+		}
+		dirty = true
+		if key == 27 {
+			key = readEscapeKey(reader)
+		}
+		if !b.handleKey(key, reload) {
+			return 0
+		}
+	}
+}
+
+// Keys decoded from escape sequences; they do not collide with runes typed
+// on a keyboard.
+const (
+	keyEscape rune = -1 - iota
+	keyUp
+	keyDown
+	keyPageUp
+	keyPageDown
+	keyHome
+	keyEnd
+)
+
+// readEscapeKey decodes the arrow and paging keys that follow an Esc. A lone
+// Esc is not followed by another byte within the read timeout.
+func readEscapeKey(reader *bufio.Reader) rune {
+	next, _, err := reader.ReadRune()
+	if err != nil || (next != '[' && next != 'O') {
+		return keyEscape
+	}
+	code, _, _ := reader.ReadRune()
+	switch code {
+	case 'A':
+		return keyUp
+	case 'B':
+		return keyDown
+	case 'H':
+		return keyHome
+	case 'F':
+		return keyEnd
+	case '5', '6':
+		reader.ReadRune() // the trailing ~
+		if code == '5' {
+			return keyPageUp
+		}
+		return keyPageDown
+	}
+	return keyEscape
+}
+
+// handleKey applies key and reports whether the browser keeps running.
+func (b *browser) handleKey(key rune, reload func()) bool {
+	if key == 3 {
+		return false
+	}
+	if b.confirm != nil {
+		action := b.confirm
+		b.confirm = nil
+		if key == 'y' || key == 'Y' {
+			// The main loop runs it after showing this message.
+			b.message = action.prompt + " ..."
+			b.running = action
+		} else {
+			b.message = "aborted"
+		}
+		return true
+	}
+	if b.filtering {
+		switch key {
+		case '\r', '\n':
+			b.filtering = false
+		case keyEscape:
+			b.filtering = false
+			b.query = b.query[:0]
+		case 127, 8:
+			if len(b.query) > 0 {
+				b.query = b.query[:len(b.query)-1]
+			}
+		case 21:
+			b.query = b.query[:0]
+		default:
+			if key > 0 && unicode.IsPrint(key) {
+				b.query = append(b.query, key)
+			}
+		}
+		b.selected = 0
+		b.refreshVisible()
+		return true
+	}
+	b.message = ""
+	if b.detail != nil {
+		switch key {
+		case 'q', keyEscape, '\r', '\n', 127, 8:
+			b.detail = nil
+		case keyUp, 'k':
+			b.detailOffset--
+		case keyDown, 'j':
+			b.detailOffset++
+		default:
+			b.actionKey(key)
+		}
+		return true
+	}
+	switch key {
+	case 'q':
+		return false
+	case keyUp, 'k', 16:
+		b.selected--
+	case keyDown, 'j', 14:
+		b.selected++
+	case keyPageUp:
+		b.selected -= 10
+	case keyPageDown:
+		b.selected += 10
+	case keyHome, 'g':
+		b.selected = 0
+	case keyEnd, 'G':
+		b.selected = len(b.visible) - 1
+	case '/':
+		b.filtering = true
+	case keyEscape:
+		b.query = b.query[:0]
+		b.refreshVisible()
+	case 'o':
+		b.sortIndex = (b.sortIndex + 1) % len(browseSorts)
+		b.refreshVisible()
+		b.message = "sorted by " + browseSorts[b.sortIndex]
+	case 'r':
+		reload()
+	case '\r', '\n':
+		if letter := b.current(); letter != nil {
+			b.detail = letter
+			b.detailOffset = 0
+		}
+	default:
+		b.actionKey(key)
+	}
+	return true
+}
+
+// actionKey asks to confirm a send, cancel or download of the current letter.
+func (b *browser) actionKey(key rune) {
+	letter := b.current()
+	if b.detail != nil {
+		letter = b.detail
+	}
+	if letter == nil {
+		return
+	}
+	id := stringValue(letter["id"])
+	attrs, _ := letter["attributes"].(map[string]any)
+	switch key {
+	case 's':
+		if ability := resourceAbility(letter, "send"); ability != "" && ability != "ok" {
+			b.message = fmt.Sprintf("letter cannot be sent: %s (status %s)", ability, stringValue(attrs["status"]))
+			return
+		}
+		sendAttributes, missing := browseSendAttributes(b.ctx, attrs)
+		if len(missing) > 0 {
+			b.message = fmt.Sprintf("set %s first, e.g. pingen-cli config set defaults.letters.send.%s <value>", strings.Join(missing, ", "), missing[0])
+			return
+		}
+		b.confirm = &browseAction{
+			prompt: fmt.Sprintf("send %s (%s, %s, %s)", id, sendAttributes["delivery_product"], sendAttributes["print_mode"], sendAttributes["print_spectrum"]),
+			run: func() (string, error) {
+				if b.ctx.global.dryRun {
+					return "dry run: letter " + id + " not sent", nil
+				}
+				payload := map[string]any{"data": map[string]any{"id": id, "type": "letters", "attributes": sendAttributes}}
+				if _, _, err := b.client.SendLetterRaw(b.ctx.jobContext, b.ctx.settings.OrganisationID, id, payload, ""); err != nil {
+					return "", err
+				}
+				return "sent " + id, nil
+			},
+		}
+	case 'c':
+		if ability := resourceAbility(letter, "cancel"); ability != "" && ability != "ok" {
+			b.message = fmt.Sprintf("letter cannot be cancelled: %s (status %s)", ability, stringValue(attrs["status"]))
+			return
+		}
+		b.confirm = &browseAction{
+			prompt: "cancel " + id,
+			run: func() (string, error) {
+				if b.ctx.global.dryRun {
+					return "dry run: letter " + id + " not cancelled", nil
+				}
+				if _, err := b.client.CancelLetter(b.ctx.jobContext, b.ctx.settings.OrganisationID, id); err != nil {
+					return "", err
+				}
+				return "cancelling " + id, nil
+			},
+		}
+	case 'd':
+		path := id + ".pdf"
+		if _, err := os.Stat(path); err == nil {
+			b.message = path + " already exists"
+			return
+		}
+		b.confirm = &browseAction{
+			prompt: "download " + id + " to " + path,
+			run: func() (string, error) {
+				if b.ctx.global.dryRun {
+					return "dry run: " + path + " not downloaded", nil
+				}
+				fileURL, _, err := b.client.GetLetterFileURL(b.ctx.jobContext, b.ctx.settings.OrganisationID, id)
+				if err != nil {
+					return "", err
+				}
+				size, err := b.client.DownloadFile(b.ctx.jobContext, fileURL, path)
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("saved %s (%s)", path, pingen.FormatSize(size)), nil
+			},
+		}
+	}
+}
+
+// browseSendAttributes takes the delivery options from the letter, then from
+// the letters.send defaults of the config, and lists the missing ones as
+// flag names.
+func browseSendAttributes(ctx appContext, attrs map[string]any) (map[string]any, []string) {
+	sendAttributes := map[string]any{}
+	missing := []string{}
+	defaults := ctx.settings.Defaults["letters.send"]
+	for _, name := range []string{"delivery_product", "print_mode", "print_spectrum"} {
+		flagName := strings.ReplaceAll(name, "_", "-")
+		value := defaults[flagName]
+		if value == "" {
+			value = stringValue(attrs[name])
+		}
+		if value == "" {
+			missing = append(missing, flagName)
+			continue
+		}
+		sendAttributes[name] = value
+	}
+	return sendAttributes, missing
+}
+
+func (b *browser) applyResult(result browseResult) {
+	b.loading = false
+	if result.err != nil {
+		b.message = "reload failed: " + result.err.Error()
+		return
+	}
+	previous := map[string]string{}
+	for _, letter := range b.letters {
+		attrs, _ := letter["attributes"].(map[string]any)
+		previous[stringValue(letter["id"])] = stringValue(attrs["status"])
+	}
+	b.changed = map[string]bool{}
+	for _, letter := range result.letters {
+		id := stringValue(letter["id"])
+		attrs, _ := letter["attributes"].(map[string]any)
+		if before, ok := previous[id]; ok && before != stringValue(attrs["status"]) {
+			b.changed[id] = true
+		}
+		if b.detail != nil && stringValue(b.detail["id"]) == id {
+			b.detail = letter
+		}
+	}
+	if len(b.changed) > 0 && b.message == "" {
+		b.message = fmt.Sprintf("%d letter(s) changed status", len(b.changed))
+	}
+	selectedID := ""
+	if letter := b.current(); letter != nil {
+		selectedID = stringValue(letter["id"])
+	}
+	b.letters = result.letters
+	b.loadedAt = time.Now()
+	b.refreshVisible()
+	// Keep the cursor on the same letter when the list shifts.
+	for i, letter := range b.visible {
+		if stringValue(letter["id"]) == selectedID {
+			b.selected = i
+		}
+	}
+}
+
+// refreshVisible applies the filter query and the sort order.
+func (b *browser) refreshVisible() {
+	query := string(b.query)
+	b.visible = b.visible[:0]
+	for _, letter := range b.letters {
+		if _, ok := fuzzyScore(query, browseLabel(b.ctx, letter)); query == "" || ok {
+			b.visible = append(b.visible, letter)
+		}
+	}
+	field := map[string]string{"newest": "created_at", "oldest": "created_at", "status": "status", "name": "file_original_name"}[browseSorts[b.sortIndex]]
+	descending := browseSorts[b.sortIndex] == "newest"
+	sort.SliceStable(b.visible, func(i, j int) bool {
+		left := stringValue(resourceAttribute(b.visible[i], field))
+		right := stringValue(resourceAttribute(b.visible[j], field))
+		if descending {
+			return left > right
+		}
+		return left < right
+	})
+}
+
+func resourceAttribute(item map[string]any, name string) any {
+	attrs, _ := item["attributes"].(map[string]any)
+	return attrs[name]
+}
+
+func (b *browser) current() map[string]any {
+	if b.selected >= len(b.visible) {
+		b.selected = len(b.visible) - 1
+	}
+	if b.selected < 0 {
+		b.selected = 0
+	}
+	if len(b.visible) == 0 {
+		return nil
+	}
+	return b.visible[b.selected]
+}
+
+// browseLabel is the text the filter matches against.
+func browseLabel(ctx appContext, letter map[string]any) string {
+	attrs, _ := letter["attributes"].(map[string]any)
+	return strings.Join([]string{
+		stringValue(letter["id"]),
+		stringValue(attrs["status"]),
+		formatTimestamp(ctx, attrs["created_at"]),
+		stringValue(attrs["delivery_product"]),
+		stringValue(attrs["country"]),
+		stringValue(attrs["file_original_name"]),
+	}, "  ")
+}
+
+// draw renders the whole screen: a header, the list or the details, and a
+// status line with the key help or the pending question.
+func (b *browser) draw(rows, columns int) {
+	var frame strings.Builder
+	// Lines are overwritten in place and cleared to their end, which does
+	// not flicker like clearing the whole screen first.
+	frame.WriteString("\033[H")
+	line := func(text string) {
+		frame.WriteString(text)
+		frame.WriteString("\033[K\r\n")
+	}
+	header := fmt.Sprintf("pingen letters  org %s  %d/%d  sort: %s", b.ctx.settings.OrganisationID, len(b.visible), len(b.letters), browseSorts[b.sortIndex])
+	switch {
+	case b.loading && b.loadedAt.IsZero():
+		header += "  loading..."
+	case !b.loadedAt.IsZero():
+		header += "  updated " + b.loadedAt.Format("15:04:05")
+	}
+	line(b.paint("\033[1m", truncateRunes(header, columns)))
+	body := rows - 3
+	if body < 1 {
+		body = 1
+	}
+	if b.detail != nil {
+		b.drawDetail(line, body, columns)
+	} else {
+		b.drawList(line, body, columns)
+	}
+	frame.WriteString("\033[J")
+	var footer string
+	switch {
+	case b.confirm != nil:
+		footer = b.confirm.prompt + "? [y/N]"
+	case b.filtering:
+		footer = "filter> " + string(b.query)
+	case b.message != "":
+		footer = b.message
+	case b.detail != nil:
+		footer = "Esc back  Up/Down scroll  s send  c cancel  d download  Ctrl-C quit"
+	default:
+		footer = "Enter details  / filter  o sort  r reload  s send  c cancel  d download  q quit"
+		if len(b.query) > 0 {
+			footer = "filter: " + string(b.query) + " (Esc clears)  " + footer
+		}
+	}
+	fmt.Fprintf(&frame, "\033[%d;1H", rows)
+	frame.WriteString(b.paint("\033[7m", truncateRunes(footer, columns)))
+	frame.WriteString("\033[K")
+	fmt.Fprint(os.Stderr, frame.String())
+}
+
+func (b *browser) drawList(line func(string), body, columns int) {
+	line(b.paint("\033[2m", truncateRunes(fmt.Sprintf("  %-8s  %-16s  %-24s  %-10s  %-2s  %s", "ID", "STATUS", "CREATED", "PRODUCT", "CC", "FILE"), columns)))
+	body--
+	if len(b.visible) == 0 {
+		if !b.loading {
+			line("  no letters match")
+		}
+		return
+	}
+	b.current()
+	if b.selected < b.offset {
+		b.offset = b.selected
+	}
+	if b.selected >= b.offset+body {
+		b.offset = b.selected - body + 1
+	}
+	for i := b.offset; i < len(b.visible) && i < b.offset+body; i++ {
+		letter := b.visible[i]
+		attrs, _ := letter["attributes"].(map[string]any)
+		id := stringValue(letter["id"])
+		status := stringValue(attrs["status"])
+		marker := " "
+		if b.changed[id] {
+			marker = "*"
+		}
+		short := id
+		if len(short) > 8 {
+			short = short[:8]
+		}
+		text := fmt.Sprintf("%s %-8s  %-16s  %-24s  %-10s  %-2s  %s", marker, short, status, formatTimestamp(b.ctx, attrs["created_at"]), stringValue(attrs["delivery_product"]), stringValue(attrs["country"]), stringValue(attrs["file_original_name"]))
+		text = truncateRunes(text, columns)
+		switch {
+		case i == b.selected:
+			text = b.paint("\033[7m", text)
+		case b.changed[id]:
+			text = b.paint("\033[1m", text)
+		case browseStatusColors[status] != "":
+			text = b.paint(browseStatusColors[status], text)
+		}
+		line(text)
+	}
+}
+
+func (b *browser) drawDetail(line func(string), body, columns int) {
+	lines := browseDetailLines(b.ctx, b.detail)
+	if b.detailOffset > len(lines)-body {
+		b.detailOffset = len(lines) - body
+	}
+	if b.detailOffset < 0 {
+		b.detailOffset = 0
+	}
+	for i := b.detailOffset; i < len(lines) && i < b.detailOffset+body; i++ {
+		line(truncateRunes(lines[i], columns))
+	}
+}
+
+// browseDetailLines lists the id, the attributes in name order, the
+// abilities and the relationships of a letter.
+func browseDetailLines(ctx appContext, letter map[string]any) []string {
+	lines := []string{"id: " + stringValue(letter["id"])}
+	attrs, _ := letter["attributes"].(map[string]any)
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := attrs[name]
+		if strings.HasSuffix(name, "_at") {
+			value = formatTimestamp(ctx, value)
+		}
+		lines = append(lines, name+": "+browseValue(value))
+	}
+	if abilities, ok := lookupPath(letter, "meta.abilities.self"); ok {
+		lines = append(lines, "abilities: "+browseValue(abilities))
+	}
+	relationships, _ := letter["relationships"].(map[string]any)
+	names = names[:0]
+	for name := range relationships {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		related, _ := relationships[name].(map[string]any)
+		if linkage, ok := related["data"].(map[string]any); ok {
+			lines = append(lines, name+": "+stringValue(linkage["id"]))
+		}
+	}
+	return lines
+}
+
+// browseValue renders an attribute on one line; addresses keep their line
+// breaks visible as " / ".
+func browseValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "-"
+	case string:
+		return strings.ReplaceAll(strings.TrimSpace(v), "\n", " / ")
+	case map[string]any, []any:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(encoded)
+	}
+	return stringValue(value)
+}
+
+func (b *browser) paint(code, text string) string {
+	if !b.color {
+		return text
+	}
+	return code + text + "\033[0m"
+}
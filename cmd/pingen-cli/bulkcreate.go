@@ -0,0 +1,455 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// bulkCreateFields are the manifest fields read by letters bulk-create. CSV
+// and XLSX manifests may also set single meta data values with columns such
+// as meta_data.recipient.name.
+var bulkCreateFields = []string{"file", "file_name", "address_position", "auto_send", "delivery_product", "print_mode", "print_spectrum", "meta_data", "recipient", "sender", "idempotency_key"}
+
+// bulkRecord is one row of a manifest, with the line (CSV, XLSX, JSONL) or
+// list position (YAML) it came from.
+type bulkRecord struct {
+	row    int
+	fields map[string]any
+}
+
+// bulkEntry is one letter of `letters bulk-create`.
+type bulkEntry struct {
+	Row      int    `json:"row"`
+	File     string `json:"file"`
+	LetterID string `json:"letter_id,omitempty"`
+	Status   string `json:"status,omitempty"`
+	Result   string `json:"result"`
+	Error    string `json:"error,omitempty"`
+
+	attributes     map[string]any
+	idempotencyKey string
+}
+
+// handleLettersBulkCreate uploads and creates one letter per manifest row,
+// several at a time. Rows are checked before anything is uploaded; invalid
+// rows are reported as failed and the others still go ahead. Every row gets
+// an idempotency key derived from the manifest and the PDF, so re-running
+// the same manifest after a failure does not create letters twice.
+func handleLettersBulkCreate(ctx appContext, args []string) (exitCode int) {
+	fs := flag.NewFlagSet("letters bulk-create", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	manifest := fs.String("manifest", "", "CSV, XLSX, JSONL or YAML file with one letter per row")
+	columnMap := fs.String("column-map", "", "Columns of non-standard CSV/XLSX layouts, e.g. file=A,delivery_product=C")
+	concurrency := fs.Int("concurrency", 4, "Letters uploaded and created in parallel")
+	reportOptions := addReportFlags(fs)
+	hooks := addHookFlags(fs)
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli letters bulk-create --manifest file.csv|file.xlsx|file.jsonl|file.yaml [--column-map field=column,...] [--concurrency N] [--report-dir dir [--csv-delimiter c] [--decimal-comma]] [--on-success cmd] [--on-failure cmd]")
+		return 0
+	}
+	// The hooks run once for the whole manifest; PINGEN_FILE_PATH is the
+	// manifest and PINGEN_ERROR counts the letters not created.
+	event := hookEvent{command: "letters bulk-create", filePath: *manifest}
+	defer func() { hooks.run(ctx, event, exitCode) }()
+	if ctx.settings.OrganisationID == "" {
+		return event.fail("PINGEN-INPUT-001", "organisation id required", 2)
+	}
+	if *manifest == "" {
+		return event.fail("PINGEN-INPUT-001", "--manifest is required", 2)
+	}
+	if *concurrency < 1 {
+		return event.fail("PINGEN-INPUT-001", "--concurrency must be at least 1", 2)
+	}
+	records, err := readBulkManifest(*manifest, *columnMap)
+	if err != nil {
+		return event.failErr(ctx, err, 2)
+	}
+	if reportOptions.dir == "" {
+		reportOptions.dir = filepath.Dir(*manifest)
+	}
+	manifestPath, err := filepath.Abs(*manifest)
+	if err != nil {
+		manifestPath = *manifest
+	}
+
+	entries := make([]bulkEntry, 0, len(records))
+	for _, record := range records {
+		entry := bulkEntry{Row: record.row, File: stringValue(record.fields["file"])}
+		if err := prepareBulkEntry(ctx, &entry, record, filepath.Dir(*manifest), manifestPath); err != nil {
+			entry.Result = "failed"
+			entry.Error = err.Error()
+		}
+		entries = append(entries, entry)
+	}
+	exitCode = createBulkEntries(ctx, "letters bulk-create", "manifest", *manifest, entries, *concurrency, reportOptions)
+	if exitCode != 0 && event.message == "" {
+		notCreated := 0
+		for _, entry := range entries {
+			if entry.Result != "created" {
+				notCreated++
+			}
+		}
+		event.message = fmt.Sprintf("%d of %d letters not created", notCreated, len(entries))
+	}
+	return exitCode
+}
+
+// createBulkEntries uploads and creates the prepared entries of a bulk run,
+// several at a time, and reports them. sourceKey and source name the input
+// (e.g. the manifest) in the dry-run plan and the JSON output; entries that
+// already failed are reported but not sent.
+func createBulkEntries(ctx appContext, command, sourceKey, source string, entries []bulkEntry, concurrency int, reportOptions *reportOptions) (exitCode int) {
+	if ctx.global.dryRun {
+		planned := []any{}
+		for _, entry := range entries {
+			item := map[string]any{"row": entry.Row, "file": entry.File, "result": entry.Result, "error": entry.Error, "attributes": entry.attributes}
+			if entry.Result == "" {
+				upload := pingen.LetterUpload{Path: entry.File, Attributes: copyMap(entry.attributes), IdempotencyKey: entry.idempotencyKey}
+				requests, err := previewRequests(ctx, previewLetterUpload(ctx, upload))
+				if err != nil {
+					reportError(ctx, err)
+					return 1
+				}
+				item["requests"] = requests
+			}
+			planned = append(planned, item)
+		}
+		return emitJSON(redactPayload(map[string]any{
+			"action":          strings.ReplaceAll(command, " ", "."),
+			"organisation_id": ctx.settings.OrganisationID,
+			sourceKey:         source,
+			"letters":         planned,
+		}))
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+	report := newRunReport(ctx, command)
+	defer func() {
+		for _, entry := range entries {
+			report.add(reportItem{Input: fmt.Sprintf("row %d: %s", entry.Row, entry.File), LetterID: entry.LetterID, Status: entry.Status, Result: entry.Result, Error: entry.Error})
+		}
+		report.write(ctx, reportOptions, exitCode)
+	}()
+	var stopSignals func()
+	ctx.jobContext, stopSignals = handleSignals(ctx.jobContext)
+	defer stopSignals()
+
+	endGroup := func() {}
+	if !ctx.global.jsonOutput {
+		endGroup = ciGroup(ctx, fmt.Sprintf("%s: %d letters", command, len(entries)))
+		for _, entry := range entries {
+			if entry.Result == "failed" {
+				printBulkEntry(entry)
+			}
+		}
+	}
+	todo := []int{}
+	uploads := []pingen.LetterUpload{}
+	for i, entry := range entries {
+		if entry.Result == "" {
+			todo = append(todo, i)
+			uploads = append(uploads, pingen.LetterUpload{Path: entry.File, Attributes: entry.attributes, IdempotencyKey: entry.idempotencyKey})
+		}
+	}
+	client.CreateLettersFromFilesRaw(ctx.jobContext, ctx.settings.OrganisationID, uploads, concurrency, uploadTimeout(ctx), func(j int, letter map[string]any, err error) {
+		entry := &entries[todo[j]]
+		if err != nil {
+			entry.Result = "failed"
+			if ctx.jobContext.Err() != nil {
+				entry.Result = "pending"
+			}
+			entry.Error = err.Error()
+		} else {
+			item, _ := letter["data"].(map[string]any)
+			attrs, _ := item["attributes"].(map[string]any)
+			entry.LetterID = stringValue(item["id"])
+			entry.Status = stringValue(attrs["status"])
+			entry.Result = "created"
+		}
+		if !ctx.global.jsonOutput && entry.Result != "pending" {
+			printBulkEntry(*entry)
+		}
+	})
+	for _, i := range todo {
+		if entries[i].Result == "" {
+			entries[i].Result = "pending"
+		}
+	}
+	endGroup()
+
+	counts := map[string]int{}
+	for _, entry := range entries {
+		counts[entry.Result]++
+		if entry.Result == "failed" {
+			annotatef("error", "row %d: %s: %s", entry.Row, entry.File, entry.Error)
+		}
+	}
+	if ctx.global.jsonOutput {
+		emitJSON(map[string]any{"organisation_id": ctx.settings.OrganisationID, sourceKey: source, "letters": entries})
+	} else if !ctx.global.quiet {
+		logf("info", "%d created, %d failed", counts["created"], counts["failed"])
+	}
+	if counts["pending"] > 0 {
+		logf("info", "stopped early: %d letters pending; re-run the same command to resume", counts["pending"])
+	}
+	if interrupted(ctx) {
+		return exitInterrupted
+	}
+	if counts["failed"] > 0 || counts["pending"] > 0 {
+		return 1
+	}
+	return 0
+}
+
+func printBulkEntry(entry bulkEntry) {
+	detail := entry.LetterID
+	if entry.Error != "" {
+		detail = entry.Error
+	}
+	fmt.Printf("%d\t%s\t%s\t%s\n", entry.Row, entry.File, entry.Result, detail)
+}
+
+// prepareBulkEntry resolves the entry's file relative to the manifest and
+// builds and validates its create attributes, the same way letters create
+// does for its flags.
+func prepareBulkEntry(ctx appContext, entry *bulkEntry, record bulkRecord, baseDir, manifestPath string) error {
+	fields := record.fields
+	if entry.File == "" {
+		return fmt.Errorf("no file given")
+	}
+	if !filepath.IsAbs(entry.File) {
+		entry.File = filepath.Join(baseDir, entry.File)
+	}
+	if _, err := os.Stat(entry.File); err != nil {
+		return codedErrorf("PINGEN-UPLOAD-001", "file not found: %s", entry.File)
+	}
+	if err := pingen.PreflightPDF(entry.File, maxUploadSize(ctx)); err != nil {
+		return err
+	}
+	attributes := map[string]any{
+		"file_original_name": stringValue(fields["file_name"]),
+		"address_position":   stringValue(fields["address_position"]),
+		"auto_send":          false,
+	}
+	if attributes["file_original_name"] == "" {
+		attributes["file_original_name"] = pingen.DefaultFileName(entry.File)
+	}
+	if attributes["address_position"] == "" {
+		attributes["address_position"] = "left"
+	}
+	if !isAllowed(stringValue(attributes["address_position"]), []string{"left", "right"}) {
+		return fmt.Errorf("address_position must be left or right")
+	}
+	if value, ok := fields["auto_send"]; ok && stringValue(value) != "" {
+		autoSend, err := strconv.ParseBool(stringValue(value))
+		if err != nil {
+			return fmt.Errorf("auto_send must be true or false")
+		}
+		attributes["auto_send"] = autoSend
+	}
+	if value := stringValue(fields["delivery_product"]); value != "" {
+		product, err := checkDeliveryProduct(&ctx, value, "")
+		if err != nil {
+			return err
+		}
+		attributes["delivery_product"] = product
+	}
+	if err := checkPageLimit(ctx, entry.File, stringValue(attributes["delivery_product"])); err != nil {
+		return err
+	}
+	allowed := map[string][]string{
+		"print_mode":     {"simplex", "duplex"},
+		"print_spectrum": {"color", "grayscale"},
+	}
+	for _, key := range []string{"print_mode", "print_spectrum"} {
+		value := stringValue(fields[key])
+		if value == "" {
+			continue
+		}
+		if !isAllowed(value, allowed[key]) {
+			return fmt.Errorf("invalid %s %q (use %s)", key, value, strings.Join(allowed[key], ", "))
+		}
+		attributes[key] = value
+	}
+	var metaData map[string]any
+	switch value := fields["meta_data"].(type) {
+	case nil:
+	case map[string]any:
+		metaData = value
+	case string:
+		if value != "" {
+			if err := json.Unmarshal([]byte(value), &metaData); err != nil {
+				return fmt.Errorf("meta_data is not a JSON object: %v", err)
+			}
+		}
+	default:
+		return fmt.Errorf("meta_data must be an object")
+	}
+	metaData, err := applyContacts(ctx, metaData, stringValue(fields["recipient"]), stringValue(fields["sender"]))
+	if err != nil {
+		return err
+	}
+	if err := validateMetaAddresses(metaData); err != nil {
+		return err
+	}
+	if metaData != nil {
+		attributes["meta_data"] = metaData
+	}
+	payload := map[string]any{"data": map[string]any{"type": "letters", "attributes": attributes}}
+	attributes["file_url"] = "https://upload.invalid/pending"
+	attributes["file_url_signature"] = "pending"
+	err = pingen.ValidatePayload("letter-create", payload)
+	delete(attributes, "file_url")
+	delete(attributes, "file_url_signature")
+	if err != nil {
+		return err
+	}
+	entry.attributes = attributes
+
+	entry.idempotencyKey = stringValue(fields["idempotency_key"])
+	if entry.idempotencyKey == "" {
+		_, digest, err := fileDigest(entry.File)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%s/%s/%d/%s", ctx.settings.OrganisationID, manifestPath, record.row, digest)))
+		entry.idempotencyKey = "bulk-" + hex.EncodeToString(sum[:16])
+	}
+	return nil
+}
+
+// readBulkManifest reads the rows of a bulk-create manifest: JSONL (.jsonl,
+// .ndjson) and YAML (.yaml, .yml) hold one object per letter, anything else is
+// read as a CSV or XLSX table.
+func readBulkManifest(path, columnMap string) ([]bulkRecord, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".jsonl" && ext != ".ndjson" && ext != ".yaml" && ext != ".yml" {
+		return readBulkTable(path, columnMap)
+	}
+	if columnMap != "" {
+		return nil, codedErrorf("PINGEN-INPUT-001", "invalid --column-map: only CSV and XLSX manifests have columns")
+	}
+	var objects []map[string]any
+	if ext == ".jsonl" || ext == ".ndjson" {
+		var err error
+		if objects, err = readJSONL(path); err != nil {
+			return nil, err
+		}
+	} else {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, codedErrorf("PINGEN-INPUT-001", "failed to read manifest: %w", err)
+		}
+		document, err := pingen.ParseYAML(data)
+		if err != nil {
+			return nil, codedErrorf("PINGEN-INPUT-001", "invalid manifest %s: %w", path, err)
+		}
+		// Either a list of letters or a mapping with a letters list.
+		if mapping, ok := document.(map[string]any); ok {
+			document = mapping["letters"]
+		}
+		list, ok := document.([]any)
+		if !ok {
+			return nil, codedErrorf("PINGEN-INPUT-001", "invalid manifest %s: expected a list of letters", path)
+		}
+		for i, item := range list {
+			object, ok := item.(map[string]any)
+			if !ok {
+				return nil, codedErrorf("PINGEN-INPUT-001", "invalid manifest row %d: expected a mapping", i+1)
+			}
+			objects = append(objects, object)
+		}
+	}
+	records := make([]bulkRecord, 0, len(objects))
+	for i, object := range objects {
+		unknown := []string{}
+		for key := range object {
+			if !isAllowed(key, bulkCreateFields) {
+				unknown = append(unknown, key)
+			}
+		}
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			return nil, codedErrorf("PINGEN-INPUT-001", "invalid manifest row %d: unknown field %s (use %s)", i+1, strings.Join(unknown, ", "), strings.Join(bulkCreateFields, ", "))
+		}
+		records = append(records, bulkRecord{row: i + 1, fields: object})
+	}
+	return records, nil
+}
+
+// readBulkTable reads a CSV or XLSX manifest. Columns named
+// meta_data.<path> set single meta data values, e.g. meta_data.recipient.zip.
+func readBulkTable(path, columnMap string) ([]bulkRecord, error) {
+	columns, err := pingen.ParseColumnMap(columnMap)
+	if err != nil {
+		return nil, withCode("PINGEN-INPUT-001", err)
+	}
+	table, err := pingen.ReadTable(path)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := table.Records(bulkCreateFields, columns)
+	if err != nil {
+		return nil, withCode("PINGEN-INPUT-001", err)
+	}
+	records := make([]bulkRecord, 0, len(rows))
+	for i, row := range rows {
+		fields := map[string]any{}
+		for key, value := range row {
+			if value != "" {
+				fields[key] = value
+			}
+		}
+		var meta map[string]any
+		for column, name := range table.Header {
+			metaPath, ok := strings.CutPrefix(name, "meta_data.")
+			if !ok || column >= len(table.Rows[i]) || strings.TrimSpace(table.Rows[i][column]) == "" {
+				continue
+			}
+			if fields["meta_data"] != nil {
+				return nil, codedErrorf("PINGEN-INPUT-001", "invalid manifest row %d: use either a meta_data column or meta_data.* columns", table.Lines[i])
+			}
+			if meta == nil {
+				meta = map[string]any{}
+			}
+			setNestedValue(meta, strings.Split(metaPath, "."), strings.TrimSpace(table.Rows[i][column]))
+		}
+		if meta != nil {
+			fields["meta_data"] = meta
+		}
+		records = append(records, bulkRecord{row: table.Lines[i], fields: fields})
+	}
+	return records, nil
+}
+
+// setNestedValue sets target[path[0]][path[1]]... = value, creating the
+// intermediate objects.
+func setNestedValue(target map[string]any, path []string, value any) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := target[key].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			target[key] = next
+		}
+		target = next
+	}
+	target[path[len(path)-1]] = value
+}
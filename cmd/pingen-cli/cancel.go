@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// handleLettersCancel pulls back a submitted letter before it is printed.
+// The letter's abilities are checked first, so a letter that can no longer be
+// cancelled fails with the reason Pingen gives instead of a bare 4xx.
+func handleLettersCancel(ctx appContext, args []string) int {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("letters cancel", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	pick := fs.Bool("pick", false, "Choose the letter interactively from the newest letters")
+	help := fs.Bool("help", false, "show help")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil || applyParsedDefaults(ctx, fs) != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli letters cancel <letter_id>|--pick")
+		return 0
+	}
+	var letterID string
+	switch {
+	case len(positional) > 0:
+		letterID, err = resolveLetterID(&ctx, positional[0])
+	case *pick:
+		letterID, err = pickResource(&ctx, "letters")
+	default:
+		printErrorCode("PINGEN-INPUT-001", "letter id required")
+		return 2
+	}
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+
+	if ctx.global.dryRun {
+		return emitDryRun(ctx, map[string]any{
+			"action":          "letters.cancel",
+			"organisation_id": ctx.settings.OrganisationID,
+			"letter_id":       letterID,
+		}, func(client pingen.Client) error {
+			_, err := client.CancelLetter(ctx.jobContext, ctx.settings.OrganisationID, letterID)
+			return err
+		})
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+	letter, _, err := client.GetLetterRaw(ctx.jobContext, ctx.settings.OrganisationID, letterID)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	item, _ := letter["data"].(map[string]any)
+	attrs, _ := item["attributes"].(map[string]any)
+	if ability := resourceAbility(item, "cancel"); ability != "" && ability != "ok" {
+		printErrorCode("PINGEN-API-003", fmt.Sprintf("letter cannot be cancelled: %s (status %s)", ability, stringValue(attrs["status"])))
+		return 1
+	}
+	if _, err := client.CancelLetter(ctx.jobContext, ctx.settings.OrganisationID, letterID); err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	// Cancelling is asynchronous; the letter usually reports "cancelling"
+	// until Pingen has pulled it from the print run.
+	payload, headers, err := client.GetLetterRaw(ctx.jobContext, ctx.settings.OrganisationID, letterID)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	return emitPayload(ctx, payload, headers, func() { printLetterSummary(payload) })
+}
+
+// resourceAbility returns what Pingen says about an action on a letter or
+// batch: "ok" when allowed, otherwise the reason, or "" when the response has
+// no abilities. They are found under meta.abilities.self or meta.abilities.
+func resourceAbility(item map[string]any, action string) string {
+	for _, path := range []string{"meta.abilities.self." + action, "meta.abilities." + action} {
+		if value, ok := lookupPath(item, path); ok {
+			return stringValue(value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// catalogEntry documents a stable error code for `explain`. Errors carry their
+// code from where they are raised (codedErrorf, printErrorCode) or get it from
+// their type in codeForError. Codes are part of the CLI's public contract:
+// never renumber or reuse them, only add new ones.
+type catalogEntry struct {
+	Code        string
+	Title       string
+	Causes      []string
+	Remediation []string
+}
+
+var errorCatalog = []catalogEntry{
+	{
+		Code:        "PINGEN-CONFIG-001",
+		Title:       "Config path could not be resolved",
+		Causes:      []string{"The home directory is unknown (HOME/USERPROFILE unset)."},
+		Remediation: []string{"Set HOME, or point PINGEN_CONFIG_PATH at a config file."},
+	},
+	{
+		Code:        "PINGEN-CONFIG-002",
+		Title:       "Config file could not be read",
+		Causes:      []string{"The config file is not valid JSON.", "The file is not readable by the current user.", "A local state file (queue job, journal, schedule state, contacts) cannot be read."},
+		Remediation: []string{"Inspect the file shown by `pingen-cli config show`, fix or remove it."},
+	},
+	{
+		Code:        "PINGEN-CONFIG-003",
+		Title:       "Config file could not be written",
+		Causes:      []string{"The config directory is not writable.", "The disk is full."},
+		Remediation: []string{"Check permissions of the config directory or set PINGEN_CONFIG_PATH."},
+	},
+	{
+		Code:        "PINGEN-CONFIG-004",
+		Title:       "Invalid environment",
+		Causes:      []string{"--env, PINGEN_ENV or the config env is neither staging nor production."},
+		Remediation: []string{"Use --env staging or --env production."},
+	},
+	{
+		Code:        "PINGEN-CONFIG-005",
+		Title:       "Unknown saved preset, template or local entry",
+		Causes:      []string{"The named filter preset, template, contact, schedule, queue job or journal entry does not exist, or an id prefix matches several jobs or entries."},
+		Remediation: []string{"List them with `pingen-cli filters list`, `templates list`, `contacts list`, `schedule list`, `queue list` or `journal list`."},
+	},
+	{
+		Code:        "PINGEN-CONFIG-006",
+		Title:       "Invalid timezone",
+		Causes:      []string{"--tz, PINGEN_TZ or the config timezone is not an IANA zone name."},
+		Remediation: []string{"Use a name like Europe/Zurich or UTC."},
+	},
+	{
+		Code:        "PINGEN-CONFIG-007",
+		Title:       "Local state could not be purged",
+		Causes:      []string{"A cache, journal or audit file is not writable by the current user.", "HOME is unset so the state directories cannot be resolved."},
+		Remediation: []string{"Fix the permissions of the listed path and re-run `pingen-cli purge`."},
+	},
+	{
+		Code:        "PINGEN-CONFIG-008",
+		Title:       "Config location not private",
+		Causes:      []string{"The config directory is writable by group or others, so secrets written there could be swapped or read."},
+		Remediation: []string{"Run `pingen-cli config fix-permissions`, chmod the directory to 0700, or pass --force."},
+	},
+	{
+		Code:        "PINGEN-CONFIG-009",
+		Title:       "Invalid command default or letter template",
+		Causes:      []string{"The config defaults or letter_templates section names a flag the command does not have, or a value the flag rejects."},
+		Remediation: []string{"Inspect `pingen-cli config show` and correct or remove the entry, or re-save the template with `pingen-cli templates save`."},
+	},
+	{
+		Code:        "PINGEN-CONFIG-010",
+		Title:       "Queue job or journal entry cannot change state",
+		Causes:      []string{"Only pending jobs can be cancelled and only failed or cancelled jobs retried.", "A flush or daemon is running the job right now.", "A journal entry that succeeded, belongs to another environment or read its file from stdin cannot be retried."},
+		Remediation: []string{"Check the job with `pingen-cli queue show <job>`; if a crashed run left it locked, remove the .lock file in the queue directory.", "Check the entry with `pingen-cli journal show <entry>`; pass the --env it was recorded for."},
+	},
+	{
+		Code:        "PINGEN-AUTH-001",
+		Title:       "Client credentials missing",
+		Causes:      []string{"No client id or client secret was provided."},
+		Remediation: []string{"Pass --client-id and --client-secret-file, or set PINGEN_CLIENT_ID and PINGEN_CLIENT_SECRET."},
+	},
+	{
+		Code:        "PINGEN-AUTH-002",
+		Title:       "Token request rejected",
+		Causes:      []string{"Wrong client id or secret.", "Credentials belong to the other environment (staging vs production).", "A requested scope is not granted to the client.", "The refresh token saved by `auth login` expired or was revoked."},
+		Remediation: []string{"Verify the credentials and --env.", "Retry with a narrower --scope.", "Run `pingen-cli auth login` again."},
+	},
+	{
+		Code:        "PINGEN-AUTH-003",
+		Title:       "Client secret file unreadable",
+		Causes:      []string{"The path given to --client-secret-file does not exist or is not readable."},
+		Remediation: []string{"Check the path and file permissions."},
+	},
+	{
+		Code:        "PINGEN-AUTH-004",
+		Title:       "Access denied",
+		Causes:      []string{"The access token expired or was revoked (HTTP 401).", "The token lacks a scope or access to the organisation (HTTP 403)."},
+		Remediation: []string{"Fetch a new token with `pingen-cli auth token --save`.", "Check --org and the scopes of the client."},
+	},
+	{
+		Code:        "PINGEN-AUTH-005",
+		Title:       "Browser login failed",
+		Causes:      []string{"The login was denied or cancelled in the browser.", "The redirect URI registered for the client does not match the callback server (http://127.0.0.1:<port>/callback).", "The login was not completed within --max-wait."},
+		Remediation: []string{"Register the redirect URI for the client and pass the same --port.", "Use --no-browser to copy the URL into a browser on this machine."},
+	},
+	{
+		Code:        "PINGEN-INPUT-001",
+		Title:       "Invalid command input",
+		Causes:      []string{"A required flag or argument is missing.", "A flag value is outside the allowed set.", "A manifest, JSONL file or merge template named on the command line does not exist or is not readable."},
+		Remediation: []string{"Run the command with --help to see required flags and allowed values."},
+	},
+	{
+		Code:        "PINGEN-INPUT-002",
+		Title:       "Invalid JSON or filter input",
+		Causes:      []string{"--meta-json, --meta-file or --filter does not contain valid JSON, or the file it names cannot be read.", "A --where clause has no operator.", "--since/--until is not a date, timestamp or relative value."},
+		Remediation: []string{"Validate the JSON (e.g. with jq) and use --where-debug to inspect generated filters."},
+	},
+	{
+		Code:        "PINGEN-INPUT-003",
+		Title:       "Id prefix not resolvable",
+		Causes:      []string{"The id prefix matches no letter, batch or webhook, or several of them."},
+		Remediation: []string{"Type more characters of the id or use the full UUID."},
+	},
+	{
+		Code:        "PINGEN-INPUT-004",
+		Title:       "Request body violates its schema",
+		Causes:      []string{"A flag or --meta-json/--meta-file value is missing, too long or not an allowed value.", "meta_data.recipient or meta_data.sender lacks a street or PO box."},
+		Remediation: []string{"Fix the listed JSON pointers; check a body offline with --schema-only."},
+	},
+	{
+		Code:        "PINGEN-INPUT-005",
+		Title:       "Table file not readable",
+		Causes:      []string{"The file does not exist or is not readable.", "The CSV file has unbalanced quotes.", "The .xlsx file is not an Excel workbook or has no worksheet.", "The file has no header row."},
+		Remediation: []string{"Re-export the sheet as .xlsx or UTF-8 CSV; only the first sheet is read and its first row must be the header."},
+	},
+	{
+		Code:        "PINGEN-INPUT-006",
+		Title:       "Recipient address not detected or not allowed",
+		Causes:      []string{"The address window holds no text (e.g. a scanned PDF) or no zip and city line.", "The detected destination country is not in --require-country.", "Addresses without a country line are assumed to be Swiss."},
+		Remediation: []string{"Check the result with `pingen-cli letters inspect-address --file <pdf>` and the --address-position.", "Add the country as last address line for letters abroad."},
+	},
+	{
+		Code:        "PINGEN-INPUT-007",
+		Title:       "Address breaks postal rules",
+		Causes:      []string{"The postcode does not match the format of the destination country.", "The country is neither an ISO 3166-1 code nor a known country name.", "The name, city or both street and PO box are missing."},
+		Remediation: []string{"Fix the listed fields; country names such as Schweiz or DEU are converted to ISO codes automatically."},
+	},
+	{
+		Code:        "PINGEN-INPUT-008",
+		Title:       "QR-bill payment part missing or misplaced",
+		Causes:      []string{"The PDF has no payment part, or it was scanned and contains no text.", "The page was scaled to fit, so the payment part or the 46 x 46 mm QR code changed size or moved.", "The IBAN or reference has wrong check digits, or a QR reference is used with a regular IBAN."},
+		Remediation: []string{"Run `pingen-cli letters check-qr-bill --file <pdf>` for the failing checks.", "Export the invoice at 100% on A4 portrait; the payment part must fill the bottom 105 mm."},
+	},
+	{
+		Code:        "PINGEN-INPUT-009",
+		Title:       "Import map not usable",
+		Causes:      []string{"The --map file of `import letters` is damaged or not writable."},
+		Remediation: []string{"Fix or move the file; without it letters already imported are created again."},
+	},
+	{
+		Code:        "PINGEN-INPUT-010",
+		Title:       "Organisation not resolvable",
+		Causes:      []string{"No organisation the token can access has this id, name or id prefix, or several share the name or prefix."},
+		Remediation: []string{"Check `pingen-cli org list` and pass the full organisation id."},
+	},
+	{
+		Code:        "PINGEN-INPUT-011",
+		Title:       "Member not resolvable",
+		Causes:      []string{"No member of the organisation has this association id, user id or email address, or several association ids share the prefix."},
+		Remediation: []string{"Check `pingen-cli users list` and pass the full association id or the email address."},
+	},
+	{
+		Code:        "PINGEN-UPLOAD-001",
+		Title:       "Local file not usable",
+		Causes:      []string{"The PDF passed to --file, or used as a letter body, merge template or attachment, does not exist or is not readable."},
+		Remediation: []string{"Check the path; relative paths are resolved from the current directory."},
+	},
+	{
+		Code:        "PINGEN-UPLOAD-002",
+		Title:       "File upload failed",
+		Causes:      []string{"The upload URL could not be requested.", "The storage endpoint rejected or aborted the upload."},
+		Remediation: []string{"Retry the command; upload URLs are short-lived.", "Raise --timeout for large files on slow links."},
+	},
+	{
+		Code:        "PINGEN-UPLOAD-003",
+		Title:       "File rejected before upload",
+		Causes:      []string{"The file is empty.", "The file is not a PDF (e.g. a DOCX or image saved with a .pdf name).", "The file is larger than max_upload_size (default 20M).", "The file was cut short or is password-protected.", "The file has more pages than the delivery product takes (max_pages)."},
+		Remediation: []string{"Export the document as PDF and check it opens in a PDF viewer.", "Compress or split large documents, or raise the limit with `pingen-cli config set max_upload_size 50M`.", "Run `pingen-cli letters check --file <pdf>` to see every check."},
+	},
+	{
+		Code:        "PINGEN-DOWNLOAD-001",
+		Title:       "Letter download failed",
+		Causes:      []string{"The letter has no printable file yet (still validating).", "The output directory or archive is not writable."},
+		Remediation: []string{"Check manifest.json for per-letter errors and re-run; finished files are kept.", "If an `export dump` cursor.json or .jsonl file is damaged, re-run with --full."},
+	},
+	{
+		Code:        "PINGEN-API-001",
+		Title:       "Unexpected API response",
+		Causes:      []string{"The API returned a status or payload the CLI does not handle."},
+		Remediation: []string{"Re-run with --json and report the output with the request_id."},
+	},
+	{
+		Code:        "PINGEN-API-003",
+		Title:       "Action not allowed in the current state",
+		Causes:      []string{"The letter or batch was already printed, handed over to the post or cancelled.", "The letter has not been submitted yet, so there is nothing to cancel.", "A submitted letter can no longer be edited, and only letters in action_required can be restored."},
+		Remediation: []string{"Check the status with `letters get`; drafts are removed with `letters delete` instead."},
+	},
+	{
+		Code:        "PINGEN-API-004",
+		Title:       "Letter did not reach the awaited state",
+		Causes:      []string{"Validation found a problem and the letter needs action (action_required), or it ended in another error state.", "The letter was still processing when --max-wait passed."},
+		Remediation: []string{"Inspect the letter with `letters get` and `letters events` and fix it in the Pingen web app.", "Raise --max-wait for slow validations; --until also accepts later states such as sent."},
+	},
+	{
+		Code:        "PINGEN-API-404",
+		Title:       "Resource not found",
+		Causes:      []string{"The id does not exist in the organisation.", "--org points at another organisation."},
+		Remediation: []string{"Check the id with `letters list` and the organisation with `org list`."},
+	},
+	{
+		Code:        "PINGEN-API-422",
+		Title:       "Request failed validation",
+		Causes:      []string{"The API rejected one or more attributes of the request."},
+		Remediation: []string{"Follow the printed hints; each names the flag to change."},
+	},
+	{
+		Code:        "PINGEN-API-429",
+		Title:       "Rate limited",
+		Causes:      []string{"More than 300 requests per minute were made with this user."},
+		Remediation: []string{"Wait for the Retry-After period and slow down bulk scripts."},
+	},
+	{
+		Code:        "PINGEN-API-500",
+		Title:       "Pingen server error",
+		Causes:      []string{"The API is in maintenance (HTTP 503) or failed internally."},
+		Remediation: []string{"Retry later with back-off; report persistent errors with the request_id."},
+	},
+	{
+		Code:        "PINGEN-NET-001",
+		Title:       "Network error",
+		Causes:      []string{"DNS lookup, connection or TLS handshake failed.", "The request exceeded --timeout.", "The port for `webhooks listen` is in use or needs privileges."},
+		Remediation: []string{"Check connectivity and proxies, --api-base/--identity-base, or raise --timeout.", "Pick another --port for `webhooks listen`."},
+	},
+	{
+		Code:        "PINGEN-NET-002",
+		Title:       "Deadline exceeded",
+		Causes:      []string{"The invocation ran longer than --deadline; in-flight requests were cancelled."},
+		Remediation: []string{"Raise --deadline or narrow the selection; the command exits with 124 so wrappers can retry later."},
+	},
+	{
+		Code:        "PINGEN-NET-003",
+		Title:       "Interrupted",
+		Causes:      []string{"SIGINT (Ctrl-C) or SIGTERM arrived; in-flight requests were cancelled."},
+		Remediation: []string{"Re-run the command; letters download resumes partial files and skips finished ones. The exit code is 130."},
+	},
+	{
+		Code:        "PINGEN-UPDATE-001",
+		Title:       "Release check failed",
+		Causes:      []string{"GitHub could not be reached or rate limited the request."},
+		Remediation: []string{"Retry later or disable the check with PINGEN_NO_UPDATE_CHECK=1."},
+	},
+	{
+		Code:        "PINGEN-OUTPUT-001",
+		Title:       "Output could not be rendered",
+		Causes:      []string{"The payload could not be encoded, an output template is invalid, or the --tee or --log-file file cannot be written."},
+		Remediation: []string{"Check the template with `pingen-cli output-templates list` and that the --tee and --log-file directories exist and are writable."},
+	},
+}
+
+func lookupCatalog(code string) (catalogEntry, bool) {
+	for _, entry := range errorCatalog {
+		if strings.EqualFold(entry.Code, code) {
+			return entry, true
+		}
+	}
+	return catalogEntry{}, false
+}
+
+func codeForStatus(status int) string {
+	switch {
+	case status == 401 || status == 403:
+		return "PINGEN-AUTH-004"
+	case status == 404:
+		return "PINGEN-API-404"
+	case status == 422:
+		return "PINGEN-API-422"
+	case status == 429:
+		return "PINGEN-API-429"
+	case status >= 500:
+		return "PINGEN-API-500"
+	case status != 0:
+		return "PINGEN-API-001"
+	}
+	return ""
+}
+
+// codedError is an error raised with its catalog code.
+type codedError struct {
+	code string
+	err  error
+}
+
+func (e codedError) Error() string { return e.err.Error() }
+
+func (e codedError) Unwrap() error { return e.err }
+
+// codedErrorf is fmt.Errorf for errors with a catalog code.
+func codedErrorf(code, format string, args ...any) error {
+	return codedError{code: code, err: fmt.Errorf(format, args...)}
+}
+
+// withCode attaches a catalog code to err.
+func withCode(code string, err error) error {
+	return codedError{code: code, err: err}
+}
+
+// codeForError returns the catalog code of err: the code it was raised
+// with, else one derived from the client's error types.
+func codeForError(err error) string {
+	var coded codedError
+	var waitErr letterWaitError
+	var schemaErr pingen.SchemaError
+	var addressErr pingen.AddressError
+	var pdfErr pingen.PDFError
+	var tableErr pingen.TableError
+	var fileErr pingen.FileError
+	var uploadErr pingen.UploadError
+	var tokenErr pingen.TokenError
+	var apiErr pingen.APIError
+	var urlErr *url.Error
+	var netErr net.Error
+	switch {
+	case errors.As(err, &coded):
+		return coded.code
+	case errors.As(err, &waitErr):
+		return "PINGEN-API-004"
+	case errors.As(err, &schemaErr):
+		return "PINGEN-INPUT-004"
+	case errors.As(err, &addressErr):
+		return "PINGEN-INPUT-007"
+	case errors.As(err, &pdfErr):
+		return "PINGEN-UPLOAD-003"
+	case errors.As(err, &tableErr):
+		return "PINGEN-INPUT-005"
+	case errors.As(err, &uploadErr):
+		return "PINGEN-UPLOAD-002"
+	case errors.As(err, &tokenErr):
+		return "PINGEN-AUTH-002"
+	case errors.As(err, &apiErr):
+		return codeForStatus(apiErr.Status)
+	case errors.As(err, &urlErr), errors.As(err, &netErr):
+		return "PINGEN-NET-001"
+	case errors.As(err, &fileErr):
+		return "PINGEN-UPLOAD-001"
+	}
+	return ""
+}
+
+func handleExplain(args []string) int {
+	if len(args) == 0 {
+		for _, entry := range errorCatalog {
+			fmt.Printf("%s\t%s\n", entry.Code, entry.Title)
+		}
+		return 0
+	}
+	entry, ok := lookupCatalog(args[0])
+	if !ok {
+		logf("error", "unknown error code: %s (run `pingen-cli explain` to list codes)", args[0])
+		return 2
+	}
+	fmt.Printf("%s: %s\n", entry.Code, entry.Title)
+	fmt.Println("\nPossible causes:")
+	for _, cause := range entry.Causes {
+		fmt.Printf("  - %s\n", cause)
+	}
+	fmt.Println("\nRemediation:")
+	for _, step := range entry.Remediation {
+		fmt.Printf("  - %s\n", step)
+	}
+	return 0
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ciProviders are the values of --ci. GitHub Actions turns workflow commands
+// (::error::, ::group::) into annotations and folded groups; GitLab has no
+// annotations, so errors and warnings are coloured there, and log sections
+// become collapsible.
+var ciProviders = []string{"github", "gitlab"}
+
+var gitlabSectionName = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// annotate writes message as a --ci annotation on stderr. The caller holds
+// l.mu.
+func (l *eventLogger) annotate(level, message string) {
+	if level != "warn" && level != "error" {
+		return
+	}
+	switch l.ci {
+	case "github":
+		command := "error"
+		if level == "warn" {
+			command = "warning"
+		}
+		escaper := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+		fmt.Fprintf(os.Stderr, "::%s::%s\n", command, escaper.Replace(message))
+	case "gitlab":
+		if level == "warn" {
+			fmt.Fprintf(os.Stderr, "\033[33;1mwarning: %s\033[0m\n", message)
+		} else {
+			fmt.Fprintf(os.Stderr, "\033[31;1m%s\033[0m\n", message)
+		}
+	}
+}
+
+// annotatef reports a failed item of a bulk or validation command as a --ci
+// annotation, e.g. "letter 123: failed validation". Without --ci it does
+// nothing; the item is already in the command's output.
+func annotatef(level, format string, args ...any) {
+	if activeLogger.ci == "" {
+		return
+	}
+	message := redactText(fmt.Sprintf(format, args...))
+	activeLogger.mu.Lock()
+	defer activeLogger.mu.Unlock()
+	activeLogger.annotate(level, message)
+	activeLogger.writeFile(time.Now(), level, message, nil)
+}
+
+// annotateOnly writes a --ci annotation for a message already logged in
+// another form, such as a --json error object.
+func (l *eventLogger) annotateOnly(level, message string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.annotate(level, message)
+}
+
+// ciGroup opens a collapsible log section on stdout and returns the function
+// that closes it. Sections are not nested: inside one, e.g. a queued job run
+// by queue flush, and with --json output (which must stay parseable) it does
+// nothing.
+func ciGroup(ctx appContext, title string) func() {
+	l := activeLogger
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ci == "" || ctx.global.jsonOutput || l.groups > 0 {
+		return func() {}
+	}
+	l.groups++
+	name := ""
+	switch l.ci {
+	case "github":
+		fmt.Printf("::group::%s\n", title)
+	case "gitlab":
+		command, _, _ := strings.Cut(title, ":")
+		name = strings.Trim(gitlabSectionName.ReplaceAllString(strings.ToLower(command), "_"), "_")
+		fmt.Printf("\033[0Ksection_start:%d:%s[collapsed=true]\r\033[0K%s\n", time.Now().Unix(), name, title)
+	}
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.groups--
+		switch l.ci {
+		case "github":
+			fmt.Println("::endgroup::")
+		case "gitlab":
+			fmt.Printf("\033[0Ksection_end:%d:%s\r\033[0K\n", time.Now().Unix(), name)
+		}
+	}
+}
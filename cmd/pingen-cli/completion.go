@@ -0,0 +1,337 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// completionCacheTTL bounds how long API-backed candidates are reused.
+const completionCacheTTL = 60 * time.Second
+
+var completionCommands = map[string][]string{
+	"auth":             {"token", "login", "status", "revoke"},
+	"config":           {"show", "set", "unset", "fix-permissions"},
+	"org":              {"list", "get", "use", "settings"},
+	"users":            {"get", "list", "invite", "remove", "set-role"},
+	"associations":     {"list"},
+	"products":         {"list"},
+	"letters":          {"list", "browse", "get", "create", "bulk-create", "send", "submit", "delete", "cancel", "edit", "restore", "download", "events", "wait", "receipts", "diff", "estimate", "price", "check", "compose", "merge", "inspect-address", "check-qr-bill", "reconcile", "duplicates"},
+	"filters":          {"save", "list", "show", "delete"},
+	"output-templates": {"save", "list", "delete"},
+	"explain":          {},
+	"limits":           {},
+	"ratelimit":        {},
+	"purge":            {},
+	"init":             {},
+	"doctor":           {},
+	"templates":        {"save", "list", "show", "delete"},
+	"contacts":         {"add", "import", "list", "show", "remove"},
+	"queue":            {"list", "show", "cancel", "retry", "flush", "daemon"},
+	"journal":          {"list", "show", "retry"},
+	"schedule":         {"add", "list", "remove", "run"},
+	"export":           {"archive", "dump"},
+	"import":           {"letters"},
+	"batches":          {"create", "list", "get", "add-attachment", "send", "cancel"},
+	"events":           {"stream"},
+	"webhooks":         {"create", "listen"},
+	"watch":            {"letters", "batches", "webhooks", "organisations"},
+	"completion":       {"bash", "zsh", "fish"},
+}
+
+// globalValueFlags lists global flags that consume the following word.
+var globalValueFlags = map[string]bool{
+	"--config": true, "--env": true, "--api-base": true, "--identity-base": true, "--org": true,
+	"--access-token": true, "--client-id": true, "--client-secret": true,
+	"--client-secret-file": true, "--timeout": true, "--retries": true, "--retry-max-wait": true, "--template-name": true, "--explain": true, "--tz": true, "--limit-rate": true, "--deadline": true, "--tee": true, "--header": true, "--ca-cert": true, "--tls-min-version": true, "--log-format": true, "--log-level": true, "--log-file": true, "--trace-format": true, "--ci": true, "--output": true, "--columns": true, "--query": true,
+}
+
+var completionGlobalFlags = []string{
+	"--config", "--env", "--api-base", "--identity-base", "--org", "--access-token", "--client-id",
+	"--client-secret", "--client-secret-file", "--timeout", "--retries", "--retry-max-wait", "--deadline", "--tee", "--tee-append", "--tz", "--limit-rate", "--json", "--plain", "--output", "--columns", "--query", "--include-headers", "--header", "--ca-cert", "--tls-min-version",
+	"--quiet", "--verbose", "--trace", "--trace-format", "--log-format", "--log-level", "--log-file", "--ci", "--redact", "--force", "--dry-run", "--template-name", "--explain", "--help", "--version", "--check-update",
+}
+
+// completionCandidate is a completion value with an optional description.
+type completionCandidate struct {
+	Value       string `json:"value"`
+	Description string `json:"description,omitempty"`
+}
+
+func handleCompletion(args []string) int {
+	if len(args) == 0 {
+		fmt.Println("completion requires a shell (bash/zsh/fish)")
+		return 2
+	}
+	switch args[0] {
+	case "bash":
+		fmt.Print(bashCompletion)
+	case "zsh":
+		fmt.Print(zshCompletion)
+	case "fish":
+		fmt.Print(fishCompletion)
+	default:
+		fmt.Println("unknown shell (use bash, zsh, or fish)")
+		return 2
+	}
+	return 0
+}
+
+// handleComplete prints candidates for the last word in args, one per line as
+// "value<TAB>description". It is invoked by the generated shell scripts.
+func handleComplete(ctx appContext, args []string) int {
+	current := ""
+	if len(args) > 0 {
+		current = args[len(args)-1]
+		args = args[:len(args)-1]
+	}
+
+	var candidates []completionCandidate
+	previous := ""
+	if len(args) > 0 {
+		previous = args[len(args)-1]
+	}
+	words := positionalWords(args)
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == "--org" {
+			ctx.settings.OrganisationID = args[i+1]
+		}
+	}
+
+	switch {
+	case previous == "--org":
+		candidates = completeOrganisations(ctx)
+	case previous == "--env":
+		candidates = staticCandidates("staging", "production")
+	case previous == "--log-format" || previous == "--trace-format":
+		candidates = staticCandidates(logFormats...)
+	case previous == "--tls-min-version":
+		candidates = staticCandidates("1.2", "1.3")
+	case previous == "--log-level":
+		candidates = staticCandidates(logLevels...)
+	case previous == "--ci":
+		candidates = staticCandidates(ciProviders...)
+	case globalValueFlags[previous]:
+		return 0
+	case strings.HasPrefix(current, "-"):
+		candidates = staticCandidates(completionGlobalFlags...)
+	case len(words) == 0:
+		names := make([]string, 0, len(completionCommands))
+		for name := range completionCommands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		candidates = staticCandidates(names...)
+	case len(words) == 1 && words[0] == "explain":
+		for _, entry := range errorCatalog {
+			candidates = append(candidates, completionCandidate{Value: entry.Code, Description: entry.Title})
+		}
+	case len(words) == 1:
+		candidates = staticCandidates(completionCommands[words[0]]...)
+	case len(words) == 2 && words[0] == "letters" && isAllowed(words[1], []string{"get", "send", "delete", "cancel", "edit", "restore", "download", "events", "wait"}):
+		candidates = completeLetters(ctx)
+	case len(words) == 2 && words[0] == "batches" && isAllowed(words[1], []string{"get", "send", "cancel"}):
+		candidates = completeBatches(ctx)
+	case len(words) == 2 && words[0] == "org" && isAllowed(words[1], []string{"get", "use"}):
+		candidates = completeOrganisations(ctx)
+	}
+
+	for _, candidate := range candidates {
+		if !strings.HasPrefix(candidate.Value, current) {
+			continue
+		}
+		if candidate.Description != "" {
+			fmt.Printf("%s\t%s\n", candidate.Value, candidate.Description)
+		} else {
+			fmt.Println(candidate.Value)
+		}
+	}
+	return 0
+}
+
+// positionalWords returns the command words, skipping global flags and their values.
+func positionalWords(args []string) []string {
+	words := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if strings.HasPrefix(arg, "-") {
+			if globalValueFlags[arg] && !strings.Contains(arg, "=") {
+				i++
+			}
+			continue
+		}
+		words = append(words, arg)
+	}
+	return words
+}
+
+func staticCandidates(values ...string) []completionCandidate {
+	candidates := make([]completionCandidate, 0, len(values))
+	for _, value := range values {
+		candidates = append(candidates, completionCandidate{Value: value})
+	}
+	return candidates
+}
+
+func completeOrganisations(ctx appContext) []completionCandidate {
+	key := "organisations-" + ctx.settings.Env
+	if cached, ok := readCompletionCache(key); ok {
+		return cached
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		return nil
+	}
+	client := newClient(ctx, token)
+	payload, _, err := client.ListOrganisationsRaw(ctx.jobContext, map[string]string{"page[limit]": "100"})
+	if err != nil {
+		return nil
+	}
+	candidates := []completionCandidate{}
+	data, _ := payload["data"].([]any)
+	for _, entry := range data {
+		item, _ := entry.(map[string]any)
+		attrs, _ := item["attributes"].(map[string]any)
+		candidates = append(candidates, completionCandidate{Value: stringValue(item["id"]), Description: stringValue(attrs["name"])})
+	}
+	writeCompletionCache(key, candidates)
+	return candidates
+}
+
+func completeLetters(ctx appContext) []completionCandidate {
+	if ctx.settings.OrganisationID == "" {
+		return nil
+	}
+	key := "letters-" + ctx.settings.Env + "-" + ctx.settings.OrganisationID
+	if cached, ok := readCompletionCache(key); ok {
+		return cached
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		return nil
+	}
+	client := newClient(ctx, token)
+	params := map[string]string{
+		"page[limit]":     "100",
+		"sort":            "-created_at",
+		"fields[letters]": "status,file_original_name",
+	}
+	payload, _, err := client.ListLettersRaw(ctx.jobContext, ctx.settings.OrganisationID, params)
+	if err != nil {
+		return nil
+	}
+	candidates := []completionCandidate{}
+	data, _ := payload["data"].([]any)
+	for _, entry := range data {
+		item, _ := entry.(map[string]any)
+		attrs, _ := item["attributes"].(map[string]any)
+		hint := strings.TrimSpace(stringValue(attrs["status"]) + " " + stringValue(attrs["file_original_name"]))
+		candidates = append(candidates, completionCandidate{Value: stringValue(item["id"]), Description: hint})
+	}
+	writeCompletionCache(key, candidates)
+	return candidates
+}
+
+func completeBatches(ctx appContext) []completionCandidate {
+	if ctx.settings.OrganisationID == "" {
+		return nil
+	}
+	key := "batches-" + ctx.settings.Env + "-" + ctx.settings.OrganisationID
+	if cached, ok := readCompletionCache(key); ok {
+		return cached
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		return nil
+	}
+	client := newClient(ctx, token)
+	params := map[string]string{
+		"page[limit]":     "100",
+		"sort":            "-created_at",
+		"fields[batches]": "status,name",
+	}
+	payload, _, err := client.ListBatchesRaw(ctx.jobContext, ctx.settings.OrganisationID, params)
+	if err != nil {
+		return nil
+	}
+	candidates := []completionCandidate{}
+	data, _ := payload["data"].([]any)
+	for _, entry := range data {
+		item, _ := entry.(map[string]any)
+		attrs, _ := item["attributes"].(map[string]any)
+		hint := strings.TrimSpace(stringValue(attrs["status"]) + " " + stringValue(attrs["name"]))
+		candidates = append(candidates, completionCandidate{Value: stringValue(item["id"]), Description: hint})
+	}
+	writeCompletionCache(key, candidates)
+	return candidates
+}
+
+func completionCachePath(key string) (string, error) {
+	dir, err := pingen.CacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "completion", key+".json"), nil
+}
+
+func readCompletionCache(key string) ([]completionCandidate, bool) {
+	path, err := completionCachePath(key)
+	if err != nil {
+		return nil, false
+	}
+	info, err := os.Stat(path)
+	if err != nil || time.Since(info.ModTime()) > completionCacheTTL {
+		return nil, false
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var candidates []completionCandidate
+	if err := json.Unmarshal(content, &candidates); err != nil {
+		return nil, false
+	}
+	return candidates, true
+}
+
+func writeCompletionCache(key string, candidates []completionCandidate) {
+	path, err := completionCachePath(key)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return
+	}
+	encoded, err := json.Marshal(candidates)
+	if err != nil {
+		return
+	}
+	_ = os.WriteFile(path, encoded, 0o600)
+}
+
+const bashCompletion = `# bash completion for pingen-cli
+_pingen_cli() {
+  local IFS=$'\n'
+  COMPREPLY=($(pingen-cli __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null | cut -f1))
+}
+complete -o default -F _pingen_cli pingen-cli
+`
+
+const zshCompletion = `#compdef pingen-cli
+_pingen_cli() {
+  local -a items
+  items=("${(@f)$(pingen-cli __complete "${(@)words[2,CURRENT]}" 2>/dev/null | sed 's/:/\\:/g; s/	/:/')}")
+  _describe 'pingen-cli' items
+}
+compdef _pingen_cli pingen-cli
+`
+
+const fishCompletion = `# fish completion for pingen-cli
+complete -c pingen-cli -f -a '(pingen-cli __complete (commandline -opc)[2..-1] (commandline -ct) 2>/dev/null)'
+`
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// countryLineNames are the country lines written for international mail.
+// Other countries get their ISO code, which the postal services accept as
+// well.
+var countryLineNames = map[string]string{
+	"CH": "SWITZERLAND", "LI": "LIECHTENSTEIN", "DE": "GERMANY", "AT": "AUSTRIA",
+	"FR": "FRANCE", "IT": "ITALY", "ES": "SPAIN", "PT": "PORTUGAL", "NL": "NETHERLANDS",
+	"BE": "BELGIUM", "LU": "LUXEMBOURG", "GB": "UNITED KINGDOM", "US": "UNITED STATES",
+}
+
+// cityFirstCountries write the postcode after the city.
+var cityFirstCountries = []string{"GB", "IE", "US", "CA"}
+
+// handleLettersCompose prepends an address page to a PDF without an address
+// block and creates the letter from the result, or writes it to --output.
+// Arguments after -- are passed to letters create.
+func handleLettersCompose(ctx appContext, args []string) int {
+	fs := flag.NewFlagSet("letters compose", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	body := fs.String("body", "", "PDF to prepend the address page to")
+	recipient := fs.String("recipient", "", "Recipient: address book alias, JSON object or @path to a JSON file")
+	sender := fs.String("sender", "", "Return address: address book alias, JSON object or @path to a JSON file")
+	addressPos := fs.String("address-position", "left", "Envelope window: left (DIN 5008) or right (Swiss)")
+	blankBack := fs.Bool("blank-back", false, "Add an empty page after the address page for duplex printing")
+	output := fs.String("output", "", "Write the composed PDF to this path (- for stdout) instead of creating a letter")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli letters compose --body <path> --recipient alias|@path|json [--sender alias|@path|json] [--address-position left|right] [--blank-back] [--output path|-] [-- letters create flags]")
+		return 0
+	}
+	switch {
+	case *body == "":
+		printErrorCode("PINGEN-INPUT-001", "--body is required")
+		return 2
+	case *recipient == "":
+		printErrorCode("PINGEN-INPUT-001", "--recipient is required")
+		return 2
+	case *addressPos != "left" && *addressPos != "right":
+		printErrorCode("PINGEN-INPUT-001", "address-position must be left or right")
+		return 2
+	case *output != "" && fs.NArg() > 0:
+		printErrorCode("PINGEN-INPUT-001", "--output cannot be combined with letters create flags")
+		return 2
+	}
+	if _, err := os.Stat(*body); err != nil {
+		printErrorCode("PINGEN-UPLOAD-001", "file not found: "+*body)
+		return 2
+	}
+	if err := pingen.PreflightPDF(*body, maxUploadSize(ctx)); err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	page, err := composeAddressPage(ctx, *recipient, *sender)
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	page.Position, page.BlankBack = *addressPos, *blankBack
+	composed, err := pingen.PrependAddressPage(*body, page)
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	verbosef(ctx, "address page: %s", strings.Join(page.Recipient, " / "))
+	switch *output {
+	case "-":
+		if _, err := os.Stdout.Write(composed); err != nil {
+			reportError(ctx, err)
+			return 1
+		}
+		return 0
+	case "":
+	default:
+		if err := os.WriteFile(*output, composed, 0o600); err != nil {
+			reportError(ctx, err)
+			return 1
+		}
+		if !ctx.global.quiet {
+			fmt.Printf("wrote %s\n", *output)
+		}
+		return 0
+	}
+	file, err := os.CreateTemp("", "pingen-compose-*.pdf")
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(composed)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	// The file and the window are set last so that they win over the
+	// forwarded flags; the file name can be overridden.
+	createArgs := append([]string{"--file-name", pingen.DefaultFileName(*body)}, fs.Args()...)
+	createArgs = append(createArgs, "--file", file.Name(), "--address-position", *addressPos)
+	return handleLettersCreate(ctx, createArgs)
+}
+
+// composeAddressPage resolves and validates the recipient and sender and
+// lays out their lines. The country line is left out for domestic mail,
+// i.e. when the recipient is in the sender's country (Switzerland without a
+// sender).
+func composeAddressPage(ctx appContext, recipientValue, senderValue string) (pingen.AddressPage, error) {
+	recipient, err := composeContact(ctx, "recipient", recipientValue)
+	if err != nil {
+		return pingen.AddressPage{}, err
+	}
+	home := defaultAddressCountry
+	page := pingen.AddressPage{}
+	if senderValue != "" {
+		sender, err := composeContact(ctx, "sender", senderValue)
+		if err != nil {
+			return pingen.AddressPage{}, err
+		}
+		home = sender.Country
+		lines := addressLines(sender, recipient.Country)
+		page.Sender = strings.Join(lines, ", ")
+	}
+	page.Recipient = addressLines(recipient, home)
+	return page, nil
+}
+
+// composeContact reads an address book alias, an inline JSON object or
+// @path to a JSON file and checks it against the postal rules.
+func composeContact(ctx appContext, role, value string) (pingen.Contact, error) {
+	var contact pingen.Contact
+	switch {
+	case strings.HasPrefix(value, "@"):
+		content, err := os.ReadFile(strings.TrimPrefix(value, "@"))
+		if err != nil {
+			return contact, codedErrorf("PINGEN-INPUT-001", "failed to read --%s: %w", role, err)
+		}
+		if err := json.Unmarshal(content, &contact); err != nil {
+			return contact, codedErrorf("PINGEN-INPUT-001", "invalid --%s: %s is not a JSON address object", role, strings.TrimPrefix(value, "@"))
+		}
+	case strings.HasPrefix(strings.TrimSpace(value), "{"):
+		if err := json.Unmarshal([]byte(value), &contact); err != nil {
+			return contact, codedErrorf("PINGEN-INPUT-001", "invalid --%s: not a JSON address object", role)
+		}
+	default:
+		found, err := lookupContact(ctx, value)
+		if err != nil {
+			return contact, err
+		}
+		contact = found
+	}
+	if err := pingen.ValidateAddress(role+".", &contact); err != nil {
+		return contact, err
+	}
+	return contact, nil
+}
+
+// addressLines formats contact for the window; the country line is added
+// when it differs from home.
+func addressLines(contact pingen.Contact, home string) []string {
+	lines := []string{strings.TrimSpace(contact.Name)}
+	if street := strings.TrimSpace(contact.Street + " " + contact.Number); street != "" {
+		lines = append(lines, street)
+	}
+	if contact.POBox != "" {
+		lines = append(lines, strings.TrimSpace(contact.POBox))
+	}
+	place := strings.TrimSpace(contact.Zip + " " + contact.City)
+	if isAllowed(contact.Country, cityFirstCountries) {
+		place = strings.TrimSpace(contact.City + " " + contact.Zip)
+	}
+	lines = append(lines, place)
+	if !strings.EqualFold(contact.Country, home) {
+		name, ok := countryLineNames[contact.Country]
+		if !ok {
+			name = contact.Country
+		}
+		lines = append(lines, name)
+	}
+	return lines
+}
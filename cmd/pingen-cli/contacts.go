@@ -0,0 +1,314 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// contactsPath is the address book location: contacts_file from the config
+// or PINGEN_CONTACTS_FILE (e.g. a shared file), else next to the config.
+func contactsPath(ctx appContext) (string, error) {
+	if ctx.settings.ContactsFile != "" {
+		return ctx.settings.ContactsFile, nil
+	}
+	return pingen.DefaultContactsPath()
+}
+
+func loadContacts(ctx appContext) (string, map[string]pingen.Contact, error) {
+	path, err := contactsPath(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	contacts, err := pingen.LoadContacts(path)
+	if err != nil {
+		return path, nil, codedErrorf("PINGEN-CONFIG-002", "failed to load contacts: %w", err)
+	}
+	return path, contacts, nil
+}
+
+// lookupContact resolves an address book alias.
+func lookupContact(ctx appContext, alias string) (pingen.Contact, error) {
+	_, contacts, err := loadContacts(ctx)
+	if err != nil {
+		return pingen.Contact{}, err
+	}
+	contact, ok := contacts[alias]
+	if !ok {
+		return pingen.Contact{}, codedErrorf("PINGEN-CONFIG-005", "unknown contact: %s", alias)
+	}
+	return contact, nil
+}
+
+func handleContacts(ctx appContext, args []string) int {
+	if len(args) == 0 {
+		fmt.Println("contacts requires a subcommand (add/import/list/show/remove)")
+		return 2
+	}
+	switch args[0] {
+	case "add":
+		return handleContactsAdd(ctx, args[1:])
+	case "import":
+		return handleContactsImport(ctx, args[1:])
+	case "list":
+		_, contacts, err := loadContacts(ctx)
+		if err != nil {
+			reportError(ctx, err)
+			return 1
+		}
+		if ctx.global.jsonOutput {
+			return emitJSON(contacts)
+		}
+		aliases := make([]string, 0, len(contacts))
+		for alias := range contacts {
+			aliases = append(aliases, alias)
+		}
+		sort.Strings(aliases)
+		for _, alias := range aliases {
+			contact := contacts[alias]
+			fmt.Printf("%s\t%s\t%s %s\t%s\n", alias, contact.Name, contact.Zip, contact.City, contact.Country)
+		}
+		return 0
+	case "show":
+		if len(args) < 2 {
+			fmt.Println("contacts show requires an alias")
+			return 2
+		}
+		contact, err := lookupContact(ctx, args[1])
+		if err != nil {
+			reportError(ctx, err)
+			return 2
+		}
+		return emitJSON(contact)
+	case "remove":
+		if len(args) < 2 {
+			fmt.Println("contacts remove requires an alias")
+			return 2
+		}
+		path, contacts, err := loadContacts(ctx)
+		if err != nil {
+			reportError(ctx, err)
+			return 1
+		}
+		if _, ok := contacts[args[1]]; !ok {
+			printErrorCode("PINGEN-CONFIG-005", fmt.Sprintf("unknown contact: %s", args[1]))
+			return 2
+		}
+		delete(contacts, args[1])
+		if err := pingen.SaveContacts(path, contacts); err != nil {
+			reportError(ctx, codedErrorf("PINGEN-CONFIG-003", "failed to save contacts: %w", err))
+			return 1
+		}
+		if !ctx.global.quiet {
+			fmt.Printf("removed %s\n", args[1])
+		}
+		return 0
+	default:
+		fmt.Println("unknown contacts subcommand")
+		return 2
+	}
+}
+
+func handleContactsAdd(ctx appContext, args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Println("contacts add requires an alias")
+		return 2
+	}
+	alias := args[0]
+	fs := flag.NewFlagSet("contacts add", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	contact := pingen.Contact{}
+	fs.StringVar(&contact.Name, "name", "", "Recipient name (max 45 characters)")
+	fs.StringVar(&contact.Street, "street", "", "Street")
+	fs.StringVar(&contact.Number, "number", "", "House number")
+	fs.StringVar(&contact.POBox, "pobox", "", "PO box (instead of street)")
+	fs.StringVar(&contact.Zip, "zip", "", "Postal code")
+	fs.StringVar(&contact.City, "city", "", "City")
+	fs.StringVar(&contact.Country, "country", "", "ISO country code (e.g. CH)")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args[1:]); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli contacts add <alias> --name name (--street street [--number n] | --pobox box) --zip zip --city city --country CC")
+		return 0
+	}
+	if err := pingen.ValidateAddress("", &contact); err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	if err := pingen.ValidatePayload("contact", contact); err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+
+	path, contacts, err := loadContacts(ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	_, exists := contacts[alias]
+	contacts[alias] = contact
+	if err := pingen.SaveContacts(path, contacts); err != nil {
+		reportError(ctx, codedErrorf("PINGEN-CONFIG-003", "failed to save contacts: %w", err))
+		return 1
+	}
+	if !ctx.global.quiet {
+		if exists {
+			fmt.Printf("updated %s\n", alias)
+		} else {
+			fmt.Printf("added %s\n", alias)
+		}
+	}
+	return 0
+}
+
+// contactFields are the columns read by contacts import.
+var contactFields = []string{"alias", "name", "street", "number", "pobox", "zip", "city", "country"}
+
+// handleContactsImport adds or updates contacts from a CSV or XLSX file with
+// a header row. Nothing is saved unless every row is valid.
+func handleContactsImport(ctx appContext, args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Println("contacts import requires a CSV or XLSX file")
+		return 2
+	}
+	path := args[0]
+	fs := flag.NewFlagSet("contacts import", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	columnMap := fs.String("column-map", "", "Columns of non-standard layouts, e.g. alias=A,name=B,street=C")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args[1:]); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli contacts import <file.csv|file.xlsx> [--column-map field=column,...]")
+		return 0
+	}
+	columns, err := pingen.ParseColumnMap(*columnMap)
+	if err != nil {
+		printErrorCode("PINGEN-INPUT-001", err.Error())
+		return 2
+	}
+	table, err := pingen.ReadTable(path)
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	records, err := table.Records(contactFields, columns)
+	if err != nil {
+		printErrorCode("PINGEN-INPUT-001", err.Error())
+		return 2
+	}
+
+	imported := map[string]pingen.Contact{}
+	invalid := 0
+	for i, record := range records {
+		row := table.Lines[i]
+		contact := pingen.Contact{
+			Name:    record["name"],
+			Street:  record["street"],
+			Number:  record["number"],
+			POBox:   record["pobox"],
+			Zip:     record["zip"],
+			City:    record["city"],
+			Country: record["country"],
+		}
+		alias := record["alias"]
+		if alias == "" {
+			printErrorCode("PINGEN-INPUT-004", fmt.Sprintf("invalid contact in row %d: alias is empty", row))
+			invalid++
+			continue
+		}
+		err := pingen.ValidateAddress("", &contact)
+		if err == nil {
+			err = pingen.ValidatePayload("contact", contact)
+		}
+		if err != nil {
+			printErrorCode("PINGEN-INPUT-004", fmt.Sprintf("invalid contact in row %d (%s): %s", row, alias, err))
+			invalid++
+			continue
+		}
+		imported[alias] = contact
+	}
+	if invalid > 0 {
+		logf("info", "%d invalid row(s), nothing imported", invalid)
+		return 2
+	}
+
+	contactsFile, contacts, err := loadContacts(ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	for alias, contact := range imported {
+		contacts[alias] = contact
+	}
+	if err := pingen.SaveContacts(contactsFile, contacts); err != nil {
+		reportError(ctx, codedErrorf("PINGEN-CONFIG-003", "failed to save contacts: %w", err))
+		return 1
+	}
+	if !ctx.global.quiet {
+		fmt.Printf("imported %d contact(s)\n", len(imported))
+	}
+	return 0
+}
+
+// validateMetaAddresses checks meta_data.recipient and meta_data.sender
+// against the postal rules of their countries and normalizes their country
+// codes and postcodes in place.
+func validateMetaAddresses(metaData map[string]any) error {
+	problems := []pingen.AddressProblem{}
+	for _, key := range []string{"recipient", "sender"} {
+		fields, ok := metaData[key].(map[string]any)
+		if !ok {
+			if contact, isContact := metaData[key].(pingen.Contact); isContact {
+				err := pingen.ValidateAddress(key+".", &contact)
+				metaData[key] = contact
+				if addressErr, failed := err.(pingen.AddressError); failed {
+					problems = append(problems, addressErr.Problems...)
+				}
+			}
+			continue
+		}
+		contact := pingen.Contact{}
+		for field, target := range map[string]*string{
+			"name": &contact.Name, "street": &contact.Street, "number": &contact.Number, "pobox": &contact.POBox,
+			"zip": &contact.Zip, "city": &contact.City, "country": &contact.Country,
+		} {
+			*target = stringValue(fields[field])
+		}
+		if err := pingen.ValidateAddress(key+".", &contact); err != nil {
+			problems = append(problems, err.(pingen.AddressError).Problems...)
+			continue
+		}
+		fields["country"], fields["zip"] = contact.Country, contact.Zip
+	}
+	if len(problems) > 0 {
+		return pingen.AddressError{Problems: problems}
+	}
+	return nil
+}
+
+// applyContacts sets meta_data.recipient and meta_data.sender from the
+// address book aliases given with --recipient and --sender.
+func applyContacts(ctx appContext, metaData map[string]any, recipient, sender string) (map[string]any, error) {
+	for _, role := range []struct{ key, alias string }{{"recipient", recipient}, {"sender", sender}} {
+		if role.alias == "" {
+			continue
+		}
+		contact, err := lookupContact(ctx, role.alias)
+		if err != nil {
+			return nil, err
+		}
+		if metaData == nil {
+			metaData = map[string]any{}
+		}
+		metaData[role.key] = contact
+	}
+	return metaData, nil
+}
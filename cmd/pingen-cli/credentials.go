@@ -0,0 +1,57 @@
+package main
+
+import (
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// loadConfig reads the config at path and fills in the secrets it keeps in
+// the OS keychain. A keychain that cannot be read is a warning: commands that
+// need the secrets then fail the same way as without them.
+func loadConfig(path string) (pingen.Config, bool, error) {
+	cfg, exists, err := pingen.LoadConfig(path)
+	if err != nil || len(cfg.KeychainSecrets) == 0 {
+		return cfg, exists, err
+	}
+	return withKeychainSecrets(path, cfg), exists, nil
+}
+
+// keychainWarned keeps a broken keychain from being reported on every load.
+var keychainWarned bool
+
+func withKeychainSecrets(path string, cfg pingen.Config) pingen.Config {
+	store, err := pingen.KeychainStore()
+	if err == nil {
+		cfg, err = pingen.LoadSecrets(store, path, cfg)
+	}
+	if err != nil && !keychainWarned {
+		logf("warn", "could not read secrets from the OS keychain: %v", err)
+		keychainWarned = true
+	}
+	return cfg
+}
+
+// storeSecrets moves the secrets of cfg into the OS keychain before it is
+// written to path. Without a usable keychain they stay in the config file,
+// with a warning unless credential_store is "file".
+func storeSecrets(path string, cfg pingen.Config) pingen.Config {
+	if cfg.CredentialStore == "file" && len(cfg.KeychainSecrets) == 0 {
+		return cfg
+	}
+	store, storeErr := pingen.KeychainStore()
+	if storeErr != nil && !cfg.HasSecrets() {
+		return cfg
+	}
+	cfg, err := pingen.StoreSecrets(store, path, cfg)
+	if err == nil {
+		return cfg
+	}
+	if storeErr != nil {
+		err = storeErr
+	}
+	if cfg.CredentialStore == "file" {
+		logf("warn", "could not remove secrets from the OS keychain: %v", err)
+	} else {
+		logf("warn", "could not store secrets in the OS keychain (%v); writing them to %s instead; set credential_store to file to silence this", err, path)
+	}
+	return cfg
+}
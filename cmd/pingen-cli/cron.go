@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSpec is a parsed five-field cron expression (minute hour day-of-month
+// month day-of-week) evaluated in a fixed time zone.
+type cronSpec struct {
+	minute, hour, dom, month, dow map[int]bool
+	domAny, dowAny                bool
+	location                      *time.Location
+}
+
+var cronMonths = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+var cronWeekdays = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseCron parses expressions like "0 6 1 * *", "*/15 8-18 * * mon-fri" or
+// "@daily". Day-of-week 7 is Sunday, as in most cron implementations.
+func parseCron(expression string, location *time.Location) (cronSpec, error) {
+	text := strings.TrimSpace(expression)
+	if macro, ok := cronMacros[strings.ToLower(text)]; ok {
+		text = macro
+	}
+	fields := strings.Fields(text)
+	if len(fields) != 5 {
+		return cronSpec{}, codedErrorf("PINGEN-INPUT-002", "invalid cron expression %q (want 5 fields: minute hour day month weekday)", expression)
+	}
+	spec := cronSpec{location: location}
+	var err error
+	ranges := []struct {
+		target   *map[int]bool
+		min, max int
+		names    map[string]int
+	}{
+		{&spec.minute, 0, 59, nil},
+		{&spec.hour, 0, 23, nil},
+		{&spec.dom, 1, 31, nil},
+		{&spec.month, 1, 12, cronMonths},
+		{&spec.dow, 0, 7, cronWeekdays},
+	}
+	for i, r := range ranges {
+		*r.target, err = parseCronField(fields[i], r.min, r.max, r.names)
+		if err != nil {
+			return cronSpec{}, codedErrorf("PINGEN-INPUT-002", "invalid cron expression %q: %v", expression, err)
+		}
+	}
+	if spec.dow[7] {
+		spec.dow[0] = true
+	}
+	spec.domAny = fields[2] == "*"
+	spec.dowAny = fields[4] == "*"
+	return spec, nil
+}
+
+func parseCronField(field string, min, max int, names map[string]int) (map[int]bool, error) {
+	values := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if base, stepText, ok := strings.Cut(part, "/"); ok {
+			parsed, err := strconv.Atoi(stepText)
+			if err != nil || parsed < 1 {
+				return nil, fmt.Errorf("bad step in %q", part)
+			}
+			part, step = base, parsed
+		}
+		low, high := min, max
+		if part != "*" {
+			startText, endText, isRange := strings.Cut(part, "-")
+			start, err := cronValue(startText, names)
+			if err != nil {
+				return nil, err
+			}
+			low, high = start, start
+			if isRange {
+				if high, err = cronValue(endText, names); err != nil {
+					return nil, err
+				}
+			} else if step > 1 {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return nil, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for value := low; value <= high; value += step {
+			values[value] = true
+		}
+	}
+	return values, nil
+}
+
+func cronValue(text string, names map[string]int) (int, error) {
+	if value, ok := names[strings.ToLower(text)]; ok {
+		return value, nil
+	}
+	value, err := strconv.Atoi(text)
+	if err != nil {
+		return 0, fmt.Errorf("bad value %q", text)
+	}
+	return value, nil
+}
+
+// matches reports whether the minute containing t is scheduled. As in cron,
+// a restricted day-of-month and day-of-week match if either one does.
+func (c cronSpec) matches(t time.Time) bool {
+	t = t.In(c.location)
+	if !c.minute[t.Minute()] || !c.hour[t.Hour()] || !c.month[int(t.Month())] {
+		return false
+	}
+	return c.dayMatches(t)
+}
+
+func (c cronSpec) dayMatches(t time.Time) bool {
+	dom, dow := c.dom[t.Day()], c.dow[int(t.Weekday())]
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+// next returns the first scheduled minute after t, or the zero time if there
+// is none within five years (e.g. "0 0 31 2 *").
+func (c cronSpec) next(t time.Time) time.Time {
+	t = t.In(c.location).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !c.month[int(t.Month())]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, c.location)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.location)
+		case !c.hour[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, c.location)
+		case !c.minute[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// exitDeadline is returned when --deadline expires; it matches timeout(1) so
+// cron wrappers can tell an overrun from an API failure.
+const exitDeadline = 124
+
+// deadlineGrace is how long commands get to wind down after the deadline
+// before the process is stopped regardless.
+const deadlineGrace = 5 * time.Second
+
+// enforceDeadline stops the process if it is still running deadlineGrace
+// after the deadline, e.g. while blocked outside of an HTTP request. The
+// returned function disarms the watchdog.
+func enforceDeadline(deadline time.Duration) func() {
+	timer := time.AfterFunc(deadline+deadlineGrace, func() {
+		printErrorCode("PINGEN-NET-002", fmt.Sprintf("deadline exceeded after %s", deadline))
+		os.Exit(exitDeadline)
+	})
+	return func() { timer.Stop() }
+}
+
+// cancelledError replaces err with a clear message once --deadline expired or
+// a signal arrived, instead of the transport's "context canceled".
+func cancelledError(ctx appContext, err error) error {
+	if interrupted(ctx) {
+		return codedErrorf("PINGEN-NET-003", "interrupted: %v", err)
+	}
+	if ctx.jobContext != nil && ctx.jobContext.Err() == context.DeadlineExceeded {
+		return codedErrorf("PINGEN-NET-002", "deadline exceeded after %s: %v", ctx.global.deadline, err)
+	}
+	return err
+}
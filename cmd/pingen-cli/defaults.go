@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"strings"
+)
+
+// parseFlags parses args into fs and then fills the flags not given on the
+// command line from the config defaults of the command, keyed by the flag set
+// name with dots: defaults["letters.list"] for "letters list". letters create
+// and letters send apply their defaults themselves, after --from-template.
+func parseFlags(ctx appContext, fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	return applyParsedDefaults(ctx, fs)
+}
+
+// applyParsedDefaults applies the defaults of the parsed flag set fs, unless
+// --help was given so that help still works with a broken default.
+func applyParsedDefaults(ctx appContext, fs *flag.FlagSet) error {
+	if help := fs.Lookup("help"); help != nil && help.Value.String() == "true" {
+		return nil
+	}
+	if err := applyFlagDefaults(ctx, strings.ReplaceAll(fs.Name(), " ", "."), fs); err != nil {
+		reportError(ctx, err)
+		return err
+	}
+	return nil
+}
+
+// parseDefaultKey splits a config key such as
+// "defaults.letters.send.delivery-product" into the command
+// ("letters.send") and the flag name. The command must exist.
+func parseDefaultKey(key string) (string, string, error) {
+	path, _ := strings.CutPrefix(key, "defaults.")
+	dot := strings.LastIndex(path, ".")
+	if dot <= 0 || dot == len(path)-1 {
+		return "", "", codedErrorf("PINGEN-CONFIG-009", "invalid default %s: use defaults.<command>.<flag>, e.g. defaults.letters.send.delivery-product", path)
+	}
+	command, name := path[:dot], strings.TrimLeft(path[dot+1:], "-")
+	words := strings.Split(command, ".")
+	subcommands, known := completionCommands[words[0]]
+	if !known || (len(words) > 1 && !isAllowed(words[1], subcommands)) {
+		return "", "", codedErrorf("PINGEN-CONFIG-009", "invalid default %s: unknown command %q", path, strings.Join(words, " "))
+	}
+	return command, name, nil
+}
+
+// applyFlagDefaults sets flags of command (e.g. "letters.create") from the
+// config defaults section unless they were given on the command line.
+func applyFlagDefaults(ctx appContext, command string, fs *flag.FlagSet) error {
+	return applyFlagValues(fs, ctx.settings.Defaults[command], "default "+command)
+}
+
+// applyFlagValues sets each named flag that is not yet set. source names the
+// origin of the values in errors (e.g. "default letters.create").
+func applyFlagValues(fs *flag.FlagSet, values map[string]string, source string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for name, value := range values {
+		if given[name] {
+			continue
+		}
+		if fs.Lookup(name) == nil {
+			return codedErrorf("PINGEN-CONFIG-009", "invalid %s.%s: unknown flag", source, name)
+		}
+		if err := fs.Set(name, value); err != nil {
+			return codedErrorf("PINGEN-CONFIG-009", "invalid %s.%s: %v", source, name, err)
+		}
+	}
+	return nil
+}
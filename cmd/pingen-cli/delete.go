@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// handleLettersDelete deletes a letter that has not been submitted yet, such
+// as a failed draft. Without --force it shows the letter and asks first.
+func handleLettersDelete(ctx appContext, args []string) int {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("letters delete", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	force := fs.Bool("force", false, "Delete without asking for confirmation")
+	pick := fs.Bool("pick", false, "Choose the letter interactively from the newest letters")
+	help := fs.Bool("help", false, "show help")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil || applyParsedDefaults(ctx, fs) != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli letters delete <letter_id>|--pick [--force]")
+		return 0
+	}
+	var letterID string
+	switch {
+	case len(positional) > 0:
+		letterID, err = resolveLetterID(&ctx, positional[0])
+	case *pick:
+		letterID, err = pickResource(&ctx, "letters")
+	default:
+		printErrorCode("PINGEN-INPUT-001", "letter id required")
+		return 2
+	}
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+
+	if ctx.global.dryRun {
+		return emitDryRun(ctx, map[string]any{
+			"action":          "letters.delete",
+			"organisation_id": ctx.settings.OrganisationID,
+			"letter_id":       letterID,
+		}, func(client pingen.Client) error {
+			_, err := client.DeleteLetter(ctx.jobContext, ctx.settings.OrganisationID, letterID)
+			return err
+		})
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+	if !*force {
+		payload, _, err := client.GetLetterRaw(ctx.jobContext, ctx.settings.OrganisationID, letterID)
+		if err != nil {
+			reportError(ctx, err)
+			return 1
+		}
+		item, _ := payload["data"].(map[string]any)
+		attrs, _ := item["attributes"].(map[string]any)
+		question := fmt.Sprintf("Delete letter %s (%s, %s, created %s)?", letterID, stringValue(attrs["file_original_name"]), stringValue(attrs["status"]), formatTimestamp(ctx, attrs["created_at"]))
+		confirmed, err := confirmAction(question)
+		if err != nil {
+			reportError(ctx, err)
+			return 2
+		}
+		if !confirmed {
+			logf("info", "letter not deleted")
+			return 1
+		}
+	}
+	if _, err := client.DeleteLetter(ctx.jobContext, ctx.settings.OrganisationID, letterID); err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	if ctx.global.jsonOutput {
+		return emitJSON(map[string]any{"id": letterID, "deleted": true})
+	}
+	if !ctx.global.quiet {
+		fmt.Printf("deleted letter %s\n", letterID)
+	}
+	return 0
+}
+
+// confirmAction asks question on stderr and reports whether it was answered
+// with yes. Without a terminal there is nobody to ask, so the command must be
+// confirmed up front with --force.
+func confirmAction(question string) (bool, error) {
+	if !stdinIsTerminal() {
+		return false, codedErrorf("PINGEN-INPUT-001", "confirmation required: stdin is not a terminal; pass --force")
+	}
+	p := &prompter{reader: bufio.NewReader(os.Stdin), out: os.Stderr}
+	answer, err := p.ask(question+" [y/N]", "")
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes", nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// diffOp is one JSON Patch (RFC 6902) operation turning the first letter
+// into the second. Old is only used for the plain-text rendering.
+type diffOp struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value,omitempty"`
+	Old   any    `json:"-"`
+}
+
+func handleLettersDiff(ctx appContext, args []string) int {
+	fs := flag.NewFlagSet("letters diff", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	pick := fs.Bool("pick", false, "Choose the letters not given as arguments interactively")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli letters diff [--pick] <letter_id> <letter_id>  (--json prints a JSON Patch)")
+		return 0
+	}
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	args = fs.Args()
+	for *pick && len(args) < 2 {
+		picked, err := pickResource(&ctx, "letters")
+		if err != nil {
+			reportError(ctx, err)
+			return 1
+		}
+		args = append(args, picked)
+	}
+	if len(args) != 2 {
+		printErrorCode("PINGEN-INPUT-001", "letters diff requires two letter ids")
+		return 2
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+	documents := make([]map[string]any, 2)
+	for i, id := range args {
+		resolved, err := resolveLetterID(&ctx, id)
+		if err != nil {
+			reportError(ctx, err)
+			return 1
+		}
+		payload, _, err := client.GetLetterRaw(ctx.jobContext, ctx.settings.OrganisationID, resolved)
+		if err != nil {
+			reportError(ctx, err)
+			return 1
+		}
+		data, _ := payload["data"].(map[string]any)
+		documents[i] = map[string]any{"attributes": data["attributes"], "meta": data["meta"]}
+	}
+
+	ops := diffValues("", normalizeDiffValue(documents[0]), normalizeDiffValue(documents[1]), nil)
+	if ctx.global.jsonOutput {
+		return emitJSON(ops)
+	}
+	if len(ops) == 0 {
+		if !ctx.global.quiet {
+			logf("info", "no differences")
+		}
+		return 0
+	}
+	color := useColor()
+	paint := func(code, text string) string {
+		if !color {
+			return text
+		}
+		return code + text + "\033[0m"
+	}
+	for _, op := range ops {
+		switch op.Op {
+		case "add":
+			fmt.Println(paint("\033[32m", fmt.Sprintf("+ %s: %s", op.Path, diffText(op.Value))))
+		case "remove":
+			fmt.Println(paint("\033[31m", fmt.Sprintf("- %s: %s", op.Path, diffText(op.Old))))
+		default:
+			fmt.Println(paint("\033[33m", fmt.Sprintf("~ %s: %s -> %s", op.Path, diffText(op.Old), diffText(op.Value))))
+		}
+	}
+	return 0
+}
+
+// diffValues appends the operations turning a into b, recursing into
+// objects and arrays. Keys are visited in sorted order for stable output.
+func diffValues(path string, a, b any, ops []diffOp) []diffOp {
+	if reflect.DeepEqual(a, b) {
+		return ops
+	}
+	aObject, aIsObject := a.(map[string]any)
+	bObject, bIsObject := b.(map[string]any)
+	if aIsObject && bIsObject {
+		keys := map[string]bool{}
+		for key := range aObject {
+			keys[key] = true
+		}
+		for key := range bObject {
+			keys[key] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+		for _, key := range sorted {
+			child := path + "/" + escapePointer(key)
+			aValue, inA := aObject[key]
+			bValue, inB := bObject[key]
+			switch {
+			case !inA:
+				ops = append(ops, diffOp{Op: "add", Path: child, Value: bValue})
+			case !inB:
+				ops = append(ops, diffOp{Op: "remove", Path: child, Old: aValue})
+			default:
+				ops = diffValues(child, aValue, bValue, ops)
+			}
+		}
+		return ops
+	}
+	aList, aIsList := a.([]any)
+	bList, bIsList := b.([]any)
+	if aIsList && bIsList {
+		common := len(aList)
+		if len(bList) < common {
+			common = len(bList)
+		}
+		for i := 0; i < common; i++ {
+			ops = diffValues(path+"/"+strconv.Itoa(i), aList[i], bList[i], ops)
+		}
+		for i := common; i < len(bList); i++ {
+			ops = append(ops, diffOp{Op: "add", Path: path + "/-", Value: bList[i]})
+		}
+		// Remove from the end so earlier indexes stay valid when applied.
+		for i := len(aList) - 1; i >= common; i-- {
+			ops = append(ops, diffOp{Op: "remove", Path: path + "/" + strconv.Itoa(i), Old: aList[i]})
+		}
+		return ops
+	}
+	return append(ops, diffOp{Op: "replace", Path: path, Value: b, Old: a})
+}
+
+// escapePointer escapes a key for use in a JSON Pointer (RFC 6901).
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+// normalizeDiffValue round-trips value through JSON so that numbers and
+// nested types compare uniformly.
+func normalizeDiffValue(value any) any {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var normalized any
+	if err := json.Unmarshal(encoded, &normalized); err != nil {
+		return value
+	}
+	return normalized
+}
+
+func diffText(value any) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return redactText(string(encoded))
+}
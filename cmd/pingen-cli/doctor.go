@@ -0,0 +1,322 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// maxClockSkew is the drift beyond which token expiry checks become unreliable.
+const maxClockSkew = 60 * time.Second
+
+type doctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"` // ok, warn, fail or skip
+	Detail string `json:"detail,omitempty"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+// doctorReport collects check results in order.
+type doctorReport struct {
+	checks []doctorCheck
+}
+
+func (r *doctorReport) add(name, status, detail, hint string) {
+	r.checks = append(r.checks, doctorCheck{Name: name, Status: status, Detail: detail, Hint: hint})
+}
+
+func (r *doctorReport) failed() bool {
+	for _, check := range r.checks {
+		if check.Status == "fail" {
+			return true
+		}
+	}
+	return false
+}
+
+func handleDoctor(ctx appContext, args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli doctor")
+		return 0
+	}
+
+	timeout := time.Duration(ctx.global.timeout) * time.Second
+	report := &doctorReport{}
+	checkLocalConfig(ctx, report)
+	apiReachable := checkEndpoint(report, "api", ctx.settings.APIBase, ctx.transport.TLSClientConfig, timeout)
+	identityReachable := checkEndpoint(report, "identity", ctx.settings.IdentityBase, ctx.transport.TLSClientConfig, timeout)
+	if apiReachable {
+		checkClockSkew(report, ctx.settings.APIBase, ctx.transport, timeout)
+	} else {
+		report.add("clock skew", "skip", "API not reachable", "")
+	}
+
+	token := ""
+	if apiReachable && (identityReachable || ctx.settings.AccessToken != "") {
+		var err error
+		token, err = ensureAccessToken(&ctx)
+		if err != nil {
+			report.add("access token", "fail", err.Error(), "run `pingen-cli init` or `pingen-cli auth token --save`, and check --env")
+		} else {
+			report.add("access token", "ok", "token accepted by identity service or loaded from config", "")
+			checkScopes(report, token)
+		}
+	} else {
+		report.add("access token", "skip", "endpoints not reachable", "")
+	}
+
+	if token != "" {
+		client := newClient(ctx, token)
+		checkOrganisation(ctx, report, client)
+		if _, _, _, err := client.GetFileUpload(ctx.jobContext); err != nil {
+			report.add("file upload", "fail", err.Error(), "the letter scope is needed to upload files; retry later if the API reports 5xx")
+		} else {
+			report.add("file upload", "ok", "upload URL issued", "")
+		}
+	}
+
+	annotateChecks(report)
+	if ctx.global.jsonOutput {
+		emitJSON(map[string]any{"checks": report.checks, "ok": !report.failed()})
+	} else {
+		printDoctorReport(report)
+	}
+	if report.failed() {
+		return 1
+	}
+	return 0
+}
+
+func checkLocalConfig(ctx appContext, report *doctorReport) {
+	if !ctx.configLoaded {
+		report.add("config", "warn", "no config file at "+ctx.configPath, "run `pingen-cli init` to create one")
+	} else {
+		report.add("config", "ok", ctx.configPath, "")
+		if mode, insecure := pingen.InsecureFile(ctx.configPath); insecure && ctx.settings.HasSecrets() {
+			report.add("config permissions", "fail", fmt.Sprintf("readable by other users (mode %04o)", mode), "run `pingen-cli config fix-permissions`")
+		} else {
+			report.add("config permissions", "ok", "", "")
+		}
+	}
+	if ctx.projectPath != "" {
+		report.add("project config", "ok", ctx.projectPath, "")
+	}
+	report.add("environment", "ok", ctx.settings.Env, "")
+	if ctx.settings.OrganisationID == "" {
+		report.add("organisation id", "warn", "not set", "pass --org or run `pingen-cli config set organisation_id <uuid>`")
+	} else if !isUUID(ctx.settings.OrganisationID) {
+		report.add("organisation id", "fail", ctx.settings.OrganisationID+" is not a UUID", "copy the id from `pingen-cli org list`")
+	}
+	if ctx.settings.AccessToken == "" && (ctx.settings.ClientID == "" || ctx.settings.ClientSecret == "") {
+		report.add("credentials", "fail", "no access token and no client id/secret", "run `pingen-cli init`")
+	}
+}
+
+// checkEndpoint resolves the host of base and opens a TCP (and for https a
+// TLS) connection to it, trusting what tlsConfig trusts.
+func checkEndpoint(report *doctorReport, name, base string, tlsConfig *tls.Config, timeout time.Duration) bool {
+	parsed, err := url.Parse(base)
+	if err != nil || parsed.Host == "" {
+		report.add(name+" url", "fail", fmt.Sprintf("invalid base URL %q", base), "check --"+name+"-base and the config")
+		return false
+	}
+	host := parsed.Hostname()
+	if _, err := net.LookupHost(host); err != nil {
+		report.add(name+" dns", "fail", err.Error(), "check DNS, VPN and proxy settings")
+		return false
+	}
+	report.add(name+" dns", "ok", host, "")
+
+	port := parsed.Port()
+	if port == "" {
+		port = "443"
+		if parsed.Scheme == "http" {
+			port = "80"
+		}
+	}
+	address := net.JoinHostPort(host, port)
+	dialer := &net.Dialer{Timeout: timeout}
+	if parsed.Scheme != "https" {
+		conn, err := dialer.Dial("tcp", address)
+		if err != nil {
+			report.add(name+" connect", "fail", err.Error(), "check firewalls and proxies")
+			return false
+		}
+		conn.Close()
+		report.add(name+" connect", "warn", address+" (plain http, no TLS)", "use https outside of local testing")
+		return true
+	}
+	config := tlsConfig.Clone()
+	config.ServerName = host
+	conn, err := tls.DialWithDialer(dialer, "tcp", address, config)
+	if err != nil {
+		report.add(name+" tls", "fail", err.Error(), "a TLS-intercepting proxy needs its CA in the system trust store or passed with --ca-cert")
+		return false
+	}
+	defer conn.Close()
+	certs := conn.ConnectionState().PeerCertificates
+	detail := address
+	if len(certs) > 0 {
+		expires := certs[0].NotAfter
+		detail = fmt.Sprintf("%s, certificate valid until %s", address, expires.Format("2006-01-02"))
+		if time.Until(expires) < 7*24*time.Hour {
+			report.add(name+" tls", "warn", detail, "the server certificate expires soon")
+			return true
+		}
+	}
+	report.add(name+" tls", "ok", detail, "")
+	return true
+}
+
+// checkClockSkew compares the local clock with the API's Date header.
+func checkClockSkew(report *doctorReport, base string, transport http.RoundTripper, timeout time.Duration) {
+	req, err := http.NewRequest("HEAD", base, nil)
+	if err != nil {
+		report.add("clock skew", "skip", err.Error(), "")
+		return
+	}
+	req.Header.Set("User-Agent", pingen.UserAgent)
+	sent := time.Now()
+	resp, err := (&http.Client{Transport: transport, Timeout: timeout}).Do(req)
+	if err != nil {
+		report.add("clock skew", "skip", err.Error(), "")
+		return
+	}
+	resp.Body.Close()
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		report.add("clock skew", "skip", "no Date header in response", "")
+		return
+	}
+	skew := sent.Add(time.Since(sent) / 2).Sub(serverTime).Round(time.Second)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > maxClockSkew {
+		report.add("clock skew", "fail", fmt.Sprintf("local clock is off by %s", skew), "enable NTP time sync; token expiry depends on an accurate clock")
+		return
+	}
+	report.add("clock skew", "ok", skew.String(), "")
+}
+
+// checkScopes reports the scopes of a JWT access token. Opaque tokens are skipped.
+func checkScopes(report *doctorReport, token string) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		report.add("token scopes", "skip", "token is not a JWT", "")
+		return
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		report.add("token scopes", "skip", "token payload not decodable", "")
+		return
+	}
+	var claims struct {
+		Scopes []string `json:"scopes"`
+		Scope  string   `json:"scope"`
+		Exp    int64    `json:"exp"`
+	}
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		report.add("token scopes", "skip", "token payload not decodable", "")
+		return
+	}
+	scopes := claims.Scopes
+	if len(scopes) == 0 && claims.Scope != "" {
+		scopes = strings.Fields(claims.Scope)
+	}
+	if claims.Exp != 0 && time.Now().Unix() > claims.Exp {
+		report.add("token expiry", "fail", "expired at "+time.Unix(claims.Exp, 0).Format(time.RFC3339), "fetch a new token with `pingen-cli auth token --save`")
+	}
+	missing := []string{}
+	for _, want := range strings.Fields(defaultScope) {
+		if !isAllowed(want, scopes) {
+			missing = append(missing, want)
+		}
+	}
+	if len(missing) > 0 {
+		report.add("token scopes", "warn", "missing "+strings.Join(missing, ", "), "request the scopes with `auth token --scope` or grant them to the client")
+		return
+	}
+	report.add("token scopes", "ok", strings.Join(scopes, " "), "")
+}
+
+func checkOrganisation(ctx appContext, report *doctorReport, client pingen.Client) {
+	if ctx.settings.OrganisationID == "" {
+		report.add("organisation access", "skip", "no organisation id", "")
+		return
+	}
+	payload, _, err := client.GetOrganisationRaw(ctx.jobContext, ctx.settings.OrganisationID)
+	if err != nil {
+		report.add("organisation access", "fail", err.Error(), "check --org and that the client belongs to the organisation")
+		return
+	}
+	data, _ := payload["data"].(map[string]any)
+	attrs, _ := data["attributes"].(map[string]any)
+	detail := strings.TrimSpace(fmt.Sprintf("%s (%s)", stringValue(attrs["name"]), stringValue(attrs["status"])))
+	if status := stringValue(attrs["status"]); status != "" && status != "active" {
+		report.add("organisation access", "warn", detail, "the organisation is not active; letters may be rejected")
+		return
+	}
+	report.add("organisation access", "ok", detail, "")
+}
+
+// annotateChecks reports failed and warning checks as --ci annotations.
+func annotateChecks(report *doctorReport) {
+	levels := map[string]string{"fail": "error", "warn": "warn"}
+	for _, check := range report.checks {
+		level, ok := levels[check.Status]
+		if !ok {
+			continue
+		}
+		message := check.Name
+		if check.Detail != "" {
+			message += ": " + check.Detail
+		}
+		annotatef(level, "%s", message)
+	}
+}
+
+func printDoctorReport(report *doctorReport) {
+	color := useColor()
+	marks := map[string]string{"ok": "✔", "warn": "!", "fail": "✘", "skip": "-"}
+	colors := map[string]string{"ok": "\033[32m", "warn": "\033[33m", "fail": "\033[31m", "skip": "\033[90m"}
+	for _, check := range report.checks {
+		mark := marks[check.Status]
+		if color {
+			mark = colors[check.Status] + mark + "\033[0m"
+		}
+		line := fmt.Sprintf("%s %s", mark, check.Name)
+		if check.Detail != "" {
+			line += ": " + check.Detail
+		}
+		fmt.Println(line)
+		if check.Hint != "" && check.Status != "ok" {
+			fmt.Printf("    hint: %s\n", check.Hint)
+		}
+	}
+}
+
+// useColor reports whether stdout is a terminal and NO_COLOR is unset.
+func useColor() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := terminalStdout().Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
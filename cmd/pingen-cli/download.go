@@ -0,0 +1,519 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// manifestName is the file written next to the downloaded PDFs.
+const manifestName = "manifest.json"
+
+// downloadManifest records what a download run archived.
+type downloadManifest struct {
+	GeneratedAt    string          `json:"generated_at"`
+	OrganisationID string          `json:"organisation_id"`
+	Filter         string          `json:"filter,omitempty"`
+	Letters        []downloadEntry `json:"letters"`
+}
+
+type downloadEntry struct {
+	ID               string `json:"id"`
+	FileOriginalName string `json:"file_original_name,omitempty"`
+	Status           string `json:"status,omitempty"`
+	CreatedAt        string `json:"created_at,omitempty"`
+	Path             string `json:"path,omitempty"`
+	Bytes            int64  `json:"bytes,omitempty"`
+	SHA256           string `json:"sha256,omitempty"`
+	Result           string `json:"result"`
+	Error            string `json:"error,omitempty"`
+
+	input    string
+	price    string
+	currency string
+}
+
+func handleLettersDownload(ctx appContext, args []string) (exitCode int) {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("letters download", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	filter := fs.String("filter", "", "Filter JSON string or @path")
+	var where stringList
+	fs.Var(&where, "where", "Filter clause (repeatable), see letters list")
+	preset := fs.String("preset", "", "Apply a saved filter preset")
+	since := fs.String("since", "", "Only letters created at or after this time")
+	until := fs.String("until", "", "Only letters created before this time")
+	all := fs.Bool("all", false, "Download every matching letter, not just the first page")
+	outDir := fs.String("out-dir", "", "Directory for the PDFs and manifest.json")
+	zipPath := fs.String("zip", "", "Also pack the PDFs and manifest into this zip archive")
+	output := fs.String("output", "", "Write the PDF of a single letter to this file instead of --out-dir")
+	concurrency := fs.Int("concurrency", 4, "Parallel downloads and page fetches")
+	pick := fs.Bool("pick", false, "Choose the letter to download interactively")
+	reportOptions := addReportFlags(fs)
+	help := fs.Bool("help", false, "show help")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil || applyParsedDefaults(ctx, fs) != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli letters download --out-dir dir [--filter json] [--where clause]... [--preset name] [--since time] [--until time] [--all] [--zip file] [--concurrency N] [--report-dir dir [--csv-delimiter c] [--decimal-comma]] [letter-id...|--pick]")
+		fmt.Println("       pingen-cli letters download <letter_id>|--pick --output file.pdf")
+		return 0
+	}
+	if *output != "" {
+		if *outDir != "" || *zipPath != "" || *all {
+			printErrorCode("PINGEN-INPUT-001", "--output cannot be combined with --out-dir, --zip or --all")
+			return 2
+		}
+		if len(positional) > 1 || (len(positional) == 0 && !*pick) {
+			printErrorCode("PINGEN-INPUT-001", "--output requires a single letter id or --pick")
+			return 2
+		}
+		return downloadLetterFile(ctx, positional, *output)
+	}
+	if *outDir == "" {
+		printErrorCode("PINGEN-INPUT-001", "--out-dir is required")
+		return 2
+	}
+	if *concurrency < 1 {
+		printErrorCode("PINGEN-INPUT-001", "--concurrency must be at least 1")
+		return 2
+	}
+
+	var unusedSort, unusedSortBy string
+	if err := applyPreset(ctx, *preset, filter, &unusedSort, &unusedSortBy, &where); err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	rangeClauses, err := timeRangeClauses("created_at", *since, *until, inputLocation(ctx))
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	where = append(where, rangeClauses...)
+	filterExpr, err := compileFilter(*filter, where)
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+
+	ids := positional
+	if len(ids) == 0 && *pick {
+		picked, err := pickResource(&ctx, "letters")
+		if err != nil {
+			reportError(ctx, err)
+			return 1
+		}
+		ids = []string{picked}
+	}
+	var entries []downloadEntry
+	if len(ids) > 0 {
+		entries, err = downloadEntriesForIDs(&ctx, client, ids)
+	} else {
+		entries, err = downloadEntriesForFilter(ctx, client, filterExpr, *all, *concurrency)
+	}
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+
+	if ctx.global.dryRun {
+		ids := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			ids = append(ids, entry.ID)
+		}
+		return emitJSON(map[string]any{
+			"action":          "letters.download",
+			"organisation_id": ctx.settings.OrganisationID,
+			"out_dir":         *outDir,
+			"zip":             *zipPath,
+			"letters":         ids,
+		})
+	}
+
+	if err := os.MkdirAll(*outDir, 0o700); err != nil {
+		printErrorCode("PINGEN-DOWNLOAD-001", fmt.Sprintf("failed to create output directory: %v", err))
+		return 1
+	}
+	report := newRunReport(ctx, "letters download")
+	defer func() {
+		for _, entry := range entries {
+			report.add(reportItem{
+				Input:    entry.input,
+				LetterID: entry.ID,
+				Status:   entry.Status,
+				Result:   entry.Result,
+				Cost:     entry.price,
+				Currency: entry.currency,
+				Error:    entry.Error,
+			})
+		}
+		report.write(ctx, reportOptions, exitCode)
+	}()
+	var stopSignals func()
+	ctx.jobContext, stopSignals = handleSignals(ctx.jobContext)
+	defer stopSignals()
+	downloadAll(ctx, client, entries, *outDir, *concurrency)
+
+	manifest := downloadManifest{
+		GeneratedAt:    time.Now().Format(apiTimeLayout),
+		OrganisationID: ctx.settings.OrganisationID,
+		Filter:         filterExpr,
+		Letters:        entries,
+	}
+	if err := writeManifest(filepath.Join(*outDir, manifestName), manifest); err != nil {
+		printErrorCode("PINGEN-DOWNLOAD-001", fmt.Sprintf("failed to write manifest: %v", err))
+		return 1
+	}
+	failed, pending := 0, 0
+	for _, entry := range entries {
+		switch entry.Result {
+		case "failed":
+			failed++
+			annotatef("error", "letter %s: download failed: %s", entry.ID, entry.Error)
+		case "pending":
+			pending++
+		}
+	}
+	if *zipPath != "" && pending == 0 {
+		if err := writeDownloadZip(*zipPath, *outDir, entries); err != nil {
+			printErrorCode("PINGEN-DOWNLOAD-001", fmt.Sprintf("failed to write archive: %v", err))
+			return 1
+		}
+	}
+
+	if ctx.global.jsonOutput {
+		emitJSON(manifest)
+	} else {
+		endGroup := ciGroup(ctx, fmt.Sprintf("letters download: %d letters", len(entries)))
+		for _, entry := range entries {
+			detail := entry.Path
+			if entry.Error != "" {
+				detail = entry.Error
+			}
+			fmt.Printf("%s\t%s\t%s\n", entry.ID, entry.Result, detail)
+		}
+		endGroup()
+		if !ctx.global.quiet {
+			logf("info", "%d letters, %d failed; manifest: %s", len(entries), failed, filepath.Join(*outDir, manifestName))
+		}
+	}
+	if pending > 0 {
+		logf("info", "stopped early: %d of %d letters done, %d pending; re-run the same command to resume", len(entries)-pending, len(entries), pending)
+	}
+	if interrupted(ctx) {
+		return exitInterrupted
+	}
+	if failed > 0 || pending > 0 {
+		return 1
+	}
+	return 0
+}
+
+// downloadLetterFile saves the PDF of one letter, exactly as Pingen printed
+// it, to path. Progress is drawn on stderr when it is a terminal; an
+// interrupted transfer resumes from path.part on the next run.
+func downloadLetterFile(ctx appContext, ids []string, path string) int {
+	var letterID string
+	var err error
+	if len(ids) > 0 {
+		letterID, err = resolveLetterID(&ctx, ids[0])
+	} else {
+		letterID, err = pickResource(&ctx, "letters")
+	}
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	if ctx.global.dryRun {
+		return emitJSON(map[string]any{
+			"action":          "letters.download",
+			"organisation_id": ctx.settings.OrganisationID,
+			"letter_id":       letterID,
+			"output":          path,
+		})
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	var stopSignals func()
+	ctx.jobContext, stopSignals = handleSignals(ctx.jobContext)
+	defer stopSignals()
+	client := newClient(ctx, token)
+	fileURL, _, err := client.GetLetterFileURL(ctx.jobContext, ctx.settings.OrganisationID, letterID)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	progress := &transferProgress{action: "downloading"}
+	if !ctx.global.quiet && !ctx.global.jsonOutput && stderrIsTerminal() {
+		client.OnProgress = progress.update
+	}
+	_, err = client.DownloadFile(ctx.jobContext, fileURL, path)
+	progress.finish()
+	if err != nil {
+		if interrupted(ctx) {
+			logf("info", "download interrupted; re-run the same command to resume")
+			return exitInterrupted
+		}
+		reportError(ctx, err)
+		return 1
+	}
+	size, sum, err := fileDigest(path)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	if ctx.global.jsonOutput {
+		return emitJSON(downloadEntry{ID: letterID, Path: path, Bytes: size, SHA256: sum, Result: "downloaded"})
+	}
+	fmt.Printf("%s\tdownloaded\t%s\t%s\tsha256:%s\n", letterID, path, pingen.FormatSize(size), sum)
+	return 0
+}
+
+// transferProgress redraws one status line on stderr, at most every 100ms.
+type transferProgress struct {
+	action string
+	drawn  time.Time
+	line   string
+}
+
+func (p *transferProgress) update(done, total int64) {
+	if time.Since(p.drawn) < 100*time.Millisecond && done != total {
+		return
+	}
+	p.drawn = time.Now()
+	p.line = p.action + " " + pingen.FormatSize(done)
+	if total > 0 {
+		p.line += fmt.Sprintf(" of %s (%d%%)", pingen.FormatSize(total), done*100/total)
+	}
+	fmt.Fprintf(os.Stderr, "\r%s\033[K", p.line)
+}
+
+// uploadProgress shows the progress of the client's uploads on a terminal.
+// Call finish on the result when the upload is done.
+func uploadProgress(ctx appContext, client *pingen.Client) *transferProgress {
+	progress := &transferProgress{action: "uploading"}
+	if !ctx.global.quiet && !ctx.global.jsonOutput && stderrIsTerminal() {
+		client.OnUploadProgress = progress.update
+	}
+	return progress
+}
+
+func (p *transferProgress) finish() {
+	if p.line != "" {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+}
+
+func stderrIsTerminal() bool {
+	info, err := os.Stderr.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func downloadEntriesForIDs(ctx *appContext, client pingen.Client, ids []string) ([]downloadEntry, error) {
+	entries := make([]downloadEntry, 0, len(ids))
+	for _, id := range ids {
+		resolved, err := resolveLetterID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		payload, _, err := client.GetLetterRaw(ctx.jobContext, ctx.settings.OrganisationID, resolved)
+		if err != nil {
+			return nil, err
+		}
+		item, _ := payload["data"].(map[string]any)
+		entry := newDownloadEntry(item)
+		entry.input = id
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// downloadEntriesForFilter lists matching letters; with all set every page is
+// fetched, concurrency pages at a time.
+func downloadEntriesForFilter(ctx appContext, client pingen.Client, filterExpr string, all bool, concurrency int) ([]downloadEntry, error) {
+	fetch := func(page int) (map[string]any, error) {
+		params := buildListParams(page, 100, "-created_at", filterExpr, "", "", "", "letters")
+		payload, _, err := client.ListLettersRaw(ctx.jobContext, ctx.settings.OrganisationID, params)
+		return payload, err
+	}
+	var items []map[string]any
+	if all {
+		var err error
+		if items, err = fetchAllPages(ctx.jobContext, concurrency, fetch); err != nil {
+			return nil, err
+		}
+	} else {
+		payload, err := fetch(1)
+		if err != nil {
+			return nil, err
+		}
+		items = pageItems(payload)
+	}
+	entries := make([]downloadEntry, 0, len(items))
+	for _, item := range items {
+		entries = append(entries, newDownloadEntry(item))
+	}
+	return entries, nil
+}
+
+func newDownloadEntry(item map[string]any) downloadEntry {
+	attrs, _ := item["attributes"].(map[string]any)
+	return downloadEntry{
+		ID:               stringValue(item["id"]),
+		FileOriginalName: stringValue(attrs["file_original_name"]),
+		Status:           stringValue(attrs["status"]),
+		CreatedAt:        stringValue(attrs["created_at"]),
+		input:            stringValue(item["id"]),
+		price:            stringValue(attrs["price_value"]),
+		currency:         stringValue(attrs["price_currency"]),
+	}
+}
+
+// downloadAll fetches entries with a fixed pool of workers. Files already
+// present in outDir are kept, so an interrupted run can simply be repeated.
+// Once the job context is cancelled no new downloads start; entries not
+// finished by then are marked pending.
+func downloadAll(ctx appContext, client pingen.Client, entries []downloadEntry, outDir string, workers int) {
+	pingen.RunPool(ctx.jobContext, workers, len(entries), func(_ context.Context, i int) error {
+		downloadOne(ctx, client, &entries[i], outDir)
+		return nil
+	})
+	for i := range entries {
+		if entries[i].Result == "" {
+			entries[i].Result = "pending"
+		}
+	}
+}
+
+func downloadOne(ctx appContext, client pingen.Client, entry *downloadEntry, outDir string) {
+	path := filepath.Join(outDir, entry.ID+".pdf")
+	entry.Path = path
+	entry.Result = "skipped"
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		entry.Result = "downloaded"
+		fileURL, _, err := client.GetLetterFileURL(ctx.jobContext, ctx.settings.OrganisationID, entry.ID)
+		if err == nil {
+			_, err = client.DownloadFile(ctx.jobContext, fileURL, path)
+		}
+		if err != nil && ctx.jobContext.Err() != nil {
+			// Cancelled mid-transfer; the .part file is resumed next run.
+			entry.Result = "pending"
+			return
+		}
+		if err != nil {
+			entry.Result = "failed"
+			entry.Error = err.Error()
+			return
+		}
+	}
+	size, sum, err := fileDigest(path)
+	if err != nil {
+		entry.Result = "failed"
+		entry.Error = err.Error()
+		return
+	}
+	entry.Bytes = size
+	entry.SHA256 = sum
+}
+
+func fileDigest(path string) (int64, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func writeManifest(path string, manifest downloadManifest) error {
+	encoded, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(encoded, '\n'), 0o600)
+}
+
+// writeDownloadZip packs the downloaded PDFs and the manifest into zipPath.
+func writeDownloadZip(zipPath, outDir string, entries []downloadEntry) error {
+	tmpPath := zipPath + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	archive := zip.NewWriter(file)
+	paths := []string{filepath.Join(outDir, manifestName)}
+	for _, entry := range entries {
+		if entry.Result != "failed" {
+			paths = append(paths, entry.Path)
+		}
+	}
+	for _, path := range paths {
+		if err = addZipFile(archive, path); err != nil {
+			break
+		}
+	}
+	if closeErr := archive.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, zipPath)
+}
+
+func addZipFile(archive *zip.Writer, path string) error {
+	source, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Method = zip.Deflate
+	target, err := archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(target, source)
+	return err
+}
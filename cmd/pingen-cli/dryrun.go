@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// previewLetterID stands in for the id of a letter that a previewed request
+// would create.
+const previewLetterID = "{id of the created letter}"
+
+// previewRequests runs calls against a client that records their requests
+// instead of sending them, for the "requests" of --dry-run plans. Each call
+// stops at its first request after the upload. The access token is a
+// stand-in, as previews mask it anyway and must work without credentials;
+// payloads are redacted like the rest of the plan.
+func previewRequests(ctx appContext, calls ...func(client pingen.Client) error) ([]pingen.RequestPreview, error) {
+	requests := []pingen.RequestPreview{}
+	client := newClient(ctx, "dry-run")
+	client.DryRun = func(request pingen.RequestPreview) {
+		request.Payload = redactPayload(request.Payload)
+		requests = append(requests, request)
+	}
+	for _, call := range calls {
+		if err := call(client); err != nil && !errors.Is(err, pingen.ErrDryRun) {
+			return nil, err
+		}
+	}
+	return requests, nil
+}
+
+// emitDryRun prints plan with the requests the calls would send.
+func emitDryRun(ctx appContext, plan map[string]any, calls ...func(client pingen.Client) error) int {
+	requests, err := previewRequests(ctx, calls...)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	plan = redactPayload(plan).(map[string]any)
+	plan["requests"] = requests
+	return emitJSON(plan)
+}
+
+// previewLetterUpload is the call that uploads a file and creates a letter
+// from it. CreateLetterFromFile adds the upload to upload.Attributes, so pass
+// a copy of attributes that are shown in the plan.
+func previewLetterUpload(ctx appContext, upload pingen.LetterUpload) func(client pingen.Client) error {
+	return func(client pingen.Client) error {
+		_, err := client.CreateLetterFromFileRaw(ctx.jobContext, ctx.settings.OrganisationID, upload, 0)
+		return err
+	}
+}
+
+// copyMap returns a shallow copy of values, e.g. of attributes that a
+// preview adds the upload placeholders to.
+func copyMap(values map[string]any) map[string]any {
+	copied := make(map[string]any, len(values))
+	for key, value := range values {
+		copied[key] = value
+	}
+	return copied
+}
+
+// configSecretKeys are config keys whose values --dry-run does not show.
+var configSecretKeys = []string{"access_token", "refresh_token", "client_secret"}
+
+// emitConfigPlan prints the change a config command would write; value is
+// nil for keys that would be removed.
+func emitConfigPlan(ctx appContext, action, key string, value any) int {
+	plan := map[string]any{"action": action, "config": ctx.configPath, "key": key}
+	if value != nil {
+		header, isHeader := strings.CutPrefix(key, "headers.")
+		if isAllowed(key, configSecretKeys) || isHeader && pingen.SensitiveHeader(header) {
+			value = redactedMarker
+		}
+		plan["value"] = value
+	}
+	return emitJSON(plan)
+}
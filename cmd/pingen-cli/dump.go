@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+const dumpCursorName = "cursor.json"
+
+// dumpCursorOverlap is subtracted from the start of the previous dump so that
+// records updated during it, or under clock skew, are fetched again.
+const dumpCursorOverlap = 5 * time.Minute
+
+// dumpCursor records, per resource, when the last complete dump started.
+// Records updated since then are fetched by the next run.
+type dumpCursor struct {
+	OrganisationID string            `json:"organisation_id"`
+	Resources      map[string]string `json:"resources"`
+}
+
+// dumpResult summarises one resource of `export dump`.
+type dumpResult struct {
+	Resource    string `json:"resource"`
+	File        string `json:"file"`
+	Incremental bool   `json:"incremental"`
+	Fetched     int    `json:"fetched"`
+	Total       int    `json:"total"`
+	PDFs        int    `json:"pdfs,omitempty"`
+	PDFsFailed  int    `json:"pdfs_failed,omitempty"`
+	Pending     int    `json:"pending,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// handleExportDump writes a backup of the organisation:
+//
+//	backup/cursor.json
+//	backup/letters.jsonl
+//	backup/batches.jsonl
+//	backup/webhooks.jsonl
+//	backup/pdfs/<letter id>.pdf   (--pdfs)
+//
+// Letters and batches are fetched incrementally after the first run and
+// merged into the JSONL files by id; webhooks are few and always re-listed.
+func handleExportDump(ctx appContext, args []string) int {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	flags := flag.NewFlagSet("export dump", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	outDir := flags.String("out", "", "Backup directory")
+	withPDFs := flags.Bool("pdfs", false, "Also download the PDF of every letter")
+	full := flags.Bool("full", false, "Ignore the cursor and re-list everything; drops records deleted on Pingen")
+	concurrency := flags.Int("concurrency", 4, "Parallel page fetches and PDF downloads")
+	help := flags.Bool("help", false, "show help")
+	if err := parseFlags(ctx, flags, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli export dump --out dir [--pdfs] [--full] [--concurrency N]")
+		return 0
+	}
+	if *outDir == "" {
+		printErrorCode("PINGEN-INPUT-001", "--out is required")
+		return 2
+	}
+	if *concurrency < 1 {
+		printErrorCode("PINGEN-INPUT-001", "--concurrency must be at least 1")
+		return 2
+	}
+	cursorPath := filepath.Join(*outDir, dumpCursorName)
+	cursor, err := loadDumpCursor(cursorPath)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	if cursor.OrganisationID != "" && cursor.OrganisationID != ctx.settings.OrganisationID {
+		printErrorCode("PINGEN-INPUT-001", fmt.Sprintf("organisation mismatch: %s holds a dump of organisation %s; use another --out directory", *outDir, cursor.OrganisationID))
+		return 2
+	}
+	if *full {
+		cursor.Resources = map[string]string{}
+	}
+
+	if ctx.global.dryRun {
+		return emitJSON(map[string]any{
+			"action":          "export.dump",
+			"organisation_id": ctx.settings.OrganisationID,
+			"out":             *outDir,
+			"pdfs":            *withPDFs,
+			"since":           cursor.Resources,
+		})
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+	if err := os.MkdirAll(*outDir, 0o700); err != nil {
+		printErrorCode("PINGEN-DOWNLOAD-001", fmt.Sprintf("failed to create output directory: %v", err))
+		return 1
+	}
+	var stopSignals func()
+	ctx.jobContext, stopSignals = handleSignals(ctx.jobContext)
+	defer stopSignals()
+
+	orgID := ctx.settings.OrganisationID
+	cursor.OrganisationID = orgID
+	resources := []struct {
+		name        string
+		incremental bool
+		list        func(params map[string]string) (map[string]any, error)
+	}{
+		{"letters", true, func(params map[string]string) (map[string]any, error) {
+			payload, _, err := client.ListLettersRaw(ctx.jobContext, orgID, params)
+			return payload, err
+		}},
+		{"batches", true, func(params map[string]string) (map[string]any, error) {
+			payload, _, err := client.ListBatchesRaw(ctx.jobContext, orgID, params)
+			return payload, err
+		}},
+		{"webhooks", false, func(params map[string]string) (map[string]any, error) {
+			payload, _, err := client.ListWebhooksRaw(ctx.jobContext, orgID, params)
+			return payload, err
+		}},
+	}
+	results := []dumpResult{}
+	failed := false
+	for _, resource := range resources {
+		if interrupted(ctx) {
+			break
+		}
+		var err error
+		started := time.Now()
+		since := ""
+		if resource.incremental {
+			since = cursor.Resources[resource.name]
+		}
+		result := dumpResult{Resource: resource.name, File: filepath.Join(*outDir, resource.name+".jsonl"), Incremental: since != ""}
+		filterExpr := ""
+		if since != "" {
+			filterExpr, err = compileFilter("", []string{"updated_at>=" + since})
+		}
+		var items []map[string]any
+		if err == nil {
+			items, err = fetchAllPages(ctx.jobContext, *concurrency, func(page int) (map[string]any, error) {
+				return resource.list(buildListParams(page, 100, "", filterExpr, "", "", "", resource.name))
+			})
+		}
+		if err == nil {
+			result.Fetched = len(items)
+			result.Total, err = mergeJSONL(result.File, items, since == "")
+		}
+		if err == nil && resource.name == "letters" && *withPDFs {
+			err = dumpPDFs(ctx, client, items, filepath.Join(*outDir, "pdfs"), *concurrency, &result)
+		}
+		if err != nil {
+			result.Error = err.Error()
+			failed = true
+			annotatef("error", "%s: dump failed: %s", resource.name, result.Error)
+		} else if resource.incremental && result.Pending == 0 && result.PDFsFailed == 0 {
+			cursor.Resources[resource.name] = started.Add(-dumpCursorOverlap).Format(apiTimeLayout)
+		}
+		results = append(results, result)
+	}
+	if err := writeJSONFile(cursorPath, cursor); err != nil {
+		printErrorCode("PINGEN-DOWNLOAD-001", fmt.Sprintf("failed to write cursor: %v", err))
+		return 1
+	}
+
+	pending := false
+	if ctx.global.jsonOutput {
+		emitJSON(map[string]any{"organisation_id": orgID, "out": *outDir, "resources": results})
+	}
+	for _, result := range results {
+		if result.PDFsFailed > 0 {
+			failed = true
+		}
+		if result.Pending > 0 {
+			pending = true
+		}
+		if ctx.global.jsonOutput {
+			continue
+		}
+		detail := fmt.Sprintf("%d fetched, %d total", result.Fetched, result.Total)
+		if result.Incremental {
+			detail = fmt.Sprintf("%d updated, %d total", result.Fetched, result.Total)
+		}
+		if result.PDFs > 0 || result.PDFsFailed > 0 {
+			detail += fmt.Sprintf(", %d PDFs (%d failed)", result.PDFs, result.PDFsFailed)
+		}
+		if result.Error != "" {
+			detail = "failed: " + result.Error
+		}
+		fmt.Printf("%s\t%s\t%s\n", result.Resource, detail, result.File)
+	}
+	if pending || len(results) < len(resources) {
+		logf("info", "stopped early; re-run the same command to resume")
+	}
+	if interrupted(ctx) {
+		return exitInterrupted
+	}
+	if failed || pending {
+		return 1
+	}
+	return 0
+}
+
+func loadDumpCursor(path string) (dumpCursor, error) {
+	cursor := dumpCursor{Resources: map[string]string{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cursor, nil
+	}
+	if err != nil {
+		return cursor, codedErrorf("PINGEN-DOWNLOAD-001", "failed to read cursor file: %w", err)
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, codedErrorf("PINGEN-DOWNLOAD-001", "invalid cursor file %s: %w", path, err)
+	}
+	if cursor.Resources == nil {
+		cursor.Resources = map[string]string{}
+	}
+	return cursor, nil
+}
+
+// mergeJSONL upserts items into the JSONL file at path by id, keeping the
+// order of existing records and appending new ones. With replace set the file
+// is rewritten with items only. It returns the number of records written.
+func mergeJSONL(path string, items []map[string]any, replace bool) (int, error) {
+	records := []map[string]any{}
+	if !replace {
+		existing, err := readJSONL(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return 0, withCode("PINGEN-DOWNLOAD-001", err)
+		}
+		records = append(records, existing...)
+	}
+	index := map[string]int{}
+	for i, record := range records {
+		index[stringValue(record["id"])] = i
+	}
+	for _, item := range items {
+		id := stringValue(item["id"])
+		if i, ok := index[id]; ok {
+			records[i] = item
+			continue
+		}
+		index[id] = len(records)
+		records = append(records, item)
+	}
+
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, record := range records {
+		if err = encoder.Encode(record); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return 0, err
+	}
+	return len(records), os.Rename(tmpPath, path)
+}
+
+// dumpPDFs downloads the PDFs of the listed letters into dir; files already
+// present are kept, so interrupted runs resume.
+func dumpPDFs(ctx appContext, client pingen.Client, letters []map[string]any, dir string, concurrency int, result *dumpResult) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	entries := make([]downloadEntry, 0, len(letters))
+	for _, letter := range letters {
+		entries = append(entries, newDownloadEntry(letter))
+	}
+	downloadAll(ctx, client, entries, dir, concurrency)
+	for _, entry := range entries {
+		switch entry.Result {
+		case "downloaded", "skipped":
+			result.PDFs++
+		case "pending":
+			result.Pending++
+		default:
+			result.PDFsFailed++
+			logf("warn", "PDF of letter %s not saved: %s", entry.ID, entry.Error)
+		}
+	}
+	return nil
+}
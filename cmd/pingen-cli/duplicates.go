@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// duplicateFields are the letter fields compared by default: the same
+// document (name and page count) to the same address with the same meta data
+// is most likely one letter submitted twice.
+const duplicateFields = "file_original_name,file_pages,address,meta_data"
+
+// duplicateGroup is a set of letters that agree on every --by field.
+type duplicateGroup struct {
+	Key       map[string]any     `json:"key"`
+	Letters   []duplicateEntry   `json:"letters"`
+	ExtraCost map[string]float64 `json:"extra_cost,omitempty"`
+}
+
+type duplicateEntry struct {
+	ID               string `json:"id"`
+	Status           string `json:"status"`
+	FileOriginalName string `json:"file_original_name"`
+	CreatedAt        string `json:"created_at"`
+	Price            string `json:"price,omitempty"`
+	Currency         string `json:"currency,omitempty"`
+	// Result is "original" for the oldest letter of a group and "duplicate"
+	// for the others.
+	Result string `json:"result"`
+}
+
+// handleLettersDuplicates lists groups of letters created in the time range
+// that agree on every --by field, oldest first, with the postage the later
+// ones cost. Cancelled letters are ignored unless --include-cancelled is set.
+func handleLettersDuplicates(ctx appContext, args []string) (exitCode int) {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("letters duplicates", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	since := fs.String("since", "30d", "Only letters created at or after this time")
+	until := fs.String("until", "", "Only letters created before this time")
+	var where stringList
+	fs.Var(&where, "where", "Filter clause limiting the letters checked (repeatable), see letters list")
+	by := fs.String("by", duplicateFields, "Comma-separated letter fields that must match, e.g. address,meta.tags.ref")
+	includeCancelled := fs.Bool("include-cancelled", false, "Also compare cancelled letters")
+	concurrency := fs.Int("concurrency", 4, "Parallel page fetches")
+	reportOptions := addReportFlags(fs)
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli letters duplicates [--since time] [--until time] [--where clause]... [--by fields] [--include-cancelled] [--concurrency N] [--report-dir dir [--csv-delimiter c] [--decimal-comma]]")
+		return 0
+	}
+	fields := splitColumns(*by)
+	if len(fields) == 0 {
+		printErrorCode("PINGEN-INPUT-001", "--by requires at least one field")
+		return 2
+	}
+	if *concurrency < 1 {
+		printErrorCode("PINGEN-INPUT-001", "--concurrency must be at least 1")
+		return 2
+	}
+	rangeClauses, err := timeRangeClauses("created_at", *since, *until, inputLocation(ctx))
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	filterExpr, err := compileFilter("", append(where, rangeClauses...))
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+	letters, err := fetchAllPages(ctx.jobContext, *concurrency, func(page int) (map[string]any, error) {
+		params := buildListParams(page, 100, "created_at", filterExpr, "", "", "", "letters")
+		payload, _, err := client.ListLettersRaw(ctx.jobContext, ctx.settings.OrganisationID, params)
+		return payload, err
+	})
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	if !*includeCancelled {
+		kept := letters[:0]
+		for _, letter := range letters {
+			attrs, _ := letter["attributes"].(map[string]any)
+			if stringValue(attrs["status"]) != "cancelled" {
+				kept = append(kept, letter)
+			}
+		}
+		letters = kept
+	}
+	groups := findDuplicates(letters, fields)
+
+	report := newRunReport(ctx, "letters duplicates")
+	defer func() {
+		for i, group := range groups {
+			for _, letter := range group.Letters {
+				report.add(reportItem{Input: fmt.Sprintf("group %d", i+1), LetterID: letter.ID, Status: letter.Status, Result: letter.Result, Cost: letter.Price, Currency: letter.Currency})
+			}
+		}
+		report.write(ctx, reportOptions, exitCode)
+	}()
+
+	duplicates := 0
+	extra := map[string]float64{}
+	for _, group := range groups {
+		duplicates += len(group.Letters) - 1
+		for currency, amount := range group.ExtraCost {
+			extra[currency] += amount
+		}
+		first := group.Letters[0]
+		annotatef("warn", "letter %s: %d probable duplicates of %s", first.ID, len(group.Letters)-1, first.FileOriginalName)
+	}
+	if ctx.global.jsonOutput {
+		emitJSON(map[string]any{"by": fields, "letters": len(letters), "groups": groups})
+	} else {
+		endGroup := ciGroup(ctx, fmt.Sprintf("letters duplicates: %d groups", len(groups)))
+		for i, group := range groups {
+			for _, letter := range group.Letters {
+				fmt.Printf("%d\t%s\t%s\t%s\t%s\t%s\n", i+1, letter.ID, letter.Result, letter.Status, formatTimestamp(ctx, letter.CreatedAt), letter.FileOriginalName)
+			}
+		}
+		endGroup()
+		if !ctx.global.quiet {
+			costs := []string{}
+			for currency, amount := range extra {
+				costs = append(costs, fmt.Sprintf("%.2f %s", amount, currency))
+			}
+			sort.Strings(costs)
+			summary := fmt.Sprintf("%d letters checked, %d groups, %d probable duplicates", len(letters), len(groups), duplicates)
+			if len(costs) > 0 {
+				summary += " costing " + strings.Join(costs, ", ")
+			}
+			logf("info", "%s", summary)
+		}
+	}
+	if len(groups) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// findDuplicates groups letters (listed oldest first) by the values of
+// fields and returns the groups of more than one letter in order of their
+// oldest letter. Text is compared ignoring case and runs of white space, so
+// that "Max  Muster" and "max muster" fall into one group.
+func findDuplicates(letters []map[string]any, fields []string) []duplicateGroup {
+	index := map[string]int{}
+	groups := []duplicateGroup{}
+	for _, letter := range letters {
+		attrs, _ := letter["attributes"].(map[string]any)
+		key := map[string]any{}
+		parts := make([]string, 0, len(fields))
+		for _, field := range fields {
+			value := lookupField(letter, field)
+			key[field] = value
+			parts = append(parts, duplicateFingerprint(value))
+		}
+		fingerprint := strings.Join(parts, "\x00")
+		i, ok := index[fingerprint]
+		if !ok {
+			i = len(groups)
+			index[fingerprint] = i
+			groups = append(groups, duplicateGroup{Key: key})
+		}
+		result := "duplicate"
+		if !ok {
+			result = "original"
+		}
+		groups[i].Letters = append(groups[i].Letters, duplicateEntry{
+			ID:               stringValue(letter["id"]),
+			Status:           stringValue(attrs["status"]),
+			FileOriginalName: stringValue(attrs["file_original_name"]),
+			CreatedAt:        stringValue(attrs["created_at"]),
+			Price:            stringValue(attrs["price_value"]),
+			Currency:         stringValue(attrs["price_currency"]),
+			Result:           result,
+		})
+	}
+	duplicates := []duplicateGroup{}
+	for _, group := range groups {
+		if len(group.Letters) < 2 {
+			continue
+		}
+		for _, letter := range group.Letters[1:] {
+			price, err := strconv.ParseFloat(letter.Price, 64)
+			if err != nil || letter.Currency == "" {
+				continue
+			}
+			if group.ExtraCost == nil {
+				group.ExtraCost = map[string]float64{}
+			}
+			group.ExtraCost[letter.Currency] += price
+		}
+		duplicates = append(duplicates, group)
+	}
+	return duplicates
+}
+
+// duplicateFingerprint returns the comparable form of a field value; objects
+// such as meta_data are compared by their JSON encoding, whose keys are
+// sorted.
+func duplicateFingerprint(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.ToLower(strings.Join(strings.Fields(v), " "))
+	case map[string]any, []any:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	default:
+		return stringValue(v)
+	}
+}
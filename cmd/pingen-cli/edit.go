@@ -0,0 +1,549 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// handleLettersEdit changes attributes of a letter that has not been
+// submitted. --json-patch takes a JSON merge patch (an object, RFC 7396) or
+// JSON Patch operations (an array, RFC 6902) for the attributes; --attr sets
+// single values on top. Only the top-level attributes that end up different
+// from the letter's current ones are sent.
+func handleLettersEdit(ctx appContext, args []string) int {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("letters edit", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	var attrs stringList
+	fs.Var(&attrs, "attr", "Set an attribute, key=value (repeatable; dotted keys such as meta_data.recipient.city reach into objects)")
+	jsonPatch := fs.String("json-patch", "", "JSON merge patch object or JSON Patch operations for the attributes, inline or @file")
+	schemaOnly := fs.Bool("schema-only", false, "Validate the request body against its schema and exit without network calls")
+	payloadFile := fs.String("payload", "", "With --schema-only, validate this request body (JSON file or -) instead of one built from the flags")
+	pick := fs.Bool("pick", false, "Choose the letter interactively from the newest letters")
+	help := fs.Bool("help", false, "show help")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil || applyParsedDefaults(ctx, fs) != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli letters edit <letter_id>|--pick [--attr key=value]... [--json-patch json|@file] [--schema-only [--payload file]]")
+		return 0
+	}
+	if *payloadFile != "" {
+		return validatePayloadFile(ctx, "letter-edit", *payloadFile, *schemaOnly)
+	}
+	if len(attrs) == 0 && *jsonPatch == "" {
+		printErrorCode("PINGEN-INPUT-001", "letters edit requires --attr or --json-patch")
+		return 2
+	}
+	var patch any
+	if *jsonPatch != "" {
+		content := []byte(*jsonPatch)
+		if strings.HasPrefix(*jsonPatch, "@") {
+			if content, err = os.ReadFile(strings.TrimPrefix(*jsonPatch, "@")); err != nil {
+				reportError(ctx, codedErrorf("PINGEN-INPUT-002", "invalid --json-patch: %w", err))
+				return 2
+			}
+		}
+		if err := decodeJSONNumbers(content, &patch); err != nil {
+			printErrorCode("PINGEN-INPUT-002", "invalid --json-patch: not valid JSON")
+			return 2
+		}
+		switch patch.(type) {
+		case map[string]any, []any:
+		default:
+			printErrorCode("PINGEN-INPUT-002", "invalid --json-patch: use an object of attributes or an array of operations")
+			return 2
+		}
+	}
+
+	// --schema-only has no letter to start from, so the edit is checked as if
+	// the letter had no attributes.
+	current := map[string]any{}
+	letterID := "pending"
+	var client pingen.Client
+	if !*schemaOnly {
+		switch {
+		case len(positional) > 0:
+			letterID, err = resolveLetterID(&ctx, positional[0])
+		case *pick:
+			letterID, err = pickResource(&ctx, "letters")
+		default:
+			printErrorCode("PINGEN-INPUT-001", "letter id required")
+			return 2
+		}
+		if err != nil {
+			reportError(ctx, err)
+			return 1
+		}
+		token, err := ensureAccessToken(&ctx)
+		if err != nil {
+			reportError(ctx, err)
+			return 1
+		}
+		client = newClient(ctx, token)
+		letter, _, err := client.GetLetterRaw(ctx.jobContext, ctx.settings.OrganisationID, letterID)
+		if err != nil {
+			reportError(ctx, err)
+			return 1
+		}
+		item, _ := letter["data"].(map[string]any)
+		if attributes, ok := item["attributes"].(map[string]any); ok {
+			current = attributes
+		}
+		if ability := resourceAbility(item, "edit"); ability != "" && ability != "ok" {
+			printErrorCode("PINGEN-API-003", fmt.Sprintf("letter cannot be edited: %s (status %s)", ability, stringValue(current["status"])))
+			return 1
+		}
+	}
+
+	edited, err := editAttributes(current, patch, attrs)
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	attributes := changedAttributes(current, edited)
+	payload := map[string]any{
+		"data": map[string]any{
+			"id":         letterID,
+			"type":       "letters",
+			"attributes": attributes,
+		},
+	}
+	if err := pingen.ValidatePayload("letter-edit", payload); err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	if *schemaOnly {
+		return reportSchemaValid("letter-edit")
+	}
+	if len(attributes) == 0 {
+		logf("info", "nothing to change: letter %s already has these attributes", letterID)
+		return 0
+	}
+	if ctx.global.dryRun {
+		return emitDryRun(ctx, map[string]any{
+			"action":          "letters.edit",
+			"organisation_id": ctx.settings.OrganisationID,
+			"letter_id":       letterID,
+			"attributes":      attributes,
+		}, func(client pingen.Client) error {
+			_, _, err := client.UpdateLetterRaw(ctx.jobContext, ctx.settings.OrganisationID, letterID, payload)
+			return err
+		})
+	}
+	resp, headers, err := client.UpdateLetterRaw(ctx.jobContext, ctx.settings.OrganisationID, letterID, payload)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	return emitPayload(ctx, resp, headers, func() { printLetterSummary(resp) })
+}
+
+// handleLettersRestore puts back the uploaded PDF of a letter that needs
+// action, so that Pingen validates it again after the problem was fixed.
+func handleLettersRestore(ctx appContext, args []string) int {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("letters restore", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	pick := fs.Bool("pick", false, "Choose the letter interactively from the newest letters")
+	help := fs.Bool("help", false, "show help")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil || applyParsedDefaults(ctx, fs) != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli letters restore <letter_id>|--pick")
+		return 0
+	}
+	var letterID string
+	switch {
+	case len(positional) > 0:
+		letterID, err = resolveLetterID(&ctx, positional[0])
+	case *pick:
+		letterID, err = pickResource(&ctx, "letters")
+	default:
+		printErrorCode("PINGEN-INPUT-001", "letter id required")
+		return 2
+	}
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+
+	if ctx.global.dryRun {
+		return emitDryRun(ctx, map[string]any{
+			"action":          "letters.restore",
+			"organisation_id": ctx.settings.OrganisationID,
+			"letter_id":       letterID,
+		}, func(client pingen.Client) error {
+			_, err := client.RestoreLetterFile(ctx.jobContext, ctx.settings.OrganisationID, letterID)
+			return err
+		})
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+	letter, _, err := client.GetLetterRaw(ctx.jobContext, ctx.settings.OrganisationID, letterID)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	item, _ := letter["data"].(map[string]any)
+	attrs, _ := item["attributes"].(map[string]any)
+	status := stringValue(attrs["status"])
+	if ability := resourceAbility(item, "restore"); ability != "" && ability != "ok" {
+		printErrorCode("PINGEN-API-003", fmt.Sprintf("letter cannot be restored: %s (status %s)", ability, status))
+		return 1
+	} else if ability == "" && status != "action_required" {
+		printErrorCode("PINGEN-API-003", fmt.Sprintf("letter cannot be restored: status %s (only letters in action_required)", status))
+		return 1
+	}
+	if _, err := client.RestoreLetterFile(ctx.jobContext, ctx.settings.OrganisationID, letterID); err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	// Validation runs again asynchronously; `letters wait` follows it.
+	payload, headers, err := client.GetLetterRaw(ctx.jobContext, ctx.settings.OrganisationID, letterID)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	return emitPayload(ctx, payload, headers, func() { printLetterSummary(payload) })
+}
+
+// editAttributes applies patch and the --attr assignments to a copy of
+// current.
+func editAttributes(current map[string]any, patch any, attrs []string) (map[string]any, error) {
+	var edited any
+	if err := cloneJSON(current, &edited); err != nil {
+		return nil, err
+	}
+	switch patch := patch.(type) {
+	case map[string]any:
+		edited = mergePatch(edited, patch)
+	case []any:
+		var err error
+		if edited, err = applyJSONPatch(edited, patch); err != nil {
+			return nil, codedErrorf("PINGEN-INPUT-002", "invalid --json-patch: %w", err)
+		}
+	}
+	result, ok := edited.(map[string]any)
+	if !ok {
+		return nil, codedErrorf("PINGEN-INPUT-002", "invalid --json-patch: the attributes must stay an object")
+	}
+	for _, assignment := range attrs {
+		key, value, ok := strings.Cut(assignment, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, codedErrorf("PINGEN-INPUT-002", "invalid --attr %q (use key=value)", assignment)
+		}
+		if err := setAttribute(result, strings.Split(key, "."), attrValue(value)); err != nil {
+			return nil, codedErrorf("PINGEN-INPUT-002", "invalid --attr %q: %w", assignment, err)
+		}
+	}
+	return result, nil
+}
+
+// attrValue reads an --attr value: JSON objects, arrays and null are parsed,
+// anything else stays a string so that zip codes keep leading zeros.
+func attrValue(raw string) any {
+	trimmed := strings.TrimSpace(raw)
+	if trimmed == "null" || strings.HasPrefix(trimmed, "[") || strings.HasPrefix(trimmed, "{") {
+		var value any
+		if decodeJSONNumbers([]byte(trimmed), &value) == nil {
+			return value
+		}
+	}
+	return raw
+}
+
+// setAttribute sets the value at path, creating objects on the way; a null
+// value removes the key.
+func setAttribute(target map[string]any, path []string, value any) error {
+	for i, key := range path[:len(path)-1] {
+		next, ok := target[key].(map[string]any)
+		if !ok {
+			if target[key] != nil {
+				return fmt.Errorf("%s is not an object", strings.Join(path[:i+1], "."))
+			}
+			next = map[string]any{}
+			target[key] = next
+		}
+		target = next
+	}
+	if value == nil {
+		delete(target, path[len(path)-1])
+		return nil
+	}
+	target[path[len(path)-1]] = value
+	return nil
+}
+
+// changedAttributes returns the top-level attributes of edited that differ
+// from current, with null for removed ones, as a PATCH replaces whole
+// attributes.
+func changedAttributes(current, edited map[string]any) map[string]any {
+	changed := map[string]any{}
+	for key, value := range edited {
+		if !sameJSON(current[key], value) {
+			changed[key] = value
+		}
+	}
+	for key := range current {
+		if _, ok := edited[key]; !ok {
+			changed[key] = nil
+		}
+	}
+	return changed
+}
+
+// mergePatch applies an RFC 7396 merge patch: objects merge recursively and
+// null removes a member.
+func mergePatch(target any, patch any) any {
+	members, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	object, ok := target.(map[string]any)
+	if !ok {
+		object = map[string]any{}
+	}
+	for key, value := range members {
+		if value == nil {
+			delete(object, key)
+			continue
+		}
+		object[key] = mergePatch(object[key], value)
+	}
+	return object
+}
+
+// applyJSONPatch applies RFC 6902 operations (add, remove, replace, move,
+// copy and test) to doc in order.
+func applyJSONPatch(doc any, operations []any) (any, error) {
+	for i, entry := range operations {
+		operation, _ := entry.(map[string]any)
+		op := stringValue(operation["op"])
+		path, err := parsePointer(stringValue(operation["path"]))
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i+1, err)
+		}
+		value, hasValue := operation["value"]
+		switch op {
+		case "add", "replace", "test":
+			if !hasValue {
+				return nil, fmt.Errorf("operation %d: %s needs a value", i+1, op)
+			}
+		case "move", "copy":
+			from, err := parsePointer(stringValue(operation["from"]))
+			if err != nil {
+				return nil, fmt.Errorf("operation %d: from: %w", i+1, err)
+			}
+			if value, err = pointerGet(doc, from); err != nil {
+				return nil, fmt.Errorf("operation %d: from: %w", i+1, err)
+			}
+			if op == "move" {
+				if doc, err = pointerRemove(doc, from); err != nil {
+					return nil, fmt.Errorf("operation %d: %w", i+1, err)
+				}
+			} else if err := cloneJSON(value, &value); err != nil {
+				return nil, err
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("operation %d: unknown op %q", i+1, op)
+		}
+		switch op {
+		case "add", "move", "copy":
+			doc, err = pointerAdd(doc, path, value, false)
+		case "replace":
+			doc, err = pointerAdd(doc, path, value, true)
+		case "remove":
+			doc, err = pointerRemove(doc, path)
+		case "test":
+			var actual any
+			if actual, err = pointerGet(doc, path); err == nil && !sameJSON(actual, value) {
+				err = fmt.Errorf("test failed at %s", stringValue(operation["path"]))
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i+1, err)
+		}
+	}
+	return doc, nil
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into its reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid path %q (use a JSON pointer such as /meta_data/recipient/city)", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func pointerGet(doc any, path []string) (any, error) {
+	for i, token := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("path /%s not found", strings.Join(path[:i+1], "/"))
+			}
+			doc = value
+		case []any:
+			index, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[index]
+		default:
+			return nil, fmt.Errorf("path /%s not found", strings.Join(path[:i+1], "/"))
+		}
+	}
+	return doc, nil
+}
+
+// pointerAdd adds value at path, or with replace sets an existing member,
+// and returns the updated document.
+func pointerAdd(doc any, path []string, value any, replace bool) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return pointerUpdate(doc, path, func(parent any, token string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			if _, ok := node[token]; replace && !ok {
+				return nil, fmt.Errorf("path /%s not found", strings.Join(path, "/"))
+			}
+			node[token] = value
+			return node, nil
+		case []any:
+			if token == "-" && !replace {
+				return append(node, value), nil
+			}
+			limit := len(node)
+			if replace {
+				limit--
+			}
+			index, err := arrayIndex(token, limit)
+			if err != nil {
+				return nil, err
+			}
+			if replace {
+				node[index] = value
+				return node, nil
+			}
+			node = append(node, nil)
+			copy(node[index+1:], node[index:])
+			node[index] = value
+			return node, nil
+		}
+		return nil, fmt.Errorf("path /%s not found", strings.Join(path, "/"))
+	})
+}
+
+func pointerRemove(doc any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("cannot remove the whole document")
+	}
+	return pointerUpdate(doc, path, func(parent any, token string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			if _, ok := node[token]; !ok {
+				return nil, fmt.Errorf("path /%s not found", strings.Join(path, "/"))
+			}
+			delete(node, token)
+			return node, nil
+		case []any:
+			index, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(node[:index], node[index+1:]...), nil
+		}
+		return nil, fmt.Errorf("path /%s not found", strings.Join(path, "/"))
+	})
+}
+
+// pointerUpdate replaces the container holding the last token of path with
+// the result of change, rebuilding the containers above it.
+func pointerUpdate(doc any, path []string, change func(parent any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return change(doc, path[0])
+	}
+	switch node := doc.(type) {
+	case map[string]any:
+		child, ok := node[path[0]]
+		if !ok {
+			return nil, fmt.Errorf("path /%s not found", path[0])
+		}
+		updated, err := pointerUpdate(child, path[1:], change)
+		if err != nil {
+			return nil, err
+		}
+		node[path[0]] = updated
+		return node, nil
+	case []any:
+		index, err := arrayIndex(path[0], len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := pointerUpdate(node[index], path[1:], change)
+		if err != nil {
+			return nil, err
+		}
+		node[index] = updated
+		return node, nil
+	}
+	return nil, fmt.Errorf("path /%s not found", path[0])
+}
+
+// arrayIndex parses an array index token that must not exceed limit.
+func arrayIndex(token string, limit int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > limit || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return index, nil
+}
+
+// sameJSON reports whether a and b encode to the same JSON; object keys are
+// sorted when encoding, so member order does not matter.
+func sameJSON(a, b any) bool {
+	left, errLeft := json.Marshal(a)
+	right, errRight := json.Marshal(b)
+	return errLeft == nil && errRight == nil && bytes.Equal(left, right)
+}
+
+// cloneJSON deep-copies value into target through its JSON encoding.
+func cloneJSON(value any, target any) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return decodeJSONNumbers(encoded, target)
+}
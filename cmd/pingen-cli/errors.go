@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// validationHint maps an attribute (matched against the end of a JSON:API
+// source pointer) to advice that names the CLI flag to change.
+type validationHint struct {
+	field string
+	hint  string
+}
+
+var validationHints = []validationHint{
+	{"address_position", "no address found at the chosen position: check --address-position (left/right) against the address window of the PDF"},
+	{"file_original_name", "set a shorter --file-name (max 255 characters)"},
+	{"file_url", "the upload URL expired or was rejected: re-run the command to upload again"},
+	{"file_url_signature", "the upload URL expired or was rejected: re-run the command to upload again"},
+	{"delivery_product", "--delivery-product is unknown or not offered for the destination country: run `pingen-cli products list --country XX` to see the available products"},
+	{"print_mode", "--print-mode must be simplex or duplex"},
+	{"print_spectrum", "--print-spectrum must be color or grayscale"},
+	{"paper_types", "the letter's paper types do not allow this operation"},
+	{"meta_data", "check the --meta-json/--meta-file content (recipient and sender objects)"},
+}
+
+// recipientHints covers meta_data address fields and their length limits.
+var recipientHints = map[string]string{
+	"name":    "name (max 45 characters)",
+	"street":  "street (max 40 characters)",
+	"pobox":   "pobox (max 45 characters)",
+	"number":  "number (max 10 characters)",
+	"zip":     "zip (max 8 characters)",
+	"city":    "city (max 25 characters)",
+	"country": "country (ISO country code)",
+}
+
+// hintsFor returns actionable hints for a failed API call.
+func hintsFor(apiErr pingen.APIError) []string {
+	hints := []string{}
+	seen := map[string]bool{}
+	add := func(hint string) {
+		if hint != "" && !seen[hint] {
+			seen[hint] = true
+			hints = append(hints, hint)
+		}
+	}
+	if apiErr.Status == 422 {
+		for _, detail := range apiErr.Errors {
+			add(hintForPointer(detail.Pointer))
+		}
+	}
+	if apiErr.Message == "token refresh failed" {
+		add("the saved refresh token expired or was revoked: run `pingen-cli auth login` again")
+	}
+	switch apiErr.Status {
+	case 401:
+		add("the access token is invalid or expired: run `pingen-cli auth token --save` or check --access-token")
+	case 403:
+		add("the token lacks permission for this organisation: check --org and the token scopes")
+	case 404:
+		add("the resource was not found: check --org and the id")
+	case 429:
+		add("rate limited: wait for the Retry-After period before retrying")
+	}
+	return hints
+}
+
+func hintForPointer(pointer string) string {
+	parts := strings.Split(strings.Trim(pointer, "/"), "/")
+	for i, part := range parts {
+		if part == "recipient" || part == "sender" {
+			if i+1 < len(parts) {
+				if field, ok := recipientHints[parts[i+1]]; ok {
+					return fmt.Sprintf("fix meta_data.%s.%s in --meta-json/--meta-file", part, field)
+				}
+			}
+		}
+	}
+	last := parts[len(parts)-1]
+	for _, candidate := range validationHints {
+		if last == candidate.field {
+			return candidate.hint
+		}
+	}
+	return ""
+}
+
+// reportError prints err to stderr. API errors include their hints; with
+// --json the error is written as a JSON object.
+func reportError(ctx appContext, err error) {
+	err = cancelledError(ctx, err)
+	code := codeForError(err)
+	var schemaErr pingen.SchemaError
+	if errors.As(err, &schemaErr) {
+		message := "payload does not match schema " + schemaErr.Schema
+		if jsonErrors || activeLogger.jsonFormat() {
+			emitErrorJSON(map[string]any{"error": message, "code": code, "violations": redactPayload(schemaErr.Violations)})
+			return
+		}
+		printCodedError(code, message, 0, "")
+		for _, violation := range schemaErr.Violations {
+			fmt.Fprintf(os.Stderr, "  %s: %s\n", violation.Pointer, violation.Message)
+		}
+		return
+	}
+	var addressErr pingen.AddressError
+	if errors.As(err, &addressErr) {
+		if jsonErrors || activeLogger.jsonFormat() {
+			emitErrorJSON(map[string]any{"error": "invalid address", "code": code, "problems": redactPayload(addressErr.Problems)})
+			return
+		}
+		printCodedError(code, "invalid address", 0, "")
+		for _, problem := range addressErr.Problems {
+			fmt.Fprintf(os.Stderr, "  %s: %s\n", problem.Field, problem.Message)
+		}
+		return
+	}
+	var apiErr pingen.APIError
+	if !errors.As(err, &apiErr) {
+		if jsonErrors || activeLogger.jsonFormat() {
+			payload := map[string]any{"error": err.Error()}
+			if code != "" {
+				payload["code"] = code
+			}
+			emitErrorJSON(payload)
+			return
+		}
+		printCodedError(code, err.Error(), 0, "")
+		return
+	}
+	hints := hintsFor(apiErr)
+	if jsonErrors || activeLogger.jsonFormat() {
+		payload := map[string]any{
+			"error":  apiErr.Message,
+			"status": apiErr.Status,
+			"code":   code,
+		}
+		if apiErr.RequestID != "" {
+			payload["request_id"] = apiErr.RequestID
+		}
+		if len(apiErr.Errors) > 0 {
+			details := make([]map[string]any, 0, len(apiErr.Errors))
+			for _, detail := range apiErr.Errors {
+				entry := map[string]any{"title": redactText(detail.Title), "detail": redactText(detail.Detail)}
+				if detail.Code != "" {
+					entry["code"] = detail.Code
+				}
+				if detail.Pointer != "" {
+					entry["pointer"] = detail.Pointer
+				}
+				details = append(details, entry)
+			}
+			payload["errors"] = details
+		}
+		if len(hints) > 0 {
+			payload["hints"] = hints
+		}
+		emitErrorJSON(payload)
+		return
+	}
+	printCodedError(code, apiErr.Message, apiErr.Status, apiErr.RequestID)
+	for _, detail := range apiErr.Errors {
+		fmt.Fprintf(os.Stderr, "  %s\n", redactText(detail.String()))
+	}
+	for _, hint := range hints {
+		fmt.Fprintf(os.Stderr, "hint: %s\n", hint)
+	}
+}
+
+// jsonErrors is set by run for --json and --output json: errors are then
+// written to stderr as JSON objects with error, code, and for API errors
+// status and request_id.
+var jsonErrors bool
+
+// emitErrorJSON writes an error for --json: a bare JSON object, or a log
+// event with the same fields under --log-format json.
+func emitErrorJSON(payload map[string]any) {
+	lastErrorCode, _ = payload["code"].(string)
+	if message, ok := payload["error"].(string); ok {
+		payload["error"] = redactText(message)
+		lastError = payload["error"].(string)
+	}
+	fields := map[string]any{}
+	for key, value := range payload {
+		if key != "error" {
+			fields[key] = value
+		}
+	}
+	if activeLogger.jsonFormat() {
+		activeLogger.log("error", fmt.Sprint(payload["error"]), fields)
+		return
+	}
+	activeLogger.logFile("error", fmt.Sprint(payload["error"]), fields)
+	defer activeLogger.annotateOnly("error", fmt.Sprint(payload["error"]))
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, payload["error"])
+		return
+	}
+	fmt.Fprintln(os.Stderr, string(encoded))
+}
+
+// reportSchemaValid implements --schema-only after a successful validation.
+func reportSchemaValid(schema string) int {
+	fmt.Printf("payload matches schema %s\n", schema)
+	return 0
+}
+
+// validatePayloadFile implements --schema-only --payload: it checks a saved
+// request body (a JSON file, or - for stdin) against schema without looking
+// at the other flags, the PDF or the API.
+func validatePayloadFile(ctx appContext, schema, path string, schemaOnly bool) int {
+	if err := checkPayloadFile(schema, path, schemaOnly); err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	return reportSchemaValid(schema)
+}
+
+// checkPayloadFile is validatePayloadFile for callers that report the error
+// themselves.
+func checkPayloadFile(schema, path string, schemaOnly bool) error {
+	if !schemaOnly {
+		return codedErrorf("PINGEN-INPUT-001", "--payload requires --schema-only")
+	}
+	var content []byte
+	var err error
+	if path == "-" {
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return codedErrorf("PINGEN-INPUT-001", "failed to read --payload: %w", err)
+	}
+	var payload any
+	if err := json.Unmarshal(content, &payload); err != nil {
+		return codedErrorf("PINGEN-INPUT-001", "invalid --payload: %w", err)
+	}
+	return pingen.ValidatePayload(schema, payload)
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+var (
+	deliveryProducts = []string{"fast", "cheap", "bulk", "premium", "registered"}
+	printModes       = []string{"simplex", "duplex"}
+	printSpectrums   = []string{"color", "grayscale"}
+	paperTypes       = []string{"normal", "qr", "sepa_at", "sepa_de"}
+)
+
+// deliveryDays is a typical delivery time in business days after handover.
+type deliveryDays struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+func (d deliveryDays) String() string {
+	if d.Max == 0 {
+		return "-"
+	}
+	if d.Min == d.Max {
+		if d.Min == 1 {
+			return "1 business day"
+		}
+		return fmt.Sprintf("%d business days", d.Min)
+	}
+	return fmt.Sprintf("%d-%d business days", d.Min, d.Max)
+}
+
+// typicalDelivery lists the usual delivery times per product within
+// Switzerland and Liechtenstein and abroad. The API has no endpoint for
+// them, so they are indicative only.
+var typicalDelivery = map[string][2]deliveryDays{
+	"fast":       {{1, 1}, {2, 5}},
+	"cheap":      {{2, 3}, {4, 10}},
+	"bulk":       {{3, 5}, {5, 10}},
+	"premium":    {{1, 1}, {2, 4}},
+	"registered": {{1, 1}, {3, 7}},
+}
+
+func expectedDelivery(product, country string) deliveryDays {
+	times := typicalDelivery[product]
+	if country == "CH" || country == "LI" {
+		return times[0]
+	}
+	return times[1]
+}
+
+// estimateRow is one priced combination of `letters estimate --compare`.
+type estimateRow struct {
+	DeliveryProduct string       `json:"delivery_product"`
+	PrintMode       string       `json:"print_mode"`
+	PrintSpectrum   string       `json:"print_spectrum"`
+	Price           float64      `json:"price,omitempty"`
+	Currency        string       `json:"currency,omitempty"`
+	Delivery        deliveryDays `json:"delivery_days"`
+	Error           string       `json:"error,omitempty"`
+}
+
+// handleLettersEstimate wraps the price calculator; it is also available as
+// `letters price`.
+func handleLettersEstimate(ctx appContext, args []string) int {
+	fs := flag.NewFlagSet("letters estimate", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	filePath := fs.String("file", "", "PDF to count the pages of")
+	pages := fs.Int("pages", 0, "Number of pages, instead of --file")
+	country := fs.String("country", "", "Destination country (ISO 3166-1 alpha-2)")
+	paperType := fs.String("paper-type", "normal", "Paper type for every page, or a comma-separated list with one entry per page")
+	deliveryProduct := fs.String("delivery-product", "", "Delivery product")
+	printMode := fs.String("print-mode", "", "Print mode")
+	printSpectrum := fs.String("print-spectrum", "", "Print spectrum")
+	compare := fs.Bool("compare", false, "Price every product/mode/spectrum combination")
+	sortBy := fs.String("sort", "price", "Order of --compare rows: price or delivery")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli letters estimate|price (--file path | --pages n) --country CC [--paper-type normal|qr|sepa_at|sepa_de[,...]] (--delivery-product ... --print-mode ... --print-spectrum ... | --compare [--sort price|delivery])")
+		return 0
+	}
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	if (*filePath == "") == (*pages <= 0) {
+		printErrorCode("PINGEN-INPUT-001", "use either --file or --pages")
+		return 2
+	}
+	if len(*country) != 2 {
+		printErrorCode("PINGEN-INPUT-001", "--country is required")
+		return 2
+	}
+	if !isAllowed(*sortBy, []string{"price", "delivery"}) {
+		printErrorCode("PINGEN-INPUT-001", "invalid --sort")
+		return 2
+	}
+	if !*compare {
+		if *deliveryProduct == "" || *printMode == "" || *printSpectrum == "" {
+			printErrorCode("PINGEN-INPUT-001", "delivery-product, print-mode, and print-spectrum are required")
+			return 2
+		}
+		if !isAllowed(*printMode, printModes) {
+			printErrorCode("PINGEN-INPUT-001", "invalid print-mode")
+			return 2
+		}
+		if !isAllowed(*printSpectrum, printSpectrums) {
+			printErrorCode("PINGEN-INPUT-001", "invalid print-spectrum")
+			return 2
+		}
+	}
+	if *filePath != "" {
+		if err := pingen.PreflightPDF(*filePath, maxUploadSize(ctx)); err != nil {
+			reportError(ctx, err)
+			return 2
+		}
+		count, err := pingen.CountPDFPages(*filePath)
+		if err != nil {
+			printErrorCode(codeForError(err), err.Error()+"; pass --pages instead")
+			return 2
+		}
+		*pages = count
+	}
+	papers, err := expandPaperTypes(*paperType, *pages)
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	countryCode := strings.ToUpper(*country)
+	if !*compare {
+		product, err := checkDeliveryProduct(&ctx, *deliveryProduct, countryCode)
+		if err != nil {
+			reportError(ctx, err)
+			return 2
+		}
+		*deliveryProduct = product
+	}
+
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+
+	if !*compare {
+		payload, headers, err := client.CalculatePriceRaw(ctx.jobContext, ctx.settings.OrganisationID, priceRequest(countryCode, papers, *deliveryProduct, *printMode, *printSpectrum))
+		if err != nil {
+			reportError(ctx, err)
+			return 1
+		}
+		return emitPayload(ctx, payload, headers, func() {
+			data, _ := payload["data"].(map[string]any)
+			attrs, _ := data["attributes"].(map[string]any)
+			price, _ := strconv.ParseFloat(stringValue(attrs["price"]), 64)
+			fmt.Printf("%s %.2f\t%s\n", stringValue(attrs["currency"]), price, expectedDelivery(*deliveryProduct, countryCode))
+		})
+	}
+
+	rows := []estimateRow{}
+	priced := 0
+	var lastErr error
+	for _, product := range deliveryProducts {
+		for _, mode := range printModes {
+			for _, spectrum := range printSpectrums {
+				row := estimateRow{DeliveryProduct: product, PrintMode: mode, PrintSpectrum: spectrum, Delivery: expectedDelivery(product, countryCode)}
+				payload, _, err := client.CalculatePriceRaw(ctx.jobContext, ctx.settings.OrganisationID, priceRequest(countryCode, papers, product, mode, spectrum))
+				if err != nil {
+					// Some combinations are not offered for every country.
+					row.Error = err.Error()
+					lastErr = err
+				} else {
+					data, _ := payload["data"].(map[string]any)
+					attrs, _ := data["attributes"].(map[string]any)
+					row.Currency = stringValue(attrs["currency"])
+					row.Price, err = strconv.ParseFloat(stringValue(attrs["price"]), 64)
+					if err != nil {
+						lastErr = fmt.Errorf("price missing from response")
+						row.Error = lastErr.Error()
+					} else {
+						priced++
+					}
+				}
+				rows = append(rows, row)
+			}
+		}
+	}
+	sortEstimates(rows, *sortBy)
+
+	if ctx.global.jsonOutput {
+		emitJSON(map[string]any{"country": countryCode, "pages": *pages, "estimates": rows})
+	} else {
+		for _, row := range rows {
+			price := "unavailable"
+			if row.Error == "" {
+				price = fmt.Sprintf("%s %.2f", row.Currency, row.Price)
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\t%s\n", row.DeliveryProduct, row.PrintMode, row.PrintSpectrum, price, row.Delivery)
+		}
+	}
+	if priced == 0 {
+		reportError(ctx, lastErr)
+		return 1
+	}
+	return 0
+}
+
+// expandPaperTypes turns --paper-type into one paper type per page. A single
+// value applies to every page.
+func expandPaperTypes(value string, pages int) ([]string, error) {
+	types := strings.Split(value, ",")
+	for i, paper := range types {
+		types[i] = strings.TrimSpace(paper)
+		if !isAllowed(types[i], paperTypes) {
+			return nil, codedErrorf("PINGEN-INPUT-001", "invalid --paper-type %q (use %s)", types[i], strings.Join(paperTypes, ", "))
+		}
+	}
+	if len(types) == 1 {
+		for len(types) < pages {
+			types = append(types, types[0])
+		}
+		return types, nil
+	}
+	if len(types) != pages {
+		return nil, codedErrorf("PINGEN-INPUT-001", "invalid --paper-type: %d entries for %d pages", len(types), pages)
+	}
+	return types, nil
+}
+
+func priceRequest(country string, papers []string, product, mode, spectrum string) map[string]any {
+	return map[string]any{
+		"data": map[string]any{
+			"type": "letter_price_calculator",
+			"attributes": map[string]any{
+				"country":          country,
+				"paper_types":      papers,
+				"delivery_product": product,
+				"print_mode":       mode,
+				"print_spectrum":   spectrum,
+			},
+		},
+	}
+}
+
+// sortEstimates orders priced rows by price or delivery time, using the other
+// as tie-breaker, and moves unavailable combinations to the end.
+func sortEstimates(rows []estimateRow, by string) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if (a.Error == "") != (b.Error == "") {
+			return a.Error == ""
+		}
+		if by == "delivery" {
+			if a.Delivery.Max != b.Delivery.Max {
+				return a.Delivery.Max < b.Delivery.Max
+			}
+			return a.Price < b.Price
+		}
+		if a.Price != b.Price {
+			return a.Price < b.Price
+		}
+		return a.Delivery.Max < b.Delivery.Max
+	})
+}
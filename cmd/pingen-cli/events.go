@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// letterEventCategories are the organisation-wide letter event feeds.
+var letterEventCategories = []string{"issues", "undeliverable", "sent", "delivered"}
+
+func handleEvents(ctx appContext, args []string) int {
+	if len(args) == 0 {
+		fmt.Println("events requires a subcommand")
+		return 2
+	}
+	switch args[0] {
+	case "stream":
+		return handleEventsStream(ctx, args[1:])
+	default:
+		fmt.Println("unknown events subcommand")
+		return 2
+	}
+}
+
+// eventStream polls event feeds and remembers what it already emitted.
+type eventStream struct {
+	ctx    appContext
+	client pingen.Client
+	format string
+	// cursor is the created_at of the newest event seen per feed; seen holds
+	// the ids emitted at or after it so that the >= filter adds no repeats.
+	cursor map[string]time.Time
+	seen   map[string]map[string]time.Time
+}
+
+func handleEventsStream(ctx appContext, args []string) int {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("events stream", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	resource := fs.String("resource", "letters", "Resource to follow: letters or batches")
+	categories := fs.String("category", strings.Join(letterEventCategories, ","), "Letter event feeds to follow (comma-separated)")
+	since := fs.String("since", "", "Start with events created at or after this time (default: now)")
+	interval := fs.Duration("interval", 30*time.Second, "Polling interval")
+	format := fs.String("format", "ndjson", "Output format: ndjson or cloudevents")
+	once := fs.Bool("once", false, "Poll once and exit")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli events stream [--resource letters|batches] [--category issues,undeliverable,sent,delivered] [--since time] [--interval 30s] [--format ndjson|cloudevents] [--once]")
+		return 0
+	}
+	if !isAllowed(*resource, []string{"letters", "batches"}) {
+		printErrorCode("PINGEN-INPUT-001", "invalid --resource (use letters or batches)")
+		return 2
+	}
+	if !isAllowed(*format, []string{"ndjson", "cloudevents"}) {
+		printErrorCode("PINGEN-INPUT-001", "invalid --format (use ndjson or cloudevents)")
+		return 2
+	}
+	if *interval < time.Second {
+		printErrorCode("PINGEN-INPUT-001", "--interval must be at least 1s")
+		return 2
+	}
+	start := time.Now()
+	if *since != "" {
+		parsed, err := parseTimeInput(*since, inputLocation(ctx), start)
+		if err != nil {
+			reportError(ctx, err)
+			return 2
+		}
+		start = parsed
+	}
+	feeds := []string{"batches"}
+	if *resource == "letters" {
+		feeds = nil
+		for _, category := range strings.Split(*categories, ",") {
+			category = strings.TrimSpace(category)
+			if !isAllowed(category, letterEventCategories) {
+				printErrorCode("PINGEN-INPUT-001", fmt.Sprintf("invalid --category %q (use %s)", category, strings.Join(letterEventCategories, ", ")))
+				return 2
+			}
+			feeds = append(feeds, category)
+		}
+	}
+
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	var stopSignals func()
+	ctx.jobContext, stopSignals = handleSignals(ctx.jobContext)
+	defer stopSignals()
+
+	stream := &eventStream{
+		ctx:    ctx,
+		client: newClient(ctx, token),
+		format: *format,
+		cursor: map[string]time.Time{},
+		seen:   map[string]map[string]time.Time{},
+	}
+	for _, feed := range feeds {
+		stream.cursor[feed] = start
+		stream.seen[feed] = map[string]time.Time{}
+	}
+	for {
+		for _, feed := range feeds {
+			err := stream.poll(feed)
+			if ctx.jobContext.Err() != nil {
+				// Ctrl-C or --deadline ends a stream normally.
+				return 0
+			}
+			if err != nil {
+				var apiErr pingen.APIError
+				if errors.As(err, &apiErr) && apiErr.Status >= 400 && apiErr.Status < 500 && apiErr.Status != 429 {
+					reportError(ctx, err)
+					return 1
+				}
+				// Network errors and 5xx/429 are retried on the next poll.
+				logf("warn", "polling %s events failed, retrying: %s", feed, err.Error())
+			}
+		}
+		if *once {
+			return 0
+		}
+		if !sleepContext(ctx.jobContext, *interval) {
+			return 0
+		}
+	}
+}
+
+// poll fetches every event of feed created since the cursor and emits the
+// new ones, oldest first.
+func (s *eventStream) poll(feed string) error {
+	var items []map[string]any
+	var err error
+	if feed == "batches" {
+		items, err = s.batchEvents()
+	} else {
+		items, err = s.pages("created_at>="+s.cursor[feed].Format(apiTimeLayout), func(params map[string]string) (map[string]any, error) {
+			payload, _, err := s.client.ListLetterEventsRaw(s.ctx.jobContext, s.ctx.settings.OrganisationID, feed, params)
+			return payload, err
+		})
+	}
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return eventTime(items[i]).Before(eventTime(items[j]))
+	})
+	for _, item := range items {
+		s.emit(feed, item)
+	}
+	return nil
+}
+
+// batchEvents collects the events of batches updated since the cursor; the
+// API has no organisation-wide batch event feed.
+func (s *eventStream) batchEvents() ([]map[string]any, error) {
+	since := s.cursor["batches"].Format(apiTimeLayout)
+	batches, err := s.pages("updated_at>="+since, func(params map[string]string) (map[string]any, error) {
+		payload, _, err := s.client.ListBatchesRaw(s.ctx.jobContext, s.ctx.settings.OrganisationID, params)
+		return payload, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	events := []map[string]any{}
+	for _, batch := range batches {
+		batchID := stringValue(batch["id"])
+		items, err := s.pages("created_at>="+since, func(params map[string]string) (map[string]any, error) {
+			payload, _, err := s.client.ListBatchEventsRaw(s.ctx.jobContext, s.ctx.settings.OrganisationID, batchID, params)
+			return payload, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, items...)
+	}
+	return events, nil
+}
+
+// pages returns the items of every page of a listing filtered by clause.
+func (s *eventStream) pages(clause string, list func(map[string]string) (map[string]any, error)) ([]map[string]any, error) {
+	filterExpr, err := compileFilter("", []string{clause})
+	if err != nil {
+		return nil, err
+	}
+	return fetchAllPages(s.ctx.jobContext, 1, func(page int) (map[string]any, error) {
+		return list(buildListParams(page, 100, "created_at", filterExpr, "", "", "", ""))
+	})
+}
+
+func eventTime(item map[string]any) time.Time {
+	attrs, _ := item["attributes"].(map[string]any)
+	created, _ := time.Parse(apiTimeLayout, stringValue(attrs["created_at"]))
+	return created
+}
+
+func (s *eventStream) emit(feed string, item map[string]any) {
+	id := stringValue(item["id"])
+	created := eventTime(item)
+	if created.IsZero() {
+		created = s.cursor[feed]
+	}
+	if _, done := s.seen[feed][id]; done || created.Before(s.cursor[feed]) {
+		return
+	}
+	if created.After(s.cursor[feed]) {
+		s.cursor[feed] = created
+		for seenID, at := range s.seen[feed] {
+			if at.Before(created) {
+				delete(s.seen[feed], seenID)
+			}
+		}
+	}
+	s.seen[feed][id] = created
+
+	var record any
+	if s.format == "cloudevents" {
+		record = cloudEvent(s.ctx.settings.OrganisationID, feed, item)
+	} else {
+		item["category"] = feed
+		record = item
+	}
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	fmt.Println(string(encoded))
+}
+
+// cloudEvent wraps an event in a CloudEvents 1.0 structured-mode envelope.
+func cloudEvent(orgID, feed string, item map[string]any) map[string]any {
+	attrs, _ := item["attributes"].(map[string]any)
+	relationships, _ := item["relationships"].(map[string]any)
+	resource, eventType := "letters", "com.pingen.letter."+feed
+	if feed == "batches" {
+		resource, eventType = "batches", "com.pingen.batch."+strings.ToLower(stringValue(attrs["code"]))
+	}
+	subject := ""
+	for _, key := range []string{"letter", "batch"} {
+		related, _ := relationships[key].(map[string]any)
+		data, _ := related["data"].(map[string]any)
+		if id := stringValue(data["id"]); id != "" {
+			subject = id
+		}
+	}
+	event := map[string]any{
+		"specversion":     "1.0",
+		"id":              stringValue(item["id"]),
+		"source":          "/organisations/" + orgID + "/" + resource,
+		"type":            eventType,
+		"datacontenttype": "application/json",
+		"data":            attrs,
+	}
+	if subject != "" {
+		event["subject"] = subject
+	}
+	if emitted, err := time.Parse(apiTimeLayout, stringValue(attrs["emitted_at"])); err == nil {
+		event["time"] = emitted.Format(time.RFC3339)
+	}
+	return event
+}
+
+// sleepContext waits for d or until ctx is done and reports whether the full
+// duration elapsed.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// handleLettersEvents prints the delivery history of one letter, oldest event
+// first: when it happened, the event code, its description and where it was
+// recorded.
+func handleLettersEvents(ctx appContext, args []string) int {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("letters events", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	pick := fs.Bool("pick", false, "Choose the letter interactively from the newest letters")
+	help := fs.Bool("help", false, "show help")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil || applyParsedDefaults(ctx, fs) != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli letters events <letter_id>|--pick")
+		return 0
+	}
+	var letterID string
+	switch {
+	case len(positional) > 0:
+		letterID, err = resolveLetterID(&ctx, positional[0])
+	case *pick:
+		letterID, err = pickResource(&ctx, "letters")
+	default:
+		printErrorCode("PINGEN-INPUT-001", "letter id required")
+		return 2
+	}
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+	events, err := fetchAllPages(ctx.jobContext, 1, func(page int) (map[string]any, error) {
+		params := map[string]string{"page[number]": fmt.Sprintf("%d", page), "page[limit]": "100"}
+		payload, _, err := client.ListLetterEventsOfRaw(ctx.jobContext, ctx.settings.OrganisationID, letterID, params)
+		return payload, err
+	})
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		a, _ := events[i]["attributes"].(map[string]any)
+		b, _ := events[j]["attributes"].(map[string]any)
+		ta, errA := time.Parse(apiTimeLayout, stringValue(a["emitted_at"]))
+		tb, errB := time.Parse(apiTimeLayout, stringValue(b["emitted_at"]))
+		return errA == nil && errB == nil && ta.Before(tb)
+	})
+	payload := map[string]any{"data": events}
+	return emitPayload(ctx, payload, nil, func() {
+		for _, event := range events {
+			attrs, _ := event["attributes"].(map[string]any)
+			location := stringValue(attrs["location"])
+			if location == "" {
+				location = "-"
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\n", formatTimestamp(ctx, attrs["emitted_at"]), stringValue(attrs["code"]), stringValue(attrs["name"]), location)
+		}
+	})
+}
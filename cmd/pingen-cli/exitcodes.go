@@ -0,0 +1,41 @@
+package main
+
+import "strings"
+
+// Exit codes that tell scripts why a command failed. 0 is success and 1 a
+// failure without a more specific code; exitDeadline and exitInterrupted are
+// defined with --deadline and the signal handling.
+const (
+	// exitUsage covers input rejected by the CLI (bad flags or arguments) or
+	// by the API (422).
+	exitUsage       = 2
+	exitAuth        = 3
+	exitNotFound    = 4
+	exitRateLimited = 5
+	exitServer      = 6
+	exitNetwork     = 7
+)
+
+// lastErrorCode is the catalog code of the most recent error printed. When a
+// command returns the generic 1, run replaces it with the exit code of that
+// error.
+var lastErrorCode string
+
+// exitCodeFor maps a catalog code to its exit code, or 1.
+func exitCodeFor(code string) int {
+	switch {
+	case strings.HasPrefix(code, "PINGEN-AUTH-"):
+		return exitAuth
+	case strings.HasPrefix(code, "PINGEN-INPUT-"), code == "PINGEN-API-422":
+		return exitUsage
+	case code == "PINGEN-API-404":
+		return exitNotFound
+	case code == "PINGEN-API-429":
+		return exitRateLimited
+	case code == "PINGEN-API-500":
+		return exitServer
+	case code == "PINGEN-NET-001":
+		return exitNetwork
+	}
+	return 1
+}
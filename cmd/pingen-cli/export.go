@@ -0,0 +1,314 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+func handleExport(ctx appContext, args []string) int {
+	if len(args) == 0 {
+		fmt.Println("export requires a subcommand (archive/dump)")
+		return 2
+	}
+	switch args[0] {
+	case "archive":
+		return handleExportArchive(ctx, args[1:])
+	case "dump":
+		return handleExportDump(ctx, args[1:])
+	default:
+		fmt.Println("unknown export subcommand")
+		return 2
+	}
+}
+
+// handleExportArchive writes one directory per letter holding the PDF, the
+// letter JSON and its event history, plus a manifest.json at the top:
+//
+//	archive/manifest.json
+//	archive/<letter id>/<letter id>.pdf
+//	archive/<letter id>/letter.json
+//	archive/<letter id>/events.json
+func handleExportArchive(ctx appContext, args []string) (exitCode int) {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	flags := flag.NewFlagSet("export archive", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	since := flags.String("since", "", "Only letters created at or after this time")
+	until := flags.String("until", "", "Only letters created before this time")
+	outDir := flags.String("out", "", "Archive directory")
+	tarPath := flags.String("tar", "", "Also pack the archive into this tar file (.tar.gz/.tgz is compressed)")
+	concurrency := flags.Int("concurrency", 4, "Parallel letters and page fetches")
+	reportOptions := addReportFlags(flags)
+	help := flags.Bool("help", false, "show help")
+	if err := parseFlags(ctx, flags, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli export archive --out dir [--since time] [--until time] [--tar file] [--concurrency N] [--report-dir dir [--csv-delimiter c] [--decimal-comma]]")
+		return 0
+	}
+	if *outDir == "" {
+		printErrorCode("PINGEN-INPUT-001", "--out is required")
+		return 2
+	}
+	if *concurrency < 1 {
+		printErrorCode("PINGEN-INPUT-001", "--concurrency must be at least 1")
+		return 2
+	}
+	where, err := timeRangeClauses("created_at", *since, *until, inputLocation(ctx))
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	filterExpr, err := compileFilter("", where)
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+	entries, err := downloadEntriesForFilter(ctx, client, filterExpr, true, *concurrency)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+
+	if ctx.global.dryRun {
+		ids := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			ids = append(ids, entry.ID)
+		}
+		return emitJSON(map[string]any{
+			"action":          "export.archive",
+			"organisation_id": ctx.settings.OrganisationID,
+			"out":             *outDir,
+			"tar":             *tarPath,
+			"letters":         ids,
+		})
+	}
+	if err := os.MkdirAll(*outDir, 0o700); err != nil {
+		printErrorCode("PINGEN-DOWNLOAD-001", fmt.Sprintf("failed to create output directory: %v", err))
+		return 1
+	}
+	report := newRunReport(ctx, "export archive")
+	defer func() {
+		for _, entry := range entries {
+			report.add(reportItem{
+				Input:    entry.input,
+				LetterID: entry.ID,
+				Status:   entry.Status,
+				Result:   entry.Result,
+				Cost:     entry.price,
+				Currency: entry.currency,
+				Error:    entry.Error,
+			})
+		}
+		report.write(ctx, reportOptions, exitCode)
+	}()
+	var stopSignals func()
+	ctx.jobContext, stopSignals = handleSignals(ctx.jobContext)
+	defer stopSignals()
+
+	archiveAll(ctx, client, entries, *outDir, *concurrency)
+
+	manifest := downloadManifest{
+		GeneratedAt:    time.Now().Format(apiTimeLayout),
+		OrganisationID: ctx.settings.OrganisationID,
+		Filter:         filterExpr,
+		Letters:        entries,
+	}
+	if err := writeManifest(filepath.Join(*outDir, manifestName), manifest); err != nil {
+		printErrorCode("PINGEN-DOWNLOAD-001", fmt.Sprintf("failed to write manifest: %v", err))
+		return 1
+	}
+	failed, pending := 0, 0
+	for _, entry := range entries {
+		switch entry.Result {
+		case "failed":
+			failed++
+			annotatef("error", "letter %s: archive failed: %s", entry.ID, entry.Error)
+		case "pending":
+			pending++
+		}
+	}
+	if *tarPath != "" && pending == 0 {
+		if err := writeTarArchive(*tarPath, *outDir); err != nil {
+			printErrorCode("PINGEN-DOWNLOAD-001", fmt.Sprintf("failed to write archive: %v", err))
+			return 1
+		}
+	}
+
+	if ctx.global.jsonOutput {
+		emitJSON(manifest)
+	} else {
+		endGroup := ciGroup(ctx, fmt.Sprintf("export archive: %d letters", len(entries)))
+		for _, entry := range entries {
+			detail := filepath.Dir(entry.Path)
+			if entry.Error != "" {
+				detail = entry.Error
+			}
+			fmt.Printf("%s\t%s\t%s\n", entry.ID, entry.Result, detail)
+		}
+		endGroup()
+		if !ctx.global.quiet {
+			logf("info", "%d letters, %d failed; manifest: %s", len(entries), failed, filepath.Join(*outDir, manifestName))
+		}
+	}
+	if pending > 0 {
+		logf("info", "stopped early: %d of %d letters done, %d pending; re-run the same command to resume", len(entries)-pending, len(entries), pending)
+	}
+	if interrupted(ctx) {
+		return exitInterrupted
+	}
+	if failed > 0 || pending > 0 {
+		return 1
+	}
+	return 0
+}
+
+// archiveAll archives entries with a fixed pool of workers; see downloadAll.
+func archiveAll(ctx appContext, client pingen.Client, entries []downloadEntry, outDir string, workers int) {
+	pingen.RunPool(ctx.jobContext, workers, len(entries), func(_ context.Context, i int) error {
+		archiveOne(ctx, client, &entries[i], outDir)
+		return nil
+	})
+	for i := range entries {
+		if entries[i].Result == "" {
+			entries[i].Result = "pending"
+		}
+	}
+}
+
+// archiveOne refreshes the letter and event JSON and downloads the PDF
+// unless it is already present.
+func archiveOne(ctx appContext, client pingen.Client, entry *downloadEntry, outDir string) {
+	dir := filepath.Join(outDir, entry.ID)
+	fail := func(err error) {
+		entry.Result = "failed"
+		if ctx.jobContext.Err() != nil {
+			entry.Result = "pending"
+		}
+		entry.Error = err.Error()
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		fail(err)
+		return
+	}
+	letter, _, err := client.GetLetterRaw(ctx.jobContext, ctx.settings.OrganisationID, entry.ID)
+	if err == nil {
+		err = writeJSONFile(filepath.Join(dir, "letter.json"), letter)
+	}
+	if err != nil {
+		fail(err)
+		return
+	}
+	events, err := fetchAllPages(ctx.jobContext, 1, func(page int) (map[string]any, error) {
+		params := map[string]string{"page[number]": fmt.Sprintf("%d", page), "page[limit]": "100"}
+		payload, _, err := client.ListLetterEventsOfRaw(ctx.jobContext, ctx.settings.OrganisationID, entry.ID, params)
+		return payload, err
+	})
+	if err == nil {
+		err = writeJSONFile(filepath.Join(dir, "events.json"), map[string]any{"data": events})
+	}
+	if err != nil {
+		fail(err)
+		return
+	}
+	downloadOne(ctx, client, entry, dir)
+	if entry.Result == "downloaded" || entry.Result == "skipped" {
+		entry.Result = "archived"
+	}
+}
+
+func writeJSONFile(path string, value any) error {
+	encoded, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(encoded, '\n'), 0o600)
+}
+
+// writeTarArchive packs the tree under root into tarPath, gzip-compressed
+// for .tar.gz and .tgz names. Entries are relative to root's parent so the
+// archive unpacks into a single directory.
+func writeTarArchive(tarPath, root string) error {
+	tmpPath := tarPath + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	var sink io.Writer = file
+	var compressor *gzip.Writer
+	if strings.HasSuffix(tarPath, ".gz") || strings.HasSuffix(tarPath, ".tgz") {
+		compressor = gzip.NewWriter(file)
+		sink = compressor
+	}
+	archive := tar.NewWriter(sink)
+	base := filepath.Dir(filepath.Clean(root))
+	err = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || strings.HasSuffix(path, ".part") {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(base, path)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		source, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer source.Close()
+		_, err = io.Copy(archive, source)
+		return err
+	})
+	if closeErr := archive.Close(); err == nil {
+		err = closeErr
+	}
+	if compressor != nil {
+		if closeErr := compressor.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, tarPath)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// whereOperators maps CLI comparison operators to the prefixes used by the
+// Pingen filter syntax. Longer operators come first so ">=" wins over ">".
+var whereOperators = []struct {
+	op     string
+	prefix string
+}{
+	{"!=", "!"},
+	{">=", ">="},
+	{"<=", "<="},
+	{"~=", "~"},
+	{"=", ""},
+	{">", ">"},
+	{"<", "<"},
+	{"~", "~"},
+}
+
+// parseWhere compiles a single --where clause into a filter expression.
+func parseWhere(clause string) (map[string]any, error) {
+	clause = strings.TrimSpace(clause)
+	if fields := strings.Fields(clause); len(fields) >= 3 && strings.EqualFold(fields[1], "in") {
+		key := fields[0]
+		list := strings.TrimSpace(clause[strings.Index(strings.ToLower(clause), " in ")+4:])
+		options := []any{}
+		for _, value := range strings.Split(list, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				options = append(options, map[string]any{key: value})
+			}
+		}
+		if len(options) == 0 {
+			return nil, codedErrorf("PINGEN-INPUT-002", "invalid where clause %q: empty list", clause)
+		}
+		if len(options) == 1 {
+			return options[0].(map[string]any), nil
+		}
+		return map[string]any{"or": options}, nil
+	}
+	for _, candidate := range whereOperators {
+		index := strings.Index(clause, candidate.op)
+		if index <= 0 {
+			continue
+		}
+		key := strings.TrimSpace(clause[:index])
+		value := strings.TrimSpace(clause[index+len(candidate.op):])
+		if key == "" || strings.ContainsAny(key, "!<>=~ ") {
+			continue
+		}
+		return map[string]any{key: candidate.prefix + value}, nil
+	}
+	return nil, codedErrorf("PINGEN-INPUT-002", "invalid where clause %q (use key=value, key!=value, key>=value, key~value or 'key in a,b')", clause)
+}
+
+// compileFilter combines a raw --filter expression (JSON or @path) with
+// --where clauses into a single Pingen filter JSON string.
+func compileFilter(raw string, where []string) (string, error) {
+	expressions := []any{}
+	if raw != "" {
+		if strings.HasPrefix(raw, "@") {
+			content, err := os.ReadFile(strings.TrimPrefix(raw, "@"))
+			if err != nil {
+				return "", codedErrorf("PINGEN-INPUT-002", "failed to read --filter: %w", err)
+			}
+			raw = strings.TrimSpace(string(content))
+		}
+		if len(where) == 0 {
+			return raw, nil
+		}
+		var parsed any
+		if err := decodeJSONNumbers([]byte(raw), &parsed); err != nil {
+			return "", codedErrorf("PINGEN-INPUT-002", "invalid --filter JSON")
+		}
+		expressions = append(expressions, parsed)
+	}
+	for _, clause := range where {
+		expression, err := parseWhere(clause)
+		if err != nil {
+			return "", err
+		}
+		expressions = append(expressions, expression)
+	}
+	if len(expressions) == 0 {
+		return "", nil
+	}
+	var combined any = expressions[0]
+	if len(expressions) > 1 {
+		combined = map[string]any{"and": expressions}
+	}
+	// Avoid HTML escaping so comparators like ">=" stay readable in --where-debug.
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(combined); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+var metaKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*$`)
+
+// letterFilterClauses compiles the letters list filter flags into --where
+// clauses: comma-separated statuses and country codes, and key=value meta
+// data matches where the key may be a dotted path such as recipient.name.
+func letterFilterClauses(statuses, countries string, meta []string) ([]string, error) {
+	clauses := []string{}
+	if list := splitStatuses(statuses); len(list) > 0 {
+		clauses = append(clauses, "status in "+strings.Join(list, ","))
+	}
+	if list := splitColumns(countries); len(list) > 0 {
+		for i, country := range list {
+			list[i] = strings.ToUpper(country)
+			if !countryCodePattern.MatchString(list[i]) {
+				return nil, codedErrorf("PINGEN-INPUT-002", "invalid --country %q (use two-letter codes such as CH,DE)", country)
+			}
+		}
+		clauses = append(clauses, "country in "+strings.Join(list, ","))
+	}
+	for _, value := range meta {
+		key, metaValue, ok := strings.Cut(value, "=")
+		key = strings.TrimPrefix(strings.TrimSpace(key), "meta_data.")
+		if !ok || !metaKeyPattern.MatchString(key) {
+			return nil, codedErrorf("PINGEN-INPUT-002", "invalid --meta %q (use key=value, e.g. recipient.name=Acme)", value)
+		}
+		clauses = append(clauses, "meta_data."+key+"="+strings.TrimSpace(metaValue))
+	}
+	return clauses, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompileFilter(t *testing.T) {
+	dir := t.TempDir()
+	filterFile := filepath.Join(dir, "filter.json")
+	if err := os.WriteFile(filterFile, []byte(`{"status":"sent"}`+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		raw      string
+		where    []string
+		want     string
+		wantCode string
+	}{
+		{name: "nothing", want: ""},
+		{name: "raw is passed through", raw: `{"country": "CH"}`, want: `{"country": "CH"}`},
+		{name: "raw from file", raw: "@" + filterFile, want: `{"status":"sent"}`},
+		{name: "missing file", raw: "@" + filepath.Join(dir, "missing.json"), wantCode: "PINGEN-INPUT-002"},
+		{name: "equals", where: []string{"country=CH"}, want: `{"country":"CH"}`},
+		{name: "not equals", where: []string{"status != sent"}, want: `{"status":"!sent"}`},
+		{name: "at least", where: []string{"created_at>=2024-01-01"}, want: `{"created_at":">=2024-01-01"}`},
+		{name: "at most", where: []string{"price<=10"}, want: `{"price":"<=10"}`},
+		{name: "greater", where: []string{"price>10"}, want: `{"price":">10"}`},
+		{name: "less", where: []string{"price<10"}, want: `{"price":"<10"}`},
+		{name: "contains", where: []string{"recipient~Muster"}, want: `{"recipient":"~Muster"}`},
+		{name: "contains with tilde equals", where: []string{"recipient~=Muster"}, want: `{"recipient":"~Muster"}`},
+		{name: "value with equals sign", where: []string{"file_original_name=a=b.pdf"}, want: `{"file_original_name":"a=b.pdf"}`},
+		{name: "in list", where: []string{"status in sent, valid"}, want: `{"or":[{"status":"sent"},{"status":"valid"}]}`},
+		{name: "in list with one value", where: []string{"status IN sent"}, want: `{"status":"sent"}`},
+		{
+			name:  "clauses are combined with and",
+			where: []string{"country=CH", "status!=cancelled"},
+			want:  `{"and":[{"country":"CH"},{"status":"!cancelled"}]}`,
+		},
+		{
+			name:  "raw and where",
+			raw:   `{"price":">=1.5"}`,
+			where: []string{"country=CH"},
+			want:  `{"and":[{"price":">=1.5"},{"country":"CH"}]}`,
+		},
+		{name: "raw must be JSON with where", raw: `status=sent`, where: []string{"country=CH"}, wantCode: "PINGEN-INPUT-002"},
+		{name: "no operator", where: []string{"country"}, wantCode: "PINGEN-INPUT-002"},
+		{name: "no key", where: []string{"=CH"}, wantCode: "PINGEN-INPUT-002"},
+		{name: "empty in list", where: []string{"status in ,"}, wantCode: "PINGEN-INPUT-002"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := compileFilter(tt.raw, tt.where)
+			if tt.wantCode != "" {
+				if err == nil {
+					t.Fatalf("compileFilter() = %s, want error %s", got, tt.wantCode)
+				}
+				if code := codeForError(err); code != tt.wantCode {
+					t.Errorf("error code = %s, want %s (%v)", code, tt.wantCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("compileFilter() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("compileFilter() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+)
+
+// hookOptions holds the shell commands run after a letter command finishes.
+type hookOptions struct {
+	onSuccess string
+	onFailure string
+}
+
+// hookEvent describes the outcome passed to hook commands as env vars.
+type hookEvent struct {
+	command  string
+	letterID string
+	status   string
+	filePath string
+	message  string
+}
+
+func addHookFlags(fs *flag.FlagSet) *hookOptions {
+	hooks := &hookOptions{}
+	fs.StringVar(&hooks.onSuccess, "on-success", "", "Shell command to run when the command succeeds")
+	fs.StringVar(&hooks.onFailure, "on-failure", "", "Shell command to run when the command fails")
+	return hooks
+}
+
+func (h *hookOptions) run(ctx appContext, event hookEvent, exitCode int) {
+	if ctx.global.dryRun {
+		return
+	}
+	command := h.onSuccess
+	outcome := "success"
+	if exitCode != 0 {
+		command = h.onFailure
+		outcome = "failure"
+	}
+	if command == "" {
+		return
+	}
+
+	cmd := shellCommand(command)
+	cmd.Env = append(os.Environ(),
+		"PINGEN_HOOK="+outcome,
+		"PINGEN_COMMAND="+event.command,
+		"PINGEN_EXIT_CODE="+strconv.Itoa(exitCode),
+		"PINGEN_ORG_ID="+ctx.settings.OrganisationID,
+		"PINGEN_LETTER_ID="+event.letterID,
+		"PINGEN_LETTER_STATUS="+event.status,
+		"PINGEN_FILE_PATH="+event.filePath,
+		"PINGEN_ERROR="+event.message,
+	)
+	// Hook output goes to stderr so it never mixes with command output on stdout.
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		logf("warn", "%s hook failed: %v", outcome, err)
+	}
+}
+
+// fail records the failure message for hooks and reports it like
+// printErrorCode.
+func (e *hookEvent) fail(code, message string, exitCode int) int {
+	e.message = message
+	printErrorCode(code, message)
+	return exitCode
+}
+
+// setLetter copies the letter id and status from an API response.
+func (e *hookEvent) setLetter(payload map[string]any) {
+	data, _ := payload["data"].(map[string]any)
+	attrs, _ := data["attributes"].(map[string]any)
+	if id := stringValue(data["id"]); id != "" {
+		e.letterID = id
+	}
+	e.status = stringValue(attrs["status"])
+}
+
+// failErr is fail for errors, reporting them through reportError.
+func (e *hookEvent) failErr(ctx appContext, err error, code int) int {
+	e.message = err.Error()
+	reportError(ctx, err)
+	return code
+}
+
+// shellCommand runs command with the platform shell.
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// prefixSearchPages caps how many pages are scanned to resolve an id prefix.
+const prefixSearchPages = 20
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func isUUID(value string) bool {
+	return uuidPattern.MatchString(value)
+}
+
+// resolveLetterID expands a unique prefix of a letter UUID to the full id.
+// Full UUIDs are returned unchanged without an API call.
+func resolveLetterID(ctx *appContext, id string) (string, error) {
+	if isUUID(id) {
+		return id, nil
+	}
+	token, err := ensureAccessToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	client := newClient(*ctx, token)
+	return resolveIDPrefix(id, "letter", func(params map[string]string) (map[string]any, error) {
+		params["fields[letters]"] = "status"
+		payload, _, err := client.ListLettersRaw(ctx.jobContext, ctx.settings.OrganisationID, params)
+		return payload, err
+	})
+}
+
+// resolveBatchID is resolveLetterID for batches.
+func resolveBatchID(ctx *appContext, id string) (string, error) {
+	if isUUID(id) {
+		return id, nil
+	}
+	token, err := ensureAccessToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	client := newClient(*ctx, token)
+	return resolveIDPrefix(id, "batch", func(params map[string]string) (map[string]any, error) {
+		params["fields[batches]"] = "status"
+		payload, _, err := client.ListBatchesRaw(ctx.jobContext, ctx.settings.OrganisationID, params)
+		return payload, err
+	})
+}
+
+// resolveWebhookID is resolveLetterID for webhooks.
+func resolveWebhookID(ctx *appContext, id string) (string, error) {
+	if isUUID(id) {
+		return id, nil
+	}
+	token, err := ensureAccessToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	client := newClient(*ctx, token)
+	return resolveIDPrefix(id, "webhook", func(params map[string]string) (map[string]any, error) {
+		payload, _, err := client.ListWebhooksRaw(ctx.jobContext, ctx.settings.OrganisationID, params)
+		return payload, err
+	})
+}
+
+// resolveIDPrefix pages through a collection (newest first) and returns the
+// single id starting with prefix. Ambiguous or missing prefixes are errors.
+func resolveIDPrefix(prefix, kind string, list func(params map[string]string) (map[string]any, error)) (string, error) {
+	if prefix == "" {
+		return "", codedErrorf("PINGEN-INPUT-001", "%s id required", kind)
+	}
+	needle := strings.ToLower(prefix)
+	matches := []string{}
+	for page := 1; page <= prefixSearchPages; page++ {
+		payload, err := list(map[string]string{
+			"page[number]": fmt.Sprintf("%d", page),
+			"page[limit]":  "100",
+			"sort":         "-created_at",
+		})
+		if err != nil {
+			return "", err
+		}
+		data, _ := payload["data"].([]any)
+		for _, entry := range data {
+			item, _ := entry.(map[string]any)
+			id := stringValue(item["id"])
+			if strings.HasPrefix(strings.ToLower(id), needle) {
+				matches = append(matches, id)
+			}
+		}
+		if len(matches) > 1 {
+			return "", codedErrorf("PINGEN-INPUT-003", "%s id prefix %q is ambiguous (%s)", kind, prefix, strings.Join(matches, ", "))
+		}
+		if len(data) < 100 {
+			break
+		}
+	}
+	if len(matches) == 0 {
+		return "", codedErrorf("PINGEN-INPUT-003", "no %s matches id prefix %q", kind, prefix)
+	}
+	return matches[0], nil
+}
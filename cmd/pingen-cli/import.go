@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// importMap records which letters of a dump were already re-created, keyed by
+// their old id, so an interrupted import resumes without duplicates.
+type importMap struct {
+	OrganisationID string            `json:"organisation_id"`
+	Letters        map[string]string `json:"letters"`
+}
+
+// importEntry is one letter of `import letters`.
+type importEntry struct {
+	OldID  string `json:"old_id"`
+	NewID  string `json:"new_id,omitempty"`
+	File   string `json:"file,omitempty"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+
+	attributes map[string]any
+}
+
+func handleImport(ctx appContext, args []string) int {
+	if len(args) == 0 {
+		fmt.Println("import requires a subcommand (letters)")
+		return 2
+	}
+	switch args[0] {
+	case "letters":
+		return handleImportLetters(ctx, args[1:])
+	default:
+		fmt.Println("unknown import subcommand")
+		return 2
+	}
+}
+
+// handleImportLetters re-creates the letters of an `export dump` (or any
+// JSONL of letter resources) as drafts in the current organisation. Letters
+// are never sent; the old→new id mapping is kept in --map and, with
+// --report-dir, in the run report.
+func handleImportLetters(ctx appContext, args []string) (exitCode int) {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	flags := flag.NewFlagSet("import letters", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	from := flags.String("from", "", "letters.jsonl written by export dump")
+	filesDir := flags.String("files-dir", "", "Directory with <letter id>.pdf files (default: pdfs/ next to --from)")
+	mapPath := flags.String("map", "", "Old→new id map, used to resume (default: import-map.json next to --from)")
+	concurrency := flags.Int("concurrency", 4, "Letters uploaded and created in parallel")
+	reportOptions := addReportFlags(flags)
+	help := flags.Bool("help", false, "show help")
+	if err := parseFlags(ctx, flags, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli import letters --from letters.jsonl [--files-dir dir] [--map file] [--concurrency N] [--report-dir dir [--csv-delimiter c] [--decimal-comma]]")
+		return 0
+	}
+	if *from == "" {
+		printErrorCode("PINGEN-INPUT-001", "--from is required")
+		return 2
+	}
+	if *concurrency < 1 {
+		printErrorCode("PINGEN-INPUT-001", "--concurrency must be at least 1")
+		return 2
+	}
+	if *filesDir == "" {
+		*filesDir = filepath.Join(filepath.Dir(*from), "pdfs")
+	}
+	if *mapPath == "" {
+		*mapPath = filepath.Join(filepath.Dir(*from), "import-map.json")
+	}
+	letters, err := readJSONL(*from)
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	mapping, err := loadImportMap(*mapPath)
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	if mapping.OrganisationID != "" && mapping.OrganisationID != ctx.settings.OrganisationID {
+		printErrorCode("PINGEN-INPUT-001", fmt.Sprintf("organisation mismatch: %s maps letters into organisation %s; use another --map file", *mapPath, mapping.OrganisationID))
+		return 2
+	}
+	mapping.OrganisationID = ctx.settings.OrganisationID
+
+	entries := make([]importEntry, 0, len(letters))
+	for _, letter := range letters {
+		entry := importEntry{OldID: stringValue(letter["id"])}
+		if newID, ok := mapping.Letters[entry.OldID]; ok {
+			entry.NewID = newID
+			entry.Result = "skipped"
+		} else if entry.File, err = findImportFile(*filesDir, entry.OldID); err != nil {
+			entry.Result = "failed"
+			entry.Error = err.Error()
+		} else if entry.attributes, err = importAttributes(letter); err != nil {
+			entry.Result = "failed"
+			entry.Error = err.Error()
+		} else if err = pingen.PreflightPDF(entry.File, maxUploadSize(ctx)); err != nil {
+			entry.Result = "failed"
+			entry.Error = err.Error()
+		}
+		entries = append(entries, entry)
+	}
+
+	if ctx.global.dryRun {
+		planned := []any{}
+		for _, entry := range entries {
+			item := map[string]any{"old_id": entry.OldID, "file": entry.File, "result": entry.Result, "error": entry.Error, "attributes": entry.attributes}
+			if entry.Result == "" {
+				upload := pingen.LetterUpload{Path: entry.File, Attributes: copyMap(entry.attributes), IdempotencyKey: importIdempotencyKey(ctx, entry.OldID)}
+				requests, err := previewRequests(ctx, previewLetterUpload(ctx, upload))
+				if err != nil {
+					reportError(ctx, err)
+					return 1
+				}
+				item["requests"] = requests
+			}
+			planned = append(planned, item)
+		}
+		return emitJSON(redactPayload(map[string]any{
+			"action":          "import.letters",
+			"organisation_id": ctx.settings.OrganisationID,
+			"map":             *mapPath,
+			"letters":         planned,
+		}))
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+	report := newRunReport(ctx, "import letters")
+	defer func() {
+		for _, entry := range entries {
+			report.add(reportItem{Input: entry.OldID, LetterID: entry.NewID, Result: entry.Result, Error: entry.Error})
+		}
+		report.write(ctx, reportOptions, exitCode)
+	}()
+	var stopSignals func()
+	ctx.jobContext, stopSignals = handleSignals(ctx.jobContext)
+	defer stopSignals()
+
+	// Letters are created concurrently; the map is rewritten after each one
+	// so that an interrupted import resumes where it stopped.
+	runContext, stop := context.WithCancel(ctx.jobContext)
+	defer stop()
+	todo := []int{}
+	uploads := []pingen.LetterUpload{}
+	for i, entry := range entries {
+		if entry.Result != "" {
+			continue
+		}
+		todo = append(todo, i)
+		uploads = append(uploads, pingen.LetterUpload{Path: entry.File, Attributes: entry.attributes, IdempotencyKey: importIdempotencyKey(ctx, entry.OldID)})
+	}
+	var mapErr error
+	client.CreateLettersFromFilesRaw(runContext, ctx.settings.OrganisationID, uploads, *concurrency, uploadTimeout(ctx), func(j int, letter map[string]any, err error) {
+		entry := &entries[todo[j]]
+		if err != nil {
+			entry.Result = "failed"
+			if runContext.Err() != nil {
+				entry.Result = "pending"
+			}
+			entry.Error = err.Error()
+			return
+		}
+		item, _ := letter["data"].(map[string]any)
+		entry.NewID = stringValue(item["id"])
+		entry.Result = "created"
+		mapping.Letters[entry.OldID] = entry.NewID
+		if mapErr == nil {
+			if mapErr = writeJSONFile(*mapPath, mapping); mapErr != nil {
+				stop()
+			}
+		}
+	})
+	for _, i := range todo {
+		if entries[i].Result == "" {
+			entries[i].Result = "pending"
+		}
+	}
+	if mapErr != nil {
+		printErrorCode("PINGEN-INPUT-009", fmt.Sprintf("failed to write import map: %v", mapErr))
+		return 1
+	}
+
+	counts := map[string]int{}
+	for _, entry := range entries {
+		counts[entry.Result]++
+		if entry.Result == "failed" {
+			annotatef("error", "letter %s: import failed: %s", entry.OldID, entry.Error)
+		}
+	}
+	if ctx.global.jsonOutput {
+		emitJSON(map[string]any{"organisation_id": ctx.settings.OrganisationID, "map": *mapPath, "letters": entries})
+	} else {
+		endGroup := ciGroup(ctx, fmt.Sprintf("import letters: %d letters", len(entries)))
+		for _, entry := range entries {
+			detail := entry.NewID
+			if entry.Error != "" {
+				detail = entry.Error
+			}
+			fmt.Printf("%s\t%s\t%s\n", entry.OldID, entry.Result, detail)
+		}
+		endGroup()
+		if !ctx.global.quiet {
+			logf("info", "%d created, %d already imported, %d failed; map: %s", counts["created"], counts["skipped"], counts["failed"], *mapPath)
+		}
+	}
+	if counts["pending"] > 0 {
+		logf("info", "stopped early: %d letters pending; re-run the same command to resume", counts["pending"])
+	}
+	if interrupted(ctx) {
+		return exitInterrupted
+	}
+	if counts["failed"] > 0 || counts["pending"] > 0 {
+		return 1
+	}
+	return 0
+}
+
+// importAttributes returns the create attributes for a dumped letter: its
+// file name, address position, meta data and, where set, its send options.
+// auto_send is always off so that imported letters stay drafts.
+func importAttributes(letter map[string]any) (map[string]any, error) {
+	attrs, _ := letter["attributes"].(map[string]any)
+	attributes := map[string]any{
+		"file_original_name": stringValue(attrs["file_original_name"]),
+		"address_position":   stringValue(attrs["address_position"]),
+		"auto_send":          false,
+	}
+	if attributes["file_original_name"] == "" {
+		attributes["file_original_name"] = stringValue(letter["id"]) + ".pdf"
+	}
+	if !isAllowed(stringValue(attributes["address_position"]), []string{"left", "right"}) {
+		attributes["address_position"] = "left"
+	}
+	allowed := map[string][]string{
+		"delivery_product": {"fast", "cheap", "bulk", "premium", "registered"},
+		"print_mode":       {"simplex", "duplex"},
+		"print_spectrum":   {"color", "grayscale"},
+	}
+	for key, values := range allowed {
+		if value := stringValue(attrs[key]); isAllowed(value, values) {
+			attributes[key] = value
+		}
+	}
+	if metaData, ok := attrs["meta_data"].(map[string]any); ok && len(metaData) > 0 {
+		attributes["meta_data"] = metaData
+	}
+	payload := map[string]any{"data": map[string]any{"type": "letters", "attributes": attributes}}
+	attributes["file_url"] = "https://upload.invalid/pending"
+	attributes["file_url_signature"] = "pending"
+	err := pingen.ValidatePayload("letter-create", payload)
+	delete(attributes, "file_url")
+	delete(attributes, "file_url_signature")
+	return attributes, err
+}
+
+// findImportFile looks for the PDF of letterID in the layouts written by
+// `export dump --pdfs` (<dir>/<id>.pdf) and `export archive`
+// (<dir>/<id>/<id>.pdf).
+func findImportFile(dir, letterID string) (string, error) {
+	for _, path := range []string{
+		filepath.Join(dir, letterID+".pdf"),
+		filepath.Join(dir, letterID, letterID+".pdf"),
+	} {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no PDF for letter %s in %s", letterID, dir)
+}
+
+func loadImportMap(path string) (importMap, error) {
+	mapping := importMap{Letters: map[string]string{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return mapping, nil
+	}
+	if err != nil {
+		return mapping, codedErrorf("PINGEN-INPUT-009", "failed to read import map: %w", err)
+	}
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		return mapping, codedErrorf("PINGEN-INPUT-009", "invalid import map %s: %w", path, err)
+	}
+	if mapping.Letters == nil {
+		mapping.Letters = map[string]string{}
+	}
+	return mapping, nil
+}
+
+// readJSONL reads one JSON object per line; blank lines are skipped.
+func readJSONL(path string) ([]map[string]any, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, codedErrorf("PINGEN-INPUT-001", "failed to read %s: %w", path, err)
+	}
+	defer file.Close()
+	records := []map[string]any{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, codedErrorf("PINGEN-DOWNLOAD-001", "invalid JSONL %s line %d: %w", path, line, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// importIdempotencyKey is derived from the target organisation and the old
+// id, so a retry after a lost response does not create the letter twice.
+func importIdempotencyKey(ctx appContext, oldID string) string {
+	sum := sha256.Sum256([]byte(ctx.settings.OrganisationID + "/" + oldID))
+	return "import-" + hex.EncodeToString(sum[:16])
+}
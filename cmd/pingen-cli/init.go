@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// prompter reads answers for interactive commands from stdin.
+type prompter struct {
+	reader *bufio.Reader
+	out    io.Writer
+}
+
+func newPrompter() *prompter {
+	return &prompter{reader: bufio.NewReader(os.Stdin), out: os.Stdout}
+}
+
+// ask prints question and returns the trimmed answer, or fallback if empty.
+func (p *prompter) ask(question, fallback string) (string, error) {
+	if fallback != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, fallback)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+	line, err := p.reader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("input aborted")
+	}
+	answer := strings.TrimSpace(line)
+	if answer == "" {
+		return fallback, nil
+	}
+	return answer, nil
+}
+
+// choose asks until the answer is one of allowed.
+func (p *prompter) choose(question, fallback string, allowed []string) (string, error) {
+	for {
+		answer, err := p.ask(fmt.Sprintf("%s (%s)", question, strings.Join(allowed, "/")), fallback)
+		if err != nil {
+			return "", err
+		}
+		if answer == "" || isAllowed(answer, allowed) {
+			return answer, nil
+		}
+		fmt.Fprintf(p.out, "please answer one of: %s\n", strings.Join(allowed, ", "))
+	}
+}
+
+// secret reads a value without echoing it when stdin is a Unix terminal.
+func (p *prompter) secret(question string, keep bool) (string, error) {
+	hint := ""
+	if keep {
+		hint = " (enter keeps the current one)"
+	}
+	fmt.Fprintf(p.out, "%s%s: ", question, hint)
+	echoOff := false
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 && runtime.GOOS != "windows" {
+		echoOff = setTerminalEcho(false) == nil
+	}
+	line, err := p.reader.ReadString('\n')
+	if echoOff {
+		_ = setTerminalEcho(true)
+		fmt.Fprintln(p.out)
+	}
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("input aborted")
+	}
+	return strings.TrimSpace(line), nil
+}
+
+func setTerminalEcho(on bool) error {
+	mode := "-echo"
+	if on {
+		mode = "echo"
+	}
+	_, err := stty(mode)
+	return err
+}
+
+func handleInit(ctx appContext, args []string) int {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli init")
+		return 0
+	}
+
+	cfg, _, err := loadConfig(ctx.configPath)
+	if err != nil {
+		printErrorCode("PINGEN-CONFIG-002", "failed to load config")
+		return 1
+	}
+	p := newPrompter()
+	if ctx.configLoaded {
+		fmt.Printf("Updating %s (press enter to keep a value).\n\n", ctx.configPath)
+	} else {
+		fmt.Printf("Creating %s.\n\n", ctx.configPath)
+	}
+
+	env, err := p.choose("Environment", ctx.settings.Env, []string{"staging", "production"})
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	clientID, err := p.ask("OAuth client id", ctx.settings.ClientID)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	secret, err := p.secret("OAuth client secret", ctx.settings.ClientSecret != "")
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	if secret == "" {
+		secret = ctx.settings.ClientSecret
+	}
+	if clientID == "" || secret == "" {
+		printErrorCode("PINGEN-AUTH-001", "client id/secret required")
+		return 2
+	}
+
+	// Base URL overrides from flags or env still apply; otherwise the
+	// defaults of the chosen environment are used and not persisted.
+	overrides := pingen.MergeConfig(configFromEnv(), configFromGlobal(ctx.global))
+	if overrides.Env != "" && overrides.Env != env {
+		overrides.APIBase, overrides.IdentityBase = "", ""
+	}
+	overrides.Env = env
+	bases := applyDefaultBases(overrides)
+	client := pingen.Client{
+		APIBase:      bases.APIBase,
+		IdentityBase: bases.IdentityBase,
+		Timeout:      time.Duration(ctx.global.timeout) * time.Second,
+		Transport:    ctx.transport,
+	}
+	if ctx.global.trace {
+		client.OnTrace = logTrace
+	}
+	fmt.Println("\nRequesting an access token...")
+	tokens, err := client.GetToken(ctx.jobContext, clientID, secret, defaultScope)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	if tokens.AccessToken == "" {
+		printErrorCode("PINGEN-AUTH-002", "access token missing in response")
+		return 1
+	}
+	client.AccessToken = tokens.AccessToken
+
+	orgID, err := chooseOrganisation(ctx.jobContext, p, client, ctx.settings.OrganisationID)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+
+	fmt.Println("\nDefault letter options (enter skips):")
+	createDefaults := map[string]string{}
+	sendDefaults := map[string]string{}
+	for _, option := range []struct {
+		command, flag, question string
+		allowed                 []string
+	}{
+		{"letters.create", "address-position", "Address position", []string{"left", "right"}},
+		{"letters.send", "delivery-product", "Delivery product", []string{"fast", "cheap", "bulk", "premium", "registered"}},
+		{"letters.send", "print-mode", "Print mode", []string{"simplex", "duplex"}},
+		{"letters.send", "print-spectrum", "Print spectrum", []string{"color", "grayscale"}},
+	} {
+		answer, err := p.choose(option.question, cfg.Defaults[option.command][option.flag], option.allowed)
+		if err != nil {
+			reportError(ctx, err)
+			return 1
+		}
+		if answer == "" {
+			continue
+		}
+		if option.command == "letters.create" {
+			createDefaults[option.flag] = answer
+		} else {
+			sendDefaults[option.flag] = answer
+		}
+	}
+
+	cfg.Env = env
+	cfg.ClientID = clientID
+	cfg.ClientSecret = secret
+	cfg.OrganisationID = orgID
+	cfg.AccessToken = tokens.AccessToken
+	cfg.AccessTokenScope = ""
+	if expiresAt := tokens.ExpiresAt(time.Now()); !expiresAt.IsZero() {
+		cfg.AccessTokenExpiresAt = expiresAt.Unix()
+	}
+	cfg = pingen.MergeConfig(cfg, pingen.Config{Defaults: map[string]map[string]string{
+		"letters.create": createDefaults,
+		"letters.send":   sendDefaults,
+	}})
+	if err := saveConfig(ctx, cfg); err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	fmt.Printf("\nSaved %s\n", ctx.configPath)
+
+	fmt.Println("Verifying access...")
+	payload, _, err := client.ListLettersRaw(ctx.jobContext, orgID, map[string]string{"page[limit]": "1"})
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	meta, _ := payload["meta"].(map[string]any)
+	fmt.Printf("ok: organisation %s reachable on %s (%s letters)\n", orgID, env, stringValue(meta["total"]))
+	return 0
+}
+
+// chooseOrganisation lists the organisations the token can access and lets
+// the user pick one; a single organisation is selected automatically.
+func chooseOrganisation(jobContext context.Context, p *prompter, client pingen.Client, current string) (string, error) {
+	payload, _, err := client.ListOrganisationsRaw(jobContext, map[string]string{"page[limit]": "100"})
+	if err != nil {
+		return "", err
+	}
+	data, _ := payload["data"].([]any)
+	if len(data) == 0 {
+		return "", codedErrorf("PINGEN-INPUT-001", "organisation id required (the credentials have no organisation)")
+	}
+	ids := make([]string, 0, len(data))
+	fallback := "1"
+	fmt.Println("\nOrganisations:")
+	for i, entry := range data {
+		item, _ := entry.(map[string]any)
+		attrs, _ := item["attributes"].(map[string]any)
+		id := stringValue(item["id"])
+		ids = append(ids, id)
+		if id == current {
+			fallback = strconv.Itoa(i + 1)
+		}
+		fmt.Printf("  %d) %s  %s\n", i+1, stringValue(attrs["name"]), id)
+	}
+	if len(ids) == 1 {
+		fmt.Printf("Using %s\n", ids[0])
+		return ids[0], nil
+	}
+	for {
+		answer, err := p.ask("Organisation number", fallback)
+		if err != nil {
+			return "", err
+		}
+		index, err := strconv.Atoi(answer)
+		if err == nil && index >= 1 && index <= len(ids) {
+			return ids[index-1], nil
+		}
+		fmt.Printf("please enter a number between 1 and %d\n", len(ids))
+	}
+}
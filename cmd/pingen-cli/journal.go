@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// journalEntry records a letters create or send run with the idempotency key
+// it sent, so that an interrupted run can be repeated without sending the
+// letter twice: Pingen answers a repeated key with the original result.
+// Entries are appended to the journal file when the run starts and again
+// when it ends; the last line of an id wins.
+type journalEntry struct {
+	ID             string    `json:"id"`
+	Command        string    `json:"command"`
+	Args           []string  `json:"args"`
+	Dir            string    `json:"dir"`
+	OrganisationID string    `json:"organisation_id"`
+	Env            string    `json:"env"`
+	IdempotencyKey string    `json:"idempotency_key"`
+	Status         string    `json:"status"` // started, done or failed
+	Attempts       int       `json:"attempts"`
+	LastError      string    `json:"last_error,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// journalPath is the request journal, next to the queue in journalDir.
+func journalPath() (string, error) {
+	dir, err := journalDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "requests.jsonl"), nil
+}
+
+// newIdempotencyKey returns a random (version 4) UUID.
+func newIdempotencyKey() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	buf[6] = buf[6]&0x0f | 0x40
+	buf[8] = buf[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", buf[0:4], buf[4:6], buf[6:8], buf[8:10], buf[10:])
+}
+
+// runJournaled runs handler for command with an idempotency key and records
+// the run in the journal. Without --idempotency-key a new key is generated
+// and passed on. Help, --dry-run and --schema-only runs send nothing and are
+// not recorded, and neither is a send queued with --at: the queue keeps its
+// own record and key.
+func runJournaled(ctx appContext, command string, args []string, handler func(appContext, []string) int) int {
+	if ctx.global.dryRun || ctx.journalID != "" || hasArg(args, "help", "h", "schema-only", "at") {
+		return handler(ctx, args)
+	}
+	key := argValue(args, "idempotency-key")
+	if key == "" {
+		key = newIdempotencyKey()
+		args = append([]string{"--idempotency-key", key}, args...)
+	}
+	dir, _ := os.Getwd()
+	now := time.Now()
+	entry := journalEntry{
+		ID:             now.UTC().Format("20060102T150405") + "-" + randomHex(3),
+		Command:        command,
+		Args:           args,
+		Dir:            dir,
+		OrganisationID: ctx.settings.OrganisationID,
+		Env:            ctx.settings.Env,
+		IdempotencyKey: key,
+		CreatedAt:      now,
+	}
+	return runJournalEntry(ctx, entry, handler)
+}
+
+// runJournalEntry records the start of an attempt, runs it and records the
+// outcome. A journal that cannot be written only costs the record, not the
+// run.
+func runJournalEntry(ctx appContext, entry journalEntry, handler func(appContext, []string) int) int {
+	entry.Attempts++
+	entry.Status, entry.LastError, entry.UpdatedAt = "started", "", time.Now()
+	if err := appendJournal(entry); err != nil {
+		logf("warn", "%v", err)
+	}
+	ctx.journalID = entry.ID
+	lastError = ""
+	code := handler(ctx, entry.Args)
+	entry.Status, entry.UpdatedAt = "done", time.Now()
+	if code != 0 {
+		entry.Status = "failed"
+		entry.LastError = fmt.Sprintf("exit code %d", code)
+		if lastError != "" {
+			entry.LastError += ": " + lastError
+		}
+	}
+	if err := appendJournal(entry); err != nil {
+		logf("warn", "%v", err)
+	}
+	return code
+}
+
+func appendJournal(entry journalEntry) error {
+	path, err := journalPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	return nil
+}
+
+// loadJournal returns the latest state of every entry, oldest first.
+func loadJournal() ([]journalEntry, error) {
+	path, err := journalPath()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []journalEntry{}, nil
+	}
+	if err != nil {
+		return nil, codedErrorf("PINGEN-CONFIG-002", "failed to load journal: %w", err)
+	}
+	defer file.Close()
+	latest := map[string]journalEntry{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var entry journalEntry
+		// A line cut short by a crash is skipped.
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil || entry.ID == "" {
+			continue
+		}
+		latest[entry.ID] = entry
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, codedErrorf("PINGEN-CONFIG-002", "failed to load journal: %w", err)
+	}
+	entries := make([]journalEntry, 0, len(latest))
+	for _, entry := range latest {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].CreatedAt.Before(entries[j].CreatedAt) })
+	return entries, nil
+}
+
+// findJournalEntry looks up an entry by id or unique id prefix.
+func findJournalEntry(id string) (journalEntry, error) {
+	entries, err := loadJournal()
+	if err != nil {
+		return journalEntry{}, err
+	}
+	matches := []journalEntry{}
+	for _, entry := range entries {
+		if entry.ID == id {
+			return entry, nil
+		}
+		if strings.HasPrefix(entry.ID, id) {
+			matches = append(matches, entry)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return journalEntry{}, codedErrorf("PINGEN-CONFIG-005", "unknown journal entry: %s", id)
+	case 1:
+		return matches[0], nil
+	}
+	return journalEntry{}, codedErrorf("PINGEN-CONFIG-005", "ambiguous journal entry %s: matches %d entries", id, len(matches))
+}
+
+// journalStatus is the status shown for entry: a run that started but never
+// recorded its end was interrupted.
+func journalStatus(entry journalEntry) string {
+	if entry.Status == "started" {
+		return "interrupted"
+	}
+	return entry.Status
+}
+
+func describeJournalEntry(ctx appContext, entry journalEntry) map[string]any {
+	described := map[string]any{
+		"id":              entry.ID,
+		"command":         entry.Command,
+		"args":            entry.Args,
+		"dir":             entry.Dir,
+		"organisation_id": entry.OrganisationID,
+		"env":             entry.Env,
+		"idempotency_key": entry.IdempotencyKey,
+		"status":          journalStatus(entry),
+		"attempts":        entry.Attempts,
+		"created_at":      entry.CreatedAt.In(inputLocation(ctx)).Format(time.RFC3339),
+		"updated_at":      entry.UpdatedAt.In(inputLocation(ctx)).Format(time.RFC3339),
+	}
+	if entry.LastError != "" {
+		described["last_error"] = entry.LastError
+	}
+	return described
+}
+
+func handleJournal(ctx appContext, args []string) int {
+	if len(args) == 0 {
+		fmt.Println("journal requires a subcommand (list/show/retry)")
+		return 2
+	}
+	switch args[0] {
+	case "list":
+		return handleJournalList(ctx, args[1:])
+	case "show":
+		if len(args) < 2 {
+			fmt.Println("journal show requires an entry id")
+			return 2
+		}
+		entry, err := findJournalEntry(args[1])
+		if err != nil {
+			reportError(ctx, err)
+			return 2
+		}
+		return emitJSON(describeJournalEntry(ctx, entry))
+	case "retry":
+		return handleJournalRetry(ctx, args[1:])
+	default:
+		fmt.Println("unknown journal subcommand")
+		return 2
+	}
+}
+
+func handleJournalList(ctx appContext, args []string) int {
+	fs := flag.NewFlagSet("journal list", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	status := fs.String("status", "", "Only list entries with this status (interrupted, done, failed)")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli journal list [--status interrupted|done|failed]")
+		return 0
+	}
+	if *status != "" && !isAllowed(*status, []string{"interrupted", "done", "failed"}) {
+		printErrorCode("PINGEN-INPUT-001", "invalid --status")
+		return 2
+	}
+	entries, err := loadJournal()
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	rows := []map[string]any{}
+	for _, entry := range entries {
+		row := describeJournalEntry(ctx, entry)
+		if *status != "" && row["status"] != *status {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	if ctx.global.jsonOutput {
+		return emitJSON(rows)
+	}
+	for _, row := range rows {
+		line := fmt.Sprintf("%s\t%s\t%d attempt(s)\t%v\t%s %s", row["id"], row["status"], row["attempts"], row["updated_at"], row["command"], strings.Join(row["args"].([]string), " "))
+		if lastError, ok := row["last_error"]; ok {
+			line += "\t" + stringValue(lastError)
+		}
+		fmt.Println(line)
+	}
+	return 0
+}
+
+// handleJournalRetry runs an interrupted or failed entry again with its
+// arguments and idempotency key, from the directory it was started in.
+func handleJournalRetry(ctx appContext, args []string) int {
+	fs := flag.NewFlagSet("journal retry", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help || fs.NArg() != 1 {
+		fmt.Println("Usage: pingen-cli journal retry <entry>")
+		if *help {
+			return 0
+		}
+		return 2
+	}
+	entry, err := findJournalEntry(fs.Arg(0))
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	switch {
+	case entry.Status == "done":
+		printErrorCode("PINGEN-CONFIG-010", fmt.Sprintf("journal entry %s already succeeded", entry.ID))
+		return 2
+	case entry.Env != ctx.settings.Env:
+		printErrorCode("PINGEN-CONFIG-010", fmt.Sprintf("journal entry %s was recorded for the %s environment (pass --env %s)", entry.ID, entry.Env, entry.Env))
+		return 2
+	case argValue(entry.Args, "file") == "-":
+		printErrorCode("PINGEN-CONFIG-010", fmt.Sprintf("journal entry %s read its file from stdin and cannot be repeated", entry.ID))
+		return 2
+	}
+	if entry.Dir != "" {
+		if err := os.Chdir(entry.Dir); err != nil {
+			reportError(ctx, err)
+			return 1
+		}
+	}
+	ctx.settings.OrganisationID = entry.OrganisationID
+	logf("info", "journal: repeating %s (%s) with idempotency key %s", entry.ID, entry.Command, entry.IdempotencyKey)
+	parts := strings.Fields(entry.Command)
+	return runJournalEntry(ctx, entry, func(ctx appContext, args []string) int {
+		return dispatch(ctx, parts[0], append(parts[1:], args...))
+	})
+}
+
+// hasArg reports whether args contain one of the flags names.
+func hasArg(args []string, names ...string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			return false
+		}
+		for _, name := range names {
+			if arg == "-"+name || arg == "--"+name || strings.HasPrefix(arg, "--"+name+"=") || strings.HasPrefix(arg, "-"+name+"=") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// argValue returns the value of flag name in args, or "".
+func argValue(args []string, name string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		for _, prefix := range []string{"--", "-"} {
+			if arg == prefix+name && i+1 < len(args) {
+				return args[i+1]
+			}
+			if value, ok := strings.CutPrefix(arg, prefix+name+"="); ok {
+				return value
+			}
+		}
+	}
+	return ""
+}
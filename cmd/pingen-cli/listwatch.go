@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// letterListWatch re-polls a letters listing for `letters list --watch`.
+type letterListWatch struct {
+	ctx         appContext
+	client      pingen.Client
+	params      map[string]string
+	all         bool
+	maxPages    int
+	concurrency int
+	sortBy      string
+	interval    time.Duration
+	changesOnly bool
+
+	// status holds the last seen status by letter id for --changes-only.
+	status map[string]string
+}
+
+// run polls until Ctrl-C or --deadline, which end the watch normally.
+// Network errors, rate limiting and server errors are retried on the next
+// poll.
+func (w *letterListWatch) run() int {
+	var stopSignals func()
+	w.ctx.jobContext, stopSignals = handleSignals(w.ctx.jobContext)
+	defer stopSignals()
+	redraw := !w.changesOnly && stdoutIsTerminal()
+	for first := true; ; first = false {
+		payload, headers, err := w.fetch()
+		if w.ctx.jobContext.Err() != nil {
+			return 0
+		}
+		switch {
+		case err != nil && retryableWatchError(err):
+			logf("warn", "polling letters failed, retrying: %s", err.Error())
+		case err != nil:
+			reportError(w.ctx, err)
+			return 1
+		case w.changesOnly:
+			if code := w.emitChanges(payload, headers, first); code != 0 {
+				return code
+			}
+		default:
+			if redraw {
+				fmt.Print("\033[H\033[2J")
+				fmt.Printf("Every %s: letters list  %s  (Ctrl-C to stop)\n\n", w.interval, time.Now().Format("15:04:05"))
+			}
+			data, _ := payload["data"].([]any)
+			if code := emitPayload(w.ctx, payload, headers, func() {
+				for _, entry := range data {
+					item, _ := entry.(map[string]any)
+					printLetterRow(item)
+				}
+			}); code != 0 {
+				return code
+			}
+		}
+		if !sleepContext(w.ctx.jobContext, w.interval) {
+			return 0
+		}
+	}
+}
+
+// fetch returns the current listing, every page of it with --all.
+func (w *letterListWatch) fetch() (map[string]any, http.Header, error) {
+	if !w.all {
+		payload, headers, err := w.client.ListLettersRaw(w.ctx.jobContext, w.ctx.settings.OrganisationID, w.params)
+		if err == nil && w.sortBy != "" {
+			data, _ := payload["data"].([]any)
+			sortResources(data, w.sortBy)
+		}
+		return payload, headers, err
+	}
+	var mu sync.Mutex
+	var headers http.Header
+	items, pages, truncated, err := fetchPages(w.ctx.jobContext, w.concurrency, w.maxPages, func(page int) (map[string]any, error) {
+		payload, pageHeaders, err := w.client.ListLettersRaw(w.ctx.jobContext, w.ctx.settings.OrganisationID, withPage(w.params, page))
+		mu.Lock()
+		headers = pageHeaders
+		mu.Unlock()
+		return payload, err
+	})
+	if err != nil {
+		return nil, headers, err
+	}
+	data := make([]any, 0, len(items))
+	for _, item := range items {
+		data = append(data, item)
+	}
+	sortBy := w.sortBy
+	if sortBy == "" {
+		sortBy = mergedSortOrder
+	}
+	sortResources(data, sortBy)
+	return map[string]any{"data": data, "meta": map[string]any{"pages": pages, "total": len(data), "truncated": truncated}}, headers, nil
+}
+
+// emitChanges writes the letters that are new or whose status changed since
+// the previous poll; the first poll writes every letter. With --json each
+// letter is one compact JSON line, so the output can be piped while it runs.
+func (w *letterListWatch) emitChanges(payload map[string]any, headers http.Header, first bool) int {
+	if w.status == nil {
+		w.status = map[string]string{}
+	}
+	changed := []any{}
+	data, _ := payload["data"].([]any)
+	for _, entry := range data {
+		item, _ := entry.(map[string]any)
+		id := stringValue(item["id"])
+		attrs, _ := item["attributes"].(map[string]any)
+		status := stringValue(attrs["status"])
+		if previous, seen := w.status[id]; first || !seen || previous != status {
+			changed = append(changed, item)
+		}
+		w.status[id] = status
+	}
+	if len(changed) == 0 {
+		verbosef(w.ctx, "no letter changed")
+		return 0
+	}
+	if w.ctx.global.jsonOutput && w.ctx.global.templateName == "" {
+		for _, item := range changed {
+			line, err := json.Marshal(item)
+			if err != nil {
+				printErrorCode("PINGEN-OUTPUT-001", "failed to encode json")
+				return 1
+			}
+			fmt.Println(string(line))
+		}
+		return 0
+	}
+	return emitPayload(w.ctx, map[string]any{"data": changed}, headers, func() {
+		for _, item := range changed {
+			letter, _ := item.(map[string]any)
+			printLetterRow(letter)
+		}
+	})
+}
+
+func stdoutIsTerminal() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
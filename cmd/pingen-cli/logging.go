@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// eventLogger writes diagnostics to stderr and, with --log-file, appends them
+// to a file. Text events on stderr look exactly like the CLI's plain
+// messages; --log-format json writes one JSON object per event instead, with
+// time, level, command and any fields such as request_id or duration_ms.
+// Events below level are not printed, and events below fileLevel are not
+// written to the file.
+type eventLogger struct {
+	mu        sync.Mutex
+	format    string
+	file      *os.File
+	command   string
+	start     time.Time
+	level     string
+	fileLevel string
+	// traceFormat is the format of --trace events, text or json.
+	traceFormat string
+	// ci is the --ci provider; warnings and errors become its annotations.
+	ci string
+	// groups counts open --ci log sections; see ciGroup.
+	groups int
+}
+
+// activeLogger is process-wide, like activeRedactor, so that printError and
+// the other helpers used before a command has a context can log.
+var activeLogger = &eventLogger{format: "text", start: time.Now(), level: "info", fileLevel: "debug"}
+
+var logFormats = []string{"text", "json"}
+
+// logLevels are the --log-level values, least severe first.
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+// levelAtLeast reports whether level is as severe as threshold.
+func levelAtLeast(level, threshold string) bool {
+	rank := map[string]int{}
+	for i, name := range logLevels {
+		rank[name] = i
+	}
+	return rank[level] >= rank[threshold]
+}
+
+// configureLogging sets up activeLogger from the global flags. Without
+// --log-level, stderr gets info and above (debug with --verbose or --trace)
+// and the log file gets everything; --log-level sets both. The returned
+// function closes the log file.
+func configureLogging(global globalOptions, command string) (func(), error) {
+	level, fileLevel := global.logLevel, global.logLevel
+	if level == "" {
+		level, fileLevel = "info", "debug"
+		if (global.verbose || global.trace) && !global.quiet {
+			level = "debug"
+		}
+	}
+	activeLogger = &eventLogger{format: global.logFormat, command: command, start: time.Now(), level: level, fileLevel: fileLevel, ci: global.ci}
+	activeLogger.traceFormat = global.traceFormat
+	if activeLogger.traceFormat == "" {
+		activeLogger.traceFormat = global.logFormat
+	}
+	if global.logFile == "" {
+		return func() {}, nil
+	}
+	file, err := os.OpenFile(global.logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	activeLogger.file = file
+	return func() { file.Close() }, nil
+}
+
+// commandName returns the command for log events, e.g. "letters create".
+func commandName(subcommand string, subargs []string) string {
+	if len(subargs) > 0 && isAllowed(subargs[0], completionCommands[subcommand]) {
+		return subcommand + " " + subargs[0]
+	}
+	return subcommand
+}
+
+// logf logs a message at level (debug, info, warn or error). Debug events
+// reach stderr only with --verbose or --log-level debug but are written to
+// the log file unless --log-level is higher.
+func logf(level, format string, args ...any) {
+	activeLogger.log(level, redactText(fmt.Sprintf(format, args...)), nil)
+}
+
+func (l *eventLogger) jsonFormat() bool {
+	return l.format == "json"
+}
+
+func (l *eventLogger) log(level, message string, fields map[string]any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if levelAtLeast(level, l.level) {
+		if l.jsonFormat() {
+			fmt.Fprintln(os.Stderr, l.encode(now, level, message, fields))
+			l.annotate(level, message)
+		} else if l.ci != "" && (level == "warn" || level == "error") {
+			l.annotate(level, message)
+		} else {
+			text := message
+			if level == "warn" {
+				text = "warning: " + message
+			}
+			fmt.Fprintln(os.Stderr, text)
+		}
+	}
+	l.writeFile(now, level, message, fields)
+}
+
+// logJSON logs an event as JSON on stderr whatever the log format, for
+// --trace-format json; the log file keeps its format.
+func (l *eventLogger) logJSON(level, message string, fields map[string]any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if levelAtLeast(level, l.level) {
+		fmt.Fprintln(os.Stderr, l.encode(now, level, message, fields))
+	}
+	l.writeFile(now, level, message, fields)
+}
+
+// logFile writes an event to the log file only, for messages that are
+// printed to stderr in another form.
+func (l *eventLogger) logFile(level, message string, fields map[string]any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.writeFile(time.Now(), level, message, fields)
+}
+
+func (l *eventLogger) writeFile(now time.Time, level, message string, fields map[string]any) {
+	if l.file == nil || !levelAtLeast(level, l.fileLevel) {
+		return
+	}
+	if l.jsonFormat() {
+		fmt.Fprintln(l.file, l.encode(now, level, message, fields))
+		return
+	}
+	line := []string{now.UTC().Format(time.RFC3339), strings.ToUpper(level)}
+	if l.command != "" {
+		line = append(line, l.command+":")
+	}
+	line = append(line, message)
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		line = append(line, fmt.Sprintf("%s=%v", key, fields[key]))
+	}
+	fmt.Fprintln(l.file, strings.Join(line, " "))
+}
+
+func (l *eventLogger) encode(now time.Time, level, message string, fields map[string]any) string {
+	event := map[string]any{}
+	for key, value := range fields {
+		event[key] = value
+	}
+	event["time"] = now.UTC().Format(time.RFC3339Nano)
+	event["level"] = level
+	event["message"] = message
+	if l.command != "" {
+		event["command"] = l.command
+	}
+	var encoded strings.Builder
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(event); err != nil {
+		return fmt.Sprintf(`{"level":%q,"message":%q}`, level, message)
+	}
+	return strings.TrimSuffix(encoded.String(), "\n")
+}
+
+// logRequest is the client's OnRequest hook: one debug event per HTTP
+// exchange with its status, request id and duration.
+func logRequest(info pingen.RequestInfo) {
+	if !activeLogger.jsonFormat() {
+		message := fmt.Sprintf("%s %s", info.Method, info.URL)
+		if info.Err != nil {
+			message += " failed: " + redactText(info.Err.Error())
+		} else {
+			message += fmt.Sprintf(" -> %d (%dms)", info.Status, info.Duration.Milliseconds())
+		}
+		if info.RequestID != "" {
+			message += " request_id=" + info.RequestID
+		}
+		if info.RateLimit.Known {
+			message += fmt.Sprintf(" rate_limit=%d/%d", info.RateLimit.Remaining, info.RateLimit.Limit)
+		}
+		activeLogger.log("debug", message, nil)
+		return
+	}
+	fields := map[string]any{
+		"method":      info.Method,
+		"url":         info.URL,
+		"duration_ms": info.Duration.Milliseconds(),
+	}
+	if info.Err != nil {
+		fields["error"] = redactText(info.Err.Error())
+	} else {
+		fields["status"] = info.Status
+	}
+	if info.RequestID != "" {
+		fields["request_id"] = info.RequestID
+	}
+	if info.RateLimit.Known {
+		fields["rate_limit_remaining"] = info.RateLimit.Remaining
+		fields["rate_limit_limit"] = info.RateLimit.Limit
+	}
+	activeLogger.log("debug", "http request", fields)
+}
+
+// traceBodyLimit caps the bytes of each body that --trace prints.
+const traceBodyLimit = 2048
+
+// logTrace is the client's OnTrace hook for --trace: each HTTP exchange with
+// its headers, timing and truncated bodies, as "> " request and "< " response
+// lines like curl -v, or as one JSON event. The client has already masked
+// credentials; --redact masks customer data on top.
+func logTrace(trace pingen.Trace) {
+	requestBody := traceBody(trace.RequestHeader.Get("Content-Type"), trace.RequestBody)
+	responseBody := traceBody(trace.ResponseHeader.Get("Content-Type"), trace.ResponseBody)
+	if activeLogger.traceFormat == "json" {
+		fields := map[string]any{
+			"method":          trace.Method,
+			"url":             redactText(trace.URL),
+			"duration_ms":     trace.Duration.Milliseconds(),
+			"request_headers": traceHeaders(trace.RequestHeader),
+		}
+		if requestBody != "" {
+			fields["request_body"] = requestBody
+		} else if trace.RequestSize > 0 {
+			fields["request_size"] = trace.RequestSize
+		}
+		if trace.Err != nil {
+			fields["error"] = redactText(trace.Err.Error())
+		} else {
+			fields["status"] = trace.Status
+			fields["response_headers"] = traceHeaders(trace.ResponseHeader)
+			if responseBody != "" {
+				fields["response_body"] = responseBody
+			}
+		}
+		activeLogger.logJSON("debug", "http exchange", fields)
+		return
+	}
+	lines := []string{fmt.Sprintf("> %s %s", trace.Method, redactText(trace.URL))}
+	lines = append(lines, traceHeaderLines("> ", trace.RequestHeader)...)
+	if requestBody != "" {
+		lines = append(lines, ">", "> "+requestBody)
+	} else if trace.RequestSize > 0 {
+		lines = append(lines, ">", fmt.Sprintf("> [%s not shown]", pingen.FormatSize(trace.RequestSize)))
+	}
+	if trace.Err != nil {
+		lines = append(lines, fmt.Sprintf("< failed after %dms: %s", trace.Duration.Milliseconds(), redactText(trace.Err.Error())))
+	} else {
+		lines = append(lines, fmt.Sprintf("< %d %s (%dms)", trace.Status, http.StatusText(trace.Status), trace.Duration.Milliseconds()))
+		lines = append(lines, traceHeaderLines("< ", trace.ResponseHeader)...)
+		if responseBody != "" {
+			lines = append(lines, "<", "< "+responseBody)
+		}
+	}
+	activeLogger.log("debug", strings.Join(lines, "\n"), nil)
+}
+
+// traceBody returns a body for --trace, redacted and cut to traceBodyLimit.
+func traceBody(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if activeRedactor != nil && strings.Contains(contentType, "json") {
+		var value any
+		if json.Unmarshal(body, &value) == nil {
+			if encoded, err := json.Marshal(redactPayload(value)); err == nil {
+				body = encoded
+			}
+		}
+	}
+	text := redactText(string(body))
+	if len(text) > traceBodyLimit {
+		text = strings.ToValidUTF8(text[:traceBodyLimit], "") + fmt.Sprintf("... (%d more bytes)", len(text)-traceBodyLimit)
+	}
+	return text
+}
+
+func traceHeaders(header http.Header) map[string]string {
+	headers := map[string]string{}
+	for name, values := range header {
+		headers[name] = redactText(strings.Join(values, ", "))
+	}
+	return headers
+}
+
+func traceHeaderLines(prefix string, header http.Header) []string {
+	headers := traceHeaders(header)
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		lines = append(lines, prefix+name+": "+headers[name])
+	}
+	return lines
+}
+
+// logRetry warns that a failed request is repeated after a wait.
+func logRetry(info pingen.RetryInfo) {
+	reason := fmt.Sprintf("HTTP %d", info.Status)
+	if info.Err != nil {
+		reason = redactText(info.Err.Error())
+	}
+	if !activeLogger.jsonFormat() {
+		activeLogger.log("warn", fmt.Sprintf("%s %s failed (%s), retrying in %s (%d/%d)", info.Method, info.URL, reason, info.Wait.Round(100*time.Millisecond), info.Attempt, info.Retries), nil)
+		return
+	}
+	activeLogger.log("warn", "retrying request", map[string]any{
+		"method":  info.Method,
+		"url":     info.URL,
+		"reason":  reason,
+		"wait_ms": info.Wait.Milliseconds(),
+		"attempt": info.Attempt,
+		"retries": info.Retries,
+	})
+}
+
+// logPace reports that a request is held back to stay within the rate
+// limit. Waiting for the limit to reset is worth an info event; the short
+// pauses that spread the last requests are debug events.
+func logPace(wait time.Duration, limit pingen.RateLimit) {
+	level := "debug"
+	if limit.Remaining == 0 {
+		level = "info"
+	}
+	if !activeLogger.jsonFormat() {
+		activeLogger.log(level, fmt.Sprintf("rate limit: %d of %d requests left until %s, waiting %s", limit.Remaining, limit.Limit, limit.Reset.Format("15:04:05"), wait.Round(100*time.Millisecond)), nil)
+		return
+	}
+	activeLogger.log(level, "pacing requests", map[string]any{
+		"rate_limit_remaining": limit.Remaining,
+		"rate_limit_limit":     limit.Limit,
+		"rate_limit_reset":     limit.Reset.UTC().Format(time.RFC3339),
+		"wait_ms":              wait.Milliseconds(),
+	})
+}
+
+// logFinished records the end of the command with its exit code and duration.
+func logFinished(exitCode int) {
+	duration := time.Since(activeLogger.start)
+	if !activeLogger.jsonFormat() {
+		activeLogger.log("debug", fmt.Sprintf("finished with exit code %d in %dms", exitCode, duration.Milliseconds()), nil)
+		return
+	}
+	activeLogger.log("debug", "finished", map[string]any{
+		"exit_code":   exitCode,
+		"duration_ms": duration.Milliseconds(),
+	})
+}
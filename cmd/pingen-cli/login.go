@@ -0,0 +1,233 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// loginCallback is what the browser brings back to the local callback server.
+type loginCallback struct {
+	code string
+	err  error
+}
+
+// handleAuthLogin runs the OAuth authorization-code flow with PKCE: the user
+// logs in in the browser, the identity server redirects to a callback server
+// on 127.0.0.1, and the code is exchanged for an access and a refresh token
+// that are saved in the config. ensureAccessToken renews the access token
+// with the refresh token from then on, so user-scoped commands keep working
+// without client credentials.
+func handleAuthLogin(ctx appContext, args []string) int {
+	fs := flag.NewFlagSet("auth login", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	scope := fs.String("scope", defaultScope, "OAuth scope")
+	port := fs.Int("port", 0, "Port of the local callback server (0: any free port); must match the redirect URI registered for the client")
+	noBrowser := fs.Bool("no-browser", false, "Print the login URL instead of opening a browser")
+	maxWait := fs.Duration("max-wait", 5*time.Minute, "Give up when the login is not completed within this time")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli auth login [--scope ...] [--port n] [--no-browser] [--max-wait 5m]")
+		return 0
+	}
+	if ctx.settings.ClientID == "" {
+		printErrorCode("PINGEN-AUTH-001", "client id required (use --client-id or PINGEN_CLIENT_ID)")
+		return 2
+	}
+	if *port < 0 || *port > 65535 {
+		printErrorCode("PINGEN-INPUT-001", "--port must be between 0 and 65535")
+		return 2
+	}
+	verifier, challenge, err := pingen.NewPKCE()
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	state, err := pingen.NewOAuthState()
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", *port))
+	if err != nil {
+		reportError(ctx, codedErrorf("PINGEN-AUTH-005", "failed to start the login callback server: %w", err))
+		return 1
+	}
+	redirectURI := fmt.Sprintf("http://127.0.0.1:%d/callback", listener.Addr().(*net.TCPAddr).Port)
+
+	callbacks := make(chan loginCallback, 1)
+	server := &http.Server{Handler: loginCallbackHandler(state, callbacks), ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(listener)
+	defer server.Close()
+
+	var stopSignals func()
+	ctx.jobContext, stopSignals = handleSignals(ctx.jobContext)
+	defer stopSignals()
+	client := newClient(ctx, "")
+	authorizeURL := client.AuthorizeURL(ctx.settings.ClientID, redirectURI, *scope, state, challenge)
+	fmt.Fprintf(os.Stderr, "Log in to Pingen in your browser:\n  %s\n", authorizeURL)
+	if !*noBrowser {
+		if err := openBrowser(authorizeURL); err != nil {
+			logf("warn", "could not open a browser (%s); open the URL above manually", err.Error())
+		}
+	}
+	fmt.Fprintln(os.Stderr, "Waiting for the login to complete...")
+
+	var callback loginCallback
+	select {
+	case callback = <-callbacks:
+	case <-time.After(*maxWait):
+		printErrorCode("PINGEN-AUTH-005", fmt.Sprintf("login timed out after %s", *maxWait))
+		return 1
+	case <-ctx.jobContext.Done():
+		if interrupted(ctx) {
+			printErrorCode("PINGEN-NET-003", "interrupted before the login completed")
+			return exitInterrupted
+		}
+		printErrorCode("PINGEN-NET-002", fmt.Sprintf("deadline exceeded after %s before the login completed", ctx.global.deadline))
+		return 1
+	}
+	if callback.err != nil {
+		reportError(ctx, callback.err)
+		return 1
+	}
+
+	payload, headers, err := client.ExchangeCodeRaw(ctx.jobContext, ctx.settings.ClientID, ctx.settings.ClientSecret, callback.code, redirectURI, verifier)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	var tokens pingen.TokenResponse
+	if err := pingen.Decode(payload, &tokens); err != nil || tokens.AccessToken == "" {
+		printErrorCode("PINGEN-AUTH-002", "access token missing in response")
+		return 1
+	}
+	cfg, _, _ := loadConfig(ctx.configPath)
+	cfg.Env = ctx.settings.Env
+	cfg.APIBase = ctx.settings.APIBase
+	cfg.IdentityBase = ctx.settings.IdentityBase
+	cfg.ClientID = ctx.settings.ClientID
+	cacheToken(&cfg, tokens, *scope)
+	if err := saveConfig(ctx, cfg); err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	result := map[string]any{
+		"logged_in":     true,
+		"scope":         cfg.AccessTokenScope,
+		"expires_at":    time.Unix(cfg.AccessTokenExpiresAt, 0).UTC().Format(time.RFC3339),
+		"refresh_token": cfg.RefreshToken != "",
+	}
+	if cfg.AccessTokenExpiresAt == 0 {
+		result["expires_at"] = nil
+	}
+	return emitPayload(ctx, result, headers, func() {
+		if cfg.RefreshToken == "" {
+			fmt.Println("Logged in. No refresh token was issued, so run `pingen-cli auth login` again when the access token expires.")
+			return
+		}
+		fmt.Println("Logged in. The access token is renewed automatically with the saved refresh token.")
+	})
+}
+
+// loginCallbackHandler accepts the redirect from the identity server once,
+// checks its state and passes the code or error on.
+func loginCallbackHandler(state string, callbacks chan<- loginCallback) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		var result loginCallback
+		switch {
+		case query.Get("state") != state:
+			http.Error(w, "Invalid login state. Start again with pingen-cli auth login.", http.StatusBadRequest)
+			return
+		case query.Get("error") != "":
+			message := query.Get("error")
+			if description := query.Get("error_description"); description != "" {
+				message += ": " + description
+			}
+			result.err = codedErrorf("PINGEN-AUTH-005", "login failed: %s", message)
+		case query.Get("code") == "":
+			result.err = codedErrorf("PINGEN-AUTH-005", "login failed: no authorization code in the callback")
+		default:
+			result.code = query.Get("code")
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if result.err != nil {
+			fmt.Fprintf(w, "<p>%s</p>", html.EscapeString(result.err.Error()))
+		} else {
+			fmt.Fprint(w, "<p>Login complete. You can close this window and return to the terminal.</p>")
+		}
+		select {
+		case callbacks <- result:
+		default:
+		}
+	})
+	return mux
+}
+
+// openBrowser opens url in the default browser.
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
+
+// cacheToken stores the access token of a token response in cfg, with its
+// scope and expiry, and the refresh token if the response carries one.
+func cacheToken(cfg *pingen.Config, tokens pingen.TokenResponse, scope string) {
+	cfg.AccessToken = tokens.AccessToken
+	cfg.AccessTokenScope = scope
+	if tokens.Scope != "" {
+		cfg.AccessTokenScope = tokens.Scope
+	}
+	cfg.AccessTokenExpiresAt = 0
+	if expiresAt := tokens.ExpiresAt(time.Now()); !expiresAt.IsZero() {
+		cfg.AccessTokenExpiresAt = expiresAt.Unix()
+	}
+	if tokens.RefreshToken != "" {
+		cfg.RefreshToken = tokens.RefreshToken
+	}
+}
+
+// refreshAccessToken renews the access token with the refresh token saved by
+// auth login and caches the result like ensureAccessToken does.
+func refreshAccessToken(ctx *appContext) (string, error) {
+	client := newClient(*ctx, "")
+	payload, _, err := client.RefreshAccessTokenRaw(ctx.jobContext, ctx.settings.ClientID, ctx.settings.ClientSecret, ctx.settings.RefreshToken)
+	if err != nil {
+		return "", err
+	}
+	var tokens pingen.TokenResponse
+	if err := pingen.Decode(payload, &tokens); err != nil || tokens.AccessToken == "" {
+		return "", codedErrorf("PINGEN-AUTH-002", "access token missing in response")
+	}
+	verbosef(*ctx, "renewed the access token with the refresh token")
+	cacheToken(&ctx.settings, tokens, ctx.settings.AccessTokenScope)
+	if ctx.configLoaded {
+		cfg, _, _ := loadConfig(ctx.configPath)
+		cacheToken(&cfg, tokens, ctx.settings.AccessTokenScope)
+		if err := saveConfig(*ctx, cfg); err != nil {
+			logf("warn", "token not cached: %v", err)
+		}
+	}
+	return tokens.AccessToken, nil
+}
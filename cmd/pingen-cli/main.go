@@ -1,15 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"pingen-cli/internal/pingen"
+	"github.com/tobiasbischoff/pingen-cli/pingen"
 )
 
 const version = "0.1.0"
@@ -26,30 +31,140 @@ func run(args []string) int {
 	if !ok {
 		return 2
 	}
+	if global.redact {
+		enableRedaction()
+	}
+	if !isAllowed(global.logFormat, logFormats) {
+		printErrorCode("PINGEN-INPUT-001", "invalid --log-format (use text or json)")
+		return 2
+	}
+	if global.logLevel != "" && !isAllowed(global.logLevel, logLevels) {
+		printErrorCode("PINGEN-INPUT-001", "invalid --log-level (use debug, info, warn or error)")
+		return 2
+	}
+	if global.traceFormat != "" && !isAllowed(global.traceFormat, logFormats) {
+		printErrorCode("PINGEN-INPUT-001", "invalid --trace-format (use text or json)")
+		return 2
+	}
+	if global.ci != "" && !isAllowed(global.ci, ciProviders) {
+		printErrorCode("PINGEN-INPUT-001", "invalid --ci (use github or gitlab)")
+		return 2
+	}
+	if global.tlsMinVersion != "" && !isAllowed(global.tlsMinVersion, []string{"1.2", "1.3"}) {
+		printErrorCode("PINGEN-INPUT-001", "invalid --tls-min-version (use 1.2 or 1.3)")
+		return 2
+	}
+	if global.retries < 0 {
+		printErrorCode("PINGEN-INPUT-001", "--retries must be at least 0")
+		return 2
+	}
+	switch global.output {
+	case "":
+	case "plain":
+		global.plain = true
+	case "json":
+		global.jsonOutput = true
+	case "table":
+		global.plain = true
+		global.tableOutput = true
+	default:
+		printErrorCode("PINGEN-INPUT-001", "invalid --output (use plain, json or table)")
+		return 2
+	}
+	jsonErrors = global.jsonOutput && !global.plain
+	if global.query != "" {
+		if global.tableOutput || len(global.columns) > 0 || global.templateName != "" {
+			printErrorCode("PINGEN-INPUT-001", "--query cannot be combined with --output table, --columns or --template-name")
+			return 2
+		}
+		expr, err := compileQuery(global.query)
+		if err != nil {
+			printErrorCode("PINGEN-INPUT-001", fmt.Sprintf("invalid --query: %s", strings.TrimPrefix(err.Error(), "invalid query: ")))
+			return 2
+		}
+		// The query works on the JSON output, so commands print it even
+		// without --json.
+		activeQuery = &outputQuery{expr: expr, raw: !global.jsonOutput || global.plain}
+		global.jsonOutput, global.plain = true, false
+	}
+	transport, err := pingen.NewTransport(pingen.TransportOptions{CAFile: global.caCert, MinTLSVersion: global.tlsMinVersion})
+	if err != nil {
+		printErrorCode("PINGEN-INPUT-001", fmt.Sprintf("failed to load --ca-cert: %v", err))
+		return 2
+	}
+	closeLog, err := configureLogging(global, commandName(subcommand, subargs))
+	if err != nil {
+		printErrorCode("PINGEN-OUTPUT-001", fmt.Sprintf("failed to open --log-file: %v", err))
+		return 1
+	}
+	defer closeLog()
 	if global.showVersion {
 		fmt.Printf("pingen-cli %s\n", version)
+		if global.checkUpdate {
+			return handleCheckUpdate(transport, time.Duration(global.timeout)*time.Second)
+		}
 		return 0
 	}
+	if global.explain != "" {
+		return handleExplain([]string{global.explain})
+	}
+	if global.checkUpdate && subcommand == "" {
+		return handleCheckUpdate(transport, time.Duration(global.timeout)*time.Second)
+	}
 	if subcommand == "" {
 		printUsage()
 		return 2
 	}
+	if subcommand == "completion" {
+		return handleCompletion(subargs)
+	}
 
 	if global.plain {
 		global.jsonOutput = false
 	}
 
-	configPath, err := pingen.ConfigPath()
-	if err != nil {
-		printError("failed to resolve config path", 0, "")
-		return 1
+	configPath := global.configFile
+	if configPath == "" {
+		configPath, err = pingen.ConfigPath()
+		if err != nil {
+			printErrorCode("PINGEN-CONFIG-001", "failed to resolve config path")
+			return 1
+		}
 	}
 
 	cfg, cfgExists, cfgErr := pingen.LoadConfig(configPath)
 	if cfgErr != nil && !errors.Is(cfgErr, os.ErrNotExist) {
-		printError("failed to load config", 0, "")
+		printErrorCode("PINGEN-CONFIG-002", "failed to load config")
 		return 1
 	}
+	fixingPermissions := subcommand == "config" && len(subargs) > 0 && subargs[0] == "fix-permissions"
+	if cfgExists && !fixingPermissions {
+		warnConfigPermissions(configPath, cfg)
+	}
+	if len(cfg.KeychainSecrets) > 0 {
+		cfg = withKeychainSecrets(configPath, cfg)
+	}
+
+	// A project config found from the working directory overrides the user
+	// config; the environment and flags override both.
+	projectPath := ""
+	if cwd, err := os.Getwd(); err == nil {
+		projectPath = pingen.FindProjectConfig(cwd)
+	}
+	if projectPath != "" && sameFile(projectPath, configPath) {
+		projectPath = ""
+	}
+	if projectPath != "" {
+		project, ignored, err := pingen.LoadProjectConfig(projectPath)
+		if err != nil {
+			printErrorCode("PINGEN-CONFIG-002", fmt.Sprintf("failed to load project config: %v", err))
+			return 1
+		}
+		if len(ignored) > 0 && subcommand != "__complete" {
+			logf("warn", "%s: ignored %s (not allowed in a project config)", projectPath, strings.Join(ignored, ", "))
+		}
+		cfg = pingen.MergeConfig(cfg, project)
+	}
 
 	envCfg := configFromEnv()
 	cliCfg := configFromGlobal(global)
@@ -59,7 +174,7 @@ func run(args []string) int {
 	if global.clientSecretFile != "" {
 		secret, err := os.ReadFile(global.clientSecretFile)
 		if err != nil {
-			printError("failed to read client secret file", 0, "")
+			printErrorCode("PINGEN-AUTH-003", "failed to read client secret file")
 			return 1
 		}
 		settings.ClientSecret = strings.TrimSpace(string(secret))
@@ -69,7 +184,7 @@ func run(args []string) int {
 		settings.Env = "staging"
 	}
 	if settings.Env != "staging" && settings.Env != "production" {
-		printError("invalid env (use staging or production)", 0, "")
+		printErrorCode("PINGEN-CONFIG-004", "invalid env (use staging or production)")
 		return 2
 	}
 	settings = applyDefaultBases(settings)
@@ -78,9 +193,53 @@ func run(args []string) int {
 		global:       global,
 		configPath:   configPath,
 		configLoaded: cfgExists,
+		projectPath:  projectPath,
 		settings:     settings,
+		jobContext:   context.Background(),
+	}
+	if global.deadline > 0 {
+		var cancel context.CancelFunc
+		ctx.jobContext, cancel = context.WithTimeout(ctx.jobContext, global.deadline)
+		defer cancel()
+		defer enforceDeadline(global.deadline)()
+	}
+	if global.limitRate > 0 {
+		ctx.uploadLimit = pingen.NewTokenBucket(global.limitRate)
+	}
+	ctx.transport = transport
+	ctx.pacer = pingen.NewRatePacer()
+	ctx.pacer.OnWait = logPace
+	if settings.Timezone != "" {
+		loc, err := loadLocation(settings.Timezone)
+		if err != nil {
+			reportError(ctx, err)
+			return 2
+		}
+		ctx.location = loc
+	}
+	if subcommand != "__complete" {
+		defer startUpdateCheck(ctx)()
 	}
+	if global.tee != "" && subcommand != "__complete" {
+		stopTee, err := startTee(global.tee, global.teeAppend)
+		if err != nil {
+			printErrorCode("PINGEN-OUTPUT-001", fmt.Sprintf("failed to open --tee file: %v", err))
+			return 1
+		}
+		defer stopTee()
+	}
+
+	exitCode := dispatch(ctx, subcommand, subargs)
+	if exitCode != 0 && ctx.jobContext.Err() == context.DeadlineExceeded {
+		exitCode = exitDeadline
+	} else if exitCode == 1 {
+		exitCode = exitCodeFor(lastErrorCode)
+	}
+	logFinished(exitCode)
+	return exitCode
+}
 
+func dispatch(ctx appContext, subcommand string, subargs []string) int {
 	switch subcommand {
 	case "auth":
 		return handleAuth(ctx, subargs)
@@ -88,8 +247,52 @@ func run(args []string) int {
 		return handleConfig(ctx, subargs)
 	case "org":
 		return handleOrg(ctx, subargs)
+	case "users":
+		return handleUsers(ctx, subargs)
+	case "products":
+		return handleProducts(ctx, subargs)
+	case "associations":
+		return handleAssociations(ctx, subargs)
 	case "letters":
 		return handleLetters(ctx, subargs)
+	case "filters":
+		return handleFilters(ctx, subargs)
+	case "output-templates":
+		return handleOutputTemplates(ctx, subargs)
+	case "limits", "ratelimit":
+		return handleRateLimit(ctx, subargs)
+	case "purge":
+		return handlePurge(ctx, subargs)
+	case "init":
+		return handleInit(ctx, subargs)
+	case "doctor":
+		return handleDoctor(ctx, subargs)
+	case "templates":
+		return handleTemplates(ctx, subargs)
+	case "contacts":
+		return handleContacts(ctx, subargs)
+	case "events":
+		return handleEvents(ctx, subargs)
+	case "webhooks":
+		return handleWebhooks(ctx, subargs)
+	case "watch":
+		return handleWatch(ctx, subargs)
+	case "queue":
+		return handleQueue(ctx, subargs)
+	case "journal":
+		return handleJournal(ctx, subargs)
+	case "schedule":
+		return handleSchedule(ctx, subargs)
+	case "export":
+		return handleExport(ctx, subargs)
+	case "import":
+		return handleImport(ctx, subargs)
+	case "batches":
+		return handleBatches(ctx, subargs)
+	case "explain":
+		return handleExplain(subargs)
+	case "__complete":
+		return handleComplete(ctx, subargs)
 	default:
 		printUsage()
 		return 2
@@ -99,6 +302,8 @@ func run(args []string) int {
 type globalOptions struct {
 	showHelp         bool
 	showVersion      bool
+	configFile       string
+	checkUpdate      bool
 	env              string
 	apiBase          string
 	identityBase     string
@@ -108,11 +313,36 @@ type globalOptions struct {
 	clientSecret     string
 	clientSecretFile string
 	timeout          int
+	retries          int
+	retryMaxWait     time.Duration
 	jsonOutput       bool
 	plain            bool
+	output           string
+	tableOutput      bool
+	columns          []string
+	query            string
 	quiet            bool
 	verbose          bool
+	trace            bool
+	traceFormat      string
 	dryRun           bool
+	templateName     string
+	explain          string
+	includeHeaders   bool
+	timezone         string
+	limitRate        int64
+	deadline         time.Duration
+	tee              string
+	teeAppend        bool
+	redact           bool
+	force            bool
+	headers          map[string]string
+	caCert           string
+	tlsMinVersion    string
+	logFormat        string
+	logLevel         string
+	logFile          string
+	ci               string
 }
 
 type appContext struct {
@@ -120,15 +350,35 @@ type appContext struct {
 	configPath   string
 	configLoaded bool
 	settings     pingen.Config
+	location     *time.Location
+	uploadLimit  *pingen.TokenBucket
+	// transport is shared by all clients, so that they reuse connections.
+	transport *http.Transport
+	// pacer is shared by all clients, so that concurrent requests slow down
+	// together when the rate limit is nearly used up.
+	pacer *pingen.RatePacer
+	// scope lists OAuth scopes a command needs on top of defaultScope, such
+	// as "user" for the users and associations commands.
+	scope string
+	// jobContext is cancelled when --deadline expires.
+	jobContext context.Context
+	// projectPath is the project config (.pingen.json or .pingen.yaml)
+	// merged over the config at configPath, or "".
+	projectPath string
+	// journalID is the journal entry a letters create or send run is
+	// recorded under; see runJournaled.
+	journalID string
 }
 
 func parseGlobal(args []string) (globalOptions, string, []string, bool) {
-	global := globalOptions{}
+	global := globalOptions{headers: map[string]string{}}
 	fs := flag.NewFlagSet("pingen-cli", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
 	fs.BoolVar(&global.showHelp, "help", false, "show help")
 	fs.BoolVar(&global.showHelp, "h", false, "show help")
 	fs.BoolVar(&global.showVersion, "version", false, "show version")
+	fs.BoolVar(&global.checkUpdate, "check-update", false, "Check GitHub for a newer release")
+	fs.StringVar(&global.configFile, "config", "", "Config file to use instead of the default location (or PINGEN_CONFIG_PATH)")
 	fs.StringVar(&global.env, "env", "", "API environment (default: staging)")
 	fs.StringVar(&global.apiBase, "api-base", "", "Override API base URL")
 	fs.StringVar(&global.identityBase, "identity-base", "", "Override identity base URL")
@@ -138,11 +388,46 @@ func parseGlobal(args []string) (globalOptions, string, []string, bool) {
 	fs.StringVar(&global.clientSecret, "client-secret", "", "OAuth client secret (prefer env/file over flags)")
 	fs.StringVar(&global.clientSecretFile, "client-secret-file", "", "Read client secret from file")
 	fs.IntVar(&global.timeout, "timeout", 30, "HTTP timeout seconds (default: 30)")
+	fs.IntVar(&global.retries, "retries", 3, "Retry rate-limited (429), failed (5xx) and interrupted requests this often; 0 disables")
+	fs.DurationVar(&global.retryMaxWait, "retry-max-wait", 30*time.Second, "Longest wait before a retry, even if Retry-After asks for more")
 	fs.BoolVar(&global.jsonOutput, "json", false, "Output JSON")
 	fs.BoolVar(&global.plain, "plain", false, "Output plain text (default)")
+	fs.StringVar(&global.output, "output", "", "Output format: plain, json or table")
+	fs.Func("columns", "Comma-separated field paths to print, e.g. id,status,created_at", func(value string) error {
+		global.columns = splitColumns(value)
+		return nil
+	})
+	fs.StringVar(&global.query, "query", "", "Print only this part of the JSON output, e.g. 'data[].attributes.status'")
 	fs.BoolVar(&global.quiet, "quiet", false, "Suppress non-essential output")
 	fs.BoolVar(&global.verbose, "verbose", false, "Verbose output")
+	fs.StringVar(&global.logFormat, "log-format", "text", "Format of messages on stderr and in --log-file: text or json")
+	fs.StringVar(&global.logLevel, "log-level", "", "Least severe events to log: debug, info, warn or error (default: info, debug with --verbose; the log file gets debug)")
+	fs.StringVar(&global.logFile, "log-file", "", "Also append log events, including --verbose ones unless --log-level is higher, to this file")
+	fs.BoolVar(&global.trace, "trace", false, "Log every HTTP request and response with headers and bodies; implies --verbose")
+	fs.StringVar(&global.traceFormat, "trace-format", "", "Format of --trace events: text or json (default: --log-format)")
+	fs.StringVar(&global.ci, "ci", "", "Emit annotations and log sections for a CI provider: github or gitlab")
 	fs.BoolVar(&global.dryRun, "dry-run", false, "Preview actions without sending")
+	fs.BoolVar(&global.force, "force", false, "Write secrets to the config even if its directory is writable by others")
+	fs.BoolVar(&global.redact, "redact", false, "Mask recipient data, file names and metadata in traces, dry-run output and errors")
+	fs.StringVar(&global.templateName, "template-name", "", "Render output with a saved output template")
+	fs.StringVar(&global.explain, "explain", "", "Explain an error code and exit")
+	fs.Func("limit-rate", "Cap upload bandwidth in bytes per second (e.g. 500K, 2M)", func(value string) error {
+		rate, err := pingen.ParseRate(value)
+		global.limitRate = rate
+		return err
+	})
+	fs.DurationVar(&global.deadline, "deadline", 0, "Abort the whole invocation after this duration (e.g. 15m), across all requests")
+	fs.StringVar(&global.tee, "tee", "", "Also write the command's output to this file")
+	fs.BoolVar(&global.teeAppend, "tee-append", false, "Append to the --tee file instead of replacing it")
+	fs.StringVar(&global.timezone, "tz", "", "Timezone for date inputs and timestamps (e.g. Europe/Zurich)")
+	fs.Func("header", "Add a header to every API request ('Name: value' or Name=value, repeatable)", func(value string) error {
+		name, headerValue, err := pingen.ParseHeader(value)
+		global.headers[name] = headerValue
+		return err
+	})
+	fs.StringVar(&global.caCert, "ca-cert", "", "PEM file of CA certificates to trust in addition to the system roots, e.g. of a TLS-intercepting proxy")
+	fs.StringVar(&global.tlsMinVersion, "tls-min-version", "", "Oldest TLS version to accept: 1.2 (default) or 1.3")
+	fs.BoolVar(&global.includeHeaders, "include-headers", false, "Include request id, rate-limit and Location headers in JSON output")
 
 	if err := fs.Parse(args); err != nil {
 		return global, "", nil, false
@@ -166,16 +451,88 @@ Usage:
 
 Commands:
   auth token         Fetch an access token
+  auth login         Log in in the browser (OAuth with PKCE) and save a refresh token
+  auth status        Show the active credentials, where they come from and the token scopes
+  auth revoke        Remove the stored tokens (--credentials: also the client id and secret)
   config show        Show config
   config set         Set config value
   config unset       Unset config value
   org list           List organisations
+  org get            Show an organisation (default: the current one)
+  org use            Make an organisation (id or name) the default in the config
+  org settings get   Show organisation defaults (retention, address position, billing)
+  org settings set   Change organisation settings (key=value, e.g. data_retention_pdf=6)
+  products list      List delivery products with countries, delivery time and starting price
+  users list         List the members of the organisation with role and status
+  users get          Show a member (id or email), or the user the token belongs to
+  users invite       Invite a user to the organisation (--email, --role; --resend)
+  users remove       Remove a member by blocking their access (--unblock restores it)
+  users set-role     Change the role of a member (--role owner|manager)
+  associations list  List the organisations of the current user with role and status
   letters list       List letters
+  letters browse     Browse letters in a terminal UI with live status, send, cancel and download
   letters get        Get a letter
   letters create     Create a letter
-  letters send       Send a letter
+  letters bulk-create  Create letters from a CSV, XLSX, JSONL or YAML manifest
+  letters send       Send a letter (--at queues it for later)
+  letters submit     Upload, validate and send a PDF in one step (--rollback deletes it on failure)
+  letters delete     Delete a letter that has not been submitted
+  letters cancel     Cancel a submitted letter before it is printed
+  letters edit       Change attributes of a letter not yet submitted (--attr, --json-patch)
+  letters restore    Restore the uploaded PDF of a letter in action_required and validate it again
+  letters download   Download letter PDFs with a manifest
+  letters events     Show the delivery history of a letter
+  letters wait       Wait until a letter has validated or reached a state (--until)
+  letters receipts   Download registered-mail receipts (event images)
+  letters diff       Compare the attributes and meta of two letters
+  letters estimate   Price a letter, or compare all products with --compare
+  letters price      Same as letters estimate
+  letters merge            Create one personalized letter per CSV/XLSX row from a template
+  letters compose          Prepend an address page to a PDF and create the letter
+  letters check            Check a PDF (format, size, pages) before uploading it
+  letters inspect-address  Show the recipient found in a PDF's address window
+  letters check-qr-bill    Check the placement and data of a QR-bill payment part
+  letters reconcile  Compare a manifest of expected letters with those in Pingen
+  letters duplicates Find letters that were probably submitted twice
+  batches create     Create a batch from a PDF to split or a ZIP of PDFs
+  batches list       List batches
+  batches get        Get a batch
+  batches add-attachment  Append a PDF to every letter of a batch
+  batches send       Send every letter of a batch
+  batches cancel     Cancel the letters of a batch not printed yet
+  export archive     Write an audit archive: PDF, letter JSON and events per letter
+  export dump        Back up letters, batches and webhooks as JSONL (incremental)
+  import letters     Re-create the letters of an export dump as drafts
+  events stream      Poll letter or batch events and print them as NDJSON
+  watch              Poll a resource until a query expression is true
+  webhooks create    Register a webhook for one event category
+  webhooks listen    Receive Pingen webhooks locally, verify them and print or --exec them
+  queue list         List queued jobs with status, attempts and next run
+  queue show         Show a queued job
+  queue cancel       Cancel a pending job
+  queue retry        Requeue a failed or cancelled job
+  queue flush        Run queued jobs now (--due: only those whose time has come)
+  queue daemon       Run queued jobs when they are due
+  journal list       List letters create/send runs with their idempotency keys
+  journal show       Show a journal entry
+  journal retry      Repeat an interrupted or failed run with the same idempotency key
+  schedule           Add/list/remove recurring jobs (cron syntax); schedule run is the daemon
+  filters save       Save a named filter preset
+  filters list       List filter presets
+  filters show       Show a filter preset
+  filters delete     Delete a filter preset
+  output-templates   Save/list/delete output templates
+  templates          Save/list/show/delete letter templates (letters create --from-template)
+  contacts           Add/import/list/show/remove address book entries (--recipient/--sender)
+  limits             Show the API rate limit: requests left and when it resets
+  init               Interactively create the config and verify access
+  doctor             Check connectivity, credentials and config
+  purge              Securely delete local caches, journals and tokens
+  explain [code]     Explain an error code (lists all codes without one)
+  completion         Print shell completion script (bash/zsh/fish)
 
 Global flags:
+  --config <path>
   --env <production|staging>
   --api-base <url>
   --identity-base <url>
@@ -185,15 +542,46 @@ Global flags:
   --client-secret <secret>
   --client-secret-file <path>
   --timeout <seconds>
-  --json | --plain
+  --retries <n> [--retry-max-wait <duration>]
+  --deadline <duration>
+  --tz <zone>
+  --limit-rate <rate>
+  --json | --plain | --output <plain|json|table>
+  --columns <fields>
+  --query <expression>
+  --tee <path> [--tee-append]
+  --include-headers
+  --header 'Name: value' | Name=value (repeatable)
+  --ca-cert <path> [--tls-min-version <1.2|1.3>]
   --quiet | --verbose
+  --trace [--trace-format <text|json>]
+  --log-format <text|json>
+  --log-level <debug|info|warn|error>
+  --log-file <path>
+  --ci <github|gitlab>
+  --redact
+  --force
   --dry-run
+  --template-name <name>
+  --explain <code>
   -h, --help
-  --version
+  --version [--check-update]
+
+Exit codes:
+  0 success, 1 other failure, 2 usage or validation error, 3 auth failure,
+  4 not found, 5 rate limited, 6 server error, 7 network error,
+  124 --deadline expired, 130 interrupted
 
 Use "pingen-cli <command> --help" for command-specific options.`)
 }
 
+// sameFile reports whether a and b name the same existing file.
+func sameFile(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
+
 func configFromEnv() pingen.Config {
 	cfg := pingen.Config{}
 	if value := os.Getenv("PINGEN_ENV"); value != "" {
@@ -217,6 +605,12 @@ func configFromEnv() pingen.Config {
 	if value := os.Getenv("PINGEN_CLIENT_SECRET"); value != "" {
 		cfg.ClientSecret = value
 	}
+	if value := os.Getenv("PINGEN_TZ"); value != "" {
+		cfg.Timezone = value
+	}
+	if value := os.Getenv("PINGEN_CONTACTS_FILE"); value != "" {
+		cfg.ContactsFile = value
+	}
 	return cfg
 }
 
@@ -229,6 +623,8 @@ func configFromGlobal(global globalOptions) pingen.Config {
 		AccessToken:    global.accessToken,
 		ClientID:       global.clientID,
 		ClientSecret:   global.clientSecret,
+		Timezone:       global.timezone,
+		Headers:        global.headers,
 	}
 }
 
@@ -252,23 +648,29 @@ func applyDefaultBases(cfg pingen.Config) pingen.Config {
 
 func handleConfig(ctx appContext, args []string) int {
 	if len(args) == 0 {
-		fmt.Println("config requires a subcommand (show/set/unset)")
+		fmt.Println("config requires a subcommand (show/set/unset/fix-permissions)")
 		return 2
 	}
 	switch args[0] {
 	case "show":
 		cfg, _, err := pingen.LoadConfig(ctx.configPath)
 		if err != nil && !errors.Is(err, os.ErrNotExist) {
-			printError("failed to load config", 0, "")
+			printErrorCode("PINGEN-CONFIG-002", "failed to load config")
 			return 1
 		}
 		return emitJSON(cfg)
+	case "fix-permissions":
+		return handleConfigFixPermissions(ctx)
 	case "set":
+		if len(args) == 2 && strings.Contains(args[1], "=") {
+			key, value, _ := strings.Cut(args[1], "=")
+			args = []string{args[0], key, value}
+		}
 		if len(args) < 3 {
 			fmt.Println("config set requires key and value")
 			return 2
 		}
-		cfg, _, _ := pingen.LoadConfig(ctx.configPath)
+		cfg, _, _ := loadConfig(ctx.configPath)
 		switch args[1] {
 		case "env":
 			cfg.Env = args[2]
@@ -284,12 +686,79 @@ func handleConfig(ctx appContext, args []string) int {
 			cfg.ClientID = args[2]
 		case "client_secret":
 			cfg.ClientSecret = args[2]
+		case "timezone":
+			if _, err := loadLocation(args[2]); err != nil {
+				fmt.Println(err.Error())
+				return 2
+			}
+			cfg.Timezone = args[2]
+		case "max_upload_size":
+			if _, err := pingen.ParseSize(args[2]); err != nil {
+				fmt.Println(err.Error())
+				return 2
+			}
+			cfg.MaxUploadSize = args[2]
+		case "max_pages":
+			pages, err := strconv.Atoi(args[2])
+			if err != nil || pages < 1 {
+				fmt.Println("max_pages must be a positive number")
+				return 2
+			}
+			cfg.MaxPages = pages
+		case "contacts_file":
+			cfg.ContactsFile = args[2]
+		case "disable_update_check":
+			disabled, err := strconv.ParseBool(args[2])
+			if err != nil {
+				fmt.Println("disable_update_check must be true or false")
+				return 2
+			}
+			cfg.DisableUpdateCheck = disabled
+		case "credential_store":
+			if args[2] != "keychain" && args[2] != "file" {
+				fmt.Println("credential_store must be keychain or file")
+				return 2
+			}
+			cfg.CredentialStore = args[2]
+			if args[2] == "keychain" {
+				cfg.CredentialStore = ""
+			}
 		default:
-			fmt.Printf("unknown config key: %s\n", args[1])
-			return 2
+			if strings.HasPrefix(args[1], "defaults.") {
+				command, name, err := parseDefaultKey(args[1])
+				if err != nil {
+					reportError(ctx, err)
+					return 2
+				}
+				if cfg.Defaults == nil {
+					cfg.Defaults = map[string]map[string]string{}
+				}
+				if cfg.Defaults[command] == nil {
+					cfg.Defaults[command] = map[string]string{}
+				}
+				cfg.Defaults[command][name] = args[2]
+				break
+			}
+			header, isHeader := strings.CutPrefix(args[1], "headers.")
+			if !isHeader {
+				fmt.Printf("unknown config key: %s\n", args[1])
+				return 2
+			}
+			name, value, err := pingen.ParseHeader(header + ": " + args[2])
+			if err != nil {
+				fmt.Println(err.Error())
+				return 2
+			}
+			if cfg.Headers == nil {
+				cfg.Headers = map[string]string{}
+			}
+			cfg.Headers[name] = value
 		}
-		if err := pingen.SaveConfig(ctx.configPath, cfg); err != nil {
-			printError("failed to save config", 0, "")
+		if ctx.global.dryRun {
+			return emitConfigPlan(ctx, "config.set", args[1], args[2])
+		}
+		if err := saveConfig(ctx, cfg); err != nil {
+			reportError(ctx, err)
 			return 1
 		}
 		if !ctx.global.quiet {
@@ -301,7 +770,7 @@ func handleConfig(ctx appContext, args []string) int {
 			fmt.Println("config unset requires key")
 			return 2
 		}
-		cfg, _, _ := pingen.LoadConfig(ctx.configPath)
+		cfg, _, _ := loadConfig(ctx.configPath)
 		switch args[1] {
 		case "env":
 			cfg.Env = ""
@@ -313,16 +782,54 @@ func handleConfig(ctx appContext, args []string) int {
 			cfg.OrganisationID = ""
 		case "access_token":
 			cfg.AccessToken = ""
+		case "refresh_token":
+			cfg.RefreshToken = ""
 		case "client_id":
 			cfg.ClientID = ""
 		case "client_secret":
 			cfg.ClientSecret = ""
+		case "timezone":
+			cfg.Timezone = ""
+		case "max_upload_size":
+			cfg.MaxUploadSize = ""
+		case "max_pages":
+			cfg.MaxPages = 0
+		case "contacts_file":
+			cfg.ContactsFile = ""
+		case "disable_update_check":
+			cfg.DisableUpdateCheck = false
+		case "credential_store":
+			cfg.CredentialStore = ""
 		default:
-			fmt.Printf("unknown config key: %s\n", args[1])
-			return 2
+			if strings.HasPrefix(args[1], "defaults.") {
+				command, name, err := parseDefaultKey(args[1])
+				if err != nil {
+					reportError(ctx, err)
+					return 2
+				}
+				delete(cfg.Defaults[command], name)
+				if len(cfg.Defaults[command]) == 0 {
+					delete(cfg.Defaults, command)
+				}
+				break
+			}
+			header, isHeader := strings.CutPrefix(args[1], "headers.")
+			if !isHeader {
+				fmt.Printf("unknown config key: %s\n", args[1])
+				return 2
+			}
+			name, _, err := pingen.ParseHeader(header + ":")
+			if err != nil {
+				fmt.Println(err.Error())
+				return 2
+			}
+			delete(cfg.Headers, name)
+		}
+		if ctx.global.dryRun {
+			return emitConfigPlan(ctx, "config.unset", args[1], nil)
 		}
-		if err := pingen.SaveConfig(ctx.configPath, cfg); err != nil {
-			printError("failed to save config", 0, "")
+		if err := saveConfig(ctx, cfg); err != nil {
+			reportError(ctx, err)
 			return 1
 		}
 		if !ctx.global.quiet {
@@ -340,6 +847,14 @@ func handleAuth(ctx appContext, args []string) int {
 		fmt.Println("auth requires a subcommand")
 		return 2
 	}
+	switch args[0] {
+	case "login":
+		return handleAuthLogin(ctx, args[1:])
+	case "status":
+		return handleAuthStatus(ctx, args[1:])
+	case "revoke":
+		return handleAuthRevoke(ctx, args[1:])
+	}
 	if args[0] != "token" {
 		fmt.Println("unknown auth subcommand")
 		return 2
@@ -350,7 +865,7 @@ func handleAuth(ctx appContext, args []string) int {
 	save := fs.Bool("save", false, "Save token in config")
 	saveCreds := fs.Bool("save-credentials", false, "Save client id/secret in config")
 	help := fs.Bool("help", false, "show help")
-	if err := fs.Parse(args[1:]); err != nil {
+	if err := parseFlags(ctx, fs, args[1:]); err != nil {
 		return 2
 	}
 	if *help {
@@ -358,38 +873,35 @@ func handleAuth(ctx appContext, args []string) int {
 		return 0
 	}
 	if ctx.settings.ClientID == "" || ctx.settings.ClientSecret == "" {
-		printError("client id/secret required", 0, "")
+		printErrorCode("PINGEN-AUTH-001", "client id/secret required")
 		return 2
 	}
-	client := pingen.Client{
-		APIBase:      ctx.settings.APIBase,
-		IdentityBase: ctx.settings.IdentityBase,
-		Timeout:      time.Duration(ctx.global.timeout) * time.Second,
-	}
-	payload, _, err := client.GetToken(ctx.settings.ClientID, ctx.settings.ClientSecret, *scope)
+	client := newClient(ctx, "")
+	payload, _, err := client.GetTokenRaw(ctx.jobContext, ctx.settings.ClientID, ctx.settings.ClientSecret, *scope)
 	if err != nil {
-		printError(err.Error(), 0, "")
+		reportError(ctx, err)
 		return 1
 	}
 	if *save || *saveCreds {
-		cfg, _, _ := pingen.LoadConfig(ctx.configPath)
+		cfg, _, _ := loadConfig(ctx.configPath)
 		cfg.Env = ctx.settings.Env
 		cfg.APIBase = ctx.settings.APIBase
 		cfg.IdentityBase = ctx.settings.IdentityBase
 		if *save {
 			if token, ok := payload["access_token"].(string); ok {
 				cfg.AccessToken = token
+				cfg.AccessTokenScope = *scope
 			}
-			if expires, ok := payload["expires_in"].(float64); ok {
-				cfg.AccessTokenExpiresAt = time.Now().Add(time.Duration(int64(expires)) * time.Second).Unix()
+			if expires, ok := int64Value(payload["expires_in"]); ok {
+				cfg.AccessTokenExpiresAt = time.Now().Add(time.Duration(expires) * time.Second).Unix()
 			}
 		}
 		if *saveCreds {
 			cfg.ClientID = ctx.settings.ClientID
 			cfg.ClientSecret = ctx.settings.ClientSecret
 		}
-		if err := pingen.SaveConfig(ctx.configPath, cfg); err != nil {
-			printError("failed to save config", 0, "")
+		if err := saveConfig(ctx, cfg); err != nil {
+			reportError(ctx, err)
 			return 1
 		}
 	}
@@ -401,10 +913,22 @@ func handleOrg(ctx appContext, args []string) int {
 		fmt.Println("org requires a subcommand")
 		return 2
 	}
-	if args[0] != "list" {
+	switch args[0] {
+	case "list":
+		return handleOrgList(ctx, args[1:])
+	case "get":
+		return handleOrgGet(ctx, args[1:])
+	case "use":
+		return handleOrgUse(ctx, args[1:])
+	case "settings":
+		return handleOrgSettings(ctx, args[1:])
+	default:
 		fmt.Println("unknown org subcommand")
 		return 2
 	}
+}
+
+func handleOrgList(ctx appContext, args []string) int {
 	fs := flag.NewFlagSet("org list", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
 	page := fs.Int("page", 0, "Page number")
@@ -414,41 +938,56 @@ func handleOrg(ctx appContext, args []string) int {
 	query := fs.String("q", "", "Full-text query")
 	include := fs.String("include", "", "Include relationships")
 	fields := fs.String("fields", "", "Sparse fieldset for primary type")
+	sortBy := fs.String("sort-by", "", "Client-side stable sort by fields (e.g. created_at,id or -status)")
+	var where stringList
+	fs.Var(&where, "where", "Filter clause (repeatable): key=value, key!=value, key>=value, key~value, 'key in a,b'")
+	whereDebug := fs.Bool("where-debug", false, "Print the generated filter JSON to stderr")
+	preset := fs.String("preset", "", "Apply a saved filter preset (see filters save)")
 	help := fs.Bool("help", false, "show help")
-	if err := fs.Parse(args[1:]); err != nil {
+	if err := parseFlags(ctx, fs, args); err != nil {
 		return 2
 	}
 	if *help {
-		fmt.Println("Usage: pingen-cli org list [--page N] [--limit N] [--sort expr] [--filter json] [--q query] [--include rel] [--fields list]")
+		fmt.Println("Usage: pingen-cli org list [--page N] [--limit N] [--sort expr] [--filter json] [--q query] [--include rel] [--fields list] [--sort-by fields] [--where clause]... [--where-debug] [--preset name]")
 		return 0
 	}
 
-	params := buildListParams(*page, *limit, *sort, *filter, *query, *include, *fields, "organisations")
-	token, err := ensureAccessToken(&ctx)
+	if err := applyPreset(ctx, *preset, filter, sort, sortBy, &where); err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	filterExpr, err := compileFilter(*filter, where)
 	if err != nil {
-		printError(err.Error(), 0, "")
-		return 1
+		reportError(ctx, err)
+		return 2
 	}
-	client := pingen.Client{
-		APIBase:     ctx.settings.APIBase,
-		AccessToken: token,
-		Timeout:     time.Duration(ctx.global.timeout) * time.Second,
+	if *whereDebug {
+		logf("info", "filter: %s", filterExpr)
 	}
-	payload, _, err := client.ListOrganisations(params)
+	params := buildListParams(*page, *limit, *sort, filterExpr, *query, *include, *fields, "organisations")
+	token, err := ensureAccessToken(&ctx)
 	if err != nil {
-		printError(err.Error(), 0, "")
+		reportError(ctx, err)
 		return 1
 	}
-	if ctx.global.jsonOutput {
-		return emitJSON(payload)
+	client := newClient(ctx, token)
+	payload, headers, err := client.ListOrganisationsRaw(ctx.jobContext, params)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
 	}
-	data, _ := payload["data"].([]any)
-	for _, entry := range data {
-		item, _ := entry.(map[string]any)
-		attrs, _ := item["attributes"].(map[string]any)
-		fmt.Printf("%s\t%s\t%s\n", stringValue(item["id"]), stringValue(attrs["name"]), stringValue(attrs["status"]))
+	if *sortBy != "" {
+		data, _ := payload["data"].([]any)
+		sortResources(data, *sortBy)
 	}
-	return 0
+	return emitPayload(ctx, payload, headers, func() {
+		data, _ := payload["data"].([]any)
+		for _, entry := range data {
+			item, _ := entry.(map[string]any)
+			attrs, _ := item["attributes"].(map[string]any)
+			fmt.Printf("%s\t%s\t%s\n", stringValue(item["id"]), stringValue(attrs["name"]), stringValue(attrs["status"]))
+		}
+	})
 }
 
 func handleLetters(ctx appContext, args []string) int {
@@ -460,12 +999,52 @@ func handleLetters(ctx appContext, args []string) int {
 	switch sub {
 	case "list":
 		return handleLettersList(ctx, args[1:])
+	case "browse":
+		return handleLettersBrowse(ctx, args[1:])
 	case "get":
 		return handleLettersGet(ctx, args[1:])
 	case "create":
-		return handleLettersCreate(ctx, args[1:])
+		return runJournaled(ctx, "letters create", args[1:], handleLettersCreate)
+	case "bulk-create":
+		return handleLettersBulkCreate(ctx, args[1:])
 	case "send":
-		return handleLettersSend(ctx, args[1:])
+		return runJournaled(ctx, "letters send", args[1:], handleLettersSend)
+	case "submit":
+		return handleLettersSubmit(ctx, args[1:])
+	case "download":
+		return handleLettersDownload(ctx, args[1:])
+	case "receipts":
+		return handleLettersReceipts(ctx, args[1:])
+	case "diff":
+		return handleLettersDiff(ctx, args[1:])
+	case "events":
+		return handleLettersEvents(ctx, args[1:])
+	case "wait":
+		return handleLettersWait(ctx, args[1:])
+	case "estimate", "price":
+		return handleLettersEstimate(ctx, args[1:])
+	case "check":
+		return handleLettersCheck(ctx, args[1:])
+	case "compose":
+		return handleLettersCompose(ctx, args[1:])
+	case "merge":
+		return handleLettersMerge(ctx, args[1:])
+	case "inspect-address":
+		return handleLettersInspectAddress(ctx, args[1:])
+	case "check-qr-bill":
+		return handleLettersCheckQRBill(ctx, args[1:])
+	case "delete":
+		return handleLettersDelete(ctx, args[1:])
+	case "cancel":
+		return handleLettersCancel(ctx, args[1:])
+	case "edit":
+		return handleLettersEdit(ctx, args[1:])
+	case "restore":
+		return handleLettersRestore(ctx, args[1:])
+	case "reconcile":
+		return handleLettersReconcile(ctx, args[1:])
+	case "duplicates":
+		return handleLettersDuplicates(ctx, args[1:])
 	default:
 		fmt.Println("unknown letters subcommand")
 		return 2
@@ -474,7 +1053,7 @@ func handleLetters(ctx appContext, args []string) int {
 
 func handleLettersList(ctx appContext, args []string) int {
 	if ctx.settings.OrganisationID == "" {
-		printError("organisation id required", 0, "")
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
 		return 2
 	}
 	fs := flag.NewFlagSet("letters list", flag.ContinueOnError)
@@ -486,88 +1065,277 @@ func handleLettersList(ctx appContext, args []string) int {
 	query := fs.String("q", "", "Full-text query")
 	include := fs.String("include", "", "Include relationships")
 	fields := fs.String("fields", "", "Sparse fieldset for primary type")
+	sortBy := fs.String("sort-by", "", "Client-side stable sort by fields (e.g. created_at,id or -status)")
+	var where stringList
+	fs.Var(&where, "where", "Filter clause (repeatable): key=value, key!=value, key>=value, key~value, 'key in a,b'")
+	var tags stringList
+	fs.Var(&tags, "tag", "Only letters tagged key=value (repeatable, see letters create --tag)")
+	whereDebug := fs.Bool("where-debug", false, "Print the generated filter JSON to stderr")
+	preset := fs.String("preset", "", "Apply a saved filter preset (see filters save)")
+	since := fs.String("since", "", "Only letters created at or after this time (YYYY-MM-DD, RFC 3339 or 30d)")
+	until := fs.String("until", "", "Only letters created before this time (YYYY-MM-DD, RFC 3339 or 30d)")
+	createdAfter := fs.String("created-after", "", "Same as --since")
+	createdBefore := fs.String("created-before", "", "Same as --until")
+	status := fs.String("status", "", "Only letters with one of these statuses (comma-separated)")
+	country := fs.String("country", "", "Only letters to one of these countries (comma-separated codes, e.g. CH,DE)")
+	var meta stringList
+	fs.Var(&meta, "meta", "Only letters whose meta data matches key=value; keys may be paths like recipient.name (repeatable)")
+	all := fs.Bool("all", false, "Fetch every page of the listing")
+	maxPages := fs.Int("max-pages", 100, "Stop --all after this many pages (0: no limit)")
+	concurrency := fs.Int("concurrency", 4, "Pages fetched in parallel with --all")
+	watch := fs.Bool("watch", false, "Poll the listing every --interval and print it again until Ctrl-C")
+	interval := fs.Duration("interval", 10*time.Second, "Polling interval for --watch")
+	changesOnly := fs.Bool("changes-only", false, "With --watch, print only letters that are new or changed status")
 	help := fs.Bool("help", false, "show help")
-	if err := fs.Parse(args); err != nil {
+	if err := parseFlags(ctx, fs, args); err != nil {
 		return 2
 	}
 	if *help {
-		fmt.Println("Usage: pingen-cli letters list [--page N] [--limit N] [--sort expr] [--filter json] [--q query] [--include rel] [--fields list]")
+		fmt.Println("Usage: pingen-cli letters list [--page N] [--limit N] [--sort expr] [--filter json] [--q query] [--include rel] [--fields list] [--sort-by fields] [--where clause]... [--tag key=value]... [--status list] [--country list] [--meta key=value]... [--where-debug] [--preset name] [--since|--created-after time] [--until|--created-before time] [--all [--max-pages N] [--concurrency N]] [--watch [--interval 10s] [--changes-only]]")
 		return 0
 	}
+	if *createdAfter != "" {
+		if *since != "" {
+			printErrorCode("PINGEN-INPUT-001", "--created-after cannot be combined with --since")
+			return 2
+		}
+		*since = *createdAfter
+	}
+	if *createdBefore != "" {
+		if *until != "" {
+			printErrorCode("PINGEN-INPUT-001", "--created-before cannot be combined with --until")
+			return 2
+		}
+		*until = *createdBefore
+	}
+	if *all && *page > 0 {
+		printErrorCode("PINGEN-INPUT-001", "--all cannot be combined with --page")
+		return 2
+	}
+	if *maxPages < 0 {
+		printErrorCode("PINGEN-INPUT-001", "--max-pages must be at least 0")
+		return 2
+	}
+	if *concurrency < 1 {
+		printErrorCode("PINGEN-INPUT-001", "--concurrency must be at least 1")
+		return 2
+	}
+	if *changesOnly && !*watch {
+		printErrorCode("PINGEN-INPUT-001", "--changes-only requires --watch")
+		return 2
+	}
+	if *watch && *interval < time.Second {
+		printErrorCode("PINGEN-INPUT-001", "--interval must be at least 1s")
+		return 2
+	}
 
-	params := buildListParams(*page, *limit, *sort, *filter, *query, *include, *fields, "letters")
+	if err := applyPreset(ctx, *preset, filter, sort, sortBy, &where); err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	rangeClauses, err := timeRangeClauses("created_at", *since, *until, inputLocation(ctx))
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	where = append(where, rangeClauses...)
+	tagWhere, err := tagClauses(tags)
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	where = append(where, tagWhere...)
+	flagWhere, err := letterFilterClauses(*status, *country, meta)
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	where = append(where, flagWhere...)
+	filterExpr, err := compileFilter(*filter, where)
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	if *whereDebug {
+		logf("info", "filter: %s", filterExpr)
+	}
+	params := buildListParams(*page, *limit, *sort, filterExpr, *query, *include, *fields, "letters")
 	token, err := ensureAccessToken(&ctx)
 	if err != nil {
-		printError(err.Error(), 0, "")
+		reportError(ctx, err)
 		return 1
 	}
-	client := pingen.Client{
-		APIBase:     ctx.settings.APIBase,
-		AccessToken: token,
-		Timeout:     time.Duration(ctx.global.timeout) * time.Second,
+	client := newClient(ctx, token)
+	if *watch {
+		if *all && params["page[limit]"] == "" {
+			params["page[limit]"] = "100"
+		}
+		w := &letterListWatch{ctx: ctx, client: client, params: params, all: *all, maxPages: *maxPages, concurrency: *concurrency, sortBy: *sortBy, interval: *interval, changesOnly: *changesOnly}
+		return w.run()
 	}
-	payload, _, err := client.ListLetters(ctx.settings.OrganisationID, params)
+	if *all {
+		return listAllLetters(ctx, client, params, *sortBy, *maxPages, *concurrency)
+	}
+	payload, headers, err := client.ListLettersRaw(ctx.jobContext, ctx.settings.OrganisationID, params)
 	if err != nil {
-		printError(err.Error(), 0, "")
+		reportError(ctx, err)
 		return 1
 	}
-	if ctx.global.jsonOutput {
-		return emitJSON(payload)
+	if *sortBy != "" {
+		data, _ := payload["data"].([]any)
+		sortResources(data, *sortBy)
 	}
-	data, _ := payload["data"].([]any)
-	for _, entry := range data {
-		item, _ := entry.(map[string]any)
-		attrs, _ := item["attributes"].(map[string]any)
-		fmt.Printf("%s\t%s\t%s\n", stringValue(item["id"]), stringValue(attrs["status"]), stringValue(attrs["file_original_name"]))
+	return emitPayload(ctx, payload, headers, func() {
+		data, _ := payload["data"].([]any)
+		for _, entry := range data {
+			item, _ := entry.(map[string]any)
+			printLetterRow(item)
+		}
+	})
+}
+
+// listAllLetters fetches every page of a letters listing. Plain rows are
+// printed as each page arrives; other output modes and --sort-by need every
+// letter first, so the pages are fetched concurrency at a time when the
+// listing reports its page count, merged into one payload and sorted by
+// --sort-by or mergedSortOrder.
+func listAllLetters(ctx appContext, client pingen.Client, params map[string]string, sortBy string, maxPages, concurrency int) int {
+	if params["page[limit]"] == "" {
+		params["page[limit]"] = "100"
+	}
+	stream := !ctx.global.jsonOutput && ctx.global.templateName == "" && !ctx.global.tableOutput && len(ctx.global.columns) == 0 && sortBy == ""
+	var mu sync.Mutex
+	var headers http.Header
+	fetch := func(page int) (map[string]any, error) {
+		payload, pageHeaders, err := client.ListLettersRaw(ctx.jobContext, ctx.settings.OrganisationID, withPage(params, page))
+		mu.Lock()
+		headers = pageHeaders
+		mu.Unlock()
+		return payload, err
+	}
+	var items []map[string]any
+	var pages int
+	var truncated bool
+	var err error
+	if stream {
+		pages, truncated, err = walkPages(maxPages, fetch, func(items []map[string]any) {
+			for _, item := range items {
+				printLetterRow(item)
+			}
+		})
+	} else {
+		items, pages, truncated, err = fetchPages(ctx.jobContext, concurrency, maxPages, fetch)
 	}
-	return 0
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	verbosef(ctx, "fetched %d pages", pages)
+	if truncated {
+		logf("warn", "stopped after %d pages (--max-pages); more letters are available", pages)
+	}
+	if stream {
+		return 0
+	}
+	data := make([]any, 0, len(items))
+	for _, item := range items {
+		data = append(data, item)
+	}
+	if sortBy == "" {
+		sortBy = mergedSortOrder
+	}
+	sortResources(data, sortBy)
+	payload := map[string]any{"data": data, "meta": map[string]any{"pages": pages, "total": len(data), "truncated": truncated}}
+	return emitPayload(ctx, payload, headers, func() {
+		for _, entry := range data {
+			item, _ := entry.(map[string]any)
+			printLetterRow(item)
+		}
+	})
+}
+
+func printLetterRow(item map[string]any) {
+	attrs, _ := item["attributes"].(map[string]any)
+	fmt.Printf("%s\t%s\t%s\n", stringValue(item["id"]), stringValue(attrs["status"]), stringValue(attrs["file_original_name"]))
 }
 
 func handleLettersGet(ctx appContext, args []string) int {
 	if ctx.settings.OrganisationID == "" {
-		printError("organisation id required", 0, "")
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
 		return 2
 	}
-	if len(args) == 0 {
+	fs := flag.NewFlagSet("letters get", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	pick := fs.Bool("pick", false, "Choose the letter interactively from the newest letters")
+	help := fs.Bool("help", false, "show help")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil || applyParsedDefaults(ctx, fs) != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli letters get <letter_id> | --pick")
+		return 0
+	}
+	var letterID string
+	switch {
+	case len(positional) > 0:
+		letterID, err = resolveLetterID(&ctx, positional[0])
+	case *pick:
+		letterID, err = pickResource(&ctx, "letters")
+	default:
 		fmt.Println("letters get requires a letter id")
 		return 2
 	}
-	letterID := args[0]
-	token, err := ensureAccessToken(&ctx)
 	if err != nil {
-		printError(err.Error(), 0, "")
+		reportError(ctx, err)
 		return 1
 	}
-	client := pingen.Client{
-		APIBase:     ctx.settings.APIBase,
-		AccessToken: token,
-		Timeout:     time.Duration(ctx.global.timeout) * time.Second,
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
 	}
-	payload, _, err := client.GetLetter(ctx.settings.OrganisationID, letterID)
+	client := newClient(ctx, token)
+	payload, headers, err := client.GetLetterRaw(ctx.jobContext, ctx.settings.OrganisationID, letterID)
 	if err != nil {
-		printError(err.Error(), 0, "")
+		reportError(ctx, err)
 		return 1
 	}
-	if ctx.global.jsonOutput {
-		return emitJSON(payload)
+	return emitPayload(ctx, payload, headers, func() {
+		item, _ := payload["data"].(map[string]any)
+		attrs, _ := item["attributes"].(map[string]any)
+		fmt.Println(stringValue(item["id"]))
+		fmt.Printf("status: %s\n", stringValue(attrs["status"]))
+		fmt.Printf("file: %s\n", stringValue(attrs["file_original_name"]))
+		fmt.Printf("created: %s\n", formatTimestamp(ctx, attrs["created_at"]))
+	})
+}
+
+// maxUploadSize returns the configured upload limit in bytes. An invalid
+// config value falls back to the default; `config set` rejects those.
+func maxUploadSize(ctx appContext) int64 {
+	if ctx.settings.MaxUploadSize != "" {
+		if size, err := pingen.ParseSize(ctx.settings.MaxUploadSize); err == nil {
+			return size
+		}
 	}
-	item, _ := payload["data"].(map[string]any)
-	attrs, _ := item["attributes"].(map[string]any)
-	fmt.Println(stringValue(item["id"]))
-	fmt.Printf("status: %s\n", stringValue(attrs["status"]))
-	fmt.Printf("file: %s\n", stringValue(attrs["file_original_name"]))
-	return 0
+	return pingen.DefaultMaxUploadSize
 }
 
-func handleLettersCreate(ctx appContext, args []string) int {
-	if ctx.settings.OrganisationID == "" {
-		printError("organisation id required", 0, "")
-		return 2
+// uploadTimeout bounds a PDF upload: --timeout, but at least a minute.
+func uploadTimeout(ctx appContext) time.Duration {
+	timeout := time.Duration(ctx.global.timeout) * time.Second
+	if timeout < 60*time.Second {
+		timeout = 60 * time.Second
 	}
+	return timeout
+}
+
+func handleLettersCreate(ctx appContext, args []string) (exitCode int) {
 	fs := flag.NewFlagSet("letters create", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
-	filePath := fs.String("file", "", "PDF file to upload")
-	fileName := fs.String("file-name", "", "Original file name shown in Pingen")
+	filePath := fs.String("file", "", "PDF file to upload, or - to read it from stdin")
+	fileName := fs.String("file-name", "", "Original file name shown in Pingen (required with stdin)")
 	addressPos := fs.String("address-position", "left", "Address position (left/right)")
 	autoSend := fs.Bool("auto-send", false, "Automatically send when processed")
 	deliveryProduct := fs.String("delivery-product", "", "Delivery product")
@@ -576,25 +1344,97 @@ func handleLettersCreate(ctx appContext, args []string) int {
 	metaJSON := fs.String("meta-json", "", "Meta data JSON string or @path")
 	metaFile := fs.String("meta-file", "", "Meta data JSON file path")
 	idempotencyKey := fs.String("idempotency-key", "", "Idempotency key for create request")
+	schemaOnly := fs.Bool("schema-only", false, "Validate the request body against its schema and exit without network calls")
+	payloadFile := fs.String("payload", "", "With --schema-only, validate this request body (JSON file or -) instead of one built from the flags")
+	fromTemplate := fs.String("from-template", "", "Fill unset flags from a saved letter template (see templates save)")
+	recipient := fs.String("recipient", "", "Address book alias for meta_data.recipient (see contacts add)")
+	var tags stringList
+	fs.Var(&tags, "tag", "Label the letter in meta_data.tags (key=value, repeatable)")
+	sender := fs.String("sender", "", "Address book alias for meta_data.sender")
+	requireCountry := fs.String("require-country", "", "Abort unless the recipient in the PDF's address window is in one of these countries (e.g. CH,DE,AT)")
+	checkQR := fs.Bool("check-qr-bill", false, "Abort unless the PDF has a QR-bill payment part that passes `letters check-qr-bill`")
+	validateAddress := fs.Bool("validate-address", false, "Warn when the recipient in the PDF's address window looks incomplete or undeliverable")
+	wait := fs.Bool("wait", false, "Wait until the letter has left validation and exit 1 if it needs action")
+	waitOptions := addLetterWaitFlags(fs)
+	hooks := addHookFlags(fs)
 	help := fs.Bool("help", false, "show help")
 	if err := fs.Parse(args); err != nil {
 		return 2
 	}
 	if *help {
-		fmt.Println("Usage: pingen-cli letters create --file <path> [--file-name name] [--address-position left|right] [--auto-send] [--delivery-product ...] [--print-mode ...] [--print-spectrum ...] [--meta-json ...|--meta-file ...] [--idempotency-key ...]")
+		fmt.Println("Usage: pingen-cli letters create --file <path>|- [--file-name name] [--address-position left|right] [--auto-send] [--delivery-product ...] [--print-mode ...] [--print-spectrum ...] [--meta-json ...|--meta-file ...] [--recipient alias] [--sender alias] [--tag key=value]... [--require-country CH,DE,...] [--check-qr-bill] [--validate-address] [--wait [--interval 5s] [--max-wait 10m]] [--idempotency-key ...] [--from-template name] [--schema-only [--payload file]] [--on-success cmd] [--on-failure cmd]")
 		return 0
 	}
+	redactSecrets(*filePath, *fileName)
+	event := hookEvent{command: "letters create", filePath: *filePath}
+	defer func() { hooks.run(ctx, event, exitCode) }()
+	if *payloadFile != "" {
+		if err := checkPayloadFile("letter-create", *payloadFile, *schemaOnly); err != nil {
+			return event.failErr(ctx, err, 2)
+		}
+		return reportSchemaValid("letter-create")
+	}
+	if ctx.settings.OrganisationID == "" {
+		return event.fail("PINGEN-INPUT-001", "organisation id required", 2)
+	}
+	if err := applyLetterTemplate(ctx, *fromTemplate, fs); err != nil {
+		return event.failErr(ctx, err, 2)
+	}
+	if err := applyFlagDefaults(ctx, "letters.create", fs); err != nil {
+		return event.failErr(ctx, err, 2)
+	}
+	// A PDF piped in with --file-name but without --file is read from stdin
+	// as well.
+	if *filePath == "" && *fileName != "" && !stdinIsTerminal() {
+		*filePath = "-"
+		event.filePath = "-"
+	}
 	if *filePath == "" {
-		printError("--file is required", 0, "")
-		return 2
+		return event.fail("PINGEN-INPUT-001", "--file is required", 2)
 	}
 	if *addressPos != "left" && *addressPos != "right" {
-		printError("address-position must be left or right", 0, "")
-		return 2
+		return event.fail("PINGEN-INPUT-001", "address-position must be left or right", 2)
 	}
-	if _, err := os.Stat(*filePath); err != nil {
-		printError("file not found", 0, "")
-		return 2
+	if err := waitOptions.validate(); *wait && err != nil {
+		return event.failErr(ctx, err, 2)
+	}
+	uploadPath := *filePath
+	if *filePath == "-" {
+		if *fileName == "" {
+			return event.fail("PINGEN-INPUT-001", "--file-name is required when reading the PDF from stdin", 2)
+		}
+		path, cleanup, err := spoolStdin(maxUploadSize(ctx))
+		if err != nil {
+			return event.failErr(ctx, err, 2)
+		}
+		defer cleanup()
+		uploadPath = path
+	} else if _, err := os.Stat(*filePath); err != nil {
+		return event.fail("PINGEN-UPLOAD-001", "file not found", 2)
+	}
+	if err := pingen.PreflightPDF(uploadPath, maxUploadSize(ctx)); err != nil {
+		if uploadPath != *filePath {
+			err = stdinPathError(err, uploadPath)
+		}
+		return event.failErr(ctx, err, 2)
+	}
+	if err := checkPageLimit(ctx, uploadPath, *deliveryProduct); err != nil {
+		return event.failErr(ctx, err, 2)
+	}
+	if *requireCountry != "" {
+		if err := checkAddressCountry(uploadPath, *addressPos, *requireCountry); err != nil {
+			return event.failErr(ctx, err, 2)
+		}
+	}
+	if *checkQR {
+		if err := checkQRBill(uploadPath); err != nil {
+			return event.failErr(ctx, err, 2)
+		}
+	}
+	if *validateAddress {
+		for _, warning := range addressWarnings(&ctx, uploadPath, *addressPos, !*schemaOnly) {
+			logf("warn", "%s", warning)
+		}
 	}
 	originalName := *fileName
 	if originalName == "" {
@@ -602,9 +1442,20 @@ func handleLettersCreate(ctx appContext, args []string) int {
 	}
 	metaData, err := loadJSONInput(*metaJSON, *metaFile)
 	if err != nil {
-		printError(err.Error(), 0, "")
-		return 2
+		return event.failErr(ctx, err, 2)
+	}
+	metaData, err = applyContacts(ctx, metaData, *recipient, *sender)
+	if err != nil {
+		return event.failErr(ctx, err, 2)
 	}
+	if err := validateMetaAddresses(metaData); err != nil {
+		return event.failErr(ctx, err, 2)
+	}
+	tagValues, err := parseTags(tags)
+	if err != nil {
+		return event.failErr(ctx, err, 2)
+	}
+	metaData = applyTags(metaData, tagValues)
 
 	attributes := map[string]any{
 		"file_original_name": originalName,
@@ -612,113 +1463,116 @@ func handleLettersCreate(ctx appContext, args []string) int {
 		"auto_send":          *autoSend,
 	}
 	if *deliveryProduct != "" {
-		if !isAllowed(*deliveryProduct, []string{"fast", "cheap", "bulk", "premium", "registered"}) {
-			printError("invalid delivery-product", 0, "")
-			return 2
-		}
 		attributes["delivery_product"] = *deliveryProduct
 	}
 	if *printMode != "" {
 		if !isAllowed(*printMode, []string{"simplex", "duplex"}) {
-			printError("invalid print-mode", 0, "")
-			return 2
+			return event.fail("PINGEN-INPUT-001", "invalid print-mode", 2)
 		}
 		attributes["print_mode"] = *printMode
 	}
 	if *printSpectrum != "" {
 		if !isAllowed(*printSpectrum, []string{"color", "grayscale"}) {
-			printError("invalid print-spectrum", 0, "")
-			return 2
+			return event.fail("PINGEN-INPUT-001", "invalid print-spectrum", 2)
 		}
 		attributes["print_spectrum"] = *printSpectrum
 	}
 	if metaData != nil {
 		attributes["meta_data"] = metaData
 	}
+	payload := map[string]any{
+		"data": map[string]any{
+			"type":       "letters",
+			"attributes": attributes,
+		},
+	}
+	// The upload URL and signature are only issued after validation; stand-ins
+	// keep the required fields present.
+	attributes["file_url"] = "https://upload.invalid/pending"
+	attributes["file_url_signature"] = "pending"
+	err = pingen.ValidatePayload("letter-create", payload)
+	delete(attributes, "file_url")
+	delete(attributes, "file_url_signature")
+	if err != nil {
+		return event.failErr(ctx, err, 2)
+	}
+	if *schemaOnly {
+		return reportSchemaValid("letter-create")
+	}
+	if *deliveryProduct != "" {
+		// A product is checked for the destination when --require-country
+		// names a single country, else for any country.
+		country := strings.ToUpper(strings.TrimSpace(*requireCountry))
+		if strings.Contains(country, ",") {
+			country = ""
+		}
+		product, err := checkDeliveryProduct(&ctx, *deliveryProduct, country)
+		if err != nil {
+			return event.failErr(ctx, err, 2)
+		}
+		attributes["delivery_product"] = product
+	}
 
 	if ctx.global.dryRun {
-		payload := map[string]any{
+		plan := map[string]any{
 			"action":          "letters.create",
 			"file":            *filePath,
 			"organisation_id": ctx.settings.OrganisationID,
 			"attributes":      attributes,
 		}
-		return emitJSON(payload)
+		upload := pingen.LetterUpload{Path: uploadPath, Attributes: copyMap(attributes), IdempotencyKey: *idempotencyKey}
+		return emitDryRun(ctx, plan, previewLetterUpload(ctx, upload))
 	}
 
 	token, err := ensureAccessToken(&ctx)
 	if err != nil {
-		printError(err.Error(), 0, "")
-		return 1
-	}
-	client := pingen.Client{
-		APIBase:     ctx.settings.APIBase,
-		AccessToken: token,
-		Timeout:     time.Duration(ctx.global.timeout) * time.Second,
-	}
-	if ctx.global.verbose && !ctx.global.quiet {
-		fmt.Fprintln(os.Stderr, "requesting upload url...")
-	}
-	uploadURL, signature, _, err := client.GetFileUpload()
+		return event.failErr(ctx, err, 1)
+	}
+	// Ctrl-C aborts the upload instead of killing the process, so that
+	// --on-failure still runs.
+	var stopSignals func()
+	ctx.jobContext, stopSignals = handleSignals(ctx.jobContext)
+	defer stopSignals()
+	client := newClient(ctx, token)
+	verbosef(ctx, "requesting upload url...")
+	uploadURL, signature, _, err := client.GetFileUpload(ctx.jobContext)
 	if err != nil {
-		printError(err.Error(), 0, "")
-		return 1
-	}
-	if ctx.global.verbose && !ctx.global.quiet {
-		fmt.Fprintln(os.Stderr, "uploading file...")
+		return event.failErr(ctx, err, interruptedCode(ctx, 1))
 	}
-	uploadTimeout := time.Duration(ctx.global.timeout) * time.Second
-	if uploadTimeout < 60*time.Second {
-		uploadTimeout = 60 * time.Second
-	}
-	if err := client.UploadFile(uploadURL, *filePath, uploadTimeout); err != nil {
-		printError(err.Error(), 0, "")
-		return 1
+	verbosef(ctx, "uploading %s...", *filePath)
+	progress := uploadProgress(ctx, &client)
+	err = client.UploadFile(ctx.jobContext, uploadURL, uploadPath, uploadTimeout(ctx))
+	progress.finish()
+	if err != nil {
+		return event.failErr(ctx, err, interruptedCode(ctx, 1))
 	}
 
-	payload := map[string]any{
-		"data": map[string]any{
-			"type": "letters",
-			"attributes": map[string]any{
-				"file_original_name": originalName,
-				"file_url":           uploadURL,
-				"file_url_signature": signature,
-				"address_position":   attributes["address_position"],
-				"auto_send":          attributes["auto_send"],
-			},
-		},
-	}
-	if value, ok := attributes["delivery_product"]; ok {
-		payload["data"].(map[string]any)["attributes"].(map[string]any)["delivery_product"] = value
-	}
-	if value, ok := attributes["print_mode"]; ok {
-		payload["data"].(map[string]any)["attributes"].(map[string]any)["print_mode"] = value
+	attributes["file_url"] = uploadURL
+	attributes["file_url_signature"] = signature
+
+	verbosef(ctx, "creating letter %q...", originalName)
+	resp, headers, err := client.CreateLetterRaw(ctx.jobContext, ctx.settings.OrganisationID, payload, *idempotencyKey)
+	if err != nil {
+		return event.failErr(ctx, err, interruptedCode(ctx, 1))
 	}
-	if value, ok := attributes["print_spectrum"]; ok {
-		payload["data"].(map[string]any)["attributes"].(map[string]any)["print_spectrum"] = value
+	event.setLetter(resp)
+	if !*wait {
+		return emitPayload(ctx, resp, headers, func() { printLetterSummary(resp) })
 	}
-	if value, ok := attributes["meta_data"]; ok {
-		payload["data"].(map[string]any)["attributes"].(map[string]any)["meta_data"] = value
+	verbosef(ctx, "waiting for letter %s to leave validation...", event.letterID)
+	letter, letterHeaders, err := waitForLetter(ctx, newClient(ctx, token), event.letterID, *waitOptions)
+	if letter != nil {
+		event.setLetter(letter)
 	}
-
-	if ctx.global.verbose && !ctx.global.quiet {
-		fmt.Fprintln(os.Stderr, "creating letter...")
-	}
-	resp, _, err := client.CreateLetter(ctx.settings.OrganisationID, payload, *idempotencyKey)
 	if err != nil {
-		printError(err.Error(), 0, "")
-		return 1
-	}
-	if ctx.global.jsonOutput {
-		return emitJSON(resp)
+		event.message = err.Error()
 	}
-	printLetterSummary(resp)
-	return 0
+	return finishLetterWait(ctx, letter, letterHeaders, err)
 }
 
-func handleLettersSend(ctx appContext, args []string) int {
+func handleLettersSend(ctx appContext, args []string) (exitCode int) {
 	if ctx.settings.OrganisationID == "" {
-		printError("organisation id required", 0, "")
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
 		return 2
 	}
 	fs := flag.NewFlagSet("letters send", flag.ContinueOnError)
@@ -729,41 +1583,64 @@ func handleLettersSend(ctx appContext, args []string) int {
 	metaJSON := fs.String("meta-json", "", "Meta data JSON string or @path")
 	metaFile := fs.String("meta-file", "", "Meta data JSON file path")
 	idempotencyKey := fs.String("idempotency-key", "", "Idempotency key for send request")
+	at := fs.String("at", "", "Queue the send to run at this time (RFC 3339) instead of now")
+	var tags stringList
+	fs.Var(&tags, "tag", "Label the letter in meta_data.tags (key=value, repeatable)")
+	schemaOnly := fs.Bool("schema-only", false, "Validate the request body against its schema and exit without network calls")
+	payloadFile := fs.String("payload", "", "With --schema-only, validate this request body (JSON file or -) instead of one built from the flags")
+	pick := fs.Bool("pick", false, "Choose the letter interactively when no id is given")
+	hooks := addHookFlags(fs)
 	help := fs.Bool("help", false, "show help")
-	if err := fs.Parse(args); err != nil {
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
 		return 2
 	}
 	if *help {
-		fmt.Println("Usage: pingen-cli letters send <letter_id> --delivery-product <fast|cheap|bulk|premium|registered> --print-mode <simplex|duplex> --print-spectrum <color|grayscale> [--meta-json ...|--meta-file ...]")
+		fmt.Println("Usage: pingen-cli letters send <letter_id>|--pick --delivery-product <product (see products list)> --print-mode <simplex|duplex> --print-spectrum <color|grayscale> [--meta-json ...|--meta-file ...] [--tag key=value]... [--at time] [--schema-only [--payload file]] [--on-success cmd] [--on-failure cmd]")
 		return 0
 	}
-	remaining := fs.Args()
+	if *payloadFile != "" {
+		return validatePayloadFile(ctx, "letter-send", *payloadFile, *schemaOnly)
+	}
+	event := hookEvent{command: "letters send"}
+	defer func() { hooks.run(ctx, event, exitCode) }()
+	if err := applyFlagDefaults(ctx, "letters.send", fs); err != nil {
+		return event.failErr(ctx, err, 2)
+	}
+	remaining := positional
+	if len(remaining) == 0 && *pick {
+		picked, err := pickResource(&ctx, "letters")
+		if err != nil {
+			return event.failErr(ctx, err, 1)
+		}
+		remaining = []string{picked}
+	}
 	if len(remaining) == 0 {
-		printError("letter id required", 0, "")
-		return 2
+		return event.fail("PINGEN-INPUT-001", "letter id required", 2)
 	}
 	letterID := remaining[0]
+	event.letterID = letterID
 	if *deliveryProduct == "" || *printMode == "" || *printSpectrum == "" {
-		printError("delivery-product, print-mode, and print-spectrum are required", 0, "")
-		return 2
-	}
-	if !isAllowed(*deliveryProduct, []string{"fast", "cheap", "bulk", "premium", "registered"}) {
-		printError("invalid delivery-product", 0, "")
-		return 2
+		return event.fail("PINGEN-INPUT-001", "delivery-product, print-mode, and print-spectrum are required", 2)
 	}
 	if !isAllowed(*printMode, []string{"simplex", "duplex"}) {
-		printError("invalid print-mode", 0, "")
-		return 2
+		return event.fail("PINGEN-INPUT-001", "invalid print-mode", 2)
 	}
 	if !isAllowed(*printSpectrum, []string{"color", "grayscale"}) {
-		printError("invalid print-spectrum", 0, "")
-		return 2
+		return event.fail("PINGEN-INPUT-001", "invalid print-spectrum", 2)
 	}
 	metaData, err := loadJSONInput(*metaJSON, *metaFile)
 	if err != nil {
-		printError(err.Error(), 0, "")
-		return 2
+		return event.failErr(ctx, err, 2)
+	}
+	if err := validateMetaAddresses(metaData); err != nil {
+		return event.failErr(ctx, err, 2)
+	}
+	tagValues, err := parseTags(tags)
+	if err != nil {
+		return event.failErr(ctx, err, 2)
 	}
+	metaData = applyTags(metaData, tagValues)
 	attributes := map[string]any{
 		"delivery_product": *deliveryProduct,
 		"print_mode":       *printMode,
@@ -772,48 +1649,92 @@ func handleLettersSend(ctx appContext, args []string) int {
 	if metaData != nil {
 		attributes["meta_data"] = metaData
 	}
+	payload := map[string]any{
+		"data": map[string]any{
+			"id":         letterID,
+			"type":       "letters",
+			"attributes": attributes,
+		},
+	}
+	if err := pingen.ValidatePayload("letter-send", payload); err != nil {
+		return event.failErr(ctx, err, 2)
+	}
+	if *schemaOnly {
+		return reportSchemaValid("letter-send")
+	}
+	letterID, err = resolveLetterID(&ctx, letterID)
+	if err != nil {
+		return event.failErr(ctx, err, 1)
+	}
+	event.letterID = letterID
+	payload["data"].(map[string]any)["id"] = letterID
+	product, err := checkDeliveryProduct(&ctx, *deliveryProduct, letterCountry(&ctx, letterID))
+	if err != nil {
+		return event.failErr(ctx, err, 2)
+	}
+	attributes["delivery_product"] = product
+
+	if *at != "" {
+		runAt, err := parseRunAt(ctx, *at)
+		if err != nil {
+			return event.failErr(ctx, err, 2)
+		}
+		// Hooks run with the queued send, not when it is enqueued.
+		queued := *hooks
+		*hooks = hookOptions{}
+		return queueLetterSend(ctx, letterID, attributes, *idempotencyKey, queued, runAt)
+	}
 
 	if ctx.global.dryRun {
-		payload := map[string]any{
+		return emitDryRun(ctx, map[string]any{
 			"action":          "letters.send",
 			"organisation_id": ctx.settings.OrganisationID,
 			"letter_id":       letterID,
 			"attributes":      attributes,
-		}
-		return emitJSON(payload)
+		}, func(client pingen.Client) error {
+			_, _, err := client.SendLetterRaw(ctx.jobContext, ctx.settings.OrganisationID, letterID, payload, *idempotencyKey)
+			return err
+		})
 	}
 
 	token, err := ensureAccessToken(&ctx)
 	if err != nil {
-		printError(err.Error(), 0, "")
-		return 1
-	}
-	client := pingen.Client{
-		APIBase:     ctx.settings.APIBase,
-		AccessToken: token,
-		Timeout:     time.Duration(ctx.global.timeout) * time.Second,
-	}
-	payload := map[string]any{
-		"data": map[string]any{
-			"id":         letterID,
-			"type":       "letters",
-			"attributes": attributes,
-		},
+		return event.failErr(ctx, err, 1)
 	}
-	resp, _, err := client.SendLetter(ctx.settings.OrganisationID, letterID, payload, *idempotencyKey)
+	client := newClient(ctx, token)
+	resp, headers, err := client.SendLetterRaw(ctx.jobContext, ctx.settings.OrganisationID, letterID, payload, *idempotencyKey)
 	if err != nil {
-		printError(err.Error(), 0, "")
-		return 1
-	}
-	if ctx.global.jsonOutput {
-		return emitJSON(resp)
+		return event.failErr(ctx, err, 1)
 	}
-	printLetterSummary(resp)
-	return 0
+	event.setLetter(resp)
+	return emitPayload(ctx, resp, headers, func() { printLetterSummary(resp) })
+}
+
+// newClient returns an API client for the resolved settings. Every request it
+// makes is bounded by the invocation's --deadline.
+func newClient(ctx appContext, token string) pingen.Client {
+	client := pingen.Client{
+		APIBase:      ctx.settings.APIBase,
+		IdentityBase: ctx.settings.IdentityBase,
+		AccessToken:  token,
+		Timeout:      time.Duration(ctx.global.timeout) * time.Second,
+		UploadLimit:  ctx.uploadLimit,
+		Transport:    ctx.transport,
+		Pacer:        ctx.pacer,
+		Headers:      ctx.settings.Headers,
+		OnRequest:    logRequest,
+		Retries:      ctx.global.retries,
+		RetryMaxWait: ctx.global.retryMaxWait,
+		OnRetry:      logRetry,
+	}
+	if ctx.global.trace {
+		client.OnRequest, client.OnTrace = nil, logTrace
+	}
+	return client
 }
 
 func ensureAccessToken(ctx *appContext) (string, error) {
-	if ctx.settings.AccessToken != "" {
+	if ctx.settings.AccessToken != "" && tokenCoversScope(ctx.settings, ctx.scope) {
 		if ctx.settings.AccessTokenExpiresAt == 0 {
 			return ctx.settings.AccessToken, nil
 		}
@@ -821,34 +1742,85 @@ func ensureAccessToken(ctx *appContext) (string, error) {
 			return ctx.settings.AccessToken, nil
 		}
 	}
+	// A refresh token cannot widen the scope; --scope falls through to the
+	// client credentials below.
+	if ctx.settings.RefreshToken != "" && ctx.settings.ClientID != "" && tokenCoversScope(ctx.settings, ctx.scope) {
+		token, err := refreshAccessToken(ctx)
+		if err == nil {
+			return token, nil
+		}
+		if ctx.settings.ClientSecret == "" {
+			return "", err
+		}
+		logf("warn", "token refresh failed, using the client credentials: %v", err)
+	}
 	if ctx.settings.ClientID == "" || ctx.settings.ClientSecret == "" {
-		return "", fmt.Errorf("access token required (use --access-token or auth token)")
+		return "", codedErrorf("PINGEN-AUTH-001", "access token required (use --access-token, auth token or auth login)")
 	}
-	client := pingen.Client{
-		APIBase:      ctx.settings.APIBase,
-		IdentityBase: ctx.settings.IdentityBase,
-		Timeout:      time.Duration(ctx.global.timeout) * time.Second,
+	scope := defaultScope
+	if ctx.scope != "" {
+		scope += " " + ctx.scope
 	}
-	payload, _, err := client.GetToken(ctx.settings.ClientID, ctx.settings.ClientSecret, defaultScope)
+	client := newClient(*ctx, "")
+	tokens, err := client.GetToken(ctx.jobContext, ctx.settings.ClientID, ctx.settings.ClientSecret, scope)
 	if err != nil {
 		return "", err
 	}
-	token, ok := payload["access_token"].(string)
-	if !ok || token == "" {
-		return "", fmt.Errorf("access token missing in response")
+	token := tokens.AccessToken
+	if token == "" {
+		return "", codedErrorf("PINGEN-AUTH-002", "access token missing in response")
 	}
 	ctx.settings.AccessToken = token
+	ctx.settings.AccessTokenScope = scope
 	if ctx.configLoaded {
-		cfg, _, _ := pingen.LoadConfig(ctx.configPath)
+		cfg, _, _ := loadConfig(ctx.configPath)
 		cfg.AccessToken = token
-		if expires, ok := payload["expires_in"].(float64); ok {
-			cfg.AccessTokenExpiresAt = time.Now().Add(time.Duration(int64(expires)) * time.Second).Unix()
+		cfg.AccessTokenScope = scope
+		if expiresAt := tokens.ExpiresAt(time.Now()); !expiresAt.IsZero() {
+			cfg.AccessTokenExpiresAt = expiresAt.Unix()
+		}
+		if err := saveConfig(*ctx, cfg); err != nil {
+			logf("warn", "token not cached: %v", err)
 		}
-		_ = pingen.SaveConfig(ctx.configPath, cfg)
 	}
 	return token, nil
 }
 
+// tokenCoversScope reports whether the cached token was requested with every
+// scope in extra. A token passed with --access-token or PINGEN_ACCESS_TOKEN
+// carries no expiry and is used as given.
+func tokenCoversScope(settings pingen.Config, extra string) bool {
+	if extra == "" || settings.AccessTokenExpiresAt == 0 {
+		return true
+	}
+	granted := strings.Fields(settings.AccessTokenScope)
+	if len(granted) == 0 {
+		granted = strings.Fields(defaultScope)
+	}
+	for _, want := range strings.Fields(extra) {
+		if !isAllowed(want, granted) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseInterspersed parses flags that may appear before, between or after
+// positional arguments and returns the positional ones.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
 func buildListParams(page, limit int, sort, filter, query, include, fields, resource string) map[string]string {
 	params := map[string]string{}
 	if page > 0 {
@@ -883,12 +1855,12 @@ func buildListParams(page, limit int, sort, filter, query, include, fields, reso
 
 func loadJSONInput(metaJSON, metaFile string) (map[string]any, error) {
 	if metaJSON != "" && metaFile != "" {
-		return nil, fmt.Errorf("use either --meta-json or --meta-file")
+		return nil, codedErrorf("PINGEN-INPUT-001", "use either --meta-json or --meta-file")
 	}
 	if metaFile != "" {
 		content, err := os.ReadFile(metaFile)
 		if err != nil {
-			return nil, err
+			return nil, codedErrorf("PINGEN-INPUT-002", "failed to read --meta-file: %w", err)
 		}
 		return parseJSONObject(content)
 	}
@@ -896,7 +1868,7 @@ func loadJSONInput(metaJSON, metaFile string) (map[string]any, error) {
 		if strings.HasPrefix(metaJSON, "@") {
 			content, err := os.ReadFile(strings.TrimPrefix(metaJSON, "@"))
 			if err != nil {
-				return nil, err
+				return nil, codedErrorf("PINGEN-INPUT-002", "failed to read --meta-json: %w", err)
 			}
 			return parseJSONObject(content)
 		}
@@ -907,16 +1879,26 @@ func loadJSONInput(metaJSON, metaFile string) (map[string]any, error) {
 
 func parseJSONObject(content []byte) (map[string]any, error) {
 	var parsed map[string]any
-	if err := json.Unmarshal(content, &parsed); err != nil {
-		return nil, fmt.Errorf("invalid JSON payload")
+	if err := decodeJSONNumbers(content, &parsed); err != nil {
+		return nil, codedErrorf("PINGEN-INPUT-002", "invalid JSON payload")
 	}
 	return parsed, nil
 }
 
+// decodeJSONNumbers unmarshals content keeping numbers as json.Number.
+func decodeJSONNumbers(content []byte, target any) error {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	return decoder.Decode(target)
+}
+
 func emitJSON(payload any) int {
+	if activeQuery != nil {
+		return emitQuery(payload)
+	}
 	encoded, err := json.MarshalIndent(payload, "", "  ")
 	if err != nil {
-		printError("failed to encode json", 0, "")
+		printErrorCode("PINGEN-OUTPUT-001", "failed to encode json")
 		return 1
 	}
 	fmt.Println(string(encoded))
@@ -943,12 +1925,28 @@ func stringValue(value any) string {
 	case fmt.Stringer:
 		return v.String()
 	case float64:
-		return fmt.Sprintf("%.0f", v)
+		return strconv.FormatFloat(v, 'f', -1, 64)
 	default:
 		return fmt.Sprintf("%v", value)
 	}
 }
 
+// int64Value converts a decoded JSON number to an int64.
+func int64Value(value any) (int64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		if parsed, err := v.Int64(); err == nil {
+			return parsed, true
+		}
+		parsed, err := v.Float64()
+		return int64(parsed), err == nil
+	case float64:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
 func isAllowed(value string, allowed []string) bool {
 	for _, item := range allowed {
 		if value == item {
@@ -958,13 +1956,55 @@ func isAllowed(value string, allowed []string) bool {
 	return false
 }
 
-func printError(message string, status int, requestID string) {
+// printErrorCode prints a CLI error under its catalog code (see explain).
+func printErrorCode(code, message string) {
+	printCodedError(code, message, 0, "")
+}
+
+// lastError is the most recent error line printed, kept for queue job records.
+var lastError string
+
+// printCodedError prints an error prefixed with its catalog code (see explain).
+func printCodedError(code, message string, status int, requestID string) {
+	message = redactText(message)
 	parts := []string{message}
+	if code != "" {
+		parts = []string{"[" + code + "]", message}
+	}
 	if status != 0 {
 		parts = append(parts, fmt.Sprintf("(HTTP %d)", status))
 	}
 	if requestID != "" {
 		parts = append(parts, fmt.Sprintf("request_id=%s", requestID))
 	}
-	fmt.Fprintln(os.Stderr, strings.Join(parts, " "))
+	lastError, lastErrorCode = strings.Join(parts, " "), code
+	if jsonErrors && !activeLogger.jsonFormat() {
+		payload := map[string]any{"error": message}
+		if code != "" {
+			payload["code"] = code
+		}
+		if status != 0 {
+			payload["status"] = status
+		}
+		if requestID != "" {
+			payload["request_id"] = requestID
+		}
+		emitErrorJSON(payload)
+		return
+	}
+	if !activeLogger.jsonFormat() {
+		activeLogger.log("error", lastError, nil)
+		return
+	}
+	fields := map[string]any{}
+	if code != "" {
+		fields["code"] = code
+	}
+	if status != 0 {
+		fields["status"] = status
+	}
+	if requestID != "" {
+		fields["request_id"] = requestID
+	}
+	activeLogger.log("error", message, fields)
 }
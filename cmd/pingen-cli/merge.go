@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// mergeTemplate renders the letter of one data row to a PDF at output.
+type mergeTemplate func(values map[string]string, output string) error
+
+// handleLettersMerge is mail merge: it fills the {{column}} placeholders of a
+// PDF or HTML template with each row of a CSV or XLSX file and creates one
+// letter per row. The columns of a bulk-create manifest (delivery_product,
+// meta_data.recipient.name, ...) set the letter's attributes; the file
+// column is not used.
+func handleLettersMerge(ctx appContext, args []string) int {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("letters merge", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	templatePath := fs.String("template", "", "PDF or HTML template with {{column}} placeholders")
+	data := fs.String("data", "", "CSV or XLSX file with one letter per row")
+	columnMap := fs.String("column-map", "", "Columns of non-standard layouts, e.g. delivery_product=C")
+	renderCmd := fs.String("render-cmd", "", "Shell command that turns $PINGEN_MERGE_INPUT (HTML) into $PINGEN_MERGE_OUTPUT (PDF)")
+	outDir := fs.String("out-dir", "", "Keep the personalized PDFs in this directory")
+	concurrency := fs.Int("concurrency", 4, "Letters uploaded and created in parallel")
+	reportOptions := addReportFlags(fs)
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli letters merge --template file.pdf|file.html --data file.csv|file.xlsx [--render-cmd cmd] [--column-map field=column,...] [--out-dir dir] [--concurrency N] [--report-dir dir [--csv-delimiter c] [--decimal-comma]]")
+		return 0
+	}
+	switch {
+	case *templatePath == "":
+		printErrorCode("PINGEN-INPUT-001", "--template is required")
+		return 2
+	case *data == "":
+		printErrorCode("PINGEN-INPUT-001", "--data is required")
+		return 2
+	case *concurrency < 1:
+		printErrorCode("PINGEN-INPUT-001", "--concurrency must be at least 1")
+		return 2
+	}
+	records, err := readBulkTable(*data, *columnMap)
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	table, err := pingen.ReadTable(*data)
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	render, names, err := loadMergeTemplate(*templatePath, *renderCmd)
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	columns := map[string]bool{}
+	for _, name := range table.Header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	for _, name := range names {
+		if !columns[strings.ToLower(name)] {
+			printErrorCode("PINGEN-INPUT-001", fmt.Sprintf("unknown placeholder {{%s}}: %s has no such column (columns: %s)", name, *data, mergeColumns(table.Header)))
+			return 2
+		}
+	}
+	if len(names) == 0 {
+		logf("warn", "%s has no {{column}} placeholders; every letter will be the same", *templatePath)
+	}
+	_, templateDigest, err := fileDigest(*templatePath)
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	dir := *outDir
+	if dir == "" {
+		if dir, err = os.MkdirTemp("", "pingen-merge-*"); err != nil {
+			reportError(ctx, err)
+			return 1
+		}
+		defer os.RemoveAll(dir)
+	} else if err := os.MkdirAll(dir, 0o700); err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	if reportOptions.dir == "" {
+		reportOptions.dir = filepath.Dir(*data)
+	}
+	dataPath, err := filepath.Abs(*data)
+	if err != nil {
+		dataPath = *data
+	}
+
+	base := strings.TrimSuffix(filepath.Base(*templatePath), filepath.Ext(*templatePath))
+	entries := make([]bulkEntry, 0, len(records))
+	for i, record := range records {
+		values := map[string]string{}
+		for column, name := range table.Header {
+			if column < len(table.Rows[i]) {
+				values[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(table.Rows[i][column])
+			}
+		}
+		entry := bulkEntry{Row: record.row, File: filepath.Join(dir, base+"-"+strconv.Itoa(record.row)+".pdf")}
+		if err := render(values, entry.File); err != nil {
+			entry.Result, entry.Error = "failed", err.Error()
+			entries = append(entries, entry)
+			continue
+		}
+		// The idempotency key comes from the template and the row rather
+		// than from the PDF, so renderers that stamp the time do not defeat
+		// it.
+		if stringValue(record.fields["idempotency_key"]) == "" {
+			encoded, _ := json.Marshal(values)
+			sum := sha256.Sum256([]byte(fmt.Sprintf("%s/%s/%d/%s/%s", ctx.settings.OrganisationID, dataPath, record.row, templateDigest, encoded)))
+			record.fields["idempotency_key"] = "merge-" + hex.EncodeToString(sum[:16])
+		}
+		if err := prepareBulkEntry(ctx, &entry, record, dir, dataPath); err != nil {
+			entry.Result, entry.Error = "failed", err.Error()
+		}
+		entries = append(entries, entry)
+	}
+	return createBulkEntries(ctx, "letters merge", "data", *data, entries, *concurrency, reportOptions)
+}
+
+// loadMergeTemplate returns the renderer for a PDF or HTML template and the
+// placeholders it uses.
+func loadMergeTemplate(path, renderCmd string) (mergeTemplate, []string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pdf":
+		if renderCmd != "" {
+			return nil, nil, codedErrorf("PINGEN-INPUT-001", "--render-cmd cannot be combined with a PDF template")
+		}
+		if err := pingen.PreflightPDF(path, 0); err != nil {
+			return nil, nil, err
+		}
+		template, err := pingen.LoadPDFTemplate(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if template.SubsetFonts && len(template.Names) > 0 {
+			logf("warn", "%s embeds font subsets; characters that only occur in the data may not print (embed the full fonts)", path)
+		}
+		return func(values map[string]string, output string) error {
+			return os.WriteFile(output, template.Fill(values), 0o600)
+		}, template.Names, nil
+	case ".html", ".htm":
+		if renderCmd == "" {
+			return nil, nil, codedErrorf("PINGEN-INPUT-001", "--render-cmd is required for HTML templates, e.g. --render-cmd 'wkhtmltopdf \"$PINGEN_MERGE_INPUT\" \"$PINGEN_MERGE_OUTPUT\"'")
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, codedErrorf("PINGEN-INPUT-001", "failed to read template: %w", err)
+		}
+		template := string(content)
+		return func(values map[string]string, output string) error {
+			input := strings.TrimSuffix(output, ".pdf") + ".html"
+			if err := os.WriteFile(input, []byte(pingen.FillHTML(template, values)), 0o600); err != nil {
+				return err
+			}
+			return runRenderCommand(renderCmd, input, output)
+		}, pingen.Placeholders(template), nil
+	}
+	return nil, nil, codedErrorf("PINGEN-INPUT-001", "invalid --template: use a .pdf or .html file")
+}
+
+// runRenderCommand runs --render-cmd for one letter and checks that it left
+// a PDF behind. Its output goes to stderr.
+func runRenderCommand(command, input, output string) error {
+	cmd := shellCommand(command)
+	cmd.Env = append(os.Environ(), "PINGEN_MERGE_INPUT="+input, "PINGEN_MERGE_OUTPUT="+output)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("render command failed: %v", err)
+	}
+	if err := pingen.PreflightPDF(output, 0); err != nil {
+		return fmt.Errorf("render command did not write a PDF: %v", err)
+	}
+	return nil
+}
+
+// mergeColumns lists the columns of a data file for messages.
+func mergeColumns(header []string) string {
+	columns := append([]string{}, header...)
+	sort.Strings(columns)
+	return strings.Join(columns, ", ")
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// orgSettingKeys are the organisation attributes shown by `org settings get`,
+// in display order.
+var orgSettingKeys = []string{
+	"default_country",
+	"default_address_position",
+	"data_retention_addresses",
+	"data_retention_pdf",
+	"billing_mode",
+	"billing_currency",
+	"limits_monthly_letters_count",
+}
+
+// orgSettableKeys are the attributes `org settings set` can change, in
+// display order. Those in orgNumericSettings are sent as JSON numbers.
+var orgSettableKeys = []string{
+	"name",
+	"default_country",
+	"default_address_position",
+	"data_retention_addresses",
+	"data_retention_pdf",
+	"limits_monthly_letters_count",
+	"color",
+}
+
+var orgNumericSettings = map[string]bool{
+	"data_retention_addresses":     true,
+	"data_retention_pdf":           true,
+	"limits_monthly_letters_count": true,
+}
+
+func handleOrgSettings(ctx appContext, args []string) int {
+	if len(args) == 0 {
+		fmt.Println("org settings requires a subcommand")
+		return 2
+	}
+	switch args[0] {
+	case "get":
+		return handleOrgSettingsGet(ctx, args[1:])
+	case "set":
+		return handleOrgSettingsSet(ctx, args[1:])
+	default:
+		fmt.Println("unknown org settings subcommand")
+		return 2
+	}
+}
+
+func handleOrgSettingsGet(ctx appContext, args []string) int {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("org settings get", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli org settings get")
+		return 0
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+	payload, headers, err := client.GetOrganisationRaw(ctx.jobContext, ctx.settings.OrganisationID)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	data, _ := payload["data"].(map[string]any)
+	attrs, _ := data["attributes"].(map[string]any)
+	settings := map[string]any{}
+	for _, key := range orgSettingKeys {
+		settings[key] = attrs[key]
+	}
+	result := map[string]any{"organisation_id": stringValue(data["id"]), "settings": settings}
+	return emitPayload(ctx, result, headers, func() {
+		for _, key := range orgSettingKeys {
+			fmt.Printf("%s: %s\n", key, stringValue(attrs[key]))
+		}
+	})
+}
+
+// handleOrgSettingsSet changes organisation settings given as key=value
+// arguments; the request is checked against the organisation-update schema.
+func handleOrgSettingsSet(ctx appContext, args []string) int {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("org settings set", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	schemaOnly := fs.Bool("schema-only", false, "Validate the request body against its schema and exit without network calls")
+	payloadFile := fs.String("payload", "", "With --schema-only, validate this request body (JSON file or -) instead of one built from the arguments")
+	help := fs.Bool("help", false, "show help")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil || applyParsedDefaults(ctx, fs) != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli org settings set key=value... [--schema-only [--payload file]]")
+		fmt.Println("Keys: " + strings.Join(orgSettableKeys, ", "))
+		return 0
+	}
+	if *payloadFile != "" {
+		return validatePayloadFile(ctx, "organisation-update", *payloadFile, *schemaOnly)
+	}
+	if len(positional) == 0 {
+		printErrorCode("PINGEN-INPUT-001", "at least one key=value setting required")
+		return 2
+	}
+	attributes := map[string]any{}
+	for _, arg := range positional {
+		key, value, ok := strings.Cut(arg, "=")
+		switch {
+		case !ok:
+			printErrorCode("PINGEN-INPUT-001", fmt.Sprintf("invalid setting %q (expected key=value)", arg))
+			return 2
+		case !isAllowed(key, orgSettableKeys):
+			printErrorCode("PINGEN-INPUT-001", fmt.Sprintf("unknown setting %q (use %s)", key, strings.Join(orgSettableKeys, ", ")))
+			return 2
+		case orgNumericSettings[key]:
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				printErrorCode("PINGEN-INPUT-001", fmt.Sprintf("%s must be a number", key))
+				return 2
+			}
+			attributes[key] = number
+		case key == "default_country":
+			attributes[key] = strings.ToUpper(value)
+		default:
+			attributes[key] = value
+		}
+	}
+	payload := map[string]any{"data": map[string]any{
+		"id":         ctx.settings.OrganisationID,
+		"type":       "organisations",
+		"attributes": attributes,
+	}}
+	if err := pingen.ValidatePayload("organisation-update", payload); err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	if *schemaOnly {
+		return reportSchemaValid("organisation-update")
+	}
+	if ctx.global.dryRun {
+		return emitDryRun(ctx, map[string]any{
+			"action":          "org.settings.set",
+			"organisation_id": ctx.settings.OrganisationID,
+			"payload":         payload,
+		}, func(client pingen.Client) error {
+			_, _, err := client.UpdateOrganisationRaw(ctx.jobContext, ctx.settings.OrganisationID, payload)
+			return err
+		})
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+	result, headers, err := client.UpdateOrganisationRaw(ctx.jobContext, ctx.settings.OrganisationID, payload)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	return emitPayload(ctx, result, headers, func() {
+		data, _ := result["data"].(map[string]any)
+		attrs, _ := data["attributes"].(map[string]any)
+		for _, key := range orgSettableKeys {
+			if _, changed := attributes[key]; !changed {
+				continue
+			}
+			fmt.Printf("%s: %s\n", key, stringValue(attrs[key]))
+		}
+	})
+}
+
+// resolveOrganisation finds the organisation value refers to among those the
+// token can access: a full id, an organisation name (case-insensitive) or a
+// unique id prefix. It returns the id and name.
+func resolveOrganisation(ctx *appContext, value string) (string, string, error) {
+	token, err := ensureAccessToken(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	client := newClient(*ctx, token)
+	var named, prefixed [][2]string
+	needle := strings.ToLower(strings.TrimSpace(value))
+	for page := 1; page <= prefixSearchPages; page++ {
+		payload, _, err := client.ListOrganisationsRaw(ctx.jobContext, map[string]string{"page[number]": strconv.Itoa(page), "page[limit]": "100"})
+		if err != nil {
+			return "", "", err
+		}
+		data, _ := payload["data"].([]any)
+		for _, entry := range data {
+			item, _ := entry.(map[string]any)
+			attrs, _ := item["attributes"].(map[string]any)
+			org := [2]string{stringValue(item["id"]), stringValue(attrs["name"])}
+			switch {
+			case strings.EqualFold(org[0], needle):
+				return org[0], org[1], nil
+			case strings.ToLower(org[1]) == needle:
+				named = append(named, org)
+			case strings.HasPrefix(strings.ToLower(org[0]), needle):
+				prefixed = append(prefixed, org)
+			}
+		}
+		if len(data) < 100 {
+			break
+		}
+	}
+	matches := named
+	if len(matches) == 0 {
+		matches = prefixed
+	}
+	switch len(matches) {
+	case 0:
+		return "", "", codedErrorf("PINGEN-INPUT-010", "unknown organisation: %s", value)
+	case 1:
+		return matches[0][0], matches[0][1], nil
+	}
+	ids := make([]string, 0, len(matches))
+	for _, org := range matches {
+		ids = append(ids, org[0])
+	}
+	return "", "", codedErrorf("PINGEN-INPUT-010", "ambiguous organisation %s: matches %s", value, strings.Join(ids, ", "))
+}
+
+func handleOrgGet(ctx appContext, args []string) int {
+	fs := flag.NewFlagSet("org get", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	pick := fs.Bool("pick", false, "Choose the organisation interactively")
+	help := fs.Bool("help", false, "show help")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil || applyParsedDefaults(ctx, fs) != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli org get [<id-or-name> | --pick]")
+		return 0
+	}
+	orgID := ctx.settings.OrganisationID
+	switch {
+	case len(positional) > 0 && isUUID(positional[0]):
+		orgID = positional[0]
+	case len(positional) > 0:
+		orgID, _, err = resolveOrganisation(&ctx, positional[0])
+	case *pick:
+		orgID, err = pickResource(&ctx, "organisations")
+	case orgID == "":
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+	payload, headers, err := client.GetOrganisationRaw(ctx.jobContext, orgID)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	return emitPayload(ctx, payload, headers, func() {
+		item, _ := payload["data"].(map[string]any)
+		attrs, _ := item["attributes"].(map[string]any)
+		fmt.Println(stringValue(item["id"]))
+		keys := make([]string, 0, len(attrs))
+		for key := range attrs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value := attrs[key]
+			if strings.HasSuffix(key, "_at") {
+				value = formatTimestamp(ctx, value)
+			}
+			fmt.Printf("%s: %s\n", key, stringValue(value))
+		}
+	})
+}
+
+// handleOrgUse makes an organisation the default by saving its id as
+// organisation_id in the user config.
+func handleOrgUse(ctx appContext, args []string) int {
+	fs := flag.NewFlagSet("org use", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	pick := fs.Bool("pick", false, "Choose the organisation interactively")
+	help := fs.Bool("help", false, "show help")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil || applyParsedDefaults(ctx, fs) != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli org use <id-or-name> | --pick")
+		return 0
+	}
+	var orgID, name string
+	switch {
+	case len(positional) > 0:
+		// Full ids are looked up as well, so that a typo is not saved.
+		orgID, name, err = resolveOrganisation(&ctx, positional[0])
+	case *pick:
+		orgID, err = pickResource(&ctx, "organisations")
+	default:
+		printErrorCode("PINGEN-INPUT-001", "organisation id or name required")
+		return 2
+	}
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	if ctx.global.dryRun {
+		return emitConfigPlan(ctx, "config.set", "organisation_id", orgID)
+	}
+	cfg, _, _ := loadConfig(ctx.configPath)
+	cfg.OrganisationID = orgID
+	if err := saveConfig(ctx, cfg); err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	if ctx.global.jsonOutput {
+		return emitJSON(map[string]any{"organisation_id": orgID, "name": name, "config": ctx.configPath})
+	}
+	if !ctx.global.quiet {
+		if name != "" {
+			fmt.Printf("using organisation %s (%s)\n", name, orgID)
+		} else {
+			fmt.Printf("using organisation %s\n", orgID)
+		}
+	}
+	return 0
+}
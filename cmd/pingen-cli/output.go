@@ -0,0 +1,308 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+)
+
+// envelopeHeaders are the response headers added by --include-headers.
+var envelopeHeaders = []string{
+	"X-Request-Id",
+	"X-Rate-Limit-Limit",
+	"X-Rate-Limit-Remaining",
+	"X-Rate-Limit-Reset",
+	"Retry-After",
+	"Location",
+}
+
+// emitPayload writes an API payload using the selected output mode. plain
+// renders the default human-readable form.
+func emitPayload(ctx appContext, payload map[string]any, headers http.Header, plain func()) int {
+	if ctx.global.templateName != "" {
+		return emitTemplate(ctx, payload)
+	}
+	if ctx.global.jsonOutput {
+		if ctx.global.includeHeaders {
+			payload["headers"] = selectHeaders(headers)
+		}
+		return emitJSON(payload)
+	}
+	if ctx.global.tableOutput || len(ctx.global.columns) > 0 {
+		items := payloadItems(payload)
+		columns := ctx.global.columns
+		if len(columns) == 0 {
+			columns = defaultColumns(items)
+		}
+		writeColumns(ctx, items, columns)
+		return 0
+	}
+	plain()
+	return 0
+}
+
+// tableColumns are the columns of --output table when --columns is not
+// given, by resource type.
+var tableColumns = map[string][]string{
+	"letters":       {"id", "status", "file_original_name", "country", "delivery_product", "created_at"},
+	"batches":       {"id", "name", "status", "letter_count", "created_at"},
+	"organisations": {"id", "name", "status"},
+	"webhooks":      {"id", "event_category", "url"},
+	"associations":  {"id", "relationships.organisation.data.id", "role", "status"},
+	"users":         {"id", "email", "first_name", "last_name", "status"},
+}
+
+// defaultColumns picks the table columns for the resource type of items,
+// falling back to the id and the resource's own attributes in name order.
+func defaultColumns(items []map[string]any) []string {
+	if len(items) == 0 {
+		return []string{"id"}
+	}
+	if columns, ok := tableColumns[stringValue(items[0]["type"])]; ok {
+		return columns
+	}
+	attrs, _ := items[0]["attributes"].(map[string]any)
+	if attrs == nil {
+		attrs = items[0]
+	}
+	columns := []string{}
+	for key, value := range attrs {
+		switch value.(type) {
+		case map[string]any, []any:
+			continue
+		}
+		columns = append(columns, key)
+	}
+	sort.Strings(columns)
+	if _, ok := items[0]["id"]; ok {
+		columns = append([]string{"id"}, columns...)
+	}
+	return columns
+}
+
+// writeColumns prints one line per item with the values of columns. Plain
+// output separates them with tabs; --output table aligns them under a
+// header line.
+func writeColumns(ctx appContext, items []map[string]any, columns []string) {
+	out := io.Writer(os.Stdout)
+	var table *tabwriter.Writer
+	if ctx.global.tableOutput {
+		table = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		out = table
+		headers := make([]string, len(columns))
+		for i, column := range columns {
+			headers[i] = strings.ToUpper(column[strings.LastIndex(column, ".")+1:])
+		}
+		fmt.Fprintln(out, strings.Join(headers, "\t"))
+	}
+	for _, item := range items {
+		values := make([]string, 0, len(columns))
+		for _, column := range columns {
+			value := lookupField(item, column)
+			if strings.HasSuffix(column, "_at") {
+				values = append(values, formatTimestamp(ctx, value))
+				continue
+			}
+			text := stringValue(value)
+			if table != nil {
+				// A tab or newline inside a value would break the alignment.
+				text = strings.Join(strings.Fields(text), " ")
+			}
+			values = append(values, text)
+		}
+		fmt.Fprintln(out, strings.Join(values, "\t"))
+	}
+	if table != nil {
+		table.Flush()
+	}
+}
+
+func selectHeaders(headers http.Header) map[string]string {
+	selected := map[string]string{}
+	for _, name := range envelopeHeaders {
+		if value := headers.Get(name); value != "" {
+			selected[name] = value
+		}
+	}
+	return selected
+}
+
+func emitTemplate(ctx appContext, payload map[string]any) int {
+	layout, ok := ctx.settings.OutputTemplates[ctx.global.templateName]
+	if !ok {
+		printErrorCode("PINGEN-CONFIG-005", fmt.Sprintf("unknown output template: %s", ctx.global.templateName))
+		return 2
+	}
+	items := payloadItems(payload)
+	if strings.Contains(layout, "{{") {
+		tmpl, err := template.New(ctx.global.templateName).Parse(layout)
+		if err != nil {
+			printErrorCode("PINGEN-OUTPUT-001", fmt.Sprintf("invalid output template: %v", err))
+			return 2
+		}
+		for _, item := range items {
+			if err := tmpl.Execute(os.Stdout, item); err != nil {
+				printErrorCode("PINGEN-OUTPUT-001", fmt.Sprintf("output template failed: %v", err))
+				return 1
+			}
+			fmt.Println()
+		}
+		return 0
+	}
+	writeColumns(ctx, items, splitColumns(layout))
+	return 0
+}
+
+// payloadItems returns the resources in a JSON:API payload. Payloads without
+// a data member are treated as a single item.
+func payloadItems(payload map[string]any) []map[string]any {
+	switch data := payload["data"].(type) {
+	case []any:
+		items := make([]map[string]any, 0, len(data))
+		for _, entry := range data {
+			item, _ := entry.(map[string]any)
+			items = append(items, item)
+		}
+		return items
+	case map[string]any:
+		return []map[string]any{data}
+	default:
+		return []map[string]any{payload}
+	}
+}
+
+func splitColumns(layout string) []string {
+	columns := []string{}
+	for _, column := range strings.Split(layout, ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// lookupField resolves a dotted path on a resource. The path is tried on the
+// resource itself, then on its attributes; "meta." also falls back to the
+// attributes.meta_data object.
+func lookupField(item map[string]any, path string) any {
+	if value, ok := lookupPath(item, path); ok {
+		return value
+	}
+	attrs, _ := item["attributes"].(map[string]any)
+	if value, ok := lookupPath(attrs, path); ok {
+		return value
+	}
+	if strings.HasPrefix(path, "meta.") {
+		if value, ok := lookupPath(attrs, "meta_data."+strings.TrimPrefix(path, "meta.")); ok {
+			return value
+		}
+	}
+	return nil
+}
+
+func lookupPath(value any, path string) (any, bool) {
+	current := value
+	for _, part := range strings.Split(path, ".") {
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		current, ok = object[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func handleOutputTemplates(ctx appContext, args []string) int {
+	if len(args) == 0 {
+		fmt.Println("output-templates requires a subcommand (save/list/delete)")
+		return 2
+	}
+	switch args[0] {
+	case "save":
+		fs := flag.NewFlagSet("output-templates save", flag.ContinueOnError)
+		fs.SetOutput(os.Stderr)
+		help := fs.Bool("help", false, "show help")
+		if err := parseFlags(ctx, fs, args[1:]); err != nil {
+			return 2
+		}
+		if *help || fs.NArg() < 2 {
+			fmt.Println("Usage: pingen-cli output-templates save <name> '<columns>|<go template>'")
+			if *help {
+				return 0
+			}
+			return 2
+		}
+		name, layout := fs.Arg(0), fs.Arg(1)
+		if strings.Contains(layout, "{{") {
+			if _, err := template.New(name).Parse(layout); err != nil {
+				printErrorCode("PINGEN-OUTPUT-001", fmt.Sprintf("invalid output template: %v", err))
+				return 2
+			}
+		}
+		cfg, _, err := loadConfig(ctx.configPath)
+		if err != nil {
+			printErrorCode("PINGEN-CONFIG-002", "failed to load config")
+			return 1
+		}
+		if cfg.OutputTemplates == nil {
+			cfg.OutputTemplates = map[string]string{}
+		}
+		cfg.OutputTemplates[name] = layout
+		if err := saveConfig(ctx, cfg); err != nil {
+			reportError(ctx, err)
+			return 1
+		}
+		if !ctx.global.quiet {
+			fmt.Printf("saved %s\n", name)
+		}
+		return 0
+	case "list":
+		if ctx.global.jsonOutput {
+			return emitJSON(ctx.settings.OutputTemplates)
+		}
+		names := make([]string, 0, len(ctx.settings.OutputTemplates))
+		for name := range ctx.settings.OutputTemplates {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%s\t%s\n", name, ctx.settings.OutputTemplates[name])
+		}
+		return 0
+	case "delete":
+		if len(args) < 2 {
+			fmt.Println("output-templates delete requires a name")
+			return 2
+		}
+		cfg, _, err := loadConfig(ctx.configPath)
+		if err != nil {
+			printErrorCode("PINGEN-CONFIG-002", "failed to load config")
+			return 1
+		}
+		if _, ok := cfg.OutputTemplates[args[1]]; !ok {
+			printErrorCode("PINGEN-CONFIG-005", fmt.Sprintf("unknown output template: %s", args[1]))
+			return 2
+		}
+		delete(cfg.OutputTemplates, args[1])
+		if err := saveConfig(ctx, cfg); err != nil {
+			reportError(ctx, err)
+			return 1
+		}
+		if !ctx.global.quiet {
+			fmt.Printf("deleted %s\n", args[1])
+		}
+		return 0
+	default:
+		fmt.Println("unknown output-templates subcommand")
+		return 2
+	}
+}
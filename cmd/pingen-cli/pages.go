@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// pageFetch returns one page of a JSON:API listing (1-based).
+type pageFetch func(page int) (map[string]any, error)
+
+// fetchAllPages collects the items of every page. When the first page reports
+// meta.last_page, the remaining pages are fetched by up to concurrency workers;
+// otherwise links.next is followed page by page. Items are returned in page
+// order and de-duplicated by id, since letters created while paging shift
+// later pages. The concurrent fetches stop when ctx ends.
+func fetchAllPages(ctx context.Context, concurrency int, fetch pageFetch) ([]map[string]any, error) {
+	items, _, _, err := fetchPages(ctx, concurrency, 0, fetch)
+	return items, err
+}
+
+// fetchPages is fetchAllPages with a limit: it stops after maxPages pages (0:
+// no limit) and also returns how many pages were read and whether pages were
+// left unread.
+func fetchPages(ctx context.Context, concurrency, maxPages int, fetch pageFetch) ([]map[string]any, int, bool, error) {
+	first, err := fetch(1)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	pages := []map[string]any{first}
+	truncated := false
+	meta, _ := first["meta"].(map[string]any)
+	lastPage, known := int64Value(meta["last_page"])
+	switch {
+	case len(pageItems(first)) == 0:
+	case known && concurrency > 1 && lastPage > 1:
+		last := int(lastPage)
+		if maxPages > 0 && last > maxPages {
+			last, truncated = maxPages, true
+		}
+		if last > 1 {
+			rest, err := fetchPagesConcurrently(ctx, 2, last, concurrency, fetch)
+			if err != nil {
+				return nil, 0, false, err
+			}
+			pages = append(pages, rest...)
+		}
+	default:
+		for page := 2; hasNextPage(pages[len(pages)-1]); page++ {
+			if maxPages > 0 && page > maxPages {
+				truncated = true
+				break
+			}
+			payload, err := fetch(page)
+			if err != nil {
+				return nil, 0, false, err
+			}
+			pages = append(pages, payload)
+		}
+	}
+
+	seen := map[string]bool{}
+	items := []map[string]any{}
+	for _, payload := range pages {
+		for _, item := range pageItems(payload) {
+			if id := stringValue(item["id"]); id != "" {
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+			}
+			items = append(items, item)
+		}
+	}
+	return items, len(pages), truncated, nil
+}
+
+// fetchPagesConcurrently fetches pages from..to and stops handing out pages
+// after the first error or when ctx ends.
+func fetchPagesConcurrently(ctx context.Context, from, to, concurrency int, fetch pageFetch) ([]map[string]any, error) {
+	results := make([]map[string]any, to-from+1)
+	poolContext, stop := context.WithCancel(ctx)
+	defer stop()
+	err := pingen.RunPool(poolContext, concurrency, len(results), func(_ context.Context, i int) error {
+		payload, err := fetch(from + i)
+		if err != nil {
+			stop()
+			return err
+		}
+		results[i] = payload
+		return nil
+	})
+	var poolErr *pingen.PoolError
+	if errors.As(err, &poolErr) && len(poolErr.Failed) > 0 {
+		return nil, poolErr.Failed[0].Err
+	}
+	if err != nil {
+		// Pages were skipped because ctx ended.
+		return nil, ctx.Err()
+	}
+	return results, nil
+}
+
+// walkPages fetches pages one after another, starting at page 1 and
+// following links.next, and passes the items of each page to visit, e.g. to
+// print rows as they arrive. Items already seen on an earlier page are
+// dropped. It stops after maxPages pages (0: no limit) and reports whether
+// pages were left unread.
+func walkPages(maxPages int, fetch pageFetch, visit func(items []map[string]any)) (int, bool, error) {
+	seen := map[string]bool{}
+	for page := 1; ; page++ {
+		if maxPages > 0 && page > maxPages {
+			return page - 1, true, nil
+		}
+		payload, err := fetch(page)
+		if err != nil {
+			return page - 1, false, err
+		}
+		items := []map[string]any{}
+		for _, item := range pageItems(payload) {
+			if id := stringValue(item["id"]); id != "" {
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+			}
+			items = append(items, item)
+		}
+		visit(items)
+		if !hasNextPage(payload) {
+			return page, false, nil
+		}
+	}
+}
+
+// withPage returns a copy of params that requests page, so that pages can be
+// fetched concurrently with the same parameters.
+func withPage(params map[string]string, page int) map[string]string {
+	copied := make(map[string]string, len(params)+1)
+	for key, value := range params {
+		copied[key] = value
+	}
+	copied["page[number]"] = strconv.Itoa(page)
+	return copied
+}
+
+func pageItems(payload map[string]any) []map[string]any {
+	data, _ := payload["data"].([]any)
+	items := make([]map[string]any, 0, len(data))
+	for _, entry := range data {
+		if item, ok := entry.(map[string]any); ok {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func hasNextPage(payload map[string]any) bool {
+	links, _ := payload["links"].(map[string]any)
+	return len(pageItems(payload)) > 0 && stringValue(links["next"]) != ""
+}
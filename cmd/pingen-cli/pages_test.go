@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// letterPages serves lastPage pages of two letters each. Page n holds
+// letters 2n-1 and 2n, except that shifted repeats the last letter of the
+// previous page first, as happens when letters are created while paging.
+type letterPages struct {
+	lastPage  int
+	withMeta  bool
+	shifted   bool
+	failPage  int
+	mu        sync.Mutex
+	requested []int
+}
+
+func (p *letterPages) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page[number]"))
+	if err != nil {
+		page = 1
+	}
+	p.mu.Lock()
+	p.requested = append(p.requested, page)
+	p.mu.Unlock()
+	if page == p.failPage {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errors":[{"status":"404","title":"Not Found"}]}`))
+		return
+	}
+	data := []any{}
+	if page <= p.lastPage {
+		first := 2*page - 1
+		if p.shifted && page > 1 {
+			first--
+		}
+		for id := first; id <= 2*page; id++ {
+			data = append(data, map[string]any{"id": fmt.Sprintf("l%d", id), "type": "letters"})
+		}
+	}
+	links := map[string]any{}
+	if page < p.lastPage {
+		links["next"] = fmt.Sprintf("%s?page[number]=%d", r.URL.Path, page+1)
+	}
+	payload := map[string]any{"data": data, "links": links}
+	if p.withMeta {
+		payload["meta"] = map[string]any{"current_page": page, "last_page": p.lastPage}
+	}
+	w.Header().Set("Content-Type", "application/vnd.api+json")
+	json.NewEncoder(w).Encode(payload)
+}
+
+func (p *letterPages) pages() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pages := append([]int(nil), p.requested...)
+	sort.Ints(pages)
+	return pages
+}
+
+func TestFetchPages(t *testing.T) {
+	tests := []struct {
+		name          string
+		server        *letterPages
+		concurrency   int
+		maxPages      int
+		wantIDs       string
+		wantPages     int
+		wantTruncated bool
+		wantRequested string
+		wantErr       bool
+	}{
+		{
+			name:          "single page",
+			server:        &letterPages{lastPage: 1, withMeta: true},
+			concurrency:   4,
+			wantIDs:       "l1,l2",
+			wantPages:     1,
+			wantRequested: "1",
+		},
+		{
+			name:          "concurrent pages from last_page",
+			server:        &letterPages{lastPage: 5, withMeta: true},
+			concurrency:   3,
+			wantIDs:       "l1,l2,l3,l4,l5,l6,l7,l8,l9,l10",
+			wantPages:     5,
+			wantRequested: "1,2,3,4,5",
+		},
+		{
+			name:          "links.next without meta",
+			server:        &letterPages{lastPage: 3},
+			concurrency:   3,
+			wantIDs:       "l1,l2,l3,l4,l5,l6",
+			wantPages:     3,
+			wantRequested: "1,2,3",
+		},
+		{
+			name:          "sequential with concurrency 1",
+			server:        &letterPages{lastPage: 3, withMeta: true},
+			concurrency:   1,
+			wantIDs:       "l1,l2,l3,l4,l5,l6",
+			wantPages:     3,
+			wantRequested: "1,2,3",
+		},
+		{
+			name:          "shifted pages are de-duplicated",
+			server:        &letterPages{lastPage: 3, withMeta: true, shifted: true},
+			concurrency:   2,
+			wantIDs:       "l1,l2,l3,l4,l5,l6",
+			wantPages:     3,
+			wantRequested: "1,2,3",
+		},
+		{
+			name:          "max pages with last_page",
+			server:        &letterPages{lastPage: 5, withMeta: true},
+			concurrency:   4,
+			maxPages:      2,
+			wantIDs:       "l1,l2,l3,l4",
+			wantPages:     2,
+			wantTruncated: true,
+			wantRequested: "1,2",
+		},
+		{
+			name:          "max pages with links.next",
+			server:        &letterPages{lastPage: 5},
+			maxPages:      3,
+			wantIDs:       "l1,l2,l3,l4,l5,l6",
+			wantPages:     3,
+			wantTruncated: true,
+			wantRequested: "1,2,3",
+		},
+		{
+			name:        "failed concurrent page",
+			server:      &letterPages{lastPage: 4, withMeta: true, failPage: 3},
+			concurrency: 2,
+			wantErr:     true,
+		},
+		{
+			name:          "failed next page",
+			server:        &letterPages{lastPage: 4, failPage: 2},
+			wantErr:       true,
+			wantRequested: "1,2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.server)
+			defer server.Close()
+			client := pingen.Client{APIBase: server.URL, AccessToken: "token"}
+			fetch := func(page int) (map[string]any, error) {
+				payload, _, err := client.ListLettersRaw(context.Background(), "org", withPage(map[string]string{"page[limit]": "2"}, page))
+				return payload, err
+			}
+
+			items, pages, truncated, err := fetchPages(context.Background(), tt.concurrency, tt.maxPages, fetch)
+			if tt.wantErr {
+				var apiErr pingen.APIError
+				if !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound {
+					t.Fatalf("fetchPages() error = %v, want the 404 APIError", err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("fetchPages() error = %v", err)
+				}
+				ids := []string{}
+				for _, item := range items {
+					ids = append(ids, stringValue(item["id"]))
+				}
+				if got := strings.Join(ids, ","); got != tt.wantIDs {
+					t.Errorf("ids = %s, want %s", got, tt.wantIDs)
+				}
+				if pages != tt.wantPages || truncated != tt.wantTruncated {
+					t.Errorf("pages, truncated = %d, %v; want %d, %v", pages, truncated, tt.wantPages, tt.wantTruncated)
+				}
+			}
+			if tt.wantRequested != "" {
+				requested := []string{}
+				for _, page := range tt.server.pages() {
+					requested = append(requested, strconv.Itoa(page))
+				}
+				if got := strings.Join(requested, ","); got != tt.wantRequested {
+					t.Errorf("requested pages %s, want %s", got, tt.wantRequested)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchPagesConcurrentlyStopsWhenContextEnds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	fetched := 0
+	fetch := func(page int) (map[string]any, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetched++
+		if page == 2 {
+			cancel()
+		}
+		return map[string]any{"data": []any{map[string]any{"id": strconv.Itoa(page)}}}, nil
+	}
+	_, err := fetchPagesConcurrently(ctx, 2, 20, 1, fetch)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("fetchPagesConcurrently() error = %v, want context.Canceled", err)
+	}
+	if fetched >= 19 {
+		t.Errorf("fetched %d pages after the context ended", fetched)
+	}
+}
+
+func TestWalkPages(t *testing.T) {
+	server := httptest.NewServer(&letterPages{lastPage: 3, shifted: true})
+	defer server.Close()
+	client := pingen.Client{APIBase: server.URL, AccessToken: "token"}
+	fetch := func(page int) (map[string]any, error) {
+		payload, _, err := client.ListLettersRaw(context.Background(), "org", withPage(nil, page))
+		return payload, err
+	}
+	batches := []string{}
+	pages, truncated, err := walkPages(0, fetch, func(items []map[string]any) {
+		ids := []string{}
+		for _, item := range items {
+			ids = append(ids, stringValue(item["id"]))
+		}
+		batches = append(batches, strings.Join(ids, ","))
+	})
+	if err != nil {
+		t.Fatalf("walkPages() error = %v", err)
+	}
+	if pages != 3 || truncated {
+		t.Errorf("pages, truncated = %d, %v; want 3, false", pages, truncated)
+	}
+	if got := strings.Join(batches, " | "); got != "l1,l2 | l3,l4 | l5,l6" {
+		t.Errorf("visited %s", got)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// defaultMaxPages caps the pages of a letter when neither the delivery
+// product nor the max_pages setting set a lower limit; thicker letters do
+// not fit the envelopes Pingen prints into.
+const defaultMaxPages = 250
+
+// productMaxPages are the page limits of delivery products that take fewer
+// pages than defaultMaxPages.
+var productMaxPages = map[string]int{"registered": 100}
+
+// maxLetterPages returns the page limit for product: max_pages when it is
+// set, otherwise the limit of the product.
+func maxLetterPages(ctx appContext, product string) int {
+	if ctx.settings.MaxPages > 0 {
+		return ctx.settings.MaxPages
+	}
+	if limit, ok := productMaxPages[product]; ok {
+		return limit
+	}
+	return defaultMaxPages
+}
+
+// checkPageLimit fails when the PDF at path has more pages than product
+// takes. Documents whose pages cannot be counted are left to the API.
+func checkPageLimit(ctx appContext, path, product string) error {
+	pages, err := pingen.CountPDFPages(path)
+	if err != nil {
+		verbosef(ctx, "not checking the page limit: %v", err)
+		return nil
+	}
+	if limit := maxLetterPages(ctx, product); pages > limit {
+		return codedErrorf("PINGEN-UPLOAD-003", "file has too many pages: %s has %d pages, the maximum is %d%s (max_pages)", path, pages, limit, productLabel(product))
+	}
+	return nil
+}
+
+func productLabel(product string) string {
+	if product == "" {
+		return ""
+	}
+	return " for " + product
+}
+
+// inspectPDF runs the pre-upload checks on the PDF at path and reports each
+// of them. The page format is only a warning; the API decides whether it
+// accepts pages other than A4.
+func inspectPDF(ctx appContext, path, product string) *doctorReport {
+	report := &doctorReport{}
+	if err := pingen.PreflightPDF(path, 0); err != nil {
+		report.add("format", "fail", err.Error(), "export the document again as an unprotected PDF")
+		return report
+	}
+	report.add("format", "ok", "PDF, not encrypted", "")
+	info, err := os.Stat(path)
+	if err != nil {
+		report.add("size", "fail", err.Error(), "")
+		return report
+	}
+	if limit := maxUploadSize(ctx); info.Size() > limit {
+		report.add("size", "fail", fmt.Sprintf("%s, the maximum is %s", pingen.FormatSize(info.Size()), pingen.FormatSize(limit)), "compress or split the document, or raise max_upload_size")
+	} else {
+		report.add("size", "ok", fmt.Sprintf("%s of at most %s", pingen.FormatSize(info.Size()), pingen.FormatSize(limit)), "")
+	}
+	limit := maxLetterPages(ctx, product)
+	if pages, err := pingen.CountPDFPages(path); err != nil {
+		report.add("pages", "warn", err.Error(), "the API checks the page count after the upload")
+	} else if pages > limit {
+		report.add("pages", "fail", fmt.Sprintf("%d, the maximum is %d%s", pages, limit, productLabel(product)), "split the document into several letters")
+	} else {
+		report.add("pages", "ok", fmt.Sprintf("%d of at most %d%s", pages, limit, productLabel(product)), "")
+	}
+	pages, err := pingen.ReadPDFPages(path)
+	if err != nil {
+		report.add("page format", "skip", err.Error(), "")
+		return report
+	}
+	for i, page := range pages {
+		widthMM, heightMM := page.Width*25.4/72, page.Height*25.4/72
+		if math.Abs(widthMM-210) > 2 || math.Abs(heightMM-297) > 2 {
+			report.add("page format", "warn", fmt.Sprintf("page %d is %.0f x %.0f mm", i+1, widthMM, heightMM), "Pingen prints on A4 portrait (210 x 297 mm); other formats may be scaled or rejected")
+			return report
+		}
+	}
+	report.add("page format", "ok", "A4 portrait", "")
+	return report
+}
+
+func handleLettersCheck(ctx appContext, args []string) int {
+	fs := flag.NewFlagSet("letters check", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	filePath := fs.String("file", "", "PDF file to check")
+	deliveryProduct := fs.String("delivery-product", "", "Check the page limit of this delivery product")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli letters check --file <path> [--delivery-product <product (see products list)>]")
+		return 0
+	}
+	if *filePath == "" {
+		printErrorCode("PINGEN-INPUT-001", "--file is required")
+		return 2
+	}
+	report := inspectPDF(ctx, *filePath, *deliveryProduct)
+	annotateChecks(report)
+	if ctx.global.jsonOutput {
+		emitJSON(map[string]any{"file": *filePath, "checks": report.checks, "ok": !report.failed()})
+	} else {
+		printDoctorReport(report)
+	}
+	if report.failed() {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// warnConfigPermissions complains when a config holding secrets can be read by
+// other users. It does not change anything; see `config fix-permissions`.
+func warnConfigPermissions(path string, cfg pingen.Config) {
+	if !cfg.HasSecrets() {
+		return
+	}
+	mode, insecure := pingen.InsecureFile(path)
+	if !insecure {
+		return
+	}
+	logf("warn", "%s contains credentials but is readable by other users (mode %04o); run `pingen-cli config fix-permissions` to restrict it to your user", path, mode)
+}
+
+// saveConfig writes cfg to the config path, keeping its secrets in the OS
+// keychain when possible. Secrets are not written into a directory other
+// users can write to, unless --force is given.
+func saveConfig(ctx appContext, cfg pingen.Config) error {
+	cfg = storeSecrets(ctx.configPath, cfg)
+	dir := filepath.Dir(ctx.configPath)
+	if mode, insecure := pingen.InsecureDir(dir); insecure && cfg.HasSecrets() && !ctx.global.force {
+		return codedErrorf("PINGEN-CONFIG-008", "refusing to write secrets: %s is writable by other users (mode %04o); fix it or pass --force", dir, mode)
+	}
+	if err := pingen.SaveConfig(ctx.configPath, cfg); err != nil {
+		return codedErrorf("PINGEN-CONFIG-003", "failed to save config: %w", err)
+	}
+	return nil
+}
+
+func handleConfigFixPermissions(ctx appContext) int {
+	changed, err := pingen.FixConfigPermissions(ctx.configPath)
+	if err != nil {
+		printErrorCode("PINGEN-CONFIG-008", fmt.Sprintf("failed to fix permissions: %v", err))
+		return 1
+	}
+	if ctx.global.jsonOutput {
+		return emitJSON(map[string]any{"changed": changed})
+	}
+	for _, path := range changed {
+		fmt.Printf("restricted %s\n", path)
+	}
+	dir := filepath.Dir(ctx.configPath)
+	if mode, insecure := pingen.InsecureDir(dir); insecure {
+		logf("warn", "%s is writable by other users (mode %04o); move the config to a private directory", dir, mode)
+		return 1
+	}
+	if len(changed) == 0 && !ctx.global.quiet {
+		fmt.Println("permissions already restricted")
+	}
+	return 0
+}
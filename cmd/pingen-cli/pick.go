@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// pickVisible is how many matches the picker shows at once.
+const pickVisible = 10
+
+var errPickCancelled = codedErrorf("PINGEN-INPUT-001", "pick cancelled")
+
+// pickItem is one resource offered by --pick.
+type pickItem struct {
+	id    string
+	label string
+}
+
+// pickResource implements --pick: it lists the newest resources of kind
+// (letters, batches, webhooks or organisations) and lets the user choose one
+// by fuzzy search on its id and attributes. The picker draws on stderr, so
+// stdout stays clean for the command's output.
+func pickResource(ctx *appContext, kind string) (string, error) {
+	if runtime.GOOS == "windows" || !stdinIsTerminal() {
+		return "", codedErrorf("PINGEN-INPUT-001", "--pick requires an interactive terminal")
+	}
+	token, err := ensureAccessToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	client := newClient(*ctx, token)
+	params := map[string]string{"page[number]": "1", "page[limit]": "100"}
+	var payload map[string]any
+	switch kind {
+	case "letters":
+		params["sort"] = "-created_at"
+		payload, _, err = client.ListLettersRaw(ctx.jobContext, ctx.settings.OrganisationID, params)
+	case "batches":
+		params["sort"] = "-created_at"
+		payload, _, err = client.ListBatchesRaw(ctx.jobContext, ctx.settings.OrganisationID, params)
+	case "webhooks":
+		payload, _, err = client.ListWebhooksRaw(ctx.jobContext, ctx.settings.OrganisationID, params)
+	case "organisations":
+		payload, _, err = client.ListOrganisationsRaw(ctx.jobContext, params)
+	}
+	if err != nil {
+		return "", err
+	}
+	items := []pickItem{}
+	data, _ := payload["data"].([]any)
+	for _, entry := range data {
+		item, _ := entry.(map[string]any)
+		attrs, _ := item["attributes"].(map[string]any)
+		columns := []string{stringValue(item["id"])}
+		switch kind {
+		case "letters":
+			columns = append(columns, stringValue(attrs["status"]), stringValue(attrs["file_original_name"]), formatTimestamp(*ctx, attrs["created_at"]))
+		case "batches":
+			columns = append(columns, stringValue(attrs["status"]), stringValue(attrs["name"]), formatTimestamp(*ctx, attrs["created_at"]))
+		case "webhooks":
+			columns = append(columns, stringValue(attrs["event_category"]), stringValue(attrs["url"]))
+		case "organisations":
+			columns = append(columns, stringValue(attrs["status"]), stringValue(attrs["name"]))
+		}
+		items = append(items, pickItem{id: columns[0], label: strings.Join(columns, "  ")})
+	}
+	if len(items) == 0 {
+		return "", codedErrorf("PINGEN-INPUT-001", "no %s to pick from", kind)
+	}
+	singular := map[string]string{"letters": "letter", "batches": "batch", "webhooks": "webhook", "organisations": "organisation"}
+	return runPicker(singular[kind], items)
+}
+
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// runPicker shows items under a search prompt until one is chosen with
+// Enter. Typing filters, Up/Down or Ctrl-P/Ctrl-N move, Ctrl-U clears the
+// query, and Esc or Ctrl-C cancels.
+func runPicker(kind string, items []pickItem) (string, error) {
+	restore, err := rawTerminal()
+	if err != nil {
+		return "", codedErrorf("PINGEN-INPUT-001", "--pick requires an interactive terminal: %v", err)
+	}
+	defer restore()
+	width := terminalWidth()
+	reader := bufio.NewReader(os.Stdin)
+	query := []rune{}
+	selected, drawn := 0, 0
+	for {
+		matches := filterPickItems(items, string(query))
+		if selected >= len(matches) {
+			selected = len(matches) - 1
+		}
+		if selected < 0 {
+			selected = 0
+		}
+		drawn = drawPicker(kind, string(query), matches, len(items), selected, drawn, width)
+		key, err := readPickKey(reader)
+		if err != nil {
+			clearPicker(drawn)
+			return "", errPickCancelled
+		}
+		switch key {
+		case '\r', '\n':
+			if len(matches) > 0 {
+				clearPicker(drawn)
+				return matches[selected].id, nil
+			}
+		case 3, 4:
+			clearPicker(drawn)
+			return "", errPickCancelled
+		case 27:
+			// A lone Esc is followed by no further byte within the read
+			// timeout; arrow keys arrive as Esc [ A or Esc O A.
+			next, _, err := reader.ReadRune()
+			if err == io.EOF {
+				clearPicker(drawn)
+				return "", errPickCancelled
+			}
+			if next == '[' || next == 'O' {
+				switch code, _, _ := reader.ReadRune(); code {
+				case 'A':
+					selected--
+				case 'B':
+					selected++
+				}
+			}
+		case 16:
+			selected--
+		case 14:
+			selected++
+		case 21:
+			query = query[:0]
+			selected = 0
+		case 127, 8:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				selected = 0
+			}
+		default:
+			if unicode.IsPrint(key) {
+				query = append(query, key)
+				selected = 0
+			}
+		}
+	}
+}
+
+// readPickKey waits for the next key. The terminal is set up so that reads
+// return io.EOF after a short idle time.
+func readPickKey(reader *bufio.Reader) (rune, error) {
+	for {
+		key, _, err := reader.ReadRune()
+		if err != io.EOF {
+			return key, err
+		}
+	}
+}
+
+// drawPicker redraws the picker over the previous frame of previous lines and
+// returns the number of lines drawn.
+func drawPicker(kind, query string, matches []pickItem, total, selected, previous, width int) int {
+	var frame strings.Builder
+	if previous > 1 {
+		fmt.Fprintf(&frame, "\033[%dA", previous-1)
+	}
+	frame.WriteString("\r\033[J")
+	fmt.Fprintf(&frame, "pick %s> %s\r\n", kind, query)
+	start := 0
+	if selected >= pickVisible {
+		start = selected - pickVisible + 1
+	}
+	lines := 1
+	for i := start; i < len(matches) && i < start+pickVisible; i++ {
+		label := truncateRunes(matches[i].label, width-3)
+		if i == selected {
+			fmt.Fprintf(&frame, "\033[7m> %s\033[0m\r\n", label)
+		} else {
+			fmt.Fprintf(&frame, "  %s\r\n", label)
+		}
+		lines++
+	}
+	fmt.Fprintf(&frame, "\033[2m  %d/%d\033[0m", len(matches), total)
+	lines++
+	fmt.Fprint(os.Stderr, frame.String())
+	return lines
+}
+
+func clearPicker(drawn int) {
+	if drawn > 1 {
+		fmt.Fprintf(os.Stderr, "\033[%dA", drawn-1)
+	}
+	fmt.Fprint(os.Stderr, "\r\033[J")
+}
+
+func truncateRunes(text string, limit int) string {
+	runes := []rune(text)
+	if limit < 1 || len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit-1]) + "…"
+}
+
+// filterPickItems returns the items matching query, best match first; ties
+// keep the listing order (newest first).
+func filterPickItems(items []pickItem, query string) []pickItem {
+	if query == "" {
+		return items
+	}
+	type scored struct {
+		item  pickItem
+		score int
+	}
+	matches := []scored{}
+	for _, item := range items {
+		if score, ok := fuzzyScore(query, item.label); ok {
+			matches = append(matches, scored{item, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+	result := make([]pickItem, 0, len(matches))
+	for _, match := range matches {
+		result = append(result, match.item)
+	}
+	return result
+}
+
+// fuzzyScore reports whether the characters of query appear in text in order,
+// ignoring case. Runs of consecutive characters and matches at the start of a
+// word score higher, as in fzf.
+func fuzzyScore(query, text string) (int, bool) {
+	needle := []rune(strings.ToLower(query))
+	haystack := []rune(strings.ToLower(text))
+	score, next, last := 0, 0, -2
+	for i, r := range haystack {
+		if next == len(needle) {
+			break
+		}
+		if r != needle[next] {
+			continue
+		}
+		score++
+		if i == last+1 {
+			score += 5
+		}
+		if i == 0 || strings.ContainsRune(" -_./", haystack[i-1]) {
+			score += 3
+		}
+		last = i
+		next++
+	}
+	return score, next == len(needle)
+}
+
+// rawTerminal puts the terminal on stdin into raw mode without echo, with
+// reads that return after 0.1s without input, and returns the function that
+// restores its previous settings.
+func rawTerminal() (func(), error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("raw", "-echo", "min", "0", "time", "1"); err != nil {
+		return nil, err
+	}
+	fmt.Fprint(os.Stderr, "\033[?25l")
+	return func() {
+		fmt.Fprint(os.Stderr, "\033[?25h")
+		_, _ = stty(strings.TrimSpace(saved))
+	}, nil
+}
+
+// terminalWidth returns the number of columns of the terminal, or 80.
+func terminalWidth() int {
+	_, columns := terminalSize()
+	return columns
+}
+
+// terminalSize returns the rows and columns of the terminal, or 24x80.
+func terminalSize() (int, int) {
+	size, err := stty("size")
+	if fields := strings.Fields(size); err == nil && len(fields) == 2 {
+		rows, rowsErr := strconv.Atoi(fields[0])
+		columns, columnsErr := strconv.Atoi(fields[1])
+		if rowsErr == nil && columnsErr == nil && rows > 0 && columns > 0 {
+			return rows, columns
+		}
+	}
+	return 24, 80
+}
+
+// stty runs stty on the terminal at stdin and returns its output.
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	output, err := cmd.Output()
+	return string(output), err
+}
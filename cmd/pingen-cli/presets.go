@@ -0,0 +1,192 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+func handleFilters(ctx appContext, args []string) int {
+	if len(args) == 0 {
+		fmt.Println("filters requires a subcommand (save/list/show/delete)")
+		return 2
+	}
+	switch args[0] {
+	case "save":
+		return handleFiltersSave(ctx, args[1:])
+	case "list":
+		cfg, _, err := loadConfig(ctx.configPath)
+		if err != nil {
+			printErrorCode("PINGEN-CONFIG-002", "failed to load config")
+			return 1
+		}
+		if ctx.global.jsonOutput {
+			return emitJSON(cfg.FilterPresets)
+		}
+		names := make([]string, 0, len(cfg.FilterPresets))
+		for name := range cfg.FilterPresets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%s\t%s\n", name, describePreset(cfg.FilterPresets[name]))
+		}
+		return 0
+	case "show":
+		if len(args) < 2 {
+			fmt.Println("filters show requires a name")
+			return 2
+		}
+		preset, err := lookupPreset(ctx, args[1])
+		if err != nil {
+			reportError(ctx, err)
+			return 2
+		}
+		return emitJSON(preset)
+	case "delete":
+		if len(args) < 2 {
+			fmt.Println("filters delete requires a name")
+			return 2
+		}
+		cfg, _, err := loadConfig(ctx.configPath)
+		if err != nil {
+			printErrorCode("PINGEN-CONFIG-002", "failed to load config")
+			return 1
+		}
+		if _, ok := cfg.FilterPresets[args[1]]; !ok {
+			printErrorCode("PINGEN-CONFIG-005", fmt.Sprintf("unknown filter preset: %s", args[1]))
+			return 2
+		}
+		delete(cfg.FilterPresets, args[1])
+		if err := saveConfig(ctx, cfg); err != nil {
+			reportError(ctx, err)
+			return 1
+		}
+		if !ctx.global.quiet {
+			fmt.Printf("deleted %s\n", args[1])
+		}
+		return 0
+	default:
+		fmt.Println("unknown filters subcommand")
+		return 2
+	}
+}
+
+func handleFiltersSave(ctx appContext, args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Println("filters save requires a name")
+		return 2
+	}
+	name := args[0]
+	fs := flag.NewFlagSet("filters save", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	var where stringList
+	fs.Var(&where, "where", "Filter clause (repeatable)")
+	filter := fs.String("filter", "", "Filter JSON string or @path")
+	sortExpr := fs.String("sort", "", "Server-side sort expression")
+	sortBy := fs.String("sort-by", "", "Client-side sort fields")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args[1:]); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli filters save <name> [--where clause]... [--filter json] [--sort expr] [--sort-by fields]")
+		return 0
+	}
+	preset := pingen.FilterPreset{Where: where, Sort: *sortExpr, SortBy: *sortBy}
+	if *filter != "" {
+		// Store the resolved JSON so the preset keeps working if the file moves.
+		resolved, err := compileFilter(*filter, nil)
+		if err != nil {
+			reportError(ctx, err)
+			return 2
+		}
+		preset.Filter = resolved
+	}
+	if _, err := compileFilter(preset.Filter, preset.Where); err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+
+	cfg, _, err := loadConfig(ctx.configPath)
+	if err != nil {
+		printErrorCode("PINGEN-CONFIG-002", "failed to load config")
+		return 1
+	}
+	if cfg.FilterPresets == nil {
+		cfg.FilterPresets = map[string]pingen.FilterPreset{}
+	}
+	cfg.FilterPresets[name] = preset
+	if err := saveConfig(ctx, cfg); err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	if !ctx.global.quiet {
+		fmt.Printf("saved %s\n", name)
+	}
+	return 0
+}
+
+func lookupPreset(ctx appContext, name string) (pingen.FilterPreset, error) {
+	preset, ok := ctx.settings.FilterPresets[name]
+	if !ok {
+		return pingen.FilterPreset{}, codedErrorf("PINGEN-CONFIG-005", "unknown filter preset: %s", name)
+	}
+	return preset, nil
+}
+
+// applyPreset merges a saved preset with flags given on the command line.
+// Where clauses and filters are combined; explicit sort flags win.
+func applyPreset(ctx appContext, name string, filter, sortExpr, sortBy *string, where *stringList) error {
+	if name == "" {
+		return nil
+	}
+	preset, err := lookupPreset(ctx, name)
+	if err != nil {
+		return err
+	}
+	*where = append(append(stringList{}, preset.Where...), (*where)...)
+	if preset.Filter != "" {
+		if *filter == "" {
+			*filter = preset.Filter
+		} else {
+			combined, err := compileFilter(preset.Filter, nil)
+			if err != nil {
+				return err
+			}
+			explicit, err := compileFilter(*filter, nil)
+			if err != nil {
+				return err
+			}
+			*filter = fmt.Sprintf(`{"and":[%s,%s]}`, combined, explicit)
+		}
+	}
+	if *sortExpr == "" {
+		*sortExpr = preset.Sort
+	}
+	if *sortBy == "" {
+		*sortBy = preset.SortBy
+	}
+	return nil
+}
+
+func describePreset(preset pingen.FilterPreset) string {
+	parts := []string{}
+	for _, clause := range preset.Where {
+		parts = append(parts, "--where "+clause)
+	}
+	if preset.Filter != "" {
+		parts = append(parts, "--filter "+preset.Filter)
+	}
+	if preset.Sort != "" {
+		parts = append(parts, "--sort "+preset.Sort)
+	}
+	if preset.SortBy != "" {
+		parts = append(parts, "--sort-by "+preset.SortBy)
+	}
+	return strings.Join(parts, " ")
+}
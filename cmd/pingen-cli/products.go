@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// deliveryProductCacheTTL bounds how long the delivery products of an
+// organisation are reused to check --delivery-product.
+const deliveryProductCacheTTL = 24 * time.Hour
+
+func handleProducts(ctx appContext, args []string) int {
+	if len(args) == 0 {
+		fmt.Println("products requires a subcommand")
+		return 2
+	}
+	switch args[0] {
+	case "list":
+		return handleProductsList(ctx, args[1:])
+	default:
+		fmt.Println("unknown products subcommand")
+		return 2
+	}
+}
+
+// handleProductsList shows the delivery products of the organisation with
+// their destination countries, delivery time, starting price and features.
+func handleProductsList(ctx appContext, args []string) int {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("products list", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	country := fs.String("country", "", "Only products for this destination country (ISO 3166-1 alpha-2)")
+	refresh := fs.Bool("refresh", false, "Fetch the products even if a cached copy is recent")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli products list [--country CC] [--refresh]")
+		return 0
+	}
+	countryCode := strings.ToUpper(strings.TrimSpace(*country))
+	if countryCode != "" && !countryCodePattern.MatchString(countryCode) {
+		printErrorCode("PINGEN-INPUT-001", "--country must be a two-letter country code")
+		return 2
+	}
+	products, err := deliveryProductCatalog(&ctx, *refresh)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	data := []any{}
+	for _, item := range products {
+		if countryCode == "" || productServes(item, countryCode) {
+			data = append(data, item)
+		}
+	}
+	payload := map[string]any{"data": data}
+	return emitPayload(ctx, payload, nil, func() {
+		for _, entry := range data {
+			item, _ := entry.(map[string]any)
+			attrs, _ := item["attributes"].(map[string]any)
+			fmt.Printf("%s\t%s\t%s\t%s\tfrom %s %s\t%s\n",
+				stringValue(item["id"]),
+				stringValue(attrs["name"]),
+				strings.Join(anyStrings(attrs["countries"]), ","),
+				productDeliveryTime(attrs["delivery_time_days"]),
+				stringValue(attrs["price_currency"]),
+				stringValue(attrs["price_starting_from"]),
+				strings.Join(anyStrings(attrs["features"]), ","))
+		}
+	})
+}
+
+// checkDeliveryProduct checks a --delivery-product value and returns the
+// value to send. The generic products (fast, cheap, bulk, premium,
+// registered) let Pingen choose the carrier; they are accepted when the
+// organisation has a product of that category for country (see
+// genericProductAvailable). Any other value must be the id or name of one of
+// the organisation's delivery products that serves country (any country when
+// country is ""); a name is replaced by the product id. When the products
+// cannot be loaded the value is passed on unchecked and the API decides.
+func checkDeliveryProduct(ctx *appContext, product, country string) (string, error) {
+	products, err := deliveryProductCatalog(ctx, false)
+	if err != nil {
+		logf("warn", "could not load the delivery products to check %q: %v", product, err)
+		return product, nil
+	}
+	if isAllowed(product, deliveryProducts) {
+		if genericProductAvailable(products, product, country) {
+			return product, nil
+		}
+		if country == "" {
+			return "", codedErrorf("PINGEN-INPUT-001", "invalid delivery-product %q: not offered by any delivery product of the organisation (see products list)", product)
+		}
+		return "", codedErrorf("PINGEN-INPUT-001", "invalid delivery-product %q: not available for %s (see products list --country %s)", product, country, country)
+	}
+	for _, entry := range products {
+		item, _ := entry.(map[string]any)
+		attrs, _ := item["attributes"].(map[string]any)
+		id := stringValue(item["id"])
+		if id != product && !strings.EqualFold(stringValue(attrs["name"]), product) {
+			continue
+		}
+		if country != "" && !productServes(item, country) {
+			return "", codedErrorf("PINGEN-INPUT-001", "invalid delivery-product %q: not available for %s (see products list --country %s)", product, country, country)
+		}
+		return id, nil
+	}
+	return "", codedErrorf("PINGEN-INPUT-001", "invalid delivery-product %q (use %s, or a product id or name from products list)", product, strings.Join(deliveryProducts, ", "))
+}
+
+// genericProductAvailable reports whether the generic product category is
+// offered for country (any country when country is ""). Products name their
+// categories among their features; when none of the products serving country
+// does, any product serving it is taken to cover every category.
+func genericProductAvailable(products []any, category, country string) bool {
+	served, categorised := false, false
+	for _, entry := range products {
+		if country != "" && !productServes(entry, country) {
+			continue
+		}
+		served = true
+		item, _ := entry.(map[string]any)
+		attrs, _ := item["attributes"].(map[string]any)
+		for _, feature := range anyStrings(attrs["features"]) {
+			if feature == category {
+				return true
+			}
+			if isAllowed(feature, deliveryProducts) {
+				categorised = true
+			}
+		}
+	}
+	return served && !categorised
+}
+
+// letterCountry returns the destination country of a letter, or "" when the
+// letter cannot be read.
+func letterCountry(ctx *appContext, letterID string) string {
+	token, err := ensureAccessToken(ctx)
+	if err != nil {
+		return ""
+	}
+	payload, _, err := newClient(*ctx, token).GetLetterRaw(ctx.jobContext, ctx.settings.OrganisationID, letterID)
+	if err != nil {
+		return ""
+	}
+	data, _ := payload["data"].(map[string]any)
+	attrs, _ := data["attributes"].(map[string]any)
+	return strings.ToUpper(stringValue(attrs["country"]))
+}
+
+// deliveryProductCatalog returns every delivery product of the organisation,
+// from a cache of up to deliveryProductCacheTTL unless refresh is set.
+func deliveryProductCatalog(ctx *appContext, refresh bool) ([]any, error) {
+	path, pathErr := deliveryProductCachePath(ctx.settings.OrganisationID)
+	if pathErr == nil && !refresh {
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) < deliveryProductCacheTTL {
+			if content, err := os.ReadFile(path); err == nil {
+				var products []any
+				if json.Unmarshal(content, &products) == nil {
+					verbosef(*ctx, "using cached delivery products from %s", path)
+					return products, nil
+				}
+			}
+		}
+	}
+	token, err := ensureAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client := newClient(*ctx, token)
+	params := map[string]string{"page[limit]": "100"}
+	products := []any{}
+	_, _, err = walkPages(0, func(page int) (map[string]any, error) {
+		params["page[number]"] = strconv.Itoa(page)
+		payload, _, err := client.ListDeliveryProductsRaw(ctx.jobContext, ctx.settings.OrganisationID, params)
+		return payload, err
+	}, func(items []map[string]any) {
+		for _, item := range items {
+			products = append(products, item)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if pathErr == nil {
+		if encoded, err := json.Marshal(products); err == nil && os.MkdirAll(filepath.Dir(path), 0o700) == nil {
+			_ = os.WriteFile(path, encoded, 0o600)
+		}
+	}
+	return products, nil
+}
+
+func deliveryProductCachePath(orgID string) (string, error) {
+	dir, err := pingen.CacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "delivery-products", orgID+".json"), nil
+}
+
+// productServes reports whether a delivery product delivers to country.
+func productServes(item any, country string) bool {
+	product, _ := item.(map[string]any)
+	attrs, _ := product["attributes"].(map[string]any)
+	for _, code := range anyStrings(attrs["countries"]) {
+		if strings.EqualFold(code, country) {
+			return true
+		}
+	}
+	return false
+}
+
+// productDeliveryTime renders delivery_time_days, e.g. [1, 2], as "1-2 days".
+func productDeliveryTime(value any) string {
+	days := anyStrings(value)
+	switch {
+	case len(days) == 0:
+		return "-"
+	case len(days) == 1 || days[0] == days[len(days)-1]:
+		if days[0] == "1" {
+			return "1 day"
+		}
+		return days[0] + " days"
+	}
+	return days[0] + "-" + days[len(days)-1] + " days"
+}
+
+func anyStrings(value any) []string {
+	list, _ := value.([]any)
+	values := make([]string, 0, len(list))
+	for _, entry := range list {
+		values = append(values, stringValue(entry))
+	}
+	return values
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// journalDir holds job journals (queued and resumable runs).
+func journalDir() (string, error) {
+	dir, err := pingen.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "journal"), nil
+}
+
+// auditDir holds the local audit trail of mutating commands.
+func auditDir() (string, error) {
+	dir, err := pingen.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "audit"), nil
+}
+
+func handlePurge(ctx appContext, args []string) int {
+	flags := flag.NewFlagSet("purge", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	cache := flags.Bool("cache", false, "Delete cached API data (completion, delivery products, update check)")
+	journal := flags.Bool("journal", false, "Delete job journals")
+	audit := flags.Bool("audit", false, "Delete the local audit log")
+	tokens := flags.Bool("tokens", false, "Remove stored access and refresh tokens from the config")
+	help := flags.Bool("help", false, "show help")
+	if err := parseFlags(ctx, flags, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli purge [--cache] [--journal] [--audit] [--tokens]  (no flags: all)")
+		return 0
+	}
+	if !*cache && !*journal && !*audit && !*tokens {
+		*cache, *journal, *audit, *tokens = true, true, true, true
+	}
+
+	targets := []func() (string, error){}
+	if *cache {
+		targets = append(targets, pingen.CacheDir)
+	}
+	if *journal {
+		targets = append(targets, journalDir)
+	}
+	if *audit {
+		targets = append(targets, auditDir)
+	}
+	removed := []string{}
+	for _, target := range targets {
+		dir, err := target()
+		if err != nil {
+			printErrorCode("PINGEN-CONFIG-007", "failed to resolve state directory")
+			return 1
+		}
+		if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		removed = append(removed, dir)
+		if ctx.global.dryRun {
+			continue
+		}
+		if err := shredDir(dir); err != nil {
+			printErrorCode("PINGEN-CONFIG-007", fmt.Sprintf("failed to purge %s: %v", dir, err))
+			return 1
+		}
+	}
+
+	tokensCleared := false
+	if *tokens && ctx.configLoaded {
+		cfg, _, err := loadConfig(ctx.configPath)
+		if err != nil {
+			printErrorCode("PINGEN-CONFIG-002", "failed to load config")
+			return 1
+		}
+		if cfg.AccessToken != "" || cfg.AccessTokenExpiresAt != 0 || cfg.RefreshToken != "" {
+			tokensCleared = true
+			cfg.AccessToken = ""
+			cfg.AccessTokenExpiresAt = 0
+			cfg.AccessTokenScope = ""
+			cfg.RefreshToken = ""
+			if !ctx.global.dryRun {
+				if err := saveConfig(ctx, cfg); err != nil {
+					reportError(ctx, err)
+					return 1
+				}
+			}
+		}
+	}
+
+	if ctx.global.jsonOutput || ctx.global.dryRun {
+		return emitJSON(map[string]any{
+			"dry_run":        ctx.global.dryRun,
+			"removed":        removed,
+			"tokens_cleared": tokensCleared,
+		})
+	}
+	if ctx.global.quiet {
+		return 0
+	}
+	for _, dir := range removed {
+		fmt.Printf("removed %s\n", dir)
+	}
+	if tokensCleared {
+		fmt.Printf("cleared stored access token in %s\n", ctx.configPath)
+	}
+	if len(removed) == 0 && !tokensCleared {
+		fmt.Println("nothing to purge")
+	}
+	return 0
+}
+
+// shredDir overwrites every regular file under dir with zeros before removing
+// the tree. This is best effort: journaling and copy-on-write filesystems or
+// SSD wear levelling may keep older copies of the data.
+func shredDir(dir string) error {
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		return shredFile(path)
+	})
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+func shredFile(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err == nil {
+		zeros := make([]byte, 32*1024)
+		for remaining := info.Size(); remaining > 0 && err == nil; {
+			chunk := int64(len(zeros))
+			if remaining < chunk {
+				chunk = remaining
+			}
+			_, err = file.Write(zeros[:chunk])
+			remaining -= chunk
+		}
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
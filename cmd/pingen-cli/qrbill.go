@@ -0,0 +1,241 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// The payment part of a QR-bill (Swiss Implementation Guidelines) is the
+// bottom 105 mm of an A4 portrait page: a 62 mm receipt on the left and a
+// 148 mm payment part with a 46 x 46 mm Swiss QR Code, both with 5 mm margins.
+const (
+	qrBillHeight      = 105.0
+	qrBillReceipt     = 62.0
+	qrBillMargin      = 5.0
+	qrBillCodeSize    = 46.0
+	qrBillTolerance   = 3.0
+	qrCodeSizeMaxSkew = 1.0
+	pointsPerMM       = 72 / 25.4
+)
+
+var (
+	paymentPartHeadings = []string{"Zahlteil", "Section paiement", "Sezione pagamento", "Payment part"}
+	receiptHeadings     = []string{"Empfangsschein", "Récépissé", "Ricevuta", "Receipt"}
+
+	qrBillIBAN        = regexp.MustCompile(`(?:CH|LI)\d{7}[0-9A-Z]{12}`)
+	qrBillQRReference = regexp.MustCompile(`^\d{27}$`)
+	qrBillRFReference = regexp.MustCompile(`^RF\d{2}[0-9A-Z]{1,21}$`)
+	qrBillCurrency    = regexp.MustCompile(`\b(CHF|EUR)\b`)
+)
+
+// findHeading returns the lowest run on page starting with one of headings;
+// the payment part is at the bottom, so mentions in the letter body are
+// passed over.
+func findHeading(page pingen.PDFPage, headings []string) (pingen.TextRun, bool) {
+	found, ok := pingen.TextRun{}, false
+	for _, run := range page.Runs {
+		text := strings.ToLower(strings.TrimSpace(run.Text))
+		for _, heading := range headings {
+			if strings.HasPrefix(text, strings.ToLower(heading)) && (!ok || run.Y < found.Y) {
+				found, ok = run, true
+			}
+		}
+	}
+	return found, ok
+}
+
+// inspectQRBill checks the placement of every QR-bill payment part in the PDF
+// at path and the account, reference and currency printed on it. The Swiss QR
+// Code itself is measured but not decoded; its human-readable counterpart is
+// validated instead.
+func inspectQRBill(path string) (*doctorReport, error) {
+	pages, err := pingen.ReadPDFPages(path)
+	if err != nil {
+		return nil, err
+	}
+	report := &doctorReport{}
+	for i, page := range pages {
+		heading, ok := findHeading(page, paymentPartHeadings)
+		if !ok {
+			continue
+		}
+		checkQRBillPage(report, fmt.Sprintf("page %d", i+1), page, heading)
+	}
+	if len(report.checks) == 0 {
+		report.add("payment part", "fail", "no QR-bill payment part found (looked for the headings "+strings.Join(paymentPartHeadings, ", ")+")", "scanned QR-bills contain no text and cannot be checked")
+	}
+	return report, nil
+}
+
+func checkQRBillPage(report *doctorReport, label string, page pingen.PDFPage, heading pingen.TextRun) {
+	mm := func(points float64) float64 { return points / pointsPerMM }
+	widthMM, heightMM := mm(page.Width), mm(page.Height)
+	report.add(label+" payment part", "ok", fmt.Sprintf("%q heading found", strings.TrimSpace(heading.Text)), "")
+
+	if math.Abs(widthMM-210) > qrBillTolerance || math.Abs(heightMM-297) > qrBillTolerance {
+		report.add(label+" page size", "fail", fmt.Sprintf("%.0f x %.0f mm", widthMM, heightMM), "QR-bills must be on A4 portrait pages (210 x 297 mm)")
+	} else {
+		report.add(label+" page size", "ok", "A4 portrait", "")
+	}
+
+	// Headings are measured at their baseline, which lies a few millimetres
+	// below the 5 mm margin of the payment part.
+	left, fromBottom := mm(heading.X), mm(heading.Y)
+	if left < qrBillReceipt || left > qrBillReceipt+qrBillMargin+qrBillTolerance || fromBottom > qrBillHeight-qrBillMargin+qrBillTolerance || fromBottom < qrBillHeight-qrBillMargin-15 {
+		report.add(label+" position", "fail", fmt.Sprintf("payment part heading at %.0f mm from the left and %.0f mm from the bottom", left, fromBottom),
+			fmt.Sprintf("the payment part must fill the bottom %.0f mm of the page, starting %.0f mm from the left edge; do not scale the page to fit", qrBillHeight, qrBillReceipt))
+	} else {
+		report.add(label+" position", "ok", fmt.Sprintf("bottom %.0f mm, payment part from %.0f mm", qrBillHeight, qrBillReceipt), "")
+	}
+
+	if receipt, ok := findHeading(page, receiptHeadings); !ok {
+		report.add(label+" receipt", "warn", "no receipt heading found", "the receipt belongs left of the payment part; without it the bill is rejected at the post office counter")
+	} else if mm(receipt.X) > qrBillMargin+qrBillTolerance || math.Abs(receipt.Y-heading.Y) > qrBillTolerance*pointsPerMM {
+		report.add(label+" receipt", "fail", fmt.Sprintf("receipt heading at %.0f mm from the left", mm(receipt.X)), "the receipt must be the leftmost 62 mm of the bill, level with the payment part")
+	} else {
+		report.add(label+" receipt", "ok", "", "")
+	}
+
+	checkQRCode(report, label, page, mm)
+
+	lines := pingen.TextLines(page.Runs, 0, 0, page.Width, qrBillHeight*pointsPerMM)
+	iban, qrReference, rfReference, currency := "", "", "", ""
+	for _, line := range lines {
+		compact := strings.ReplaceAll(line, " ", "")
+		if iban == "" {
+			iban = qrBillIBAN.FindString(compact)
+		}
+		if qrReference == "" && qrBillQRReference.MatchString(compact) {
+			qrReference = line
+		}
+		if rfReference == "" && qrBillRFReference.MatchString(compact) {
+			rfReference = line
+		}
+		if currency == "" {
+			currency = qrBillCurrency.FindString(line)
+		}
+	}
+
+	switch {
+	case iban == "":
+		report.add(label+" account", "fail", "no CH or LI IBAN found in the payment part", "QR-bills are payable only to Swiss and Liechtenstein accounts")
+	case !pingen.ValidIBAN(iban):
+		report.add(label+" account", "fail", "IBAN "+iban+" has invalid check digits", "")
+	case pingen.IsQRIBAN(iban):
+		report.add(label+" account", "ok", "QR-IBAN "+iban, "")
+	default:
+		report.add(label+" account", "ok", "IBAN "+iban, "")
+	}
+
+	switch {
+	case qrReference != "" && !pingen.ValidQRReference(qrReference):
+		report.add(label+" reference", "fail", "QR reference "+qrReference+" has an invalid check digit", "")
+	case qrReference != "" && iban != "" && !pingen.IsQRIBAN(iban):
+		report.add(label+" reference", "fail", "QR reference with a regular IBAN", "QR references are only valid with a QR-IBAN; use a creditor reference (RF...) or no reference")
+	case qrReference != "":
+		report.add(label+" reference", "ok", "QR reference "+qrReference, "")
+	case rfReference != "" && !pingen.ValidCreditorReference(rfReference):
+		report.add(label+" reference", "fail", "creditor reference "+rfReference+" has invalid check digits", "")
+	case pingen.IsQRIBAN(iban):
+		report.add(label+" reference", "fail", "QR-IBAN without a QR reference", "payments to a QR-IBAN need a 27-digit QR reference")
+	case rfReference != "":
+		report.add(label+" reference", "ok", "creditor reference "+rfReference, "")
+	default:
+		report.add(label+" reference", "ok", "no reference", "")
+	}
+
+	if currency == "" {
+		report.add(label+" currency", "fail", "no CHF or EUR amount found", "")
+	} else {
+		report.add(label+" currency", "ok", currency, "")
+	}
+}
+
+// checkQRCode looks for a square image in the payment part and checks that it
+// is printed at 46 x 46 mm. Codes drawn as vector paths are not measured.
+func checkQRCode(report *doctorReport, label string, page pingen.PDFPage, mm func(float64) float64) {
+	var code *pingen.ImageBox
+	for i, image := range page.Images {
+		width, height := mm(image.X1-image.X0), mm(image.Y1-image.Y0)
+		if mm(image.X0) < qrBillReceipt-qrBillTolerance || mm(image.Y1) > qrBillHeight+qrBillTolerance || width < 20 || math.Abs(width-height) > qrCodeSizeMaxSkew {
+			continue
+		}
+		code = &page.Images[i]
+		break
+	}
+	if code == nil {
+		report.add(label+" QR code", "warn", "no QR code image found in the payment part", "codes drawn as vector graphics cannot be measured; check that the code is 46 x 46 mm")
+		return
+	}
+	width, height := mm(code.X1-code.X0), mm(code.Y1-code.Y0)
+	switch {
+	case math.Abs(width-qrBillCodeSize) > qrCodeSizeMaxSkew || math.Abs(height-qrBillCodeSize) > qrCodeSizeMaxSkew:
+		report.add(label+" QR code", "fail", fmt.Sprintf("%.1f x %.1f mm", width, height), "the Swiss QR Code must be printed at 46 x 46 mm; scaled codes are rejected by scanners")
+	case mm(code.X0) < qrBillReceipt+qrBillMargin-qrBillTolerance || mm(code.Y0) < qrBillMargin-1:
+		report.add(label+" QR code", "fail", fmt.Sprintf("%.0f mm from the left, %.0f mm from the bottom", mm(code.X0), mm(code.Y0)), "keep the code at least 5 mm inside the payment part")
+	default:
+		report.add(label+" QR code", "ok", fmt.Sprintf("%.1f x %.1f mm", width, height), "")
+	}
+}
+
+// checkQRBill implements `letters create --check-qr-bill`: it fails when the
+// PDF has no payment part or one of its checks fails.
+func checkQRBill(path string) error {
+	report, err := inspectQRBill(path)
+	if err != nil {
+		return err
+	}
+	problems := []string{}
+	for _, check := range report.checks {
+		if check.Status == "fail" {
+			problems = append(problems, check.Name+": "+check.Detail)
+		}
+	}
+	if len(problems) > 0 {
+		return codedErrorf("PINGEN-INPUT-008", "QR-bill check failed: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func handleLettersCheckQRBill(ctx appContext, args []string) int {
+	fs := flag.NewFlagSet("letters check-qr-bill", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	filePath := fs.String("file", "", "PDF file to check")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli letters check-qr-bill --file <path>")
+		return 0
+	}
+	if *filePath == "" {
+		printErrorCode("PINGEN-INPUT-001", "--file is required")
+		return 2
+	}
+	if err := pingen.PreflightPDF(*filePath, maxUploadSize(ctx)); err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	report, err := inspectQRBill(*filePath)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	annotateChecks(report)
+	if ctx.global.jsonOutput {
+		emitJSON(map[string]any{"checks": report.checks, "ok": !report.failed()})
+	} else {
+		printDoctorReport(report)
+	}
+	if report.failed() {
+		return 1
+	}
+	return 0
+}
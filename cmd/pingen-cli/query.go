@@ -0,0 +1,551 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A small jq-like expression language for conditions on API responses:
+//
+//	.data.attributes.status == "sent"
+//	.data.attributes.price_value > 2 and .data.attributes.country != "CH"
+//	not .data.meta.abilities.cancel
+//	.data.attributes.paper_types[0] == "normal"
+//
+// Paths start with "." and select object keys and array indexes; missing
+// values are null. Only null and false are falsy, as in jq. For --query, the
+// leading dot may be left out, and [] maps the rest of the path over an
+// array, JMESPath-style: data[].attributes.status is the list of statuses.
+
+type queryToken struct {
+	kind  string // path, string, number, ident, op, (, ), end
+	text  string
+	value any
+	path  []any // string keys, int indexes and projections
+}
+
+// projection is the [] path segment.
+type projection struct{}
+
+type queryExpr interface {
+	eval(document any) (any, error)
+}
+
+type pathExpr struct{ path []any }
+type literalExpr struct{ value any }
+type notExpr struct{ operand queryExpr }
+type binaryExpr struct {
+	op          string
+	left, right queryExpr
+}
+
+// compileQuery parses expression for repeated evaluation.
+func compileQuery(expression string) (queryExpr, error) {
+	tokens, err := tokenizeQuery(expression)
+	if err != nil {
+		return nil, err
+	}
+	parser := &queryParser{tokens: tokens}
+	expr, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if next := parser.peek(); next.kind != "end" {
+		return nil, codedErrorf("PINGEN-INPUT-002", "invalid query: unexpected %q", next.text)
+	}
+	return expr, nil
+}
+
+// evalCondition evaluates expr against document and applies jq truthiness.
+func evalCondition(expr queryExpr, document any) (bool, error) {
+	value, err := expr.eval(document)
+	if err != nil {
+		return false, err
+	}
+	return truthy(value), nil
+}
+
+func tokenizeQuery(input string) ([]queryToken, error) {
+	tokens := []queryToken{}
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '.':
+			path, next, err := scanPath(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, queryToken{kind: "path", text: string(runes[i:next]), path: path})
+			i = next
+		case r == '"' || r == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				if runes[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(runes) {
+				return nil, codedErrorf("PINGEN-INPUT-002", "invalid query: unterminated string")
+			}
+			raw := string(runes[i+1 : end])
+			text, err := strconv.Unquote(`"` + strings.ReplaceAll(raw, `"`, `\"`) + `"`)
+			if err != nil {
+				text = raw
+			}
+			tokens = append(tokens, queryToken{kind: "string", text: string(runes[i : end+1]), value: text})
+			i = end + 1
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			end := i + 1
+			for end < len(runes) && (unicode.IsDigit(runes[end]) || runes[end] == '.' || runes[end] == 'e' || runes[end] == 'E') {
+				end++
+			}
+			number, err := strconv.ParseFloat(string(runes[i:end]), 64)
+			if err != nil {
+				return nil, codedErrorf("PINGEN-INPUT-002", "invalid query: bad number %q", string(runes[i:end]))
+			}
+			tokens = append(tokens, queryToken{kind: "number", text: string(runes[i:end]), value: number})
+			i = end
+		case unicode.IsLetter(r) || r == '_':
+			end := i
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_') {
+				end++
+			}
+			word := string(runes[i:end])
+			if isAllowed(word, queryKeywords) {
+				tokens = append(tokens, queryToken{kind: "ident", text: word})
+				i = end
+				continue
+			}
+			// A bare key starts a path, as in data[].id.
+			rest, next, err := scanPath(runes, end)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, queryToken{kind: "path", text: string(runes[i:next]), path: append([]any{word}, rest...)})
+			i = next
+		case r == '(' || r == ')':
+			tokens = append(tokens, queryToken{kind: string(r), text: string(r)})
+			i++
+		default:
+			op := ""
+			for _, candidate := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!"} {
+				if strings.HasPrefix(string(runes[i:]), candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, codedErrorf("PINGEN-INPUT-002", "invalid query: unexpected %q", string(r))
+			}
+			tokens = append(tokens, queryToken{kind: "op", text: op})
+			i += len(op)
+		}
+	}
+	return append(tokens, queryToken{kind: "end", text: "end of expression"}), nil
+}
+
+// scanPath reads a path such as .data.attributes["file-name"][0] starting at
+// the leading dot and returns its segments and the index after it.
+func scanPath(runes []rune, start int) ([]any, int, error) {
+	path := []any{}
+	i := start
+	for i < len(runes) {
+		switch runes[i] {
+		case '.':
+			i++
+			end := i
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_' || runes[end] == '-') {
+				end++
+			}
+			if end > i {
+				path = append(path, string(runes[i:end]))
+			}
+			i = end
+		case '[':
+			end := i + 1
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, 0, codedErrorf("PINGEN-INPUT-002", "invalid query: unterminated [")
+			}
+			inner := strings.TrimSpace(string(runes[i+1 : end]))
+			if inner == "" {
+				path = append(path, projection{})
+			} else if index, err := strconv.Atoi(inner); err == nil {
+				path = append(path, index)
+			} else {
+				path = append(path, strings.Trim(inner, `"'`))
+			}
+			i = end + 1
+		default:
+			return path, i, nil
+		}
+	}
+	return path, i, nil
+}
+
+// queryKeywords are the words that do not start a path.
+var queryKeywords = []string{"and", "or", "not", "true", "false", "null"}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() queryToken { return p.tokens[p.pos] }
+
+func (p *queryParser) next() queryToken {
+	token := p.tokens[p.pos]
+	if token.kind != "end" {
+		p.pos++
+	}
+	return token
+}
+
+func (p *queryParser) isKeyword(words ...string) (string, bool) {
+	token := p.peek()
+	if token.kind != "op" && token.kind != "ident" {
+		return "", false
+	}
+	for _, word := range words {
+		if token.text == word {
+			return word, true
+		}
+	}
+	return "", false
+}
+
+func (p *queryParser) parseOr() (queryExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.isKeyword("or", "||"); !ok {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: "or", left: left, right: right}
+	}
+}
+
+func (p *queryParser) parseAnd() (queryExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.isKeyword("and", "&&"); !ok {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: "and", left: left, right: right}
+	}
+}
+
+func (p *queryParser) parseNot() (queryExpr, error) {
+	if _, ok := p.isKeyword("not", "!"); ok {
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *queryParser) parseComparison() (queryExpr, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if op, ok := p.isKeyword("==", "!=", "<", "<=", ">", ">="); ok {
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return binaryExpr{op: op, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseOperand() (queryExpr, error) {
+	token := p.next()
+	switch token.kind {
+	case "path":
+		return pathExpr{path: token.path}, nil
+	case "string", "number":
+		return literalExpr{value: token.value}, nil
+	case "ident":
+		switch token.text {
+		case "true":
+			return literalExpr{value: true}, nil
+		case "false":
+			return literalExpr{value: false}, nil
+		case "null":
+			return literalExpr{value: nil}, nil
+		}
+	case "(":
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != ")" {
+			return nil, codedErrorf("PINGEN-INPUT-002", "invalid query: expected ) but found %q", closing.text)
+		}
+		return expr, nil
+	}
+	return nil, codedErrorf("PINGEN-INPUT-002", "invalid query: unexpected %q", token.text)
+}
+
+func (e pathExpr) eval(document any) (any, error) {
+	return walkPath(document, e.path), nil
+}
+
+// walkPath follows path from current. At a projection, the rest of the path
+// is applied to each element of the array and the results are collected;
+// nested projections are flattened into one list, like the stream of jq's
+// .[].
+func walkPath(current any, path []any) any {
+	for i, segment := range path {
+		switch key := segment.(type) {
+		case string:
+			object, ok := current.(map[string]any)
+			if !ok {
+				return nil
+			}
+			current = object[key]
+		case int:
+			list, ok := current.([]any)
+			if !ok {
+				return nil
+			}
+			if key < 0 {
+				key += len(list)
+			}
+			if key < 0 || key >= len(list) {
+				return nil
+			}
+			current = list[key]
+		case projection:
+			list, ok := current.([]any)
+			if !ok {
+				return nil
+			}
+			results := []any{}
+			for _, item := range list {
+				result := walkPath(item, path[i+1:])
+				if nested, ok := result.([]any); ok && hasProjection(path[i+1:]) {
+					results = append(results, nested...)
+				} else {
+					results = append(results, result)
+				}
+			}
+			return results
+		}
+	}
+	return current
+}
+
+func hasProjection(path []any) bool {
+	for _, segment := range path {
+		if _, ok := segment.(projection); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (e literalExpr) eval(any) (any, error) { return e.value, nil }
+
+func (e notExpr) eval(document any) (any, error) {
+	value, err := e.operand.eval(document)
+	if err != nil {
+		return nil, err
+	}
+	return !truthy(value), nil
+}
+
+func (e binaryExpr) eval(document any) (any, error) {
+	left, err := e.left.eval(document)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "and":
+		if !truthy(left) {
+			return false, nil
+		}
+	case "or":
+		if truthy(left) {
+			return true, nil
+		}
+	}
+	right, err := e.right.eval(document)
+	if err != nil {
+		return nil, err
+	}
+	if e.op == "and" || e.op == "or" {
+		return truthy(right), nil
+	}
+	left, right = normalizeQueryValue(left), normalizeQueryValue(right)
+	switch e.op {
+	case "==":
+		return reflect.DeepEqual(left, right), nil
+	case "!=":
+		return !reflect.DeepEqual(left, right), nil
+	}
+	leftNumber, leftIsNumber := left.(float64)
+	rightNumber, rightIsNumber := right.(float64)
+	if leftIsNumber && rightIsNumber {
+		return compareOrdered(e.op, leftNumber < rightNumber, leftNumber == rightNumber), nil
+	}
+	leftText, leftIsText := left.(string)
+	rightText, rightIsText := right.(string)
+	if leftIsText && rightIsText {
+		return compareOrdered(e.op, leftText < rightText, leftText == rightText), nil
+	}
+	// Ordering null, booleans, objects or mixed types is never true.
+	return false, nil
+}
+
+func compareOrdered(op string, less, equal bool) bool {
+	switch op {
+	case "<":
+		return less
+	case "<=":
+		return less || equal
+	case ">":
+		return !less && !equal
+	}
+	return !less
+}
+
+// normalizeQueryValue turns json.Number into float64, also inside lists
+// and objects, so that numbers from responses compare with numeric
+// literals. Only comparisons use it; paths return the numbers unchanged.
+func normalizeQueryValue(value any) any {
+	switch typed := value.(type) {
+	case json.Number:
+		if parsed, err := typed.Float64(); err == nil {
+			return parsed
+		}
+	case []any:
+		list := make([]any, len(typed))
+		for i, item := range typed {
+			list[i] = normalizeQueryValue(item)
+		}
+		return list
+	case map[string]any:
+		object := make(map[string]any, len(typed))
+		for key, item := range typed {
+			object[key] = normalizeQueryValue(item)
+		}
+		return object
+	}
+	return value
+}
+
+func truthy(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	}
+	return true
+}
+
+// outputQuery is the --query applied to the JSON output of a command.
+type outputQuery struct {
+	expr queryExpr
+	// raw prints strings unquoted and lists of scalars one per line, like
+	// jq -r; it is off with --json or --output json.
+	raw bool
+}
+
+// activeQuery is set by run when --query is given. Like activeRedactor it is
+// process-wide, so that every emitJSON applies it.
+var activeQuery *outputQuery
+
+// emitQuery prints the result of activeQuery on payload.
+func emitQuery(payload any) int {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		printErrorCode("PINGEN-OUTPUT-001", "failed to encode json")
+		return 1
+	}
+	var document any
+	decoder := json.NewDecoder(strings.NewReader(string(encoded)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		printErrorCode("PINGEN-OUTPUT-001", "failed to encode json")
+		return 1
+	}
+	result, err := activeQuery.expr.eval(document)
+	if err != nil {
+		printErrorCode(codeForError(err), err.Error())
+		return 1
+	}
+	if activeQuery.raw {
+		if lines, ok := rawLines(result); ok {
+			for _, line := range lines {
+				fmt.Println(line)
+			}
+			return 0
+		}
+	}
+	encoded, err = json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		printErrorCode("PINGEN-OUTPUT-001", "failed to encode json")
+		return 1
+	}
+	fmt.Println(string(encoded))
+	return 0
+}
+
+// rawLines formats a scalar, or a list of scalars, as lines. Objects and
+// nested lists are printed as JSON instead.
+func rawLines(value any) ([]string, bool) {
+	switch typed := value.(type) {
+	case map[string]any:
+		return nil, false
+	case []any:
+		lines := make([]string, 0, len(typed))
+		for _, item := range typed {
+			switch item.(type) {
+			case map[string]any, []any:
+				return nil, false
+			}
+			line, _ := rawLines(item)
+			lines = append(lines, line...)
+		}
+		return lines, true
+	case string:
+		return []string{typed}, true
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, false
+	}
+	return []string{string(encoded)}, true
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const queryDocument = `{
+  "data": [
+    {"id": "l1", "attributes": {"status": "sent", "price_value": 1.10, "pages": 2, "tags": ["a", "b"]}},
+    {"id": "l2", "attributes": {"status": "valid", "price_value": 0.85, "pages": 10, "tags": []}}
+  ],
+  "meta": {"current_page": 1, "last_page": 3, "abilities": {"cancel": false}}
+}`
+
+func decodeQueryDocument(t *testing.T) any {
+	t.Helper()
+	var document any
+	if err := decodeJSONNumbers([]byte(queryDocument), &document); err != nil {
+		t.Fatal(err)
+	}
+	return document
+}
+
+func TestEvalCondition(t *testing.T) {
+	document := decodeQueryDocument(t)
+	tests := []struct {
+		expression string
+		want       bool
+		wantErr    bool
+	}{
+		{expression: `.data[0].attributes.status == "sent"`, want: true},
+		{expression: `.data[0].attributes.status == 'sent'`, want: true},
+		{expression: `.data[0].attributes.status != "sent"`, want: false},
+		{expression: `.data[-1].id == "l2"`, want: true},
+		{expression: `.data[5].id == null`, want: true},
+		{expression: `.data[0].attributes.price_value > 1`, want: true},
+		{expression: `.data[0].attributes.price_value == 1.1`, want: true},
+		{expression: `.data[1].attributes.pages >= 10`, want: true},
+		{expression: `.data[1].attributes.pages < 9`, want: false},
+		{expression: `.meta.last_page <= .meta.current_page`, want: false},
+		{expression: `.data[0].attributes.status < "valid"`, want: true},
+		{expression: `.data[0].attributes.status > 1`, want: false},
+		{expression: `.data[].attributes.pages == [2, 10]`, wantErr: true},
+		{expression: `.data[].attributes.status == .data[].attributes.status`, want: true},
+		{expression: `.meta.abilities.cancel`, want: false},
+		{expression: `not .meta.abilities.cancel`, want: true},
+		{expression: `! .meta.abilities.cancel`, want: true},
+		{expression: `.meta.missing`, want: false},
+		{expression: `.data[1].attributes.tags`, want: true},
+		{expression: `.meta.last_page == 3 and .data[0].id == "l1"`, want: true},
+		{expression: `.meta.last_page == 3 && .data[0].id == "l2"`, want: false},
+		{expression: `.data[0].id == "l2" or .data[1].id == "l2"`, want: true},
+		{expression: `.data[0].id == "l2" || (.meta.abilities.cancel == false and true)`, want: true},
+		{expression: `data[0].id == "l1"`, want: true},
+		{expression: `.data[0].id ==`, wantErr: true},
+		{expression: `.data[0.id`, wantErr: true},
+		{expression: `.data[0].id == "l1`, wantErr: true},
+		{expression: `.data[0].id == "l1" )`, wantErr: true},
+		{expression: `.data[0].id = "l1"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			expr, err := compileQuery(tt.expression)
+			if err == nil {
+				var got bool
+				got, err = evalCondition(expr, document)
+				if err == nil && got != tt.want {
+					t.Errorf("evalCondition() = %v, want %v", got, tt.want)
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && codeForError(err) != "PINGEN-INPUT-002" {
+				t.Errorf("error code = %s, want PINGEN-INPUT-002", codeForError(err))
+			}
+		})
+	}
+}
+
+func TestQueryPaths(t *testing.T) {
+	document := decodeQueryDocument(t)
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{expression: `.data[0].id`, want: `"l1"`},
+		{expression: `data[].id`, want: `["l1","l2"]`},
+		// Numbers keep the exact text of the response.
+		{expression: `.data[0].attributes.price_value`, want: `1.10`},
+		{expression: `data[].attributes.price_value`, want: `[1.10,0.85]`},
+		{expression: `data[].attributes.tags[]`, want: `["a","b"]`},
+		{expression: `.data[0].attributes["tags"][-1]`, want: `"b"`},
+		{expression: `.meta.abilities`, want: `{"cancel":false}`},
+		{expression: `.meta.missing.deeper`, want: `null`},
+		{expression: `.meta[0]`, want: `null`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			expr, err := compileQuery(tt.expression)
+			if err != nil {
+				t.Fatalf("compileQuery() error = %v", err)
+			}
+			value, err := expr.eval(document)
+			if err != nil {
+				t.Fatalf("eval() error = %v", err)
+			}
+			got, err := json.Marshal(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("eval() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,526 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// queueJob is a command deferred to a later time, stored as one JSON file in
+// the queue directory. Args are the command's arguments after the command
+// name, with every value already resolved so a run needs no user input.
+type queueJob struct {
+	ID             string     `json:"id"`
+	Command        string     `json:"command"`
+	Args           []string   `json:"args"`
+	OrganisationID string     `json:"organisation_id"`
+	Env            string     `json:"env"`
+	RunAt          time.Time  `json:"run_at"`
+	Status         string     `json:"status"` // pending, done or failed
+	Attempts       int        `json:"attempts"`
+	LastError      string     `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty"`
+}
+
+// queueDir holds queued jobs.
+func queueDir() (string, error) {
+	dir, err := journalDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "queue"), nil
+}
+
+// randomHex returns n random bytes hex-encoded.
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// enqueueJob stores a pending job that runs command with args at runAt.
+func enqueueJob(ctx appContext, command string, args []string, runAt time.Time) (queueJob, error) {
+	now := time.Now()
+	job := queueJob{
+		ID:             now.UTC().Format("20060102T150405") + "-" + randomHex(3),
+		Command:        command,
+		Args:           args,
+		OrganisationID: ctx.settings.OrganisationID,
+		Env:            ctx.settings.Env,
+		RunAt:          runAt,
+		Status:         "pending",
+		CreatedAt:      now,
+	}
+	return job, saveJob(job)
+}
+
+func saveJob(job queueJob) error {
+	dir, err := queueDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return codedErrorf("PINGEN-CONFIG-003", "failed to save queue job: %w", err)
+	}
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, job.ID+".json")
+	if err := os.WriteFile(path+".tmp", append(data, '\n'), 0o600); err != nil {
+		return codedErrorf("PINGEN-CONFIG-003", "failed to save queue job: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return codedErrorf("PINGEN-CONFIG-003", "failed to save queue job: %w", err)
+	}
+	return nil
+}
+
+// loadQueue returns all jobs ordered by run time.
+func loadQueue() ([]queueJob, error) {
+	dir, err := queueDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []queueJob{}, nil
+	}
+	if err != nil {
+		return nil, codedErrorf("PINGEN-CONFIG-002", "failed to load queue: %w", err)
+	}
+	jobs := []queueJob{}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, codedErrorf("PINGEN-CONFIG-002", "failed to load queue: %w", err)
+		}
+		var job queueJob
+		if err := json.Unmarshal(data, &job); err != nil {
+			return nil, codedErrorf("PINGEN-CONFIG-002", "failed to load queue: %s: %w", entry.Name(), err)
+		}
+		jobs = append(jobs, job)
+	}
+	sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].RunAt.Before(jobs[j].RunAt) })
+	return jobs, nil
+}
+
+// claimJob takes an exclusive lock on job so that a daemon and a manual
+// flush never run it twice. The returned func releases the lock.
+func claimJob(job queueJob) (func(), bool) {
+	dir, err := queueDir()
+	if err != nil {
+		return nil, false
+	}
+	lock := filepath.Join(dir, job.ID+".lock")
+	file, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, false
+	}
+	file.Close()
+	return func() { os.Remove(lock) }, true
+}
+
+// runJob executes job through the normal command dispatch and records the
+// outcome. It returns the command's exit code.
+func runJob(ctx appContext, job queueJob) int {
+	release, ok := claimJob(job)
+	if !ok {
+		return 0
+	}
+	defer release()
+
+	ctx.settings.OrganisationID = job.OrganisationID
+	parts := strings.Fields(job.Command)
+	job.Attempts++
+	if !ctx.global.quiet {
+		logf("info", "queue: running %s (%s)", job.ID, job.Command)
+	}
+	lastError = ""
+	endGroup := ciGroup(ctx, fmt.Sprintf("queue job %s: %s", job.ID, job.Command))
+	code := dispatch(ctx, parts[0], append(parts[1:], job.Args...))
+	endGroup()
+	finished := time.Now()
+	job.FinishedAt = &finished
+	if code == 0 {
+		job.Status = "done"
+		job.LastError = ""
+	} else {
+		job.Status = "failed"
+		job.LastError = fmt.Sprintf("exit code %d", code)
+		if lastError != "" {
+			job.LastError += ": " + lastError
+		}
+	}
+	if err := saveJob(job); err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	return code
+}
+
+// findJob looks up a job by id or unique id prefix.
+func findJob(id string) (queueJob, error) {
+	jobs, err := loadQueue()
+	if err != nil {
+		return queueJob{}, err
+	}
+	matches := []queueJob{}
+	for _, job := range jobs {
+		if job.ID == id {
+			return job, nil
+		}
+		if strings.HasPrefix(job.ID, id) {
+			matches = append(matches, job)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return queueJob{}, codedErrorf("PINGEN-CONFIG-005", "unknown queue job: %s", id)
+	case 1:
+		return matches[0], nil
+	}
+	return queueJob{}, codedErrorf("PINGEN-CONFIG-005", "ambiguous queue job %s: matches %d jobs", id, len(matches))
+}
+
+// jobRunning reports whether a flush or daemon currently holds job.
+func jobRunning(job queueJob) bool {
+	dir, err := queueDir()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(filepath.Join(dir, job.ID+".lock"))
+	return err == nil
+}
+
+// describeJob returns job as JSON with the live status and, for pending
+// jobs, the next run time in --tz.
+func describeJob(ctx appContext, job queueJob) map[string]any {
+	status := job.Status
+	if status == "pending" && jobRunning(job) {
+		status = "running"
+	}
+	described := map[string]any{
+		"id":              job.ID,
+		"command":         job.Command,
+		"args":            job.Args,
+		"organisation_id": job.OrganisationID,
+		"env":             job.Env,
+		"status":          status,
+		"attempts":        job.Attempts,
+		"run_at":          job.RunAt.In(inputLocation(ctx)).Format(time.RFC3339),
+		"created_at":      job.CreatedAt.In(inputLocation(ctx)).Format(time.RFC3339),
+		"next_run":        "",
+	}
+	if status == "pending" {
+		described["next_run"] = described["run_at"]
+	}
+	if job.LastError != "" {
+		described["last_error"] = job.LastError
+	}
+	if job.FinishedAt != nil {
+		described["finished_at"] = job.FinishedAt.In(inputLocation(ctx)).Format(time.RFC3339)
+	}
+	return described
+}
+
+func handleQueueList(ctx appContext, args []string) int {
+	fs := flag.NewFlagSet("queue list", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	status := fs.String("status", "", "Only list jobs with this status (pending, running, done, failed, cancelled)")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli queue list [--status pending|running|done|failed|cancelled]")
+		return 0
+	}
+	if *status != "" && !isAllowed(*status, []string{"pending", "running", "done", "failed", "cancelled"}) {
+		printErrorCode("PINGEN-INPUT-001", "invalid --status")
+		return 2
+	}
+	jobs, err := loadQueue()
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	rows := []map[string]any{}
+	for _, job := range jobs {
+		row := describeJob(ctx, job)
+		if *status != "" && row["status"] != *status {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	if ctx.global.jsonOutput {
+		return emitJSON(rows)
+	}
+	for _, row := range rows {
+		when := row["next_run"]
+		if when == "" {
+			when = row["finished_at"]
+		}
+		line := fmt.Sprintf("%s\t%s\t%d attempt(s)\t%v\t%s", row["id"], row["status"], row["attempts"], when, row["command"])
+		if lastError, ok := row["last_error"]; ok {
+			line += "\t" + stringValue(lastError)
+		}
+		fmt.Println(line)
+	}
+	return 0
+}
+
+// handleQueueUpdate cancels a pending job or puts a failed or cancelled job
+// back in the queue to run at the next flush.
+func handleQueueUpdate(ctx appContext, action, id string) int {
+	job, err := findJob(id)
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	if jobRunning(job) {
+		printErrorCode("PINGEN-CONFIG-010", fmt.Sprintf("queue job %s is running", job.ID))
+		return 1
+	}
+	switch action {
+	case "cancel":
+		if job.Status != "pending" {
+			printErrorCode("PINGEN-CONFIG-010", fmt.Sprintf("queue job %s is %s, only pending jobs can be cancelled", job.ID, job.Status))
+			return 1
+		}
+		job.Status = "cancelled"
+	case "retry":
+		if job.Status != "failed" && job.Status != "cancelled" {
+			printErrorCode("PINGEN-CONFIG-010", fmt.Sprintf("queue job %s is %s, only failed or cancelled jobs can be retried", job.ID, job.Status))
+			return 1
+		}
+		job.Status = "pending"
+		if job.RunAt.Before(time.Now()) {
+			job.RunAt = time.Now()
+		}
+		job.FinishedAt = nil
+	}
+	if ctx.global.dryRun {
+		return emitJSON(describeJob(ctx, job))
+	}
+	if err := saveJob(job); err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	if ctx.global.jsonOutput {
+		return emitJSON(describeJob(ctx, job))
+	}
+	if !ctx.global.quiet {
+		fmt.Printf("%s is now %s\n", job.ID, job.Status)
+	}
+	return 0
+}
+
+// flushQueue runs pending jobs, only those whose time has come if dueOnly.
+// Jobs queued for another environment are left alone.
+func flushQueue(ctx appContext, dueOnly bool) (ran, failed int, err error) {
+	jobs, err := loadQueue()
+	if err != nil {
+		return 0, 0, err
+	}
+	now := time.Now()
+	for _, job := range jobs {
+		if job.Status != "pending" || (dueOnly && job.RunAt.After(now)) {
+			continue
+		}
+		if job.Env != ctx.settings.Env {
+			logf("info", "queue: skipping %s (queued for env %s)", job.ID, job.Env)
+			continue
+		}
+		if ctx.jobContext.Err() != nil {
+			break
+		}
+		ran++
+		if runJob(ctx, job) != 0 {
+			failed++
+		}
+	}
+	return ran, failed, nil
+}
+
+func handleQueue(ctx appContext, args []string) int {
+	if len(args) == 0 {
+		fmt.Println("queue requires a subcommand (list/show/cancel/retry/flush/daemon)")
+		return 2
+	}
+	switch args[0] {
+	case "list":
+		return handleQueueList(ctx, args[1:])
+	case "show":
+		if len(args) < 2 {
+			fmt.Println("queue show requires a job id")
+			return 2
+		}
+		job, err := findJob(args[1])
+		if err != nil {
+			reportError(ctx, err)
+			return 2
+		}
+		return emitJSON(describeJob(ctx, job))
+	case "cancel", "retry":
+		if len(args) < 2 {
+			fmt.Printf("queue %s requires a job id\n", args[0])
+			return 2
+		}
+		return handleQueueUpdate(ctx, args[0], args[1])
+	case "flush":
+		return handleQueueFlush(ctx, args[1:])
+	case "daemon":
+		return handleQueueDaemon(ctx, args[1:])
+	default:
+		fmt.Println("unknown queue subcommand")
+		return 2
+	}
+}
+
+func handleQueueFlush(ctx appContext, args []string) int {
+	fs := flag.NewFlagSet("queue flush", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	due := fs.Bool("due", false, "Only run jobs whose scheduled time has passed")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli queue flush [--due]")
+		return 0
+	}
+	ran, failed, err := flushQueue(ctx, *due)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	if !ctx.global.quiet {
+		logf("info", "queue: ran %d job(s), %d failed", ran, failed)
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func handleQueueDaemon(ctx appContext, args []string) int {
+	fs := flag.NewFlagSet("queue daemon", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	interval := fs.Duration("interval", 30*time.Second, "How often to check for due jobs")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli queue daemon [--interval 30s]")
+		return 0
+	}
+	if *interval < time.Second {
+		printErrorCode("PINGEN-INPUT-001", "--interval must be at least 1s")
+		return 2
+	}
+	var stop func()
+	ctx.jobContext, stop = handleSignals(ctx.jobContext)
+	defer stop()
+
+	for {
+		if _, _, err := flushQueue(ctx, true); err != nil {
+			reportError(ctx, err)
+		}
+		if !sleepContext(ctx.jobContext, *interval) {
+			if interrupted(ctx) {
+				return exitInterrupted
+			}
+			return 0
+		}
+	}
+}
+
+// parseRunAt reads a --at value; times without an offset use --tz.
+func parseRunAt(ctx appContext, value string) (time.Time, error) {
+	runAt, err := parseTimeInput(value, inputLocation(ctx), time.Now())
+	if err != nil || relativeTimePattern.MatchString(strings.TrimSpace(value)) {
+		return time.Time{}, codedErrorf("PINGEN-INPUT-002", "invalid --at %q (use RFC 3339, e.g. 2024-06-01T08:00+02:00)", value)
+	}
+	return runAt, nil
+}
+
+// queueLetterSend enqueues `letters send` for letterID. The idempotency key
+// is fixed now so that a run retried after a crash cannot send twice.
+func queueLetterSend(ctx appContext, letterID string, attributes map[string]any, idempotencyKey string, hooks hookOptions, runAt time.Time) int {
+	if idempotencyKey == "" {
+		idempotencyKey = randomHex(16)
+	}
+	args := []string{
+		"--delivery-product", stringValue(attributes["delivery_product"]),
+		"--print-mode", stringValue(attributes["print_mode"]),
+		"--print-spectrum", stringValue(attributes["print_spectrum"]),
+		"--idempotency-key", idempotencyKey,
+	}
+	if metaData, ok := attributes["meta_data"]; ok {
+		encoded, err := json.Marshal(metaData)
+		if err != nil {
+			reportError(ctx, err)
+			return 2
+		}
+		args = append(args, "--meta-json", string(encoded))
+	}
+	if hooks.onSuccess != "" {
+		args = append(args, "--on-success", hooks.onSuccess)
+	}
+	if hooks.onFailure != "" {
+		args = append(args, "--on-failure", hooks.onFailure)
+	}
+	args = append(args, letterID)
+
+	if ctx.global.dryRun {
+		// The preview shows the request the queued job sends at run_at.
+		return emitDryRun(ctx, map[string]any{
+			"action":          "queue.add",
+			"command":         "letters send",
+			"organisation_id": ctx.settings.OrganisationID,
+			"letter_id":       letterID,
+			"run_at":          runAt.Format(time.RFC3339),
+			"attributes":      attributes,
+		}, func(client pingen.Client) error {
+			payload := map[string]any{"data": map[string]any{"id": letterID, "type": "letters", "attributes": attributes}}
+			_, _, err := client.SendLetterRaw(ctx.jobContext, ctx.settings.OrganisationID, letterID, payload, idempotencyKey)
+			return err
+		})
+	}
+	job, err := enqueueJob(ctx, "letters send", args, runAt)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	return queuedSummary(ctx, job)
+}
+
+// queuedSummary reports an enqueued job.
+func queuedSummary(ctx appContext, job queueJob) int {
+	if ctx.global.jsonOutput {
+		return emitJSON(job)
+	}
+	if !ctx.global.quiet {
+		fmt.Printf("queued %s: %s at %s\n", job.ID, job.Command, job.RunAt.Format(time.RFC3339))
+		fmt.Println("run it with `pingen-cli queue daemon` or `pingen-cli queue flush --due`")
+	}
+	return 0
+}
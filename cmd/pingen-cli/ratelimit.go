@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// handleRateLimit reports the remaining request budget using a cheap
+// authenticated request. It is the limits command; ratelimit is its old
+// name.
+func handleRateLimit(ctx appContext, args []string) int {
+	fs := flag.NewFlagSet("limits", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli limits")
+		return 0
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+	_, headers, err := client.ListOrganisationsRaw(ctx.jobContext, map[string]string{
+		"page[limit]":           "1",
+		"fields[organisations]": "name",
+	})
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	limit := pingen.ParseRateLimit(headers)
+	if ctx.global.jsonOutput {
+		payload := map[string]any{
+			"known":     limit.Known,
+			"limit":     limit.Limit,
+			"remaining": limit.Remaining,
+			"used":      limit.Limit - limit.Remaining,
+		}
+		if !limit.Reset.IsZero() {
+			payload["reset_at"] = limit.Reset.UTC().Format(time.RFC3339)
+			payload["reset_in_seconds"] = int64(time.Until(limit.Reset).Seconds())
+		}
+		return emitJSON(payload)
+	}
+	if !limit.Known {
+		fmt.Println("the API did not report rate-limit headers")
+		return 0
+	}
+	fmt.Printf("limit: %d\n", limit.Limit)
+	fmt.Printf("remaining: %d\n", limit.Remaining)
+	fmt.Printf("used: %d\n", limit.Limit-limit.Remaining)
+	if !limit.Reset.IsZero() {
+		fmt.Printf("reset: %s (in %s)\n", limit.Reset.Format(time.RFC3339), time.Until(limit.Reset).Round(time.Second))
+	}
+	return 0
+}
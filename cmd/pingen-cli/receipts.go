@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// receiptEntry is one letter event image (acceptance or delivery receipt).
+type receiptEntry struct {
+	LetterID  string `json:"letter_id"`
+	EventID   string `json:"event_id"`
+	Code      string `json:"code"`
+	EmittedAt string `json:"emitted_at,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Bytes     int64  `json:"bytes,omitempty"`
+	SHA256    string `json:"sha256,omitempty"`
+	Result    string `json:"result"`
+	Error     string `json:"error,omitempty"`
+}
+
+var receiptNameUnsafe = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// receiptExtensions maps sniffed content types to file extensions.
+var receiptExtensions = map[string]string{
+	"application/pdf": ".pdf",
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/tiff":      ".tif",
+}
+
+func handleLettersReceipts(ctx appContext, args []string) (exitCode int) {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("letters receipts", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	since := fs.String("since", "", "Only letters created at or after this time (e.g. 30d)")
+	until := fs.String("until", "", "Only letters created before this time")
+	outDir := fs.String("out-dir", "", "Directory for the receipt files")
+	concurrency := fs.Int("concurrency", 4, "Parallel requests")
+	reportOptions := addReportFlags(fs)
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli letters receipts --out-dir dir [--since time] [--until time] [--concurrency N] [--report-dir dir [--csv-delimiter c] [--decimal-comma]]")
+		return 0
+	}
+	if *outDir == "" {
+		printErrorCode("PINGEN-INPUT-001", "--out-dir is required")
+		return 2
+	}
+	if *concurrency < 1 {
+		printErrorCode("PINGEN-INPUT-001", "--concurrency must be at least 1")
+		return 2
+	}
+	where, err := timeRangeClauses("created_at", *since, *until, inputLocation(ctx))
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	filterExpr, err := compileFilter("", append([]string{"delivery_product=registered"}, where...))
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+	var stopSignals func()
+	ctx.jobContext, stopSignals = handleSignals(ctx.jobContext)
+	defer stopSignals()
+
+	letters, err := fetchAllPages(ctx.jobContext, *concurrency, func(page int) (map[string]any, error) {
+		params := buildListParams(page, 100, "-created_at", filterExpr, "", "", "", "letters")
+		payload, _, err := client.ListLettersRaw(ctx.jobContext, ctx.settings.OrganisationID, params)
+		return payload, err
+	})
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	receipts, err := findReceipts(ctx, client, letters, *concurrency)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+
+	if ctx.global.dryRun {
+		return emitJSON(map[string]any{
+			"action":          "letters.receipts",
+			"organisation_id": ctx.settings.OrganisationID,
+			"out_dir":         *outDir,
+			"receipts":        receipts,
+		})
+	}
+	if err := os.MkdirAll(*outDir, 0o700); err != nil {
+		printErrorCode("PINGEN-DOWNLOAD-001", fmt.Sprintf("failed to create output directory: %v", err))
+		return 1
+	}
+	report := newRunReport(ctx, "letters receipts")
+	defer func() {
+		for _, receipt := range receipts {
+			report.add(reportItem{
+				Input:    receipt.LetterID + "/" + receipt.EventID,
+				LetterID: receipt.LetterID,
+				Status:   receipt.Code,
+				Result:   receipt.Result,
+				Error:    receipt.Error,
+			})
+		}
+		report.write(ctx, reportOptions, exitCode)
+	}()
+
+	downloadReceipts(ctx, client, receipts, *outDir, *concurrency)
+
+	failed, pending := 0, 0
+	for _, receipt := range receipts {
+		switch receipt.Result {
+		case "failed":
+			failed++
+			annotatef("error", "letter %s: receipt %s failed: %s", receipt.LetterID, receipt.Code, receipt.Error)
+		case "pending":
+			pending++
+		}
+	}
+	if ctx.global.jsonOutput {
+		emitJSON(receipts)
+	} else {
+		endGroup := ciGroup(ctx, fmt.Sprintf("letters receipts: %d receipts", len(receipts)))
+		for _, receipt := range receipts {
+			detail := receipt.Path
+			if receipt.Error != "" {
+				detail = receipt.Error
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\n", receipt.LetterID, receipt.Code, receipt.Result, detail)
+		}
+		endGroup()
+		if !ctx.global.quiet {
+			logf("info", "%d receipts, %d failed", len(receipts), failed)
+		}
+	}
+	if pending > 0 {
+		logf("info", "stopped early: %d receipts pending; re-run the same command to resume", pending)
+	}
+	if interrupted(ctx) {
+		return exitInterrupted
+	}
+	if failed > 0 || pending > 0 {
+		return 1
+	}
+	return 0
+}
+
+// findReceipts lists the events of each registered letter and returns those
+// with an image, in letter order.
+func findReceipts(ctx appContext, client pingen.Client, letters []map[string]any, workers int) ([]receiptEntry, error) {
+	found := make([][]receiptEntry, len(letters))
+	err := pingen.RunPool(ctx.jobContext, workers, len(letters), func(_ context.Context, i int) error {
+		letterID := stringValue(letters[i]["id"])
+		attrs, _ := letters[i]["attributes"].(map[string]any)
+		if product := stringValue(attrs["delivery_product"]); product != "" && !strings.Contains(product, "registered") {
+			return nil
+		}
+		params := map[string]string{"page[limit]": "100"}
+		payload, _, err := client.ListLetterEventsOfRaw(ctx.jobContext, ctx.settings.OrganisationID, letterID, params)
+		if err != nil {
+			return err
+		}
+		for _, event := range pageItems(payload) {
+			eventAttrs, _ := event["attributes"].(map[string]any)
+			if hasImage, _ := eventAttrs["has_image"].(bool); !hasImage {
+				continue
+			}
+			found[i] = append(found[i], receiptEntry{
+				LetterID:  letterID,
+				EventID:   stringValue(event["id"]),
+				Code:      stringValue(eventAttrs["code"]),
+				EmittedAt: stringValue(eventAttrs["emitted_at"]),
+			})
+		}
+		return nil
+	})
+	if err := ctx.jobContext.Err(); err != nil {
+		return nil, err
+	}
+	var poolErr *pingen.PoolError
+	if errors.As(err, &poolErr) && len(poolErr.Failed) > 0 {
+		return nil, poolErr.Failed[0].Err
+	}
+	receipts := []receiptEntry{}
+	for i := range letters {
+		receipts = append(receipts, found[i]...)
+	}
+	return receipts, nil
+}
+
+// receiptBaseName is the file name of a receipt without extension:
+// <letter id>-<event code>-<emitted at as YYYYMMDDTHHMMSS>. It only depends on
+// the event, so re-runs find files downloaded earlier.
+func receiptBaseName(receipt receiptEntry) string {
+	stamp := receipt.EventID
+	if emitted, err := time.Parse(apiTimeLayout, receipt.EmittedAt); err == nil {
+		stamp = emitted.UTC().Format("20060102T150405Z")
+	}
+	code := receiptNameUnsafe.ReplaceAllString(receipt.Code, "_")
+	if code == "" {
+		code = "event"
+	}
+	return receipt.LetterID + "-" + code + "-" + stamp
+}
+
+func downloadReceipts(ctx appContext, client pingen.Client, receipts []receiptEntry, outDir string, workers int) {
+	pingen.RunPool(ctx.jobContext, workers, len(receipts), func(_ context.Context, i int) error {
+		downloadReceipt(ctx, client, &receipts[i], outDir)
+		return nil
+	})
+	for i := range receipts {
+		if receipts[i].Result == "" {
+			receipts[i].Result = "pending"
+		}
+	}
+}
+
+func downloadReceipt(ctx appContext, client pingen.Client, receipt *receiptEntry, outDir string) {
+	base := filepath.Join(outDir, receiptBaseName(*receipt))
+	receipt.Result = "skipped"
+	path := existingReceipt(base)
+	if path == "" {
+		receipt.Result = "downloaded"
+		imageURL, _, err := client.GetLetterEventImageURL(ctx.jobContext, ctx.settings.OrganisationID, receipt.LetterID, receipt.EventID)
+		if err == nil {
+			_, err = client.DownloadFile(ctx.jobContext, imageURL, base)
+		}
+		if err == nil {
+			path, err = nameByContent(base)
+		}
+		if err != nil && ctx.jobContext.Err() != nil {
+			receipt.Result = "pending"
+			return
+		}
+		if err != nil {
+			receipt.Result = "failed"
+			receipt.Error = err.Error()
+			return
+		}
+	}
+	receipt.Path = path
+	size, sum, err := fileDigest(path)
+	if err != nil {
+		receipt.Result = "failed"
+		receipt.Error = err.Error()
+		return
+	}
+	receipt.Bytes = size
+	receipt.SHA256 = sum
+}
+
+// existingReceipt returns a previously downloaded file for base, if any.
+func existingReceipt(base string) string {
+	matches, _ := filepath.Glob(base + ".*")
+	for _, match := range matches {
+		if !strings.HasSuffix(match, ".part") {
+			return match
+		}
+	}
+	return ""
+}
+
+// nameByContent adds the extension matching the downloaded file's content.
+func nameByContent(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	head := make([]byte, 512)
+	n, _ := file.Read(head)
+	file.Close()
+	contentType := strings.TrimSpace(strings.Split(http.DetectContentType(head[:n]), ";")[0])
+	extension, ok := receiptExtensions[contentType]
+	if !ok {
+		extension = ".bin"
+	}
+	if err := os.Rename(path, path+extension); err != nil {
+		return "", err
+	}
+	return path + extension, nil
+}
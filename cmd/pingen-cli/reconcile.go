@@ -0,0 +1,306 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// reconcileFields are the manifest columns read by letters reconcile.
+var reconcileFields = []string{"key", "sha256", "file"}
+
+var reconcileMatches = []string{"hash", "key"}
+
+// reconcileEntry is one line of the reconciliation: a manifest row, or a
+// letter that no row accounts for.
+type reconcileEntry struct {
+	Row      int    `json:"row,omitempty"`
+	Key      string `json:"key"`
+	LetterID string `json:"letter_id,omitempty"`
+	Status   string `json:"status,omitempty"`
+	Result   string `json:"result"`
+	Error    string `json:"error,omitempty"`
+}
+
+// handleLettersReconcile compares a manifest of expected submissions with the
+// letters that exist in Pingen. Rows and letters are matched by the SHA-256
+// of the PDF (--match hash, the default) or by a field such as a meta data
+// reference (--match key --key-field meta.tags.ref). Every row is reported as
+// matched or missing; letters beyond the rows of their key are duplicates,
+// and letters no row mentions are extra.
+func handleLettersReconcile(ctx appContext, args []string) (exitCode int) {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("letters reconcile", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	manifest := fs.String("manifest", "", "CSV or XLSX of expected letters, with a key, sha256 or file column")
+	match := fs.String("match", "hash", "Match rows to letters by PDF hash or by --key-field (hash|key)")
+	keyField := fs.String("key-field", "", "Letter field holding the manifest key with --match key, e.g. meta.tags.ref")
+	columnMap := fs.String("column-map", "", "Columns of non-standard layouts, e.g. key=A,file=C")
+	var where stringList
+	fs.Var(&where, "where", "Filter clause limiting the letters checked (repeatable), see letters list")
+	since := fs.String("since", "", "Only letters created at or after this time")
+	until := fs.String("until", "", "Only letters created before this time")
+	concurrency := fs.Int("concurrency", 4, "Parallel page fetches and PDF downloads")
+	reportOptions := addReportFlags(fs)
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli letters reconcile --manifest file.csv|file.xlsx [--match hash|key] [--key-field path] [--column-map field=column,...] [--where clause]... [--since time] [--until time] [--concurrency N] [--report-dir dir [--csv-delimiter c] [--decimal-comma]]")
+		return 0
+	}
+	if *manifest == "" {
+		printErrorCode("PINGEN-INPUT-001", "--manifest is required")
+		return 2
+	}
+	if !isAllowed(*match, reconcileMatches) {
+		printErrorCode("PINGEN-INPUT-001", "invalid --match (use hash or key)")
+		return 2
+	}
+	if *match == "key" && *keyField == "" {
+		printErrorCode("PINGEN-INPUT-001", "--key-field is required with --match key")
+		return 2
+	}
+	if *concurrency < 1 {
+		printErrorCode("PINGEN-INPUT-001", "--concurrency must be at least 1")
+		return 2
+	}
+	rangeClauses, err := timeRangeClauses("created_at", *since, *until, inputLocation(ctx))
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	filterExpr, err := compileFilter("", append(where, rangeClauses...))
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	rows, err := readReconcileManifest(*manifest, *columnMap, *match)
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+	var stopSignals func()
+	ctx.jobContext, stopSignals = handleSignals(ctx.jobContext)
+	defer stopSignals()
+
+	letters, err := fetchAllPages(ctx.jobContext, *concurrency, func(page int) (map[string]any, error) {
+		params := buildListParams(page, 100, "created_at", filterExpr, "", "", "", "letters")
+		payload, _, err := client.ListLettersRaw(ctx.jobContext, ctx.settings.OrganisationID, params)
+		return payload, err
+	})
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	remote, unverified, err := reconcileLetterKeys(ctx, client, letters, *match, *keyField, *concurrency)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	if interrupted(ctx) {
+		return exitInterrupted
+	}
+	entries := reconcile(rows, remote)
+	entries = append(entries, unverified...)
+
+	report := newRunReport(ctx, "letters reconcile")
+	defer func() {
+		for _, entry := range entries {
+			input := entry.Key
+			if entry.Row > 0 {
+				input = fmt.Sprintf("row %d: %s", entry.Row, entry.Key)
+			}
+			report.add(reportItem{Input: input, LetterID: entry.LetterID, Status: entry.Status, Result: entry.Result, Error: entry.Error})
+		}
+		report.write(ctx, reportOptions, exitCode)
+	}()
+
+	counts := map[string]int{}
+	for _, entry := range entries {
+		counts[entry.Result]++
+		switch entry.Result {
+		case "missing":
+			annotatef("error", "row %d: no letter for %s", entry.Row, entry.Key)
+		case "duplicate":
+			annotatef("error", "letter %s: duplicate of %s", entry.LetterID, entry.Key)
+		case "extra":
+			annotatef("warn", "letter %s: not in the manifest", entry.LetterID)
+		case "unverified":
+			annotatef("warn", "letter %s: not verified: %s", entry.LetterID, entry.Error)
+		}
+	}
+	summary := fmt.Sprintf("%d matched, %d missing, %d duplicate, %d extra", counts["matched"], counts["missing"], counts["duplicate"], counts["extra"])
+	if counts["unverified"] > 0 {
+		summary += fmt.Sprintf(", %d unverified", counts["unverified"])
+	}
+	if ctx.global.jsonOutput {
+		emitJSON(map[string]any{
+			"manifest": *manifest,
+			"match":    *match,
+			"rows":     len(rows),
+			"letters":  len(letters),
+			"summary":  counts,
+			"entries":  entries,
+		})
+	} else {
+		endGroup := ciGroup(ctx, fmt.Sprintf("letters reconcile: %d rows, %d letters", len(rows), len(letters)))
+		for _, entry := range entries {
+			detail := entry.Status
+			if entry.Row > 0 {
+				detail = fmt.Sprintf("row %d", entry.Row)
+			}
+			if entry.Error != "" {
+				detail = entry.Error
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\n", entry.Result, entry.Key, entry.LetterID, detail)
+		}
+		endGroup()
+		if !ctx.global.quiet {
+			logf("info", "%s", summary)
+		}
+	}
+	if len(entries) > counts["matched"] {
+		return 1
+	}
+	return 0
+}
+
+// reconcileRow is one expected letter of the manifest.
+type reconcileRow struct {
+	line int
+	key  string
+}
+
+// readReconcileManifest returns the key of every manifest row: the key
+// column with --match key; with --match hash the sha256 column, or else the
+// digest of the file column, resolved relative to the manifest.
+func readReconcileManifest(path, columnMap, match string) ([]reconcileRow, error) {
+	columns, err := pingen.ParseColumnMap(columnMap)
+	if err != nil {
+		return nil, withCode("PINGEN-INPUT-001", err)
+	}
+	table, err := pingen.ReadTable(path)
+	if err != nil {
+		return nil, err
+	}
+	records, err := table.Records(reconcileFields, columns)
+	if err != nil {
+		return nil, withCode("PINGEN-INPUT-001", err)
+	}
+	rows := make([]reconcileRow, 0, len(records))
+	for i, record := range records {
+		row := reconcileRow{line: table.Lines[i], key: record["key"]}
+		if match == "hash" {
+			row.key = strings.ToLower(record["sha256"])
+			if row.key == "" && record["file"] != "" {
+				file := record["file"]
+				if !filepath.IsAbs(file) {
+					file = filepath.Join(filepath.Dir(path), file)
+				}
+				if _, row.key, err = fileDigest(file); err != nil {
+					return nil, codedErrorf("PINGEN-INPUT-001", "invalid manifest row %d: %w", row.line, err)
+				}
+			}
+		}
+		if row.key == "" {
+			column := "key"
+			if match == "hash" {
+				column = "sha256 or file"
+			}
+			return nil, codedErrorf("PINGEN-INPUT-001", "invalid manifest row %d: %s is empty", row.line, column)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// reconcileLetterKeys returns the letters with their keys, in listing order.
+// With --match hash every PDF is downloaded to a temporary directory and
+// hashed; letters whose PDF cannot be fetched (e.g. still processing) are
+// returned separately as unverified.
+func reconcileLetterKeys(ctx appContext, client pingen.Client, letters []map[string]any, match, keyField string, concurrency int) ([]reconcileEntry, []reconcileEntry, error) {
+	remote := make([]reconcileEntry, 0, len(letters))
+	unverified := []reconcileEntry{}
+	if match == "key" {
+		for _, letter := range letters {
+			attrs, _ := letter["attributes"].(map[string]any)
+			remote = append(remote, reconcileEntry{Key: stringValue(lookupField(letter, keyField)), LetterID: stringValue(letter["id"]), Status: stringValue(attrs["status"])})
+		}
+		return remote, unverified, nil
+	}
+	dir, err := os.MkdirTemp("", "pingen-reconcile-")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(dir)
+	downloads := make([]downloadEntry, 0, len(letters))
+	for _, letter := range letters {
+		downloads = append(downloads, newDownloadEntry(letter))
+	}
+	downloadAll(ctx, client, downloads, dir, concurrency)
+	for _, download := range downloads {
+		entry := reconcileEntry{Key: download.SHA256, LetterID: download.ID, Status: download.Status}
+		if download.SHA256 == "" {
+			entry.Key = download.FileOriginalName
+			entry.Result = "unverified"
+			entry.Error = download.Error
+			if entry.Error == "" {
+				entry.Error = "PDF not downloaded"
+			}
+			unverified = append(unverified, entry)
+			continue
+		}
+		remote = append(remote, entry)
+	}
+	return remote, unverified, nil
+}
+
+// reconcile pairs the rows of each key with its letters, oldest letter
+// first. Rows left over are missing, letters left over are duplicates, and
+// letters of keys without rows are extra.
+func reconcile(rows []reconcileRow, remote []reconcileEntry) []reconcileEntry {
+	byKey := map[string][]int{}
+	for i, letter := range remote {
+		byKey[letter.Key] = append(byKey[letter.Key], i)
+	}
+	matched := make([]bool, len(remote))
+	expected := map[string]int{}
+	entries := []reconcileEntry{}
+	for _, row := range rows {
+		entry := reconcileEntry{Row: row.line, Key: row.key, Result: "missing"}
+		if letters := byKey[row.key]; expected[row.key] < len(letters) {
+			i := letters[expected[row.key]]
+			matched[i] = true
+			entry.LetterID, entry.Status, entry.Result = remote[i].LetterID, remote[i].Status, "matched"
+		}
+		expected[row.key]++
+		entries = append(entries, entry)
+	}
+	for i, letter := range remote {
+		if matched[i] {
+			continue
+		}
+		letter.Result = "extra"
+		if expected[letter.Key] > 0 {
+			letter.Result = "duplicate"
+		}
+		entries = append(entries, letter)
+	}
+	return entries
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const redactedMarker = "[redacted]"
+
+// redactedKeys are payload keys whose values identify customers or are
+// secrets of theirs.
+var redactedKeys = map[string]bool{
+	"name": true, "address": true, "email": true, "recipient": true, "sender": true, "meta_data": true,
+	"file": true, "file_path": true, "file_original_name": true, "file_url": true, "file_url_signature": true,
+	"signing_key": true,
+}
+
+// redactor scrubs customer data from diagnostics (--redact). Values masked in
+// payloads are remembered so they are also removed from free-text messages.
+type redactor struct {
+	mu      sync.Mutex
+	secrets map[string]bool
+}
+
+// activeRedactor is set by run when --redact is given. Like the error
+// printers that consult it, it is process-wide rather than per command.
+var activeRedactor *redactor
+
+func enableRedaction() {
+	activeRedactor = &redactor{secrets: map[string]bool{}}
+}
+
+// redactSecrets registers values (e.g. a local file path) to scrub from output.
+func redactSecrets(values ...string) {
+	if activeRedactor == nil {
+		return
+	}
+	activeRedactor.mu.Lock()
+	defer activeRedactor.mu.Unlock()
+	for _, value := range values {
+		if len(strings.TrimSpace(value)) < 2 {
+			continue
+		}
+		activeRedactor.secrets[value] = true
+		if base := filepath.Base(value); base != value && len(base) > 1 {
+			activeRedactor.secrets[base] = true
+		}
+	}
+}
+
+// redactText replaces registered secrets in message.
+func redactText(message string) string {
+	if activeRedactor == nil {
+		return message
+	}
+	activeRedactor.mu.Lock()
+	secrets := make([]string, 0, len(activeRedactor.secrets))
+	for secret := range activeRedactor.secrets {
+		secrets = append(secrets, secret)
+	}
+	activeRedactor.mu.Unlock()
+	// Longest first, so a path is replaced before its base name.
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	for _, secret := range secrets {
+		message = strings.ReplaceAll(message, secret, redactedMarker)
+	}
+	return message
+}
+
+// redactPayload returns a copy of value with customer data masked. It returns
+// value unchanged when redaction is off.
+func redactPayload(value any) any {
+	if activeRedactor == nil {
+		return value
+	}
+	return redactValue(value, false)
+}
+
+func redactValue(value any, mask bool) any {
+	switch typed := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(typed))
+		for key, item := range typed {
+			copied[key] = redactValue(item, mask || redactedKeys[key])
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(typed))
+		for i, item := range typed {
+			copied[i] = redactValue(item, mask)
+		}
+		return copied
+	case []string:
+		copied := make([]any, len(typed))
+		for i, item := range typed {
+			copied[i] = redactValue(item, mask)
+		}
+		return copied
+	case string:
+		if !mask || typed == "" {
+			return typed
+		}
+		redactSecrets(typed)
+		return redactedMarker
+	case nil, bool:
+		return typed
+	default:
+		if mask {
+			return redactedMarker
+		}
+		return typed
+	}
+}
+
+// verbosef logs a debug message, shown with --verbose or --log-level debug.
+func verbosef(ctx appContext, format string, args ...any) {
+	logf("debug", format, args...)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// runReport is the machine-readable outcome of a bulk command, written by
+// --report-dir as <command>-<timestamp>.json and .csv.
+type runReport struct {
+	Command        string         `json:"command"`
+	OrganisationID string         `json:"organisation_id"`
+	StartedAt      string         `json:"started_at"`
+	FinishedAt     string         `json:"finished_at"`
+	ExitCode       int            `json:"exit_code"`
+	Summary        map[string]int `json:"summary"`
+	Items          []reportItem   `json:"items"`
+}
+
+// reportItem is one processed input. Result is the command's outcome for the
+// item (e.g. downloaded, failed, pending); Status is the letter status.
+type reportItem struct {
+	Input    string `json:"input"`
+	LetterID string `json:"letter_id,omitempty"`
+	Status   string `json:"status,omitempty"`
+	Result   string `json:"result"`
+	Cost     string `json:"cost,omitempty"`
+	Currency string `json:"currency,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+var reportColumns = []string{"input", "letter_id", "status", "result", "cost", "currency", "error"}
+
+// reportOptions are the --report-dir flags. The CSV options make the report
+// open directly in Excel installations with a German or French locale, which
+// expect ';' between fields and a decimal comma.
+type reportOptions struct {
+	dir          string
+	delimiter    rune
+	decimalComma bool
+}
+
+func addReportFlags(fs *flag.FlagSet) *reportOptions {
+	options := &reportOptions{}
+	fs.StringVar(&options.dir, "report-dir", "", "Write a JSON and CSV run report to this directory")
+	fs.Func("csv-delimiter", "Field separator of the CSV report, e.g. ';' or tab (default ',', or ';' with --decimal-comma)", func(value string) error {
+		delimiter, err := parseCSVDelimiter(value)
+		options.delimiter = delimiter
+		return err
+	})
+	fs.BoolVar(&options.decimalComma, "decimal-comma", false, "Write amounts in the CSV report with a decimal comma (12,50)")
+	return options
+}
+
+// parseCSVDelimiter accepts a single character, or "tab" or "\t".
+func parseCSVDelimiter(value string) (rune, error) {
+	if value == "tab" || value == `\t` {
+		return '\t', nil
+	}
+	runes := []rune(value)
+	if len(runes) != 1 || runes[0] == '"' || runes[0] == '\r' || runes[0] == '\n' || runes[0] == utf8.RuneError {
+		return 0, fmt.Errorf("%q is not a single character other than a quote or line break", value)
+	}
+	return runes[0], nil
+}
+
+func newRunReport(ctx appContext, command string) *runReport {
+	return &runReport{
+		Command:        command,
+		OrganisationID: ctx.settings.OrganisationID,
+		StartedAt:      time.Now().Format(apiTimeLayout),
+		Summary:        map[string]int{},
+	}
+}
+
+func (r *runReport) add(item reportItem) {
+	r.Items = append(r.Items, item)
+	r.Summary[item.Result]++
+}
+
+// write stores the report in the --report-dir directory and prints the paths
+// to stderr. Failures are reported as warnings; the command's own exit code is
+// kept.
+func (r *runReport) write(ctx appContext, options *reportOptions, exitCode int) {
+	if options.dir == "" || ctx.global.dryRun {
+		return
+	}
+	r.FinishedAt = time.Now().Format(apiTimeLayout)
+	r.ExitCode = exitCode
+	dir := options.dir
+	base := filepath.Join(dir, strings.ReplaceAll(r.Command, " ", "-")+"-"+time.Now().Format("20060102T150405"))
+	if err := r.writeFiles(dir, base, options); err != nil {
+		logf("warn", "run report not written: %v", err)
+		return
+	}
+	if !ctx.global.quiet {
+		logf("info", "report: %s.json, %s.csv", base, base)
+	}
+}
+
+func (r *runReport) writeFiles(dir, base string, options *reportOptions) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	encoded, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(base+".json", append(encoded, '\n'), 0o600); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(base+".csv", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(file)
+	switch {
+	case options.delimiter != 0:
+		writer.Comma = options.delimiter
+	case options.decimalComma:
+		writer.Comma = ';'
+	}
+	_ = writer.Write(reportColumns)
+	for _, item := range r.Items {
+		cost := item.Cost
+		if options.decimalComma {
+			cost = strings.Replace(cost, ".", ",", 1)
+		}
+		_ = writer.Write([]string{item.Input, item.LetterID, item.Status, item.Result, cost, item.Currency, item.Error})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// unschedulable are commands that make no sense as a recurring job.
+var unschedulable = []string{"schedule", "queue", "init", "completion", "__complete"}
+
+func handleSchedule(ctx appContext, args []string) int {
+	if len(args) == 0 {
+		fmt.Println("schedule requires a subcommand (add/list/remove/run)")
+		return 2
+	}
+	switch args[0] {
+	case "add":
+		return handleScheduleAdd(ctx, args[1:])
+	case "list":
+		return handleScheduleList(ctx)
+	case "remove":
+		if len(args) < 2 {
+			fmt.Println("schedule remove requires a name")
+			return 2
+		}
+		cfg, _, err := loadConfig(ctx.configPath)
+		if err != nil {
+			printErrorCode("PINGEN-CONFIG-002", "failed to load config")
+			return 1
+		}
+		if _, ok := cfg.Schedules[args[1]]; !ok {
+			printErrorCode("PINGEN-CONFIG-005", fmt.Sprintf("unknown schedule: %s", args[1]))
+			return 2
+		}
+		delete(cfg.Schedules, args[1])
+		if err := saveConfig(ctx, cfg); err != nil {
+			reportError(ctx, err)
+			return 1
+		}
+		if !ctx.global.quiet {
+			fmt.Printf("removed %s\n", args[1])
+		}
+		return 0
+	case "run":
+		return handleScheduleRun(ctx, args[1:])
+	default:
+		fmt.Println("unknown schedule subcommand")
+		return 2
+	}
+}
+
+func handleScheduleAdd(ctx appContext, args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Println("schedule add requires a name")
+		return 2
+	}
+	name := args[0]
+	fs := flag.NewFlagSet("schedule add", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	cronExpr := fs.String("cron", "", "Cron expression (minute hour day month weekday), evaluated in --tz")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args[1:]); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli schedule add <name> --cron '0 6 1 * *' -- <command> [args]")
+		return 0
+	}
+	if *cronExpr == "" {
+		printErrorCode("PINGEN-INPUT-001", "--cron is required")
+		return 2
+	}
+	spec, err := parseCron(*cronExpr, inputLocation(ctx))
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	command := fs.Args()
+	if len(command) == 0 {
+		printErrorCode("PINGEN-INPUT-001", "schedule add requires a command after --")
+		return 2
+	}
+	if _, known := completionCommands[command[0]]; !known || isAllowed(command[0], unschedulable) {
+		printErrorCode("PINGEN-INPUT-001", fmt.Sprintf("invalid scheduled command: %s", command[0]))
+		return 2
+	}
+
+	cfg, _, err := loadConfig(ctx.configPath)
+	if err != nil {
+		printErrorCode("PINGEN-CONFIG-002", "failed to load config")
+		return 1
+	}
+	if cfg.Schedules == nil {
+		cfg.Schedules = map[string]pingen.Schedule{}
+	}
+	cfg.Schedules[name] = pingen.Schedule{
+		Cron:           *cronExpr,
+		Timezone:       inputLocation(ctx).String(),
+		Args:           command,
+		OrganisationID: ctx.settings.OrganisationID,
+		Env:            ctx.settings.Env,
+	}
+	if err := saveConfig(ctx, cfg); err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	if !ctx.global.quiet {
+		fmt.Printf("saved %s (next run %s)\n", name, formatNextRun(spec.next(time.Now())))
+	}
+	return 0
+}
+
+func handleScheduleList(ctx appContext) int {
+	cfg, _, err := loadConfig(ctx.configPath)
+	if err != nil {
+		printErrorCode("PINGEN-CONFIG-002", "failed to load config")
+		return 1
+	}
+	lastRuns, err := loadScheduleRuns()
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	names := make([]string, 0, len(cfg.Schedules))
+	for name := range cfg.Schedules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rows := []map[string]any{}
+	for _, name := range names {
+		schedule := cfg.Schedules[name]
+		row := map[string]any{
+			"name":            name,
+			"cron":            schedule.Cron,
+			"timezone":        schedule.Timezone,
+			"command":         schedule.Args,
+			"organisation_id": schedule.OrganisationID,
+			"next_run":        "",
+			"last_run":        "",
+		}
+		if spec, err := scheduleSpec(schedule); err == nil {
+			row["next_run"] = formatNextRun(spec.next(time.Now()))
+		}
+		if last, ok := lastRuns[name]; ok {
+			row["last_run"] = last.In(inputLocation(ctx)).Format(time.RFC3339)
+		}
+		rows = append(rows, row)
+	}
+	if ctx.global.jsonOutput {
+		return emitJSON(rows)
+	}
+	for _, row := range rows {
+		fmt.Printf("%s\t%s\tnext %s\t%s\n", row["name"], row["cron"], row["next_run"], strings.Join(row["command"].([]string), " "))
+	}
+	return 0
+}
+
+// scheduleSpec parses the cron expression of schedule in the zone it was
+// saved with.
+func scheduleSpec(schedule pingen.Schedule) (cronSpec, error) {
+	location, err := loadLocation(schedule.Timezone)
+	if err != nil {
+		return cronSpec{}, err
+	}
+	return parseCron(schedule.Cron, location)
+}
+
+func formatNextRun(next time.Time) string {
+	if next.IsZero() {
+		return "never"
+	}
+	return next.Format(time.RFC3339)
+}
+
+// handleScheduleRun is the scheduler daemon: once a minute it queues the
+// schedules that are due and runs due queue jobs. Runs missed while it was
+// not running are not caught up, as with cron.
+func handleScheduleRun(ctx appContext, args []string) int {
+	fs := flag.NewFlagSet("schedule run", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli schedule run")
+		return 0
+	}
+	var stop func()
+	ctx.jobContext, stop = handleSignals(ctx.jobContext)
+	defer stop()
+
+	for {
+		now := time.Now()
+		if err := queueDueSchedules(ctx, now); err != nil {
+			reportError(ctx, err)
+		}
+		if _, _, err := flushQueue(ctx, true); err != nil {
+			reportError(ctx, err)
+		}
+		wait := time.Until(now.Truncate(time.Minute).Add(time.Minute))
+		if !sleepContext(ctx.jobContext, wait) {
+			if interrupted(ctx) {
+				return exitInterrupted
+			}
+			return 0
+		}
+	}
+}
+
+// queueDueSchedules enqueues every schedule matching the minute of now that
+// has not run in that minute yet. The config is re-read so that schedules
+// added while the daemon runs are picked up.
+func queueDueSchedules(ctx appContext, now time.Time) error {
+	cfg, _, err := loadConfig(ctx.configPath)
+	if err != nil {
+		return codedErrorf("PINGEN-CONFIG-002", "failed to load config: %w", err)
+	}
+	lastRuns, err := loadScheduleRuns()
+	if err != nil {
+		return err
+	}
+	minute := now.Truncate(time.Minute)
+	names := make([]string, 0, len(cfg.Schedules))
+	for name := range cfg.Schedules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	changed := false
+	for _, name := range names {
+		schedule := cfg.Schedules[name]
+		spec, err := scheduleSpec(schedule)
+		if err != nil {
+			logf("info", "schedule: skipping %s: %v", name, err)
+			continue
+		}
+		if !spec.matches(minute) || !lastRuns[name].Before(minute) || len(schedule.Args) == 0 {
+			continue
+		}
+		if schedule.Env != "" && schedule.Env != ctx.settings.Env {
+			logf("info", "schedule: skipping %s (saved for env %s)", name, schedule.Env)
+			continue
+		}
+		jobCtx := ctx
+		jobCtx.settings.OrganisationID = schedule.OrganisationID
+		command, jobArgs := splitCommand(schedule.Args)
+		job, err := enqueueJob(jobCtx, command, jobArgs, minute)
+		if err != nil {
+			return err
+		}
+		if !ctx.global.quiet {
+			logf("info", "schedule: queued %s as %s", name, job.ID)
+		}
+		lastRuns[name] = minute
+		changed = true
+	}
+	if changed {
+		return saveScheduleRuns(lastRuns)
+	}
+	return nil
+}
+
+// splitCommand separates "letters send --x y" into the command words
+// ("letters send") and the remaining arguments.
+func splitCommand(args []string) (string, []string) {
+	if len(args) > 1 && isAllowed(args[1], completionCommands[args[0]]) {
+		return args[0] + " " + args[1], args[2:]
+	}
+	return args[0], args[1:]
+}
+
+// scheduleRunsPath records when each schedule last fired.
+func scheduleRunsPath() (string, error) {
+	dir, err := journalDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "schedules.json"), nil
+}
+
+func loadScheduleRuns() (map[string]time.Time, error) {
+	path, err := scheduleRunsPath()
+	if err != nil {
+		return nil, err
+	}
+	runs := map[string]time.Time{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return runs, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &runs)
+	}
+	if err != nil {
+		return nil, codedErrorf("PINGEN-CONFIG-002", "failed to load schedule state: %w", err)
+	}
+	return runs, nil
+}
+
+func saveScheduleRuns(runs map[string]time.Time) error {
+	path, err := scheduleRunsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return codedErrorf("PINGEN-CONFIG-003", "failed to save schedule state: %w", err)
+	}
+	data, err := json.MarshalIndent(runs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		return codedErrorf("PINGEN-CONFIG-003", "failed to save schedule state: %w", err)
+	}
+	return nil
+}
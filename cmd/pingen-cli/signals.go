@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// exitInterrupted is returned after SIGINT/SIGTERM, following the shell
+// convention of 128 + SIGINT.
+const exitInterrupted = 130
+
+// errInterrupted is the cancellation cause of the job context after a signal.
+var errInterrupted = codedErrorf("PINGEN-NET-003", "interrupted")
+
+// handleSignals returns a context that is cancelled on the first SIGINT or
+// SIGTERM so that long-running commands can stop cleanly and report partial
+// results. A second signal exits immediately. The returned function stops
+// listening. Short commands don't call it and keep the default behaviour.
+func handleSignals(parent context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-signals:
+			logf("info", "interrupted: cancelling in-flight requests (press Ctrl-C again to abort)")
+			cancel(errInterrupted)
+		case <-done:
+			return
+		}
+		select {
+		case <-signals:
+			os.Exit(exitInterrupted)
+		case <-done:
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		close(done)
+		cancel(nil)
+	}
+}
+
+// interrupted reports whether the invocation was stopped by a signal.
+func interrupted(ctx appContext) bool {
+	return ctx.jobContext != nil && errors.Is(context.Cause(ctx.jobContext), errInterrupted)
+}
+
+// interruptedCode returns exitInterrupted after a signal and code otherwise.
+func interruptedCode(ctx appContext, code int) int {
+	if interrupted(ctx) {
+		return exitInterrupted
+	}
+	return code
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// mergedSortOrder orders the pages merged by --all when --sort-by is not
+// given, so that repeated runs print the same items in the same order even
+// if items were created while paging.
+const mergedSortOrder = "created_at,id"
+
+// sortResources stably orders JSON:API resources by a comma-separated list of
+// fields. A leading "-" sorts a field descending. Fields are looked up on the
+// resource itself (id, type) and then in its attributes.
+func sortResources(data []any, spec string) {
+	keys := []string{}
+	for _, key := range strings.Split(spec, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	sort.SliceStable(data, func(i, j int) bool {
+		left, _ := data[i].(map[string]any)
+		right, _ := data[j].(map[string]any)
+		for _, key := range keys {
+			field := strings.TrimPrefix(key, "-")
+			cmp := compareValues(resourceField(left, field), resourceField(right, field))
+			if cmp == 0 {
+				continue
+			}
+			if strings.HasPrefix(key, "-") {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+}
+
+func resourceField(item map[string]any, field string) any {
+	if value, ok := item[field]; ok && field != "attributes" {
+		return value
+	}
+	attrs, _ := item["attributes"].(map[string]any)
+	return attrs[field]
+}
+
+// compareValues orders numbers numerically and everything else as strings.
+// Missing values sort first.
+func compareValues(left, right any) int {
+	if left == nil || right == nil {
+		switch {
+		case left == nil && right == nil:
+			return 0
+		case left == nil:
+			return -1
+		default:
+			return 1
+		}
+	}
+	leftText, rightText := stringValue(left), stringValue(right)
+	leftNum, leftErr := strconv.ParseFloat(leftText, 64)
+	rightNum, rightErr := strconv.ParseFloat(rightText, 64)
+	if leftErr == nil && rightErr == nil {
+		switch {
+		case leftNum < rightNum:
+			return -1
+		case leftNum > rightNum:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(leftText, rightText)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSortResources(t *testing.T) {
+	resource := func(id string, attributes map[string]any) any {
+		return map[string]any{"id": id, "type": "letters", "attributes": attributes}
+	}
+	letters := func() []any {
+		return []any{
+			resource("c", map[string]any{"status": "sent", "pages": "10", "created_at": "2024-02-01"}),
+			resource("a", map[string]any{"status": "valid", "pages": float64(2), "created_at": "2024-01-01"}),
+			resource("d", map[string]any{"status": "sent", "created_at": "2024-01-01"}),
+			resource("b", map[string]any{"status": "valid", "pages": float64(9), "created_at": "2024-03-01"}),
+		}
+	}
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{spec: "", want: "c,a,d,b"},
+		{spec: "id", want: "a,b,c,d"},
+		{spec: "-id", want: "d,c,b,a"},
+		// Numbers compare numerically, also when sent as strings; missing
+		// values come first.
+		{spec: "pages", want: "d,a,b,c"},
+		{spec: "-pages", want: "c,b,a,d"},
+		// The sort is stable, so equal keys keep the listing order.
+		{spec: "status", want: "c,d,a,b"},
+		{spec: "status,-created_at", want: "c,d,b,a"},
+		{spec: " -status , id ", want: "a,b,c,d"},
+		{spec: mergedSortOrder, want: "a,d,c,b"},
+		{spec: "type", want: "c,a,d,b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			data := letters()
+			sortResources(data, tt.spec)
+			ids := make([]string, 0, len(data))
+			for _, item := range data {
+				ids = append(ids, stringValue(item.(map[string]any)["id"]))
+			}
+			if got := strings.Join(ids, ","); got != tt.want {
+				t.Errorf("sortResources(%q) = %s, want %s", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
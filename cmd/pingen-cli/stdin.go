@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// spoolStdin copies a PDF piped on stdin into a private temp file, so it
+// goes through the same checks as a file on disk and can be uploaded with the
+// Content-Length the presigned upload URL requires. At most limit bytes are
+// accepted. The returned func removes the file.
+func spoolStdin(limit int64) (string, func(), error) {
+	file, err := os.CreateTemp("", "pingen-stdin-*.pdf")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.Remove(file.Name()) }
+	var src io.Reader = os.Stdin
+	if limit > 0 {
+		src = io.LimitReader(os.Stdin, limit+1)
+	}
+	size, err := io.Copy(file, src)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	switch {
+	case err != nil:
+		cleanup()
+		return "", nil, fmt.Errorf("failed to read stdin: %w", err)
+	case size == 0:
+		cleanup()
+		return "", nil, codedErrorf("PINGEN-UPLOAD-003", "stdin is empty: pipe a PDF into --file -")
+	case limit > 0 && size > limit:
+		cleanup()
+		return "", nil, codedErrorf("PINGEN-UPLOAD-003", "stdin is too large: the maximum is %s (max_upload_size)", pingen.FormatSize(limit))
+	}
+	return file.Name(), cleanup, nil
+}
+
+// stdinPathError names stdin instead of the temp file in an error about a
+// spooled PDF. The error keeps its catalog code.
+func stdinPathError(err error, path string) error {
+	return withCode(codeForError(err), errors.New(strings.ReplaceAll(err.Error(), path, "stdin")))
+}
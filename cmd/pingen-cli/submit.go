@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// handleLettersSubmit uploads a PDF, creates the letter without auto_send,
+// waits until it has validated and sends it. With --rollback a letter that
+// fails validation or cannot be sent is deleted again, so a failed run leaves
+// no draft behind.
+func handleLettersSubmit(ctx appContext, args []string) (exitCode int) {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("letters submit", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	filePath := fs.String("file", "", "PDF file to upload, or - to read it from stdin")
+	fileName := fs.String("file-name", "", "Original file name shown in Pingen (required with stdin)")
+	addressPos := fs.String("address-position", "left", "Address position (left/right)")
+	deliveryProduct := fs.String("delivery-product", "", "Delivery product")
+	printMode := fs.String("print-mode", "", "Print mode")
+	printSpectrum := fs.String("print-spectrum", "", "Print spectrum")
+	metaJSON := fs.String("meta-json", "", "Meta data JSON string or @path")
+	metaFile := fs.String("meta-file", "", "Meta data JSON file path")
+	recipient := fs.String("recipient", "", "Address book alias for meta_data.recipient (see contacts add)")
+	sender := fs.String("sender", "", "Address book alias for meta_data.sender")
+	var tags stringList
+	fs.Var(&tags, "tag", "Label the letter in meta_data.tags (key=value, repeatable)")
+	idempotencyKey := fs.String("idempotency-key", "", "Idempotency key; the create and send requests use it with -create and -send appended")
+	validateAddress := fs.Bool("validate-address", false, "Warn when the recipient in the PDF's address window looks incomplete or undeliverable")
+	rollback := fs.Bool("rollback", false, "Delete the letter again if it does not validate or cannot be sent")
+	waitOptions := addLetterWaitFlags(fs)
+	hooks := addHookFlags(fs)
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli letters submit --file <path>|- [--file-name name] --delivery-product <product (see products list)> --print-mode <simplex|duplex> --print-spectrum <color|grayscale> [--address-position left|right] [--meta-json ...|--meta-file ...] [--recipient alias] [--sender alias] [--tag key=value]... [--validate-address] [--interval 5s] [--max-wait 10m] [--rollback] [--idempotency-key ...] [--on-success cmd] [--on-failure cmd]")
+		return 0
+	}
+	redactSecrets(*filePath, *fileName)
+	event := hookEvent{command: "letters submit", filePath: *filePath}
+	defer func() { hooks.run(ctx, event, exitCode) }()
+	if *filePath == "" {
+		return event.fail("PINGEN-INPUT-001", "--file is required", 2)
+	}
+	if *addressPos != "left" && *addressPos != "right" {
+		return event.fail("PINGEN-INPUT-001", "address-position must be left or right", 2)
+	}
+	if *deliveryProduct == "" || *printMode == "" || *printSpectrum == "" {
+		return event.fail("PINGEN-INPUT-001", "delivery-product, print-mode, and print-spectrum are required", 2)
+	}
+	product, err := checkDeliveryProduct(&ctx, *deliveryProduct, "")
+	if err != nil {
+		return event.failErr(ctx, err, 2)
+	}
+	if !isAllowed(*printMode, []string{"simplex", "duplex"}) {
+		return event.fail("PINGEN-INPUT-001", "invalid print-mode", 2)
+	}
+	if !isAllowed(*printSpectrum, []string{"color", "grayscale"}) {
+		return event.fail("PINGEN-INPUT-001", "invalid print-spectrum", 2)
+	}
+	if err := waitOptions.validate(); err != nil {
+		return event.failErr(ctx, err, 2)
+	}
+	waitOptions.until = []string{"valid"}
+	uploadPath := *filePath
+	if *filePath == "-" {
+		if *fileName == "" {
+			return event.fail("PINGEN-INPUT-001", "--file-name is required when reading the PDF from stdin", 2)
+		}
+		path, cleanup, err := spoolStdin(maxUploadSize(ctx))
+		if err != nil {
+			return event.failErr(ctx, err, 2)
+		}
+		defer cleanup()
+		uploadPath = path
+	} else if _, err := os.Stat(*filePath); err != nil {
+		return event.fail("PINGEN-UPLOAD-001", "file not found", 2)
+	}
+	if err := pingen.PreflightPDF(uploadPath, maxUploadSize(ctx)); err != nil {
+		if uploadPath != *filePath {
+			err = stdinPathError(err, uploadPath)
+		}
+		return event.failErr(ctx, err, 2)
+	}
+	if err := checkPageLimit(ctx, uploadPath, *deliveryProduct); err != nil {
+		return event.failErr(ctx, err, 2)
+	}
+	if *validateAddress {
+		for _, warning := range addressWarnings(&ctx, uploadPath, *addressPos, true) {
+			logf("warn", "%s", warning)
+		}
+	}
+	originalName := *fileName
+	if originalName == "" {
+		originalName = pingen.DefaultFileName(*filePath)
+	}
+	metaData, err := loadJSONInput(*metaJSON, *metaFile)
+	if err != nil {
+		return event.failErr(ctx, err, 2)
+	}
+	metaData, err = applyContacts(ctx, metaData, *recipient, *sender)
+	if err != nil {
+		return event.failErr(ctx, err, 2)
+	}
+	if err := validateMetaAddresses(metaData); err != nil {
+		return event.failErr(ctx, err, 2)
+	}
+	tagValues, err := parseTags(tags)
+	if err != nil {
+		return event.failErr(ctx, err, 2)
+	}
+	metaData = applyTags(metaData, tagValues)
+
+	createAttributes := map[string]any{
+		"file_original_name": originalName,
+		"address_position":   *addressPos,
+		"auto_send":          false,
+	}
+	if metaData != nil {
+		createAttributes["meta_data"] = metaData
+	}
+	sendAttributes := map[string]any{
+		"delivery_product": product,
+		"print_mode":       *printMode,
+		"print_spectrum":   *printSpectrum,
+	}
+	createAttributes["file_url"] = "https://upload.invalid/pending"
+	createAttributes["file_url_signature"] = "pending"
+	err = pingen.ValidatePayload("letter-create", map[string]any{"data": map[string]any{"type": "letters", "attributes": createAttributes}})
+	delete(createAttributes, "file_url")
+	delete(createAttributes, "file_url_signature")
+	if err != nil {
+		return event.failErr(ctx, err, 2)
+	}
+	sendPayload := map[string]any{"data": map[string]any{"id": "pending", "type": "letters", "attributes": sendAttributes}}
+	if err := pingen.ValidatePayload("letter-send", sendPayload); err != nil {
+		return event.failErr(ctx, err, 2)
+	}
+
+	createKey, sendKey := "", ""
+	if *idempotencyKey != "" {
+		createKey, sendKey = *idempotencyKey+"-create", *idempotencyKey+"-send"
+	}
+	if ctx.global.dryRun {
+		plan := map[string]any{
+			"action":            "letters.submit",
+			"file":              *filePath,
+			"organisation_id":   ctx.settings.OrganisationID,
+			"create_attributes": createAttributes,
+			"send_attributes":   sendAttributes,
+			"rollback":          *rollback,
+		}
+		upload := pingen.LetterUpload{Path: uploadPath, Attributes: copyMap(createAttributes), IdempotencyKey: createKey}
+		return emitDryRun(ctx, plan, previewLetterUpload(ctx, upload), func(client pingen.Client) error {
+			payload := map[string]any{"data": map[string]any{"id": previewLetterID, "type": "letters", "attributes": sendAttributes}}
+			_, _, err := client.SendLetterRaw(ctx.jobContext, ctx.settings.OrganisationID, previewLetterID, payload, sendKey)
+			return err
+		})
+	}
+
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		return event.failErr(ctx, err, 1)
+	}
+	var stopSignals func()
+	ctx.jobContext, stopSignals = handleSignals(ctx.jobContext)
+	defer stopSignals()
+	client := newClient(ctx, token)
+
+	verbosef(ctx, "uploading %s and creating letter %q...", *filePath, originalName)
+	upload := pingen.LetterUpload{Path: uploadPath, Attributes: createAttributes, IdempotencyKey: createKey}
+	created, err := client.CreateLetterFromFileRaw(ctx.jobContext, ctx.settings.OrganisationID, upload, uploadTimeout(ctx))
+	if err != nil {
+		if uploadPath != *filePath {
+			err = stdinPathError(err, uploadPath)
+		}
+		return event.failErr(ctx, err, interruptedCode(ctx, 1))
+	}
+	event.setLetter(created)
+	letterID := event.letterID
+
+	// undo deletes the letter after a failed step when --rollback is set. It
+	// uses its own context so that it also runs after Ctrl-C or --deadline.
+	undo := func() {
+		if !*rollback {
+			logf("warn", "letter %s was created but not sent; delete it with `pingen-cli letters delete %s` or pass --rollback", letterID, letterID)
+			return
+		}
+		if _, err := newClient(ctx, token).DeleteLetter(context.Background(), ctx.settings.OrganisationID, letterID); err != nil {
+			logf("error", "rollback failed: letter %s could not be deleted: %s", letterID, err.Error())
+			return
+		}
+		logf("info", "rolled back: deleted letter %s", letterID)
+	}
+
+	verbosef(ctx, "waiting for letter %s to validate...", letterID)
+	letter, letterHeaders, err := waitForLetter(ctx, client, letterID, *waitOptions)
+	if letter != nil {
+		event.setLetter(letter)
+	}
+	if err != nil {
+		event.message = err.Error()
+		code := finishLetterWait(ctx, letter, letterHeaders, err)
+		undo()
+		return code
+	}
+
+	verbosef(ctx, "sending letter %s...", letterID)
+	sendPayload["data"].(map[string]any)["id"] = letterID
+	resp, headers, err := client.SendLetterRaw(ctx.jobContext, ctx.settings.OrganisationID, letterID, sendPayload, sendKey)
+	if err != nil {
+		code := event.failErr(ctx, err, interruptedCode(ctx, 1))
+		undo()
+		return code
+	}
+	event.setLetter(resp)
+	return emitPayload(ctx, resp, headers, func() { printLetterSummary(resp) })
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// tagsKey is the reserved meta_data key that holds --tag labels.
+const tagsKey = "tags"
+
+var tagKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,40}$`)
+
+// parseTags turns repeated key=value --tag flags into a map. A later value
+// for the same key wins.
+func parseTags(values []string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, value := range values {
+		key, tagValue, ok := strings.Cut(value, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !tagKeyPattern.MatchString(key) {
+			return nil, codedErrorf("PINGEN-INPUT-002", "invalid --tag %q (use key=value; keys are letters, digits, _ and -)", value)
+		}
+		tags[key] = strings.TrimSpace(tagValue)
+	}
+	return tags, nil
+}
+
+// applyTags merges tags into meta_data.tags, keeping tags already present
+// in the meta data unless a flag overrides them.
+func applyTags(metaData map[string]any, tags map[string]string) map[string]any {
+	if len(tags) == 0 {
+		return metaData
+	}
+	if metaData == nil {
+		metaData = map[string]any{}
+	}
+	merged := map[string]any{}
+	if existing, ok := metaData[tagsKey].(map[string]any); ok {
+		for key, value := range existing {
+			merged[key] = value
+		}
+	}
+	for key, value := range tags {
+		merged[key] = value
+	}
+	metaData[tagsKey] = merged
+	return metaData
+}
+
+// tagClauses compiles --tag filters into --where clauses on meta_data.tags.
+func tagClauses(values []string) ([]string, error) {
+	if _, err := parseTags(values); err != nil {
+		return nil, err
+	}
+	clauses := make([]string, 0, len(values))
+	for _, value := range values {
+		key, tagValue, _ := strings.Cut(value, "=")
+		clauses = append(clauses, "meta_data."+tagsKey+"."+strings.TrimSpace(key)+"="+strings.TrimSpace(tagValue))
+	}
+	return clauses, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// teeStdout is the real stdout while --tee redirects os.Stdout into a pipe.
+var teeStdout *os.File
+
+// startTee copies everything written to stdout into path as well, truncating
+// it unless appendMode is set. The returned func flushes the copy and
+// restores stdout.
+func startTee(path string, appendMode bool) (func(), error) {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if appendMode {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(path, flags, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	teeStdout = os.Stdout
+	os.Stdout = writer
+	done := make(chan struct{})
+	go func() {
+		io.Copy(io.MultiWriter(teeStdout, file), reader)
+		close(done)
+	}()
+	return func() {
+		writer.Close()
+		<-done
+		reader.Close()
+		file.Close()
+		os.Stdout = teeStdout
+		teeStdout = nil
+	}, nil
+}
+
+// terminalStdout returns the stdout to inspect for terminal detection.
+func terminalStdout() *os.File {
+	if teeStdout != nil {
+		return teeStdout
+	}
+	return os.Stdout
+}
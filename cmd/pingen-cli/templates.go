@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// templateFlags are the `letters create` flags a letter template can hold.
+var templateFlags = []string{
+	"file", "file-name", "address-position", "auto-send", "delivery-product",
+	"print-mode", "print-spectrum", "meta-json", "recipient", "sender",
+}
+
+func handleTemplates(ctx appContext, args []string) int {
+	if len(args) == 0 {
+		fmt.Println("templates requires a subcommand (save/list/show/delete)")
+		return 2
+	}
+	switch args[0] {
+	case "save":
+		return handleTemplatesSave(ctx, args[1:])
+	case "list":
+		if ctx.global.jsonOutput {
+			return emitJSON(ctx.settings.LetterTemplates)
+		}
+		names := make([]string, 0, len(ctx.settings.LetterTemplates))
+		for name := range ctx.settings.LetterTemplates {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%s\t%s\n", name, describeTemplate(ctx.settings.LetterTemplates[name]))
+		}
+		return 0
+	case "show":
+		if len(args) < 2 {
+			fmt.Println("templates show requires a name")
+			return 2
+		}
+		template, err := lookupLetterTemplate(ctx, args[1])
+		if err != nil {
+			reportError(ctx, err)
+			return 2
+		}
+		return emitJSON(template)
+	case "delete":
+		if len(args) < 2 {
+			fmt.Println("templates delete requires a name")
+			return 2
+		}
+		cfg, _, err := loadConfig(ctx.configPath)
+		if err != nil {
+			printErrorCode("PINGEN-CONFIG-002", "failed to load config")
+			return 1
+		}
+		if _, ok := cfg.LetterTemplates[args[1]]; !ok {
+			printErrorCode("PINGEN-CONFIG-005", fmt.Sprintf("unknown letter template: %s", args[1]))
+			return 2
+		}
+		delete(cfg.LetterTemplates, args[1])
+		if err := saveConfig(ctx, cfg); err != nil {
+			reportError(ctx, err)
+			return 1
+		}
+		if !ctx.global.quiet {
+			fmt.Printf("deleted %s\n", args[1])
+		}
+		return 0
+	default:
+		fmt.Println("unknown templates subcommand")
+		return 2
+	}
+}
+
+func handleTemplatesSave(ctx appContext, args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Println("templates save requires a name")
+		return 2
+	}
+	name := args[0]
+	fs := flag.NewFlagSet("templates save", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	filePath := fs.String("file", "", "Default PDF file (e.g. a base document)")
+	fs.String("file-name", "", "Original file name shown in Pingen")
+	addressPos := fs.String("address-position", "", "Address position (left/right)")
+	fs.Bool("auto-send", false, "Automatically send when processed")
+	deliveryProduct := fs.String("delivery-product", "", "Delivery product")
+	printMode := fs.String("print-mode", "", "Print mode")
+	printSpectrum := fs.String("print-spectrum", "", "Print spectrum")
+	metaJSON := fs.String("meta-json", "", "Meta data JSON string or @path")
+	metaFile := fs.String("meta-file", "", "Meta data JSON file path")
+	recipient := fs.String("recipient", "", "Address book alias for meta_data.recipient")
+	sender := fs.String("sender", "", "Address book alias for meta_data.sender")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args[1:]); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli templates save <name> [--file path] [--file-name name] [--address-position left|right] [--auto-send] [--delivery-product ...] [--print-mode ...] [--print-spectrum ...] [--meta-json ...|--meta-file ...] [--recipient alias] [--sender alias]")
+		return 0
+	}
+	for _, check := range []struct {
+		flag, value string
+		allowed     []string
+	}{
+		{"address-position", *addressPos, []string{"left", "right"}},
+		{"delivery-product", *deliveryProduct, []string{"fast", "cheap", "bulk", "premium", "registered"}},
+		{"print-mode", *printMode, []string{"simplex", "duplex"}},
+		{"print-spectrum", *printSpectrum, []string{"color", "grayscale"}},
+	} {
+		if check.value != "" && !isAllowed(check.value, check.allowed) {
+			printErrorCode("PINGEN-INPUT-001", "invalid "+check.flag)
+			return 2
+		}
+	}
+
+	for _, alias := range []string{*recipient, *sender} {
+		if alias == "" {
+			continue
+		}
+		if _, err := lookupContact(ctx, alias); err != nil {
+			reportError(ctx, err)
+			return 2
+		}
+	}
+
+	values := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		if isAllowed(f.Name, templateFlags) {
+			values[f.Name] = f.Value.String()
+		}
+	})
+	if *filePath != "" {
+		// Store an absolute path so the template works from any directory.
+		absolute, err := filepath.Abs(*filePath)
+		if err == nil {
+			values["file"] = absolute
+		}
+		if _, err := os.Stat(absolute); err != nil {
+			printErrorCode("PINGEN-UPLOAD-001", "file not found")
+			return 2
+		}
+	}
+	if *metaJSON != "" || *metaFile != "" {
+		// Store the resolved JSON so the template keeps working if the file moves.
+		metaData, err := loadJSONInput(*metaJSON, *metaFile)
+		if err != nil {
+			reportError(ctx, err)
+			return 2
+		}
+		encoded, err := json.Marshal(metaData)
+		if err != nil {
+			reportError(ctx, err)
+			return 2
+		}
+		values["meta-json"] = string(encoded)
+	}
+	if len(values) == 0 {
+		printErrorCode("PINGEN-INPUT-001", "templates save requires at least one letters create flag")
+		return 2
+	}
+
+	cfg, _, err := loadConfig(ctx.configPath)
+	if err != nil {
+		printErrorCode("PINGEN-CONFIG-002", "failed to load config")
+		return 1
+	}
+	if cfg.LetterTemplates == nil {
+		cfg.LetterTemplates = map[string]map[string]string{}
+	}
+	cfg.LetterTemplates[name] = values
+	if err := saveConfig(ctx, cfg); err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	if !ctx.global.quiet {
+		fmt.Printf("saved %s\n", name)
+	}
+	return 0
+}
+
+func lookupLetterTemplate(ctx appContext, name string) (map[string]string, error) {
+	template, ok := ctx.settings.LetterTemplates[name]
+	if !ok {
+		return nil, codedErrorf("PINGEN-CONFIG-005", "unknown letter template: %s", name)
+	}
+	return template, nil
+}
+
+// applyLetterTemplate fills `letters create` flags from a saved template.
+// Flags given on the command line win; config defaults apply afterwards.
+func applyLetterTemplate(ctx appContext, name string, fs *flag.FlagSet) error {
+	if name == "" {
+		return nil
+	}
+	template, err := lookupLetterTemplate(ctx, name)
+	if err != nil {
+		return err
+	}
+	values := map[string]string{}
+	for flagName, value := range template {
+		values[flagName] = value
+	}
+	// An explicit --meta-file replaces the template's meta data.
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "meta-file" {
+			delete(values, "meta-json")
+		}
+	})
+	return applyFlagValues(fs, values, "template "+name)
+}
+
+func describeTemplate(template map[string]string) string {
+	parts := []string{}
+	for _, name := range templateFlags {
+		value, ok := template[name]
+		if !ok {
+			continue
+		}
+		if name == "auto-send" {
+			parts = append(parts, "--auto-send="+value)
+			continue
+		}
+		parts = append(parts, "--"+name+" "+value)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiTimeLayout is the timestamp format used by the Pingen API (Y-m-d\TH:i:sO).
+const apiTimeLayout = "2006-01-02T15:04:05-0700"
+
+var relativeTimePattern = regexp.MustCompile(`^(\d+)([smhdw])$`)
+
+// loadLocation resolves a --tz value; empty means the local zone.
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, codedErrorf("PINGEN-CONFIG-006", "invalid timezone %q", name)
+	}
+	return loc, nil
+}
+
+// inputLocation is the zone used to read dates without an offset.
+func inputLocation(ctx appContext) *time.Location {
+	if ctx.location == nil {
+		return time.Local
+	}
+	return ctx.location
+}
+
+// parseTimeInput interprets --since/--until values. Dates and times without an
+// offset are read in loc; "30d", "12h", "2w" are relative to now.
+func parseTimeInput(value string, loc *time.Location, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if match := relativeTimePattern.FindStringSubmatch(value); match != nil {
+		amount, _ := strconv.Atoi(match[1])
+		unit := map[string]time.Duration{
+			"s": time.Second,
+			"m": time.Minute,
+			"h": time.Hour,
+			"d": 24 * time.Hour,
+			"w": 7 * 24 * time.Hour,
+		}[match[2]]
+		return now.Add(-time.Duration(amount) * unit), nil
+	}
+	for _, layout := range []string{time.RFC3339, apiTimeLayout, "2006-01-02T15:04Z07:00"} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed, nil
+		}
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02T15:04", "2006-01-02T15:04:05", "2006-01-02 15:04"} {
+		if parsed, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, codedErrorf("PINGEN-INPUT-002", "invalid time %q (use YYYY-MM-DD, RFC 3339 or a relative value like 30d)", value)
+}
+
+// timeRangeClauses turns --since/--until into --where clauses on field.
+func timeRangeClauses(field, since, until string, loc *time.Location) ([]string, error) {
+	clauses := []string{}
+	now := time.Now()
+	if since != "" {
+		start, err := parseTimeInput(since, loc, now)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, field+">="+start.In(loc).Format(apiTimeLayout))
+	}
+	if until != "" {
+		end, err := parseTimeInput(until, loc, now)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, field+"<"+end.In(loc).Format(apiTimeLayout))
+	}
+	return clauses, nil
+}
+
+// formatTimestamp renders an API timestamp in the configured zone. Values that
+// are not timestamps are returned unchanged.
+func formatTimestamp(ctx appContext, value any) string {
+	text := stringValue(value)
+	if text == "" || ctx.location == nil {
+		return text
+	}
+	parsed, err := time.Parse(apiTimeLayout, text)
+	if err != nil {
+		parsed, err = time.Parse(time.RFC3339, text)
+		if err != nil {
+			return text
+		}
+	}
+	return parsed.In(ctx.location).Format(apiTimeLayout)
+}
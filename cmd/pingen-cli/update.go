@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+const releasesURL = "https://api.github.com/repos/tobiasbischoff/pingen-cli/releases/latest"
+
+// updateCheckInterval is how often the background check contacts GitHub.
+const updateCheckInterval = 24 * time.Hour
+
+// updateCheckGrace is how long a command waits at exit for a background
+// check still in flight.
+const updateCheckGrace = 300 * time.Millisecond
+
+// releaseInfo is the cached result of the latest release lookup.
+type releaseInfo struct {
+	CheckedAt int64  `json:"checked_at"`
+	Latest    string `json:"latest"`
+	URL       string `json:"url"`
+}
+
+// fetchLatestRelease looks up the latest release on the shared transport, so
+// --ca-cert, --tls-min-version and the proxy settings apply as for the API.
+func fetchLatestRelease(transport http.RoundTripper, timeout time.Duration) (releaseInfo, error) {
+	req, err := http.NewRequest("GET", releasesURL, nil)
+	if err != nil {
+		return releaseInfo{}, err
+	}
+	req.Header.Set("User-Agent", pingen.UserAgent)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	client := &http.Client{Transport: transport, Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return releaseInfo{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return releaseInfo{}, codedErrorf("PINGEN-UPDATE-001", "release lookup failed (HTTP %d)", resp.StatusCode)
+	}
+	var payload struct {
+		TagName string `json:"tag_name"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return releaseInfo{}, err
+	}
+	info := releaseInfo{CheckedAt: time.Now().Unix(), Latest: strings.TrimPrefix(payload.TagName, "v"), URL: payload.HTMLURL}
+	writeReleaseCache(info)
+	return info, nil
+}
+
+// handleCheckUpdate implements --check-update.
+func handleCheckUpdate(transport http.RoundTripper, timeout time.Duration) int {
+	info, err := fetchLatestRelease(transport, timeout)
+	if err != nil {
+		printErrorCode(codeForError(err), err.Error())
+		return 1
+	}
+	if compareVersions(info.Latest, version) > 0 {
+		fmt.Printf("pingen-cli %s is available (running %s)\n%s\n", info.Latest, version, info.URL)
+		return 0
+	}
+	fmt.Printf("pingen-cli %s is up to date\n", version)
+	return 0
+}
+
+// startUpdateCheck refreshes the cached release info in the background at most
+// once per updateCheckInterval. The check time is saved before the lookup
+// starts, so a lookup that fails or is cut short by the command exiting is
+// not retried on every run. The returned function waits up to
+// updateCheckGrace for the lookup and prints an upgrade hint to stderr if a
+// newer release is known.
+func startUpdateCheck(ctx appContext) func() {
+	if !updateCheckEnabled(ctx) {
+		return func() {}
+	}
+	cached, _ := readReleaseCache()
+	var done chan releaseInfo
+	if time.Since(time.Unix(cached.CheckedAt, 0)) > updateCheckInterval {
+		cached.CheckedAt = time.Now().Unix()
+		writeReleaseCache(cached)
+		done = make(chan releaseInfo, 1)
+		go func() {
+			info, err := fetchLatestRelease(ctx.transport, 3*time.Second)
+			if err != nil {
+				info = cached
+			}
+			done <- info
+		}()
+	}
+	return func() {
+		info := cached
+		if done != nil {
+			select {
+			case info = <-done:
+			case <-time.After(updateCheckGrace):
+			}
+		}
+		if info.Latest != "" && compareVersions(info.Latest, version) > 0 {
+			logf("info", "a new pingen-cli release is available: %s -> %s (%s)", version, info.Latest, info.URL)
+		}
+	}
+}
+
+func updateCheckEnabled(ctx appContext) bool {
+	if ctx.settings.DisableUpdateCheck || os.Getenv("PINGEN_NO_UPDATE_CHECK") != "" {
+		return false
+	}
+	if ctx.global.quiet || ctx.global.jsonOutput {
+		return false
+	}
+	// Only nag interactive users; scripts and CI keep clean stderr.
+	info, err := os.Stderr.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	return true
+}
+
+func releaseCachePath() (string, error) {
+	dir, err := pingen.CacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "update-check.json"), nil
+}
+
+func readReleaseCache() (releaseInfo, error) {
+	path, err := releaseCachePath()
+	if err != nil {
+		return releaseInfo{}, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return releaseInfo{}, err
+	}
+	var info releaseInfo
+	err = json.Unmarshal(content, &info)
+	return info, err
+}
+
+func writeReleaseCache(info releaseInfo) {
+	path, err := releaseCachePath()
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return
+	}
+	encoded, err := json.Marshal(info)
+	if err != nil {
+		return
+	}
+	_ = os.WriteFile(path, encoded, 0o600)
+}
+
+// compareVersions compares dotted numeric versions, returning -1, 0 or 1.
+func compareVersions(a, b string) int {
+	left := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	right := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(left) || i < len(right); i++ {
+		var l, r int
+		if i < len(left) {
+			l, _ = strconv.Atoi(strings.SplitN(left[i], "-", 2)[0])
+		}
+		if i < len(right) {
+			r, _ = strconv.Atoi(strings.SplitN(right[i], "-", 2)[0])
+		}
+		if l != r {
+			if l > r {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,526 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// memberRoles are the roles a member of an organisation can have.
+var memberRoles = []string{"owner", "manager"}
+
+// userScope is the OAuth scope of the /user endpoints. It is not part of
+// defaultScope, so the users and associations commands request it on top.
+const userScope = "user"
+
+func handleUsers(ctx appContext, args []string) int {
+	if len(args) == 0 {
+		fmt.Println("users requires a subcommand")
+		return 2
+	}
+	switch args[0] {
+	case "get":
+		return handleUsersGet(ctx, args[1:])
+	case "list":
+		return handleUsersList(ctx, args[1:])
+	case "invite":
+		return handleUsersInvite(ctx, args[1:])
+	case "remove":
+		return handleUsersRemove(ctx, args[1:])
+	case "set-role":
+		return handleUsersSetRole(ctx, args[1:])
+	default:
+		fmt.Println("unknown users subcommand")
+		return 2
+	}
+}
+
+// handleUsersList lists the members of the organisation with their role
+// (owner or manager) and membership status.
+func handleUsersList(ctx appContext, args []string) int {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("users list", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	page := fs.Int("page", 0, "Page number")
+	limit := fs.Int("limit", 0, "Page size")
+	sort := fs.String("sort", "", "Sort expression")
+	filter := fs.String("filter", "", "Filter JSON string or @path")
+	var where stringList
+	fs.Var(&where, "where", "Filter clause (repeatable), see letters list")
+	sortBy := fs.String("sort-by", "", "Client-side stable sort by fields (e.g. role,id)")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli users list [--page N] [--limit N] [--sort expr] [--filter json] [--where clause]... [--sort-by fields]")
+		return 0
+	}
+	filterExpr, err := compileFilter(*filter, where)
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	params := buildListParams(*page, *limit, *sort, filterExpr, "", "user", "", "associations")
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+	payload, headers, err := client.ListOrganisationAssociationsRaw(ctx.jobContext, ctx.settings.OrganisationID, params)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	if *sortBy != "" {
+		data, _ := payload["data"].([]any)
+		sortResources(data, *sortBy)
+	}
+	return emitPayload(ctx, payload, headers, func() {
+		users := includedByID(payload)
+		data, _ := payload["data"].([]any)
+		for _, entry := range data {
+			item, _ := entry.(map[string]any)
+			printMember(item, users)
+		}
+	})
+}
+
+// handleUsersGet shows the user the token belongs to or, given an
+// association id, user id or email address, a member of the organisation.
+func handleUsersGet(ctx appContext, args []string) int {
+	fs := flag.NewFlagSet("users get", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	help := fs.Bool("help", false, "show help")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil || applyParsedDefaults(ctx, fs) != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli users get [<association-id> | <user-id> | <email>]")
+		return 0
+	}
+	if len(positional) > 0 {
+		return showMember(ctx, positional[0])
+	}
+	ctx.scope = userScope
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+	payload, headers, err := client.GetUserRaw(ctx.jobContext)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	return emitPayload(ctx, payload, headers, func() {
+		item, _ := payload["data"].(map[string]any)
+		attrs, _ := item["attributes"].(map[string]any)
+		name := strings.TrimSpace(stringValue(attrs["first_name"]) + " " + stringValue(attrs["last_name"]))
+		fmt.Printf("%s\t%s\t%s\t%s\n", stringValue(item["id"]), stringValue(attrs["email"]), name, stringValue(attrs["status"]))
+	})
+}
+
+// handleUsersInvite invites a user by email address to the organisation, or
+// with --resend sends the invitation of a pending member again.
+func handleUsersInvite(ctx appContext, args []string) int {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("users invite", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	email := fs.String("email", "", "Email address of the user to invite")
+	role := fs.String("role", "manager", "Role of the new member: owner or manager")
+	resend := fs.String("resend", "", "Send the invitation of a pending member (id or email) again")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli users invite --email <address> [--role owner|manager] | --resend <member>")
+		return 0
+	}
+	if *resend != "" {
+		return changeMember(ctx, *resend, "users.invite.resend", "resent invitation to", pingen.Client.ResendInvitation)
+	}
+	if *email == "" {
+		printErrorCode("PINGEN-INPUT-001", "--email is required")
+		return 2
+	}
+	if !isAllowed(*role, memberRoles) {
+		printErrorCode("PINGEN-INPUT-001", "invalid --role: must be owner or manager")
+		return 2
+	}
+	payload := map[string]any{"data": map[string]any{
+		"type":       "associations",
+		"attributes": map[string]any{"email": *email, "role": *role},
+	}}
+	if ctx.global.dryRun {
+		return emitDryRun(ctx, map[string]any{
+			"action":          "users.invite",
+			"organisation_id": ctx.settings.OrganisationID,
+			"payload":         payload,
+		}, func(client pingen.Client) error {
+			_, _, err := client.CreateOrganisationAssociationRaw(ctx.jobContext, ctx.settings.OrganisationID, payload)
+			return err
+		})
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+	result, headers, err := client.CreateOrganisationAssociationRaw(ctx.jobContext, ctx.settings.OrganisationID, payload)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	return emitPayload(ctx, result, headers, func() {
+		item, _ := result["data"].(map[string]any)
+		attrs, _ := item["attributes"].(map[string]any)
+		fmt.Printf("%s\t%s\t%s\t%s\n", stringValue(item["id"]), *email, stringValue(attrs["role"]), stringValue(attrs["status"]))
+	})
+}
+
+// handleUsersRemove blocks a member, which revokes their access to the
+// organisation; --unblock restores it.
+func handleUsersRemove(ctx appContext, args []string) int {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("users remove", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	unblock := fs.Bool("unblock", false, "Restore the access of a removed member")
+	force := fs.Bool("force", false, "Remove without asking for confirmation")
+	help := fs.Bool("help", false, "show help")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil || applyParsedDefaults(ctx, fs) != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli users remove <member> [--unblock] [--force]")
+		return 0
+	}
+	if len(positional) == 0 {
+		printErrorCode("PINGEN-INPUT-001", "member id or email required")
+		return 2
+	}
+	if *unblock {
+		return changeMember(ctx, positional[0], "users.unblock", "unblocked", pingen.Client.UnblockOrganisationAssociation)
+	}
+	if !*force && !ctx.global.dryRun {
+		confirmed, err := confirmAction(fmt.Sprintf("Remove %s from the organisation?", positional[0]))
+		if err != nil {
+			reportError(ctx, err)
+			return 2
+		}
+		if !confirmed {
+			logf("info", "member not removed")
+			return 1
+		}
+	}
+	return changeMember(ctx, positional[0], "users.remove", "removed", pingen.Client.BlockOrganisationAssociation)
+}
+
+// changeMember resolves a member and applies one of the association actions
+// that take no attributes (block, unblock, resend the invitation).
+func changeMember(ctx appContext, value, action, done string, change func(pingen.Client, context.Context, string, string) (http.Header, error)) int {
+	item, _, err := resolveMember(&ctx, value)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	associationID := stringValue(item["id"])
+	if ctx.global.dryRun {
+		return emitDryRun(ctx, map[string]any{
+			"action":          action,
+			"organisation_id": ctx.settings.OrganisationID,
+			"association_id":  associationID,
+		}, func(client pingen.Client) error {
+			_, err := change(client, ctx.jobContext, ctx.settings.OrganisationID, associationID)
+			return err
+		})
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	if _, err := change(newClient(ctx, token), ctx.jobContext, ctx.settings.OrganisationID, associationID); err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	if ctx.global.jsonOutput {
+		return emitJSON(map[string]any{"id": associationID, "action": action, "ok": true})
+	}
+	if !ctx.global.quiet {
+		fmt.Printf("%s member %s\n", done, associationID)
+	}
+	return 0
+}
+
+// handleUsersSetRole changes the role of a member.
+func handleUsersSetRole(ctx appContext, args []string) int {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("users set-role", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	role := fs.String("role", "", "New role: owner or manager")
+	help := fs.Bool("help", false, "show help")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil || applyParsedDefaults(ctx, fs) != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli users set-role <member> --role owner|manager")
+		return 0
+	}
+	if len(positional) == 0 {
+		printErrorCode("PINGEN-INPUT-001", "member id or email required")
+		return 2
+	}
+	if !isAllowed(*role, memberRoles) {
+		printErrorCode("PINGEN-INPUT-001", "invalid --role: must be owner or manager")
+		return 2
+	}
+	item, user, err := resolveMember(&ctx, positional[0])
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	associationID := stringValue(item["id"])
+	payload := map[string]any{"data": map[string]any{
+		"id":         associationID,
+		"type":       "associations",
+		"attributes": map[string]any{"role": *role},
+	}}
+	if ctx.global.dryRun {
+		return emitDryRun(ctx, map[string]any{
+			"action":          "users.set-role",
+			"organisation_id": ctx.settings.OrganisationID,
+			"association_id":  associationID,
+			"payload":         payload,
+		}, func(client pingen.Client) error {
+			_, _, err := client.UpdateOrganisationAssociationRaw(ctx.jobContext, ctx.settings.OrganisationID, associationID, payload)
+			return err
+		})
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+	result, headers, err := client.UpdateOrganisationAssociationRaw(ctx.jobContext, ctx.settings.OrganisationID, associationID, payload)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	return emitPayload(ctx, result, headers, func() {
+		updated, _ := result["data"].(map[string]any)
+		if updated == nil {
+			updated = item
+		}
+		users := map[string]map[string]any{}
+		if user != nil {
+			users[stringValue(user["id"])] = user
+		}
+		printMember(updated, users)
+	})
+}
+
+func showMember(ctx appContext, value string) int {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	item, user, err := resolveMember(&ctx, value)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	payload := map[string]any{"data": item}
+	if user != nil {
+		payload["included"] = []any{user}
+	}
+	return emitPayload(ctx, payload, nil, func() {
+		printMember(item, includedByID(payload))
+	})
+}
+
+// resolveMember finds a member of the organisation by association id, user
+// id, email address or a unique association id prefix. It returns the
+// association and, when the API included it, the user.
+func resolveMember(ctx *appContext, value string) (map[string]any, map[string]any, error) {
+	needle := strings.ToLower(strings.TrimSpace(value))
+	if needle == "" {
+		return nil, nil, codedErrorf("PINGEN-INPUT-001", "member id or email required")
+	}
+	token, err := ensureAccessToken(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	client := newClient(*ctx, token)
+	var prefixed [][2]map[string]any
+	for page := 1; page <= prefixSearchPages; page++ {
+		payload, _, err := client.ListOrganisationAssociationsRaw(ctx.jobContext, ctx.settings.OrganisationID, map[string]string{
+			"page[number]": strconv.Itoa(page),
+			"page[limit]":  "100",
+			"include":      "user",
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		users := includedByID(payload)
+		data, _ := payload["data"].([]any)
+		for _, entry := range data {
+			item, _ := entry.(map[string]any)
+			id := strings.ToLower(stringValue(item["id"]))
+			userID := stringValue(lookupField(item, "relationships.user.data.id"))
+			user := users[userID]
+			email := strings.ToLower(stringValue(lookupField(user, "email")))
+			switch {
+			case id == needle || strings.ToLower(userID) == needle || (email != "" && email == needle):
+				return item, user, nil
+			case strings.HasPrefix(id, needle):
+				prefixed = append(prefixed, [2]map[string]any{item, user})
+			}
+		}
+		if len(data) < 100 {
+			break
+		}
+	}
+	switch len(prefixed) {
+	case 0:
+		return nil, nil, codedErrorf("PINGEN-INPUT-011", "unknown member: %s", value)
+	case 1:
+		return prefixed[0][0], prefixed[0][1], nil
+	}
+	ids := make([]string, 0, len(prefixed))
+	for _, match := range prefixed {
+		ids = append(ids, stringValue(match[0]["id"]))
+	}
+	return nil, nil, codedErrorf("PINGEN-INPUT-011", "ambiguous member %s: matches %s", value, strings.Join(ids, ", "))
+}
+
+// includedByID indexes the included resources of a payload by id.
+func includedByID(payload map[string]any) map[string]map[string]any {
+	byID := map[string]map[string]any{}
+	included, _ := payload["included"].([]any)
+	for _, entry := range included {
+		item, _ := entry.(map[string]any)
+		byID[stringValue(item["id"])] = item
+	}
+	return byID
+}
+
+// printMember prints the plain line of an organisation association: its id,
+// the user's email and name, the role and the status.
+func printMember(item map[string]any, users map[string]map[string]any) {
+	attrs, _ := item["attributes"].(map[string]any)
+	email, name := "-", "-"
+	if user := users[stringValue(lookupField(item, "relationships.user.data.id"))]; user != nil {
+		userAttrs, _ := user["attributes"].(map[string]any)
+		email = stringValue(userAttrs["email"])
+		if full := strings.TrimSpace(stringValue(userAttrs["first_name"]) + " " + stringValue(userAttrs["last_name"])); full != "" {
+			name = full
+		}
+	}
+	fmt.Printf("%s\t%s\t%s\t%s\t%s\n", stringValue(item["id"]), email, name, stringValue(attrs["role"]), stringValue(attrs["status"]))
+}
+
+func handleAssociations(ctx appContext, args []string) int {
+	if len(args) == 0 {
+		fmt.Println("associations requires a subcommand")
+		return 2
+	}
+	switch args[0] {
+	case "list":
+		return handleAssociationsList(ctx, args[1:])
+	default:
+		fmt.Println("unknown associations subcommand")
+		return 2
+	}
+}
+
+// handleAssociationsList lists the organisations the current user belongs
+// to with the role (owner or manager) and status of each membership.
+func handleAssociationsList(ctx appContext, args []string) int {
+	fs := flag.NewFlagSet("associations list", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	page := fs.Int("page", 0, "Page number")
+	limit := fs.Int("limit", 0, "Page size")
+	sort := fs.String("sort", "", "Sort expression")
+	filter := fs.String("filter", "", "Filter JSON string or @path")
+	var where stringList
+	fs.Var(&where, "where", "Filter clause (repeatable), see letters list")
+	fields := fs.String("fields", "", "Sparse fieldset for primary type")
+	sortBy := fs.String("sort-by", "", "Client-side stable sort by fields (e.g. role,id)")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli associations list [--page N] [--limit N] [--sort expr] [--filter json] [--where clause]... [--fields list] [--sort-by fields]")
+		return 0
+	}
+	filterExpr, err := compileFilter(*filter, where)
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	params := buildListParams(*page, *limit, *sort, filterExpr, "", "organisation", *fields, "associations")
+	ctx.scope = userScope
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+	payload, headers, err := client.ListUserAssociationsRaw(ctx.jobContext, params)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	if *sortBy != "" {
+		data, _ := payload["data"].([]any)
+		sortResources(data, *sortBy)
+	}
+	return emitPayload(ctx, payload, headers, func() {
+		names := map[string]string{}
+		included, _ := payload["included"].([]any)
+		for _, entry := range included {
+			item, _ := entry.(map[string]any)
+			attrs, _ := item["attributes"].(map[string]any)
+			names[stringValue(item["id"])] = stringValue(attrs["name"])
+		}
+		data, _ := payload["data"].([]any)
+		for _, entry := range data {
+			item, _ := entry.(map[string]any)
+			attrs, _ := item["attributes"].(map[string]any)
+			orgID := stringValue(lookupField(item, "relationships.organisation.data.id"))
+			name := names[orgID]
+			if name == "" {
+				name = "-"
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\t%s\n", stringValue(item["id"]), orgID, name, stringValue(attrs["role"]), stringValue(attrs["status"]))
+		}
+	})
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// letterProgress is the order in which a letter passes the states it can be
+// waited for; a letter that is further along has reached the earlier ones.
+var letterProgress = []string{"validating", "valid", "submitted", "accepted", "printing", "sent"}
+
+// letterProcessingStatuses are the states a letter leaves on its own.
+var letterProcessingStatuses = []string{"validating", "processing", "submitted", "accepted", "printing", "cancelling"}
+
+// letterErrorStatuses end a wait with an error unless they are waited for.
+var letterErrorStatuses = []string{"action_required", "unprintable", "invalid", "failed", "cancelled", "expired", "undeliverable"}
+
+// letterWaitOptions control how long and how often a letter is polled.
+type letterWaitOptions struct {
+	until    []string
+	interval time.Duration
+	maxWait  time.Duration
+}
+
+func addLetterWaitFlags(fs *flag.FlagSet) *letterWaitOptions {
+	options := &letterWaitOptions{}
+	fs.DurationVar(&options.interval, "interval", 5*time.Second, "Polling interval while waiting")
+	fs.DurationVar(&options.maxWait, "max-wait", 10*time.Minute, "Give up waiting after this long (0: no limit)")
+	return options
+}
+
+func (o letterWaitOptions) validate() error {
+	if o.interval < time.Second {
+		return codedErrorf("PINGEN-INPUT-001", "--interval must be at least 1s")
+	}
+	if o.maxWait < 0 {
+		return codedErrorf("PINGEN-INPUT-001", "--max-wait must not be negative")
+	}
+	return nil
+}
+
+// letterWaitError ends a wait without the awaited state: the letter landed
+// in an error state, or --max-wait passed.
+type letterWaitError struct {
+	letterID string
+	status   string
+	timeout  time.Duration
+}
+
+func (e letterWaitError) Error() string {
+	if e.timeout > 0 {
+		return fmt.Sprintf("timed out waiting for letter %s after %s (status %s)", e.letterID, e.timeout, e.status)
+	}
+	return fmt.Sprintf("letter ended in status %s: %s; see `pingen-cli letters get %s`", e.status, e.letterID, e.letterID)
+}
+
+// letterWaitDone reports whether status ends a wait for until, and whether
+// it does so successfully. Without until the wait ends once the letter has
+// left the processing states.
+func letterWaitDone(status string, until []string) (bool, bool) {
+	if isAllowed(status, until) {
+		return true, true
+	}
+	if len(until) == 0 {
+		if isAllowed(status, letterProcessingStatuses) || status == "" {
+			return false, false
+		}
+		return true, !isAllowed(status, letterErrorStatuses)
+	}
+	if isAllowed(status, letterErrorStatuses) {
+		return true, false
+	}
+	reached := indexOf(letterProgress, status)
+	for _, target := range until {
+		if want := indexOf(letterProgress, target); want >= 0 && reached > want {
+			return true, true
+		}
+	}
+	return false, false
+}
+
+func indexOf(values []string, value string) int {
+	for i, candidate := range values {
+		if candidate == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// waitForLetter polls the letter until letterWaitDone says the wait is over
+// and returns the last response. Network errors, rate limiting and server
+// errors are logged and polling continues.
+func waitForLetter(ctx appContext, client pingen.Client, letterID string, options letterWaitOptions) (map[string]any, http.Header, error) {
+	started := time.Now()
+	for attempt := 1; ; attempt++ {
+		payload, headers, err := client.GetLetterRaw(ctx.jobContext, ctx.settings.OrganisationID, letterID)
+		status := ""
+		switch {
+		case err != nil && ctx.jobContext.Err() == nil && retryableWatchError(err):
+			logf("warn", "polling letter %s failed, retrying: %s", letterID, err.Error())
+		case err != nil:
+			return nil, nil, err
+		default:
+			data, _ := payload["data"].(map[string]any)
+			attrs, _ := data["attributes"].(map[string]any)
+			status = stringValue(attrs["status"])
+			done, ok := letterWaitDone(status, options.until)
+			verbosef(ctx, "poll %d: letter %s status=%s", attempt, letterID, status)
+			if done && ok {
+				return payload, headers, nil
+			}
+			if done {
+				return payload, headers, letterWaitError{letterID: letterID, status: status}
+			}
+		}
+		wait := options.interval
+		if options.maxWait > 0 {
+			left := options.maxWait - time.Since(started)
+			if left <= 0 {
+				return nil, nil, letterWaitError{letterID: letterID, status: status, timeout: options.maxWait}
+			}
+			if left < wait {
+				wait = left
+			}
+		}
+		if !sleepContext(ctx.jobContext, wait) {
+			return nil, nil, ctx.jobContext.Err()
+		}
+	}
+}
+
+// handleLettersWait blocks until a letter reaches one of the --until states,
+// by default until it has left validation. It exits with 1 when the letter
+// lands in an error state such as action_required instead, or when
+// --max-wait passes.
+func handleLettersWait(ctx appContext, args []string) (exitCode int) {
+	fs := flag.NewFlagSet("letters wait", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	until := fs.String("until", "", "Comma-separated states to wait for, e.g. valid, sent or action_required (default: any state after processing)")
+	options := addLetterWaitFlags(fs)
+	pick := fs.Bool("pick", false, "Choose the letter interactively from the newest letters")
+	hooks := addHookFlags(fs)
+	help := fs.Bool("help", false, "show help")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil || applyParsedDefaults(ctx, fs) != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli letters wait <letter_id>|--pick [--until valid|sent|action_required,...] [--interval 5s] [--max-wait 10m] [--on-success cmd] [--on-failure cmd]")
+		return 0
+	}
+	event := hookEvent{command: "letters wait"}
+	defer func() { hooks.run(ctx, event, exitCode) }()
+	if ctx.settings.OrganisationID == "" {
+		return event.fail("PINGEN-INPUT-001", "organisation id required", 2)
+	}
+	if err := options.validate(); err != nil {
+		return event.failErr(ctx, err, 2)
+	}
+	options.until = splitStatuses(*until)
+	for _, status := range options.until {
+		if indexOf(letterProgress, status) < 0 && !isAllowed(status, letterProcessingStatuses) && !isAllowed(status, letterErrorStatuses) {
+			return event.fail("PINGEN-INPUT-001", fmt.Sprintf("invalid --until state %q", status), 2)
+		}
+	}
+	switch {
+	case len(positional) > 0:
+		event.letterID, err = resolveLetterID(&ctx, positional[0])
+	case *pick:
+		event.letterID, err = pickResource(&ctx, "letters")
+	default:
+		return event.fail("PINGEN-INPUT-001", "letter id required", 2)
+	}
+	if err != nil {
+		return event.failErr(ctx, err, 1)
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		return event.failErr(ctx, err, 1)
+	}
+	var stopSignals func()
+	ctx.jobContext, stopSignals = handleSignals(ctx.jobContext)
+	defer stopSignals()
+	client := newClient(ctx, token)
+	payload, headers, err := waitForLetter(ctx, client, event.letterID, *options)
+	if payload != nil {
+		event.setLetter(payload)
+	}
+	if err != nil {
+		event.message = err.Error()
+	}
+	return finishLetterWait(ctx, payload, headers, err)
+}
+
+// finishLetterWait prints the letter a wait ended with and returns the exit
+// code: 0 for the awaited state, 1 for an error state or timeout.
+func finishLetterWait(ctx appContext, payload map[string]any, headers http.Header, err error) int {
+	if err == nil {
+		return emitPayload(ctx, payload, headers, func() { printLetterSummary(payload) })
+	}
+	if interrupted(ctx) {
+		printErrorCode("PINGEN-NET-003", "interrupted before the letter reached the awaited state")
+		return exitInterrupted
+	}
+	if ctx.jobContext.Err() != nil {
+		printErrorCode("PINGEN-NET-002", fmt.Sprintf("deadline exceeded after %s before the letter reached the awaited state", ctx.global.deadline))
+		return 1
+	}
+	if payload != nil && !ctx.global.jsonOutput && !ctx.global.quiet {
+		printLetterSummary(payload)
+	}
+	reportError(ctx, err)
+	return 1
+}
+
+// splitStatuses is splitColumns for status lists; it lower-cases them.
+func splitStatuses(value string) []string {
+	statuses := splitColumns(value)
+	for i := range statuses {
+		statuses[i] = strings.ToLower(statuses[i])
+	}
+	return statuses
+}
@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestLetterWaitDone(t *testing.T) {
+	tests := []struct {
+		status  string
+		until   []string
+		done    bool
+		success bool
+	}{
+		// Without --until the wait ends once processing is over.
+		{status: "", done: false},
+		{status: "validating", done: false},
+		{status: "processing", done: false},
+		{status: "submitted", done: false},
+		{status: "cancelling", done: false},
+		{status: "valid", done: true, success: true},
+		{status: "sent", done: true, success: true},
+		{status: "action_required", done: true, success: false},
+		{status: "undeliverable", done: true, success: false},
+		// With --until the wait ends at the target or a later status.
+		{status: "valid", until: []string{"valid"}, done: true, success: true},
+		{status: "validating", until: []string{"valid"}, done: false},
+		{status: "printing", until: []string{"submitted"}, done: true, success: true},
+		{status: "accepted", until: []string{"sent"}, done: false},
+		{status: "sent", until: []string{"printing", "cancelled"}, done: true, success: true},
+		{status: "cancelled", until: []string{"printing", "cancelled"}, done: true, success: true},
+		{status: "cancelled", until: []string{"sent"}, done: true, success: false},
+		{status: "invalid", until: []string{"valid"}, done: true, success: false},
+		{status: "processing", until: []string{"submitted"}, done: false},
+	}
+	for _, tt := range tests {
+		name := tt.status
+		if len(tt.until) > 0 {
+			name += " until " + tt.until[0]
+		}
+		t.Run(name, func(t *testing.T) {
+			done, success := letterWaitDone(tt.status, tt.until)
+			if done != tt.done || success != tt.success {
+				t.Errorf("letterWaitDone(%q, %v) = %v, %v; want %v, %v", tt.status, tt.until, done, success, tt.done, tt.success)
+			}
+		})
+	}
+}
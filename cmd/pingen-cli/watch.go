@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// watchResources are the resources `watch` can poll.
+var watchResources = []string{"letters", "batches", "webhooks", "organisations"}
+
+func handleWatch(ctx appContext, args []string) int {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	until := fs.String("until", "", "Query expression that ends the watch when true (e.g. '.data.attributes.status == \"sent\"')")
+	interval := fs.Duration("interval", 30*time.Second, "Polling interval")
+	pick := fs.Bool("pick", false, "Choose the resource interactively when no id is given")
+	help := fs.Bool("help", false, "show help")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil || applyParsedDefaults(ctx, fs) != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli watch <letters|batches|webhooks|organisations> <id>|--pick --until <expression> [--interval 30s]")
+		return 0
+	}
+	if len(positional) == 0 || !isAllowed(positional[0], watchResources) {
+		printErrorCode("PINGEN-INPUT-001", "invalid resource (use letters, batches, webhooks or organisations)")
+		return 2
+	}
+	resource := positional[0]
+	id := ""
+	if len(positional) > 1 {
+		id = positional[1]
+	}
+	if id == "" && *pick {
+		if resource != "organisations" && ctx.settings.OrganisationID == "" {
+			printErrorCode("PINGEN-INPUT-001", "organisation id required")
+			return 2
+		}
+		if id, err = pickResource(&ctx, resource); err != nil {
+			reportError(ctx, err)
+			return 1
+		}
+	}
+	if resource == "organisations" && id == "" {
+		id = ctx.settings.OrganisationID
+	}
+	if id == "" {
+		printErrorCode("PINGEN-INPUT-001", resource+" id required")
+		return 2
+	}
+	if resource != "organisations" && ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	if *until == "" {
+		printErrorCode("PINGEN-INPUT-001", "--until is required")
+		return 2
+	}
+	if *interval < time.Second {
+		printErrorCode("PINGEN-INPUT-001", "--interval must be at least 1s")
+		return 2
+	}
+	condition, err := compileQuery(*until)
+	if err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	switch resource {
+	case "letters":
+		id, err = resolveLetterID(&ctx, id)
+	case "batches":
+		id, err = resolveBatchID(&ctx, id)
+	case "webhooks":
+		id, err = resolveWebhookID(&ctx, id)
+	}
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	var stopSignals func()
+	ctx.jobContext, stopSignals = handleSignals(ctx.jobContext)
+	defer stopSignals()
+	client := newClient(ctx, token)
+	fetch := watchFetcher(client, ctx.settings.OrganisationID, resource)
+
+	for attempt := 1; ; attempt++ {
+		payload, headers, err := fetch(ctx.jobContext, id)
+		if err != nil && ctx.jobContext.Err() == nil && retryableWatchError(err) {
+			logf("warn", "polling %s %s failed, retrying: %s", resource, id, err.Error())
+		} else if err != nil {
+			reportError(ctx, err)
+			if interrupted(ctx) {
+				return exitInterrupted
+			}
+			return 1
+		} else {
+			done, err := evalCondition(condition, map[string]any(payload))
+			if err != nil {
+				reportError(ctx, err)
+				return 2
+			}
+			data, _ := payload["data"].(map[string]any)
+			attrs, _ := data["attributes"].(map[string]any)
+			verbosef(ctx, "poll %d: %s %s status=%s condition=%t", attempt, resource, id, stringValue(attrs["status"]), done)
+			if done {
+				return emitPayload(ctx, payload, headers, func() {
+					fmt.Printf("%s\t%s\n", stringValue(data["id"]), stringValue(attrs["status"]))
+				})
+			}
+		}
+		if !sleepContext(ctx.jobContext, *interval) {
+			if interrupted(ctx) {
+				printErrorCode("PINGEN-NET-003", "interrupted before the condition was met")
+				return exitInterrupted
+			}
+			printErrorCode("PINGEN-NET-002", fmt.Sprintf("deadline exceeded after %s before the condition was met", ctx.global.deadline))
+			return 1
+		}
+	}
+}
+
+type watchFetch func(ctx context.Context, id string) (map[string]any, http.Header, error)
+
+func watchFetcher(client pingen.Client, orgID, resource string) watchFetch {
+	switch resource {
+	case "batches":
+		return func(ctx context.Context, id string) (map[string]any, http.Header, error) {
+			return client.GetBatchRaw(ctx, orgID, id)
+		}
+	case "webhooks":
+		return func(ctx context.Context, id string) (map[string]any, http.Header, error) {
+			return client.GetWebhookRaw(ctx, orgID, id)
+		}
+	case "organisations":
+		return client.GetOrganisationRaw
+	}
+	return func(ctx context.Context, id string) (map[string]any, http.Header, error) {
+		return client.GetLetterRaw(ctx, orgID, id)
+	}
+}
+
+// retryableWatchError reports whether polling should continue after err:
+// network failures, rate limiting and server errors are transient.
+func retryableWatchError(err error) bool {
+	var apiErr pingen.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Status == http.StatusTooManyRequests || apiErr.Status >= 500
+	}
+	return true
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tobiasbischoff/pingen-cli/pingen"
+)
+
+// maxWebhookBody bounds the size of a webhook request body.
+const maxWebhookBody = 1 << 20
+
+func handleWebhooks(ctx appContext, args []string) int {
+	if len(args) == 0 {
+		fmt.Println("webhooks requires a subcommand")
+		return 2
+	}
+	switch args[0] {
+	case "create":
+		return handleWebhooksCreate(ctx, args[1:])
+	case "listen":
+		return handleWebhooksListen(ctx, args[1:])
+	default:
+		fmt.Println("unknown webhooks subcommand")
+		return 2
+	}
+}
+
+// webhookCategories are the event categories a webhook can subscribe to.
+var webhookCategories = []string{"issues", "sent", "undeliverable", "delivered", "channel_subscriptions"}
+
+// handleWebhooksCreate subscribes a URL to the events of one category. The
+// signing key is read like for webhooks listen, so both ends can share one
+// key file.
+func handleWebhooksCreate(ctx appContext, args []string) int {
+	if ctx.settings.OrganisationID == "" {
+		printErrorCode("PINGEN-INPUT-001", "organisation id required")
+		return 2
+	}
+	fs := flag.NewFlagSet("webhooks create", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	category := fs.String("event-category", "", "Events to deliver: "+strings.Join(webhookCategories, ", "))
+	url := fs.String("url", "", "HTTPS URL that receives the events")
+	secret := fs.String("secret", "", "Signing key, up to 32 characters (or PINGEN_WEBHOOK_SECRET)")
+	secretFile := fs.String("secret-file", "", "Read the signing key from a file")
+	schemaOnly := fs.Bool("schema-only", false, "Validate the request body against its schema and exit without network calls")
+	payloadFile := fs.String("payload", "", "With --schema-only, validate this request body (JSON file or -) instead of one built from the flags")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli webhooks create --event-category <" + strings.Join(webhookCategories, "|") + "> --url <url> --secret key|--secret-file path [--schema-only [--payload file]]")
+		return 0
+	}
+	if *payloadFile != "" {
+		return validatePayloadFile(ctx, "webhook-create", *payloadFile, *schemaOnly)
+	}
+	key := *secret
+	if key == "" {
+		key = os.Getenv("PINGEN_WEBHOOK_SECRET")
+	}
+	if *secretFile != "" {
+		data, err := os.ReadFile(*secretFile)
+		if err != nil {
+			printErrorCode("PINGEN-INPUT-001", fmt.Sprintf("failed to read --secret-file: %v", err))
+			return 2
+		}
+		key = strings.TrimSpace(string(data))
+	}
+	if key == "" {
+		printErrorCode("PINGEN-INPUT-001", "webhook signing key required (--secret, --secret-file or PINGEN_WEBHOOK_SECRET)")
+		return 2
+	}
+	payload := map[string]any{"data": map[string]any{
+		"type": "webhooks",
+		"attributes": map[string]any{
+			"event_category": *category,
+			"url":            *url,
+			"signing_key":    key,
+		},
+	}}
+	if err := pingen.ValidatePayload("webhook-create", payload); err != nil {
+		reportError(ctx, err)
+		return 2
+	}
+	if *schemaOnly {
+		return reportSchemaValid("webhook-create")
+	}
+	if ctx.global.dryRun {
+		return emitDryRun(ctx, map[string]any{
+			"action":          "webhooks.create",
+			"organisation_id": ctx.settings.OrganisationID,
+			"payload":         payload,
+		}, func(client pingen.Client) error {
+			_, _, err := client.CreateWebhookRaw(ctx.jobContext, ctx.settings.OrganisationID, payload)
+			return err
+		})
+	}
+	token, err := ensureAccessToken(&ctx)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	client := newClient(ctx, token)
+	result, headers, err := client.CreateWebhookRaw(ctx.jobContext, ctx.settings.OrganisationID, payload)
+	if err != nil {
+		reportError(ctx, err)
+		return 1
+	}
+	return emitPayload(ctx, result, headers, func() {
+		item, _ := result["data"].(map[string]any)
+		attrs, _ := item["attributes"].(map[string]any)
+		fmt.Printf("%s\t%s\t%s\n", stringValue(item["id"]), stringValue(attrs["event_category"]), stringValue(attrs["url"]))
+	})
+}
+
+// webhookListener receives Pingen webhook requests, checks their signature
+// and prints them as JSON lines or hands them to --exec, one at a time.
+type webhookListener struct {
+	ctx       appContext
+	secret    string
+	exec      string
+	maxEvents int
+
+	mu       sync.Mutex
+	received int
+	done     chan struct{}
+}
+
+func handleWebhooksListen(ctx appContext, args []string) int {
+	fs := flag.NewFlagSet("webhooks listen", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	host := fs.String("host", "127.0.0.1", "Address to listen on (0.0.0.0 for all interfaces)")
+	port := fs.Int("port", 8080, "Port to listen on")
+	secret := fs.String("secret", "", "Signing key of the webhook (or PINGEN_WEBHOOK_SECRET)")
+	secretFile := fs.String("secret-file", "", "Read the signing key from a file")
+	noVerify := fs.Bool("no-verify", false, "Accept requests without checking the signature (local testing only)")
+	execCommand := fs.String("exec", "", "Shell command to run for each event, with the event JSON on stdin")
+	maxEvents := fs.Int("max-events", 0, "Exit after this many events (0: run until Ctrl-C or --deadline)")
+	help := fs.Bool("help", false, "show help")
+	if err := parseFlags(ctx, fs, args); err != nil {
+		return 2
+	}
+	if *help {
+		fmt.Println("Usage: pingen-cli webhooks listen [--port 8080] [--host 127.0.0.1] --secret key|--secret-file path|--no-verify [--exec cmd] [--max-events n]")
+		return 0
+	}
+	if *port < 1 || *port > 65535 {
+		printErrorCode("PINGEN-INPUT-001", "--port must be between 1 and 65535")
+		return 2
+	}
+	if *maxEvents < 0 {
+		printErrorCode("PINGEN-INPUT-001", "--max-events must not be negative")
+		return 2
+	}
+	key := *secret
+	if key == "" {
+		key = os.Getenv("PINGEN_WEBHOOK_SECRET")
+	}
+	if *secretFile != "" {
+		data, err := os.ReadFile(*secretFile)
+		if err != nil {
+			printErrorCode("PINGEN-INPUT-001", fmt.Sprintf("failed to read --secret-file: %v", err))
+			return 2
+		}
+		key = strings.TrimSpace(string(data))
+	}
+	if key == "" && !*noVerify {
+		printErrorCode("PINGEN-INPUT-001", "webhook signing key required (--secret, --secret-file or PINGEN_WEBHOOK_SECRET; --no-verify skips the check)")
+		return 2
+	}
+	if *noVerify {
+		key = ""
+		logf("warn", "signature verification is off: any request is accepted")
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(*host, fmt.Sprint(*port)))
+	if err != nil {
+		reportError(ctx, codedErrorf("PINGEN-NET-001", "failed to listen on %s:%d: %w", *host, *port, err))
+		return 1
+	}
+	var stopSignals func()
+	ctx.jobContext, stopSignals = handleSignals(ctx.jobContext)
+	defer stopSignals()
+
+	receiver := &webhookListener{ctx: ctx, secret: key, exec: *execCommand, maxEvents: *maxEvents, done: make(chan struct{})}
+	server := &http.Server{Handler: receiver, ReadHeaderTimeout: 10 * time.Second}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.Serve(listener) }()
+	logf("info", "listening for Pingen webhooks on http://%s/ (Ctrl-C to stop)", listener.Addr())
+
+	code := 0
+	select {
+	case <-receiver.done:
+	case <-ctx.jobContext.Done():
+		// Ctrl-C or --deadline ends the listener normally.
+	case err := <-serveErr:
+		reportError(ctx, err)
+		code = 1
+	}
+	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server.Shutdown(shutdown)
+	return code
+}
+
+func (l *webhookListener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody+1))
+	if err != nil || len(body) > maxWebhookBody {
+		http.Error(w, "request body too large or unreadable", http.StatusBadRequest)
+		return
+	}
+	if l.secret != "" && !pingen.VerifyWebhookSignature(body, r.Header.Get(pingen.WebhookSignatureHeader), l.secret) {
+		logf("warn", "rejected a webhook request from %s: invalid signature", r.RemoteAddr)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		logf("warn", "rejected a webhook request from %s: invalid JSON", r.RemoteAddr)
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxEvents > 0 && l.received >= l.maxEvents {
+		http.Error(w, "listener is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	data, _ := payload["data"].(map[string]any)
+	verbosef(l.ctx, "received %s %s", stringValue(data["type"]), stringValue(data["id"]))
+	if l.exec != "" {
+		if err := l.forward(body, data); err != nil {
+			// A failed command answers 500 so that Pingen delivers the event again.
+			logf("warn", "--exec failed for %s %s: %v", stringValue(data["type"]), stringValue(data["id"]), err)
+			http.Error(w, "event handler failed", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		var line bytes.Buffer
+		if err := json.Compact(&line, body); err != nil {
+			line.Reset()
+			line.Write(body)
+		}
+		fmt.Println(line.String())
+	}
+	w.WriteHeader(http.StatusOK)
+	l.received++
+	if l.maxEvents > 0 && l.received == l.maxEvents {
+		close(l.done)
+	}
+}
+
+// forward runs --exec with the raw event on stdin and its type and ids in
+// the environment.
+func (l *webhookListener) forward(body []byte, data map[string]any) error {
+	cmd := shellCommand(l.exec)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"PINGEN_WEBHOOK_TYPE="+stringValue(data["type"]),
+		"PINGEN_WEBHOOK_ID="+stringValue(data["id"]),
+		"PINGEN_ORG_ID="+relationshipID(data, "organisation"),
+		"PINGEN_LETTER_ID="+relationshipID(data, "letter"),
+		"PINGEN_EVENT_ID="+relationshipID(data, "event"),
+	)
+	err := cmd.Run()
+	var exitErr interface{ ExitCode() int }
+	if errors.As(err, &exitErr) {
+		return fmt.Errorf("exit code %d", exitErr.ExitCode())
+	}
+	return err
+}
+
+// relationshipID returns the id of the related resource name, or "".
+func relationshipID(data map[string]any, name string) string {
+	relationships, _ := data["relationships"].(map[string]any)
+	related, _ := relationships[name].(map[string]any)
+	linkage, _ := related["data"].(map[string]any)
+	return stringValue(linkage["id"])
+}
@@ -1,3 +1,3 @@
-module pingen-cli
+module github.com/tobiasbischoff/pingen-cli
 
 go 1.20
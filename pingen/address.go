@@ -0,0 +1,155 @@
+package pingen
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// AddressProblem is a field of an address that breaks the postal rules of its
+// destination country.
+type AddressProblem struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// AddressError lists every problem found in an address.
+type AddressError struct {
+	Problems []AddressProblem
+}
+
+func (err AddressError) Error() string {
+	parts := make([]string, 0, len(err.Problems))
+	for _, problem := range err.Problems {
+		parts = append(parts, problem.Field+": "+problem.Message)
+	}
+	return "invalid address: " + strings.Join(parts, "; ")
+}
+
+// isoCountries are the ISO 3166-1 alpha-2 codes.
+var isoCountries = strings.Fields(`
+AD AE AF AG AI AL AM AO AQ AR AS AT AU AW AX AZ BA BB BD BE BF BG BH BI BJ BL
+BM BN BO BQ BR BS BT BV BW BY BZ CA CC CD CF CG CH CI CK CL CM CN CO CR CU CV
+CW CX CY CZ DE DJ DK DM DO DZ EC EE EG EH ER ES ET FI FJ FK FM FO FR GA GB GD
+GE GF GG GH GI GL GM GN GP GQ GR GS GT GU GW GY HK HM HN HR HT HU ID IE IL IM
+IN IO IQ IR IS IT JE JM JO JP KE KG KH KI KM KN KP KR KW KY KZ LA LB LC LI LK
+LR LS LT LU LV LY MA MC MD ME MF MG MH MK ML MM MN MO MP MQ MR MS MT MU MV MW
+MX MY MZ NA NC NE NF NG NI NL NO NP NR NU NZ OM PA PE PF PG PH PK PL PM PN PR
+PS PT PW PY QA RE RO RS RU RW SA SB SC SD SE SG SH SI SJ SK SL SM SN SO SR SS
+ST SV SX SY SZ TC TD TF TG TH TJ TK TL TM TN TO TR TT TV TW TZ UA UG UM US UY
+UZ VA VC VE VG VI VN VU WF WS YE YT ZA ZM ZW`)
+
+// countryAliases maps alpha-3 codes, common non-ISO codes and country names in
+// the languages of the region (lower case) to alpha-2 codes.
+var countryAliases = map[string]string{
+	"che": "CH", "lie": "LI", "deu": "DE", "aut": "AT", "fra": "FR", "ita": "IT",
+	"esp": "ES", "prt": "PT", "nld": "NL", "bel": "BE", "lux": "LU", "gbr": "GB",
+	"irl": "IE", "dnk": "DK", "swe": "SE", "nor": "NO", "fin": "FI", "pol": "PL",
+	"cze": "CZ", "svk": "SK", "hun": "HU", "svn": "SI", "hrv": "HR", "grc": "GR",
+	"usa": "US", "can": "CA", "uk": "GB",
+	"schweiz": "CH", "suisse": "CH", "svizzera": "CH", "svizra": "CH", "switzerland": "CH",
+	"deutschland": "DE", "germany": "DE", "allemagne": "DE", "germania": "DE",
+	"österreich": "AT", "oesterreich": "AT", "austria": "AT", "autriche": "AT",
+	"liechtenstein": "LI", "fürstentum liechtenstein": "LI",
+	"frankreich": "FR", "france": "FR", "francia": "FR",
+	"italien": "IT", "italia": "IT", "italy": "IT", "italie": "IT",
+	"luxemburg": "LU", "luxembourg": "LU",
+	"belgien": "BE", "belgique": "BE", "belgium": "BE",
+	"niederlande": "NL", "nederland": "NL", "netherlands": "NL", "pays-bas": "NL",
+	"spanien": "ES", "españa": "ES", "spain": "ES", "espagne": "ES",
+	"portugal":               "PT",
+	"vereinigtes königreich": "GB", "united kingdom": "GB", "grossbritannien": "GB", "great britain": "GB",
+	"vereinigte staaten": "US", "united states": "US",
+}
+
+// NormalizeCountry returns the ISO 3166-1 alpha-2 code for an alpha-2 or
+// alpha-3 code or a country name.
+func NormalizeCountry(value string) (string, bool) {
+	text := strings.TrimSpace(value)
+	if code := strings.ToUpper(text); len(code) == 2 {
+		for _, known := range isoCountries {
+			if known == code {
+				return code, true
+			}
+		}
+	}
+	code, ok := countryAliases[strings.ToLower(text)]
+	return code, ok
+}
+
+type postcodeRule struct {
+	pattern *regexp.Regexp
+	example string
+}
+
+// postcodeRules are the postcode formats of common destinations. Countries
+// without a rule accept any postcode.
+var postcodeRules = map[string]postcodeRule{
+	"CH": {regexp.MustCompile(`^[1-9]\d{3}$`), "8000"},
+	"LI": {regexp.MustCompile(`^94(8[5-9]|9[0-8])$`), "9490"},
+	"DE": {regexp.MustCompile(`^\d{5}$`), "10115"},
+	"AT": {regexp.MustCompile(`^[1-9]\d{3}$`), "1010"},
+	"FR": {regexp.MustCompile(`^\d{5}$`), "75001"},
+	"IT": {regexp.MustCompile(`^\d{5}$`), "00184"},
+	"ES": {regexp.MustCompile(`^\d{5}$`), "28001"},
+	"PT": {regexp.MustCompile(`^\d{4}-\d{3}$`), "1000-001"},
+	"NL": {regexp.MustCompile(`^[1-9]\d{3} ?[A-Z]{2}$`), "1011 AB"},
+	"BE": {regexp.MustCompile(`^[1-9]\d{3}$`), "1000"},
+	"LU": {regexp.MustCompile(`^(L-)?\d{4}$`), "1111"},
+	"DK": {regexp.MustCompile(`^\d{4}$`), "1050"},
+	"SE": {regexp.MustCompile(`^\d{3} ?\d{2}$`), "111 22"},
+	"NO": {regexp.MustCompile(`^\d{4}$`), "0150"},
+	"FI": {regexp.MustCompile(`^\d{5}$`), "00100"},
+	"PL": {regexp.MustCompile(`^\d{2}-\d{3}$`), "00-001"},
+	"CZ": {regexp.MustCompile(`^\d{3} ?\d{2}$`), "110 00"},
+	"SK": {regexp.MustCompile(`^\d{3} ?\d{2}$`), "811 01"},
+	"HU": {regexp.MustCompile(`^\d{4}$`), "1051"},
+	"SI": {regexp.MustCompile(`^\d{4}$`), "1000"},
+	"HR": {regexp.MustCompile(`^\d{5}$`), "10000"},
+	"GR": {regexp.MustCompile(`^\d{3} ?\d{2}$`), "105 57"},
+	"GB": {regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}$`), "SW1A 1AA"},
+	"IE": {regexp.MustCompile(`^[A-Z]\d[\dW] ?[A-Z\d]{4}$`), "D02 X285"},
+	"US": {regexp.MustCompile(`^\d{5}(-\d{4})?$`), "10001"},
+	"CA": {regexp.MustCompile(`^[A-Z]\d[A-Z] ?\d[A-Z]\d$`), "K1A 0B1"},
+}
+
+// ValidateAddress checks contact against the postal rules of its country and
+// normalizes it in place: the country becomes an ISO 3166-1 alpha-2 code and
+// the postcode is trimmed and upper-cased. Problems are reported per field,
+// prefixed with prefix (e.g. "recipient.").
+func ValidateAddress(prefix string, contact *Contact) error {
+	problems := []AddressProblem{}
+	add := func(field, format string, args ...any) {
+		problems = append(problems, AddressProblem{Field: prefix + field, Message: fmt.Sprintf(format, args...)})
+	}
+	if strings.TrimSpace(contact.Name) == "" {
+		add("name", "is required")
+	}
+	if strings.TrimSpace(contact.Street) == "" && strings.TrimSpace(contact.POBox) == "" {
+		add("street", "a street or PO box is required")
+	}
+	if strings.TrimSpace(contact.City) == "" {
+		add("city", "is required")
+	}
+	country, ok := NormalizeCountry(contact.Country)
+	switch {
+	case strings.TrimSpace(contact.Country) == "":
+		add("country", "is required")
+	case !ok:
+		add("country", "%q is not an ISO 3166-1 country code or a known country name", contact.Country)
+	default:
+		contact.Country = country
+	}
+	contact.Zip = strings.ToUpper(strings.TrimSpace(contact.Zip))
+	if contact.Zip == "" {
+		if country != "IE" {
+			add("zip", "is required")
+		}
+	} else if rule, known := postcodeRules[country]; known && !rule.pattern.MatchString(contact.Zip) {
+		add("zip", "%q is not a valid postcode for %s (e.g. %s)", contact.Zip, country, rule.example)
+	}
+	if len(problems) > 0 {
+		return AddressError{Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,1040 @@
+package pingen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const UserAgent = "pingen-cli/0.1.0"
+
+type APIError struct {
+	Message   string
+	Status    int
+	RequestID string
+	Errors    []ErrorDetail
+}
+
+// UploadError is an APIError of the file upload: requesting the upload URL or
+// sending the PDF to it.
+type UploadError struct {
+	APIError
+}
+
+func (err UploadError) Unwrap() error { return err.APIError }
+
+// TokenError is an APIError of the token endpoint.
+type TokenError struct {
+	APIError
+}
+
+func (err TokenError) Unwrap() error { return err.APIError }
+
+// ErrorDetail is a single entry of a JSON:API errors array.
+type ErrorDetail struct {
+	Code    string `json:"code,omitempty"`
+	Title   string `json:"title,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+	Pointer string `json:"pointer,omitempty"`
+}
+
+// Error includes the first JSON:API error, so that run reports and queue
+// records show why a request was rejected.
+func (err APIError) Error() string {
+	message := err.Message
+	if len(err.Errors) > 0 {
+		message += ": " + err.Errors[0].String()
+		if len(err.Errors) > 1 {
+			message += fmt.Sprintf(" (and %d more)", len(err.Errors)-1)
+		}
+	}
+	if err.RequestID != "" {
+		return fmt.Sprintf("%s (HTTP %d, request_id=%s)", message, err.Status, err.RequestID)
+	}
+	return fmt.Sprintf("%s (HTTP %d)", message, err.Status)
+}
+
+// String renders the detail as "pointer: title: detail (code c)", leaving
+// out the parts the API did not send.
+func (d ErrorDetail) String() string {
+	parts := []string{}
+	for _, part := range []string{d.Pointer, d.Title, d.Detail} {
+		if part != "" && (len(parts) == 0 || parts[len(parts)-1] != part) {
+			parts = append(parts, part)
+		}
+	}
+	text := strings.Join(parts, ": ")
+	if d.Code != "" {
+		text += " (code " + d.Code + ")"
+	}
+	return strings.TrimSpace(text)
+}
+
+// Client calls the Pingen API. Every request method takes a context first;
+// cancelling it aborts the request in flight, including uploads, downloads
+// and the waits for the rate limit or before a retry.
+//
+// Methods named after a resource (GetLetter, ListBatches, ...) return typed
+// structs; their Raw variants return the decoded JSON and the response
+// headers.
+type Client struct {
+	APIBase      string
+	IdentityBase string
+	AccessToken  string
+	Timeout      time.Duration
+	// UploadLimit throttles file uploads when set; share one bucket between
+	// clients to cap their combined bandwidth.
+	UploadLimit *TokenBucket
+	// Transport carries all requests; see NewTransport. Nil uses a
+	// transport shared by all clients without one.
+	Transport http.RoundTripper
+	// Pacer holds API requests back when the rate limit is nearly used up;
+	// share one between clients to pace them together.
+	Pacer *RatePacer
+	// Headers are added to every API and identity request (--header), but
+	// not to file transfers with presigned URLs.
+	Headers map[string]string
+	// OnRequest is called after every HTTP exchange, e.g. for logging.
+	OnRequest func(RequestInfo)
+	// OnTrace is called after every HTTP exchange with its headers and
+	// bodies, for debugging; see Trace. It buffers JSON and text responses.
+	OnTrace func(Trace)
+	// Retries is how often a request is repeated after a 429, a 5xx response
+	// or a network error (see shouldRetry); 0 disables retries.
+	Retries int
+	// RetryMaxWait caps the wait before a retry, including the wait asked
+	// for with Retry-After; 0 means no cap.
+	RetryMaxWait time.Duration
+	// OnRetry is called before waiting for a retry, e.g. for logging.
+	OnRetry func(RetryInfo)
+	// OnUploadProgress is called while UploadFile sends, with the bytes sent
+	// and the file size. A retried upload starts again from 0.
+	OnUploadProgress func(sent, total int64)
+	// OnProgress is called while DownloadFile writes, with the bytes on disk
+	// and the full size, or -1 when the server does not send it.
+	OnProgress func(done, total int64)
+	// DryRun, when set, receives every request instead of it being sent,
+	// and the request fails with ErrDryRun. Use it to preview what a call
+	// would do; no access token is needed.
+	DryRun func(RequestPreview)
+}
+
+// RequestInfo describes a finished HTTP exchange. URL has no query string, so
+// presigned URLs do not leak their signatures.
+type RequestInfo struct {
+	Method    string
+	URL       string
+	Status    int
+	RequestID string
+	// RateLimit is the budget reported by the response, if any.
+	RateLimit RateLimit
+	Duration  time.Duration
+	Err       error
+}
+
+// send performs req with client and reports it to OnRequest.
+func (c Client) send(client *http.Client, req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := client.Do(req)
+	if c.OnTrace != nil {
+		c.trace(req, resp, err, time.Since(start))
+	}
+	if c.Pacer != nil && resp != nil {
+		c.Pacer.observe(ParseRateLimit(resp.Header))
+	}
+	if c.OnRequest != nil {
+		info := RequestInfo{Method: req.Method, URL: req.URL.Scheme + "://" + req.URL.Host + req.URL.Path, Duration: time.Since(start), Err: err}
+		if resp != nil {
+			info.Status = resp.StatusCode
+			info.RequestID = resp.Header.Get("X-Request-Id")
+			info.RateLimit = ParseRateLimit(resp.Header)
+		}
+		c.OnRequest(info)
+	}
+	return resp, err
+}
+
+func (c Client) GetTokenRaw(ctx context.Context, clientID, clientSecret, scope string) (map[string]any, http.Header, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", clientID)
+	form.Set("client_secret", clientSecret)
+	if scope != "" {
+		form.Set("scope", scope)
+	}
+	return c.requestToken(ctx, form, "token request failed")
+}
+
+// requestToken posts form to the token endpoint and decodes the response.
+func (c Client) requestToken(ctx context.Context, form url.Values, failMessage string) (map[string]any, http.Header, error) {
+	endpoint := c.IdentityBase + "/auth/access-tokens"
+	headers := map[string]string{
+		"Content-Type": "application/x-www-form-urlencoded",
+		"Accept":       "application/json",
+	}
+	status, respHeaders, body, err := c.doRequest(ctx, "POST", endpoint, headers, bytes.NewBufferString(form.Encode()))
+	if err != nil {
+		return nil, respHeaders, err
+	}
+	if status != http.StatusOK {
+		return nil, respHeaders, TokenError{newAPIError(failMessage, status, respHeaders, body)}
+	}
+	payload, err := decodeJSON(body)
+	return payload, respHeaders, err
+}
+
+func (c Client) ListOrganisationsRaw(ctx context.Context, params map[string]string) (map[string]any, http.Header, error) {
+	endpoint := c.APIBase + "/organisations"
+	endpoint = addQuery(endpoint, params)
+	status, headers, body, err := c.doJSON(ctx, "GET", endpoint, nil, "application/vnd.api+json")
+	if err != nil {
+		return nil, headers, err
+	}
+	if status != http.StatusOK {
+		return nil, headers, newAPIError("list organisations failed", status, headers, body)
+	}
+	payload, err := decodeJSON(body)
+	return payload, headers, err
+}
+
+// GetUserRaw returns the user the access token was issued for. It needs the
+// "user" scope.
+func (c Client) GetUserRaw(ctx context.Context) (map[string]any, http.Header, error) {
+	endpoint := c.APIBase + "/user"
+	status, headers, body, err := c.doJSON(ctx, "GET", endpoint, nil, "application/vnd.api+json")
+	if err != nil {
+		return nil, headers, err
+	}
+	if status != http.StatusOK {
+		return nil, headers, newAPIError("get user failed", status, headers, body)
+	}
+	payload, err := decodeJSON(body)
+	return payload, headers, err
+}
+
+// ListUserAssociationsRaw lists the organisations the user belongs to, with
+// the role and status of each membership. It needs the "user" scope.
+func (c Client) ListUserAssociationsRaw(ctx context.Context, params map[string]string) (map[string]any, http.Header, error) {
+	endpoint := c.APIBase + "/user/associations"
+	endpoint = addQuery(endpoint, params)
+	status, headers, body, err := c.doJSON(ctx, "GET", endpoint, nil, "application/vnd.api+json")
+	if err != nil {
+		return nil, headers, err
+	}
+	if status != http.StatusOK {
+		return nil, headers, newAPIError("list associations failed", status, headers, body)
+	}
+	payload, err := decodeJSON(body)
+	return payload, headers, err
+}
+
+// ListOrganisationAssociationsRaw lists the members of an organisation: one
+// association per user, with its role and status. Add include=user to get
+// the users' names and email addresses.
+func (c Client) ListOrganisationAssociationsRaw(ctx context.Context, orgID string, params map[string]string) (map[string]any, http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/management/associations"
+	endpoint = addQuery(endpoint, params)
+	status, headers, body, err := c.doJSON(ctx, "GET", endpoint, nil, "application/vnd.api+json")
+	if err != nil {
+		return nil, headers, err
+	}
+	if status != http.StatusOK {
+		return nil, headers, newAPIError("list organisation members failed", status, headers, body)
+	}
+	payload, err := decodeJSON(body)
+	return payload, headers, err
+}
+
+// CreateOrganisationAssociationRaw invites a user by email address to join
+// an organisation with a role (owner or manager). The association stays
+// pending until the user accepts.
+func (c Client) CreateOrganisationAssociationRaw(ctx context.Context, orgID string, payload map[string]any) (map[string]any, http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/management/associations"
+	status, headers, body, err := c.doJSON(ctx, "POST", endpoint, payload, "application/vnd.api+json")
+	if err != nil {
+		return nil, headers, err
+	}
+	if status != http.StatusCreated && status != http.StatusOK {
+		return nil, headers, newAPIError("invite member failed", status, headers, body)
+	}
+	payloadMap, err := decodeJSON(body)
+	return payloadMap, headers, err
+}
+
+// UpdateOrganisationAssociationRaw changes the role of a member.
+func (c Client) UpdateOrganisationAssociationRaw(ctx context.Context, orgID, associationID string, payload map[string]any) (map[string]any, http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/management/associations/" + associationID
+	status, headers, body, err := c.doJSON(ctx, "PATCH", endpoint, payload, "application/vnd.api+json")
+	if err != nil {
+		return nil, headers, err
+	}
+	if status != http.StatusOK {
+		return nil, headers, newAPIError("update member failed", status, headers, body)
+	}
+	payloadMap, err := decodeJSON(body)
+	return payloadMap, headers, err
+}
+
+// BlockOrganisationAssociation revokes a member's access to the
+// organisation; UnblockOrganisationAssociation restores it.
+func (c Client) BlockOrganisationAssociation(ctx context.Context, orgID, associationID string) (http.Header, error) {
+	return c.patchAssociation(ctx, orgID, associationID, "block", "block member failed")
+}
+
+func (c Client) UnblockOrganisationAssociation(ctx context.Context, orgID, associationID string) (http.Header, error) {
+	return c.patchAssociation(ctx, orgID, associationID, "unblock", "unblock member failed")
+}
+
+// ResendInvitation sends the invitation of a pending member again.
+func (c Client) ResendInvitation(ctx context.Context, orgID, associationID string) (http.Header, error) {
+	return c.patchAssociation(ctx, orgID, associationID, "invitation", "resend invitation failed")
+}
+
+func (c Client) patchAssociation(ctx context.Context, orgID, associationID, action, failMessage string) (http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/management/associations/" + associationID + "/" + action
+	payload := map[string]any{"data": map[string]any{"id": associationID, "type": "associations"}}
+	status, headers, body, err := c.doJSON(ctx, "PATCH", endpoint, payload, "application/vnd.api+json")
+	if err != nil {
+		return headers, err
+	}
+	if status != http.StatusAccepted && status != http.StatusOK && status != http.StatusNoContent {
+		return headers, newAPIError(failMessage, status, headers, body)
+	}
+	return headers, nil
+}
+
+func (c Client) GetOrganisationRaw(ctx context.Context, orgID string) (map[string]any, http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID
+	status, headers, body, err := c.doJSON(ctx, "GET", endpoint, nil, "application/vnd.api+json")
+	if err != nil {
+		return nil, headers, err
+	}
+	if status != http.StatusOK {
+		return nil, headers, newAPIError("get organisation failed", status, headers, body)
+	}
+	payload, err := decodeJSON(body)
+	return payload, headers, err
+}
+
+// UpdateOrganisationRaw changes organisation settings such as the default
+// country or the data retention periods.
+func (c Client) UpdateOrganisationRaw(ctx context.Context, orgID string, payload map[string]any) (map[string]any, http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID
+	status, headers, body, err := c.doJSON(ctx, "PATCH", endpoint, payload, "application/vnd.api+json")
+	if err != nil {
+		return nil, headers, err
+	}
+	if status != http.StatusOK {
+		return nil, headers, newAPIError("update organisation failed", status, headers, body)
+	}
+	result, err := decodeJSON(body)
+	return result, headers, err
+}
+
+func (c Client) ListLettersRaw(ctx context.Context, orgID string, params map[string]string) (map[string]any, http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/letters"
+	endpoint = addQuery(endpoint, params)
+	status, headers, body, err := c.doJSON(ctx, "GET", endpoint, nil, "application/vnd.api+json")
+	if err != nil {
+		return nil, headers, err
+	}
+	if status != http.StatusOK {
+		return nil, headers, newAPIError("list letters failed", status, headers, body)
+	}
+	payload, err := decodeJSON(body)
+	return payload, headers, err
+}
+
+func (c Client) GetLetterRaw(ctx context.Context, orgID, letterID string) (map[string]any, http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/letters/" + letterID
+	status, headers, body, err := c.doJSON(ctx, "GET", endpoint, nil, "application/vnd.api+json")
+	if err != nil {
+		return nil, headers, err
+	}
+	if status != http.StatusOK {
+		return nil, headers, newAPIError("get letter failed", status, headers, body)
+	}
+	payload, err := decodeJSON(body)
+	return payload, headers, err
+}
+
+// ListLetterEventsRaw lists organisation-wide letter events of one category
+// (issues, undeliverable, sent or delivered).
+func (c Client) ListLetterEventsRaw(ctx context.Context, orgID, category string, params map[string]string) (map[string]any, http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/letters/events/" + category
+	endpoint = addQuery(endpoint, params)
+	status, headers, body, err := c.doJSON(ctx, "GET", endpoint, nil, "application/vnd.api+json")
+	if err != nil {
+		return nil, headers, err
+	}
+	if status != http.StatusOK {
+		return nil, headers, newAPIError("list letter events failed", status, headers, body)
+	}
+	payload, err := decodeJSON(body)
+	return payload, headers, err
+}
+
+func (c Client) ListBatchesRaw(ctx context.Context, orgID string, params map[string]string) (map[string]any, http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/batches"
+	endpoint = addQuery(endpoint, params)
+	status, headers, body, err := c.doJSON(ctx, "GET", endpoint, nil, "application/vnd.api+json")
+	if err != nil {
+		return nil, headers, err
+	}
+	if status != http.StatusOK {
+		return nil, headers, newAPIError("list batches failed", status, headers, body)
+	}
+	payload, err := decodeJSON(body)
+	return payload, headers, err
+}
+
+func (c Client) GetBatchRaw(ctx context.Context, orgID, batchID string) (map[string]any, http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/batches/" + batchID
+	status, headers, body, err := c.doJSON(ctx, "GET", endpoint, nil, "application/vnd.api+json")
+	if err != nil {
+		return nil, headers, err
+	}
+	if status != http.StatusOK {
+		return nil, headers, newAPIError("get batch failed", status, headers, body)
+	}
+	payload, err := decodeJSON(body)
+	return payload, headers, err
+}
+
+// CreateBatchRaw creates a batch from an uploaded PDF or ZIP file, which Pingen
+// splits into letters as set by the grouping options.
+func (c Client) CreateBatchRaw(ctx context.Context, orgID string, payload map[string]any, idempotencyKey string) (map[string]any, http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/batches"
+	status, headers, body, err := c.doJSON(ctx, "POST", endpoint, payload, "application/vnd.api+json", idempotencyKey)
+	if err != nil {
+		return nil, headers, err
+	}
+	if status != http.StatusOK && status != http.StatusCreated {
+		return nil, headers, newAPIError("create batch failed", status, headers, body)
+	}
+	payloadMap, err := decodeJSON(body)
+	return payloadMap, headers, err
+}
+
+func (c Client) SendBatchRaw(ctx context.Context, orgID, batchID string, payload map[string]any, idempotencyKey string) (map[string]any, http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/batches/" + batchID + "/send"
+	status, headers, body, err := c.doJSON(ctx, "PATCH", endpoint, payload, "application/vnd.api+json", idempotencyKey)
+	if err != nil {
+		return nil, headers, err
+	}
+	if status != http.StatusOK && status != http.StatusNoContent {
+		return nil, headers, newAPIError("send batch failed", status, headers, body)
+	}
+	if len(body) == 0 {
+		return map[string]any{}, headers, nil
+	}
+	payloadMap, err := decodeJSON(body)
+	return payloadMap, headers, err
+}
+
+// AddBatchAttachment appends an uploaded PDF (see GetFileUpload) to every
+// letter of a batch that has not been submitted.
+func (c Client) AddBatchAttachment(ctx context.Context, orgID, batchID, fileURL, signature string) (http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/batches/" + batchID + "/attachment"
+	payload := map[string]any{"data": map[string]any{
+		"id":         batchID,
+		"type":       "batches",
+		"attributes": map[string]any{"file_url": fileURL, "file_url_signature": signature},
+	}}
+	status, headers, body, err := c.doJSON(ctx, "PATCH", endpoint, payload, "application/vnd.api+json")
+	if err != nil {
+		return headers, err
+	}
+	if status != http.StatusAccepted && status != http.StatusOK && status != http.StatusNoContent {
+		return headers, newAPIError("add batch attachment failed", status, headers, body)
+	}
+	return headers, nil
+}
+
+// CancelBatch cancels every letter of a batch that has not been printed yet.
+// Like CancelLetter it is accepted asynchronously.
+func (c Client) CancelBatch(ctx context.Context, orgID, batchID string) (http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/batches/" + batchID + "/cancel"
+	status, headers, body, err := c.doJSON(ctx, "PATCH", endpoint, nil, "application/vnd.api+json")
+	if err != nil {
+		return headers, err
+	}
+	if status != http.StatusAccepted && status != http.StatusOK && status != http.StatusNoContent {
+		return headers, newAPIError("cancel batch failed", status, headers, body)
+	}
+	return headers, nil
+}
+
+func (c Client) ListWebhooksRaw(ctx context.Context, orgID string, params map[string]string) (map[string]any, http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/webhooks"
+	endpoint = addQuery(endpoint, params)
+	status, headers, body, err := c.doJSON(ctx, "GET", endpoint, nil, "application/vnd.api+json")
+	if err != nil {
+		return nil, headers, err
+	}
+	if status != http.StatusOK {
+		return nil, headers, newAPIError("list webhooks failed", status, headers, body)
+	}
+	payload, err := decodeJSON(body)
+	return payload, headers, err
+}
+
+func (c Client) GetWebhookRaw(ctx context.Context, orgID, webhookID string) (map[string]any, http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/webhooks/" + webhookID
+	status, headers, body, err := c.doJSON(ctx, "GET", endpoint, nil, "application/vnd.api+json")
+	if err != nil {
+		return nil, headers, err
+	}
+	if status != http.StatusOK {
+		return nil, headers, newAPIError("get webhook failed", status, headers, body)
+	}
+	payload, err := decodeJSON(body)
+	return payload, headers, err
+}
+
+// CreateWebhookRaw subscribes a URL to the events of one category. Pingen
+// signs every request to it with the signing key of the payload.
+func (c Client) CreateWebhookRaw(ctx context.Context, orgID string, payload map[string]any) (map[string]any, http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/webhooks"
+	status, headers, body, err := c.doJSON(ctx, "POST", endpoint, payload, "application/vnd.api+json")
+	if err != nil {
+		return nil, headers, err
+	}
+	if status != http.StatusCreated && status != http.StatusOK {
+		return nil, headers, newAPIError("create webhook failed", status, headers, body)
+	}
+	payloadMap, err := decodeJSON(body)
+	return payloadMap, headers, err
+}
+
+func (c Client) ListBatchEventsRaw(ctx context.Context, orgID, batchID string, params map[string]string) (map[string]any, http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/batches/" + batchID + "/events"
+	endpoint = addQuery(endpoint, params)
+	status, headers, body, err := c.doJSON(ctx, "GET", endpoint, nil, "application/vnd.api+json")
+	if err != nil {
+		return nil, headers, err
+	}
+	if status != http.StatusOK {
+		return nil, headers, newAPIError("list batch events failed", status, headers, body)
+	}
+	payload, err := decodeJSON(body)
+	return payload, headers, err
+}
+
+func (c Client) GetFileUpload(ctx context.Context) (string, string, http.Header, error) {
+	endpoint := c.APIBase + "/file-upload"
+	status, headers, body, err := c.doJSON(ctx, "GET", endpoint, nil, "application/vnd.api+json")
+	if errors.Is(err, ErrDryRun) {
+		return DryRunUploadURL, DryRunUploadSignature, headers, nil
+	}
+	if err != nil {
+		return "", "", headers, err
+	}
+	if status != http.StatusOK {
+		return "", "", headers, UploadError{newAPIError("file upload request failed", status, headers, body)}
+	}
+	payload, err := decodeJSON(body)
+	if err != nil {
+		return "", "", headers, err
+	}
+	data, ok := payload["data"].(map[string]any)
+	if !ok {
+		return "", "", headers, UploadError{APIError{Message: "file upload response missing data", Status: status}}
+	}
+	attrs, ok := data["attributes"].(map[string]any)
+	if !ok {
+		return "", "", headers, UploadError{APIError{Message: "file upload response missing attributes", Status: status}}
+	}
+	urlValue, _ := attrs["url"].(string)
+	sigValue, _ := attrs["url_signature"].(string)
+	if urlValue == "" || sigValue == "" {
+		return "", "", headers, UploadError{APIError{Message: "file upload response missing url data", Status: status}}
+	}
+	return urlValue, sigValue, headers, nil
+}
+
+// UploadFile PUTs the file at filePath to a presigned upload URL. The
+// presigned target takes the file in one request and cannot continue a
+// partial upload, so an upload interrupted by a network error or a 5xx
+// response is sent again from the start, as allowed by Retries. timeout
+// bounds each attempt.
+func (c Client) UploadFile(ctx context.Context, uploadURL, filePath string, timeout time.Duration) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return FileError{err: err}
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return FileError{err: err}
+	}
+	if c.DryRun != nil {
+		preview := c.preview("PUT", uploadURL, nil, false, nil)
+		preview.File = filePath
+		c.DryRun(preview)
+		return nil
+	}
+
+	resp, err := c.do(c.httpClient(timeout), func() (*http.Request, error) {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		var body io.Reader = file
+		if c.UploadLimit != nil {
+			body = &throttledReader{reader: body, bucket: c.UploadLimit, ctx: ctx}
+		}
+		if c.OnUploadProgress != nil {
+			body = &progressReader{reader: body, total: info.Size(), report: c.OnUploadProgress}
+		}
+		// The transport closes request bodies; a retry still needs the file.
+		req, err := http.NewRequestWithContext(ctx, "PUT", uploadURL, io.NopCloser(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", UserAgent)
+		req.ContentLength = info.Size()
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Drain the body so that the connection can be reused.
+	defer io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		return UploadError{APIError{Message: "file upload failed", Status: resp.StatusCode}}
+	}
+	return nil
+}
+
+func (c Client) CreateLetterRaw(ctx context.Context, orgID string, payload map[string]any, idempotencyKey string) (map[string]any, http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/letters"
+	status, headers, body, err := c.doJSON(ctx, "POST", endpoint, payload, "application/vnd.api+json", idempotencyKey)
+	if err != nil {
+		return nil, headers, err
+	}
+	if status != http.StatusOK && status != http.StatusCreated {
+		return nil, headers, newAPIError("create letter failed", status, headers, body)
+	}
+	payloadMap, err := decodeJSON(body)
+	return payloadMap, headers, err
+}
+
+func (c Client) SendLetterRaw(ctx context.Context, orgID, letterID string, payload map[string]any, idempotencyKey string) (map[string]any, http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/letters/" + letterID + "/send"
+	status, headers, body, err := c.doJSON(ctx, "PATCH", endpoint, payload, "application/vnd.api+json", idempotencyKey)
+	if err != nil {
+		return nil, headers, err
+	}
+	if status != http.StatusOK && status != http.StatusNoContent {
+		return nil, headers, newAPIError("send letter failed", status, headers, body)
+	}
+	if len(body) == 0 {
+		return map[string]any{}, headers, nil
+	}
+	payloadMap, err := decodeJSON(body)
+	return payloadMap, headers, err
+}
+
+// DeleteLetter deletes a letter. Pingen only allows this while the letter
+// has not been submitted for printing.
+func (c Client) DeleteLetter(ctx context.Context, orgID, letterID string) (http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/letters/" + letterID
+	status, headers, body, err := c.doJSON(ctx, "DELETE", endpoint, nil, "application/vnd.api+json")
+	if err != nil {
+		return headers, err
+	}
+	if status != http.StatusNoContent && status != http.StatusOK {
+		return headers, newAPIError("delete letter failed", status, headers, body)
+	}
+	return headers, nil
+}
+
+// CancelLetter asks Pingen to pull a submitted letter from printing. The
+// request is accepted asynchronously; the letter shows the outcome in its
+// status.
+func (c Client) CancelLetter(ctx context.Context, orgID, letterID string) (http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/letters/" + letterID + "/cancel"
+	status, headers, body, err := c.doJSON(ctx, "PATCH", endpoint, nil, "application/vnd.api+json")
+	if err != nil {
+		return headers, err
+	}
+	if status != http.StatusAccepted && status != http.StatusOK && status != http.StatusNoContent {
+		return headers, newAPIError("cancel letter failed", status, headers, body)
+	}
+	return headers, nil
+}
+
+// UpdateLetterRaw changes attributes of a letter that has not been submitted,
+// such as its paper types, address position or meta data.
+func (c Client) UpdateLetterRaw(ctx context.Context, orgID, letterID string, payload map[string]any) (map[string]any, http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/letters/" + letterID
+	status, headers, body, err := c.doJSON(ctx, "PATCH", endpoint, payload, "application/vnd.api+json")
+	if err != nil {
+		return nil, headers, err
+	}
+	if status != http.StatusOK {
+		return nil, headers, newAPIError("update letter failed", status, headers, body)
+	}
+	payloadMap, err := decodeJSON(body)
+	return payloadMap, headers, err
+}
+
+// RestoreLetterFile puts back the PDF of a letter as it was uploaded,
+// undoing changes made to resolve validation problems, and has Pingen
+// validate it again.
+func (c Client) RestoreLetterFile(ctx context.Context, orgID, letterID string) (http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/letters/" + letterID + "/file/restore"
+	status, headers, body, err := c.doJSON(ctx, "PATCH", endpoint, nil, "application/vnd.api+json")
+	if err != nil {
+		return headers, err
+	}
+	if status != http.StatusAccepted && status != http.StatusOK && status != http.StatusNoContent {
+		return headers, newAPIError("restore letter failed", status, headers, body)
+	}
+	return headers, nil
+}
+
+// CalculatePriceRaw asks the price calculator what a letter with the given
+// country, paper types (one per page), print options and delivery product costs.
+func (c Client) CalculatePriceRaw(ctx context.Context, orgID string, payload map[string]any) (map[string]any, http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/letters/price-calculator"
+	status, headers, body, err := c.doJSON(ctx, "POST", endpoint, payload, "application/vnd.api+json")
+	if err != nil {
+		return nil, headers, err
+	}
+	if status != http.StatusOK {
+		return nil, headers, newAPIError("price calculation failed", status, headers, body)
+	}
+	payloadMap, err := decodeJSON(body)
+	return payloadMap, headers, err
+}
+
+// ListDeliveryProductsRaw lists the delivery products the organisation can send
+// with, each with its destination countries, delivery time and starting price.
+func (c Client) ListDeliveryProductsRaw(ctx context.Context, orgID string, params map[string]string) (map[string]any, http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/distribution/delivery-products"
+	endpoint = addQuery(endpoint, params)
+	status, headers, body, err := c.doJSON(ctx, "GET", endpoint, nil, "application/vnd.api+json")
+	if err != nil {
+		return nil, headers, err
+	}
+	if status != http.StatusOK {
+		return nil, headers, newAPIError("list delivery products failed", status, headers, body)
+	}
+	payload, err := decodeJSON(body)
+	return payload, headers, err
+}
+
+// GetLetterFileURL returns the short-lived download URL of a letter's PDF.
+func (c Client) GetLetterFileURL(ctx context.Context, orgID, letterID string) (string, http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/letters/" + letterID + "/file"
+	return c.redirectLocation(ctx, endpoint, "letter file request failed")
+}
+
+// ListLetterEventsOfRaw lists the events of a single letter.
+func (c Client) ListLetterEventsOfRaw(ctx context.Context, orgID, letterID string, params map[string]string) (map[string]any, http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/letters/" + letterID + "/events"
+	endpoint = addQuery(endpoint, params)
+	status, headers, body, err := c.doJSON(ctx, "GET", endpoint, nil, "application/vnd.api+json")
+	if err != nil {
+		return nil, headers, err
+	}
+	if status != http.StatusOK {
+		return nil, headers, newAPIError("list letter events failed", status, headers, body)
+	}
+	payload, err := decodeJSON(body)
+	return payload, headers, err
+}
+
+// GetLetterEventImageURL returns the download URL of the image attached to a
+// letter event (has_image), e.g. a registered-mail receipt.
+func (c Client) GetLetterEventImageURL(ctx context.Context, orgID, letterID, eventID string) (string, http.Header, error) {
+	endpoint := c.APIBase + "/organisations/" + orgID + "/letters/" + letterID + "/events/" + eventID + "/image"
+	return c.redirectLocation(ctx, endpoint, "letter event image request failed")
+}
+
+// redirectLocation requests endpoint and returns the Location of the
+// redirect the API answers with. The redirect is not followed so that the
+// bearer token is never sent to the storage host.
+func (c Client) redirectLocation(ctx context.Context, endpoint, failMessage string) (string, http.Header, error) {
+	client := c.httpClient(c.Timeout)
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := c.do(client, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", UserAgent)
+		c.setCustomHeaders(req)
+		req.Header.Set("Authorization", "Bearer "+c.AccessToken)
+		return req, nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusFound && resp.StatusCode != http.StatusSeeOther && resp.StatusCode != http.StatusTemporaryRedirect {
+		return "", resp.Header, newAPIError(failMessage, resp.StatusCode, resp.Header, body)
+	}
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return "", resp.Header, APIError{Message: failMessage + ": response missing location", Status: resp.StatusCode}
+	}
+	return location, resp.Header, nil
+}
+
+// DownloadFile stores fileURL at filePath. Data is written to filePath+".part"
+// first; an existing partial file is resumed with a Range request when the
+// server supports it. It returns the number of bytes of the complete file.
+func (c Client) DownloadFile(ctx context.Context, fileURL, filePath string) (int64, error) {
+	partPath := filePath + ".part"
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+	client := c.httpClient(c.Timeout)
+	resp, err := c.do(client, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", fileURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", UserAgent)
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		}
+		return req, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		flags |= os.O_TRUNC
+		offset = 0
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file is already complete.
+		if err := os.Rename(partPath, filePath); err != nil {
+			return 0, err
+		}
+		return offset, nil
+	default:
+		return 0, APIError{Message: "letter download failed", Status: resp.StatusCode}
+	}
+	file, err := os.OpenFile(partPath, flags, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	var body io.Reader = resp.Body
+	if c.OnProgress != nil {
+		total := int64(-1)
+		if resp.ContentLength >= 0 {
+			total = offset + resp.ContentLength
+		}
+		body = &progressReader{reader: resp.Body, done: offset, total: total, report: c.OnProgress}
+	}
+	written, err := io.Copy(file, body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Rename(partPath, filePath); err != nil {
+		return 0, err
+	}
+	return offset + written, nil
+}
+
+// progressReader reports the bytes read so far after every read.
+type progressReader struct {
+	reader      io.Reader
+	done, total int64
+	report      func(done, total int64)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.done += int64(n)
+	r.report(r.done, r.total)
+	return n, err
+}
+
+func (c Client) doJSON(ctx context.Context, method, endpoint string, payload map[string]any, contentType string, extraHeaders ...string) (int, http.Header, []byte, error) {
+	var body io.Reader
+	if payload != nil {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		body = bytes.NewBuffer(encoded)
+	}
+
+	headers := map[string]string{
+		"Accept":       contentType,
+		"Content-Type": contentType,
+	}
+	if c.AccessToken != "" {
+		headers["Authorization"] = "Bearer " + c.AccessToken
+	}
+	if len(extraHeaders) > 0 && extraHeaders[0] != "" {
+		headers["Idempotency-Key"] = extraHeaders[0]
+	}
+
+	return c.doRequest(ctx, method, endpoint, headers, body)
+}
+
+func (c Client) doRequest(ctx context.Context, method, endpoint string, headers map[string]string, body io.Reader) (int, http.Header, []byte, error) {
+	// The body is kept in memory so that a retry can send it again.
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = io.ReadAll(body); err != nil {
+			return 0, nil, nil, err
+		}
+	}
+	if c.DryRun != nil {
+		c.DryRun(c.preview(method, endpoint, headers, true, payload))
+		return 0, nil, nil, ErrDryRun
+	}
+	client := c.httpClient(c.Timeout)
+	resp, err := c.do(client, func() (*http.Request, error) {
+		if c.Pacer != nil {
+			if err := c.Pacer.wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+		var reader io.Reader
+		if payload != nil {
+			reader = bytes.NewReader(payload)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", UserAgent)
+		c.setCustomHeaders(req)
+		for key, value := range headers {
+			if value == "" {
+				continue
+			}
+			req.Header.Set(key, value)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, resp.Header, nil, err
+	}
+	return resp.StatusCode, resp.Header, responseBody, nil
+}
+
+// setCustomHeaders applies Headers; they may replace the User-Agent but are
+// applied before the per-request headers.
+func (c Client) setCustomHeaders(req *http.Request) {
+	for name, value := range c.Headers {
+		req.Header.Set(name, value)
+	}
+}
+
+// newAPIError builds an APIError and decodes any JSON:API errors in body.
+func newAPIError(message string, status int, headers http.Header, body []byte) APIError {
+	apiErr := APIError{Message: message, Status: status}
+	if headers != nil {
+		apiErr.RequestID = headers.Get("X-Request-Id")
+	}
+	apiErr.Errors = decodeErrors(body)
+	return apiErr
+}
+
+func decodeErrors(body []byte) []ErrorDetail {
+	var payload struct {
+		Errors []struct {
+			Code   any    `json:"code"`
+			Title  string `json:"title"`
+			Detail string `json:"detail"`
+			Source struct {
+				Pointer   string `json:"pointer"`
+				Parameter string `json:"parameter"`
+			} `json:"source"`
+		} `json:"errors"`
+	}
+	if len(body) == 0 || json.Unmarshal(body, &payload) != nil {
+		return nil
+	}
+	details := make([]ErrorDetail, 0, len(payload.Errors))
+	for _, entry := range payload.Errors {
+		detail := ErrorDetail{Title: entry.Title, Detail: entry.Detail, Pointer: entry.Source.Pointer}
+		if detail.Pointer == "" {
+			detail.Pointer = entry.Source.Parameter
+		}
+		if entry.Code != nil {
+			detail.Code = fmt.Sprint(entry.Code)
+		}
+		details = append(details, detail)
+	}
+	return details
+}
+
+func decodeJSON(body []byte) (map[string]any, error) {
+	if len(body) == 0 {
+		return map[string]any{}, nil
+	}
+	// UseNumber keeps large integers and prices exact instead of rounding
+	// them through float64.
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var payload map[string]any
+	if err := decoder.Decode(&payload); err != nil {
+		return map[string]any{}, err
+	}
+	return payload, nil
+}
+
+func addQuery(endpoint string, params map[string]string) string {
+	if len(params) == 0 {
+		return endpoint
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	values := parsed.Query()
+	for key, value := range params {
+		if value == "" {
+			continue
+		}
+		values.Set(key, value)
+	}
+	parsed.RawQuery = values.Encode()
+	return parsed.String()
+}
+
+func DefaultFileName(path string) string {
+	base := filepath.Base(path)
+	if base == "." || base == string(filepath.Separator) {
+		return "document.pdf"
+	}
+	return base
+}
@@ -0,0 +1,338 @@
+package pingen
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AddressPage is a cover page with the recipient placed in the envelope
+// window, for documents that have no address block of their own.
+type AddressPage struct {
+	// Position is the window the letter is folded for: left (DIN 5008
+	// form B) or right (Swiss SN 010130).
+	Position string
+	// Recipient holds the address lines, name first.
+	Recipient []string
+	// Sender is the return address, printed small above the recipient.
+	Sender string
+	// BlankBack adds an empty page after the cover, so that the document
+	// still starts on a new sheet when it is printed duplex.
+	BlankBack bool
+}
+
+// addressPageOrigins are the top-left corners of the recipient block, in
+// millimetres from the top-left corner of the page. Both lie inside the
+// windows Pingen reads the address from.
+var addressPageOrigins = map[string][2]float64{
+	"left":  {25, 62},
+	"right": {118, 62},
+}
+
+const (
+	a4Width, a4Height = 595.276, 841.89
+	pointsPerMM       = 72 / 25.4
+)
+
+var (
+	pdfVersionHeader = regexp.MustCompile(`%PDF-(\d\.\d)`)
+	pdfTrailerRoot   = regexp.MustCompile(`/Root\s+(\d+)\s+\d+\s+R`)
+	pdfTrailerInfo   = regexp.MustCompile(`/Info\s+(\d+)\s+\d+\s+R`)
+)
+
+// PrependAddressPage returns the PDF at path with page in front of its first
+// page. The document is rewritten without object streams or cross-reference
+// streams; encrypted documents are not supported.
+func PrependAddressPage(path string, page AddressPage) ([]byte, error) {
+	origin, ok := addressPageOrigins[page.Position]
+	if !ok {
+		return nil, fmt.Errorf("address position must be left or right")
+	}
+	if len(page.Recipient) == 0 {
+		return nil, fmt.Errorf("the address page needs a recipient")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, FileError{err: err}
+	}
+	doc := loadPDF(data)
+	rootNumber := doc.catalogNumber(data)
+	if rootNumber < 0 {
+		return nil, pdfErrorf("could not read the pages of %s", path)
+	}
+	pagesRef, ok := doc.objects[rootNumber].value.(map[string]any)["Pages"].(pdfRef)
+	pagesTree := doc.dict(pagesRef)
+	if !ok || pagesTree == nil {
+		return nil, pdfErrorf("could not read the pages of %s", path)
+	}
+
+	next := 0
+	for number := range doc.objects {
+		if number >= next {
+			next = number + 1
+		}
+	}
+	fontRef, contentRef, coverRef := pdfRef(next), pdfRef(next+1), pdfRef(next+2)
+	added := []any{coverRef}
+	objects := map[int]pdfObject{
+		int(fontRef): {value: map[string]any{
+			"Type": pdfName("Font"), "Subtype": pdfName("Type1"),
+			"BaseFont": pdfName("Helvetica"), "Encoding": pdfName("WinAnsiEncoding"),
+		}},
+		int(contentRef): {value: map[string]any{}, stream: addressPageContent(page, origin)},
+		int(coverRef): {value: map[string]any{
+			"Type": pdfName("Page"), "Parent": pagesRef, "Rotate": float64(0),
+			"MediaBox":  []any{float64(0), float64(0), a4Width, a4Height},
+			"Resources": map[string]any{"Font": map[string]any{"F1": fontRef}},
+			"Contents":  contentRef,
+		}},
+	}
+	if page.BlankBack {
+		blankRef := pdfRef(next + 3)
+		objects[int(blankRef)] = pdfObject{value: map[string]any{
+			"Type": pdfName("Page"), "Parent": pagesRef, "Rotate": float64(0),
+			"MediaBox":  []any{float64(0), float64(0), a4Width, a4Height},
+			"Resources": map[string]any{},
+		}}
+		added = append(added, blankRef)
+	}
+	tree := map[string]any{}
+	for key, value := range pagesTree {
+		tree[key] = value
+	}
+	kids, _ := doc.resolve(pagesTree["Kids"]).([]any)
+	tree["Kids"] = append(added, kids...)
+	tree["Count"] = doc.number(pagesTree["Count"]) + float64(len(added))
+
+	for number, object := range doc.rewritableObjects() {
+		if _, replaced := objects[number]; !replaced {
+			objects[number] = object
+		}
+	}
+	objects[int(pagesRef)] = pdfObject{value: tree}
+	return writePDF(pdfVersion(data), objects, rewriteTrailer(data, rootNumber, objects)), nil
+}
+
+// rewritableObjects returns the objects written back when doc is rewritten.
+// Object streams and cross-reference streams are dropped, as their objects
+// are written directly, and so is the linearization dictionary, which no
+// longer matches.
+func (d *pdfDocument) rewritableObjects() map[int]pdfObject {
+	objects := map[int]pdfObject{}
+	for number, object := range d.objects {
+		if dict, ok := object.value.(map[string]any); ok {
+			if dict["Type"] == pdfName("ObjStm") || dict["Type"] == pdfName("XRef") || dict["Linearized"] != nil {
+				continue
+			}
+		}
+		objects[number] = object
+	}
+	return objects
+}
+
+// rewriteTrailer returns the trailer of a rewritten document: the catalog
+// and, when it is still there, the document information of the original.
+func rewriteTrailer(data []byte, root int, objects map[int]pdfObject) map[string]any {
+	trailer := map[string]any{"Root": pdfRef(root)}
+	if matches := pdfTrailerInfo.FindAllSubmatch(data, -1); len(matches) > 0 {
+		number, _ := strconv.Atoi(string(matches[len(matches)-1][1]))
+		if _, exists := objects[number]; exists {
+			trailer["Info"] = pdfRef(number)
+		}
+	}
+	return trailer
+}
+
+func pdfVersion(data []byte) string {
+	if match := pdfVersionHeader.FindSubmatch(data); match != nil {
+		return string(match[1])
+	}
+	return "1.4"
+}
+
+// catalogNumber returns the object number of the document catalog: the
+// /Root of the last trailer, or else the lowest numbered catalog.
+func (d *pdfDocument) catalogNumber(data []byte) int {
+	if matches := pdfTrailerRoot.FindAllSubmatch(data, -1); len(matches) > 0 {
+		number, _ := strconv.Atoi(string(matches[len(matches)-1][1]))
+		if dict, ok := d.objects[number].value.(map[string]any); ok && dict["Type"] == pdfName("Catalog") {
+			return number
+		}
+	}
+	lowest := -1
+	for number, object := range d.objects {
+		dict, ok := object.value.(map[string]any)
+		if ok && dict["Type"] == pdfName("Catalog") && (lowest < 0 || number < lowest) {
+			lowest = number
+		}
+	}
+	return lowest
+}
+
+// addressPageContent draws the return address in 7 pt and the recipient in
+// 10 pt Helvetica below it.
+func addressPageContent(page AddressPage, origin [2]float64) []byte {
+	var content bytes.Buffer
+	x := origin[0] * pointsPerMM
+	y := a4Height - origin[1]*pointsPerMM
+	if page.Sender != "" {
+		fmt.Fprintf(&content, "BT /F1 7 Tf %.2f %.2f Td %s Tj ET\n", x, y+6, pdfLiteral(page.Sender))
+	}
+	fmt.Fprintf(&content, "BT /F1 10 Tf 12 TL %.2f %.2f Td\n", x, y-12)
+	for i, line := range page.Recipient {
+		if i > 0 {
+			content.WriteString("T*\n")
+		}
+		fmt.Fprintf(&content, "%s Tj\n", pdfLiteral(line))
+	}
+	content.WriteString("ET\n")
+	return content.Bytes()
+}
+
+// pdfLiteral encodes text as a WinAnsi literal string.
+func pdfLiteral(text string) string {
+	return literalBytes(winAnsiBytes(text))
+}
+
+// winAnsiBytes encodes text in WinAnsi; characters outside it become "?".
+func winAnsiBytes(text string) []byte {
+	out := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			out = append(out, byte(r))
+		case r == '€':
+			out = append(out, 0x80)
+		default:
+			out = append(out, '?')
+		}
+	}
+	return out
+}
+
+// literalBytes writes raw string bytes as a literal string, escaping what a
+// reader would otherwise interpret.
+func literalBytes(raw []byte) string {
+	var out strings.Builder
+	out.WriteByte('(')
+	for _, c := range raw {
+		switch {
+		case c == '(' || c == ')' || c == '\\':
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		case c >= 0x20 && c < 0x7f:
+			out.WriteByte(c)
+		default:
+			fmt.Fprintf(&out, "\\%03o", c)
+		}
+	}
+	out.WriteByte(')')
+	return out.String()
+}
+
+// writePDF serializes objects with a classic cross-reference table. Stream
+// lengths are recomputed.
+func writePDF(version string, objects map[int]pdfObject, trailer map[string]any) []byte {
+	numbers := make([]int, 0, len(objects))
+	size := 1
+	for number := range objects {
+		numbers = append(numbers, number)
+		if number >= size {
+			size = number + 1
+		}
+	}
+	sort.Ints(numbers)
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "%%PDF-%s\n%%\xe2\xe3\xcf\xd3\n", version)
+	offsets := make([]int, size)
+	for _, number := range numbers {
+		object := objects[number]
+		offsets[number] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n", number)
+		value := object.value
+		if object.stream != nil {
+			dict := map[string]any{}
+			if original, ok := value.(map[string]any); ok {
+				for key, entry := range original {
+					dict[key] = entry
+				}
+			}
+			dict["Length"] = float64(len(object.stream))
+			value = dict
+		}
+		writePDFValue(&out, value)
+		if object.stream != nil {
+			out.WriteString("\nstream\n")
+			out.Write(object.stream)
+			out.WriteString("\nendstream")
+		}
+		out.WriteString("\nendobj\n")
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", size)
+	for number := 1; number < size; number++ {
+		if _, ok := objects[number]; ok {
+			fmt.Fprintf(&out, "%010d 00000 n \n", offsets[number])
+		} else {
+			out.WriteString("0000000000 65535 f \n")
+		}
+	}
+	trailer["Size"] = float64(size)
+	out.WriteString("trailer\n")
+	writePDFValue(&out, trailer)
+	fmt.Fprintf(&out, "\nstartxref\n%d\n%%%%EOF\n", xref)
+	return out.Bytes()
+}
+
+func writePDFValue(out *bytes.Buffer, value any) {
+	switch value := value.(type) {
+	case nil:
+		out.WriteString("null")
+	case bool:
+		out.WriteString(strconv.FormatBool(value))
+	case float64:
+		out.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	case pdfRef:
+		fmt.Fprintf(out, "%d 0 R", int(value))
+	case pdfName:
+		out.WriteByte('/')
+		for i := 0; i < len(value); i++ {
+			c := value[i]
+			if c < 0x21 || c > 0x7e || c == '#' || isPDFDelimiter(c) {
+				fmt.Fprintf(out, "#%02X", c)
+			} else {
+				out.WriteByte(c)
+			}
+		}
+	case pdfString:
+		fmt.Fprintf(out, "<%X>", []byte(value))
+	case pdfKeyword:
+		out.WriteString(string(value))
+	case []any:
+		out.WriteByte('[')
+		for i, item := range value {
+			if i > 0 {
+				out.WriteByte(' ')
+			}
+			writePDFValue(out, item)
+		}
+		out.WriteByte(']')
+	case map[string]any:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		out.WriteString("<<")
+		for _, key := range keys {
+			writePDFValue(out, pdfName(key))
+			out.WriteByte(' ')
+			writePDFValue(out, value[key])
+		}
+		out.WriteString(">>")
+	}
+}
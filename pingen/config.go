@@ -0,0 +1,304 @@
+package pingen
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+const ConfigEnvVar = "PINGEN_CONFIG_PATH"
+
+// Config stores persisted settings for the CLI.
+type Config struct {
+	Env                  string `json:"env"`
+	APIBase              string `json:"api_base"`
+	IdentityBase         string `json:"identity_base"`
+	OrganisationID       string `json:"organisation_id"`
+	AccessToken          string `json:"access_token"`
+	AccessTokenExpiresAt int64  `json:"access_token_expires_at"`
+	// AccessTokenScope is the scope the cached token was requested with;
+	// empty means the default scope.
+	AccessTokenScope string `json:"access_token_scope,omitempty"`
+	// RefreshToken is issued by `auth login` and renews the access token
+	// once it expires.
+	RefreshToken       string `json:"refresh_token,omitempty"`
+	ClientID           string `json:"client_id"`
+	ClientSecret       string `json:"client_secret"`
+	Timezone           string `json:"timezone,omitempty"`
+	MaxUploadSize      string `json:"max_upload_size,omitempty"`
+	MaxPages           int    `json:"max_pages,omitempty"`
+	ContactsFile       string `json:"contacts_file,omitempty"`
+	DisableUpdateCheck bool   `json:"disable_update_check,omitempty"`
+
+	// CredentialStore is "file" to keep secrets in this file; by default
+	// they go into the OS keychain when one is available.
+	CredentialStore string `json:"credential_store,omitempty"`
+	// KeychainSecrets names the secrets kept in the OS keychain, e.g.
+	// ["client_secret", "access_token"].
+	KeychainSecrets []string `json:"keychain_secrets,omitempty"`
+
+	// Headers are sent with every API request, e.g. headers["X-Trace"] = "1".
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Defaults holds per-command flag defaults, e.g.
+	// defaults["letters.create"]["address-position"] = "right".
+	Defaults map[string]map[string]string `json:"defaults,omitempty"`
+
+	FilterPresets   map[string]FilterPreset `json:"filter_presets,omitempty"`
+	OutputTemplates map[string]string       `json:"output_templates,omitempty"`
+
+	// LetterTemplates holds named `letters create` flag values, e.g.
+	// letter_templates["invoice"]["print-mode"] = "duplex".
+	LetterTemplates map[string]map[string]string `json:"letter_templates,omitempty"`
+
+	Schedules map[string]Schedule `json:"schedules,omitempty"`
+}
+
+// Schedule is a recurring command run by `schedule run`.
+type Schedule struct {
+	Cron           string   `json:"cron"`
+	Timezone       string   `json:"timezone,omitempty"`
+	Args           []string `json:"args"`
+	OrganisationID string   `json:"organisation_id,omitempty"`
+	Env            string   `json:"env,omitempty"`
+}
+
+// FilterPreset is a named, reusable list query.
+type FilterPreset struct {
+	Where  []string `json:"where,omitempty"`
+	Filter string   `json:"filter,omitempty"`
+	Sort   string   `json:"sort,omitempty"`
+	SortBy string   `json:"sort_by,omitempty"`
+}
+
+// ConfigPath returns the config file location: PINGEN_CONFIG_PATH, then
+// $XDG_CONFIG_HOME/pingen, then the platform default (%APPDATA%\pingen on
+// Windows, ~/Library/Application Support/pingen on macOS, ~/.config/pingen
+// elsewhere). A config left at the old ~/.config location on Windows or macOS
+// is moved to the platform default on first use.
+func ConfigPath() (string, error) {
+	if override := os.Getenv(ConfigEnvVar); override != "" {
+		return override, nil
+	}
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "pingen", "config.json"), nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "pingen", "config.json")
+	if home, err := os.UserHomeDir(); err == nil {
+		migrateLegacyConfig(filepath.Join(home, ".config", "pingen", "config.json"), path)
+	}
+	return path, nil
+}
+
+// migrateLegacyConfig moves a config from legacy to path if only the legacy
+// file exists. Failures leave the legacy file in place.
+func migrateLegacyConfig(legacy, path string) {
+	if legacy == path {
+		return
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	data, err := os.ReadFile(legacy)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return
+	}
+	_ = os.Remove(legacy)
+}
+
+// CacheDir returns the directory for disposable local data such as completion
+// results: $XDG_CACHE_HOME/pingen, else %LOCALAPPDATA%\pingen on Windows,
+// ~/Library/Caches/pingen on macOS and ~/.cache/pingen elsewhere.
+func CacheDir() (string, error) {
+	if xdg := os.Getenv("XDG_CACHE_HOME"); xdg != "" {
+		return filepath.Join(xdg, "pingen"), nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "pingen"), nil
+}
+
+// StateDir returns the directory for records the CLI keeps between runs, such
+// as job journals and audit logs: $XDG_STATE_HOME/pingen, else
+// %LOCALAPPDATA%\pingen\state on Windows, ~/Library/Application
+// Support/pingen/state on macOS and ~/.local/state/pingen elsewhere.
+func StateDir() (string, error) {
+	if xdg := os.Getenv("XDG_STATE_HOME"); xdg != "" {
+		return filepath.Join(xdg, "pingen"), nil
+	}
+	switch runtime.GOOS {
+	case "windows":
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, "pingen", "state"), nil
+	case "darwin", "ios":
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, "pingen", "state"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state", "pingen"), nil
+}
+
+func LoadConfig(path string) (Config, bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Config{}, false, nil
+		}
+		return Config{}, false, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Config{}, true, err
+	}
+	return cfg, true, nil
+}
+
+func SaveConfig(path string, cfg Config) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	payload, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	payload = append(payload, '\n')
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	// O_CREATE's mode only applies to new files; tighten existing ones too.
+	if err := file.Chmod(0o600); err != nil && runtime.GOOS != "windows" {
+		return err
+	}
+	_, err = file.Write(payload)
+	return err
+}
+
+func MergeConfig(base Config, override Config) Config {
+	merged := base
+	if override.Env != "" {
+		merged.Env = override.Env
+	}
+	if override.APIBase != "" {
+		merged.APIBase = override.APIBase
+	}
+	if override.IdentityBase != "" {
+		merged.IdentityBase = override.IdentityBase
+	}
+	if override.OrganisationID != "" {
+		merged.OrganisationID = override.OrganisationID
+	}
+	if override.AccessToken != "" {
+		merged.AccessToken = override.AccessToken
+	}
+	if override.AccessTokenExpiresAt != 0 {
+		merged.AccessTokenExpiresAt = override.AccessTokenExpiresAt
+	}
+	if override.ClientID != "" {
+		merged.ClientID = override.ClientID
+	}
+	if override.ClientSecret != "" {
+		merged.ClientSecret = override.ClientSecret
+	}
+	if override.Timezone != "" {
+		merged.Timezone = override.Timezone
+	}
+	if override.MaxUploadSize != "" {
+		merged.MaxUploadSize = override.MaxUploadSize
+	}
+	if override.MaxPages != 0 {
+		merged.MaxPages = override.MaxPages
+	}
+	if override.ContactsFile != "" {
+		merged.ContactsFile = override.ContactsFile
+	}
+	if len(override.Defaults) > 0 {
+		merged.Defaults = map[string]map[string]string{}
+		for command, flags := range base.Defaults {
+			merged.Defaults[command] = flags
+		}
+		for command, flags := range override.Defaults {
+			combined := map[string]string{}
+			for name, value := range base.Defaults[command] {
+				combined[name] = value
+			}
+			for name, value := range flags {
+				combined[name] = value
+			}
+			merged.Defaults[command] = combined
+		}
+	}
+	if override.DisableUpdateCheck {
+		merged.DisableUpdateCheck = true
+	}
+	if len(override.Headers) > 0 {
+		merged.Headers = map[string]string{}
+		for name, value := range base.Headers {
+			merged.Headers[name] = value
+		}
+		for name, value := range override.Headers {
+			merged.Headers[name] = value
+		}
+	}
+	if len(override.OutputTemplates) > 0 {
+		merged.OutputTemplates = map[string]string{}
+		for name, layout := range base.OutputTemplates {
+			merged.OutputTemplates[name] = layout
+		}
+		for name, layout := range override.OutputTemplates {
+			merged.OutputTemplates[name] = layout
+		}
+	}
+	if len(override.LetterTemplates) > 0 {
+		merged.LetterTemplates = map[string]map[string]string{}
+		for name, flags := range base.LetterTemplates {
+			merged.LetterTemplates[name] = flags
+		}
+		for name, flags := range override.LetterTemplates {
+			merged.LetterTemplates[name] = flags
+		}
+	}
+	if len(override.Schedules) > 0 {
+		merged.Schedules = map[string]Schedule{}
+		for name, schedule := range base.Schedules {
+			merged.Schedules[name] = schedule
+		}
+		for name, schedule := range override.Schedules {
+			merged.Schedules[name] = schedule
+		}
+	}
+	if len(override.FilterPresets) > 0 {
+		merged.FilterPresets = map[string]FilterPreset{}
+		for name, preset := range base.FilterPresets {
+			merged.FilterPresets[name] = preset
+		}
+		for name, preset := range override.FilterPresets {
+			merged.FilterPresets[name] = preset
+		}
+	}
+	return merged
+}
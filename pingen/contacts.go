@@ -0,0 +1,58 @@
+package pingen
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Contact is a postal address in the shape of letter meta_data.recipient and
+// meta_data.sender.
+type Contact struct {
+	Name    string `json:"name"`
+	Street  string `json:"street,omitempty"`
+	Number  string `json:"number,omitempty"`
+	POBox   string `json:"pobox,omitempty"`
+	Zip     string `json:"zip"`
+	City    string `json:"city"`
+	Country string `json:"country"`
+}
+
+// DefaultContactsPath returns contacts.json next to the config file.
+func DefaultContactsPath() (string, error) {
+	configPath, err := ConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), "contacts.json"), nil
+}
+
+// LoadContacts reads the address book at path; a missing file is empty.
+func LoadContacts(path string) (map[string]Contact, error) {
+	contacts := map[string]Contact{}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return contacts, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &contacts); err != nil {
+		return nil, err
+	}
+	return contacts, nil
+}
+
+// SaveContacts writes the address book. New files are private (0600); the mode
+// of an existing file is kept so that a shared address book stays shared.
+func SaveContacts(path string, contacts map[string]Contact) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	payload, err := json.MarshalIndent(contacts, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(payload, '\n'), 0o600)
+}
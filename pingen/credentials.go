@@ -0,0 +1,230 @@
+package pingen
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// credentialService is the service name secrets are filed under in the OS
+// keychain.
+const credentialService = "pingen-cli"
+
+// ErrCredentialNotFound is returned by CredentialStore.Get for unknown keys.
+var ErrCredentialNotFound = errors.New("credential not found")
+
+// ErrNoKeychain means the platform has no usable OS keychain.
+var ErrNoKeychain = errors.New("no OS keychain available")
+
+// CredentialStore keeps secrets outside the config file.
+type CredentialStore interface {
+	// Name describes the store for messages, e.g. "macOS Keychain".
+	Name() string
+	Get(key string) (string, error)
+	Set(key, value string) error
+	// Delete removes key; deleting a missing key is not an error.
+	Delete(key string) error
+}
+
+// windowsCredentials is set on Windows, where the store needs syscalls.
+var windowsCredentials func() (CredentialStore, error)
+
+// KeychainStore returns the OS keychain: the macOS Keychain via security(1),
+// the Secret Service (GNOME Keyring, KWallet) via libsecret's secret-tool, or
+// the Windows Credential Manager.
+func KeychainStore() (CredentialStore, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		if _, err := exec.LookPath("security"); err != nil {
+			return nil, fmt.Errorf("%w: security not found", ErrNoKeychain)
+		}
+		return macKeychain{}, nil
+	case "windows":
+		if windowsCredentials == nil {
+			return nil, ErrNoKeychain
+		}
+		return windowsCredentials()
+	}
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return nil, fmt.Errorf("%w: secret-tool (libsecret) not found", ErrNoKeychain)
+	}
+	return secretService{}, nil
+}
+
+// secretKey names the keychain entry for a config secret. The config path is
+// part of it so that configs chosen via PINGEN_CONFIG_PATH do not share
+// credentials.
+func secretKey(path, name string) string {
+	return name + "@" + path
+}
+
+// secretFields maps the names of the secrets in cfg to their fields.
+func secretFields(cfg *Config) map[string]*string {
+	return map[string]*string{
+		"client_secret": &cfg.ClientSecret,
+		"access_token":  &cfg.AccessToken,
+		"refresh_token": &cfg.RefreshToken,
+	}
+}
+
+// secretNames lists the secrets of secretFields in a stable order.
+var secretNames = []string{"client_secret", "access_token", "refresh_token"}
+
+// LoadSecrets fills in the secrets cfg.KeychainSecrets says are kept in
+// store. Secrets that cannot be read are left empty and reported in the
+// returned error.
+func LoadSecrets(store CredentialStore, path string, cfg Config) (Config, error) {
+	fields := secretFields(&cfg)
+	var errs []error
+	for _, name := range cfg.KeychainSecrets {
+		field, ok := fields[name]
+		if !ok {
+			continue
+		}
+		value, err := store.Get(secretKey(path, name))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		*field = value
+	}
+	return cfg, errors.Join(errs...)
+}
+
+// StoreSecrets moves the secrets of cfg into store and returns the config to
+// write to path, with those secrets blanked and listed in KeychainSecrets.
+// Secrets that were cleared are deleted from store. A secret that cannot be
+// stored stays in the returned config and is reported in the error. With
+// CredentialStore "file" all secrets are moved back into the config. A nil
+// store stands for an unreachable keychain: entries already in it stay
+// listed unless cfg now holds a value for them.
+func StoreSecrets(store CredentialStore, path string, cfg Config) (Config, error) {
+	kept := map[string]bool{}
+	for _, name := range cfg.KeychainSecrets {
+		kept[name] = true
+	}
+	fields := secretFields(&cfg)
+	var errs []error
+	for _, name := range secretNames {
+		field := fields[name]
+		switch {
+		case store == nil:
+			if *field != "" {
+				errs = append(errs, fmt.Errorf("%s: %w", name, ErrNoKeychain))
+				delete(kept, name)
+			}
+		case *field == "" || cfg.CredentialStore == "file":
+			if kept[name] {
+				if err := store.Delete(secretKey(path, name)); err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				}
+				delete(kept, name)
+			}
+		default:
+			if err := store.Set(secretKey(path, name), *field); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				delete(kept, name)
+				continue
+			}
+			*field = ""
+			kept[name] = true
+		}
+	}
+	cfg.KeychainSecrets = nil
+	for _, name := range secretNames {
+		if kept[name] {
+			cfg.KeychainSecrets = append(cfg.KeychainSecrets, name)
+		}
+	}
+	return cfg, errors.Join(errs...)
+}
+
+// runCredentialTool runs a keychain helper and returns its trimmed stdout.
+// The exit status and stderr are folded into the error.
+func runCredentialTool(stdin string, name string, args ...string) (string, int, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			if detail := strings.TrimSpace(stderr.String()); detail != "" {
+				return "", exitErr.ExitCode(), fmt.Errorf("%s: %s", name, detail)
+			}
+			return "", exitErr.ExitCode(), fmt.Errorf("%s: %w", name, err)
+		}
+		return "", -1, err
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), 0, nil
+}
+
+// macKeychain stores generic passwords in the login keychain.
+type macKeychain struct{}
+
+// macNotFound is the exit status of security(1) for a missing item.
+const macNotFound = 44
+
+func (macKeychain) Name() string { return "macOS Keychain" }
+
+func (macKeychain) Get(key string) (string, error) {
+	value, code, err := runCredentialTool("", "security", "find-generic-password", "-s", credentialService, "-a", key, "-w")
+	if code == macNotFound {
+		return "", ErrCredentialNotFound
+	}
+	return value, err
+}
+
+// Set passes the secret on stdin through `security -i`, hex encoded, so it
+// never shows up in the process list.
+func (macKeychain) Set(key, value string) error {
+	command := fmt.Sprintf("add-generic-password -U -s %s -a %s -X %s\n", quoteSecurityArg(credentialService), quoteSecurityArg(key), hex.EncodeToString([]byte(value)))
+	_, _, err := runCredentialTool(command, "security", "-i")
+	return err
+}
+
+func (macKeychain) Delete(key string) error {
+	_, code, err := runCredentialTool("", "security", "delete-generic-password", "-s", credentialService, "-a", key)
+	if code == macNotFound {
+		return nil
+	}
+	return err
+}
+
+// quoteSecurityArg quotes an argument for the `security -i` command line.
+func quoteSecurityArg(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// secretService stores secrets through libsecret's secret-tool.
+type secretService struct{}
+
+func (secretService) Name() string { return "Secret Service" }
+
+func (secretService) Get(key string) (string, error) {
+	value, code, err := runCredentialTool("", "secret-tool", "lookup", "service", credentialService, "account", key)
+	// secret-tool exits 1 without output when nothing matches.
+	if code == 1 && value == "" {
+		return "", ErrCredentialNotFound
+	}
+	return value, err
+}
+
+func (secretService) Set(key, value string) error {
+	_, _, err := runCredentialTool(value, "secret-tool", "store", "--label", credentialService+" "+key, "service", credentialService, "account", key)
+	return err
+}
+
+func (secretService) Delete(key string) error {
+	_, code, err := runCredentialTool("", "secret-tool", "clear", "service", credentialService, "account", key)
+	if code == 1 {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+package pingen
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+func init() {
+	windowsCredentials = func() (CredentialStore, error) {
+		if err := procCredReadW.Find(); err != nil {
+			return nil, ErrNoKeychain
+		}
+		return windowsCredentialManager{}, nil
+	}
+}
+
+var (
+	advapi32         = syscall.NewLazyDLL("advapi32.dll")
+	procCredReadW    = advapi32.NewProc("CredReadW")
+	procCredWriteW   = advapi32.NewProc("CredWriteW")
+	procCredDeleteW  = advapi32.NewProc("CredDeleteW")
+	procCredFree     = advapi32.NewProc("CredFree")
+	errorNotFound    = syscall.Errno(1168)
+	credTypeGeneric  = uint32(1)
+	credPersistLocal = uint32(2)
+)
+
+// credentialW mirrors the Win32 CREDENTIALW structure.
+type credentialW struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// windowsCredentialManager stores generic credentials named
+// "pingen-cli:<key>" in the Windows Credential Manager.
+type windowsCredentialManager struct{}
+
+func (windowsCredentialManager) Name() string { return "Windows Credential Manager" }
+
+func credentialTarget(key string) (*uint16, error) {
+	return syscall.UTF16PtrFromString(credentialService + ":" + key)
+}
+
+func (windowsCredentialManager) Get(key string) (string, error) {
+	target, err := credentialTarget(key)
+	if err != nil {
+		return "", err
+	}
+	var cred *credentialW
+	ok, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(target)), uintptr(credTypeGeneric), 0, uintptr(unsafe.Pointer(&cred)))
+	if ok == 0 {
+		if err == errorNotFound {
+			return "", ErrCredentialNotFound
+		}
+		return "", err
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+	if cred.CredentialBlobSize == 0 {
+		return "", nil
+	}
+	return string(unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)), nil
+}
+
+func (windowsCredentialManager) Set(key, value string) error {
+	target, err := credentialTarget(key)
+	if err != nil {
+		return err
+	}
+	user, err := syscall.UTF16PtrFromString(credentialService)
+	if err != nil {
+		return err
+	}
+	blob := []byte(value)
+	cred := credentialW{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		CredentialBlobSize: uint32(len(blob)),
+		Persist:            credPersistLocal,
+		UserName:           user,
+	}
+	if len(blob) > 0 {
+		cred.CredentialBlob = &blob[0]
+	}
+	if ok, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0); ok == 0 {
+		return err
+	}
+	return nil
+}
+
+func (windowsCredentialManager) Delete(key string) error {
+	target, err := credentialTarget(key)
+	if err != nil {
+		return err
+	}
+	if ok, _, err := procCredDeleteW.Call(uintptr(unsafe.Pointer(target)), uintptr(credTypeGeneric), 0); ok == 0 && err != errorNotFound {
+		return err
+	}
+	return nil
+}
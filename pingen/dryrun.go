@@ -0,0 +1,76 @@
+package pingen
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrDryRun is returned by the requests of a client with DryRun set. The
+// upload steps are the exception: GetFileUpload returns the placeholders
+// below and UploadFile succeeds, so that the request that creates a letter
+// or batch from the upload can be previewed as well.
+var ErrDryRun = errors.New("dry run: request not sent")
+
+// Placeholders for the presigned upload URL and its signature in dry runs.
+const (
+	DryRunUploadURL       = "{upload url from /file-upload}"
+	DryRunUploadSignature = "{url signature from /file-upload}"
+)
+
+// RequestPreview is a request as it would have been sent. Credentials in the
+// headers are masked, so previews can be shared for review.
+type RequestPreview struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	// Payload is the decoded JSON body, or the body as text.
+	Payload any `json:"payload,omitempty"`
+	// File is the local file sent as the body of an upload.
+	File string `json:"file,omitempty"`
+}
+
+// sensitiveHeaderParts mark header names whose values are credentials.
+var sensitiveHeaderParts = []string{"authorization", "cookie", "token", "secret", "password", "api-key", "apikey"}
+
+// preview builds the RequestPreview of a request with the same headers
+// doRequest would set: the User-Agent, then Headers, then the per-request
+// headers.
+func (c Client) preview(method, endpoint string, headers map[string]string, custom bool, body []byte) RequestPreview {
+	header := http.Header{"User-Agent": {UserAgent}}
+	if custom {
+		for name, value := range c.Headers {
+			header.Set(name, value)
+		}
+	}
+	for name, value := range headers {
+		if value != "" {
+			header.Set(name, value)
+		}
+	}
+	preview := RequestPreview{Method: method, URL: maskURL(endpoint), Headers: map[string]string{}}
+	for name, values := range maskHeader(header) {
+		preview.Headers[name] = values[0]
+	}
+	if len(body) > 0 {
+		var decoded any
+		if err := json.Unmarshal(body, &decoded); err == nil {
+			preview.Payload = decoded
+		} else {
+			preview.Payload = string(body)
+		}
+	}
+	return preview
+}
+
+// SensitiveHeader reports whether the header name carries credentials.
+func SensitiveHeader(name string) bool {
+	name = strings.ToLower(name)
+	for _, part := range sensitiveHeaderParts {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	return false
+}
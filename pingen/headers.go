@@ -0,0 +1,36 @@
+package pingen
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var headerName = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// reservedHeaders are set by the client for every request and cannot be
+// replaced by custom headers.
+var reservedHeaders = map[string]bool{"Authorization": true, "Content-Type": true, "Content-Length": true, "Host": true, "Idempotency-Key": true}
+
+// ParseHeader splits a "Name: value" or "Name=value" header as given to
+// --header and returns the canonical name. Names cannot contain ":" or "=",
+// so the first of them separates the name from the value.
+func ParseHeader(header string) (string, string, error) {
+	separator := strings.IndexAny(header, ":=")
+	if separator < 0 {
+		return "", "", fmt.Errorf("invalid header %q (use 'Name: value' or Name=value)", header)
+	}
+	name, value := strings.TrimSpace(header[:separator]), strings.TrimSpace(header[separator+1:])
+	if !headerName.MatchString(name) {
+		return "", "", fmt.Errorf("invalid header %q (use 'Name: value' or Name=value)", header)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return "", "", fmt.Errorf("invalid header %q: value contains a line break", name)
+	}
+	name = http.CanonicalHeaderKey(name)
+	if reservedHeaders[name] {
+		return "", "", fmt.Errorf("invalid header %q: set by the CLI and cannot be overridden", name)
+	}
+	return name, value, nil
+}
@@ -0,0 +1,214 @@
+package pingen
+
+import (
+	"bytes"
+	"html"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// placeholderPattern matches {{name}} and {{ name }}.
+	placeholderPattern = regexp.MustCompile(`\{\{\s*([^{}\s]+)\s*\}\}`)
+	// inlineImageEnd ends the data of an inline image.
+	inlineImageEnd = regexp.MustCompile(`\sEI(\s|$)`)
+)
+
+// Placeholders returns the distinct placeholder names in text, sorted.
+func Placeholders(text string) []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			names = append(names, match[1])
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FillHTML replaces the placeholders of an HTML template with the
+// HTML-escaped values; names are matched case-insensitively.
+func FillHTML(template string, values map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(template, func(match string) string {
+		name := placeholderPattern.FindStringSubmatch(match)[1]
+		return html.EscapeString(values[strings.ToLower(name)])
+	})
+}
+
+// PDFTemplate is a PDF whose text holds {{name}} placeholders. Placeholders
+// are found in the literal strings of the page content and of the forms the
+// pages draw, so they must be set in a font with a single-byte encoding;
+// text in CID fonts (hex strings) is left alone.
+type PDFTemplate struct {
+	// Names are the placeholders used in the template.
+	Names []string
+	// SubsetFonts is set when the template embeds font subsets, which may
+	// lack glyphs for characters that only occur in the values.
+	SubsetFonts bool
+
+	data    []byte
+	doc     *pdfDocument
+	root    int
+	streams map[int][]byte // decoded content with placeholders, by object
+}
+
+// LoadPDFTemplate reads the PDF template at path.
+func LoadPDFTemplate(path string) (*PDFTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, FileError{err: err}
+	}
+	doc := loadPDF(data)
+	t := &PDFTemplate{data: data, doc: doc, root: doc.catalogNumber(data), streams: map[int][]byte{}}
+	if t.root < 0 {
+		return nil, pdfErrorf("could not read the pages of %s", path)
+	}
+	names := map[string]bool{}
+	for _, page := range doc.pages() {
+		refs := []pdfRef{}
+		switch contents := page["Contents"].(type) {
+		case pdfRef:
+			refs = append(refs, contents)
+		case []any:
+			for _, item := range contents {
+				if ref, ok := item.(pdfRef); ok {
+					refs = append(refs, ref)
+				}
+			}
+		}
+		resources := doc.dict(doc.inherited(page, "Resources"))
+		for _, value := range doc.dict(resources["XObject"]) {
+			if ref, ok := value.(pdfRef); ok && doc.dict(ref)["Subtype"] == pdfName("Form") {
+				refs = append(refs, ref)
+			}
+		}
+		for _, font := range doc.dict(resources["Font"]) {
+			if base, ok := doc.dict(font)["BaseFont"].(pdfName); ok && len(base) > 7 && base[6] == '+' {
+				t.SubsetFonts = true
+			}
+		}
+		for _, ref := range refs {
+			content := doc.streamData(ref)
+			found := false
+			scanContentStrings(content, func(raw []byte) []byte {
+				for _, name := range Placeholders(string(raw)) {
+					names[name], found = true, true
+				}
+				return nil
+			})
+			if found {
+				t.streams[int(ref)] = content
+			}
+		}
+	}
+	for name := range names {
+		t.Names = append(t.Names, name)
+	}
+	sort.Strings(t.Names)
+	return t, nil
+}
+
+// Fill returns the template with its placeholders replaced by values, which
+// are WinAnsi encoded. Names are matched case-insensitively. Kerning in a
+// TJ array that holds a placeholder is dropped.
+func (t *PDFTemplate) Fill(values map[string]string) []byte {
+	objects := t.doc.rewritableObjects()
+	for number, content := range t.streams {
+		filled := scanContentStrings(content, func(raw []byte) []byte {
+			if !placeholderPattern.Match(raw) {
+				return nil
+			}
+			return placeholderPattern.ReplaceAllFunc(raw, func(match []byte) []byte {
+				name := placeholderPattern.FindSubmatch(match)[1]
+				return winAnsiBytes(values[strings.ToLower(string(name))])
+			})
+		})
+		dict := map[string]any{}
+		for key, value := range t.doc.objects[number].value.(map[string]any) {
+			if key != "Filter" && key != "DecodeParms" {
+				dict[key] = value
+			}
+		}
+		objects[number] = pdfObject{value: dict, stream: filled}
+	}
+	return writePDF(pdfVersion(t.data), objects, rewriteTrailer(t.data, t.root, objects))
+}
+
+// scanContentStrings calls replace with the bytes of every literal string in
+// a content stream, and with the joined strings of every array, so that
+// placeholders split by kerning are found. It returns the content with each
+// string or array for which replace returned non-nil bytes replaced by them.
+// Inline image data and comments are skipped.
+func scanContentStrings(content []byte, replace func(raw []byte) []byte) []byte {
+	var out bytes.Buffer
+	for pos := 0; pos < len(content); {
+		c := content[pos]
+		switch {
+		case c == '%':
+			end := bytes.IndexAny(content[pos:], "\r\n")
+			if end < 0 {
+				end = len(content) - pos
+			}
+			out.Write(content[pos : pos+end])
+			pos += end
+		case c == '(':
+			lexer := &pdfLexer{data: content, pos: pos}
+			raw := lexer.literalString()
+			if replaced := replace(raw); replaced != nil {
+				out.WriteString(literalBytes(replaced))
+			} else {
+				out.Write(content[pos:lexer.pos])
+			}
+			pos = lexer.pos
+		case c == '[':
+			lexer := &pdfLexer{data: content, pos: pos}
+			items, _ := lexer.token().([]any)
+			var joined []byte
+			for _, item := range items {
+				if text, ok := item.(pdfString); ok {
+					joined = append(joined, text...)
+				}
+			}
+			if replaced := replace(joined); replaced != nil {
+				out.WriteString("[" + literalBytes(replaced) + "]")
+			} else {
+				out.Write(content[pos:lexer.pos])
+			}
+			pos = lexer.pos
+		case bytes.HasPrefix(content[pos:], []byte("<<")):
+			out.WriteString("<<")
+			pos += 2
+		case c == '<':
+			end := bytes.IndexByte(content[pos:], '>')
+			if end < 0 {
+				end = len(content) - pos - 1
+			}
+			out.Write(content[pos : pos+end+1])
+			pos += end + 1
+		case isPDFSpace(c) || isPDFDelimiter(c):
+			out.WriteByte(c)
+			pos++
+		default:
+			start := pos
+			for pos < len(content) && !isPDFSpace(content[pos]) && !isPDFDelimiter(content[pos]) {
+				pos++
+			}
+			out.Write(content[start:pos])
+			if string(content[start:pos]) == "ID" && pos < len(content) {
+				// Inline image data runs up to a whitespace-delimited EI.
+				end := inlineImageEnd.FindIndex(content[pos+1:])
+				if end == nil {
+					out.Write(content[pos:])
+					return out.Bytes()
+				}
+				out.Write(content[pos : pos+1+end[0]])
+				pos += 1 + end[0]
+			}
+		}
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,104 @@
+package pingen
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// NewPKCE returns a random PKCE code verifier and its S256 code challenge
+// (RFC 7636).
+func NewPKCE() (string, string, error) {
+	verifier, err := randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// NewOAuthState returns a random state value for an authorization request.
+func NewOAuthState() (string, error) {
+	return randomToken(16)
+}
+
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// AuthorizeURL is the identity server page where the user logs in and
+// grants clientID access; the browser is then sent back to redirectURI with
+// a code for ExchangeCode.
+func (c Client) AuthorizeURL(clientID, redirectURI, scope, state, challenge string) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", clientID)
+	query.Set("redirect_uri", redirectURI)
+	if scope != "" {
+		query.Set("scope", scope)
+	}
+	query.Set("state", state)
+	query.Set("code_challenge", challenge)
+	query.Set("code_challenge_method", "S256")
+	return c.IdentityBase + "/auth/authorize?" + query.Encode()
+}
+
+// ExchangeCodeRaw trades an authorization code for an access and a refresh
+// token. clientSecret may be empty for public clients; verifier is the PKCE
+// code verifier the challenge was made from.
+func (c Client) ExchangeCodeRaw(ctx context.Context, clientID, clientSecret, code, redirectURI, verifier string) (map[string]any, http.Header, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("client_id", clientID)
+	if clientSecret != "" {
+		form.Set("client_secret", clientSecret)
+	}
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("code_verifier", verifier)
+	return c.requestToken(ctx, form, "authorization code exchange failed")
+}
+
+// RefreshAccessTokenRaw gets a new access token with a refresh token from
+// ExchangeCode. The response may carry a new refresh token that replaces the
+// old one.
+func (c Client) RefreshAccessTokenRaw(ctx context.Context, clientID, clientSecret, refreshToken string) (map[string]any, http.Header, error) {
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("client_id", clientID)
+	if clientSecret != "" {
+		form.Set("client_secret", clientSecret)
+	}
+	form.Set("refresh_token", refreshToken)
+	return c.requestToken(ctx, form, "token refresh failed")
+}
+
+// TokenClaims decodes the claims of a JWT access token without verifying
+// its signature; they are only used to describe the token, e.g. its scopes
+// and the client it was issued to.
+func TokenClaims(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("the access token is not a JWT")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("the access token is not a JWT: %w", err)
+	}
+	claims := map[string]any{}
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return nil, fmt.Errorf("the access token is not a JWT: %w", err)
+	}
+	return claims, nil
+}
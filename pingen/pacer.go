@@ -0,0 +1,101 @@
+package pingen
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RatePacer spaces API requests so that they stay within the rate limit the
+// API reports in its responses. It is safe for concurrent use; share one
+// between clients, e.g. the workers of a bulk operation, so that they pace
+// together.
+//
+// Requests go out without delay while more than a tenth of the budget is
+// left. Below that, the remaining requests are spread evenly until the
+// limit resets, and once the budget is used up the pacer waits for the
+// reset.
+type RatePacer struct {
+	mu    sync.Mutex
+	limit RateLimit
+	next  time.Time
+	// OnWait is called before a request is held back, e.g. for logging.
+	OnWait func(wait time.Duration, limit RateLimit)
+}
+
+// NewRatePacer returns a pacer that lets requests through until a response
+// reports a rate limit.
+func NewRatePacer() *RatePacer {
+	return &RatePacer{}
+}
+
+// Limit returns the budget of the latest response that reported one.
+func (p *RatePacer) Limit() RateLimit {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.limit
+}
+
+// observe records the budget reported by a response.
+func (p *RatePacer) observe(limit RateLimit) {
+	if !limit.Known {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// Responses to concurrent requests arrive in any order; within the same
+	// window the lowest remaining budget is the current one.
+	if p.limit.Known && limit.Reset.Equal(p.limit.Reset) && limit.Remaining > p.limit.Remaining {
+		limit.Remaining = p.limit.Remaining
+	}
+	p.limit = limit
+}
+
+// wait blocks until the next request fits the budget. It returns early with
+// the context's error when ctx ends.
+func (p *RatePacer) wait(ctx context.Context) error {
+	p.mu.Lock()
+	now := time.Now()
+	delay := p.delay(now)
+	limit := p.limit
+	// Count the request against the budget until a response reports the
+	// new one, so that concurrent callers do not all see the same budget.
+	if p.limit.Known && p.limit.Remaining > 0 {
+		p.limit.Remaining--
+	}
+	p.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	if p.OnWait != nil {
+		p.OnWait(delay, limit)
+	}
+	if !sleepContext(ctx, delay) {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// delay is how long the next request has to wait; p.mu is held.
+func (p *RatePacer) delay(now time.Time) time.Duration {
+	if !p.limit.Known || p.limit.Reset.IsZero() || !now.Before(p.limit.Reset) {
+		return 0
+	}
+	reserve := p.limit.Limit / 10
+	if reserve < 1 {
+		reserve = 1
+	}
+	if p.limit.Remaining > reserve {
+		return 0
+	}
+	untilReset := p.limit.Reset.Sub(now)
+	if p.limit.Remaining <= 0 {
+		return untilReset
+	}
+	slot := p.next
+	if slot.Before(now) {
+		slot = now
+	}
+	p.next = slot.Add(untilReset / time.Duration(p.limit.Remaining+1))
+	return slot.Sub(now)
+}
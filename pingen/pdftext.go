@@ -0,0 +1,1036 @@
+package pingen
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// TextRun is a piece of text drawn by one text-showing operator, positioned in
+// points from the bottom-left corner of the page.
+type TextRun struct {
+	X    float64 `json:"x"`
+	Y    float64 `json:"y"`
+	EndX float64 `json:"end_x"`
+	Size float64 `json:"size"`
+	Text string  `json:"text"`
+}
+
+// ImageBox is the bounding box of an image drawn on a page, in points from the
+// bottom-left corner.
+type ImageBox struct {
+	X0 float64 `json:"x0"`
+	Y0 float64 `json:"y0"`
+	X1 float64 `json:"x1"`
+	Y1 float64 `json:"y1"`
+}
+
+// PDFPage is the text and the image placements of one page.
+type PDFPage struct {
+	Width  float64
+	Height float64
+	Runs   []TextRun
+	Images []ImageBox
+}
+
+// FirstPageText returns the text runs of the first page of the PDF at path and
+// the page size in points. It understands the common producers (uncompressed
+// and Flate streams, object streams, ToUnicode maps, form XObjects); scanned
+// pages and encrypted files yield no text.
+func FirstPageText(path string) ([]TextRun, float64, float64, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, 0, FileError{err: err}
+	}
+	doc := loadPDF(content)
+	page := doc.firstPage()
+	if page == nil {
+		return nil, 0, 0, pdfErrorf("could not read the pages of %s", path)
+	}
+	result := doc.readPage(page)
+	return result.Runs, result.Width, result.Height, nil
+}
+
+// ReadPDFPages returns the text and image placements of every page of the PDF
+// at path, in page order.
+func ReadPDFPages(path string) ([]PDFPage, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, FileError{err: err}
+	}
+	doc := loadPDF(content)
+	pages := doc.pages()
+	if len(pages) == 0 {
+		return nil, pdfErrorf("could not read the pages of %s", path)
+	}
+	result := make([]PDFPage, 0, len(pages))
+	for _, page := range pages {
+		result = append(result, doc.readPage(page))
+	}
+	return result, nil
+}
+
+func (d *pdfDocument) readPage(page map[string]any) PDFPage {
+	result := PDFPage{Width: 595, Height: 842} // A4
+	if box, ok := d.inherited(page, "MediaBox").([]any); ok && len(box) == 4 {
+		x0, y0, x1, y1 := d.number(box[0]), d.number(box[1]), d.number(box[2]), d.number(box[3])
+		result.Width, result.Height = x1-x0, y1-y0
+	}
+	resources, _ := d.resolve(d.inherited(page, "Resources")).(map[string]any)
+	var stream []byte
+	contents := d.resolve(page["Contents"])
+	if list, ok := contents.([]any); ok {
+		for _, item := range list {
+			stream = append(append(stream, d.streamData(item)...), '\n')
+		}
+	} else {
+		stream = d.streamData(page["Contents"])
+	}
+	interpreter := &textInterpreter{doc: d, fonts: map[pdfRef]*pdfFont{}}
+	interpreter.run(stream, resources, identityMatrix, 0)
+	result.Runs, result.Images = interpreter.runs, interpreter.images
+	return result
+}
+
+// TextLines joins the runs inside the rectangle (points, origin bottom-left)
+// into lines, top to bottom.
+func TextLines(runs []TextRun, x0, y0, x1, y1 float64) []string {
+	inside := []TextRun{}
+	for _, run := range runs {
+		if strings.TrimSpace(run.Text) == "" {
+			continue
+		}
+		if run.X >= x0 && run.X < x1 && run.Y >= y0 && run.Y < y1 {
+			inside = append(inside, run)
+		}
+	}
+	sort.SliceStable(inside, func(i, j int) bool { return inside[i].Y > inside[j].Y })
+	type line struct {
+		y    float64
+		runs []TextRun
+	}
+	lines := []*line{}
+	for _, run := range inside {
+		var current *line
+		if len(lines) > 0 {
+			last := lines[len(lines)-1]
+			if math.Abs(last.y-run.Y) < math.Max(run.Size, 1)*0.5 {
+				current = last
+			}
+		}
+		if current == nil {
+			current = &line{y: run.Y}
+			lines = append(lines, current)
+		}
+		current.runs = append(current.runs, run)
+	}
+	text := []string{}
+	for _, l := range lines {
+		sort.SliceStable(l.runs, func(i, j int) bool { return l.runs[i].X < l.runs[j].X })
+		var b strings.Builder
+		for i, run := range l.runs {
+			if i > 0 && run.X-l.runs[i-1].EndX > run.Size*0.15 && !strings.HasSuffix(b.String(), " ") {
+				b.WriteByte(' ')
+			}
+			b.WriteString(run.Text)
+		}
+		if joined := strings.Join(strings.Fields(b.String()), " "); joined != "" {
+			text = append(text, joined)
+		}
+	}
+	return text
+}
+
+// PDF object model: dictionaries are map[string]any, arrays []any, numbers
+// float64, and the types below.
+type (
+	pdfName    string
+	pdfRef     int
+	pdfString  []byte
+	pdfKeyword string
+)
+
+type pdfObject struct {
+	value  any
+	stream []byte // raw, still encoded
+}
+
+type pdfDocument struct {
+	objects map[int]pdfObject
+}
+
+var objectHeader = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+
+func loadPDF(data []byte) *pdfDocument {
+	doc := &pdfDocument{objects: map[int]pdfObject{}}
+	skipUntil := 0
+	for _, match := range objectHeader.FindAllSubmatchIndex(data, -1) {
+		if match[0] < skipUntil {
+			continue // inside a stream parsed earlier
+		}
+		number, _ := strconv.Atoi(string(data[match[2]:match[3]]))
+		lexer := &pdfLexer{data: data, pos: match[1]}
+		value := lexer.value()
+		object := pdfObject{value: value}
+		if keyword, ok := lexer.token().(pdfKeyword); ok && keyword == "stream" {
+			start := lexer.pos
+			if start < len(data) && data[start] == '\r' {
+				start++
+			}
+			if start < len(data) && data[start] == '\n' {
+				start++
+			}
+			end := -1
+			if dict, ok := value.(map[string]any); ok {
+				if length, ok := dict["Length"].(float64); ok && start+int(length) <= len(data) {
+					rest := bytes.TrimLeft(data[start+int(length):], "\r\n \t")
+					if bytes.HasPrefix(rest, []byte("endstream")) {
+						end = start + int(length)
+					}
+				}
+			}
+			if end < 0 {
+				if index := bytes.Index(data[start:], []byte("endstream")); index >= 0 {
+					end = start + index
+					for end > start && (data[end-1] == '\n' || data[end-1] == '\r') {
+						end--
+					}
+				} else {
+					end = len(data)
+				}
+			}
+			object.stream = data[start:end]
+			skipUntil = end
+		}
+		doc.objects[number] = object
+	}
+	for _, object := range doc.objects {
+		dict, ok := object.value.(map[string]any)
+		if !ok || dict["Type"] != pdfName("ObjStm") {
+			continue
+		}
+		doc.loadObjectStream(dict, object.stream)
+	}
+	return doc
+}
+
+func (d *pdfDocument) loadObjectStream(dict map[string]any, raw []byte) {
+	data, err := d.decode(dict, raw)
+	if err != nil {
+		return
+	}
+	count, first := int(d.number(dict["N"])), int(d.number(dict["First"]))
+	if first > len(data) {
+		return
+	}
+	header := &pdfLexer{data: data[:first]}
+	for i := 0; i < count; i++ {
+		number, ok1 := header.token().(float64)
+		offset, ok2 := header.token().(float64)
+		if !ok1 || !ok2 || first+int(offset) >= len(data) {
+			return
+		}
+		if _, exists := d.objects[int(number)]; exists {
+			continue
+		}
+		lexer := &pdfLexer{data: data, pos: first + int(offset)}
+		d.objects[int(number)] = pdfObject{value: lexer.value()}
+	}
+}
+
+func (d *pdfDocument) resolve(value any) any {
+	for depth := 0; depth < 32; depth++ {
+		ref, ok := value.(pdfRef)
+		if !ok {
+			return value
+		}
+		value = d.objects[int(ref)].value
+	}
+	return nil
+}
+
+func (d *pdfDocument) dict(value any) map[string]any {
+	dict, _ := d.resolve(value).(map[string]any)
+	return dict
+}
+
+func (d *pdfDocument) number(value any) float64 {
+	number, _ := d.resolve(value).(float64)
+	return number
+}
+
+// streamData returns the decoded stream of the object value refers to.
+func (d *pdfDocument) streamData(value any) []byte {
+	ref, ok := value.(pdfRef)
+	if !ok {
+		return nil
+	}
+	object := d.objects[int(ref)]
+	dict, _ := object.value.(map[string]any)
+	data, err := d.decode(dict, object.stream)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func (d *pdfDocument) decode(dict map[string]any, raw []byte) ([]byte, error) {
+	filters := []any{}
+	switch filter := d.resolve(dict["Filter"]).(type) {
+	case pdfName:
+		filters = append(filters, filter)
+	case []any:
+		filters = filter
+	}
+	data := raw
+	for _, filter := range filters {
+		switch d.resolve(filter) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			reader, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			// Keep what was inflated when the stream is truncated or its
+			// checksum is wrong, as viewers do.
+			decoded, err := io.ReadAll(reader)
+			if err != nil && len(decoded) == 0 {
+				return nil, err
+			}
+			data = decoded
+		default:
+			return nil, fmt.Errorf("unsupported stream filter %v", filter)
+		}
+	}
+	return data, nil
+}
+
+func (d *pdfDocument) firstPage() map[string]any {
+	for _, object := range d.objects {
+		dict, ok := object.value.(map[string]any)
+		if ok && dict["Type"] == pdfName("Catalog") {
+			if page := d.firstLeaf(dict["Pages"], 0); page != nil {
+				return page
+			}
+		}
+	}
+	// No usable catalog: take the lowest numbered page object.
+	lowest := -1
+	for number, object := range d.objects {
+		dict, ok := object.value.(map[string]any)
+		if ok && dict["Type"] == pdfName("Page") && (lowest < 0 || number < lowest) {
+			lowest = number
+		}
+	}
+	if lowest < 0 {
+		return nil
+	}
+	return d.objects[lowest].value.(map[string]any)
+}
+
+func (d *pdfDocument) firstLeaf(node any, depth int) map[string]any {
+	dict := d.dict(node)
+	if dict == nil || depth > 32 {
+		return nil
+	}
+	if dict["Type"] == pdfName("Page") {
+		return dict
+	}
+	kids, _ := d.resolve(dict["Kids"]).([]any)
+	for _, kid := range kids {
+		if page := d.firstLeaf(kid, depth+1); page != nil {
+			return page
+		}
+	}
+	return nil
+}
+
+// pages returns every page in document order.
+func (d *pdfDocument) pages() []map[string]any {
+	for _, object := range d.objects {
+		dict, ok := object.value.(map[string]any)
+		if ok && dict["Type"] == pdfName("Catalog") {
+			if pages := d.leaves(dict["Pages"], 0, nil); len(pages) > 0 {
+				return pages
+			}
+		}
+	}
+	numbers := []int{}
+	for number, object := range d.objects {
+		if dict, ok := object.value.(map[string]any); ok && dict["Type"] == pdfName("Page") {
+			numbers = append(numbers, number)
+		}
+	}
+	sort.Ints(numbers)
+	pages := []map[string]any{}
+	for _, number := range numbers {
+		pages = append(pages, d.objects[number].value.(map[string]any))
+	}
+	return pages
+}
+
+func (d *pdfDocument) leaves(node any, depth int, pages []map[string]any) []map[string]any {
+	dict := d.dict(node)
+	if dict == nil || depth > 32 {
+		return pages
+	}
+	if dict["Type"] == pdfName("Page") {
+		return append(pages, dict)
+	}
+	kids, _ := d.resolve(dict["Kids"]).([]any)
+	for _, kid := range kids {
+		pages = d.leaves(kid, depth+1, pages)
+	}
+	return pages
+}
+
+// inherited looks key up on the page and then on its ancestors.
+func (d *pdfDocument) inherited(page map[string]any, key string) any {
+	node := page
+	for depth := 0; node != nil && depth < 32; depth++ {
+		if value, ok := node[key]; ok {
+			return d.resolve(value)
+		}
+		node = d.dict(node["Parent"])
+	}
+	return nil
+}
+
+// pdfLexer reads PDF tokens and objects from data.
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+// dictEnd and arrayEnd mark closing delimiters in the token stream.
+type (
+	dictEnd  struct{}
+	arrayEnd struct{}
+)
+
+// token returns the next token; containers are returned fully parsed. It
+// returns nil at the end of data.
+func (l *pdfLexer) token() any {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isPDFSpace(c) {
+			l.pos++
+			continue
+		}
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		break
+	}
+	if l.pos >= len(l.data) {
+		return nil
+	}
+	c := l.data[l.pos]
+	switch {
+	case c == '/':
+		l.pos++
+		start := l.pos
+		for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+			l.pos++
+		}
+		return pdfName(decodeNameEscapes(string(l.data[start:l.pos])))
+	case c == '(':
+		return l.literalString()
+	case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+		l.pos += 2
+		dict := map[string]any{}
+		for {
+			key := l.token()
+			name, ok := key.(pdfName)
+			if !ok {
+				return dict // >> or malformed
+			}
+			dict[string(name)] = l.value()
+		}
+	case c == '<':
+		l.pos++
+		end := bytes.IndexByte(l.data[l.pos:], '>')
+		if end < 0 {
+			end = len(l.data) - l.pos
+		}
+		hex := bytes.Map(func(r rune) rune {
+			if isPDFSpace(byte(r)) {
+				return -1
+			}
+			return r
+		}, l.data[l.pos:l.pos+end])
+		l.pos += end + 1
+		if len(hex)%2 == 1 {
+			hex = append(hex, '0')
+		}
+		decoded := make([]byte, len(hex)/2)
+		for i := range decoded {
+			value, _ := strconv.ParseUint(string(hex[2*i:2*i+2]), 16, 8)
+			decoded[i] = byte(value)
+		}
+		return pdfString(decoded)
+	case c == '>' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '>':
+		l.pos += 2
+		return dictEnd{}
+	case c == '[':
+		l.pos++
+		list := []any{}
+		for {
+			item := l.valueOrEnd()
+			if _, done := item.(arrayEnd); done || item == nil {
+				return list
+			}
+			list = append(list, item)
+		}
+	case c == ']':
+		l.pos++
+		return arrayEnd{}
+	case isPDFDelimiter(c):
+		l.pos++
+		return pdfKeyword(string(c))
+	}
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	if number, err := strconv.ParseFloat(word, 64); err == nil {
+		return number
+	}
+	switch word {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	return pdfKeyword(word)
+}
+
+// valueOrEnd reads a value, turning "n g R" into a reference.
+func (l *pdfLexer) valueOrEnd() any {
+	token := l.token()
+	number, ok := token.(float64)
+	if !ok {
+		return token
+	}
+	saved := l.pos
+	if _, ok := l.token().(float64); ok {
+		if keyword, ok := l.token().(pdfKeyword); ok && keyword == "R" {
+			return pdfRef(int(number))
+		}
+	}
+	l.pos = saved
+	return number
+}
+
+func (l *pdfLexer) value() any {
+	value := l.valueOrEnd()
+	switch value.(type) {
+	case dictEnd, arrayEnd:
+		return nil
+	}
+	return value
+}
+
+func (l *pdfLexer) literalString() pdfString {
+	l.pos++ // (
+	var out []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return out
+			}
+			next := l.data[l.pos]
+			l.pos++
+			switch next {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			case '\n':
+			default:
+				if next >= '0' && next <= '7' {
+					value := int(next - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						value = value*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					out = append(out, byte(value))
+				} else {
+					out = append(out, next)
+				}
+			}
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func decodeNameEscapes(name string) string {
+	if !strings.Contains(name, "#") {
+		return name
+	}
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '#' && i+2 < len(name) {
+			if value, err := strconv.ParseUint(name[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(value))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
+
+// matrix is a PDF transformation [a b c d e f].
+type matrix [6]float64
+
+var identityMatrix = matrix{1, 0, 0, 1, 0, 0}
+
+// multiply returns m × n (apply m first, then n).
+func (m matrix) multiply(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func (m matrix) apply(x, y float64) (float64, float64) {
+	return x*m[0] + y*m[2] + m[4], x*m[1] + y*m[3] + m[5]
+}
+
+type pdfFont struct {
+	twoByte      bool
+	toUnicode    map[uint32]string
+	widths       map[uint32]float64 // glyph widths in 1/1000 text space units
+	defaultWidth float64
+}
+
+type graphicsState struct {
+	ctm                                     matrix
+	font                                    *pdfFont
+	size, charSpace, wordSpace, scale, lead float64
+	rise                                    float64
+}
+
+type textInterpreter struct {
+	doc    *pdfDocument
+	fonts  map[pdfRef]*pdfFont
+	runs   []TextRun
+	images []ImageBox
+}
+
+func (t *textInterpreter) run(content []byte, resources map[string]any, ctm matrix, depth int) {
+	if depth > 8 {
+		return
+	}
+	state := graphicsState{ctm: ctm, scale: 1}
+	stack := []graphicsState{}
+	tm, tlm := identityMatrix, identityMatrix
+	operands := []any{}
+	lexer := &pdfLexer{data: content}
+	number := func(i int) float64 {
+		if i < len(operands) {
+			value, _ := operands[i].(float64)
+			return value
+		}
+		return 0
+	}
+	moveLine := func(tx, ty float64) {
+		tlm = matrix{1, 0, 0, 1, tx, ty}.multiply(tlm)
+		tm = tlm
+	}
+	show := func(items []any) {
+		if state.font == nil {
+			return
+		}
+		trm := tm.multiply(state.ctm)
+		x, y := trm.apply(0, state.rise)
+		size := state.size * math.Hypot(trm[2], trm[3])
+		var text strings.Builder
+		for _, item := range items {
+			switch v := item.(type) {
+			case pdfString:
+				for _, glyph := range state.font.glyphs(v) {
+					text.WriteString(glyph.text)
+					advance := glyph.width/1000*state.size + state.charSpace
+					if glyph.space {
+						advance += state.wordSpace
+					}
+					tm = matrix{1, 0, 0, 1, advance * state.scale, 0}.multiply(tm)
+				}
+			case float64:
+				shift := -v / 1000 * state.size * state.scale
+				if v < -250 && !strings.HasSuffix(text.String(), " ") {
+					text.WriteByte(' ')
+				}
+				tm = matrix{1, 0, 0, 1, shift, 0}.multiply(tm)
+			}
+		}
+		endX, _ := tm.multiply(state.ctm).apply(0, state.rise)
+		t.runs = append(t.runs, TextRun{X: x, Y: y, EndX: endX, Size: size, Text: text.String()})
+	}
+	for {
+		token := lexer.valueOrEnd()
+		if token == nil && lexer.pos >= len(lexer.data) {
+			return
+		}
+		keyword, isOperator := token.(pdfKeyword)
+		if !isOperator {
+			operands = append(operands, token)
+			continue
+		}
+		switch keyword {
+		case "q":
+			stack = append(stack, state)
+		case "Q":
+			if len(stack) > 0 {
+				state = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		case "cm":
+			state.ctm = matrix{number(0), number(1), number(2), number(3), number(4), number(5)}.multiply(state.ctm)
+		case "BT":
+			tm, tlm = identityMatrix, identityMatrix
+		case "Tf":
+			if len(operands) >= 2 {
+				name, _ := operands[0].(pdfName)
+				state.font = t.font(resources, name)
+				state.size = number(1)
+			}
+		case "Tc":
+			state.charSpace = number(0)
+		case "Tw":
+			state.wordSpace = number(0)
+		case "Tz":
+			state.scale = number(0) / 100
+		case "TL":
+			state.lead = number(0)
+		case "Ts":
+			state.rise = number(0)
+		case "Td":
+			moveLine(number(0), number(1))
+		case "TD":
+			state.lead = -number(1)
+			moveLine(number(0), number(1))
+		case "Tm":
+			tlm = matrix{number(0), number(1), number(2), number(3), number(4), number(5)}
+			tm = tlm
+		case "T*":
+			moveLine(0, -state.lead)
+		case "Tj":
+			if len(operands) > 0 {
+				show(operands[len(operands)-1:])
+			}
+		case "TJ":
+			if len(operands) > 0 {
+				items, _ := operands[len(operands)-1].([]any)
+				show(items)
+			}
+		case "'", "\"":
+			if keyword == "\"" && len(operands) >= 3 {
+				state.wordSpace, state.charSpace = number(0), number(1)
+			}
+			moveLine(0, -state.lead)
+			if len(operands) > 0 {
+				show(operands[len(operands)-1:])
+			}
+		case "Do":
+			if len(operands) > 0 {
+				name, _ := operands[len(operands)-1].(pdfName)
+				t.form(resources, name, state.ctm, depth)
+			}
+		case "BI":
+			// Record the placement and skip the image data up to EI.
+			t.image(state.ctm)
+			if index := bytes.Index(lexer.data[lexer.pos:], []byte("ID")); index >= 0 {
+				lexer.pos += index + 2
+				for lexer.pos < len(lexer.data) {
+					index := bytes.Index(lexer.data[lexer.pos:], []byte("EI"))
+					if index < 0 {
+						lexer.pos = len(lexer.data)
+						break
+					}
+					lexer.pos += index + 2
+					if isPDFSpace(lexer.data[lexer.pos-3]) && (lexer.pos >= len(lexer.data) || isPDFSpace(lexer.data[lexer.pos])) {
+						break
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+func (t *textInterpreter) form(resources map[string]any, name pdfName, ctm matrix, depth int) {
+	xobjects := t.doc.dict(resources["XObject"])
+	ref, ok := xobjects[string(name)].(pdfRef)
+	if !ok {
+		return
+	}
+	object := t.doc.objects[int(ref)]
+	dict, _ := object.value.(map[string]any)
+	if dict != nil && dict["Subtype"] == pdfName("Image") {
+		t.image(ctm)
+		return
+	}
+	if dict == nil || dict["Subtype"] != pdfName("Form") {
+		return
+	}
+	content, err := t.doc.decode(dict, object.stream)
+	if err != nil {
+		return
+	}
+	if values, ok := t.doc.resolve(dict["Matrix"]).([]any); ok && len(values) == 6 {
+		var m matrix
+		for i := range m {
+			m[i] = t.doc.number(values[i])
+		}
+		ctm = m.multiply(ctm)
+	}
+	formResources := t.doc.dict(dict["Resources"])
+	if formResources == nil {
+		formResources = resources
+	}
+	t.run(content, formResources, ctm, depth+1)
+}
+
+// image records an image, which fills the unit square mapped through ctm.
+func (t *textInterpreter) image(ctm matrix) {
+	box := ImageBox{X0: math.Inf(1), Y0: math.Inf(1), X1: math.Inf(-1), Y1: math.Inf(-1)}
+	for _, corner := range [][2]float64{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+		x, y := ctm.apply(corner[0], corner[1])
+		box.X0, box.Y0 = math.Min(box.X0, x), math.Min(box.Y0, y)
+		box.X1, box.Y1 = math.Max(box.X1, x), math.Max(box.Y1, y)
+	}
+	t.images = append(t.images, box)
+}
+
+func (t *textInterpreter) font(resources map[string]any, name pdfName) *pdfFont {
+	fonts := t.doc.dict(resources["Font"])
+	key := fonts[string(name)]
+	if key == nil {
+		return &pdfFont{defaultWidth: 500}
+	}
+	ref, isRef := key.(pdfRef)
+	if font, ok := t.fonts[ref]; isRef && ok {
+		return font
+	}
+	dict := t.doc.dict(key)
+	font := &pdfFont{widths: map[uint32]float64{}, defaultWidth: 500}
+	if dict["Subtype"] == pdfName("Type0") {
+		font.twoByte = true
+		font.defaultWidth = 1000
+		if descendants, ok := t.doc.resolve(dict["DescendantFonts"]).([]any); ok && len(descendants) > 0 {
+			cid := t.doc.dict(descendants[0])
+			if dw, ok := t.doc.resolve(cid["DW"]).(float64); ok {
+				font.defaultWidth = dw
+			}
+			widths, _ := t.doc.resolve(cid["W"]).([]any)
+			for i := 0; i+1 < len(widths); {
+				first := uint32(t.doc.number(widths[i]))
+				if list, ok := t.doc.resolve(widths[i+1]).([]any); ok {
+					for j, width := range list {
+						font.widths[first+uint32(j)] = t.doc.number(width)
+					}
+					i += 2
+					continue
+				}
+				if i+2 >= len(widths) {
+					break
+				}
+				last, width := uint32(t.doc.number(widths[i+1])), t.doc.number(widths[i+2])
+				for code := first; code <= last && code-first < 65536; code++ {
+					font.widths[code] = width
+				}
+				i += 3
+			}
+		}
+	} else {
+		first := uint32(t.doc.number(dict["FirstChar"]))
+		widths, _ := t.doc.resolve(dict["Widths"]).([]any)
+		for i, width := range widths {
+			font.widths[first+uint32(i)] = t.doc.number(width)
+		}
+		if descriptor := t.doc.dict(dict["FontDescriptor"]); descriptor != nil {
+			if missing, ok := t.doc.resolve(descriptor["MissingWidth"]).(float64); ok && missing > 0 {
+				font.defaultWidth = missing
+			}
+		}
+	}
+	if cmap := t.doc.streamData(dict["ToUnicode"]); cmap != nil {
+		font.toUnicode = parseToUnicode(cmap)
+	}
+	if isRef {
+		t.fonts[ref] = font
+	}
+	return font
+}
+
+type pdfGlyph struct {
+	text  string
+	width float64
+	space bool
+}
+
+func (f *pdfFont) glyphs(s pdfString) []pdfGlyph {
+	glyphs := []pdfGlyph{}
+	step := 1
+	if f.twoByte {
+		step = 2
+	}
+	for i := 0; i+step <= len(s); i += step {
+		code := uint32(s[i])
+		if f.twoByte {
+			code = code<<8 | uint32(s[i+1])
+		}
+		text, ok := f.toUnicode[code]
+		if !ok {
+			if f.twoByte {
+				text = ""
+			} else {
+				text = winAnsi(byte(code))
+			}
+		}
+		width, ok := f.widths[code]
+		if !ok {
+			width = f.defaultWidth
+		}
+		glyphs = append(glyphs, pdfGlyph{text: text, width: width, space: !f.twoByte && code == ' '})
+	}
+	return glyphs
+}
+
+// winAnsiHigh maps the bytes 0x80-0x9F of WinAnsiEncoding; the rest of the
+// encoding matches Latin-1.
+var winAnsiHigh = []rune("€\u0081‚ƒ„…†‡ˆ‰Š‹Œ\u008dŽ\u008f\u0090‘’“”•–—˜™š›œ\u009džŸ")
+
+func winAnsi(c byte) string {
+	if c >= 0x80 && c <= 0x9F {
+		return string(winAnsiHigh[c-0x80])
+	}
+	return string(rune(c))
+}
+
+// parseToUnicode reads the bfchar and bfrange sections of a ToUnicode CMap.
+func parseToUnicode(cmap []byte) map[uint32]string {
+	mapping := map[uint32]string{}
+	lexer := &pdfLexer{data: cmap}
+	code := func(value any) (uint32, bool) {
+		s, ok := value.(pdfString)
+		if !ok || len(s) == 0 || len(s) > 4 {
+			return 0, false
+		}
+		var c uint32
+		for _, b := range s {
+			c = c<<8 | uint32(b)
+		}
+		return c, true
+	}
+	for {
+		token := lexer.token()
+		if token == nil {
+			return mapping
+		}
+		switch token {
+		case pdfKeyword("beginbfchar"):
+			for {
+				source := lexer.token()
+				if source == pdfKeyword("endbfchar") || source == nil {
+					break
+				}
+				target, _ := lexer.token().(pdfString)
+				if c, ok := code(source); ok {
+					mapping[c] = utf16BE(target)
+				}
+			}
+		case pdfKeyword("beginbfrange"):
+			for {
+				low := lexer.token()
+				if low == pdfKeyword("endbfrange") || low == nil {
+					break
+				}
+				high, target := lexer.token(), lexer.token()
+				first, ok1 := code(low)
+				last, ok2 := code(high)
+				if !ok1 || !ok2 || last < first || last-first > 65535 {
+					continue
+				}
+				switch target := target.(type) {
+				case pdfString:
+					base := []rune(utf16BE(target))
+					if len(base) == 0 {
+						continue
+					}
+					for c := first; c <= last; c++ {
+						runes := append([]rune{}, base...)
+						runes[len(runes)-1] += rune(c - first)
+						mapping[c] = string(runes)
+					}
+				case []any:
+					for i, item := range target {
+						if s, ok := item.(pdfString); ok && first+uint32(i) <= last {
+							mapping[first+uint32(i)] = utf16BE(s)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func utf16BE(s []byte) string {
+	units := make([]uint16, 0, len(s)/2)
+	for i := 0; i+1 < len(s); i += 2 {
+		units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
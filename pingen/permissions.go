@@ -0,0 +1,63 @@
+package pingen
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// HasSecrets reports whether cfg holds credentials worth protecting.
+func (c Config) HasSecrets() bool {
+	return c.AccessToken != "" || c.ClientSecret != "" || c.RefreshToken != ""
+}
+
+// InsecureFile reports whether path is readable by group or others. Windows
+// ACLs are not inspected, so it always reports false there.
+func InsecureFile(path string) (os.FileMode, bool) {
+	if runtime.GOOS == "windows" {
+		return 0, false
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, false
+	}
+	mode := info.Mode().Perm()
+	return mode, mode&0o077 != 0
+}
+
+// InsecureDir reports whether dir is writable by group or others, letting
+// them replace files inside it. Sticky directories such as /tmp are fine:
+// only the owner may rename or delete their files there.
+func InsecureDir(dir string) (os.FileMode, bool) {
+	if runtime.GOOS == "windows" {
+		return 0, false
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return 0, false
+	}
+	mode := info.Mode().Perm()
+	return mode, mode&0o022 != 0 && info.Mode()&os.ModeSticky == 0
+}
+
+// FixConfigPermissions restricts the config file to its owner. The parent
+// directory is only tightened when it is the CLI's own "pingen" directory,
+// never a shared directory chosen via PINGEN_CONFIG_PATH. It returns the
+// paths that were changed.
+func FixConfigPermissions(path string) ([]string, error) {
+	changed := []string{}
+	if _, insecure := InsecureFile(path); insecure {
+		if err := os.Chmod(path, 0o600); err != nil {
+			return changed, err
+		}
+		changed = append(changed, path)
+	}
+	dir := filepath.Dir(path)
+	if _, insecure := InsecureDir(dir); insecure && filepath.Base(dir) == "pingen" {
+		if err := os.Chmod(dir, 0o700); err != nil {
+			return changed, err
+		}
+		changed = append(changed, dir)
+	}
+	return changed, nil
+}
@@ -0,0 +1,154 @@
+package pingen
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TaskError is the failure of one task of RunPool.
+type TaskError struct {
+	Index int
+	Err   error
+}
+
+func (e TaskError) Error() string {
+	return fmt.Sprintf("task %d: %v", e.Index, e.Err)
+}
+
+func (e TaskError) Unwrap() error { return e.Err }
+
+// PoolError collects the failures of a RunPool run in task order. Skipped
+// counts the tasks that were not started because the context ended.
+type PoolError struct {
+	Failed  []TaskError
+	Skipped int
+	Total   int
+}
+
+func (e *PoolError) Error() string {
+	message := fmt.Sprintf("%d of %d tasks failed", len(e.Failed), e.Total)
+	if e.Skipped > 0 {
+		message += fmt.Sprintf(", %d not started", e.Skipped)
+	}
+	if len(e.Failed) > 0 {
+		message += ": " + e.Failed[0].Error()
+		if len(e.Failed) > 1 {
+			message += fmt.Sprintf(" (and %d more)", len(e.Failed)-1)
+		}
+	}
+	return message
+}
+
+func (e *PoolError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, failed := range e.Failed {
+		errs = append(errs, failed)
+	}
+	return errs
+}
+
+// RunPool runs task for the indices 0..n-1 on at most workers goroutines.
+// Once ctx ends no further tasks are started; tasks already running are
+// waited for. It returns nil when every task succeeded and a *PoolError
+// otherwise.
+func RunPool(ctx context.Context, workers, n int, task func(ctx context.Context, i int) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+	errs := make([]error, n)
+	started := make([]bool, n)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				errs[i] = task(ctx, i)
+			}
+		}()
+	}
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		started[i] = true
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	result := &PoolError{Total: n}
+	for i := range errs {
+		switch {
+		case !started[i]:
+			result.Skipped++
+		case errs[i] != nil:
+			result.Failed = append(result.Failed, TaskError{Index: i, Err: errs[i]})
+		}
+	}
+	if len(result.Failed) == 0 && result.Skipped == 0 {
+		return nil
+	}
+	return result
+}
+
+// LetterUpload is a PDF to turn into a letter with CreateLettersFromFiles.
+type LetterUpload struct {
+	Path string
+	// Attributes are the create attributes; file_url and
+	// file_url_signature are filled in after the upload.
+	Attributes     map[string]any
+	IdempotencyKey string
+}
+
+// CreateLetterFromFileRaw requests an upload URL, uploads the PDF at path and
+// creates a letter from it in orgID.
+func (c Client) CreateLetterFromFileRaw(ctx context.Context, orgID string, upload LetterUpload, uploadTimeout time.Duration) (map[string]any, error) {
+	uploadURL, signature, _, err := c.GetFileUpload(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.UploadFile(ctx, uploadURL, upload.Path, uploadTimeout); err != nil {
+		return nil, err
+	}
+	upload.Attributes["file_url"] = uploadURL
+	upload.Attributes["file_url_signature"] = signature
+	payload := map[string]any{"data": map[string]any{"type": "letters", "attributes": upload.Attributes}}
+	letter, _, err := c.CreateLetterRaw(ctx, orgID, payload, upload.IdempotencyKey)
+	return letter, err
+}
+
+// CreateLettersFromFilesRaw creates a letter for every upload, with up to
+// workers files requested, uploaded and created at the same time. done is
+// called after each upload with its index and outcome, from one goroutine at
+// a time. The result is RunPool's: nil, or a *PoolError with the indices of
+// the failed uploads.
+func (c Client) CreateLettersFromFilesRaw(ctx context.Context, orgID string, uploads []LetterUpload, workers int, uploadTimeout time.Duration, done func(i int, letter map[string]any, err error)) error {
+	var mu sync.Mutex
+	return RunPool(ctx, workers, len(uploads), func(ctx context.Context, i int) error {
+		letter, err := c.CreateLetterFromFileRaw(ctx, orgID, uploads[i], uploadTimeout)
+		if done != nil {
+			mu.Lock()
+			done(i, letter, err)
+			mu.Unlock()
+		}
+		return err
+	})
+}
+
+// CreateLettersFromFiles is CreateLettersFromFilesRaw with the created
+// letters decoded.
+func (c Client) CreateLettersFromFiles(ctx context.Context, orgID string, uploads []LetterUpload, workers int, uploadTimeout time.Duration, done func(i int, letter Letter, err error)) error {
+	return c.CreateLettersFromFilesRaw(ctx, orgID, uploads, workers, uploadTimeout, func(i int, payload map[string]any, err error) {
+		letter, err := decodeData[Letter](payload, nil, err)
+		if done != nil {
+			done(i, letter, err)
+		}
+	})
+}
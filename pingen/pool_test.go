@@ -0,0 +1,118 @@
+package pingen
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRunPool(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name        string
+		workers     int
+		n           int
+		fail        map[int]bool
+		wantFailed  []int
+		wantSkipped int
+	}{
+		{name: "all succeed", workers: 3, n: 10},
+		{name: "no tasks", workers: 3, n: 0},
+		{name: "zero workers run serially", workers: 0, n: 4},
+		{name: "failures in task order", workers: 4, n: 8, fail: map[int]bool{6: true, 1: true, 3: true}, wantFailed: []int{1, 3, 6}},
+		{name: "single worker", workers: 1, n: 3, fail: map[int]bool{2: true}, wantFailed: []int{2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ran int32
+			err := RunPool(context.Background(), tt.workers, tt.n, func(ctx context.Context, i int) error {
+				atomic.AddInt32(&ran, 1)
+				if tt.fail[i] {
+					return errFailed
+				}
+				return nil
+			})
+			if got := int(atomic.LoadInt32(&ran)); got != tt.n {
+				t.Errorf("ran %d tasks, want %d", got, tt.n)
+			}
+			if len(tt.wantFailed) == 0 {
+				if err != nil {
+					t.Fatalf("RunPool() = %v, want nil", err)
+				}
+				return
+			}
+			var poolErr *PoolError
+			if !errors.As(err, &poolErr) {
+				t.Fatalf("RunPool() = %v, want *PoolError", err)
+			}
+			if poolErr.Total != tt.n || poolErr.Skipped != tt.wantSkipped {
+				t.Errorf("Total, Skipped = %d, %d; want %d, %d", poolErr.Total, poolErr.Skipped, tt.n, tt.wantSkipped)
+			}
+			if len(poolErr.Failed) != len(tt.wantFailed) {
+				t.Fatalf("Failed = %v, want indices %v", poolErr.Failed, tt.wantFailed)
+			}
+			for i, failed := range poolErr.Failed {
+				if failed.Index != tt.wantFailed[i] {
+					t.Errorf("Failed[%d].Index = %d, want %d", i, failed.Index, tt.wantFailed[i])
+				}
+			}
+			if !errors.Is(err, errFailed) {
+				t.Errorf("errors.Is(%v, errFailed) = false", err)
+			}
+		})
+	}
+}
+
+func TestRunPoolWorkerLimit(t *testing.T) {
+	const workers = 3
+	var running, peak int32
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- RunPool(context.Background(), workers, 12, func(ctx context.Context, i int) error {
+			now := atomic.AddInt32(&running, 1)
+			for {
+				old := atomic.LoadInt32(&peak)
+				if now <= old || atomic.CompareAndSwapInt32(&peak, old, now) {
+					break
+				}
+			}
+			<-release
+			atomic.AddInt32(&running, -1)
+			return nil
+		})
+	}()
+	for i := 0; i < 12; i++ {
+		release <- struct{}{}
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("RunPool() = %v", err)
+	}
+	if got := atomic.LoadInt32(&peak); got > workers {
+		t.Errorf("%d tasks ran at once, want at most %d", got, workers)
+	}
+}
+
+func TestRunPoolStopsWhenContextEnds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var ran int32
+	err := RunPool(ctx, 1, 5, func(ctx context.Context, i int) error {
+		atomic.AddInt32(&ran, 1)
+		if i == 1 {
+			cancel()
+		}
+		return nil
+	})
+	var poolErr *PoolError
+	if !errors.As(err, &poolErr) {
+		t.Fatalf("RunPool() = %v, want *PoolError", err)
+	}
+	if len(poolErr.Failed) != 0 {
+		t.Errorf("Failed = %v, want none", poolErr.Failed)
+	}
+	if got := atomic.LoadInt32(&ran); int(got)+poolErr.Skipped != 5 || poolErr.Skipped < 2 {
+		t.Errorf("ran %d tasks with %d skipped, want at least the last 2 of 5 skipped", got, poolErr.Skipped)
+	}
+}
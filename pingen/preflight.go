@@ -0,0 +1,160 @@
+package pingen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+// DefaultMaxUploadSize caps uploads when the config sets no max_upload_size.
+const DefaultMaxUploadSize = 20 << 20
+
+// pdfHeaderWindow is how far into the file the %PDF- marker may appear;
+// readers tolerate leading garbage within the first kilobyte.
+const pdfHeaderWindow = 1024
+
+// pdfTrailerWindow is how much of the end of the file is searched for the
+// trailer (/Encrypt) and the %%EOF marker.
+const pdfTrailerWindow = 4096
+
+// PDFError reports a file Pingen cannot print: not a PDF, empty, too large,
+// truncated or encrypted, or with pages that cannot be read.
+type PDFError struct {
+	err error
+}
+
+func (err PDFError) Error() string { return err.err.Error() }
+
+func (err PDFError) Unwrap() error { return err.err }
+
+func pdfErrorf(format string, args ...any) error {
+	return PDFError{err: fmt.Errorf(format, args...)}
+}
+
+// FileError reports a local file that does not exist or cannot be read.
+type FileError struct {
+	err error
+}
+
+func (err FileError) Error() string { return err.err.Error() }
+
+func (err FileError) Unwrap() error { return err.err }
+
+// knownSignatures name common non-PDF formats for clearer errors.
+var knownSignatures = []struct {
+	magic []byte
+	name  string
+}{
+	{[]byte("PK\x03\x04"), "a ZIP archive or Office document (DOCX/XLSX)"},
+	{[]byte("\xD0\xCF\x11\xE0"), "a legacy Office document (DOC/XLS)"},
+	{[]byte("\x89PNG"), "a PNG image"},
+	{[]byte("\xFF\xD8\xFF"), "a JPEG image"},
+	{[]byte("{\\rtf"), "an RTF document"},
+	{[]byte("<!DOCTYPE html"), "an HTML page"},
+	{[]byte("<html"), "an HTML page"},
+}
+
+// PreflightPDF checks that path is a non-empty, complete and unencrypted PDF
+// of at most maxSize bytes before anything is uploaded.
+func PreflightPDF(path string, maxSize int64) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return FileError{err: err}
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return FileError{err: err}
+	}
+	if info.IsDir() {
+		return pdfErrorf("file is not a PDF: %s is a directory", path)
+	}
+	if info.Size() == 0 {
+		return pdfErrorf("file is empty: %s", path)
+	}
+	if maxSize > 0 && info.Size() > maxSize {
+		return pdfErrorf("file is too large: %s is %s, the maximum is %s (max_upload_size)", path, FormatSize(info.Size()), FormatSize(maxSize))
+	}
+	head := make([]byte, pdfHeaderWindow)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	head = head[:n]
+	if bytes.Contains(head, []byte("%PDF-")) {
+		return checkPDFTrailer(file, path, info.Size())
+	}
+	for _, signature := range knownSignatures {
+		if bytes.HasPrefix(head, signature.magic) {
+			return pdfErrorf("file is not a PDF: %s looks like %s", path, signature.name)
+		}
+	}
+	return pdfErrorf("file is not a PDF: %s has no %%PDF- header", path)
+}
+
+// checkPDFTrailer rejects files cut short by an interrupted download or copy
+// (no %%EOF marker) and password-protected files, which Pingen cannot print.
+func checkPDFTrailer(file *os.File, path string, size int64) error {
+	offset := size - pdfTrailerWindow
+	if offset < 0 {
+		offset = 0
+	}
+	tail := make([]byte, size-offset)
+	if _, err := file.ReadAt(tail, offset); err != nil && err != io.EOF {
+		return err
+	}
+	if !bytes.Contains(tail, []byte("%%EOF")) {
+		return pdfErrorf("file is truncated: %s has no %%%%EOF marker (incomplete download or copy?)", path)
+	}
+	if bytes.Contains(tail, []byte("/Encrypt")) {
+		return pdfErrorf("file is encrypted: %s is password-protected or has permission restrictions; save an unprotected copy", path)
+	}
+	return nil
+}
+
+var (
+	pdfPageObject = regexp.MustCompile(`/Type\s*/Page[^s]`)
+	pdfPageCount  = regexp.MustCompile(`/Type\s*/Pages\b[^>]*?/Count\s+(\d+)|/Count\s+(\d+)[^>]*?/Type\s*/Pages\b`)
+)
+
+// CountPDFPages returns the number of pages of the PDF at path. It reads the
+// /Count of the page tree and falls back to counting page objects; documents
+// whose page tree sits in a compressed object stream cannot be counted.
+func CountPDFPages(path string) (int, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, FileError{err: err}
+	}
+	pages := 0
+	for _, match := range pdfPageCount.FindAllSubmatch(content, -1) {
+		digits := match[1]
+		if len(digits) == 0 {
+			digits = match[2]
+		}
+		// Intermediate page tree nodes count their subtree; the root is largest.
+		if count, err := strconv.Atoi(string(digits)); err == nil && count > pages {
+			pages = count
+		}
+	}
+	if pages == 0 {
+		pages = len(pdfPageObject.FindAll(content, -1))
+	}
+	if pages == 0 {
+		return 0, pdfErrorf("could not count the pages of %s", path)
+	}
+	return pages, nil
+}
+
+// FormatSize renders a byte count for messages, e.g. "1.5 MB".
+func FormatSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d bytes", size)
+}
@@ -0,0 +1,113 @@
+package pingen
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ProjectConfigNames are the file names of a project config, in the order
+// they are looked for in each directory.
+var ProjectConfigNames = []string{".pingen.json", ".pingen.yaml", ".pingen.yml"}
+
+// hookFlags are flags that run shell commands; a project config cannot set
+// defaults or templates for them.
+var hookFlags = []string{"on-success", "on-failure", "exec"}
+
+// FindProjectConfig returns the project config in dir or the closest of its
+// parents, or "" when there is none.
+func FindProjectConfig(dir string) string {
+	for {
+		for _, name := range ProjectConfigNames {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// LoadProjectConfig reads a project config (JSON, or YAML for .yaml/.yml).
+// A project config is usually committed with a repository, so settings that
+// a checkout must not control are dropped and listed in ignored: the API and
+// identity endpoints, secrets and their storage, schedules, and hook commands
+// in defaults and letter templates.
+func LoadProjectConfig(path string) (cfg Config, ignored []string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, nil, err
+	}
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		document, err := ParseYAML(data)
+		if err != nil {
+			return Config{}, nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if document == nil {
+			return Config{}, nil, nil
+		}
+		if _, ok := document.(map[string]any); !ok {
+			return Config{}, nil, fmt.Errorf("%s: expected a mapping of settings", path)
+		}
+		if data, err = json.Marshal(document); err != nil {
+			return Config{}, nil, err
+		}
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Config{}, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, field := range []struct {
+		name  string
+		value *string
+	}{
+		{"api_base", &cfg.APIBase},
+		{"identity_base", &cfg.IdentityBase},
+		{"access_token", &cfg.AccessToken},
+		{"access_token_scope", &cfg.AccessTokenScope},
+		{"refresh_token", &cfg.RefreshToken},
+		{"client_secret", &cfg.ClientSecret},
+		{"credential_store", &cfg.CredentialStore},
+	} {
+		if *field.value != "" {
+			ignored = append(ignored, field.name)
+			*field.value = ""
+		}
+	}
+	if cfg.AccessTokenExpiresAt != 0 {
+		ignored = append(ignored, "access_token_expires_at")
+		cfg.AccessTokenExpiresAt = 0
+	}
+	if len(cfg.KeychainSecrets) > 0 {
+		ignored = append(ignored, "keychain_secrets")
+		cfg.KeychainSecrets = nil
+	}
+	if len(cfg.Schedules) > 0 {
+		ignored = append(ignored, "schedules")
+		cfg.Schedules = nil
+	}
+	for _, group := range []struct {
+		name  string
+		flags map[string]map[string]string
+	}{
+		{"defaults", cfg.Defaults},
+		{"letter_templates", cfg.LetterTemplates},
+	} {
+		for entry, flags := range group.flags {
+			for _, flag := range hookFlags {
+				if _, ok := flags[flag]; ok {
+					ignored = append(ignored, fmt.Sprintf("%s.%s.%s", group.name, entry, flag))
+					delete(flags, flag)
+				}
+			}
+		}
+	}
+	sort.Strings(ignored)
+	return cfg, ignored, nil
+}
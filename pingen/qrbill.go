@@ -0,0 +1,79 @@
+package pingen
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ValidIBAN checks the ISO 13616 check digits of iban; spaces are ignored.
+func ValidIBAN(iban string) bool {
+	compact := strings.ToUpper(strings.ReplaceAll(iban, " ", ""))
+	if len(compact) < 15 || len(compact) > 34 {
+		return false
+	}
+	return mod97(compact[4:]+compact[:4]) == 1
+}
+
+// IsQRIBAN reports whether a Swiss or Liechtenstein IBAN is a QR-IBAN, whose
+// institution id lies between 30000 and 31999. QR-IBANs require a QR
+// reference.
+func IsQRIBAN(iban string) bool {
+	compact := strings.ToUpper(strings.ReplaceAll(iban, " ", ""))
+	if len(compact) != 21 || (!strings.HasPrefix(compact, "CH") && !strings.HasPrefix(compact, "LI")) {
+		return false
+	}
+	iid := compact[4:9]
+	return iid >= "30000" && iid <= "31999"
+}
+
+// ValidQRReference checks the 27-digit QR reference and its modulo 10
+// recursive check digit.
+func ValidQRReference(reference string) bool {
+	compact := strings.ReplaceAll(reference, " ", "")
+	if len(compact) != 27 {
+		return false
+	}
+	table := [10]int{0, 9, 4, 6, 8, 2, 7, 1, 3, 5}
+	carry := 0
+	for i, r := range compact {
+		if r < '0' || r > '9' {
+			return false
+		}
+		if i == len(compact)-1 {
+			return (10-carry)%10 == int(r-'0')
+		}
+		carry = table[(carry+int(r-'0'))%10]
+	}
+	return false
+}
+
+// ValidCreditorReference checks an ISO 11649 creditor reference (RF...).
+func ValidCreditorReference(reference string) bool {
+	compact := strings.ToUpper(strings.ReplaceAll(reference, " ", ""))
+	if len(compact) < 5 || len(compact) > 25 || !strings.HasPrefix(compact, "RF") {
+		return false
+	}
+	return mod97(compact[4:]+compact[:4]) == 1
+}
+
+// mod97 converts letters to numbers (A=10 ... Z=35) and returns the value
+// modulo 97, or -1 for other characters.
+func mod97(value string) int64 {
+	var digits strings.Builder
+	for _, r := range value {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r >= 'A' && r <= 'Z':
+			digits.WriteString(strconv.Itoa(int(r-'A') + 10))
+		default:
+			return -1
+		}
+	}
+	number, ok := new(big.Int).SetString(digits.String(), 10)
+	if !ok {
+		return -1
+	}
+	return new(big.Int).Mod(number, big.NewInt(97)).Int64()
+}
@@ -0,0 +1,54 @@
+package pingen
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimit is the request budget reported in response headers.
+type RateLimit struct {
+	Limit      int           `json:"limit"`
+	Remaining  int           `json:"remaining"`
+	Reset      time.Time     `json:"reset,omitempty"`
+	RetryAfter time.Duration `json:"retry_after,omitempty"`
+	// Known is false when the response carried no rate-limit headers.
+	Known bool `json:"known"`
+}
+
+// ParseRateLimit reads the X-Rate-Limit-* (or X-RateLimit-*) and Retry-After
+// headers of a response.
+func ParseRateLimit(headers http.Header) RateLimit {
+	var limit RateLimit
+	if headers == nil {
+		return limit
+	}
+	if value, ok := headerInt(headers, "X-Rate-Limit-Limit", "X-RateLimit-Limit"); ok {
+		limit.Limit = int(value)
+		limit.Known = true
+	}
+	if value, ok := headerInt(headers, "X-Rate-Limit-Remaining", "X-RateLimit-Remaining"); ok {
+		limit.Remaining = int(value)
+		limit.Known = true
+	}
+	if value, ok := headerInt(headers, "X-Rate-Limit-Reset", "X-RateLimit-Reset"); ok {
+		limit.Reset = time.Unix(value, 0)
+		limit.Known = true
+	}
+	if value, ok := headerInt(headers, "Retry-After"); ok {
+		limit.RetryAfter = time.Duration(value) * time.Second
+	}
+	return limit
+}
+
+func headerInt(headers http.Header, names ...string) (int64, bool) {
+	for _, name := range names {
+		if value := headers.Get(name); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err == nil {
+				return parsed, true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,556 @@
+package pingen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// The typed resources below cover the attributes documented in the API
+// reference. Every resource keeps the complete JSON:API object in Raw, so
+// attributes that Pingen adds later, or that are not listed here, stay
+// available; Decode turns the map payloads of the Raw Client methods into
+// these types.
+
+// Resource holds the members that every JSON:API resource object has.
+type Resource struct {
+	ID            string                  `json:"id"`
+	Type          string                  `json:"type"`
+	Relationships map[string]Relationship `json:"relationships,omitempty"`
+	Links         map[string]any          `json:"links,omitempty"`
+	Meta          map[string]any          `json:"meta,omitempty"`
+	// Raw is the resource object as received.
+	Raw json.RawMessage `json:"-"`
+}
+
+// ResourceIdentifier is the type and id of a related resource.
+type ResourceIdentifier struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+// Relationship is a relationship of a resource. Data is a single resource
+// identifier, a list of them or null; use ID or Identifiers to read it.
+type Relationship struct {
+	Data  json.RawMessage `json:"data,omitempty"`
+	Links map[string]any  `json:"links,omitempty"`
+}
+
+// Identifiers returns the related resources, or nil when there are none.
+func (r Relationship) Identifiers() []ResourceIdentifier {
+	data := bytes.TrimSpace(r.Data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if data[0] == '[' {
+		var list []ResourceIdentifier
+		if json.Unmarshal(data, &list) != nil {
+			return nil
+		}
+		return list
+	}
+	var single ResourceIdentifier
+	if json.Unmarshal(data, &single) != nil || single.ID == "" {
+		return nil
+	}
+	return []ResourceIdentifier{single}
+}
+
+// ID returns the id of a to-one relationship, or "".
+func (r Relationship) ID() string {
+	if ids := r.Identifiers(); len(ids) == 1 {
+		return ids[0].ID
+	}
+	return ""
+}
+
+// RelatedID returns the id of the resource related as name, or "".
+func (r Resource) RelatedID(name string) string {
+	return r.Relationships[name].ID()
+}
+
+// Letter is a letter resource.
+type Letter struct {
+	Resource
+	Attributes LetterAttributes `json:"attributes"`
+}
+
+type LetterAttributes struct {
+	Status           string         `json:"status"`
+	FileOriginalName string         `json:"file_original_name"`
+	FilePages        int            `json:"file_pages"`
+	Address          string         `json:"address"`
+	AddressPosition  string         `json:"address_position"`
+	Country          string         `json:"country"`
+	DeliveryProduct  string         `json:"delivery_product"`
+	PrintMode        string         `json:"print_mode"`
+	PrintSpectrum    string         `json:"print_spectrum"`
+	PriceCurrency    string         `json:"price_currency"`
+	PriceValue       json.Number    `json:"price_value"`
+	PaperTypes       []string       `json:"paper_types"`
+	Fonts            []any          `json:"fonts"`
+	Source           string         `json:"source"`
+	TrackingNumber   string         `json:"tracking_number"`
+	MetaData         map[string]any `json:"meta_data,omitempty"`
+	SubmittedAt      Timestamp      `json:"submitted_at"`
+	CreatedAt        Timestamp      `json:"created_at"`
+	UpdatedAt        Timestamp      `json:"updated_at"`
+}
+
+// Organisation is an organisation resource.
+type Organisation struct {
+	Resource
+	Attributes OrganisationAttributes `json:"attributes"`
+}
+
+type OrganisationAttributes struct {
+	Name                      string      `json:"name"`
+	Status                    string      `json:"status"`
+	Plan                      string      `json:"plan"`
+	BillingMode               string      `json:"billing_mode"`
+	BillingCurrency           string      `json:"billing_currency"`
+	BillingBalance            json.Number `json:"billing_balance"`
+	MissingCredits            json.Number `json:"missing_credits"`
+	Edition                   string      `json:"edition"`
+	DefaultCountry            string      `json:"default_country"`
+	DefaultAddressPosition    string      `json:"default_address_position"`
+	DataRetentionAddresses    int         `json:"data_retention_addresses"`
+	DataRetentionPDF          int         `json:"data_retention_pdf"`
+	LimitsMonthlyLettersCount int         `json:"limits_monthly_letters_count"`
+	Color                     string      `json:"color"`
+	Flags                     []string    `json:"flags"`
+	CreatedAt                 Timestamp   `json:"created_at"`
+	UpdatedAt                 Timestamp   `json:"updated_at"`
+}
+
+// Batch is a batch resource.
+type Batch struct {
+	Resource
+	Attributes BatchAttributes `json:"attributes"`
+}
+
+type BatchAttributes struct {
+	Name             string      `json:"name"`
+	Icon             string      `json:"icon"`
+	Status           string      `json:"status"`
+	FileOriginalName string      `json:"file_original_name"`
+	LetterCount      int         `json:"letter_count"`
+	AddressPosition  string      `json:"address_position"`
+	PrintMode        string      `json:"print_mode"`
+	PrintSpectrum    string      `json:"print_spectrum"`
+	PriceCurrency    string      `json:"price_currency"`
+	PriceValue       json.Number `json:"price_value"`
+	Source           string      `json:"source"`
+	SubmittedAt      Timestamp   `json:"submitted_at"`
+	CreatedAt        Timestamp   `json:"created_at"`
+	UpdatedAt        Timestamp   `json:"updated_at"`
+}
+
+// Webhook is a webhook subscription resource.
+type Webhook struct {
+	Resource
+	Attributes WebhookAttributes `json:"attributes"`
+}
+
+type WebhookAttributes struct {
+	EventCategory string `json:"event_category"`
+	URL           string `json:"url"`
+	SigningKey    string `json:"signing_key"`
+}
+
+// DeliveryProduct is a delivery product of the organisation.
+type DeliveryProduct struct {
+	Resource
+	Attributes DeliveryProductAttributes `json:"attributes"`
+}
+
+type DeliveryProductAttributes struct {
+	Countries         []string    `json:"countries"`
+	Name              string      `json:"name"`
+	FullName          string      `json:"full_name"`
+	DeliveryTimeDays  []int       `json:"delivery_time_days"`
+	Features          []string    `json:"features"`
+	PriceCurrency     string      `json:"price_currency"`
+	PriceStartingFrom json.Number `json:"price_starting_from"`
+}
+
+// User is the user an access token was issued for.
+type User struct {
+	Resource
+	Attributes UserAttributes `json:"attributes"`
+}
+
+type UserAttributes struct {
+	Email     string    `json:"email"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Status    string    `json:"status"`
+	Language  string    `json:"language"`
+	Edition   string    `json:"edition"`
+	Flags     []string  `json:"flags"`
+	CreatedAt Timestamp `json:"created_at"`
+	UpdatedAt Timestamp `json:"updated_at"`
+}
+
+// Association is the membership of a user in an organisation. Its user and
+// organisation are relationships.
+type Association struct {
+	Resource
+	Attributes AssociationAttributes `json:"attributes"`
+}
+
+type AssociationAttributes struct {
+	Role      string    `json:"role"`
+	Status    string    `json:"status"`
+	CreatedAt Timestamp `json:"created_at"`
+	UpdatedAt Timestamp `json:"updated_at"`
+}
+
+// Event is a letter or batch event, e.g. a delivery confirmation.
+type Event struct {
+	Resource
+	Attributes EventAttributes `json:"attributes"`
+}
+
+type EventAttributes struct {
+	Code     string   `json:"code"`
+	Name     string   `json:"name"`
+	Producer string   `json:"producer"`
+	Location string   `json:"location"`
+	HasImage bool     `json:"has_image"`
+	Data     []string `json:"data"`
+	// EmittedAt is when the event happened, CreatedAt when Pingen recorded it.
+	EmittedAt Timestamp `json:"emitted_at"`
+	CreatedAt Timestamp `json:"created_at"`
+	UpdatedAt Timestamp `json:"updated_at"`
+}
+
+// Price is the result of the letter price calculator.
+type Price struct {
+	Resource
+	Attributes PriceAttributes `json:"attributes"`
+}
+
+type PriceAttributes struct {
+	Currency string      `json:"currency"`
+	Price    json.Number `json:"price"`
+}
+
+// TokenResponse is the response of the token endpoint.
+type TokenResponse struct {
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	// Raw is the response as received.
+	Raw json.RawMessage `json:"-"`
+}
+
+// ExpiresAt returns when the token expires, counted from issued, or the zero
+// time when the response has no expiry.
+func (t TokenResponse) ExpiresAt(issued time.Time) time.Time {
+	if t.ExpiresIn <= 0 {
+		return time.Time{}
+	}
+	return issued.Add(time.Duration(t.ExpiresIn) * time.Second)
+}
+
+// Document is a JSON:API response with a single resource.
+type Document[T any] struct {
+	Data     T                `json:"data"`
+	Included []map[string]any `json:"included,omitempty"`
+	Links    map[string]any   `json:"links,omitempty"`
+	Meta     map[string]any   `json:"meta,omitempty"`
+}
+
+// List is a JSON:API response with a page of resources.
+type List[T any] struct {
+	Data     []T              `json:"data"`
+	Included []map[string]any `json:"included,omitempty"`
+	Links    map[string]any   `json:"links,omitempty"`
+	Meta     map[string]any   `json:"meta,omitempty"`
+}
+
+// Timestamp is a time attribute. Pingen sends ISO 8601 times with a numeric
+// offset without a colon ("2006-01-02T15:04:05-0700"); RFC 3339 is accepted
+// as well, and null or "" leave the zero time.
+type Timestamp struct {
+	time.Time
+}
+
+var timestampLayouts = []string{"2006-01-02T15:04:05-0700", time.RFC3339Nano}
+
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	var value *string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	t.Time = time.Time{}
+	if value == nil || *value == "" {
+		return nil
+	}
+	for _, layout := range timestampLayouts {
+		if parsed, err := time.Parse(layout, *value); err == nil {
+			t.Time = parsed
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid timestamp %q", *value)
+}
+
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(t.Format(timestampLayouts[0]))
+}
+
+func (l *Letter) UnmarshalJSON(data []byte) error {
+	type plain Letter
+	return unmarshalRaw(data, (*plain)(l), &l.Raw)
+}
+
+func (o *Organisation) UnmarshalJSON(data []byte) error {
+	type plain Organisation
+	return unmarshalRaw(data, (*plain)(o), &o.Raw)
+}
+
+func (b *Batch) UnmarshalJSON(data []byte) error {
+	type plain Batch
+	return unmarshalRaw(data, (*plain)(b), &b.Raw)
+}
+
+func (w *Webhook) UnmarshalJSON(data []byte) error {
+	type plain Webhook
+	return unmarshalRaw(data, (*plain)(w), &w.Raw)
+}
+
+func (d *DeliveryProduct) UnmarshalJSON(data []byte) error {
+	type plain DeliveryProduct
+	return unmarshalRaw(data, (*plain)(d), &d.Raw)
+}
+
+func (u *User) UnmarshalJSON(data []byte) error {
+	type plain User
+	return unmarshalRaw(data, (*plain)(u), &u.Raw)
+}
+
+func (a *Association) UnmarshalJSON(data []byte) error {
+	type plain Association
+	return unmarshalRaw(data, (*plain)(a), &a.Raw)
+}
+
+func (e *Event) UnmarshalJSON(data []byte) error {
+	type plain Event
+	return unmarshalRaw(data, (*plain)(e), &e.Raw)
+}
+
+func (p *Price) UnmarshalJSON(data []byte) error {
+	type plain Price
+	return unmarshalRaw(data, (*plain)(p), &p.Raw)
+}
+
+func (t *TokenResponse) UnmarshalJSON(data []byte) error {
+	type plain TokenResponse
+	return unmarshalRaw(data, (*plain)(t), &t.Raw)
+}
+
+// unmarshalRaw decodes data into v, keeping numbers in untyped fields exact
+// like decodeJSON, and keeps a copy of data in raw.
+func unmarshalRaw(data []byte, v any, raw *json.RawMessage) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	*raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+// Decode converts payload, as returned by the Raw Client methods, into
+// v, e.g. a *Document[Letter] or a *List[Batch].
+func Decode(payload map[string]any, v any) error {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// decodeResource runs a Raw request and decodes its payload into T.
+func decodeResource[T any](payload map[string]any, _ http.Header, err error) (T, error) {
+	var result T
+	if err != nil {
+		return result, err
+	}
+	if err := Decode(payload, &result); err != nil {
+		return result, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result, nil
+}
+
+// decodeData runs a Raw request and returns the resource of its document.
+func decodeData[T any](payload map[string]any, headers http.Header, err error) (T, error) {
+	document, err := decodeResource[Document[T]](payload, headers, err)
+	return document.Data, err
+}
+
+// GetToken requests an access token with the client credentials grant.
+func (c Client) GetToken(ctx context.Context, clientID, clientSecret, scope string) (TokenResponse, error) {
+	return decodeResource[TokenResponse](c.GetTokenRaw(ctx, clientID, clientSecret, scope))
+}
+
+// ExchangeCode trades an authorization code for an access and a refresh
+// token; see ExchangeCodeRaw.
+func (c Client) ExchangeCode(ctx context.Context, clientID, clientSecret, code, redirectURI, verifier string) (TokenResponse, error) {
+	return decodeResource[TokenResponse](c.ExchangeCodeRaw(ctx, clientID, clientSecret, code, redirectURI, verifier))
+}
+
+// RefreshAccessToken gets a new access token with a refresh token.
+func (c Client) RefreshAccessToken(ctx context.Context, clientID, clientSecret, refreshToken string) (TokenResponse, error) {
+	return decodeResource[TokenResponse](c.RefreshAccessTokenRaw(ctx, clientID, clientSecret, refreshToken))
+}
+
+// GetUser returns the user the access token was issued for.
+func (c Client) GetUser(ctx context.Context) (User, error) {
+	return decodeData[User](c.GetUserRaw(ctx))
+}
+
+// ListUserAssociations returns a page of the user's memberships.
+func (c Client) ListUserAssociations(ctx context.Context, params map[string]string) (List[Association], error) {
+	return decodeResource[List[Association]](c.ListUserAssociationsRaw(ctx, params))
+}
+
+// ListOrganisationAssociations returns a page of the members of an
+// organisation.
+func (c Client) ListOrganisationAssociations(ctx context.Context, orgID string, params map[string]string) (List[Association], error) {
+	return decodeResource[List[Association]](c.ListOrganisationAssociationsRaw(ctx, orgID, params))
+}
+
+// CreateOrganisationAssociation invites a user to an organisation; see
+// CreateOrganisationAssociationRaw.
+func (c Client) CreateOrganisationAssociation(ctx context.Context, orgID string, payload map[string]any) (Association, error) {
+	return decodeData[Association](c.CreateOrganisationAssociationRaw(ctx, orgID, payload))
+}
+
+// UpdateOrganisationAssociation changes the role of a member.
+func (c Client) UpdateOrganisationAssociation(ctx context.Context, orgID, associationID string, payload map[string]any) (Association, error) {
+	return decodeData[Association](c.UpdateOrganisationAssociationRaw(ctx, orgID, associationID, payload))
+}
+
+// GetOrganisation returns an organisation.
+func (c Client) GetOrganisation(ctx context.Context, orgID string) (Organisation, error) {
+	return decodeData[Organisation](c.GetOrganisationRaw(ctx, orgID))
+}
+
+// UpdateOrganisation changes organisation settings and returns the updated
+// organisation.
+func (c Client) UpdateOrganisation(ctx context.Context, orgID string, payload map[string]any) (Organisation, error) {
+	return decodeData[Organisation](c.UpdateOrganisationRaw(ctx, orgID, payload))
+}
+
+// ListOrganisations returns a page of the organisations the token can access.
+func (c Client) ListOrganisations(ctx context.Context, params map[string]string) (List[Organisation], error) {
+	return decodeResource[List[Organisation]](c.ListOrganisationsRaw(ctx, params))
+}
+
+// GetLetter returns a letter.
+func (c Client) GetLetter(ctx context.Context, orgID, letterID string) (Letter, error) {
+	return decodeData[Letter](c.GetLetterRaw(ctx, orgID, letterID))
+}
+
+// ListLetters returns a page of letters.
+func (c Client) ListLetters(ctx context.Context, orgID string, params map[string]string) (List[Letter], error) {
+	return decodeResource[List[Letter]](c.ListLettersRaw(ctx, orgID, params))
+}
+
+// CreateLetter creates a letter from an uploaded file; see CreateLetterRaw
+// for the payload.
+func (c Client) CreateLetter(ctx context.Context, orgID string, payload map[string]any, idempotencyKey string) (Letter, error) {
+	return decodeData[Letter](c.CreateLetterRaw(ctx, orgID, payload, idempotencyKey))
+}
+
+// CreateLetterFromFile uploads the PDF of upload and creates a letter from it.
+func (c Client) CreateLetterFromFile(ctx context.Context, orgID string, upload LetterUpload, uploadTimeout time.Duration) (Letter, error) {
+	payload, err := c.CreateLetterFromFileRaw(ctx, orgID, upload, uploadTimeout)
+	return decodeData[Letter](payload, nil, err)
+}
+
+// SendLetter submits a letter for printing. The letter is the zero value
+// when the API answers without a body.
+func (c Client) SendLetter(ctx context.Context, orgID, letterID string, payload map[string]any, idempotencyKey string) (Letter, error) {
+	return decodeData[Letter](c.SendLetterRaw(ctx, orgID, letterID, payload, idempotencyKey))
+}
+
+// UpdateLetter changes attributes of a letter that has not been submitted.
+func (c Client) UpdateLetter(ctx context.Context, orgID, letterID string, payload map[string]any) (Letter, error) {
+	return decodeData[Letter](c.UpdateLetterRaw(ctx, orgID, letterID, payload))
+}
+
+// ListLetterEvents returns a page of organisation-wide letter events of one
+// category (issues, undeliverable, sent or delivered).
+func (c Client) ListLetterEvents(ctx context.Context, orgID, category string, params map[string]string) (List[Event], error) {
+	return decodeResource[List[Event]](c.ListLetterEventsRaw(ctx, orgID, category, params))
+}
+
+// ListLetterEventsOf returns a page of the events of a single letter.
+func (c Client) ListLetterEventsOf(ctx context.Context, orgID, letterID string, params map[string]string) (List[Event], error) {
+	return decodeResource[List[Event]](c.ListLetterEventsOfRaw(ctx, orgID, letterID, params))
+}
+
+// CalculatePrice returns what a letter with the given attributes costs.
+func (c Client) CalculatePrice(ctx context.Context, orgID string, payload map[string]any) (Price, error) {
+	return decodeData[Price](c.CalculatePriceRaw(ctx, orgID, payload))
+}
+
+// GetBatch returns a batch.
+func (c Client) GetBatch(ctx context.Context, orgID, batchID string) (Batch, error) {
+	return decodeData[Batch](c.GetBatchRaw(ctx, orgID, batchID))
+}
+
+// ListBatches returns a page of batches.
+func (c Client) ListBatches(ctx context.Context, orgID string, params map[string]string) (List[Batch], error) {
+	return decodeResource[List[Batch]](c.ListBatchesRaw(ctx, orgID, params))
+}
+
+// CreateBatch creates a batch from an uploaded file.
+func (c Client) CreateBatch(ctx context.Context, orgID string, payload map[string]any, idempotencyKey string) (Batch, error) {
+	return decodeData[Batch](c.CreateBatchRaw(ctx, orgID, payload, idempotencyKey))
+}
+
+// SendBatch submits every letter of a batch. The batch is the zero value when
+// the API answers without a body.
+func (c Client) SendBatch(ctx context.Context, orgID, batchID string, payload map[string]any, idempotencyKey string) (Batch, error) {
+	return decodeData[Batch](c.SendBatchRaw(ctx, orgID, batchID, payload, idempotencyKey))
+}
+
+// ListBatchEvents returns a page of the events of a batch.
+func (c Client) ListBatchEvents(ctx context.Context, orgID, batchID string, params map[string]string) (List[Event], error) {
+	return decodeResource[List[Event]](c.ListBatchEventsRaw(ctx, orgID, batchID, params))
+}
+
+// GetWebhook returns a webhook subscription.
+func (c Client) GetWebhook(ctx context.Context, orgID, webhookID string) (Webhook, error) {
+	return decodeData[Webhook](c.GetWebhookRaw(ctx, orgID, webhookID))
+}
+
+// ListWebhooks returns a page of webhook subscriptions.
+func (c Client) ListWebhooks(ctx context.Context, orgID string, params map[string]string) (List[Webhook], error) {
+	return decodeResource[List[Webhook]](c.ListWebhooksRaw(ctx, orgID, params))
+}
+
+// CreateWebhook subscribes a URL to webhook events; see CreateWebhookRaw.
+func (c Client) CreateWebhook(ctx context.Context, orgID string, payload map[string]any) (Webhook, error) {
+	return decodeData[Webhook](c.CreateWebhookRaw(ctx, orgID, payload))
+}
+
+// ListDeliveryProducts returns a page of the organisation's delivery products.
+func (c Client) ListDeliveryProducts(ctx context.Context, orgID string, params map[string]string) (List[DeliveryProduct], error) {
+	return decodeResource[List[DeliveryProduct]](c.ListDeliveryProductsRaw(ctx, orgID, params))
+}
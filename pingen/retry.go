@@ -0,0 +1,125 @@
+package pingen
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// retryBaseWait is the wait before the first retry when the response does
+// not say how long to wait; it doubles with every further attempt.
+const retryBaseWait = time.Second
+
+// RetryInfo describes a request that is about to be repeated.
+type RetryInfo struct {
+	Method  string
+	URL     string
+	Attempt int
+	Retries int
+	Wait    time.Duration
+	// Status is the response status, or 0 after a network error.
+	Status int
+	Err    error
+}
+
+// shouldRetry reports whether a request may be repeated. A 429 means the
+// request was not processed, so any request can be retried. After a 5xx
+// response or a network error the request may have taken effect; only
+// methods without side effects and requests carrying an Idempotency-Key are
+// repeated then.
+func shouldRetry(req *http.Request, status int, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	if status == http.StatusTooManyRequests {
+		return true
+	}
+	if err == nil && status < 500 {
+		return false
+	}
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// retryWait returns how long to wait before retry number attempt (1-based):
+// the Retry-After header when present, otherwise an exponential backoff with
+// jitter. The result never exceeds RetryMaxWait when that is set.
+func (c Client) retryWait(attempt int, headers http.Header) time.Duration {
+	wait, ok := retryAfter(headers, time.Now())
+	if !ok {
+		backoff := retryBaseWait << uint(attempt-1)
+		wait = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+	}
+	if c.RetryMaxWait > 0 && wait > c.RetryMaxWait {
+		wait = c.RetryMaxWait
+	}
+	return wait
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func retryAfter(headers http.Header, now time.Time) (time.Duration, bool) {
+	value := headers.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := at.Sub(now); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// sleepContext waits for d and reports false if ctx ended first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// do sends the request built by newRequest, repeating it after a 429, a 5xx
+// response or a network error as allowed by Retries and shouldRetry. The
+// caller closes the body of the returned response.
+func (c Client) do(client *http.Client, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.send(client, req)
+		status := 0
+		var headers http.Header
+		if resp != nil {
+			status, headers = resp.StatusCode, resp.Header
+		}
+		if attempt > c.Retries || !shouldRetry(req, status, err) {
+			return resp, err
+		}
+		wait := c.retryWait(attempt, headers)
+		if c.OnRetry != nil {
+			c.OnRetry(RetryInfo{Method: req.Method, URL: req.URL.Scheme + "://" + req.URL.Host + req.URL.Path, Attempt: attempt, Retries: c.Retries, Wait: wait, Status: status, Err: err})
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if !sleepContext(req.Context(), wait) {
+			return nil, req.Context().Err()
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package pingen
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShouldRetry(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	networkErr := errors.New("connection reset")
+	tests := []struct {
+		name           string
+		ctx            context.Context
+		method         string
+		idempotencyKey string
+		status         int
+		err            error
+		want           bool
+	}{
+		{name: "429 on POST", method: "POST", status: 429, want: true},
+		{name: "503 on GET", method: "GET", status: 503, want: true},
+		{name: "500 on PUT", method: "PUT", status: 500, want: true},
+		{name: "500 on DELETE", method: "DELETE", status: 500, want: true},
+		{name: "500 on POST", method: "POST", status: 500, want: false},
+		{name: "500 on POST with idempotency key", method: "POST", idempotencyKey: "k", status: 500, want: true},
+		{name: "network error on PATCH", method: "PATCH", err: networkErr, want: false},
+		{name: "network error on PATCH with idempotency key", method: "PATCH", idempotencyKey: "k", err: networkErr, want: true},
+		{name: "network error on GET", method: "GET", err: networkErr, want: true},
+		{name: "200 on GET", method: "GET", status: 200, want: false},
+		{name: "404 on GET", method: "GET", status: 404, want: false},
+		{name: "422 on POST with idempotency key", method: "POST", idempotencyKey: "k", status: 422, want: false},
+		{name: "cancelled context", ctx: cancelled, method: "GET", status: 429, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			req, err := http.NewRequestWithContext(ctx, tt.method, "https://api.example.test/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.idempotencyKey != "" {
+				req.Header.Set("Idempotency-Key", tt.idempotencyKey)
+			}
+			if got := shouldRetry(req, tt.status, tt.err); got != tt.want {
+				t.Errorf("shouldRetry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{name: "missing", value: "", want: 0, wantOK: false},
+		{name: "seconds", value: "120", want: 2 * time.Minute, wantOK: true},
+		{name: "zero seconds", value: "0", want: 0, wantOK: true},
+		{name: "negative seconds", value: "-5", want: 0, wantOK: false},
+		{name: "future date", value: now.Add(90 * time.Second).Format(http.TimeFormat), want: 90 * time.Second, wantOK: true},
+		{name: "past date", value: now.Add(-time.Minute).Format(http.TimeFormat), want: 0, wantOK: true},
+		{name: "garbage", value: "soon", want: 0, wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := http.Header{}
+			if tt.value != "" {
+				headers.Set("Retry-After", tt.value)
+			}
+			got, ok := retryAfter(headers, now)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("retryAfter(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		retries      int
+		failures     int
+		failStatus   int
+		wantAttempts int32
+		wantErr      bool
+	}{
+		{name: "GET recovers after 503", method: "GET", retries: 2, failures: 2, failStatus: 503, wantAttempts: 3},
+		{name: "GET gives up after retries", method: "GET", retries: 1, failures: 3, failStatus: 503, wantAttempts: 2, wantErr: true},
+		{name: "POST retried after 429", method: "POST", retries: 2, failures: 1, failStatus: 429, wantAttempts: 2},
+		{name: "POST not retried after 503", method: "POST", retries: 2, failures: 1, failStatus: 503, wantAttempts: 1, wantErr: true},
+		{name: "retries disabled", method: "GET", retries: 0, failures: 1, failStatus: 429, wantAttempts: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != tt.method {
+					t.Errorf("method = %s, want %s", r.Method, tt.method)
+				}
+				if n := atomic.AddInt32(&attempts, 1); int(n) <= tt.failures {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(tt.failStatus)
+					return
+				}
+				w.Header().Set("Content-Type", "application/vnd.api+json")
+				w.Write([]byte(`{"data":{"id":"org","type":"organisations"}}`))
+			}))
+			defer server.Close()
+
+			client := Client{APIBase: server.URL, AccessToken: "token", Retries: tt.retries, RetryMaxWait: time.Millisecond}
+			var err error
+			if tt.method == "GET" {
+				_, _, err = client.GetOrganisationRaw(context.Background(), "org")
+			} else {
+				_, _, err = client.CreateWebhookRaw(context.Background(), "org", map[string]any{"data": map[string]any{}})
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := atomic.LoadInt32(&attempts); got != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", got, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestUploadFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "letter.pdf")
+	content := []byte("%PDF-1.4\n%%EOF\n")
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name         string
+		path         string
+		statuses     []int
+		wantAttempts int32
+		wantErr      any
+	}{
+		{name: "uploaded", path: path, statuses: []int{200}, wantAttempts: 1},
+		{name: "sent again after 503", path: path, statuses: []int{503, 200}, wantAttempts: 2},
+		{name: "rejected", path: path, statuses: []int{403}, wantAttempts: 1, wantErr: &UploadError{}},
+		{name: "missing file", path: filepath.Join(dir, "missing.pdf"), wantAttempts: 0, wantErr: &FileError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&attempts, 1)
+				body, _ := io.ReadAll(r.Body)
+				if r.Method != "PUT" || string(body) != string(content) {
+					t.Errorf("got %s with %q, want PUT with the file", r.Method, body)
+				}
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(tt.statuses[int(n)-1])
+			}))
+			defer server.Close()
+
+			client := Client{Retries: 2, RetryMaxWait: time.Millisecond}
+			err := client.UploadFile(context.Background(), server.URL+"/upload?signature=x", tt.path, time.Minute)
+			switch target := tt.wantErr.(type) {
+			case nil:
+				if err != nil {
+					t.Fatalf("UploadFile() = %v", err)
+				}
+			case *UploadError:
+				if !errors.As(err, target) {
+					t.Fatalf("UploadFile() = %v, want UploadError", err)
+				}
+			case *FileError:
+				if !errors.As(err, target) || !errors.Is(err, os.ErrNotExist) {
+					t.Fatalf("UploadFile() = %v, want FileError wrapping os.ErrNotExist", err)
+				}
+			}
+			if got := atomic.LoadInt32(&attempts); got != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", got, tt.wantAttempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package pingen
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+// SchemaNames lists the embedded request schemas (e.g. "letter-create").
+func SchemaNames() []string {
+	entries, _ := schemaFiles.ReadDir("schemas")
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Schema returns the raw JSON Schema document called name.
+func Schema(name string) ([]byte, error) {
+	content, err := schemaFiles.ReadFile("schemas/" + name + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("unknown schema %q (known: %s)", name, strings.Join(SchemaNames(), ", "))
+	}
+	return content, nil
+}
+
+// SchemaViolation is a single mismatch between a payload and its schema.
+type SchemaViolation struct {
+	Pointer string `json:"pointer"`
+	Message string `json:"message"`
+}
+
+// SchemaError lists every violation found in a payload.
+type SchemaError struct {
+	Schema     string
+	Violations []SchemaViolation
+}
+
+func (err SchemaError) Error() string {
+	parts := make([]string, 0, len(err.Violations))
+	for _, violation := range err.Violations {
+		parts = append(parts, violation.Pointer+": "+violation.Message)
+	}
+	return fmt.Sprintf("payload does not match schema %s: %s", err.Schema, strings.Join(parts, "; "))
+}
+
+// ValidatePayload checks payload against the embedded schema called name. It
+// supports the JSON Schema keywords the embedded schemas use: type,
+// properties, required, additionalProperties, enum, minLength, maxLength,
+// pattern, minimum, maximum, items, minItems, maxItems and anyOf.
+func ValidatePayload(name string, payload any) error {
+	content, err := Schema(name)
+	if err != nil {
+		return err
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(content, &schema); err != nil {
+		return fmt.Errorf("schema %s is invalid: %w", name, err)
+	}
+	// Round-trip the payload so that typed Go values ([]string, json.Number,
+	// structs) are checked in their JSON form.
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	var document any
+	if err := json.Unmarshal(encoded, &document); err != nil {
+		return err
+	}
+	violations := validateNode(schema, document, "")
+	if len(violations) > 0 {
+		return SchemaError{Schema: name, Violations: violations}
+	}
+	return nil
+}
+
+func validateNode(schema map[string]any, value any, pointer string) []SchemaViolation {
+	at := pointer
+	if at == "" {
+		at = "/"
+	}
+	fail := func(format string, args ...any) []SchemaViolation {
+		return []SchemaViolation{{Pointer: at, Message: fmt.Sprintf(format, args...)}}
+	}
+	if expected, ok := schema["type"].(string); ok && !matchesType(expected, value) {
+		return fail("expected %s, got %s", expected, jsonType(value))
+	}
+	if allowed, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, candidate := range allowed {
+			if candidate == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			names := make([]string, 0, len(allowed))
+			for _, candidate := range allowed {
+				names = append(names, fmt.Sprint(candidate))
+			}
+			return fail("must be one of %s", strings.Join(names, ", "))
+		}
+	}
+
+	violations := []SchemaViolation{}
+	switch typed := value.(type) {
+	case string:
+		length := utf8.RuneCountInString(typed)
+		if limit, ok := schema["minLength"].(float64); ok && float64(length) < limit {
+			violations = append(violations, fail("must be at least %d characters", int(limit))...)
+		}
+		if limit, ok := schema["maxLength"].(float64); ok && float64(length) > limit {
+			violations = append(violations, fail("must be at most %d characters (got %d)", int(limit), length)...)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(typed) {
+				violations = append(violations, fail("must match %s", pattern)...)
+			}
+		}
+	case float64:
+		if limit, ok := schema["minimum"].(float64); ok && typed < limit {
+			violations = append(violations, fail("must be >= %v", limit)...)
+		}
+		if limit, ok := schema["maximum"].(float64); ok && typed > limit {
+			violations = append(violations, fail("must be <= %v", limit)...)
+		}
+	case []any:
+		if limit, ok := schema["minItems"].(float64); ok && float64(len(typed)) < limit {
+			violations = append(violations, fail("must have at least %d items", int(limit))...)
+		}
+		if limit, ok := schema["maxItems"].(float64); ok && float64(len(typed)) > limit {
+			violations = append(violations, fail("must have at most %d items", int(limit))...)
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range typed {
+				violations = append(violations, validateNode(items, item, fmt.Sprintf("%s/%d", pointer, i))...)
+			}
+		}
+	case map[string]any:
+		properties, _ := schema["properties"].(map[string]any)
+		if required, ok := schema["required"].([]any); ok {
+			for _, key := range required {
+				name := fmt.Sprint(key)
+				if _, present := typed[name]; !present {
+					violations = append(violations, SchemaViolation{Pointer: pointer + "/" + name, Message: "is required"})
+				}
+			}
+		}
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			child, known := properties[key].(map[string]any)
+			if !known {
+				if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+					violations = append(violations, SchemaViolation{Pointer: pointer + "/" + key, Message: "is not allowed"})
+				}
+				continue
+			}
+			violations = append(violations, validateNode(child, typed[key], pointer+"/"+key)...)
+		}
+	}
+
+	if options, ok := schema["anyOf"].([]any); ok {
+		matched := false
+		for _, option := range options {
+			if optionSchema, ok := option.(map[string]any); ok && len(validateNode(optionSchema, value, pointer)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			violations = append(violations, fail("does not match any allowed shape (%s)", describeAnyOf(options))...)
+		}
+	}
+	return violations
+}
+
+// describeAnyOf summarises anyOf branches that only list required keys.
+func describeAnyOf(options []any) string {
+	parts := []string{}
+	for _, option := range options {
+		optionSchema, _ := option.(map[string]any)
+		required, _ := optionSchema["required"].([]any)
+		keys := []string{}
+		for _, key := range required {
+			keys = append(keys, fmt.Sprint(key))
+		}
+		if len(keys) > 0 {
+			parts = append(parts, strings.Join(keys, "+"))
+		}
+	}
+	if len(parts) == 0 {
+		return "see schema"
+	}
+	return "needs " + strings.Join(parts, " or ")
+}
+
+func matchesType(expected string, value any) bool {
+	switch expected {
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == math.Trunc(number)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	}
+	return jsonType(value) == expected
+}
+
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
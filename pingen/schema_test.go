@@ -0,0 +1,132 @@
+package pingen
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidatePayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		payload string
+		// want lists "pointer: message" prefixes expected among the
+		// violations; an empty list means the payload is valid.
+		want []string
+	}{
+		{
+			name:    "valid webhook",
+			schema:  "webhook-create",
+			payload: `{"data":{"type":"webhooks","attributes":{"event_category":"sent","url":"https://example.com/hook","signing_key":"secret"}}}`,
+		},
+		{
+			name:    "missing data",
+			schema:  "webhook-create",
+			payload: `{}`,
+			want:    []string{"/data: is required"},
+		},
+		{
+			name:    "webhook enum, pattern and length",
+			schema:  "webhook-create",
+			payload: `{"data":{"type":"webhooks","attributes":{"event_category":"opened","url":"ftp://example.com","signing_key":"0123456789abcdef0123456789abcdef0"}}}`,
+			want: []string{
+				"/data/attributes/event_category: must be one of",
+				"/data/attributes/url: ",
+				"/data/attributes/signing_key: must be at most 32 characters (got 33)",
+			},
+		},
+		{
+			name:    "unknown attribute",
+			schema:  "webhook-create",
+			payload: `{"data":{"type":"webhooks","attributes":{"event_category":"sent","url":"https://example.com","signing_key":"k","secret":"x"}}}`,
+			want:    []string{"/data/attributes/secret: is not allowed"},
+		},
+		{
+			name:    "wrong type",
+			schema:  "webhook-create",
+			payload: `{"data":{"type":"webhooks","attributes":{"event_category":"sent","url":"https://example.com","signing_key":42}}}`,
+			want:    []string{"/data/attributes/signing_key: expected string, got"},
+		},
+		{
+			name:    "valid letter send",
+			schema:  "letter-send",
+			payload: `{"data":{"id":"l1","type":"letters","attributes":{"delivery_product":"cheap","print_mode":"simplex","print_spectrum":"color"}}}`,
+		},
+		{
+			name:    "letter send without id",
+			schema:  "letter-send",
+			payload: `{"data":{"type":"letters","attributes":{"delivery_product":"","print_mode":"simplex","print_spectrum":"color"}}}`,
+			want: []string{
+				"/data/id: is required",
+				"/data/attributes/delivery_product: must be at least 1 characters",
+			},
+		},
+		{
+			name:    "valid organisation update",
+			schema:  "organisation-update",
+			payload: `{"data":{"id":"org","type":"organisations","attributes":{"default_country":"CH","data_retention_pdf":6,"limits_monthly_letters_count":250}}}`,
+		},
+		{
+			name:    "organisation update limits",
+			schema:  "organisation-update",
+			payload: `{"data":{"id":"org","type":"organisations","attributes":{"default_country":"CHE","data_retention_pdf":2,"limits_monthly_letters_count":50}}}`,
+			want: []string{
+				"/data/attributes/default_country: must be at most 2 characters (got 3)",
+				"/data/attributes/data_retention_pdf: must be one of",
+				"/data/attributes/limits_monthly_letters_count: must be >= 100",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var payload map[string]any
+			if err := json.Unmarshal([]byte(tt.payload), &payload); err != nil {
+				t.Fatal(err)
+			}
+			err := ValidatePayload(tt.schema, payload)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("ValidatePayload() = %v, want nil", err)
+				}
+				return
+			}
+			var schemaErr SchemaError
+			if !errors.As(err, &schemaErr) {
+				t.Fatalf("ValidatePayload() = %v, want SchemaError", err)
+			}
+			if schemaErr.Schema != tt.schema {
+				t.Errorf("Schema = %q, want %q", schemaErr.Schema, tt.schema)
+			}
+			if len(schemaErr.Violations) != len(tt.want) {
+				t.Errorf("got %d violations, want %d: %v", len(schemaErr.Violations), len(tt.want), err)
+			}
+			for _, want := range tt.want {
+				if !hasViolation(schemaErr.Violations, want) {
+					t.Errorf("no violation %q in %v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidatePayloadUnknownSchema(t *testing.T) {
+	err := ValidatePayload("letter-archive", map[string]any{})
+	if err == nil {
+		t.Fatal("ValidatePayload() = nil, want an error")
+	}
+	var schemaErr SchemaError
+	if errors.As(err, &schemaErr) {
+		t.Fatalf("ValidatePayload() = %v, want a lookup error rather than violations", err)
+	}
+}
+
+func hasViolation(violations []SchemaViolation, want string) bool {
+	for _, violation := range violations {
+		if strings.HasPrefix(violation.Pointer+": "+violation.Message, want) {
+			return true
+		}
+	}
+	return false
+}
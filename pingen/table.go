@@ -0,0 +1,332 @@
+package pingen
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Table is a header row and the data rows below it, read from a CSV file or
+// the first sheet of an XLSX workbook.
+type Table struct {
+	Header []string
+	Rows   [][]string
+	// Lines holds the 1-based row number in the file of each entry of Rows,
+	// for error messages that match what the user sees in a spreadsheet.
+	Lines []int
+}
+
+// TableError reports a CSV or XLSX file that cannot be read as a table.
+type TableError struct {
+	err error
+}
+
+func (err TableError) Error() string { return err.err.Error() }
+
+func (err TableError) Unwrap() error { return err.err }
+
+func tableErrorf(format string, args ...any) error {
+	return TableError{err: fmt.Errorf(format, args...)}
+}
+
+// ReadTable reads path as XLSX when it ends in .xlsx and as CSV otherwise.
+// The first row is the header; completely empty rows are dropped.
+func ReadTable(path string) (Table, error) {
+	var records [][]string
+	var lines []int
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".xlsx") {
+		records, lines, err = readXLSX(path)
+	} else {
+		records, lines, err = readCSV(path)
+	}
+	if err != nil {
+		return Table{}, err
+	}
+	table := Table{}
+	for i, record := range records {
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		if table.Header == nil {
+			table.Header = record
+			continue
+		}
+		table.Rows = append(table.Rows, record)
+		table.Lines = append(table.Lines, lines[i])
+	}
+	if table.Header == nil {
+		return Table{}, tableErrorf("table is empty: %s has no header row", path)
+	}
+	for i := range table.Header {
+		table.Header[i] = strings.TrimSpace(strings.TrimPrefix(table.Header[i], "\ufeff"))
+	}
+	return table, nil
+}
+
+func readCSV(path string) ([][]string, []int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, tableErrorf("failed to read table: %w", err)
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records := [][]string{}
+	lines := []int{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return records, lines, nil
+		}
+		if err != nil {
+			return nil, nil, tableErrorf("invalid CSV %s: %w", path, err)
+		}
+		line, _ := reader.FieldPos(0)
+		records = append(records, record)
+		lines = append(lines, line)
+	}
+}
+
+// ParseColumnMap parses a --column-map value such as "name=B,street=Strasse"
+// into field -> column reference.
+func ParseColumnMap(spec string) (map[string]string, error) {
+	columns := map[string]string{}
+	if strings.TrimSpace(spec) == "" {
+		return columns, nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		field, column, ok := strings.Cut(pair, "=")
+		field, column = strings.TrimSpace(field), strings.TrimSpace(column)
+		if !ok || field == "" || column == "" {
+			return nil, fmt.Errorf("invalid --column-map entry %q (use field=column, e.g. name=B)", pair)
+		}
+		columns[field] = column
+	}
+	return columns, nil
+}
+
+// Records maps every row to field -> value. Fields are looked up through
+// columns, where a reference is a header name or a column letter (A, B, ...,
+// AA); fields missing from columns use the header of the same name. Header
+// names match case-insensitively and win over column letters.
+func (t Table) Records(fields []string, columns map[string]string) ([]map[string]string, error) {
+	index := map[string]int{}
+	for _, field := range fields {
+		reference, mapped := columns[field]
+		if !mapped {
+			reference = field
+		}
+		column := t.column(reference)
+		if column < 0 && mapped {
+			return nil, fmt.Errorf("invalid --column-map: no column %q for %s", reference, field)
+		}
+		if column >= 0 {
+			index[field] = column
+		}
+	}
+	for field := range columns {
+		if !contains(fields, field) {
+			return nil, fmt.Errorf("invalid --column-map: unknown field %s (use %s)", field, strings.Join(fields, ", "))
+		}
+	}
+	records := make([]map[string]string, 0, len(t.Rows))
+	for _, row := range t.Rows {
+		record := map[string]string{}
+		for field, column := range index {
+			if column < len(row) {
+				record[field] = strings.TrimSpace(row[column])
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (t Table) column(reference string) int {
+	for i, name := range t.Header {
+		if strings.EqualFold(name, reference) {
+			return i
+		}
+	}
+	if column, ok := columnIndex(reference); ok {
+		return column
+	}
+	return -1
+}
+
+// columnIndex converts a column letter such as "C" or "AB" to a zero-based index.
+func columnIndex(letters string) (int, bool) {
+	if letters == "" || len(letters) > 3 {
+		return 0, false
+	}
+	index := 0
+	for _, r := range strings.ToUpper(letters) {
+		if r < 'A' || r > 'Z' {
+			return 0, false
+		}
+		index = index*26 + int(r-'A') + 1
+	}
+	return index - 1, true
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// XLSX is a zip of SpreadsheetML parts. Only what is needed to read cell
+// values of the first sheet is decoded: the workbook's sheet list, its
+// relationships, the shared string table and the sheet's cells.
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		RelationID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxText is rich or plain text; phonetic runs (rPh) are ignored.
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var text strings.Builder
+	for _, run := range t.Runs {
+		text.WriteString(run.T)
+	}
+	return text.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Number int `xml:"r,attr"`
+		Cells  []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Value  string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func readXLSX(filePath string) ([][]string, []int, error) {
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, nil, tableErrorf("invalid XLSX %s: %w", filePath, err)
+	}
+	defer archive.Close()
+	parts := map[string]*zip.File{}
+	for _, file := range archive.File {
+		parts[strings.TrimPrefix(file.Name, "/")] = file
+	}
+	decode := func(name string, target any) error {
+		part, ok := parts[name]
+		if !ok {
+			return os.ErrNotExist
+		}
+		reader, err := part.Open()
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		if err := xml.NewDecoder(reader).Decode(target); err != nil && err != io.EOF {
+			return tableErrorf("invalid XLSX %s: %s: %w", filePath, name, err)
+		}
+		return nil
+	}
+
+	sheetPath := "xl/worksheets/sheet1.xml"
+	var workbook xlsxWorkbook
+	var relationships xlsxRelationships
+	if decode("xl/workbook.xml", &workbook) == nil && len(workbook.Sheets) > 0 && decode("xl/_rels/workbook.xml.rels", &relationships) == nil {
+		for _, relationship := range relationships.Relationships {
+			if relationship.ID != workbook.Sheets[0].RelationID {
+				continue
+			}
+			if strings.HasPrefix(relationship.Target, "/") {
+				sheetPath = strings.TrimPrefix(relationship.Target, "/")
+			} else {
+				sheetPath = path.Join("xl", relationship.Target)
+			}
+		}
+	}
+
+	var shared xlsxSharedStrings
+	if err := decode("xl/sharedStrings.xml", &shared); err != nil && err != os.ErrNotExist {
+		return nil, nil, err
+	}
+	var sheet xlsxSheet
+	if err := decode(sheetPath, &sheet); err != nil {
+		if err == os.ErrNotExist {
+			return nil, nil, tableErrorf("invalid XLSX %s: no worksheet found", filePath)
+		}
+		return nil, nil, err
+	}
+
+	records := make([][]string, 0, len(sheet.Rows))
+	lines := make([]int, 0, len(sheet.Rows))
+	for i, row := range sheet.Rows {
+		if row.Number == 0 {
+			row.Number = i + 1
+		}
+		record := []string{}
+		for _, cell := range row.Cells {
+			column := len(record)
+			if cell.Ref != "" {
+				letters := strings.TrimRight(cell.Ref, "0123456789")
+				if index, ok := columnIndex(letters); ok {
+					column = index
+				}
+			}
+			for len(record) <= column {
+				record = append(record, "")
+			}
+			switch cell.Type {
+			case "s":
+				index, err := strconv.Atoi(cell.Value)
+				if err != nil || index < 0 || index >= len(shared.Items) {
+					return nil, nil, tableErrorf("invalid XLSX %s: bad shared string in cell %s", filePath, cell.Ref)
+				}
+				record[column] = shared.Items[index].String()
+			case "inlineStr":
+				record[column] = cell.Inline.String()
+			case "b":
+				record[column] = map[string]string{"1": "TRUE", "0": "FALSE"}[cell.Value]
+			default:
+				record[column] = cell.Value
+			}
+		}
+		records = append(records, record)
+		lines = append(lines, row.Number)
+	}
+	return records, lines, nil
+}
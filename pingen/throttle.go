@@ -0,0 +1,129 @@
+package pingen
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ParseRate parses a --limit-rate value in bytes per second, see ParseSize.
+func ParseRate(value string) (int64, error) {
+	rate, err := ParseSize(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q (use bytes per second, e.g. 500K or 2M)", value)
+	}
+	return rate, nil
+}
+
+// ParseSize parses a positive byte count. A K, M or G suffix multiplies by
+// 1024, 1024² or 1024³ (e.g. "512K", "2M", "1.5G").
+func ParseSize(value string) (int64, error) {
+	text := strings.TrimSpace(strings.ToUpper(value))
+	text = strings.TrimSuffix(text, "B")
+	multiplier := int64(1)
+	if text != "" {
+		switch text[len(text)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			text = text[:len(text)-1]
+		}
+	}
+	number, err := strconv.ParseFloat(text, 64)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("invalid size %q (e.g. 500K or 20M)", value)
+	}
+	return int64(number * float64(multiplier)), nil
+}
+
+// TokenBucket limits throughput to a fixed number of bytes per second. It is
+// safe for concurrent use, so one bucket can cap several uploads together.
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket returns a bucket refilling at rate bytes per second and
+// holding at most one second worth of tokens.
+func NewTokenBucket(rate int64) *TokenBucket {
+	return &TokenBucket{rate: float64(rate), burst: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// take blocks until n tokens are available and consumes them. It returns
+// early with the context's error when ctx ends.
+func (b *TokenBucket) take(ctx context.Context, n int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens < 0 {
+		// Sleeping under the lock queues concurrent readers behind us.
+		wait := time.Duration(-b.tokens / b.rate * float64(time.Second))
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			// Give back what was not waited for, so other readers are not
+			// held back by the aborted one.
+			b.tokens += float64(n)
+			return ctx.Err()
+		}
+		b.last = b.last.Add(wait)
+		b.tokens = 0
+	}
+	return nil
+}
+
+// chunk caps a single read so a read never asks for more than the burst.
+func (b *TokenBucket) chunk(n int) int {
+	limit := int(b.burst)
+	if limit < 1 {
+		limit = 1
+	}
+	if n > limit {
+		return limit
+	}
+	return n
+}
+
+type throttledReader struct {
+	reader io.Reader
+	bucket *TokenBucket
+	ctx    context.Context
+}
+
+// NewThrottledReader wraps reader so that reads drain bucket.
+func NewThrottledReader(reader io.Reader, bucket *TokenBucket) io.Reader {
+	return &throttledReader{reader: reader, bucket: bucket, ctx: context.Background()}
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n, err := r.reader.Read(p[:r.bucket.chunk(len(p))])
+	if n > 0 {
+		if waitErr := r.bucket.take(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
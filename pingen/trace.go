@@ -0,0 +1,207 @@
+package pingen
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Trace is a full HTTP exchange, for debugging. Credentials are masked:
+// credential headers, the secrets of token requests and responses, and the
+// signatures of presigned URLs.
+type Trace struct {
+	Method string
+	URL    string
+	// RequestHeader and ResponseHeader are copies; changing them has no
+	// effect on the exchange.
+	RequestHeader http.Header
+	// RequestBody is the body of API requests. File uploads are streamed
+	// and not recorded; RequestSize still gives their size.
+	RequestBody []byte
+	RequestSize int64
+	// Status is 0 when no response was received.
+	Status         int
+	ResponseHeader http.Header
+	// ResponseBody is recorded for JSON and text responses only, so that
+	// downloads are not buffered.
+	ResponseBody []byte
+	Duration     time.Duration
+	Err          error
+}
+
+// maskedValue replaces credentials in traces.
+const maskedValue = "[redacted]"
+
+// credentialFields are the form fields and JSON keys that hold credentials.
+var credentialFields = map[string]bool{
+	"client_secret": true, "access_token": true, "refresh_token": true, "id_token": true,
+	"code": true, "code_verifier": true, "password": true, "url_signature": true,
+	"file_url_signature": true,
+}
+
+// urlFields are the JSON keys that hold presigned URLs.
+var urlFields = map[string]bool{"url": true, "file_url": true}
+
+// secretQueryParts mark the query parameters of presigned URLs that grant
+// access, e.g. X-Amz-Signature.
+var secretQueryParts = []string{"sig", "credential", "token"}
+
+// trace reports an exchange to OnTrace. A JSON or text response body is read
+// and put back, so the caller still sees it.
+func (c Client) trace(req *http.Request, resp *http.Response, err error, duration time.Duration) {
+	trace := Trace{
+		Method:        req.Method,
+		URL:           maskURL(req.URL.String()),
+		RequestHeader: maskHeader(req.Header),
+		RequestSize:   req.ContentLength,
+		Duration:      duration,
+		Err:           err,
+	}
+	if req.GetBody != nil {
+		if body, bodyErr := req.GetBody(); bodyErr == nil {
+			content, _ := io.ReadAll(body)
+			body.Close()
+			trace.RequestBody = maskBody(req.Header.Get("Content-Type"), content)
+		}
+	}
+	if resp != nil {
+		trace.Status = resp.StatusCode
+		trace.ResponseHeader = maskHeader(resp.Header)
+		if textContent(resp.Header.Get("Content-Type")) {
+			content, readErr := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(content), errReader{readErr}))
+			trace.ResponseBody = maskBody(resp.Header.Get("Content-Type"), content)
+		}
+	}
+	c.OnTrace(trace)
+}
+
+// errReader returns err, or io.EOF when err is nil.
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) {
+	if r.err == nil {
+		return 0, io.EOF
+	}
+	return 0, r.err
+}
+
+func textContent(contentType string) bool {
+	return strings.Contains(contentType, "json") || strings.HasPrefix(contentType, "text/")
+}
+
+func maskHeader(header http.Header) http.Header {
+	masked := header.Clone()
+	for name, values := range masked {
+		for i, value := range values {
+			switch {
+			case name == "Authorization" || name == "Proxy-Authorization":
+				if scheme, _, ok := strings.Cut(value, " "); ok {
+					values[i] = scheme + " " + maskedValue
+				} else {
+					values[i] = maskedValue
+				}
+			case SensitiveHeader(name):
+				values[i] = maskedValue
+			case name == "Location":
+				values[i] = maskURL(value)
+			}
+		}
+	}
+	return masked
+}
+
+// maskURL masks the query parameters of rawURL that grant access.
+func maskURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.RawQuery == "" {
+		return rawURL
+	}
+	query := parsed.Query()
+	changed := false
+	for name := range query {
+		lower := strings.ToLower(name)
+		for _, part := range secretQueryParts {
+			if strings.Contains(lower, part) {
+				query.Set(name, maskedValue)
+				changed = true
+				break
+			}
+		}
+	}
+	if !changed {
+		return rawURL
+	}
+	parsed.RawQuery = unescapeMask(query.Encode())
+	return parsed.String()
+}
+
+// maskBody masks the credentialFields of a form or JSON body. Other bodies are
+// returned as they are.
+func maskBody(contentType string, body []byte) []byte {
+	switch {
+	case len(body) == 0:
+		return body
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return body
+		}
+		for name := range form {
+			if credentialFields[name] {
+				form.Set(name, maskedValue)
+			}
+		}
+		return []byte(unescapeMask(form.Encode()))
+	case strings.Contains(contentType, "json"):
+		var value any
+		if json.Unmarshal(body, &value) != nil || !maskJSON(value) {
+			return body
+		}
+		masked, err := json.Marshal(value)
+		if err != nil {
+			return body
+		}
+		return masked
+	}
+	return body
+}
+
+// unescapeMask keeps maskedValue readable in encoded queries and forms.
+func unescapeMask(encoded string) string {
+	return strings.ReplaceAll(encoded, url.QueryEscape(maskedValue), maskedValue)
+}
+
+// maskJSON masks the credentialFields of value in place and reports whether it
+// changed anything.
+func maskJSON(value any) bool {
+	changed := false
+	switch typed := value.(type) {
+	case map[string]any:
+		for key, item := range typed {
+			text, isString := item.(string)
+			switch {
+			case isString && credentialFields[key]:
+				typed[key] = maskedValue
+				changed = true
+			case isString && urlFields[key] && maskURL(text) != text:
+				typed[key] = maskURL(text)
+				changed = true
+			case maskJSON(item):
+				changed = true
+			}
+		}
+	case []any:
+		for _, item := range typed {
+			if maskJSON(item) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
@@ -0,0 +1,88 @@
+package pingen
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// TransportOptions configure the TLS of NewTransport.
+type TransportOptions struct {
+	// CAFile is a PEM file of certificates trusted in addition to the
+	// system roots, e.g. the CA of a TLS-intercepting proxy.
+	CAFile string
+	// MinTLSVersion is "1.2" (the default) or "1.3".
+	MinTLSVersion string
+}
+
+// maxIdleConnsPerHost keeps a connection per worker of bulk operations open
+// between requests; http.DefaultTransport keeps two.
+const maxIdleConnsPerHost = 32
+
+// NewTransport returns an HTTP transport for Client.Transport. It keeps
+// connections alive between requests, speaks HTTP/2 where the server
+// offers it and honours the proxy environment variables. Share one between
+// clients so they reuse its connections instead of paying a TLS handshake
+// per request.
+func NewTransport(options TransportOptions) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ForceAttemptHTTP2 = true
+	transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	transport.IdleConnTimeout = 90 * time.Second
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	switch options.MinTLSVersion {
+	case "", "1.2":
+	case "1.3":
+		config.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("invalid TLS version %q (use 1.2 or 1.3)", options.MinTLSVersion)
+	}
+	if options.CAFile != "" {
+		pem, err := os.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s contains no PEM certificates", options.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	transport.TLSClientConfig = config
+	return transport, nil
+}
+
+var (
+	sharedTransportOnce sync.Once
+	sharedTransport     http.RoundTripper
+)
+
+// transport returns Transport, or a transport shared by all clients that
+// have none.
+func (c Client) transport() http.RoundTripper {
+	if c.Transport != nil {
+		return c.Transport
+	}
+	sharedTransportOnce.Do(func() {
+		transport, err := NewTransport(TransportOptions{})
+		if err != nil {
+			sharedTransport = http.DefaultTransport
+			return
+		}
+		sharedTransport = transport
+	})
+	return sharedTransport
+}
+
+// httpClient returns an http.Client on the client's transport. It is cheap:
+// the connections live in the transport.
+func (c Client) httpClient(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: c.transport(), Timeout: timeout}
+}
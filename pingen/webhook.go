@@ -0,0 +1,30 @@
+package pingen
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// WebhookSignatureHeader carries the signature of a webhook request.
+const WebhookSignatureHeader = "Signature"
+
+// WebhookSignature is the hex HMAC-SHA256 of a webhook body keyed with the
+// signing key the webhook was registered with.
+func WebhookSignature(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature reports whether signature matches body and secret.
+// The body must be the raw request body, before any JSON decoding.
+func VerifyWebhookSignature(body []byte, signature, secret string) bool {
+	got, err := hex.DecodeString(strings.TrimSpace(signature))
+	if err != nil {
+		return false
+	}
+	want, _ := hex.DecodeString(WebhookSignature(body, secret))
+	return hmac.Equal(got, want)
+}
@@ -0,0 +1,41 @@
+package pingen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	body := []byte("The quick brown fox jumps over the lazy dog")
+	const signature = "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"
+	tests := []struct {
+		name      string
+		body      []byte
+		signature string
+		secret    string
+		want      bool
+	}{
+		{name: "valid", body: body, signature: signature, secret: "key", want: true},
+		{name: "upper case hex", body: body, signature: strings.ToUpper(signature), secret: "key", want: true},
+		{name: "surrounding whitespace", body: body, signature: " " + signature + "\n", secret: "key", want: true},
+		{name: "wrong secret", body: body, signature: signature, secret: "other", want: false},
+		{name: "modified body", body: []byte(string(body) + "."), signature: signature, secret: "key", want: false},
+		{name: "truncated signature", body: body, signature: signature[:32], secret: "key", want: false},
+		{name: "not hex", body: body, signature: "sha256=" + signature, secret: "key", want: false},
+		{name: "empty signature", body: body, signature: "", secret: "key", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyWebhookSignature(tt.body, tt.signature, tt.secret); got != tt.want {
+				t.Errorf("VerifyWebhookSignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookSignatureRoundTrip(t *testing.T) {
+	body := []byte(`{"data":{"type":"webhook_issues"}}`)
+	if !VerifyWebhookSignature(body, WebhookSignature(body, "secret"), "secret") {
+		t.Fatal("a signature from WebhookSignature does not verify")
+	}
+}
@@ -0,0 +1,224 @@
+package pingen
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlLine is a non-empty line of a YAML document with its comment removed.
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+// ParseYAML reads the block-style subset of YAML that hand-written manifests
+// use: nested mappings and sequences, plain and quoted scalars, comments, and
+// JSON-style flow values ({...}, [...]). Mappings decode to map[string]any and
+// sequences to []any. Plain scalars stay strings, so a zip code such as 8000
+// is not turned into a number; only true, false and null (or ~) are typed.
+// Anchors, tags and multi-line scalars are not supported.
+func ParseYAML(data []byte) (any, error) {
+	lines := []yamlLine{}
+	for i, raw := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		text := stripYAMLComment(raw)
+		trimmed := strings.TrimLeft(text, " ")
+		if strings.TrimSpace(trimmed) == "" || trimmed == "---" || trimmed == "..." {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("yaml line %d: tabs are not allowed for indentation", i+1)
+		}
+		lines = append(lines, yamlLine{number: i + 1, indent: len(text) - len(trimmed), text: strings.TrimRight(trimmed, " \t")})
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+	value, next, err := parseYAMLNode(lines, 0, lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if next < len(lines) {
+		return nil, fmt.Errorf("yaml line %d: unexpected indentation", lines[next].number)
+	}
+	return value, nil
+}
+
+// stripYAMLComment removes a # comment that starts the line or follows a
+// space, unless it is inside quotes.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// parseYAMLNode parses the sequence or mapping starting at lines[i], whose
+// entries are indented by indent, and returns the index after it.
+func parseYAMLNode(lines []yamlLine, i, indent int) (any, int, error) {
+	if isYAMLSequenceItem(lines[i].text) {
+		return parseYAMLSequence(lines, i, indent)
+	}
+	if _, _, ok := splitYAMLKey(lines[i].text); ok {
+		return parseYAMLMapping(lines, i, indent)
+	}
+	value, err := parseYAMLScalar(lines[i])
+	return value, i + 1, err
+}
+
+func parseYAMLSequence(lines []yamlLine, i, indent int) (any, int, error) {
+	items := []any{}
+	for i < len(lines) && lines[i].indent == indent && isYAMLSequenceItem(lines[i].text) {
+		rest := strings.TrimLeft(strings.TrimPrefix(lines[i].text, "-"), " ")
+		if rest == "" {
+			if i+1 < len(lines) && lines[i+1].indent > indent {
+				value, next, err := parseYAMLNode(lines, i+1, lines[i+1].indent)
+				if err != nil {
+					return nil, 0, err
+				}
+				items = append(items, value)
+				i = next
+				continue
+			}
+			items = append(items, nil)
+			i++
+			continue
+		}
+		// "- key: value" opens a mapping whose further keys line up with key.
+		inner := indent + len(lines[i].text) - len(rest)
+		saved := lines[i]
+		lines[i] = yamlLine{number: saved.number, indent: inner, text: rest}
+		value, next, err := parseYAMLNode(lines, i, inner)
+		lines[i] = saved
+		if err != nil {
+			return nil, 0, err
+		}
+		items = append(items, value)
+		i = next
+	}
+	return items, i, nil
+}
+
+func parseYAMLMapping(lines []yamlLine, i, indent int) (any, int, error) {
+	mapping := map[string]any{}
+	for i < len(lines) && lines[i].indent == indent && !isYAMLSequenceItem(lines[i].text) {
+		line := lines[i]
+		key, rest, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, 0, fmt.Errorf("yaml line %d: expected key: value", line.number)
+		}
+		if _, duplicate := mapping[key]; duplicate {
+			return nil, 0, fmt.Errorf("yaml line %d: duplicate key %s", line.number, key)
+		}
+		i++
+		if rest != "" {
+			value, err := parseYAMLScalar(yamlLine{number: line.number, indent: line.indent, text: rest})
+			if err != nil {
+				return nil, 0, err
+			}
+			mapping[key] = value
+			continue
+		}
+		// A nested block is indented further, except for a sequence, which
+		// may sit at the indentation of its key.
+		if i < len(lines) && (lines[i].indent > indent || lines[i].indent == indent && isYAMLSequenceItem(lines[i].text)) {
+			value, next, err := parseYAMLNode(lines, i, lines[i].indent)
+			if err != nil {
+				return nil, 0, err
+			}
+			mapping[key] = value
+			i = next
+			continue
+		}
+		mapping[key] = nil
+	}
+	if i < len(lines) && lines[i].indent > indent {
+		return nil, 0, fmt.Errorf("yaml line %d: unexpected indentation", lines[i].number)
+	}
+	return mapping, i, nil
+}
+
+// splitYAMLKey splits "key: value" or "key:" at the first colon outside
+// quotes that is followed by a space or the end of the line.
+func splitYAMLKey(text string) (string, string, bool) {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && i == 0:
+			quote = c
+		case c == '{' || c == '[':
+			if i == 0 {
+				return "", "", false
+			}
+		case c == ':' && (i+1 == len(text) || text[i+1] == ' '):
+			key := strings.TrimSpace(text[:i])
+			if unquoted, err := parseYAMLScalar(yamlLine{text: key}); err == nil {
+				if s, ok := unquoted.(string); ok {
+					key = s
+				}
+			}
+			return key, strings.TrimSpace(text[i+1:]), key != ""
+		}
+	}
+	return "", "", false
+}
+
+func parseYAMLScalar(line yamlLine) (any, error) {
+	text := line.text
+	switch {
+	case strings.HasPrefix(text, `"`):
+		value, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("yaml line %d: invalid double-quoted string", line.number)
+		}
+		return value, nil
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return nil, fmt.Errorf("yaml line %d: invalid single-quoted string", line.number)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case strings.HasPrefix(text, "{") || strings.HasPrefix(text, "["):
+		var value any
+		if err := json.Unmarshal([]byte(text), &value); err != nil {
+			return nil, fmt.Errorf("yaml line %d: only JSON-style flow values are supported: %v", line.number, err)
+		}
+		return value, nil
+	case text == "|" || text == ">" || strings.HasPrefix(text, "|") || strings.HasPrefix(text, ">"):
+		return nil, fmt.Errorf("yaml line %d: multi-line scalars are not supported", line.number)
+	case strings.HasPrefix(text, "&") || strings.HasPrefix(text, "*") || strings.HasPrefix(text, "!"):
+		return nil, fmt.Errorf("yaml line %d: anchors, aliases and tags are not supported", line.number)
+	}
+	switch text {
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	case "null", "Null", "NULL", "~":
+		return nil, nil
+	}
+	return text, nil
+}